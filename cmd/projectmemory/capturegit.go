@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/localrivet/projectmemory"
+	"github.com/localrivet/projectmemory/internal/git"
+)
+
+// runCaptureGit runs the capture-git subcommand with args and returns the
+// exit code. The report goes to stderr after each commit, and the batch of
+// the saved commits at the end, for rolling them back. With --install-hook
+// it writes a post-commit hook running the same capture instead.
+func runCaptureGit(args []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("capture-git", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	repo := flags.String("repo", ".", "directory in the repository whose commits are captured")
+	since := flags.String("since", "", "commit after which to capture, instead of the last commit captured")
+	maxCommits := flags.Int("max-commits", git.DefaultMaxCommits, "most commits captured, the newest first")
+	diffs := flags.Bool("diffs", false, "save each commit's diff along with its message")
+	statePath := flags.String("state", "", "file recording the last commit captured; empty keeps it in the repository's git directory")
+	dryRun := flags.Bool("dry-run", false, "count the commits without saving them")
+	installHook := flags.Bool("install-hook", false, "write a post-commit hook capturing every commit, and exit")
+	configPath := flags.String("config", defaultConfigPath, "configuration file")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: projectmemory capture-git [--repo DIR] [--since REV] [--max-commits N] [--diffs] [--state PATH] [--dry-run] [--install-hook] [--config PATH]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 || *maxCommits < 0 {
+		flags.Usage()
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *installHook {
+		command, err := hookCommand(*repo, *configPath, *diffs, *statePath)
+		if err == nil {
+			var path string
+			if path, err = git.InstallHook(ctx, *repo, command); err == nil {
+				fmt.Fprintf(stderr, "Installed %s\n", path)
+				return 0
+			}
+		}
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	server, err := projectmemory.NewServer(projectmemory.ServerOptions{ConfigPath: *configPath})
+	if err != nil {
+		slog.Error("Failed to create server", "error", err)
+		return 1
+	}
+	defer server.Stop()
+
+	report, batch, err := server.CaptureGit(ctx, *repo, git.Options{
+		Since:      *since,
+		MaxCommits: *maxCommits,
+		Diffs:      *diffs,
+		StatePath:  *statePath,
+		DryRun:     *dryRun,
+		Progress:   func(report git.Report) { fmt.Fprintln(stderr, report) },
+	})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprintln(stderr, report)
+	if batch != "" && report.Saved > 0 {
+		fmt.Fprintf(stderr, "Saved in batch %s\n", batch)
+	}
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// hookCommand returns the shell command a post-commit hook runs: this
+// binary capturing the repository with the configuration, by absolute
+// paths, since hooks run wherever git is run from
+func hookCommand(repo, configPath string, diffs bool, statePath string) (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	repo, err = filepath.Abs(repo)
+	if err != nil {
+		return "", err
+	}
+	configPath, err = filepath.Abs(configPath)
+	if err != nil {
+		return "", err
+	}
+	command := []string{shellQuote(executable), "capture-git", "--repo", shellQuote(repo), "--config", shellQuote(configPath)}
+	if diffs {
+		command = append(command, "--diffs")
+	}
+	if statePath != "" {
+		if statePath, err = filepath.Abs(statePath); err != nil {
+			return "", err
+		}
+		command = append(command, "--state", shellQuote(statePath))
+	}
+	return strings.Join(command, " "), nil
+}
+
+// shellQuote quotes s as a single word for sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/localrivet/projectmemory"
+	"github.com/localrivet/projectmemory/internal/config"
+)
+
+func TestRunCaptureGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	cfg := config.NewConfig()
+	cfg.Store.SQLitePath = filepath.Join(dir, "memory.db")
+	cfg.Summarizer.Provider = "basic"
+	cfg.Embedder.Provider = "mock"
+	configPath := filepath.Join(dir, "config.json")
+	if err := cfg.SaveToFile(configPath); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	repo := filepath.Join(dir, "repo")
+	gitCommand := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=Ada", "-c", "user.email=ada@example.com", "-c", "commit.gpgsign=false"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v: %s", args[0], err, out)
+		}
+	}
+	if err := os.Mkdir(repo, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	gitCommand("init", "--quiet")
+	for _, message := range []string{"Add the auth middleware", "Rotate signing keys weekly"} {
+		gitCommand("commit", "--quiet", "--allow-empty", "-m", message)
+	}
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStderr string
+	}{
+		{"dry run", []string{"--config", configPath, "--repo", repo, "--dry-run"}, 0, "2 commits: 0 saved"},
+		{"capture", []string{"--config", configPath, "--repo", repo}, 0, "Saved in batch git-"},
+		{"nothing new", []string{"--config", configPath, "--repo", repo}, 0, "0 commits: 0 saved"},
+		{"unknown commit", []string{"--config", configPath, "--repo", repo, "--since", "nosuchbranch"}, 1, "unknown commit"},
+		{"not a repository", []string{"--config", configPath, "--repo", dir}, 1, "not a git repository"},
+		{"install hook", []string{"--config", configPath, "--repo", repo, "--diffs", "--install-hook"}, 0, "Installed "},
+		{"arguments", []string{"--config", configPath, repo}, 2, "Usage"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stderr strings.Builder
+			if code := runCaptureGit(test.args, &stderr); code != test.wantCode {
+				t.Fatalf("runCaptureGit() = %d, want %d; stderr %q", code, test.wantCode, stderr.String())
+			}
+			if !strings.Contains(stderr.String(), test.wantStderr) {
+				t.Errorf("Expected stderr containing %q, got %q", test.wantStderr, stderr.String())
+			}
+		})
+	}
+
+	hook, err := os.ReadFile(filepath.Join(repo, ".git", "hooks", "post-commit"))
+	if err != nil || !strings.Contains(string(hook), "capture-git --repo '"+repo+"' --config '"+configPath+"' --diffs") {
+		t.Errorf("Expected the hook to capture the repository, got %q, %v", hook, err)
+	}
+
+	server, err := projectmemory.NewServer(projectmemory.ServerOptions{ConfigPath: configPath})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Stop()
+	batches, err := server.ListBatches()
+	if err != nil || len(batches) != 1 || batches[0].Entries != 2 {
+		t.Errorf("Expected both commits in one batch, got %+v, %v", batches, err)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/localrivet/projectmemory"
+	"github.com/localrivet/projectmemory/internal/consolidate"
+)
+
+// runConsolidate runs the consolidate subcommand with args and returns the
+// exit code. Each cluster goes to stderr once it is merged, or at the end
+// of a dry run, and the counts at the end. An interrupt stops the run,
+// leaving the clusters already merged.
+func runConsolidate(args []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("consolidate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	namespace := flags.String("namespace", "", "namespace to consolidate; empty consolidates every namespace")
+	threshold := flags.Float64("threshold", 0, "cosine similarity every two entries of a cluster reach; 0 uses the configured threshold")
+	maxClusterSize := flags.Int("max-cluster-size", 0, "most entries merged into one; 0 uses the configured size")
+	dryRun := flags.Bool("dry-run", false, "list the clusters without merging them")
+	configPath := flags.String("config", defaultConfigPath, "configuration file")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: projectmemory consolidate [--namespace NAME] [--threshold T] [--max-cluster-size N] [--dry-run] [--config PATH]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 || *threshold < 0 || *threshold > 1 || *maxClusterSize < 0 {
+		flags.Usage()
+		return 2
+	}
+
+	server, err := projectmemory.NewServer(projectmemory.ServerOptions{ConfigPath: *configPath})
+	if err != nil {
+		slog.Error("Failed to create server", "error", err)
+		return 1
+	}
+	defer server.Stop()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	report, err := server.Consolidate(ctx, consolidate.Options{
+		Threshold:      *threshold,
+		MaxClusterSize: *maxClusterSize,
+		Namespace:      *namespace,
+		DryRun:         *dryRun,
+		Progress: func(report consolidate.Report) {
+			printCluster(stderr, report.Clusters[report.Consolidated+report.Failed-1])
+		},
+	})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if *dryRun {
+		for _, cluster := range report.Clusters {
+			printCluster(stderr, cluster)
+		}
+		fmt.Fprintf(stderr, "%d clusters of %d entries found\n", len(report.Clusters), clusteredEntries(report))
+		return 0
+	}
+	fmt.Fprintln(stderr, report)
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// printCluster writes one line describing cluster to w, with the entry
+// that replaced it if it was merged
+func printCluster(w io.Writer, cluster consolidate.Cluster) {
+	if cluster.Consolidated == "" {
+		fmt.Fprintf(w, "%s: %s\n", cluster.Namespace, strings.Join(cluster.IDs, " "))
+		return
+	}
+	fmt.Fprintf(w, "%s: %s -> %s\n", cluster.Namespace, strings.Join(cluster.IDs, " "), cluster.Consolidated)
+}
+
+// clusteredEntries returns the number of entries in the clusters of report
+func clusteredEntries(report consolidate.Report) int {
+	count := 0
+	for _, cluster := range report.Clusters {
+		count += len(cluster.IDs)
+	}
+	return count
+}
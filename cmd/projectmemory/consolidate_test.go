@@ -0,0 +1,65 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/localrivet/projectmemory"
+	"github.com/localrivet/projectmemory/internal/config"
+)
+
+func TestRunConsolidate(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.NewConfig()
+	cfg.Store.SQLitePath = filepath.Join(dir, "memory.db")
+	cfg.Summarizer.Provider = "basic"
+	cfg.Embedder.Provider = "mock"
+	disabledPath := filepath.Join(dir, "disabled.json")
+	if err := cfg.SaveToFile(disabledPath); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	cfg.Consolidation.Enabled = true
+	cfg.Consolidation.Provider = "openai"
+	cfg.Consolidation.ApiKey = "sk-test"
+	configPath := filepath.Join(dir, "config.json")
+	if err := cfg.SaveToFile(configPath); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	server, err := projectmemory.NewServer(projectmemory.ServerOptions{ConfigPath: configPath})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	for _, text := range []string{"The API uses JWT tokens.", "Deploys run from the release branch."} {
+		if _, err := server.SaveContext(text); err != nil {
+			t.Fatalf("Failed to save context: %v", err)
+		}
+	}
+	server.Stop()
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStderr string
+	}{
+		{"dry run", []string{"--config", configPath, "--dry-run"}, 0, "0 clusters of 0 entries found"},
+		{"nothing to merge", []string{"--config", configPath, "--threshold", "1"}, 0, "0 clusters: 0 consolidated"},
+		{"not enabled", []string{"--config", disabledPath, "--dry-run"}, 1, "consolidation is not configured"},
+		{"invalid threshold", []string{"--config", configPath, "--threshold", "2"}, 2, "Usage"},
+		{"extra argument", []string{"--config", configPath, "docs"}, 2, "Usage"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stderr strings.Builder
+			if code := runConsolidate(test.args, &stderr); code != test.wantCode {
+				t.Fatalf("runConsolidate() = %d, want %d; stderr %q", code, test.wantCode, stderr.String())
+			}
+			if !strings.Contains(stderr.String(), test.wantStderr) {
+				t.Errorf("Expected stderr containing %q, got %q", test.wantStderr, stderr.String())
+			}
+		})
+	}
+}
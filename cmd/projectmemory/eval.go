@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/localrivet/projectmemory"
+	"github.com/localrivet/projectmemory/internal/eval"
+)
+
+// runEval runs the eval subcommand with args and returns the exit code. Each
+// preset is run against the summarizer and embedder of the configuration,
+// and a report per preset goes to stdout, as text or as one JSON object per
+// line. Running it once per configuration compares providers on the same
+// workload.
+func runEval(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("eval", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	presetFlag := flags.String("preset", "all", "comma-separated presets to run, of "+strings.Join(eval.PresetNames(), ", ")+", or \"all\"")
+	file := flags.String("file", "", "run the preset in this JSON file instead of the built-in ones")
+	k := flags.Int("k", eval.DefaultK, "results each query is judged on")
+	asJSON := flags.Bool("json", false, "print each report as a JSON object, with the results of every query")
+	configPath := flags.String("config", defaultConfigPath, "configuration file")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: projectmemory eval [--preset NAMES | --file PATH] [--k N] [--json] [--config PATH]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	presets, err := loadPresets(*presetFlag, *file)
+	if err != nil || flags.NArg() > 0 || *k <= 0 {
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+		}
+		flags.Usage()
+		return 2
+	}
+
+	server, err := projectmemory.NewServer(projectmemory.ServerOptions{ConfigPath: *configPath})
+	if err != nil {
+		slog.Error("Failed to create server", "error", err)
+		return 1
+	}
+	defer server.Stop()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	encoder := json.NewEncoder(stdout)
+	for _, preset := range presets {
+		report, err := server.Evaluate(ctx, preset, eval.Options{K: *k})
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", preset.Name, err)
+			return 1
+		}
+		if *asJSON {
+			if err := encoder.Encode(report); err != nil {
+				return 1
+			}
+			continue
+		}
+		printReport(stdout, report)
+	}
+	return 0
+}
+
+// loadPresets returns the preset in file if it is set, and otherwise the
+// built-in presets named in the comma-separated names
+func loadPresets(names, file string) ([]eval.Preset, error) {
+	if file != "" {
+		preset, err := eval.LoadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		return []eval.Preset{preset}, nil
+	}
+
+	var presets []eval.Preset
+	selected := strings.Split(names, ",")
+	if names == "all" {
+		selected = eval.PresetNames()
+	}
+	for _, name := range selected {
+		preset, err := eval.LoadPreset(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		presets = append(presets, preset)
+	}
+	return presets, nil
+}
+
+// printReport writes report to w as a summary line followed by the queries
+// that missed some of their relevant documents
+func printReport(w io.Writer, report eval.Report) {
+	fmt.Fprintf(w, "%s: %d documents, %d queries: recall@%d %.3f, MRR %.3f (indexed in %s, queried in %s)\n",
+		report.Preset, report.Documents, report.Queries, report.K, report.Recall, report.MRR,
+		report.IndexTime.Round(time.Millisecond), report.QueryTime.Round(time.Millisecond))
+	for _, result := range report.Results {
+		if result.Recall < 1 {
+			fmt.Fprintf(w, "  missed %q: want %s, got %s\n",
+				result.Query, strings.Join(result.Relevant, ", "), strings.Join(result.Retrieved, ", "))
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/localrivet/projectmemory/internal/config"
+	"github.com/localrivet/projectmemory/internal/eval"
+)
+
+func TestRunEval(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.NewConfig()
+	cfg.Store.SQLitePath = filepath.Join(dir, "memory.db")
+	cfg.Summarizer.Provider = "basic"
+	cfg.Embedder.Provider = "mock"
+	configPath := filepath.Join(dir, "config.json")
+	if err := cfg.SaveToFile(configPath); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{"all presets", []string{"--config", configPath}, 0, "research: 12 documents, 13 queries: recall@5", ""},
+		{"one preset", []string{"--config", configPath, "--preset", "code", "--k", "3"}, 0, "code: 12 documents, 13 queries: recall@3", ""},
+		{"unknown preset", []string{"--config", configPath, "--preset", "legal"}, 2, "", "unknown eval preset"},
+		{"missing file", []string{"--config", configPath, "--file", filepath.Join(dir, "missing.json")}, 2, "", "failed to read eval preset"},
+		{"invalid k", []string{"--config", configPath, "--k", "0"}, 2, "", "Usage: projectmemory eval"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout, stderr strings.Builder
+			if code := runEval(test.args, &stdout, &stderr); code != test.wantCode {
+				t.Fatalf("runEval() = %d, want %d; stderr %q", code, test.wantCode, stderr.String())
+			}
+			if !strings.Contains(stdout.String(), test.wantStdout) {
+				t.Errorf("Expected stdout containing %q, got %q", test.wantStdout, stdout.String())
+			}
+			if !strings.Contains(stderr.String(), test.wantStderr) {
+				t.Errorf("Expected stderr containing %q, got %q", test.wantStderr, stderr.String())
+			}
+		})
+	}
+
+	var stdout, stderr strings.Builder
+	if code := runEval([]string{"--config", configPath, "--preset", "meetings", "--json"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("runEval() = %d, want 0; stderr %q", code, stderr.String())
+	}
+	var report eval.Report
+	if err := json.Unmarshal([]byte(stdout.String()), &report); err != nil {
+		t.Fatalf("Expected a JSON report, got %q: %v", stdout.String(), err)
+	}
+	if report.Preset != "meetings" || len(report.Results) != report.Queries {
+		t.Errorf("Expected a meetings report with every query's results, got %+v", report)
+	}
+}
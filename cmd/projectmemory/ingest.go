@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/localrivet/projectmemory"
+	"github.com/localrivet/projectmemory/internal/ingest"
+)
+
+// runIngest runs the ingest subcommand with args and returns the exit code.
+// Progress goes to stderr after each file, and the batch of the saved
+// chunks at the end, for rolling them back. An interrupt stops the run
+// after the chunk being saved.
+func runIngest(args []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("ingest", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	chunker := flags.String("chunker", ingest.ChunkerAuto, "how files are split: auto, headings, tokens or symbols")
+	maxTokens := flags.Int("max-tokens", ingest.DefaultMaxTokens, "token budget of a chunk")
+	dryRun := flags.Bool("dry-run", false, "count the files and chunks without saving them")
+	configPath := flags.String("config", defaultConfigPath, "configuration file")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: projectmemory ingest [--chunker NAME] [--max-tokens N] [--dry-run] [--config PATH] PATH...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if _, err := ingest.NewChunker(*chunker, *maxTokens, nil); err != nil || flags.NArg() == 0 || *maxTokens < 0 {
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+		}
+		flags.Usage()
+		return 2
+	}
+
+	server, err := projectmemory.NewServer(projectmemory.ServerOptions{ConfigPath: *configPath})
+	if err != nil {
+		slog.Error("Failed to create server", "error", err)
+		return 1
+	}
+	defer server.Stop()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	report, batch, err := server.Ingest(ctx, flags.Args(), ingest.Options{
+		Chunker:   *chunker,
+		MaxTokens: *maxTokens,
+		DryRun:    *dryRun,
+		Progress:  func(report ingest.Report) { fmt.Fprintln(stderr, report) },
+	})
+	if err != nil {
+		return 1
+	}
+	fmt.Fprintln(stderr, report)
+	if batch != "" && report.Saved > 0 {
+		fmt.Fprintf(stderr, "Saved in batch %s\n", batch)
+	}
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/localrivet/projectmemory"
+	"github.com/localrivet/projectmemory/internal/config"
+)
+
+func TestRunIngest(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.NewConfig()
+	cfg.Store.SQLitePath = filepath.Join(dir, "memory.db")
+	cfg.Summarizer.Provider = "basic"
+	cfg.Embedder.Provider = "mock"
+	configPath := filepath.Join(dir, "config.json")
+	if err := cfg.SaveToFile(configPath); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	docs := filepath.Join(dir, "docs")
+	if err := os.Mkdir(docs, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	readme := "# Deploys\nDeploys run from the release branch.\n\n# Auth\nThe API uses JWT tokens.\n"
+	if err := os.WriteFile(filepath.Join(docs, "README.md"), []byte(readme), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStderr string
+	}{
+		{"dry run", []string{"--config", configPath, "--dry-run", docs}, 0, "1 files, 0 skipped: 2 chunks, 0 saved"},
+		{"ingest", []string{"--config", configPath, docs}, 0, "Saved in batch ingest-"},
+		{"unknown chunker", []string{"--config", configPath, "--chunker", "sentences", docs}, 2, "unknown chunker"},
+		{"missing paths", []string{"--config", configPath}, 2, "Usage"},
+		{"no files", []string{"--config", configPath, t.TempDir()}, 1, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stderr strings.Builder
+			if code := runIngest(test.args, &stderr); code != test.wantCode {
+				t.Fatalf("runIngest() = %d, want %d; stderr %q", code, test.wantCode, stderr.String())
+			}
+			if !strings.Contains(stderr.String(), test.wantStderr) {
+				t.Errorf("Expected stderr containing %q, got %q", test.wantStderr, stderr.String())
+			}
+		})
+	}
+
+	server, err := projectmemory.NewServer(projectmemory.ServerOptions{ConfigPath: configPath})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Stop()
+	batches, err := server.ListBatches()
+	if err != nil || len(batches) != 1 || batches[0].Entries != 2 {
+		t.Errorf("Expected both chunks in one batch, got %+v, %v", batches, err)
+	}
+}
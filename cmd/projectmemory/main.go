@@ -2,17 +2,15 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
-	"os/signal"
 	"strings"
-	"syscall"
 
 	"github.com/localrivet/projectmemory"
 	"github.com/localrivet/projectmemory/internal/config"
-	"github.com/localrivet/projectmemory/internal/contextstore"
 )
 
 const (
@@ -25,10 +23,39 @@ func main() {
 	// Set up logging with slog
 	setupSlog()
 
-	// Get configuration path from arguments or use default
+	// Parse flags; the configuration path is the optional positional argument
+	chaosMode := flag.Bool("chaos", false, "inject faults into the store, summarizer and embedder (development only)")
+	recordCassette := flag.String("record", "", "record provider HTTP traffic to this cassette file, with API keys redacted")
+	replayCassette := flag.String("replay", "", "answer provider HTTP requests from this cassette file instead of the network")
+	snapshot := flag.Bool("snapshot", false, "write a snapshot of every namespace to the archive target and exit")
+	restoreSnapshot := flag.String("restore-snapshot", "", "restore the snapshot with this ID, or \"latest\", from the archive target and exit")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: projectmemory [flags] [CONFIG]\n       projectmemory search [--ndjson] [--limit N] [--config PATH] QUERY...\n       projectmemory pick [--limit N] [--copy] [--builtin] [--config PATH] QUERY...\n       projectmemory regenerate --filter FILTER [--batch-size N] [--interval D] [--state PATH] [--dry-run] [--config PATH]\n       projectmemory eval [--preset NAMES | --file PATH] [--k N] [--json] [--config PATH]\n       projectmemory ingest [--chunker NAME] [--max-tokens N] [--dry-run] [--config PATH] PATH...\n       projectmemory capture-git [--repo DIR] [--since REV] [--max-commits N] [--diffs] [--state PATH] [--dry-run] [--install-hook] [--config PATH]\n       projectmemory consolidate [--namespace NAME] [--threshold T] [--max-cluster-size N] [--dry-run] [--config PATH]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// Subcommands do their work and exit without serving
+	switch flag.Arg(0) {
+	case "search":
+		os.Exit(runSearch(flag.Args()[1:], os.Stdout, os.Stderr))
+	case "pick":
+		os.Exit(runPick(flag.Args()[1:]))
+	case "regenerate":
+		os.Exit(runRegenerate(flag.Args()[1:], os.Stderr))
+	case "eval":
+		os.Exit(runEval(flag.Args()[1:], os.Stdout, os.Stderr))
+	case "ingest":
+		os.Exit(runIngest(flag.Args()[1:], os.Stderr))
+	case "capture-git":
+		os.Exit(runCaptureGit(flag.Args()[1:], os.Stderr))
+	case "consolidate":
+		os.Exit(runConsolidate(flag.Args()[1:], os.Stderr))
+	}
+
 	configPath := defaultConfigPath
-	if len(os.Args) > 1 {
-		configPath = os.Args[1]
+	if flag.NArg() > 0 {
+		configPath = flag.Arg(0)
 	}
 
 	slog.Info("ProjectMemory MCP Server - Starting...")
@@ -58,6 +85,10 @@ func main() {
 	// Create the server
 	server, err := projectmemory.NewServer(projectmemory.ServerOptions{
 		ConfigPath: configPath,
+		Chaos:      *chaosMode,
+
+		RecordCassette: *recordCassette,
+		ReplayCassette: *replayCassette,
 		// Let it use slog.Default() for logging (set up in setupSlog)
 	})
 	if err != nil {
@@ -65,22 +96,28 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Initialize components
-	store, err := initStore()
-	if err != nil {
-		slog.Error("Failed to initialize SQLite context store", "error", err)
-		os.Exit(1)
+	// Snapshots are taken and restored without serving
+	if *snapshot || *restoreSnapshot != "" {
+		if *snapshot {
+			_, err = server.Snapshot()
+		} else {
+			_, err = server.RestoreSnapshot(*restoreSnapshot)
+		}
+		server.Stop()
+		if err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
 	}
-	slog.Info("SQLite context store initialized")
 
-	// Set up signal handler for graceful shutdown
-	setupSignalHandler(store)
-
-	// Start the server
+	// Start the server. It stops itself on SIGINT and SIGTERM.
 	slog.Info("Starting MCP server...")
 	err = server.Start()
+	if stopErr := server.Stop(); err == nil {
+		err = stopErr
+	}
 	if err != nil {
-		slog.Error("Failed to start MCP server", "error", err)
+		slog.Error("MCP server failed", "error", err)
 		os.Exit(1)
 	}
 }
@@ -168,42 +205,3 @@ func setupSlog() {
 		// Consider logging important startup messages before setting handler to io.Discard if they must be seen.
 	}
 }
-
-func initStore() (contextstore.ContextStore, error) {
-	// Get database path from environment or use default
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = config.DefaultSQLitePath // Use the default from config package
-	}
-
-	// Initialize SQLite store
-	slog.Info("Initializing SQLite store", "path", dbPath)
-	store := contextstore.NewSQLiteContextStore()
-	err := store.Initialize(dbPath)
-	if err != nil {
-		slog.Error("Failed to initialize SQLite context store", "error", err, "path", dbPath)
-		return nil, err
-	}
-
-	return store, nil
-}
-
-func setupSignalHandler(store contextstore.ContextStore) {
-	// Create channel to receive signals
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-
-	// Handle signals in a goroutine
-	go func() {
-		<-c
-		slog.Info("Shutting down gracefully...")
-
-		// Close the store
-		err := store.Close()
-		if err != nil {
-			slog.Error("Error closing store during shutdown", "error", err)
-		}
-
-		os.Exit(0)
-	}()
-}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/localrivet/projectmemory"
+)
+
+// defaultPickLimit is how many results the picker offers by default
+const defaultPickLimit = 20
+
+// errNoChoice is returned when the picker is left without choosing an entry
+var errNoChoice = errors.New("no entry chosen")
+
+// clipboardCommands are the commands tried, in order, to copy to the
+// clipboard
+var clipboardCommands = [][]string{
+	{"pbcopy"},
+	{"wl-copy"},
+	{"xclip", "-selection", "clipboard"},
+	{"xsel", "--clipboard", "--input"},
+	{"clip.exe"},
+}
+
+// runPick runs the pick subcommand with args and returns the exit code. The
+// chosen entry's summary goes to stdout, or to the clipboard with --copy.
+func runPick(args []string) int {
+	flags := flag.NewFlagSet("pick", flag.ContinueOnError)
+	limit := flags.Int("limit", defaultPickLimit, "most results to pick from")
+	configPath := flags.String("config", defaultConfigPath, "configuration file")
+	copyChoice := flags.Bool("copy", false, "copy the chosen summary to the clipboard instead of printing it")
+	builtin := flags.Bool("builtin", false, "use the built-in picker even if fzf is installed")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: projectmemory pick [--limit N] [--copy] [--builtin] [--config PATH] QUERY...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	query := strings.TrimSpace(strings.Join(flags.Args(), " "))
+	if query == "" {
+		flags.Usage()
+		return 2
+	}
+
+	server, err := projectmemory.NewServer(projectmemory.ServerOptions{ConfigPath: *configPath})
+	if err != nil {
+		slog.Error("Failed to create server", "error", err)
+		return 1
+	}
+	results, err := server.SearchContext(query, *limit)
+	server.Stop()
+	if err != nil {
+		return 1
+	}
+	if len(results) == 0 {
+		fmt.Fprintln(os.Stderr, "No entries match the query.")
+		return 1
+	}
+
+	var chosen projectmemory.SearchResult
+	if fzf, lookErr := exec.LookPath("fzf"); lookErr == nil && !*builtin {
+		chosen, err = pickWithFzf(fzf, results)
+	} else {
+		chosen, err = pickBuiltin(os.Stdin, os.Stderr, results)
+	}
+	if errors.Is(err, errNoChoice) {
+		return 130
+	}
+	if err != nil {
+		slog.Error("Failed to pick an entry", "error", err)
+		return 1
+	}
+
+	if *copyChoice {
+		if err := copyToClipboard(chosen.Summary); err != nil {
+			slog.Error("Failed to copy to the clipboard", "error", err)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "Copied %s to the clipboard.\n", chosen.ID)
+		return 0
+	}
+	fmt.Println(chosen.Summary)
+	return 0
+}
+
+// fzfArgs are the fzf options of the picker. Each input line is the score,
+// heading and ID separated by tabs: fzf shows the first two fields and
+// matches only the second. The ID comes last so the heading is field 2
+// whether fzf counts fields before or after hiding the ID.
+var fzfArgs = []string{"--delimiter=\t", "--with-nth=1..2", "--nth=2", "--no-sort", "--prompt=memory> "}
+
+// pickWithFzf lets the user choose one of results with the fzf binary at
+// path. Each line shows the score and heading and is matched on the
+// heading; the ID is hidden and used to find the choice.
+func pickWithFzf(path string, results []projectmemory.SearchResult) (projectmemory.SearchResult, error) {
+	var input bytes.Buffer
+	for _, result := range results {
+		fmt.Fprintln(&input, fzfLine(result))
+	}
+
+	cmd := exec.Command(path, fzfArgs...)
+	cmd.Stdin = &input
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && (exitErr.ExitCode() == 1 || exitErr.ExitCode() == 130) {
+		// fzf exits 1 without a match and 130 when interrupted
+		return projectmemory.SearchResult{}, errNoChoice
+	}
+	if err != nil {
+		return projectmemory.SearchResult{}, fmt.Errorf("fzf failed: %w", err)
+	}
+
+	return fzfChoice(string(output), results)
+}
+
+// fzfLine formats result as a line of fzf input
+func fzfLine(result projectmemory.SearchResult) string {
+	return fmt.Sprintf("%.3f\t%s\t%s", result.Score, heading(result), result.ID)
+}
+
+// fzfChoice returns the result of the line fzf printed
+func fzfChoice(line string, results []projectmemory.SearchResult) (projectmemory.SearchResult, error) {
+	line = strings.TrimRight(line, "\r\n")
+	id := line[strings.LastIndex(line, "\t")+1:]
+	for _, result := range results {
+		if result.ID == id {
+			return result, nil
+		}
+	}
+	return projectmemory.SearchResult{}, errNoChoice
+}
+
+// pickBuiltin lets the user choose one of results without fzf. The
+// candidates are listed on out, numbered, by heading; entering a number
+// chooses that entry, and entering text narrows the list to the entries
+// whose title or summary fuzzily matches it. An empty line chooses the first candidate.
+func pickBuiltin(in io.Reader, out io.Writer, results []projectmemory.SearchResult) (projectmemory.SearchResult, error) {
+	reader := bufio.NewReader(in)
+	candidates := results
+	for {
+		for i, result := range candidates {
+			fmt.Fprintf(out, "%3d  %.3f  %s\n", i+1, result.Score, truncate(heading(result), 100))
+		}
+		fmt.Fprint(out, "Number, filter text, or empty for the first: ")
+
+		line, err := reader.ReadString('\n')
+		if err != nil && (line == "" || !errors.Is(err, io.EOF)) {
+			return projectmemory.SearchResult{}, errNoChoice
+		}
+		line = strings.TrimSpace(line)
+
+		if line == "" {
+			return candidates[0], nil
+		}
+		if n, err := strconv.Atoi(line); err == nil {
+			if n >= 1 && n <= len(candidates) {
+				return candidates[n-1], nil
+			}
+			fmt.Fprintf(out, "Choose a number from 1 to %d.\n", len(candidates))
+			continue
+		}
+
+		var matched []projectmemory.SearchResult
+		for _, result := range candidates {
+			if fuzzyMatch(line, result.Title) || fuzzyMatch(line, result.Summary) {
+				matched = append(matched, result)
+			}
+		}
+		if len(matched) == 0 {
+			fmt.Fprintf(out, "Nothing matches %q.\n", line)
+			continue
+		}
+		if len(matched) == 1 {
+			return matched[0], nil
+		}
+		candidates = matched
+	}
+}
+
+// fuzzyMatch reports whether the runes of pattern appear in text in order,
+// ignoring case and spaces in pattern, like fzf's default matching
+func fuzzyMatch(pattern, text string) bool {
+	text = strings.ToLower(text)
+	for _, r := range strings.ToLower(pattern) {
+		if r == ' ' {
+			continue
+		}
+		i := strings.IndexRune(text, r)
+		if i < 0 {
+			return false
+		}
+		text = text[i+len(string(r)):]
+	}
+	return true
+}
+
+// copyToClipboard copies text with the first clipboard command installed
+func copyToClipboard(text string) error {
+	for _, command := range clipboardCommands {
+		path, err := exec.LookPath(command[0])
+		if err != nil {
+			continue
+		}
+		cmd := exec.Command(path, command[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		return cmd.Run()
+	}
+	return errors.New("no clipboard command found; install pbcopy, wl-copy, xclip or xsel")
+}
+
+// heading returns the title of result, or its summary on one line if it has
+// no title
+func heading(result projectmemory.SearchResult) string {
+	if result.Title != "" {
+		return result.Title
+	}
+	return oneLine(result.Summary)
+}
+
+// oneLine joins the lines of text with single spaces
+func oneLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// truncate shortens text to at most n runes, marking the cut with "..."
+func truncate(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n-3]) + "..."
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/localrivet/projectmemory"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		pattern, text string
+		want          bool
+	}{
+		{"", "anything", true},
+		{"jwt", "The API uses JWT tokens", true},
+		{"apjwt", "The API uses JWT tokens", true},
+		{"api jwt", "The API uses JWT tokens", true},
+		{"jwt api", "The API uses JWT tokens", false},
+		{"tokenz", "The API uses JWT tokens", false},
+		{"ü", "Über", true},
+		{"db", "", false},
+	}
+
+	for _, test := range tests {
+		if got := fuzzyMatch(test.pattern, test.text); got != test.want {
+			t.Errorf("fuzzyMatch(%q, %q) = %v, want %v", test.pattern, test.text, got, test.want)
+		}
+	}
+}
+
+func TestPickBuiltin(t *testing.T) {
+	results := []projectmemory.SearchResult{
+		{ID: "a", Score: 0.9, Summary: "The API uses JWT tokens for authentication."},
+		{ID: "b", Score: 0.8, Summary: "Database migrations live in db/migrations."},
+		{ID: "c", Score: 0.7, Summary: "Deploys run from the release branch."},
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{"empty line chooses the first", "\n", "a", nil},
+		{"number", "2\n", "b", nil},
+		{"number without newline", "3", "c", nil},
+		{"out of range number asks again", "7\n3\n", "c", nil},
+		{"single match chooses it", "migr\n", "b", nil},
+		{"filter then number", "de\n2\n", "c", nil},
+		{"no match asks again", "zzz\n1\n", "a", nil},
+		{"end of input", "", "", errNoChoice},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out strings.Builder
+			got, err := pickBuiltin(strings.NewReader(test.input), &out, results)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("pickBuiltin() error = %v, want %v", err, test.wantErr)
+			}
+			if got.ID != test.want {
+				t.Errorf("pickBuiltin() = %q, want %q\n%s", got.ID, test.want, out.String())
+			}
+		})
+	}
+}
+
+func TestFzfChoice(t *testing.T) {
+	results := []projectmemory.SearchResult{
+		{ID: "a", Score: 0.9, Summary: "First\nentry"},
+		{ID: "b", Score: 0.8, Summary: "Second entry"},
+		{ID: "c", Score: 0.7, Summary: "Third entry, with a title", Title: "Third"},
+	}
+
+	line := fzfLine(results[1])
+	if fields := strings.Split(line, "\t"); len(fields) != 3 || fields[1] != "Second entry" {
+		t.Errorf("fzfLine() = %q, want the summary as the second of three fields", line)
+	}
+	if fields := strings.Split(fzfLine(results[2]), "\t"); fields[1] != "Third" {
+		t.Errorf("fzfLine() = %q, want the title as the second field", fzfLine(results[2]))
+	}
+	got, err := fzfChoice(line+"\n", results)
+	if err != nil || got.ID != "b" {
+		t.Errorf("fzfChoice() = %q, %v, want b", got.ID, err)
+	}
+	if _, err := fzfChoice("0.500\tGone\tz\n", results); !errors.Is(err, errNoChoice) {
+		t.Errorf("fzfChoice() of an unknown ID error = %v, want errNoChoice", err)
+	}
+}
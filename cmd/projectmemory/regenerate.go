@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/localrivet/projectmemory"
+	"github.com/localrivet/projectmemory/internal/regenerate"
+)
+
+// runRegenerate runs the regenerate subcommand with args and returns the exit
+// code. Progress goes to stderr after each batch. An interrupt stops the run
+// after the entry being regenerated, leaving the state file to resume from.
+func runRegenerate(args []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("regenerate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	filterFlag := flags.String("filter", "", "entries to regenerate: \"all\" or key=value pairs of summarizer, provider, model and prompt_version, such as summarizer=basic")
+	batchSize := flags.Int("batch-size", regenerate.DefaultBatchSize, "entries to regenerate between checkpoints")
+	interval := flags.Duration("interval", 0, "wait between batches, to stay within provider rate limits")
+	statePath := flags.String("state", ".projectmemory-regenerate.json", "file recording finished entries, so an interrupted run can be resumed; empty disables it")
+	dryRun := flags.Bool("dry-run", false, "count the matching entries without changing them")
+	configPath := flags.String("config", defaultConfigPath, "configuration file")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: projectmemory regenerate --filter FILTER [--batch-size N] [--interval D] [--state PATH] [--dry-run] [--config PATH]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	filter, err := regenerate.ParseFilter(*filterFlag)
+	if err != nil || flags.NArg() > 0 {
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+		}
+		flags.Usage()
+		return 2
+	}
+
+	server, err := projectmemory.NewServer(projectmemory.ServerOptions{ConfigPath: *configPath})
+	if err != nil {
+		slog.Error("Failed to create server", "error", err)
+		return 1
+	}
+	defer server.Stop()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	progress, err := server.Regenerate(ctx, regenerate.Options{
+		Filter:    filter,
+		BatchSize: *batchSize,
+		Interval:  *interval,
+		StatePath: *statePath,
+		DryRun:    *dryRun,
+		Progress:  func(progress regenerate.Progress) { printProgress(stderr, progress) },
+	})
+	if err != nil {
+		return 1
+	}
+	if *dryRun {
+		fmt.Fprintf(stderr, "%d entries match %s\n", progress.Total, filter)
+		return 0
+	}
+	printProgress(stderr, progress)
+	if progress.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// printProgress writes one line of progress counts to w
+func printProgress(w io.Writer, progress regenerate.Progress) {
+	fmt.Fprintf(w, "%d/%d done: %d regenerated, %d skipped, %d failed\n",
+		progress.Done, progress.Total, progress.Regenerated, progress.Skipped, progress.Failed)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/localrivet/projectmemory"
+	"github.com/localrivet/projectmemory/internal/config"
+)
+
+func TestRunRegenerate(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.NewConfig()
+	cfg.Store.SQLitePath = filepath.Join(dir, "memory.db")
+	cfg.Summarizer.Provider = "basic"
+	cfg.Embedder.Provider = "mock"
+	configPath := filepath.Join(dir, "config.json")
+	if err := cfg.SaveToFile(configPath); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	server, err := projectmemory.NewServer(projectmemory.ServerOptions{ConfigPath: configPath})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	for _, text := range []string{"The API uses JWT tokens.", "Deploys run from the release branch."} {
+		if _, err := server.SaveContext(text); err != nil {
+			t.Fatalf("Failed to save context: %v", err)
+		}
+	}
+	server.Stop()
+
+	statePath := filepath.Join(dir, "regenerate.json")
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStderr string
+	}{
+		{"dry run", []string{"--config", configPath, "--filter", "summarizer=basic", "--dry-run"}, 0, "2 entries match summarizer=basic"},
+		{"no match", []string{"--config", configPath, "--filter", "summarizer=ai", "--state", statePath}, 0, "0/0 done"},
+		{"regenerate", []string{"--config", configPath, "--filter", "summarizer=basic", "--batch-size", "1", "--state", statePath}, 0, "1/2 done: 1 regenerated"},
+		{"missing filter", []string{"--config", configPath}, 2, "use \"all\""},
+		{"invalid filter", []string{"--config", configPath, "--filter", "colour=red"}, 2, "unknown key"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stderr strings.Builder
+			if code := runRegenerate(test.args, &stderr); code != test.wantCode {
+				t.Fatalf("runRegenerate() = %d, want %d; stderr %q", code, test.wantCode, stderr.String())
+			}
+			if !strings.Contains(stderr.String(), test.wantStderr) {
+				t.Errorf("Expected stderr containing %q, got %q", test.wantStderr, stderr.String())
+			}
+		})
+	}
+}
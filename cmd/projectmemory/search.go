@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/localrivet/projectmemory"
+	"github.com/localrivet/projectmemory/internal/tools"
+)
+
+// runSearch runs the search subcommand with args and returns the exit code.
+// Results go to stdout, one per line; usage errors go to stderr and logs stay
+// with slog.
+func runSearch(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("search", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	ndjson := flags.Bool("ndjson", false, "print one JSON object per result with id, score, tags, summary, title and generation")
+	limit := flags.Int("limit", tools.DefaultRetrieveLimit, "most results to print")
+	configPath := flags.String("config", defaultConfigPath, "configuration file")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: projectmemory search [--ndjson] [--limit N] [--config PATH] QUERY...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	query := strings.TrimSpace(strings.Join(flags.Args(), " "))
+	if query == "" {
+		flags.Usage()
+		return 2
+	}
+
+	server, err := projectmemory.NewServer(projectmemory.ServerOptions{ConfigPath: *configPath})
+	if err != nil {
+		slog.Error("Failed to create server", "error", err)
+		return 1
+	}
+	defer server.Stop()
+
+	results, err := server.SearchContext(query, *limit)
+	if err != nil {
+		return 1
+	}
+	if err := printResults(stdout, results, *ndjson); err != nil {
+		slog.Error("Failed to print search results", "error", err)
+		return 1
+	}
+	return 0
+}
+
+// printResults writes results to w, as NDJSON or as tab-separated score, ID
+// and heading lines
+func printResults(w io.Writer, results []projectmemory.SearchResult, ndjson bool) error {
+	encoder := json.NewEncoder(w)
+	for _, result := range results {
+		var err error
+		if ndjson {
+			err = encoder.Encode(result)
+		} else {
+			_, err = fmt.Fprintf(w, "%.3f\t%s\t%s\n", result.Score, result.ID, heading(result))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/localrivet/projectmemory"
+	"github.com/localrivet/projectmemory/internal/config"
+)
+
+func TestPrintResults(t *testing.T) {
+	results := []projectmemory.SearchResult{
+		{ID: "a", Score: 0.91234, Tags: []string{"auth"}, Summary: "The API uses\nJWT tokens."},
+		{ID: "b", Score: 0.5, Summary: "Deploys run from the release branch."},
+		{ID: "c", Score: 0.25, Summary: "Releases are tagged vX.Y.Z.\nTags trigger the publish job.", Title: "Release tagging"},
+	}
+
+	var out strings.Builder
+	if err := printResults(&out, results, false); err != nil {
+		t.Fatalf("printResults() error = %v", err)
+	}
+	want := "0.912\ta\tThe API uses JWT tokens.\n0.500\tb\tDeploys run from the release branch.\n0.250\tc\tRelease tagging\n"
+	if out.String() != want {
+		t.Errorf("printResults() = %q, want %q", out.String(), want)
+	}
+
+	out.Reset()
+	if err := printResults(&out, results, true); err != nil {
+		t.Fatalf("printResults() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 NDJSON lines, got %q", out.String())
+	}
+	var first projectmemory.SearchResult
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("Failed to decode NDJSON line %q: %v", lines[0], err)
+	}
+	if first.ID != "a" || first.Summary != results[0].Summary || len(first.Tags) != 1 {
+		t.Errorf("Unexpected NDJSON result %+v", first)
+	}
+	if !strings.Contains(lines[2], `"title":"Release tagging"`) || strings.Contains(lines[0], `"title"`) {
+		t.Errorf("Expected a title only on the titled result, got %q", out.String())
+	}
+}
+
+func TestRunSearch(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.NewConfig()
+	cfg.Store.SQLitePath = filepath.Join(dir, "memory.db")
+	cfg.Summarizer.Provider = "basic"
+	cfg.Embedder.Provider = "mock"
+	configPath := filepath.Join(dir, "config.json")
+	if err := cfg.SaveToFile(configPath); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	server, err := projectmemory.NewServer(projectmemory.ServerOptions{ConfigPath: configPath})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	for _, text := range []string{"The API uses JWT tokens.", "Deploys run from the release branch."} {
+		if _, err := server.SaveContext(text); err != nil {
+			t.Fatalf("Failed to save context: %v", err)
+		}
+	}
+	server.Stop()
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{"tab-separated", []string{"--config", configPath, "--limit", "1", "Deploys run from the release branch."}, 0, "\tDeploys run from the release branch\n", ""},
+		{"ndjson", []string{"--config", configPath, "--ndjson", "--limit=1", "Deploys", "run from the release branch."}, 0, `"summary":"Deploys run from the release branch."`, ""},
+		{"missing query", []string{"--config", configPath, " "}, 2, "", "Usage: projectmemory search"},
+		{"unknown flag", []string{"--json", "query"}, 2, "", "flag provided but not defined"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout, stderr strings.Builder
+			if code := runSearch(test.args, &stdout, &stderr); code != test.wantCode {
+				t.Fatalf("runSearch() = %d, want %d; stderr %q", code, test.wantCode, stderr.String())
+			}
+			if !strings.Contains(stdout.String(), test.wantStdout) || (test.wantStdout == "" && stdout.Len() > 0) {
+				t.Errorf("Expected stdout containing %q, got %q", test.wantStdout, stdout.String())
+			}
+			if strings.Count(stdout.String(), "\n") > 1 {
+				t.Errorf("Expected at most one result with --limit 1, got %q", stdout.String())
+			}
+			if !strings.Contains(stderr.String(), test.wantStderr) {
+				t.Errorf("Expected stderr containing %q, got %q", test.wantStderr, stderr.String())
+			}
+		})
+	}
+}
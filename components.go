@@ -0,0 +1,49 @@
+package projectmemory
+
+import (
+	"errors"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/summarizer"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+// ErrIncompleteComponents is returned by NewServer when some but not all of
+// ServerOptions.Store, Summarizer and Embedder are set.
+var ErrIncompleteComponents = errors.New("store, summarizer and embedder must be set together")
+
+// ContextStore stores context entries and searches them by similarity.
+type ContextStore = contextstore.ContextStore
+
+// Summarizer condenses text before it is embedded and stored.
+type Summarizer = summarizer.Summarizer
+
+// Embedder turns text into embeddings.
+type Embedder = vector.Embedder
+
+// MemoryStore is a ContextStore held in memory. It is intended for tests,
+// examples and short-lived processes where persistence is not required.
+type MemoryStore = contextstore.MemoryContextStore
+
+// DefaultEmbeddingDimensions is the size of the embeddings made by the
+// default embedder.
+const DefaultEmbeddingDimensions = vector.DefaultEmbeddingDimensions
+
+// NewMemoryStore returns an empty MemoryStore, ready to use.
+func NewMemoryStore() *MemoryStore {
+	return contextstore.NewMemoryContextStore()
+}
+
+// NewFakeSummarizer returns a ready Summarizer that calls no provider: it
+// shortens text to the default summary length, so short text is its own
+// summary.
+func NewFakeSummarizer() Summarizer {
+	return summarizer.NewBasicSummarizer(summarizer.DefaultMaxSummaryLength)
+}
+
+// NewFakeEmbedder returns a ready Embedder that calls no provider: it
+// derives an embedding of the given size from a hash of the text, so equal
+// texts get equal embeddings. A size of 0 or less uses 128.
+func NewFakeEmbedder(dimensions int) Embedder {
+	return vector.NewMockEmbedder(dimensions)
+}
@@ -0,0 +1,327 @@
+package projectmemory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/contextstore/storetest"
+	"github.com/localrivet/projectmemory/internal/git"
+	"github.com/localrivet/projectmemory/internal/ingest"
+	"github.com/localrivet/projectmemory/internal/server"
+	"github.com/localrivet/projectmemory/internal/summarizer"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+func TestMemoryStoreContract(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) contextstore.ContextStore {
+		return NewMemoryStore()
+	})
+}
+
+func TestNewServerWithComponents(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+	srv, err := NewServer(ServerOptions{
+		Logger:     logger,
+		Store:      NewMemoryStore(),
+		Summarizer: NewFakeSummarizer(),
+		Embedder:   NewFakeEmbedder(0),
+	})
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	defer srv.Stop()
+
+	if _, ok := srv.GetStore().(*MemoryStore); !ok {
+		t.Errorf("GetStore() = %T, want the provided *MemoryStore", srv.GetStore())
+	}
+	if _, err := srv.SaveContext("Deploys run from the release branch."); err != nil {
+		t.Fatalf("SaveContext() error = %v", err)
+	}
+	results, err := srv.RetrieveContext("Deploys run from the release branch.", 1)
+	if err != nil {
+		t.Fatalf("RetrieveContext() error = %v", err)
+	}
+	if len(results) != 1 || results[0] != "Deploys run from the release branch." {
+		t.Errorf("RetrieveContext() = %q, want the saved text", results)
+	}
+
+	_, err = NewServer(ServerOptions{Logger: logger, Store: NewMemoryStore()})
+	if !errors.Is(err, ErrIncompleteComponents) {
+		t.Errorf("NewServer() with only a store error = %v, want ErrIncompleteComponents", err)
+	}
+}
+
+func TestServerQuery(t *testing.T) {
+	srv, err := NewServer(ServerOptions{
+		Logger:     slog.New(slog.DiscardHandler),
+		Store:      NewMemoryStore(),
+		Summarizer: NewFakeSummarizer(),
+		Embedder:   NewFakeEmbedder(0),
+	})
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	defer srv.Stop()
+
+	id, err := srv.SaveContext("Deploys run from the release branch.")
+	if err != nil {
+		t.Fatalf("SaveContext() error = %v", err)
+	}
+	if _, err := srv.SaveContext("Database migrations live in db/migrations."); err != nil {
+		t.Fatalf("SaveContext() error = %v", err)
+	}
+
+	results, err := srv.Query(context.Background(), Query{Text: "Deploys run from the release branch.", Limit: 1})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(results) != 1 || results[0].ID != id || results[0].Score <= 0 {
+		t.Fatalf("Query() = %+v, want the saved entry %s with a score", results, id)
+	}
+
+	// Known entries are excluded, or moved behind the others
+	results, err = srv.Query(context.Background(), Query{Text: "Deploys run from the release branch.", KnownIDs: []string{id}})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(results) != 1 || results[0].ID == id {
+		t.Errorf("Query() with a known entry = %+v, want it excluded", results)
+	}
+	results, err = srv.Query(context.Background(), Query{Text: "Deploys run from the release branch.", KnownIDs: []string{id}, DownrankKnown: true})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(results) != 2 || results[1].ID != id {
+		t.Errorf("Query() with a down-ranked entry = %+v, want it last", results)
+	}
+
+	// Each invalid field is reported
+	now := time.Now()
+	_, err = srv.Query(context.Background(), Query{Limit: -1, Since: now, Until: now.Add(-time.Hour)})
+	for _, want := range []error{server.ErrMissingQuery, server.ErrInvalidLimit, server.ErrInvalidTimeRange} {
+		if !errors.Is(err, want) {
+			t.Errorf("Query() error = %v, want it to wrap %v", err, want)
+		}
+	}
+}
+
+// TestNewServersConcurrently creates and uses servers from one Config in
+// parallel. Run with -race, it checks that they share no configuration.
+func TestNewServersConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	cfg := DefaultConfig()
+	cfg.Embedder.Dimensions = 8
+
+	var wg sync.WaitGroup
+	servers := make([]*Server, 8)
+	errs := make([]error, len(servers))
+	for i := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			own := cfg.Clone()
+			own.Store.SQLitePath = filepath.Join(dir, fmt.Sprintf("instance-%d.db", i))
+			servers[i], errs[i] = NewServer(ServerOptions{Config: own, Logger: slog.New(slog.DiscardHandler)})
+			own.Store.SQLitePath = "changed.db"
+			if errs[i] == nil {
+				_, errs[i] = servers[i].SaveContext(fmt.Sprintf("Instance %d deploys from its own branch.", i))
+			}
+		}()
+	}
+	wg.Wait()
+	for i, srv := range servers {
+		if errs[i] != nil {
+			t.Fatalf("Server %d: %v", i, errs[i])
+		}
+		defer srv.Stop()
+	}
+
+	// Changing a Config after NewServer leaves its server alone
+	for i, srv := range servers {
+		if want := filepath.Join(dir, fmt.Sprintf("instance-%d.db", i)); srv.config.Store.SQLitePath != want {
+			t.Errorf("Server %d uses %q, want %q", i, srv.config.Store.SQLitePath, want)
+		}
+		results, err := srv.SearchContext(fmt.Sprintf("Instance %d deploys from its own branch.", i), 5)
+		if err != nil || len(results) != 1 {
+			t.Errorf("Server %d found %+v, %v, want only its own entry", i, results, err)
+		}
+	}
+}
+
+// downEmbedder is an Embedder whose provider is unavailable
+type downEmbedder struct{}
+
+func (downEmbedder) CreateEmbedding(string) ([]float32, error) {
+	return nil, errors.New("provider unavailable")
+}
+
+func (downEmbedder) Initialize() error {
+	return nil
+}
+
+// TestSaveContextQuarantine tests that library saves embedded by a fallback
+// provider are quarantined like save_context's, not indexed
+func TestSaveContextQuarantine(t *testing.T) {
+	store := NewMemoryStore()
+	srv, err := NewServer(ServerOptions{
+		Logger:     slog.New(slog.DiscardHandler),
+		Store:      store,
+		Summarizer: NewFakeSummarizer(),
+		Embedder: vector.NewFallbackEmbedder(
+			vector.NamedEmbedder{Name: "primary", Embedder: downEmbedder{}},
+			[]vector.NamedEmbedder{{Name: "fallback", Embedder: NewFakeEmbedder(0)}},
+			vector.FallbackEmbedderConfig{MaxRetries: 1, RetryDelay: time.Nanosecond},
+		),
+	})
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	defer srv.Stop()
+
+	id, err := srv.SaveContextWithSource("Deploys run from the release branch.", "notes.md")
+	if err != nil {
+		t.Fatalf("SaveContextWithSource() error = %v", err)
+	}
+	quarantined, err := store.ListQuarantined()
+	if err != nil || len(quarantined) != 1 || quarantined[0].ID != id {
+		t.Fatalf("ListQuarantined() = %+v, %v; want the saved entry %s", quarantined, err, id)
+	}
+	if results, _ := srv.RetrieveContext("Deploys run from the release branch.", 5); len(results) != 0 {
+		t.Errorf("RetrieveContext() = %q, want the quarantined entry left out", results)
+	}
+	if chain, _ := store.GetProvenance(id); fmt.Sprint(chain) != "[notes.md api]" {
+		t.Errorf("Provenance = %v, want [notes.md api]", chain)
+	}
+}
+
+// ctxSummarizer is a Summarizer that refuses every text, or with block
+// waits for its context to be cancelled
+type ctxSummarizer struct {
+	block   bool
+	started chan struct{}
+}
+
+func (s *ctxSummarizer) Summarize(ctx context.Context, text string) (string, error) {
+	if !s.block {
+		return "", summarizer.ErrContentFiltered
+	}
+	select {
+	case s.started <- struct{}{}:
+	default:
+	}
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func (s *ctxSummarizer) Initialize() error {
+	return nil
+}
+
+// newSummarizingServer creates a server summarizing with summarizer into a
+// memory store
+func newSummarizingServer(t *testing.T, summarizer Summarizer) (*Server, *MemoryStore) {
+	t.Helper()
+	store := NewMemoryStore()
+	srv, err := NewServer(ServerOptions{
+		Logger:     slog.New(slog.DiscardHandler),
+		Store:      store,
+		Summarizer: summarizer,
+		Embedder:   NewFakeEmbedder(0),
+	})
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	t.Cleanup(func() { srv.Stop() })
+	return srv, store
+}
+
+// TestIngestSavePipeline tests that ingested chunks are saved like
+// save_context's: refused text is stored verbatim, and cancelling the run
+// stops the summarizer call in progress
+func TestIngestSavePipeline(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.md", "b.md"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("Deploys run from the release branch every Friday."), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	srv, store := newSummarizingServer(t, &ctxSummarizer{})
+	report, _, err := srv.Ingest(context.Background(), []string{filepath.Join(dir, "a.md")}, ingest.Options{Root: dir})
+	if err != nil || report.Saved != 1 {
+		t.Fatalf("Ingest() = %+v, %v; want 1 chunk saved", report, err)
+	}
+	entries, _ := store.ListEntries()
+	if len(entries) != 1 || !strings.HasSuffix(entries[0].SummaryText, "Deploys run from the release branch every Friday.") {
+		t.Errorf("Expected the refused chunk stored verbatim, got %+v", entries)
+	}
+
+	blocking := &ctxSummarizer{block: true, started: make(chan struct{}, 1)}
+	srv, store = newSummarizingServer(t, blocking)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-blocking.started
+		cancel()
+	}()
+	report, _, err = srv.Ingest(ctx, []string{dir}, ingest.Options{Root: dir})
+	if !errors.Is(err, context.Canceled) || report.Saved != 0 {
+		t.Errorf("Ingest() = %+v, %v; want it cancelled with nothing saved", report, err)
+	}
+	if entries, _ := store.ListEntries(); len(entries) != 0 {
+		t.Errorf("Expected no entries after cancelling, got %d", len(entries))
+	}
+}
+
+// TestCaptureGitSavePipeline tests that captured commits are saved like
+// save_context's, and that a cancelled capture saves nothing
+func TestCaptureGitSavePipeline(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"config", "user.name", "Ada"},
+		{"config", "user.email", "ada@example.com"},
+		{"config", "commit.gpgsign", "false"},
+		{"commit", "--quiet", "--allow-empty", "-m", "Deploy from the release branch"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v: %s", args[0], err, out)
+		}
+	}
+
+	blocking := &ctxSummarizer{block: true, started: make(chan struct{}, 1)}
+	srv, store := newSummarizingServer(t, blocking)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-blocking.started
+		cancel()
+	}()
+	report, _, err := srv.CaptureGit(ctx, dir, git.Options{})
+	if err != nil || report.Saved != 0 || report.Failed != 1 {
+		t.Errorf("CaptureGit() = %+v, %v; want the commit failed", report, err)
+	}
+	if entries, _ := store.ListEntries(); len(entries) != 0 {
+		t.Errorf("Expected no entries after cancelling, got %d", len(entries))
+	}
+
+	srv, store = newSummarizingServer(t, &ctxSummarizer{})
+	report, _, err = srv.CaptureGit(context.Background(), dir, git.Options{})
+	if err != nil || report.Saved != 1 {
+		t.Fatalf("CaptureGit() = %+v, %v; want the commit saved again", report, err)
+	}
+	entries, _ := store.ListEntries()
+	if len(entries) != 1 || !strings.Contains(entries[0].SummaryText, "Deploy from the release branch") {
+		t.Errorf("Expected the refused commit stored verbatim, got %+v", entries)
+	}
+}
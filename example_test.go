@@ -0,0 +1,147 @@
+package projectmemory_test
+
+//go:generate go test -run ^Example -count=1 .
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"time"
+
+	mcpserver "github.com/localrivet/gomcp/server"
+	"github.com/localrivet/projectmemory"
+)
+
+// newExampleServer creates a server over an in-memory store that calls no
+// summarization or embedding provider.
+func newExampleServer() *projectmemory.Server {
+	srv, err := projectmemory.NewServer(projectmemory.ServerOptions{
+		Logger:     slog.New(slog.DiscardHandler),
+		Store:      projectmemory.NewMemoryStore(),
+		Summarizer: projectmemory.NewFakeSummarizer(),
+		Embedder:   projectmemory.NewFakeEmbedder(projectmemory.DefaultEmbeddingDimensions),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return srv
+}
+
+// This example saves and retrieves context through the Server API, which is
+// the recommended way to embed ProjectMemory in another program.
+func Example_directComponents() {
+	srv := newExampleServer()
+	defer srv.Stop()
+
+	for _, text := range []string{
+		"The API uses JWT tokens for authentication.",
+		"Database migrations live in db/migrations.",
+	} {
+		if _, err := srv.SaveContext(text); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	results, err := srv.RetrieveContext("Database migrations live in db/migrations.", 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(results[0])
+	// Output: Database migrations live in db/migrations.
+}
+
+// This example filters and ranks a search with a Query, the richer form of
+// RetrieveContext.
+func Example_query() {
+	srv := newExampleServer()
+	defer srv.Stop()
+
+	for _, text := range []string{
+		"The API uses JWT tokens for authentication.",
+		"Database migrations live in db/migrations.",
+	} {
+		if _, err := srv.SaveContext(text); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	results, err := srv.Query(context.Background(), projectmemory.Query{
+		Text:     "Database migrations live in db/migrations.",
+		Limit:    1,
+		MinScore: 0.5,
+		Since:    time.Now().Add(-time.Hour),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(results[0].Summary)
+	// Output: Database migrations live in db/migrations.
+}
+
+// saveRequest and retrieveRequest are the arguments of the example's tools.
+type saveRequest struct {
+	ContextText string `json:"context_text" description:"The text to save"`
+}
+
+type retrieveRequest struct {
+	Query string `json:"query" description:"The query to search for"`
+	Limit int    `json:"limit,omitempty" description:"The maximum number of results"`
+}
+
+// toolResponse is the result of the example's tools.
+type toolResponse struct {
+	Status  string   `json:"status"`
+	ID      string   `json:"id,omitempty"`
+	Results []string `json:"results,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// This example registers ProjectMemory-backed tools on an existing MCP server
+// alongside the server's own tools.
+func Example_embedInMCP() {
+	srv := newExampleServer()
+	defer srv.Stop()
+
+	saveContext := func(ctx *mcpserver.Context, req saveRequest) (toolResponse, error) {
+		id, err := srv.SaveContext(req.ContextText)
+		if err != nil {
+			return toolResponse{Status: "error", Error: err.Error()}, nil
+		}
+		return toolResponse{Status: "success", ID: id}, nil
+	}
+
+	retrieveContext := func(ctx *mcpserver.Context, req retrieveRequest) (toolResponse, error) {
+		limit := req.Limit
+		if limit <= 0 {
+			limit = 5
+		}
+
+		results, err := srv.RetrieveContext(req.Query, limit)
+		if err != nil {
+			return toolResponse{Status: "error", Error: err.Error()}, nil
+		}
+		return toolResponse{Status: "success", Results: results}, nil
+	}
+
+	// Register the tools on your own MCP server; call AsStdio().Run() to serve them
+	mcpServer := mcpserver.NewServer("combined-mcp-server")
+	mcpServer = mcpServer.Tool("save_context", "Save context to the persistent memory store", saveContext)
+	mcpServer = mcpServer.Tool("retrieve_context", "Retrieve relevant context based on a query", retrieveContext)
+
+	// Handlers are plain functions, so they can be exercised without a transport
+	saved, _ := saveContext(nil, saveRequest{ContextText: "Deploys run from the release branch."})
+	fmt.Println(saved.Status)
+
+	retrieved, _ := retrieveContext(nil, retrieveRequest{Query: "Deploys run from the release branch."})
+	fmt.Println(retrieved.Results)
+	// Output:
+	// success
+	// [Deploys run from the release branch.]
+}
+
+func ExampleGenerateHash() {
+	id := projectmemory.GenerateHash("some summary", time.Unix(0, 0).UnixNano())
+	fmt.Println(len(id))
+	// Output: 16
+}
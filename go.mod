@@ -4,8 +4,13 @@ go 1.24.2
 
 require (
 	crawshaw.io/sqlite v0.3.2
+	github.com/fsnotify/fsnotify v1.9.0
 	github.com/localrivet/configurator v0.0.0-20250512175823-40e1d85f761e
 	github.com/localrivet/gomcp v1.2.1
+	github.com/yalue/onnxruntime_go v1.26.0
+	golang.org/x/sys v0.33.0
+	google.golang.org/grpc v1.72.1
+	google.golang.org/protobuf v1.36.6
 )
 
 require (
@@ -24,10 +29,7 @@ require (
 	golang.org/x/crypto v0.38.0 // indirect
 	golang.org/x/net v0.35.0 // indirect
 	golang.org/x/sync v0.14.0 // indirect
-	golang.org/x/sys v0.33.0 // indirect
 	golang.org/x/text v0.25.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20250218202821-56aae31c358a // indirect
-	google.golang.org/grpc v1.72.1 // indirect
-	google.golang.org/protobuf v1.36.6 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,315 @@
+// Package analytics reports how stored context is used: which entries are
+// retrieved most, which tags are never retrieved, and how often retrievals
+// find anything, so teams can tell whether their memory pulls its weight.
+package analytics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+)
+
+// Report formats
+const (
+	FormatJSON     = "json"
+	FormatMarkdown = "markdown"
+)
+
+const (
+	// DefaultTop is how many entries and queries each list of a report
+	// holds when no limit is given.
+	DefaultTop = 10
+
+	// maxEmptyQueries bounds the distinct queries without results that are
+	// counted, so a stream of unique queries cannot grow the log without
+	// limit. Further queries still count towards the totals.
+	maxEmptyQueries = 1000
+)
+
+// ErrUnknownFormat is returned for a report format other than FormatJSON and
+// FormatMarkdown.
+var ErrUnknownFormat = errors.New("unknown report format")
+
+// QueryLog counts retrievals and the queries that found nothing. It is safe
+// for concurrent use.
+type QueryLog struct {
+	mu    sync.Mutex
+	since time.Time
+	total int
+	hits  int
+	empty map[string]int
+}
+
+// NewQueryLog returns an empty log counting from now
+func NewQueryLog() *QueryLog {
+	return &QueryLog{since: time.Now(), empty: make(map[string]int)}
+}
+
+// Record counts one retrieval for query that returned results entries
+func (l *QueryLog) Record(query string, results int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.total++
+	if results > 0 {
+		l.hits++
+		return
+	}
+	query = strings.TrimSpace(query)
+	if _, counted := l.empty[query]; !counted && len(l.empty) >= maxEmptyQueries {
+		return
+	}
+	l.empty[query]++
+}
+
+// QueryStats is a copy of a QueryLog's counts
+type QueryStats struct {
+	Since      time.Time
+	Retrievals int
+	Hits       int
+
+	// Empty counts each query that returned nothing
+	Empty map[string]int
+}
+
+// Stats returns a copy of the counts so far
+func (l *QueryLog) Stats() QueryStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	empty := make(map[string]int, len(l.empty))
+	for query, count := range l.empty {
+		empty[query] = count
+	}
+	return QueryStats{Since: l.since, Retrievals: l.total, Hits: l.hits, Empty: empty}
+}
+
+// EntryUsage is how often one entry was retrieved
+type EntryUsage struct {
+	ID            string    `json:"id"`
+	Summary       string    `json:"summary"`
+	Retrievals    int       `json:"retrievals"`
+	LastRetrieved time.Time `json:"last_retrieved"`
+}
+
+// TagUsage is a tag and how many entries carry it
+type TagUsage struct {
+	Tag     string `json:"tag"`
+	Entries int    `json:"entries"`
+}
+
+// QueryCount is a query and how often it was asked
+type QueryCount struct {
+	Query string `json:"query"`
+	Count int    `json:"count"`
+}
+
+// Report is the usage of the stored context
+type Report struct {
+	GeneratedAt time.Time `json:"generated_at"`
+
+	// Entries is the number of stored entries, and NeverRetrieved how many
+	// of them no retrieval ever returned
+	Entries        int `json:"entries"`
+	NeverRetrieved int `json:"never_retrieved"`
+
+	// TopEntries are the entries retrieved most, most first
+	TopEntries []EntryUsage `json:"top_entries"`
+
+	// DeadTags are tags none of whose entries was ever retrieved, most
+	// entries first
+	DeadTags []TagUsage `json:"dead_tags"`
+
+	// QueriesSince is when Retrievals, Hits and EmptyQueries started
+	// counting, usually when the server started
+	QueriesSince time.Time `json:"queries_since"`
+	Retrievals   int       `json:"retrievals"`
+	Hits         int       `json:"hits"`
+
+	// HitRate is the share of retrievals that returned anything, 0 without
+	// retrievals
+	HitRate float64 `json:"hit_rate"`
+
+	// EmptyQueries are the queries that returned nothing, most often first
+	EmptyQueries []QueryCount `json:"empty_queries"`
+
+	// Suggestions are topics worth ingesting documentation about, from the
+	// store's retrieval gaps, if they were asked for
+	Suggestions []Suggestion `json:"suggestions,omitempty"`
+}
+
+// Build reports the usage of entries, whose tags are given by ID, and of the
+// retrievals in queries. Each list holds at most top items; 0 uses
+// DefaultTop.
+func Build(entries []contextstore.Entry, tags map[string][]string, queries QueryStats, top int, now time.Time) Report {
+	if top <= 0 {
+		top = DefaultTop
+	}
+	report := Report{
+		GeneratedAt:  now,
+		Entries:      len(entries),
+		TopEntries:   []EntryUsage{},
+		DeadTags:     []TagUsage{},
+		QueriesSince: queries.Since,
+		Retrievals:   queries.Retrievals,
+		Hits:         queries.Hits,
+		EmptyQueries: []QueryCount{},
+	}
+	if queries.Retrievals > 0 {
+		report.HitRate = float64(queries.Hits) / float64(queries.Retrievals)
+	}
+
+	// Tags count as alive once any of their entries was retrieved
+	tagEntries := make(map[string]int)
+	aliveTags := make(map[string]bool)
+	var retrieved []contextstore.Entry
+	for _, entry := range entries {
+		for _, tag := range tags[entry.ID] {
+			tagEntries[tag]++
+			if entry.Retrievals > 0 {
+				aliveTags[tag] = true
+			}
+		}
+		if entry.Retrievals == 0 {
+			report.NeverRetrieved++
+			continue
+		}
+		retrieved = append(retrieved, entry)
+	}
+
+	sort.SliceStable(retrieved, func(i, j int) bool {
+		return retrieved[i].Retrievals > retrieved[j].Retrievals
+	})
+	for i, entry := range retrieved {
+		if i == top {
+			break
+		}
+		report.TopEntries = append(report.TopEntries, EntryUsage{
+			ID:            entry.ID,
+			Summary:       entry.SummaryText,
+			Retrievals:    entry.Retrievals,
+			LastRetrieved: entry.LastRetrieved,
+		})
+	}
+
+	for tag, count := range tagEntries {
+		if !aliveTags[tag] {
+			report.DeadTags = append(report.DeadTags, TagUsage{Tag: tag, Entries: count})
+		}
+	}
+	sort.Slice(report.DeadTags, func(i, j int) bool {
+		if report.DeadTags[i].Entries != report.DeadTags[j].Entries {
+			return report.DeadTags[i].Entries > report.DeadTags[j].Entries
+		}
+		return report.DeadTags[i].Tag < report.DeadTags[j].Tag
+	})
+
+	for query, count := range queries.Empty {
+		report.EmptyQueries = append(report.EmptyQueries, QueryCount{Query: query, Count: count})
+	}
+	sort.Slice(report.EmptyQueries, func(i, j int) bool {
+		if report.EmptyQueries[i].Count != report.EmptyQueries[j].Count {
+			return report.EmptyQueries[i].Count > report.EmptyQueries[j].Count
+		}
+		return report.EmptyQueries[i].Query < report.EmptyQueries[j].Query
+	})
+	if len(report.EmptyQueries) > top {
+		report.EmptyQueries = report.EmptyQueries[:top]
+	}
+	return report
+}
+
+// ValidateFormat returns ErrUnknownFormat unless format is FormatJSON or
+// FormatMarkdown
+func ValidateFormat(format string) error {
+	switch format {
+	case FormatJSON, FormatMarkdown:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+}
+
+// Render returns the report as JSON or Markdown
+func (r Report) Render(format string) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		return json.Marshal(r)
+	case FormatMarkdown:
+		return []byte(r.Markdown()), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+}
+
+// Markdown returns the report as a Markdown document
+func (r Report) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Context Usage Report\n\nGenerated %s.\n\n", r.GeneratedAt.UTC().Format(time.RFC3339))
+
+	fmt.Fprintf(&b, "## Retrievals\n\n")
+	fmt.Fprintf(&b, "Since %s: %d retrievals, %d with results (hit rate %.1f%%).\n\n",
+		r.QueriesSince.UTC().Format(time.RFC3339), r.Retrievals, r.Hits, 100*r.HitRate)
+
+	fmt.Fprintf(&b, "## Entries\n\n%d entries stored, %d never retrieved.\n\n", r.Entries, r.NeverRetrieved)
+
+	fmt.Fprintf(&b, "### Most Retrieved\n\n")
+	if len(r.TopEntries) == 0 {
+		b.WriteString("No entry has been retrieved yet.\n\n")
+	} else {
+		b.WriteString("| Retrievals | Last Retrieved | ID | Summary |\n| ---: | --- | --- | --- |\n")
+		for _, entry := range r.TopEntries {
+			fmt.Fprintf(&b, "| %d | %s | `%s` | %s |\n", entry.Retrievals,
+				entry.LastRetrieved.UTC().Format(time.DateOnly), entry.ID, markdownCell(entry.Summary, 120))
+		}
+		b.WriteString("\n")
+	}
+
+	fmt.Fprintf(&b, "### Dead Tags\n\n")
+	if len(r.DeadTags) == 0 {
+		b.WriteString("Every tag has been retrieved at least once.\n\n")
+	} else {
+		b.WriteString("Tags none of whose entries was ever retrieved:\n\n| Tag | Entries |\n| --- | ---: |\n")
+		for _, tag := range r.DeadTags {
+			fmt.Fprintf(&b, "| `%s` | %d |\n", tag.Tag, tag.Entries)
+		}
+		b.WriteString("\n")
+	}
+
+	fmt.Fprintf(&b, "## Queries Without Results\n\n")
+	if len(r.EmptyQueries) == 0 {
+		b.WriteString("Every retrieval returned results.\n")
+	} else {
+		b.WriteString("| Count | Query |\n| ---: | --- |\n")
+		for _, query := range r.EmptyQueries {
+			fmt.Fprintf(&b, "| %d | %s |\n", query.Count, markdownCell(query.Query, 120))
+		}
+	}
+
+	if len(r.Suggestions) > 0 {
+		b.WriteString("\n## Suggested Ingestion\n\nDocumentation on these topics would answer queries that found nothing:\n\n")
+		for _, suggestion := range r.Suggestions {
+			quoted := make([]string, len(suggestion.Queries))
+			for i, query := range suggestion.Queries {
+				quoted[i] = fmt.Sprintf("%q", markdownCell(query, 80))
+			}
+			fmt.Fprintf(&b, "- **%s** (%d misses), e.g. %s\n", suggestion.Topic, suggestion.Count, strings.Join(quoted, ", "))
+		}
+	}
+	return b.String()
+}
+
+// markdownCell fits text on one table row of at most n runes
+func markdownCell(text string, n int) string {
+	text = strings.ReplaceAll(strings.Join(strings.Fields(text), " "), "|", `\|`)
+	if runes := []rune(text); len(runes) > n {
+		text = string(runes[:n-3]) + "..."
+	}
+	return text
+}
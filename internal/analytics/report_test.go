@@ -0,0 +1,92 @@
+package analytics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+)
+
+func TestQueryLog(t *testing.T) {
+	log := NewQueryLog()
+	log.Record("auth flow", 3)
+	log.Record("  deploy steps ", 0)
+	log.Record("deploy steps", 0)
+	log.Record("billing", 0)
+
+	stats := log.Stats()
+	if stats.Retrievals != 4 || stats.Hits != 1 {
+		t.Errorf("Expected 4 retrievals and 1 hit, got %d and %d", stats.Retrievals, stats.Hits)
+	}
+	if stats.Empty["deploy steps"] != 2 || stats.Empty["billing"] != 1 || len(stats.Empty) != 2 {
+		t.Errorf("Expected the empty queries counted by text, got %v", stats.Empty)
+	}
+
+	// Distinct empty queries stop being kept at the limit, but still count
+	for i := 0; i < maxEmptyQueries; i++ {
+		log.Record(fmt.Sprintf("query %d", i), 0)
+	}
+	stats = log.Stats()
+	if len(stats.Empty) != maxEmptyQueries || stats.Retrievals != 4+maxEmptyQueries {
+		t.Errorf("Expected %d empty queries kept of %d retrievals, got %d of %d",
+			maxEmptyQueries, 4+maxEmptyQueries, len(stats.Empty), stats.Retrievals)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	entries := []contextstore.Entry{
+		{ID: "auth", SummaryText: "The auth service issues JWTs", Retrievals: 2, LastRetrieved: now},
+		{ID: "deploy", SummaryText: "Deploys go through | the pipeline", Retrievals: 5, LastRetrieved: now},
+		{ID: "notes", SummaryText: "Old meeting notes"},
+		{ID: "todo", SummaryText: "Old todo list"},
+	}
+	tags := map[string][]string{
+		"auth":  {"backend"},
+		"notes": {"backend", "meetings"},
+		"todo":  {"meetings", "personal"},
+	}
+	queries := QueryStats{Since: now.Add(-time.Hour), Retrievals: 4, Hits: 3, Empty: map[string]int{"billing": 1}}
+
+	report := Build(entries, tags, queries, 1, now)
+
+	if report.Entries != 4 || report.NeverRetrieved != 2 || report.HitRate != 0.75 {
+		t.Errorf("Expected 4 entries, 2 never retrieved and a 0.75 hit rate, got %+v", report)
+	}
+	if len(report.TopEntries) != 1 || report.TopEntries[0].ID != "deploy" {
+		t.Errorf("Expected only the most retrieved entry, got %+v", report.TopEntries)
+	}
+	wantTags := []TagUsage{{Tag: "meetings", Entries: 2}, {Tag: "personal", Entries: 1}}
+	if fmt.Sprint(report.DeadTags) != fmt.Sprint(wantTags) {
+		t.Errorf("Expected dead tags %v, got %v", wantTags, report.DeadTags)
+	}
+	if len(report.EmptyQueries) != 1 || report.EmptyQueries[0] != (QueryCount{Query: "billing", Count: 1}) {
+		t.Errorf("Expected the empty query, got %v", report.EmptyQueries)
+	}
+
+	markdown := report.Markdown()
+	for _, want := range []string{"hit rate 75.0%", "| 5 | 2024-06-01 | `deploy` | Deploys go through \\| the pipeline |", "| `meetings` | 2 |", "| 1 | billing |"} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("Expected the Markdown report to contain %q, got:\n%s", want, markdown)
+		}
+	}
+
+	data, err := report.Render(FormatJSON)
+	if err != nil || !json.Valid(data) {
+		t.Errorf("Expected a JSON report, got %s, %v", data, err)
+	}
+	if _, err := report.Render("html"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Expected ErrUnknownFormat, got %v", err)
+	}
+
+	// Empty lists are rendered as such, not as null
+	empty := Build(nil, nil, QueryStats{}, 0, now)
+	data, _ = empty.Render(FormatJSON)
+	if !strings.Contains(string(data), `"top_entries":[]`) || !strings.Contains(string(data), `"empty_queries":[]`) {
+		t.Errorf("Expected empty lists, got %s", data)
+	}
+}
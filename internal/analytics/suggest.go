@@ -0,0 +1,98 @@
+package analytics
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+)
+
+// suggestionExamples is how many example queries each suggestion lists
+const suggestionExamples = 3
+
+// stopWords are left out of suggested topics
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "how": true, "what": true, "why": true,
+	"when": true, "where": true, "which": true, "who": true, "does": true, "did": true,
+	"with": true, "from": true, "into": true, "about": true, "our": true, "are": true,
+	"was": true, "were": true, "can": true, "should": true, "this": true, "that": true,
+	"there": true, "use": true, "using": true, "used": true, "get": true, "set": true,
+	"have": true, "has": true, "not": true, "any": true, "all": true, "you": true,
+}
+
+// Suggestion is a topic whose documentation would fill retrieval gaps
+type Suggestion struct {
+	// Topic is the word the gaps' queries share
+	Topic string `json:"topic"`
+
+	// Count is how often the queries about Topic found nothing
+	Count int `json:"count"`
+
+	// Queries are examples of them, most often asked first
+	Queries []string `json:"queries"`
+}
+
+// SuggestIngestion groups gaps by the words their queries share and returns
+// at most top topics to ingest documentation about, most missed first. Each
+// gap counts towards one topic only. 0 uses DefaultTop.
+func SuggestIngestion(gaps []contextstore.Gap, top int) []Suggestion {
+	if top <= 0 {
+		top = DefaultTop
+	}
+
+	// Examples are taken most often asked first
+	remaining := make([]contextstore.Gap, len(gaps))
+	copy(remaining, gaps)
+	sort.SliceStable(remaining, func(i, j int) bool { return remaining[i].Count > remaining[j].Count })
+
+	suggestions := []Suggestion{}
+	for len(suggestions) < top && len(remaining) > 0 {
+		// The topic is the word missed most often across the remaining gaps
+		weights := make(map[string]int)
+		for _, gap := range remaining {
+			for word := range topicWords(gap.Query) {
+				weights[word] += gap.Count
+			}
+		}
+		topic, weight := "", 0
+		for word, w := range weights {
+			if w > weight || (w == weight && word < topic) {
+				topic, weight = word, w
+			}
+		}
+		if topic == "" {
+			break
+		}
+
+		suggestion := Suggestion{Topic: topic, Count: weight, Queries: []string{}}
+		var rest []contextstore.Gap
+		for _, gap := range remaining {
+			if !topicWords(gap.Query)[topic] {
+				rest = append(rest, gap)
+				continue
+			}
+			if len(suggestion.Queries) < suggestionExamples {
+				suggestion.Queries = append(suggestion.Queries, gap.Query)
+			}
+		}
+		suggestions = append(suggestions, suggestion)
+		remaining = rest
+	}
+	return suggestions
+}
+
+// topicWords returns the lowercased words of query that can name a topic
+func topicWords(query string) map[string]bool {
+	words := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-'
+	}) {
+		word = strings.Trim(word, "-_")
+		if len([]rune(word)) < 3 || stopWords[word] {
+			continue
+		}
+		words[word] = true
+	}
+	return words
+}
@@ -0,0 +1,49 @@
+package analytics
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+)
+
+func TestSuggestIngestion(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	gaps := []contextstore.Gap{
+		{Query: "How do we rotate the billing API keys?", Count: 1, LastSeen: now},
+		{Query: "kubernetes deploy rollback", Count: 3, LastSeen: now},
+		{Query: "billing webhook retries", Count: 2, LastSeen: now},
+		{Query: "what is the deploy freeze schedule", Count: 2, LastSeen: now},
+		{Query: "why?", Count: 5, LastSeen: now},
+	}
+
+	suggestions := SuggestIngestion(gaps, 0)
+
+	// deploy is missed 5 times, billing 3; each gap counts once
+	want := []string{
+		"deploy 5 [kubernetes deploy rollback what is the deploy freeze schedule]",
+		"billing 3 [billing webhook retries How do we rotate the billing API keys?]",
+	}
+	if len(suggestions) < len(want) {
+		t.Fatalf("Expected at least %d suggestions, got %+v", len(want), suggestions)
+	}
+	for i, w := range want {
+		got := fmt.Sprintf("%s %d %v", suggestions[i].Topic, suggestions[i].Count, suggestions[i].Queries)
+		if got != w {
+			t.Errorf("Suggestion %d = %q, want %q", i, got, w)
+		}
+	}
+	for _, suggestion := range suggestions {
+		if suggestion.Topic == "why" {
+			t.Errorf("Expected stop words not to be suggested, got %+v", suggestion)
+		}
+	}
+
+	if limited := SuggestIngestion(gaps, 1); len(limited) != 1 {
+		t.Errorf("Expected 1 suggestion, got %+v", limited)
+	}
+	if none := SuggestIngestion(nil, 0); len(none) != 0 {
+		t.Errorf("Expected no suggestions without gaps, got %+v", none)
+	}
+}
@@ -0,0 +1,298 @@
+// Package archive moves namespaces of a context store into cold storage and
+// back. An archived namespace is written as a gzipped JSON bundle holding its
+// entries and their snapshot hash, which is checked before the namespace is
+// removed from the store and again before it is restored.
+//
+// Bundles and snapshot manifests are kept for years, so their format is
+// versioned and documented in docs/archive_format.md. Every release reads
+// every format written before it, and can read newer formats that only add
+// fields.
+package archive
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+)
+
+const (
+	// FormatVersion is the format of the bundles and manifests written, and
+	// the newest format read. It is raised when a field is added, changed
+	// or removed.
+	FormatVersion = 1
+
+	// MinFormatVersion is the oldest format a reader needs to read the
+	// bundles and manifests written: the last format that changed or
+	// removed a field rather than adding one. Readers of that format or
+	// newer ignore the fields they do not know.
+	MinFormatVersion = 1
+
+	// BundleKind and ManifestKind mark bundles and snapshot manifests
+	BundleKind   = "projectmemory.archive"
+	ManifestKind = "projectmemory.snapshot"
+)
+
+// bundleSuffix ends the name of every bundle
+const bundleSuffix = ".json.gz"
+
+var (
+	// ErrEmptyNamespace is returned when a namespace holding no entries is
+	// archived
+	ErrEmptyNamespace = errors.New("namespace holds no entries")
+
+	// ErrNotArchived is returned when a namespace without a bundle is
+	// restored
+	ErrNotArchived = errors.New("namespace is not archived")
+
+	// ErrIntegrity is returned when entries do not match the snapshot hash
+	// recorded for them
+	ErrIntegrity = errors.New("archive integrity check failed")
+
+	// ErrUnsupportedFormat is returned for a bundle or manifest that needs a
+	// newer reader, or that is not one at all
+	ErrUnsupportedFormat = errors.New("unsupported archive format")
+)
+
+// Bundle is the content of an archived namespace
+type Bundle struct {
+	// Kind is BundleKind. It is empty in bundles written before it was
+	// recorded.
+	Kind string `json:"kind,omitempty"`
+
+	// Format is the format the bundle was written in, and MinFormat the
+	// oldest format a reader needs to read it. MinFormat is 0 in bundles
+	// written before it was recorded, which need Format.
+	Format    int `json:"format"`
+	MinFormat int `json:"min_format,omitempty"`
+
+	Namespace  string    `json:"namespace"`
+	ArchivedAt time.Time `json:"archived_at"`
+
+	// SnapshotHash is the namespace's snapshot hash when it was archived
+	SnapshotHash string `json:"snapshot_hash"`
+
+	Entries []contextstore.ArchivedEntry `json:"entries"`
+}
+
+// Target is where bundles are kept
+type Target interface {
+	// Put stores a bundle under name, replacing any bundle of that name.
+	Put(name string, bundle io.Reader) error
+
+	// Get opens the bundle stored under name. It returns an error wrapping
+	// os.ErrNotExist if there is none.
+	Get(name string) (io.ReadCloser, error)
+}
+
+// Directory is a Target keeping bundles as files in a local directory
+type Directory struct {
+	Path string
+}
+
+// Put writes the bundle next to its final name and renames it into place,
+// so a bundle file is always complete. Slashes in name are directories.
+func (d Directory) Put(name string, bundle io.Reader) error {
+	path := filepath.Join(d.Path, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create archive file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, bundle); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	// The namespace is deleted once Put returns, so the bundle must be on disk
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace archive file: %w", err)
+	}
+	return nil
+}
+
+// Get opens the bundle file
+func (d Directory) Get(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(d.Path, filepath.FromSlash(name)))
+}
+
+// BundleName returns the name a namespace's bundle is stored under. Bytes
+// other than ASCII letters, digits, '-' and '_' are percent-encoded, so every
+// namespace maps to a distinct name that is safe as a file or object name.
+func BundleName(namespace string) string {
+	var name strings.Builder
+	for i := 0; i < len(namespace); i++ {
+		c := namespace[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' {
+			name.WriteByte(c)
+		} else {
+			fmt.Fprintf(&name, "%%%02X", c)
+		}
+	}
+	return name.String() + bundleSuffix
+}
+
+// Archive writes the entries of namespace to target and then deletes them
+// from store, returning the bundle written. The store is left untouched
+// unless the bundle was stored and matches the namespace's snapshot hash.
+// Entries stored in the namespace while it is archived are kept.
+func Archive(store contextstore.ContextStore, target Target, namespace string, now time.Time) (*Bundle, error) {
+	archiver, ok := store.(contextstore.NamespaceArchiver)
+	if !ok {
+		return nil, contextstore.ErrArchiveUnsupported
+	}
+
+	entries, err := archiver.ExportNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrEmptyNamespace, namespace)
+	}
+
+	bundle := newBundle(namespace, now, entries)
+	if err := put(target, BundleName(namespace), bundle); err != nil {
+		return nil, err
+	}
+
+	// Read the bundle back, so a target that lost it fails the archive
+	if _, err := Load(target, namespace); err != nil {
+		return nil, fmt.Errorf("failed to verify archive of %s: %w", namespace, err)
+	}
+
+	ids := make([]string, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.ID
+	}
+	if _, err := archiver.DeleteArchived(namespace, ids); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// Restore reads the bundle of namespace from target and imports its entries
+// into store. It returns the number of entries restored. The bundle is kept,
+// so it can be restored again after the namespace is archived or cleared.
+func Restore(store contextstore.ContextStore, target Target, namespace string) (int, error) {
+	archiver, ok := store.(contextstore.NamespaceArchiver)
+	if !ok {
+		return 0, contextstore.ErrArchiveUnsupported
+	}
+
+	bundle, err := Load(target, namespace)
+	if err != nil {
+		return 0, err
+	}
+	if err := archiver.ImportNamespace(namespace, bundle.Entries); err != nil {
+		return 0, err
+	}
+	return len(bundle.Entries), nil
+}
+
+// Load reads and checks the bundle of namespace from target
+func Load(target Target, namespace string) (*Bundle, error) {
+	return load(target, BundleName(namespace), namespace)
+}
+
+// load reads the bundle stored under name and checks that it holds
+// namespace and matches its snapshot hash
+func load(target Target, name string, namespace string) (*Bundle, error) {
+	reader, err := target.Get(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotArchived, namespace)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive of %s: %w", namespace, err)
+	}
+	defer reader.Close()
+
+	unzipped, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive of %s: %w", namespace, err)
+	}
+	var bundle Bundle
+	if err := json.NewDecoder(unzipped).Decode(&bundle); err != nil {
+		return nil, fmt.Errorf("failed to read archive of %s: %w", namespace, err)
+	}
+
+	if err := checkFormat(BundleKind, bundle.Kind, bundle.Format, bundle.MinFormat); err != nil {
+		return nil, fmt.Errorf("archive of %s: %w", namespace, err)
+	}
+	if bundle.Namespace != namespace {
+		return nil, fmt.Errorf("%w: archive of %s holds namespace %s", ErrIntegrity, namespace, bundle.Namespace)
+	}
+	if contextstore.ArchiveHash(bundle.Entries) != bundle.SnapshotHash {
+		return nil, fmt.Errorf("%w: archive of %s does not match its snapshot hash", ErrIntegrity, namespace)
+	}
+	return &bundle, nil
+}
+
+// newBundle returns the bundle of entries, the content of namespace at now
+func newBundle(namespace string, now time.Time, entries []contextstore.ArchivedEntry) *Bundle {
+	return &Bundle{
+		Kind:         BundleKind,
+		Format:       FormatVersion,
+		MinFormat:    MinFormatVersion,
+		Namespace:    namespace,
+		ArchivedAt:   now.UTC(),
+		SnapshotHash: contextstore.ArchiveHash(entries),
+		Entries:      entries,
+	}
+}
+
+// checkFormat checks that a bundle or manifest of kind, written in format
+// for readers of minFormat or newer, can be read. An empty kind and a
+// minFormat of 0 are from before they were recorded.
+func checkFormat(want, kind string, format, minFormat int) error {
+	if kind != "" && kind != want {
+		return fmt.Errorf("%w: %q is not a %s", ErrUnsupportedFormat, kind, want)
+	}
+	if minFormat == 0 {
+		minFormat = format
+	}
+	if format < 1 || minFormat > format {
+		return fmt.Errorf("%w: invalid format %d, min_format %d", ErrUnsupportedFormat, format, minFormat)
+	}
+	if minFormat > FormatVersion {
+		return fmt.Errorf("%w: format %d needs a reader of format %d, this one reads up to %d",
+			ErrUnsupportedFormat, format, minFormat, FormatVersion)
+	}
+	return nil
+}
+
+// put stores the gzipped bundle in target under name
+func put(target Target, name string, bundle *Bundle) error {
+	reader, writer := io.Pipe()
+	go func() {
+		zipped := gzip.NewWriter(writer)
+		err := json.NewEncoder(zipped).Encode(bundle)
+		if closeErr := zipped.Close(); err == nil {
+			err = closeErr
+		}
+		writer.CloseWithError(err)
+	}()
+
+	if err := target.Put(name, reader); err != nil {
+		reader.CloseWithError(err)
+		return fmt.Errorf("failed to store archive of %s: %w", bundle.Namespace, err)
+	}
+	return nil
+}
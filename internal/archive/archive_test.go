@@ -0,0 +1,196 @@
+//go:build cgo && !purego
+
+package archive
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+// newStore creates a SQLite store holding two default-namespace entries
+// with tags, provenance, a summary generation and title, file references, a
+// pin and a batch
+func newStore(t *testing.T) *contextstore.SQLiteContextStore {
+	store := contextstore.NewSQLiteContextStore()
+	if err := store.Initialize(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	for i, id := range []string{"first", "second"} {
+		embedding, _ := vector.Float32SliceToBytes([]float32{1, float32(i)})
+		if err := store.Store(id, id+" summary", embedding, time.Unix(int64(1000+i), 0)); err != nil {
+			t.Fatalf("Failed to store %s: %v", id, err)
+		}
+	}
+	if err := store.SetTags("first", []string{"design"}); err != nil {
+		t.Fatalf("Failed to tag entry: %v", err)
+	}
+	if err := store.SetProvenance("first", []string{"notes.md", "tool:save_context"}); err != nil {
+		t.Fatalf("Failed to record provenance: %v", err)
+	}
+	if err := store.SetGeneration("first", contextstore.Generation{Summarizer: "ai", Provider: "openai", Model: "gpt-4o"}); err != nil {
+		t.Fatalf("Failed to record generation: %v", err)
+	}
+	if err := store.SetTitle("first", "First entry"); err != nil {
+		t.Fatalf("Failed to record title: %v", err)
+	}
+	if err := store.SetReferences("first", []contextstore.Reference{{Path: "main.go", Symbol: "main"}}); err != nil {
+		t.Fatalf("Failed to record references: %v", err)
+	}
+	if err := store.SetPinned("second", true); err != nil {
+		t.Fatalf("Failed to pin entry: %v", err)
+	}
+	if err := store.SetBatch("second", "import-1"); err != nil {
+		t.Fatalf("Failed to set batch: %v", err)
+	}
+	return store
+}
+
+// TestArchiveAndRestore checks that a namespace leaves the store when
+// archived and comes back with the same snapshot hash
+func TestArchiveAndRestore(t *testing.T) {
+	store := newStore(t)
+	target := Directory{Path: filepath.Join(t.TempDir(), "archive")}
+	namespace := contextstore.DefaultNamespace
+
+	before, _ := store.SnapshotHashes()
+	bundle, err := Archive(store, target, namespace, time.Now())
+	if err != nil {
+		t.Fatalf("Archive failed: %v", err)
+	}
+	if len(bundle.Entries) != 2 || bundle.SnapshotHash != before[namespace] {
+		t.Errorf("Expected both entries with hash %s, got %d with %s", before[namespace], len(bundle.Entries), bundle.SnapshotHash)
+	}
+	if hashes, _ := store.SnapshotHashes(); len(hashes) != 0 {
+		t.Errorf("Expected the namespace to leave the store, got %v", hashes)
+	}
+	if batches, _ := store.ListBatches(); len(batches) != 0 {
+		t.Errorf("Expected the batch to leave with its entries, got %v", batches)
+	}
+
+	if _, err := Archive(store, target, namespace, time.Now()); !errors.Is(err, ErrEmptyNamespace) {
+		t.Errorf("Expected ErrEmptyNamespace archiving it again, got %v", err)
+	}
+
+	count, err := Restore(store, target, namespace)
+	if err != nil || count != 2 {
+		t.Fatalf("Expected 2 entries restored, got %d, %v", count, err)
+	}
+	if after, _ := store.SnapshotHashes(); after[namespace] != before[namespace] {
+		t.Errorf("Expected hash %s after restoring, got %s", before[namespace], after[namespace])
+	}
+	if batches, _ := store.ListBatches(); len(batches) != 1 || batches[0].ID != "import-1" {
+		t.Errorf("Expected the batch to be restored, got %v", batches)
+	}
+	if generation, _ := store.GetGeneration("first"); generation.Model != "gpt-4o" {
+		t.Errorf("Expected the generation to be restored, got %+v", generation)
+	}
+	if title, _ := store.GetTitle("first"); title != "First entry" {
+		t.Errorf("Expected the title to be restored, got %q", title)
+	}
+	if references, _ := store.GetReferences("first"); len(references) != 1 || references[0].Symbol != "main" {
+		t.Errorf("Expected the references to be restored, got %v", references)
+	}
+	if pinned, _ := store.ListPinned(namespace); len(pinned) != 1 || pinned[0] != "second" {
+		t.Errorf("Expected the pin to be restored, got %v", pinned)
+	}
+
+	if _, err := Restore(store, target, namespace); !errors.Is(err, contextstore.ErrNamespaceNotEmpty) {
+		t.Errorf("Expected ErrNamespaceNotEmpty restoring over entries, got %v", err)
+	}
+	if _, err := Restore(store, target, "other"); !errors.Is(err, ErrNotArchived) {
+		t.Errorf("Expected ErrNotArchived for an unknown namespace, got %v", err)
+	}
+}
+
+// TestRestoreRejectsTamperedBundle checks that a bundle whose entries no
+// longer match its snapshot hash is not restored
+func TestRestoreRejectsTamperedBundle(t *testing.T) {
+	store := newStore(t)
+	target := Directory{Path: t.TempDir()}
+	namespace := contextstore.DefaultNamespace
+
+	bundle, err := Archive(store, target, namespace, time.Now())
+	if err != nil {
+		t.Fatalf("Archive failed: %v", err)
+	}
+
+	bundle.Entries[0].SummaryText = "edited"
+	file, err := os.Create(filepath.Join(target.Path, BundleName(namespace)))
+	if err != nil {
+		t.Fatalf("Failed to rewrite bundle: %v", err)
+	}
+	zipped := gzip.NewWriter(file)
+	json.NewEncoder(zipped).Encode(bundle)
+	zipped.Close()
+	file.Close()
+
+	if _, err := Restore(store, target, namespace); !errors.Is(err, ErrIntegrity) {
+		t.Errorf("Expected ErrIntegrity, got %v", err)
+	}
+	if hashes, _ := store.SnapshotHashes(); len(hashes) != 0 {
+		t.Errorf("Expected nothing restored, got %v", hashes)
+	}
+}
+
+func TestBundleName(t *testing.T) {
+	tests := map[string]string{
+		"default":         "default.json.gz",
+		"team/project":    "team%2Fproject.json.gz",
+		"..":              "%2E%2E.json.gz",
+		"client:acme_2":   "client%3Aacme_2.json.gz",
+		"team%2Fproject":  "team%252Fproject.json.gz",
+		"Project-Phoenix": "Project-Phoenix.json.gz",
+	}
+	for namespace, want := range tests {
+		if got := BundleName(namespace); got != want {
+			t.Errorf("BundleName(%q) = %q, want %q", namespace, got, want)
+		}
+	}
+}
+
+// TestSnapshotAndRestore checks that a snapshot leaves the store untouched
+// and restores the latest snapshot into an empty store
+func TestSnapshotAndRestore(t *testing.T) {
+	store := newStore(t)
+	target := Directory{Path: t.TempDir()}
+	before, _ := store.SnapshotHashes()
+
+	manifest, err := Snapshot(store, target, time.Date(2025, 5, 12, 17, 58, 23, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	if manifest.ID != "20250512T175823Z" || manifest.Namespaces[contextstore.DefaultNamespace].Entries != 2 {
+		t.Errorf("Unexpected manifest %+v", manifest)
+	}
+	if after, _ := store.SnapshotHashes(); len(after) != len(before) {
+		t.Errorf("Expected the store untouched, got %v", after)
+	}
+	if _, err := RestoreSnapshot(store, target, LatestSnapshot); !errors.Is(err, contextstore.ErrNamespaceNotEmpty) {
+		t.Errorf("Expected ErrNamespaceNotEmpty restoring over entries, got %v", err)
+	}
+
+	empty := contextstore.NewSQLiteContextStore()
+	if err := empty.Initialize(filepath.Join(t.TempDir(), "empty.db")); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+	defer empty.Close()
+	if _, err := RestoreSnapshot(empty, target, LatestSnapshot); err != nil {
+		t.Fatalf("RestoreSnapshot failed: %v", err)
+	}
+	if after, _ := empty.SnapshotHashes(); after[contextstore.DefaultNamespace] != before[contextstore.DefaultNamespace] {
+		t.Errorf("Expected hash %s after restoring, got %s", before[contextstore.DefaultNamespace], after[contextstore.DefaultNamespace])
+	}
+	if _, err := RestoreSnapshot(empty, target, "20000101T000000Z"); !errors.Is(err, ErrNoSnapshot) {
+		t.Errorf("Expected ErrNoSnapshot for an unknown ID, got %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+//go:build cgo && !purego
+
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+// update rewrites the fixture of the current format. Fixtures of earlier
+// formats are never rewritten: they are what earlier releases wrote.
+var update = flag.Bool("update", false, "rewrite the archive fixture of the current format")
+
+// fixtureEntries are the entries of the current format's fixture, with
+// every field set
+func fixtureEntries() []contextstore.ArchivedEntry {
+	first, _ := vector.Float32SliceToBytes([]float32{1, 0})
+	second, _ := vector.Float32SliceToBytes([]float32{1, 1})
+	return []contextstore.ArchivedEntry{
+		{
+			ID:          "first",
+			SummaryText: "first summary",
+			Embedding:   first,
+			Timestamp:   time.Unix(1000, 0).UTC(),
+			Tags:        []string{"design"},
+			Provenance:  []string{"notes.md", "tool:save_context"},
+			Generation:  &contextstore.Generation{Summarizer: "ai", Provider: "openai", Model: "gpt-4o", PromptVersion: "1"},
+			Title:       "First entry",
+			References:  []contextstore.Reference{{Path: "main.go", Symbol: "main"}},
+		},
+		{
+			ID:          "second",
+			SummaryText: "second summary",
+			Embedding:   second,
+			Timestamp:   time.Unix(1001, 0).UTC(),
+			Batch:       "import-1",
+			Pinned:      true,
+		},
+	}
+}
+
+// readFixture returns the decompressed bundle of a fixture directory
+func readFixture(t *testing.T, dir string) []byte {
+	t.Helper()
+	file, err := os.Open(filepath.Join("testdata", dir, BundleName(contextstore.DefaultNamespace)))
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer file.Close()
+	unzipped, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	data, err := io.ReadAll(unzipped)
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	return data
+}
+
+// TestCurrentFormatFixture checks that bundles are still written exactly as
+// the fixture of the current format records. A change to the format must
+// raise FormatVersion, and MinFormatVersion if it is not only additions,
+// then add the new format's fixture with -update and keep the old one.
+func TestCurrentFormatFixture(t *testing.T) {
+	dir := fmt.Sprintf("format-%d", FormatVersion)
+	bundle := newBundle(contextstore.DefaultNamespace, time.Unix(2000, 0), fixtureEntries())
+
+	if *update {
+		if err := put(Directory{Path: filepath.Join("testdata", dir)}, BundleName(bundle.Namespace), bundle); err != nil {
+			t.Fatalf("Failed to write fixture: %v", err)
+		}
+	}
+
+	target := Directory{Path: t.TempDir()}
+	if err := put(target, BundleName(bundle.Namespace), bundle); err != nil {
+		t.Fatalf("Failed to write bundle: %v", err)
+	}
+	reader, err := target.Get(BundleName(bundle.Namespace))
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer reader.Close()
+	unzipped, err := gzip.NewReader(reader)
+	if err != nil {
+		t.Fatalf("Failed to read bundle: %v", err)
+	}
+	written, err := io.ReadAll(unzipped)
+	if err != nil {
+		t.Fatalf("Failed to read bundle: %v", err)
+	}
+	if want := readFixture(t, dir); !bytes.Equal(written, want) {
+		t.Errorf("Bundle no longer matches testdata/%s:\n got %s\nwant %s", dir, written, want)
+	}
+}
+
+// TestReadsEveryFormat checks that the bundles of every earlier format, and
+// of newer formats that only add fields, are read and survive a restore and
+// archive by this release unchanged, and that newer formats that change
+// fields are refused
+func TestReadsEveryFormat(t *testing.T) {
+	tests := []struct {
+		dir     string
+		wantErr error
+	}{
+		{dir: "format-1-oldest"},
+		{dir: "format-1"},
+		{dir: "format-2-additive"},
+		{dir: "format-3-breaking", wantErr: ErrUnsupportedFormat},
+	}
+	for _, test := range tests {
+		t.Run(test.dir, func(t *testing.T) {
+			fixture := Directory{Path: filepath.Join("testdata", test.dir)}
+			bundle, err := Load(fixture, contextstore.DefaultNamespace)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("Expected %v, got %v", test.wantErr, err)
+			}
+			if test.wantErr != nil {
+				return
+			}
+			if len(bundle.Entries) != 2 {
+				t.Fatalf("Expected the fixture's 2 entries, got %d", len(bundle.Entries))
+			}
+
+			store := contextstore.NewSQLiteContextStore()
+			if err := store.Initialize(filepath.Join(t.TempDir(), "test.db")); err != nil {
+				t.Fatalf("Failed to initialize store: %v", err)
+			}
+			defer store.Close()
+			if _, err := Restore(store, fixture, contextstore.DefaultNamespace); err != nil {
+				t.Fatalf("Restore() error = %v", err)
+			}
+			target := Directory{Path: t.TempDir()}
+			rewritten, err := Archive(store, target, contextstore.DefaultNamespace, time.Unix(3000, 0))
+			if err != nil {
+				t.Fatalf("Archive() error = %v", err)
+			}
+			if rewritten.Format != FormatVersion || rewritten.SnapshotHash != bundle.SnapshotHash {
+				t.Errorf("Expected a format %d bundle with hash %s, got format %d with %s",
+					FormatVersion, bundle.SnapshotHash, rewritten.Format, rewritten.SnapshotHash)
+			}
+			want, _ := json.Marshal(bundle.Entries)
+			got, _ := json.Marshal(rewritten.Entries)
+			if !bytes.Equal(got, want) {
+				t.Errorf("Entries changed in the round trip:\n got %s\nwant %s", got, want)
+			}
+		})
+	}
+}
+
+func TestCheckFormat(t *testing.T) {
+	tests := []struct {
+		name      string
+		kind      string
+		format    int
+		minFormat int
+		wantErr   bool
+	}{
+		{"current", BundleKind, FormatVersion, MinFormatVersion, false},
+		{"before the header was recorded", "", 1, 0, false},
+		{"newer format readable by this one", BundleKind, FormatVersion + 1, FormatVersion, false},
+		{"newer format needing a newer reader", BundleKind, FormatVersion + 1, FormatVersion + 1, true},
+		{"newer format without min_format", "", FormatVersion + 1, 0, true},
+		{"other kind", ManifestKind, FormatVersion, MinFormatVersion, true},
+		{"no format", BundleKind, 0, 0, true},
+		{"min_format above format", BundleKind, 1, 2, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkFormat(BundleKind, test.kind, test.format, test.minFormat)
+			if (err != nil) != test.wantErr || (err != nil && !errors.Is(err, ErrUnsupportedFormat)) {
+				t.Errorf("checkFormat() error = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+// TestRestoreSnapshotChecksManifestFormat checks that a snapshot whose
+// manifest needs a newer reader is refused before anything is restored
+func TestRestoreSnapshotChecksManifestFormat(t *testing.T) {
+	target := Directory{Path: t.TempDir()}
+	manifest := `{"kind":"projectmemory.snapshot","format":9,"min_format":9,"id":"20250101T000000Z","namespaces":{}}`
+	if err := target.Put("snapshots/20250101T000000Z/manifest.json", strings.NewReader(manifest)); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+
+	store := contextstore.NewSQLiteContextStore()
+	if err := store.Initialize(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+	defer store.Close()
+	if _, err := RestoreSnapshot(store, target, "20250101T000000Z"); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("Expected ErrUnsupportedFormat, got %v", err)
+	}
+}
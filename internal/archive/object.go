@@ -0,0 +1,389 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// objectTimeout bounds each request to an object store
+const objectTimeout = 5 * time.Minute
+
+// azureVersion is the Blob service version requests are made against
+const azureVersion = "2021-08-06"
+
+var (
+	// ErrMissingCredentials is returned when an object storage target is
+	// opened without its credentials in the environment
+	ErrMissingCredentials = errors.New("object storage credentials not set")
+
+	// ErrChecksumMismatch is returned when a downloaded object does not
+	// match the checksum stored with it
+	ErrChecksumMismatch = errors.New("object checksum mismatch")
+)
+
+// ObjectTarget is a Target keeping bundles as objects in S3, Google Cloud
+// Storage or Azure Blob Storage. Each upload carries a Content-MD5 header
+// the service checks, and records the SHA-256 of the object in its metadata,
+// which is checked again on every download.
+type ObjectTarget struct {
+	// base is the URL of the bucket or container, prefix included,
+	// without a trailing slash
+	base string
+
+	// metaPrefix starts the names of metadata headers
+	metaPrefix string
+
+	// putHeaders are added to every upload
+	putHeaders map[string]string
+
+	// sign authenticates a request before it is sent
+	sign func(req *http.Request, payloadHash string, now time.Time) error
+
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewS3Target returns a target storing objects under prefix in an S3
+// bucket. Credentials come from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// the optional AWS_SESSION_TOKEN, and the region from AWS_REGION or
+// AWS_DEFAULT_REGION. AWS_ENDPOINT_URL_S3 selects an S3-compatible service,
+// addressed path-style. A nil client uses one with a five minute timeout.
+func NewS3Target(bucket, prefix string, client *http.Client) (*ObjectTarget, error) {
+	keyID, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if keyID == "" || secret == "" {
+		return nil, fmt.Errorf("%w: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required for s3://", ErrMissingCredentials)
+	}
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	base := "https://" + bucket + ".s3." + region + ".amazonaws.com"
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL_S3"); endpoint != "" {
+		base = strings.TrimSuffix(endpoint, "/") + "/" + encodePath(bucket)
+	}
+
+	signer := sigV4{
+		algorithm:  "AWS4",
+		headers:    "x-amz-",
+		terminator: "aws4_request",
+		service:    "s3",
+		region:     region,
+		keyID:      keyID,
+		secret:     secret,
+		token:      os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	return newObjectTarget(base, prefix, "x-amz-meta-", nil, signer.sign, client), nil
+}
+
+// NewGCSTarget returns a target storing objects under prefix in a Google
+// Cloud Storage bucket, through its XML API with an HMAC key read from
+// GCS_HMAC_ACCESS_ID and GCS_HMAC_SECRET. A nil client uses one with a five
+// minute timeout.
+func NewGCSTarget(bucket, prefix string, client *http.Client) (*ObjectTarget, error) {
+	keyID, secret := os.Getenv("GCS_HMAC_ACCESS_ID"), os.Getenv("GCS_HMAC_SECRET")
+	if keyID == "" || secret == "" {
+		return nil, fmt.Errorf("%w: GCS_HMAC_ACCESS_ID and GCS_HMAC_SECRET are required for gs://", ErrMissingCredentials)
+	}
+
+	signer := sigV4{
+		algorithm:  "GOOG4",
+		headers:    "x-goog-",
+		terminator: "goog4_request",
+		service:    "storage",
+		region:     "auto",
+		keyID:      keyID,
+		secret:     secret,
+	}
+	base := "https://storage.googleapis.com/" + encodePath(bucket)
+	return newObjectTarget(base, prefix, "x-goog-meta-", nil, signer.sign, client), nil
+}
+
+// NewAzureTarget returns a target storing blobs under prefix in an Azure
+// Blob Storage container, authorized with the account named by
+// AZURE_STORAGE_ACCOUNT and its key AZURE_STORAGE_KEY. A nil client uses
+// one with a five minute timeout.
+func NewAzureTarget(container, prefix string, client *http.Client) (*ObjectTarget, error) {
+	account, key := os.Getenv("AZURE_STORAGE_ACCOUNT"), os.Getenv("AZURE_STORAGE_KEY")
+	if account == "" || key == "" {
+		return nil, fmt.Errorf("%w: AZURE_STORAGE_ACCOUNT and AZURE_STORAGE_KEY are required for azblob://", ErrMissingCredentials)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AZURE_STORAGE_KEY: %w", err)
+	}
+
+	signer := sharedKey{account: account, key: decoded}
+	base := "https://" + account + ".blob.core.windows.net/" + encodePath(container)
+	putHeaders := map[string]string{"x-ms-blob-type": "BlockBlob"}
+	return newObjectTarget(base, prefix, "x-ms-meta-", putHeaders, signer.sign, client), nil
+}
+
+// newObjectTarget creates an ObjectTarget for the bucket at base
+func newObjectTarget(base, prefix, metaPrefix string, putHeaders map[string]string, sign func(*http.Request, string, time.Time) error, client *http.Client) *ObjectTarget {
+	if client == nil {
+		client = &http.Client{Timeout: objectTimeout}
+	}
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		base += "/" + encodePath(prefix)
+	}
+	return &ObjectTarget{
+		base:       base,
+		metaPrefix: metaPrefix,
+		putHeaders: putHeaders,
+		sign:       sign,
+		client:     client,
+		now:        time.Now,
+	}
+}
+
+// Put uploads the bundle as the object name
+func (t *ObjectTarget) Put(name string, bundle io.Reader) error {
+	data, err := io.ReadAll(bundle)
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	payloadHash := hex.EncodeToString(sum[:])
+	md5Sum := md5.Sum(data)
+
+	req, err := http.NewRequest(http.MethodPut, t.url(name), bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create upload request: %w", err)
+	}
+	req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(md5Sum[:]))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set(t.metaPrefix+"sha256", payloadHash)
+	for name, value := range t.putHeaders {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := t.do(req, payloadHash)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", name, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get downloads the object name and checks it against the SHA-256 recorded
+// in its metadata
+func (t *ObjectTarget) Get(name string) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, t.url(name), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download request: %w", err)
+	}
+
+	resp, err := t.do(req, emptyPayloadHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	if want := resp.Header.Get(t.metaPrefix + "sha256"); want != "" {
+		sum := sha256.Sum256(data)
+		if got := hex.EncodeToString(sum[:]); got != want {
+			return nil, fmt.Errorf("%w: %s has SHA-256 %s, want %s", ErrChecksumMismatch, name, got, want)
+		}
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// url returns the URL of the object name
+func (t *ObjectTarget) url(name string) string {
+	return t.base + "/" + encodePath(name)
+}
+
+// do signs and sends req, turning 404 into os.ErrNotExist and any other
+// status outside 2xx into an error
+func (t *ObjectTarget) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	if err := t.sign(req, payloadHash, t.now().UTC()); err != nil {
+		return nil, err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, os.ErrNotExist
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// emptyPayloadHash is the hex SHA-256 of an empty body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// encodePath percent-encodes path for a URL the way signatures expect:
+// everything but unreserved characters and '/' is encoded
+func encodePath(path string) string {
+	var encoded strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			encoded.WriteByte(c)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+	return encoded.String()
+}
+
+// sigV4 signs requests with AWS Signature Version 4, or its Google Cloud
+// Storage variant for HMAC keys
+type sigV4 struct {
+	algorithm  string // "AWS4" or "GOOG4"
+	headers    string // prefix of the date and payload hash headers
+	terminator string
+	service    string
+	region     string
+	keyID      string
+	secret     string
+	token      string
+}
+
+// sign adds the date, payload hash and Authorization headers to req,
+// signing every header it already has
+func (s sigV4) sign(req *http.Request, payloadHash string, now time.Time) error {
+	stamp := now.Format("20060102T150405Z")
+	req.Header.Set(s.headers+"date", stamp)
+	req.Header.Set(s.headers+"content-sha256", payloadHash)
+	if s.token != "" {
+		req.Header.Set(s.headers+"security-token", s.token)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	canonical.WriteString(req.Method + "\n" + req.URL.EscapedPath() + "\n" + canonicalQuery(req.URL) + "\n")
+	for _, name := range names {
+		canonical.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonical.WriteString("\n" + signedHeaders + "\n" + payloadHash)
+
+	scope := stamp[:8] + "/" + s.region + "/" + s.service + "/" + s.terminator
+	canonicalHash := sha256.Sum256([]byte(canonical.String()))
+	stringToSign := s.algorithm + "-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := []byte(s.algorithm + s.secret)
+	for _, part := range []string{stamp[:8], s.region, s.service, s.terminator} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.algorithm, s.keyID, scope, signedHeaders, signature))
+	return nil
+}
+
+// canonicalQuery returns the query of u sorted and encoded for signing
+func canonicalQuery(u *url.URL) string {
+	query := u.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, encodePath(key)+"="+strings.ReplaceAll(encodePath(value), "/", "%2F"))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// sharedKey signs requests with an Azure Storage account key
+type sharedKey struct {
+	account string
+	key     []byte
+}
+
+// sign adds the date, version and Authorization headers to req
+func (s sharedKey) sign(req *http.Request, payloadHash string, now time.Time) error {
+	req.Header.Set("x-ms-date", now.Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", azureVersion)
+
+	length := ""
+	if req.ContentLength > 0 {
+		length = fmt.Sprint(req.ContentLength)
+	}
+
+	var msHeaders []string
+	for name := range req.Header {
+		if name = strings.ToLower(name); strings.HasPrefix(name, "x-ms-") {
+			msHeaders = append(msHeaders, name)
+		}
+	}
+	sort.Strings(msHeaders)
+
+	var stringToSign strings.Builder
+	for _, value := range []string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		length,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date, superseded by x-ms-date
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+	} {
+		stringToSign.WriteString(value + "\n")
+	}
+	for _, name := range msHeaders {
+		stringToSign.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+	stringToSign.WriteString("/" + s.account + req.URL.EscapedPath())
+
+	signature := base64.StdEncoding.EncodeToString(hmacSHA256(s.key, stringToSign.String()))
+	req.Header.Set("Authorization", "SharedKey "+s.account+":"+signature)
+	return nil
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data under key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
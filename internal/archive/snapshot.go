@@ -0,0 +1,201 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+)
+
+const (
+	// LatestSnapshot restores the most recent snapshot
+	LatestSnapshot = "latest"
+
+	// snapshotPrefix starts the name of every object of a snapshot, so
+	// lifecycle rules can expire snapshots by prefix and age
+	snapshotPrefix = "snapshots/"
+
+	// latestName points at the most recent snapshot. It is outside
+	// snapshotPrefix, so expiring old snapshots leaves it in place.
+	latestName = "latest-snapshot.json"
+
+	// snapshotIDFormat formats snapshot IDs, which sort by time
+	snapshotIDFormat = "20060102T150405Z"
+)
+
+// ErrNoSnapshot is returned when a snapshot that was never taken is restored
+var ErrNoSnapshot = errors.New("snapshot not found")
+
+// Manifest describes a snapshot of every namespace of a store
+type Manifest struct {
+	// Kind, Format and MinFormat are the header of every bundle, with
+	// ManifestKind as the kind
+	Kind      string `json:"kind,omitempty"`
+	Format    int    `json:"format"`
+	MinFormat int    `json:"min_format,omitempty"`
+
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Namespaces lists the namespaces in the snapshot
+	Namespaces map[string]SnapshotNamespace `json:"namespaces"`
+}
+
+// SnapshotNamespace describes one namespace of a snapshot
+type SnapshotNamespace struct {
+	Entries      int    `json:"entries"`
+	SnapshotHash string `json:"snapshot_hash"`
+}
+
+// Snapshot writes every namespace of store to target, without removing
+// anything from the store, and returns the manifest of the snapshot. Its
+// objects are named "snapshots/<id>/...", where the ID is the UTC time of the
+// snapshot, such as "20250512T175823Z".
+func Snapshot(store contextstore.ContextStore, target Target, now time.Time) (*Manifest, error) {
+	archiver, ok := store.(contextstore.NamespaceArchiver)
+	if !ok {
+		return nil, contextstore.ErrArchiveUnsupported
+	}
+	hasher, ok := store.(contextstore.SnapshotHasher)
+	if !ok {
+		return nil, contextstore.ErrSnapshotUnsupported
+	}
+
+	hashes, err := hasher.SnapshotHashes()
+	if err != nil {
+		return nil, err
+	}
+	namespaces := make([]string, 0, len(hashes))
+	for namespace := range hashes {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	now = now.UTC()
+	manifest := &Manifest{
+		Kind:       ManifestKind,
+		Format:     FormatVersion,
+		MinFormat:  MinFormatVersion,
+		ID:         now.Format(snapshotIDFormat),
+		CreatedAt:  now,
+		Namespaces: make(map[string]SnapshotNamespace, len(namespaces)),
+	}
+	for _, namespace := range namespaces {
+		entries, err := archiver.ExportNamespace(namespace)
+		if err != nil {
+			return nil, err
+		}
+		bundle := newBundle(namespace, now, entries)
+		if err := put(target, snapshotName(manifest.ID, namespace), bundle); err != nil {
+			return nil, err
+		}
+		manifest.Namespaces[namespace] = SnapshotNamespace{Entries: len(entries), SnapshotHash: bundle.SnapshotHash}
+	}
+
+	// The manifest is written last, so a snapshot without one is incomplete
+	if err := putJSON(target, snapshotPrefix+manifest.ID+"/manifest.json", manifest); err != nil {
+		return nil, err
+	}
+	if err := putJSON(target, latestName, map[string]string{"id": manifest.ID}); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// RestoreSnapshot imports every namespace of the snapshot id, or of the
+// most recent one for LatestSnapshot, into store and returns its manifest.
+// Every bundle is checked before anything is imported, and nothing is
+// imported if any of the snapshot's namespaces holds entries.
+func RestoreSnapshot(store contextstore.ContextStore, target Target, id string) (*Manifest, error) {
+	archiver, ok := store.(contextstore.NamespaceArchiver)
+	if !ok {
+		return nil, contextstore.ErrArchiveUnsupported
+	}
+
+	if id == LatestSnapshot {
+		var latest struct {
+			ID string `json:"id"`
+		}
+		if err := getJSON(target, latestName, &latest); err != nil {
+			return nil, err
+		}
+		id = latest.ID
+	}
+
+	var manifest Manifest
+	if err := getJSON(target, snapshotPrefix+id+"/manifest.json", &manifest); err != nil {
+		return nil, err
+	}
+	if err := checkFormat(ManifestKind, manifest.Kind, manifest.Format, manifest.MinFormat); err != nil {
+		return nil, fmt.Errorf("snapshot %s: %w", id, err)
+	}
+
+	if hasher, ok := store.(contextstore.SnapshotHasher); ok {
+		hashes, err := hasher.SnapshotHashes()
+		if err != nil {
+			return nil, err
+		}
+		for namespace := range manifest.Namespaces {
+			if _, exists := hashes[namespace]; exists {
+				return nil, fmt.Errorf("%w: %s", contextstore.ErrNamespaceNotEmpty, namespace)
+			}
+		}
+	}
+
+	bundles := make([]*Bundle, 0, len(manifest.Namespaces))
+	for namespace, described := range manifest.Namespaces {
+		bundle, err := load(target, snapshotName(id, namespace), namespace)
+		if err != nil {
+			return nil, err
+		}
+		if bundle.SnapshotHash != described.SnapshotHash {
+			return nil, fmt.Errorf("%w: snapshot %s of %s does not match its manifest", ErrIntegrity, id, namespace)
+		}
+		bundles = append(bundles, bundle)
+	}
+	for _, bundle := range bundles {
+		if err := archiver.ImportNamespace(bundle.Namespace, bundle.Entries); err != nil {
+			return nil, err
+		}
+	}
+	return &manifest, nil
+}
+
+// snapshotName returns the name of a namespace's bundle in snapshot id
+func snapshotName(id, namespace string) string {
+	return snapshotPrefix + id + "/" + BundleName(namespace)
+}
+
+// putJSON stores v as JSON in target under name
+func putJSON(target Target, name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", name, err)
+	}
+	if err := target.Put(name, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to store %s: %w", name, err)
+	}
+	return nil
+}
+
+// getJSON reads the JSON object stored under name into v
+func getJSON(target Target, name string, v interface{}) error {
+	reader, err := target.Get(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrNoSnapshot, name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer reader.Close()
+
+	if err := json.NewDecoder(reader).Decode(v); err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return nil
+}
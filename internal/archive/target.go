@@ -0,0 +1,35 @@
+package archive
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// OpenTarget returns the target at location: "s3://bucket/prefix",
+// "gs://bucket/prefix" or "azblob://container/prefix" for object storage
+// with credentials from the environment, or a local directory path. client
+// is used for object storage; nil uses one with a five minute timeout.
+func OpenTarget(location string, client *http.Client) (Target, error) {
+	scheme, _, found := strings.Cut(location, "://")
+	if !found {
+		return Directory{Path: location}, nil
+	}
+
+	parsed, err := url.Parse(location)
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid archive location %q: a bucket or container is required", location)
+	}
+	bucket, prefix := parsed.Host, strings.TrimPrefix(parsed.Path, "/")
+
+	switch scheme {
+	case "s3":
+		return NewS3Target(bucket, prefix, client)
+	case "gs":
+		return NewGCSTarget(bucket, prefix, client)
+	case "azblob":
+		return NewAzureTarget(bucket, prefix, client)
+	}
+	return nil, fmt.Errorf("unsupported archive location scheme %q: use s3, gs, azblob or a directory", scheme)
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+)
+
+// APIKeyAuthenticator authenticates bearer tokens that are one of a fixed
+// set of API keys
+type APIKeyAuthenticator struct {
+	// keys maps the SHA-256 hash of each key to its identity, so lookups
+	// take the same time whichever key is sent
+	keys map[[sha256.Size]byte]Identity
+}
+
+// NewAPIKeyAuthenticator returns an authenticator accepting each key of
+// keys as a bearer token, for the identity it maps to. The identities'
+// Method is set to MethodAPIKey.
+func NewAPIKeyAuthenticator(keys map[string]Identity) *APIKeyAuthenticator {
+	a := &APIKeyAuthenticator{keys: make(map[[sha256.Size]byte]Identity, len(keys))}
+	for key, identity := range keys {
+		identity.Method = MethodAPIKey
+		a.keys[sha256.Sum256([]byte(key))] = identity
+	}
+	return a
+}
+
+// Authenticate implements Authenticator
+func (a *APIKeyAuthenticator) Authenticate(_ context.Context, credentials Credentials) (Identity, error) {
+	if credentials.BearerToken == "" {
+		return Identity{}, ErrNoCredentials
+	}
+	sum := sha256.Sum256([]byte(credentials.BearerToken))
+	for hash, identity := range a.keys {
+		if subtle.ConstantTimeCompare(sum[:], hash[:]) == 1 {
+			return identity, nil
+		}
+	}
+	return Identity{}, fmt.Errorf("%w: unknown API key", ErrUnauthenticated)
+}
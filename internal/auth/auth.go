@@ -0,0 +1,135 @@
+// Package auth authenticates callers of the network transports: the gRPC
+// service and the quick-capture endpoint. The stdio transport needs none,
+// since only the process that started the server can reach it.
+//
+// An Authenticator turns the credentials of a request, a bearer token or a
+// verified client certificate, into an Identity naming the caller and the
+// namespaces it may use. Middleware for HTTP and gRPC authenticates every
+// request and puts the identity in its context, where handlers read it for
+// audit logs and namespace checks.
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// AllNamespaces in an identity's namespaces grants every namespace
+const AllNamespaces = "*"
+
+// Authentication methods recorded in Identity.Method
+const (
+	MethodAPIKey = "api_key"
+	MethodOIDC   = "oidc"
+	MethodMTLS   = "mtls"
+)
+
+var (
+	// ErrUnauthenticated is returned for a request whose credentials are
+	// missing or invalid.
+	ErrUnauthenticated = errors.New("unauthenticated")
+
+	// ErrNoCredentials is returned by an Authenticator for a request
+	// without the kind of credentials it checks, so a Chain tries the
+	// next one. It is an ErrUnauthenticated.
+	ErrNoCredentials = fmt.Errorf("%w: no credentials", ErrUnauthenticated)
+
+	// ErrForbidden is returned for an identity using a namespace it is not
+	// allowed.
+	ErrForbidden = errors.New("namespace not allowed")
+)
+
+// Credentials are what a request presents to prove who sent it
+type Credentials struct {
+	// BearerToken is the token of an "Authorization: Bearer" header or
+	// "authorization" metadata. Empty if there is none.
+	BearerToken string
+
+	// VerifiedChains are the client certificate chains the TLS handshake
+	// verified. Empty without mutual TLS.
+	VerifiedChains [][]*x509.Certificate
+}
+
+// Identity is an authenticated caller
+type Identity struct {
+	// Subject names the caller: the API key's subject, the token's "sub"
+	// claim or the certificate's common name.
+	Subject string
+
+	// Method is how the caller was authenticated, such as MethodOIDC
+	Method string
+
+	// Namespaces lists the namespaces the caller may save to and retrieve
+	// from. AllNamespaces grants every one; an empty list grants none.
+	Namespaces []string
+}
+
+// Allows reports whether the identity may use namespace. Only an identity
+// granted AllNamespaces may use AllNamespaces, as a search of every
+// namespace does.
+func (i Identity) Allows(namespace string) bool {
+	return slices.Contains(i.Namespaces, AllNamespaces) || slices.Contains(i.Namespaces, namespace)
+}
+
+// Authenticator authenticates the credentials of a request. It returns
+// ErrNoCredentials if the request has none of the kind it checks, and an
+// ErrUnauthenticated error if they are invalid.
+type Authenticator interface {
+	Authenticate(ctx context.Context, credentials Credentials) (Identity, error)
+}
+
+// Chain tries authenticators in order and returns the first identity one
+// of them authenticates. It fails with ErrNoCredentials only if every
+// authenticator did, and otherwise with the errors of the authenticators
+// that rejected the credentials.
+func Chain(authenticators ...Authenticator) Authenticator {
+	return chain(slices.DeleteFunc(slices.Clone(authenticators), func(a Authenticator) bool { return a == nil }))
+}
+
+type chain []Authenticator
+
+// Authenticate implements Authenticator
+func (c chain) Authenticate(ctx context.Context, credentials Credentials) (Identity, error) {
+	var errs []error
+	for _, authenticator := range c {
+		identity, err := authenticator.Authenticate(ctx, credentials)
+		if err == nil {
+			return identity, nil
+		}
+		if !errors.Is(err, ErrNoCredentials) {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 {
+		return Identity{}, ErrNoCredentials
+	}
+	return Identity{}, errors.Join(errs...)
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying identity
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// FromContext returns the identity ctx carries, if a transport
+// authenticated its request
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+// Authorize returns ErrForbidden if ctx carries an identity that may not
+// use namespace. A request without an identity came through a transport
+// that does not authenticate, and may use any namespace.
+func Authorize(ctx context.Context, namespace string) error {
+	identity, ok := FromContext(ctx)
+	if !ok || identity.Allows(namespace) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s may not use namespace %q", ErrForbidden, identity.Subject, namespace)
+}
@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIdentityAllows(t *testing.T) {
+	identity := Identity{Subject: "ci", Namespaces: []string{"default", "docs"}}
+	if !identity.Allows("docs") || identity.Allows("secrets") || identity.Allows(AllNamespaces) {
+		t.Errorf("Expected only the listed namespaces to be allowed, got %+v", identity)
+	}
+	admin := Identity{Subject: "admin", Namespaces: []string{AllNamespaces}}
+	if !admin.Allows("secrets") || !admin.Allows(AllNamespaces) {
+		t.Errorf("Expected AllNamespaces to allow every namespace")
+	}
+	if (Identity{}).Allows("default") {
+		t.Errorf("Expected an identity without namespaces to be allowed none")
+	}
+
+	ctx := context.Background()
+	if err := Authorize(ctx, "secrets"); err != nil {
+		t.Errorf("Expected a request without an identity to be authorized, got %v", err)
+	}
+	ctx = WithIdentity(ctx, identity)
+	if err := Authorize(ctx, "docs"); err != nil {
+		t.Errorf("Authorize(docs) = %v", err)
+	}
+	if err := Authorize(ctx, "secrets"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Authorize(secrets) = %v, want ErrForbidden", err)
+	}
+}
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	a := NewAPIKeyAuthenticator(map[string]Identity{"key-1": {Subject: "ci", Namespaces: []string{"default"}}})
+
+	identity, err := a.Authenticate(context.Background(), Credentials{BearerToken: "key-1"})
+	if err != nil || identity.Subject != "ci" || identity.Method != MethodAPIKey {
+		t.Errorf("Expected the ci identity, got %+v, %v", identity, err)
+	}
+	if _, err := a.Authenticate(context.Background(), Credentials{BearerToken: "key-2"}); !errors.Is(err, ErrUnauthenticated) || errors.Is(err, ErrNoCredentials) {
+		t.Errorf("Expected an unknown key to be unauthenticated, got %v", err)
+	}
+	if _, err := a.Authenticate(context.Background(), Credentials{}); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("Expected ErrNoCredentials without a token, got %v", err)
+	}
+}
+
+func TestMTLSAuthenticator(t *testing.T) {
+	a := NewMTLSAuthenticator(map[string][]string{"indexer": {"docs"}})
+	chain := func(commonName string) Credentials {
+		return Credentials{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: commonName}}}}}
+	}
+
+	identity, err := a.Authenticate(context.Background(), chain("indexer"))
+	if err != nil || identity.Subject != "indexer" || identity.Method != MethodMTLS || !identity.Allows("docs") {
+		t.Errorf("Expected the indexer identity, got %+v, %v", identity, err)
+	}
+	if _, err := a.Authenticate(context.Background(), chain("intruder")); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("Expected an unlisted certificate to be unauthenticated, got %v", err)
+	}
+	if _, err := a.Authenticate(context.Background(), Credentials{BearerToken: "key"}); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("Expected ErrNoCredentials without a certificate, got %v", err)
+	}
+}
+
+func TestChain(t *testing.T) {
+	a := Chain(
+		NewAPIKeyAuthenticator(map[string]Identity{"key-1": {Subject: "ci"}}),
+		nil,
+		NewMTLSAuthenticator(map[string][]string{"indexer": {"docs"}}),
+	)
+
+	if identity, err := a.Authenticate(context.Background(), Credentials{BearerToken: "key-1"}); err != nil || identity.Subject != "ci" {
+		t.Errorf("Expected the API key to authenticate, got %+v, %v", identity, err)
+	}
+	if _, err := a.Authenticate(context.Background(), Credentials{}); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("Expected ErrNoCredentials without any credentials, got %v", err)
+	}
+	if _, err := a.Authenticate(context.Background(), Credentials{BearerToken: "key-2"}); !errors.Is(err, ErrUnauthenticated) || errors.Is(err, ErrNoCredentials) {
+		t.Errorf("Expected the rejected key's error, got %v", err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	a := NewAPIKeyAuthenticator(map[string]Identity{"key-1": {Subject: "ci"}})
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := Middleware(a, logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ := FromContext(r.Context())
+		w.Write([]byte(identity.Subject))
+	}))
+
+	for _, test := range []struct {
+		header   string
+		wantCode int
+		wantBody string
+	}{
+		{"Bearer key-1", http.StatusOK, "ci"},
+		{"Bearer key-2", http.StatusUnauthorized, "unauthorized\n"},
+		{"key-1", http.StatusUnauthorized, "unauthorized\n"},
+		{"", http.StatusUnauthorized, "unauthorized\n"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.header != "" {
+			req.Header.Set("Authorization", test.header)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		if recorder.Code != test.wantCode || recorder.Body.String() != test.wantBody {
+			t.Errorf("Authorization %q: got %d %q, want %d %q", test.header, recorder.Code, recorder.Body.String(), test.wantCode, test.wantBody)
+		}
+	}
+}
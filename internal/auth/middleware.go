@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// HTTPCredentials returns the credentials of an HTTP request
+func HTTPCredentials(r *http.Request) Credentials {
+	var c Credentials
+	if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		c.BearerToken = token
+	}
+	if r.TLS != nil {
+		c.VerifiedChains = r.TLS.VerifiedChains
+	}
+	return c
+}
+
+// GRPCCredentials returns the credentials of the gRPC call ctx belongs to
+func GRPCCredentials(ctx context.Context) Credentials {
+	var c Credentials
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		if token, found := strings.CutPrefix(value, "Bearer "); found {
+			c.BearerToken = token
+			break
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			c.VerifiedChains = info.State.VerifiedChains
+		}
+	}
+	return c
+}
+
+// Middleware authenticates each request with authenticator before passing
+// it to next with the identity in its context. Requests that fail are
+// answered 401 Unauthorized and logged to logger.
+func Middleware(authenticator Authenticator, logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, err := authenticator.Authenticate(r.Context(), HTTPCredentials(r))
+		if err != nil {
+			logger.Warn("Authentication failed", "transport", "http", "path", r.URL.Path, "remote_addr", r.RemoteAddr, "error", err)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
+	})
+}
+
+// UnaryServerInterceptor authenticates each unary gRPC call with
+// authenticator, failing it with Unauthenticated, and passes the identity
+// to the handler in its context. Failures are logged to logger.
+func UnaryServerInterceptor(authenticator Authenticator, logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authenticateGRPC(ctx, authenticator, logger, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor authenticates each streaming gRPC call like
+// UnaryServerInterceptor
+func StreamServerInterceptor(authenticator Authenticator, logger *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticateGRPC(stream.Context(), authenticator, logger, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &identityStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// authenticateGRPC returns ctx with the identity of the call it belongs to
+func authenticateGRPC(ctx context.Context, authenticator Authenticator, logger *slog.Logger, method string) (context.Context, error) {
+	identity, err := authenticator.Authenticate(ctx, GRPCCredentials(ctx))
+	if err != nil {
+		logger.Warn("Authentication failed", "transport", "grpc", "method", method, "error", err)
+		message := "missing or invalid credentials"
+		if errors.Is(err, ErrNoCredentials) {
+			message = "missing credentials"
+		}
+		return ctx, status.Error(codes.Unauthenticated, message)
+	}
+	return WithIdentity(ctx, identity), nil
+}
+
+// identityStream is a server stream whose context carries the caller's
+// identity
+type identityStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the stream's context with the identity
+func (s *identityStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// ErrNoClientCAs is returned by ServerTLSConfig for a client CA file
+// without any certificate.
+var ErrNoClientCAs = errors.New("no certificates in client CA file")
+
+// MTLSAuthenticator authenticates clients by the certificate the TLS
+// handshake verified against the client CAs
+type MTLSAuthenticator struct {
+	// namespaces maps the common name of each allowed client certificate
+	// to its namespaces
+	namespaces map[string][]string
+}
+
+// NewMTLSAuthenticator returns an authenticator accepting verified client
+// certificates whose subject common name is a key of namespaces, granting
+// the namespaces it maps to.
+func NewMTLSAuthenticator(namespaces map[string][]string) *MTLSAuthenticator {
+	return &MTLSAuthenticator{namespaces: namespaces}
+}
+
+// Authenticate implements Authenticator
+func (a *MTLSAuthenticator) Authenticate(_ context.Context, credentials Credentials) (Identity, error) {
+	if len(credentials.VerifiedChains) == 0 || len(credentials.VerifiedChains[0]) == 0 {
+		return Identity{}, ErrNoCredentials
+	}
+	subject := credentials.VerifiedChains[0][0].Subject.CommonName
+	namespaces, ok := a.namespaces[subject]
+	if !ok {
+		return Identity{}, fmt.Errorf("%w: client certificate %q is not allowed", ErrUnauthenticated, subject)
+	}
+	return Identity{Subject: subject, Method: MethodMTLS, Namespaces: slices.Clone(namespaces)}, nil
+}
+
+// ServerTLSConfig returns the TLS configuration of a transport serving the
+// certificate and key in certFile and keyFile. If clientCAFile is set,
+// client certificates are verified against the CAs it holds: clients
+// without one can still authenticate with a bearer token.
+func ServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCAFile == "" {
+		return config, nil
+	}
+
+	pem, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file: %w", err)
+	}
+	config.ClientCAs = x509.NewCertPool()
+	if !config.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%w: %s", ErrNoClientCAs, clientCAFile)
+	}
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	return config, nil
+}
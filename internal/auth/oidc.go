@@ -0,0 +1,416 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // SHA-256 for RS256 and ES256
+	_ "crypto/sha512" // SHA-384 and SHA-512 for RS384, RS512, ES384 and ES512
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultNamespacesClaim is the token claim listing the namespaces of
+	// the caller when OIDCConfig.NamespacesClaim is empty
+	DefaultNamespacesClaim = "namespaces"
+
+	// oidcLeeway is the clock skew tolerated when checking the exp and nbf
+	// claims
+	oidcLeeway = time.Minute
+
+	// oidcKeysTTL is how long fetched signing keys are used before they
+	// are fetched again
+	oidcKeysTTL = time.Hour
+
+	// oidcRefetchInterval is the shortest wait between fetches of the
+	// signing keys prompted by tokens signed with an unknown key, so
+	// forged key IDs cannot flood the issuer
+	oidcRefetchInterval = time.Minute
+
+	// oidcMaxResponseBytes bounds the discovery and key set responses
+	oidcMaxResponseBytes = 1 << 20
+)
+
+// ErrOIDCConfig is returned by NewOIDCAuthenticator without an issuer or an
+// audience.
+var ErrOIDCConfig = errors.New("OIDC issuer and audience are required")
+
+// OIDCConfig configures an OIDCAuthenticator
+type OIDCConfig struct {
+	// Issuer is the URL of the OpenID provider, which tokens must name in
+	// their "iss" claim
+	Issuer string
+
+	// Audience must be in the "aud" claim of tokens, so tokens issued to
+	// other applications are refused
+	Audience string
+
+	// JWKSURL is where the provider's signing keys are fetched from. Empty
+	// discovers it from the issuer's /.well-known/openid-configuration.
+	JWKSURL string
+
+	// NamespacesClaim is the claim listing the namespaces of the caller,
+	// as an array or a space-separated string. Empty uses
+	// DefaultNamespacesClaim. A token without it grants no namespace.
+	NamespacesClaim string
+
+	// HTTPClient fetches the discovery document and the keys. nil uses
+	// http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// OIDCAuthenticator authenticates bearer tokens that are JWTs issued by an
+// OpenID Connect provider, checking their signature against the provider's
+// published keys, their issuer, audience and validity period. RS256, RS384,
+// RS512, ES256, ES384 and ES512 signatures are accepted.
+type OIDCAuthenticator struct {
+	config OIDCConfig
+	now    func() time.Time
+
+	mu      sync.Mutex
+	jwksURL string
+	keys    map[string]crypto.PublicKey
+
+	// fetched is when keys were fetched, and attempted when they last
+	// were or failed to be
+	fetched   time.Time
+	attempted time.Time
+}
+
+// NewOIDCAuthenticator returns an authenticator for tokens issued by
+// config.Issuer. Keys are fetched on first use, so the provider need not be
+// reachable yet.
+func NewOIDCAuthenticator(config OIDCConfig) (*OIDCAuthenticator, error) {
+	if config.Issuer == "" || config.Audience == "" {
+		return nil, ErrOIDCConfig
+	}
+	if config.NamespacesClaim == "" {
+		config.NamespacesClaim = DefaultNamespacesClaim
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	return &OIDCAuthenticator{config: config, now: time.Now, jwksURL: config.JWKSURL}, nil
+}
+
+// jwtHeader is the header of a JWT
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Authenticate implements Authenticator
+func (a *OIDCAuthenticator) Authenticate(ctx context.Context, credentials Credentials) (Identity, error) {
+	token := credentials.BearerToken
+	if token == "" {
+		return Identity{}, ErrNoCredentials
+	}
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: invalid OIDC token: %s", ErrUnauthenticated, fmt.Sprintf(format, args...))
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Identity{}, invalid("not a JWT")
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Identity{}, invalid("malformed header: %v", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Identity{}, invalid("malformed signature: %v", err)
+	}
+
+	key, err := a.key(ctx, header.Kid)
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %w", ErrUnauthenticated, err)
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return Identity{}, invalid("%v", err)
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Identity{}, invalid("malformed claims: %v", err)
+	}
+	if err := a.checkClaims(claims); err != nil {
+		return Identity{}, invalid("%v", err)
+	}
+
+	subject, _ := claims["sub"].(string)
+	return Identity{Subject: subject, Method: MethodOIDC, Namespaces: stringList(claims[a.config.NamespacesClaim])}, nil
+}
+
+// checkClaims returns an error unless claims name the issuer and audience
+// and the token is valid now
+func (a *OIDCAuthenticator) checkClaims(claims map[string]any) error {
+	if issuer, _ := claims["iss"].(string); issuer != a.config.Issuer {
+		return fmt.Errorf("issuer %q is not %q", issuer, a.config.Issuer)
+	}
+	if !hasAudience(claims["aud"], a.config.Audience) {
+		return fmt.Errorf("audience %q is missing", a.config.Audience)
+	}
+
+	now := a.now()
+	expires, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("exp claim is missing")
+	}
+	if now.After(time.Unix(int64(expires), 0).Add(oidcLeeway)) {
+		return errors.New("token expired")
+	}
+	if notBefore, ok := claims["nbf"].(float64); ok && now.Add(oidcLeeway).Before(time.Unix(int64(notBefore), 0)) {
+		return errors.New("token not valid yet")
+	}
+	return nil
+}
+
+// key returns the signing key with ID kid, fetching the keys if they are
+// stale or kid is unknown, at most once per oidcRefetchInterval. Stale keys
+// stay in use while the provider cannot be reached. A token without a key
+// ID uses the only key.
+func (a *OIDCAuthenticator) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now()
+	key, known := a.lookup(kid)
+	if known && now.Sub(a.fetched) <= oidcKeysTTL {
+		return key, nil
+	}
+	if now.Sub(a.attempted) >= oidcRefetchInterval {
+		a.attempted = now
+		keys, err := a.fetchKeys(ctx)
+		if err != nil && !known {
+			return nil, err
+		}
+		if err == nil {
+			a.keys, a.fetched = keys, now
+			key, known = a.lookup(kid)
+		}
+	}
+	if !known {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// lookup returns the cached key with ID kid
+func (a *OIDCAuthenticator) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(a.keys) == 1 {
+		for _, key := range a.keys {
+			return key, true
+		}
+	}
+	key, ok := a.keys[kid]
+	return key, ok
+}
+
+// fetchKeys fetches the provider's signing keys, discovering where they are
+// published first if needed. Keys of unsupported types are skipped.
+func (a *OIDCAuthenticator) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	if a.jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := a.getJSON(ctx, strings.TrimSuffix(a.config.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+			return nil, fmt.Errorf("failed to discover OIDC signing keys: %w", err)
+		}
+		if discovery.JWKSURI == "" {
+			return nil, errors.New("failed to discover OIDC signing keys: jwks_uri is missing")
+		}
+		a.jwksURL = discovery.JWKSURI
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := a.getJSON(ctx, a.jwksURL, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch OIDC signing keys: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+// getJSON decodes the JSON document at url into v
+func (a *OIDCAuthenticator) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := a.config.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseBytes)).Decode(v)
+}
+
+// jsonWebKey is an RSA or EC public key of a JSON Web Key Set
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey returns the key as an *rsa.PublicKey or *ecdsa.PublicKey
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA exponent %q", k.E)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("EC point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// verifySignature checks signature over signed with key, as alg requires
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	if len(alg) != 5 || (alg[:2] != "RS" && alg[:2] != "ES") {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if alg[:2] != "RS" {
+			return fmt.Errorf("algorithm %q does not match an RSA key", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(key, hash, digest, signature); err != nil {
+			return errors.New("signature mismatch")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if alg[:2] != "ES" || len(signature) != 2*size {
+			return fmt.Errorf("algorithm %q does not match an EC key", alg)
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errors.New("signature mismatch")
+		}
+		return nil
+	default:
+		return errors.New("unsupported key")
+	}
+}
+
+// decodeSegment decodes a base64url JSON segment of a JWT into v
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// decodeBigInt decodes a base64url big-endian integer of a JSON Web Key
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(data) == 0 {
+		return nil, fmt.Errorf("invalid key parameter %q", s)
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// hasAudience reports whether the aud claim names audience. A string claim
+// must equal it; only an array is searched.
+func hasAudience(claim any, audience string) bool {
+	if aud, ok := claim.(string); ok {
+		return aud == audience
+	}
+	return slices.Contains(stringList(claim), audience)
+}
+
+// stringList returns a claim holding a string or an array of strings as a
+// list. A string claim is split on spaces, like the "scope" claim.
+func stringList(claim any) []string {
+	switch claim := claim.(type) {
+	case string:
+		return strings.Fields(claim)
+	case []any:
+		list := make([]string, 0, len(claim))
+		for _, item := range claim {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testIssuer serves OpenID discovery and a key set holding an RSA key "rsa"
+// and an EC key "ec", counting the key set fetches
+type testIssuer struct {
+	*httptest.Server
+	rsaKey  *rsa.PrivateKey
+	ecKey   *ecdsa.PrivateKey
+	fetches atomic.Int32
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate EC key: %v", err)
+	}
+	issuer := &testIssuer{rsaKey: rsaKey, ecKey: ecKey}
+
+	encode := func(n *big.Int, size int) string {
+		return base64.RawURLEncoding.EncodeToString(n.FillBytes(make([]byte, size)))
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": issuer.URL, "jwks_uri": issuer.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		issuer.fetches.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "use": "sig", "n": encode(rsaKey.N, rsaKey.Size()), "e": "AQAB"},
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encode(ecKey.X, 32), "y": encode(ecKey.Y, 32)},
+			{"kty": "oct", "kid": "secret", "k": "c2VjcmV0"},
+		}})
+	})
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+// sign returns a JWT with claims, signed with the key named kid
+func (i *testIssuer) sign(t *testing.T, kid string, claims map[string]any) string {
+	t.Helper()
+	alg := map[string]string{"rsa": "RS256", "ec": "ES256"}[kid]
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	var err error
+	if kid == "ec" {
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, i.ecKey, digest[:])
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	} else {
+		signature, err = rsa.SignPKCS1v15(rand.Reader, i.rsaKey, crypto.SHA256, digest[:])
+	}
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestOIDCAuthenticator(t *testing.T) {
+	if _, err := NewOIDCAuthenticator(OIDCConfig{Issuer: "https://issuer.example"}); !errors.Is(err, ErrOIDCConfig) {
+		t.Errorf("Expected ErrOIDCConfig without an audience, got %v", err)
+	}
+
+	issuer := newTestIssuer(t)
+	a, err := NewOIDCAuthenticator(OIDCConfig{Issuer: issuer.URL, Audience: "projectmemory"})
+	if err != nil {
+		t.Fatalf("NewOIDCAuthenticator failed: %v", err)
+	}
+	now := time.Now()
+	a.now = func() time.Time { return now }
+
+	claims := func(changes map[string]any) map[string]any {
+		c := map[string]any{
+			"iss":        issuer.URL,
+			"aud":        []string{"other", "projectmemory"},
+			"sub":        "build-bot",
+			"exp":        now.Add(time.Hour).Unix(),
+			"namespaces": []string{"docs"},
+		}
+		for key, value := range changes {
+			if value == nil {
+				delete(c, key)
+			} else {
+				c[key] = value
+			}
+		}
+		return c
+	}
+
+	for _, kid := range []string{"rsa", "ec"} {
+		identity, err := a.Authenticate(context.Background(), Credentials{BearerToken: issuer.sign(t, kid, claims(nil))})
+		if err != nil {
+			t.Fatalf("Expected a %s token to authenticate, got %v", kid, err)
+		}
+		if identity.Subject != "build-bot" || identity.Method != MethodOIDC || !identity.Allows("docs") || identity.Allows("default") {
+			t.Errorf("Unexpected identity %+v", identity)
+		}
+	}
+	if _, err := a.Authenticate(context.Background(), Credentials{BearerToken: issuer.sign(t, "rsa", claims(map[string]any{"aud": "projectmemory"}))}); err != nil {
+		t.Errorf("Expected a token for the audience alone to authenticate, got %v", err)
+	}
+	if fetches := issuer.fetches.Load(); fetches != 1 {
+		t.Errorf("Expected the keys to be fetched once, got %d fetches", fetches)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"not a JWT", "opaque-token"},
+		{"wrong issuer", issuer.sign(t, "rsa", claims(map[string]any{"iss": "https://evil.example"}))},
+		{"wrong audience", issuer.sign(t, "rsa", claims(map[string]any{"aud": "other"}))},
+		{"audience in a string", issuer.sign(t, "rsa", claims(map[string]any{"aud": "other projectmemory"}))},
+		{"expired", issuer.sign(t, "rsa", claims(map[string]any{"exp": now.Add(-time.Hour).Unix()}))},
+		{"no expiry", issuer.sign(t, "rsa", claims(map[string]any{"exp": nil}))},
+		{"not yet valid", issuer.sign(t, "rsa", claims(map[string]any{"nbf": now.Add(time.Hour).Unix()}))},
+		{"tampered", strings.Replace(issuer.sign(t, "rsa", claims(nil)), ".", ".e30", 1)},
+		{"unknown key", issuer.sign(t, "rotated", claims(nil))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := a.Authenticate(context.Background(), Credentials{BearerToken: test.token}); !errors.Is(err, ErrUnauthenticated) || errors.Is(err, ErrNoCredentials) {
+				t.Errorf("Expected the token to be rejected, got %v", err)
+			}
+		})
+	}
+	if fetches := issuer.fetches.Load(); fetches != 1 {
+		t.Errorf("Expected an unknown key not to refetch the keys within a minute, got %d fetches", fetches)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := a.Authenticate(context.Background(), Credentials{BearerToken: issuer.sign(t, "rotated", claims(nil))}); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("Expected an unknown key to be rejected, got %v", err)
+	}
+	if fetches := issuer.fetches.Load(); fetches != 2 {
+		t.Errorf("Expected an unknown key to refetch the keys after a minute, got %d fetches", fetches)
+	}
+}
@@ -0,0 +1,268 @@
+// Package cassette records the HTTP requests made to LLM and embedding
+// providers, and their responses, to a file and replays them later, so
+// tests and bug reproductions run the same way without live API access.
+// API keys are redacted before anything is written.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Mode selects whether a Transport records or replays
+type Mode string
+
+const (
+	// ModeRecord sends requests to the provider and records them
+	ModeRecord Mode = "record"
+
+	// ModeReplay answers requests from the cassette without sending them
+	ModeReplay Mode = "replay"
+)
+
+// Redacted replaces the values of credentials in a cassette
+const Redacted = "REDACTED"
+
+// Errors
+var (
+	ErrInvalidMode   = errors.New("cassette mode must be record or replay")
+	ErrNoInteraction = errors.New("cassette has no recorded response for request")
+)
+
+// sensitiveNames are substrings of the header and query parameter names
+// whose values are redacted
+var sensitiveNames = []string{"auth", "key", "token", "secret", "cookie"}
+
+// Interaction is one recorded request and its response
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded request, with credentials redacted
+type Request struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+// Response is a recorded response
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// Cassette is the file format: the interactions in the order they were
+// recorded
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Transport is an http.RoundTripper that records to or replays from a
+// cassette file. It is safe for concurrent use.
+type Transport struct {
+	path     string
+	mode     Mode
+	next     http.RoundTripper
+	cassette Cassette
+	used     []bool
+	mu       sync.Mutex
+}
+
+// New creates a Transport for the cassette at path. Recording starts a new
+// cassette and sends requests with next, or http.DefaultTransport if nil.
+// Replaying loads the cassette and never sends a request.
+func New(path string, mode Mode, next http.RoundTripper) (*Transport, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	t := &Transport{path: path, mode: mode, next: next}
+
+	switch mode {
+	case ModeRecord:
+		if err := t.save(); err != nil {
+			return nil, err
+		}
+	case ModeReplay:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cassette: %w", err)
+		}
+		if err := json.Unmarshal(data, &t.cassette); err != nil {
+			return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+		}
+		t.used = make([]bool, len(t.cassette.Interactions))
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidMode, mode)
+	}
+	return t, nil
+}
+
+// Mode returns whether the transport records or replays
+func (t *Transport) Mode() Mode {
+	return t.mode
+}
+
+// RoundTrip records or replays req
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded, err := newRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if t.mode == ModeReplay {
+		return t.replay(req, recorded)
+	}
+
+	// The body was consumed while recording it
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(strings.NewReader(recorded.Body))
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response to record: %w", err)
+	}
+
+	t.mu.Lock()
+	t.cassette.Interactions = append(t.cassette.Interactions, Interaction{
+		Request: recorded,
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Headers:    redactHeaders(resp.Header),
+			Body:       string(body),
+		},
+	})
+	err = t.save()
+	t.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// replay answers req with the first unused interaction recorded for the
+// same method, URL and body
+func (t *Transport) replay(req *http.Request, recorded Request) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, interaction := range t.cassette.Interactions {
+		if t.used[i] || !interaction.Request.matches(recorded) {
+			continue
+		}
+		t.used[i] = true
+
+		header := interaction.Response.Headers.Clone()
+		if header == nil {
+			header = make(http.Header)
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+			StatusCode:    interaction.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(strings.NewReader(interaction.Response.Body)),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, recorded.Method, recorded.URL)
+}
+
+// save writes the cassette. The caller holds mu, or has not shared t yet.
+func (t *Transport) save() error {
+	data, err := json.MarshalIndent(t.cassette, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+	if err := os.WriteFile(t.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// newRequest records req with its credentials redacted. The request body
+// is read.
+func newRequest(req *http.Request) (Request, error) {
+	recorded := Request{
+		Method:  req.Method,
+		URL:     redactURL(req.URL),
+		Headers: redactHeaders(req.Header),
+	}
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return Request{}, fmt.Errorf("failed to read request to record: %w", err)
+		}
+		recorded.Body = string(body)
+	}
+	return recorded, nil
+}
+
+// matches reports whether r and other are the same request. Headers are
+// not compared.
+func (r Request) matches(other Request) bool {
+	return r.Method == other.Method && r.URL == other.URL && r.Body == other.Body
+}
+
+// sensitive reports whether the value of a header or query parameter named
+// name is redacted
+func sensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range sensitiveNames {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactHeaders returns a copy of header with credentials redacted
+func redactHeaders(header http.Header) http.Header {
+	redacted := header.Clone()
+	for name := range redacted {
+		if sensitive(name) {
+			redacted[name] = []string{Redacted}
+		}
+	}
+	return redacted
+}
+
+// redactURL returns u with the values of credential query parameters
+// redacted
+func redactURL(u *url.URL) string {
+	query := u.Query()
+	changed := false
+	for name := range query {
+		if sensitive(name) {
+			query[name] = []string{Redacted}
+			changed = true
+		}
+	}
+	if !changed {
+		return u.String()
+	}
+	redacted := *u
+	redacted.RawQuery = query.Encode()
+	return redacted.String()
+}
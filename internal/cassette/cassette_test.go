@@ -0,0 +1,115 @@
+package cassette
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/localrivet/projectmemory/internal/summarizer/providers"
+)
+
+// TestRecordAndReplay checks that a recorded exchange replays without the
+// server, and that the API key never reaches the cassette
+func TestRecordAndReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte("echo: " + string(body)))
+	}))
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	recorder, err := New(path, ModeRecord, nil)
+	if err != nil {
+		t.Fatalf("New(record) failed: %v", err)
+	}
+	client := &http.Client{Transport: recorder}
+	post := func(client *http.Client) (string, error) {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/v1?key=secret-key", strings.NewReader("hello"))
+		req.Header.Set("Authorization", "Bearer secret-key")
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	if got, err := post(client); err != nil || got != "echo: hello" {
+		t.Fatalf("Expected \"echo: hello\" while recording, got %q, %v", got, err)
+	}
+	server.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read cassette: %v", err)
+	}
+	if strings.Contains(string(data), "secret-key") {
+		t.Errorf("Cassette contains the API key:\n%s", data)
+	}
+
+	replayer, err := New(path, ModeReplay, nil)
+	if err != nil {
+		t.Fatalf("New(replay) failed: %v", err)
+	}
+	client = &http.Client{Transport: replayer}
+	if got, err := post(client); err != nil || got != "echo: hello" {
+		t.Fatalf("Expected \"echo: hello\" on replay, got %q, %v", got, err)
+	}
+
+	// Each interaction replays once
+	if _, err := post(client); !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("Expected ErrNoInteraction on a second replay, got %v", err)
+	}
+}
+
+// TestReplayProvider replays a provider response from a cassette
+func TestReplayProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "anthropic.json")
+	recorder, err := New(path, ModeRecord, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"content": [{"text": "Recorded summary"}]}`)),
+		}, nil
+	}))
+	if err != nil {
+		t.Fatalf("New(record) failed: %v", err)
+	}
+
+	summarize := func(transport http.RoundTripper) (string, error) {
+		provider := providers.NewAnthropicProvider(providers.Config{APIKey: "test-key", Transport: transport})
+		return provider.Summarize(context.Background(), "Some project notes", 100)
+	}
+	if _, err := summarize(recorder); err != nil {
+		t.Fatalf("Summarize while recording failed: %v", err)
+	}
+
+	replayer, err := New(path, ModeReplay, nil)
+	if err != nil {
+		t.Fatalf("New(replay) failed: %v", err)
+	}
+	summary, err := summarize(replayer)
+	if err != nil || summary != "Recorded summary" {
+		t.Errorf("Expected the recorded summary, got %q, %v", summary, err)
+	}
+}
+
+func TestInvalidMode(t *testing.T) {
+	if _, err := New(filepath.Join(t.TempDir(), "cassette.json"), "rewind", nil); !errors.Is(err, ErrInvalidMode) {
+		t.Errorf("Expected ErrInvalidMode, got %v", err)
+	}
+}
+
+// roundTripFunc is an http.RoundTripper calling itself
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls f
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,139 @@
+// Package chaos provides fault-injection wrappers for LLM providers,
+// summarizers, embedders and context stores. The wrappers inject errors,
+// latency spikes and malformed responses at configurable rates so the
+// retry, fallback and error-reporting paths can be exercised on purpose,
+// both in tests and in a development server started with --chaos.
+package chaos
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Default fault rates used by --chaos
+	DefaultErrorRate     = 0.2
+	DefaultLatencyRate   = 0.1
+	DefaultLatency       = 2 * time.Second
+	DefaultMalformedRate = 0.05
+)
+
+// ErrInjected is returned by every fault the chaos wrappers inject.
+var ErrInjected = errors.New("chaos: injected fault")
+
+// Config controls how often each kind of fault is injected. Rates are
+// probabilities between 0 and 1 and are evaluated independently per call.
+type Config struct {
+	// ErrorRate is the probability that a call fails with ErrInjected.
+	ErrorRate float64
+
+	// LatencyRate is the probability that a call is delayed by Latency.
+	LatencyRate float64
+
+	// Latency is the delay added to slow calls.
+	Latency time.Duration
+
+	// MalformedRate is the probability that a call which would have
+	// succeeded returns a malformed result instead.
+	MalformedRate float64
+
+	// Seed makes the fault sequence reproducible. 0 seeds from the clock.
+	Seed int64
+}
+
+// DefaultConfig returns the fault rates used by --chaos.
+func DefaultConfig() Config {
+	return Config{
+		ErrorRate:     DefaultErrorRate,
+		LatencyRate:   DefaultLatencyRate,
+		Latency:       DefaultLatency,
+		MalformedRate: DefaultMalformedRate,
+	}
+}
+
+// LoadConfigFromEnvironment returns DefaultConfig overridden by the
+// CHAOS_ERROR_RATE, CHAOS_LATENCY_RATE, CHAOS_LATENCY, CHAOS_MALFORMED_RATE
+// and CHAOS_SEED environment variables. Unparseable values are ignored.
+func LoadConfigFromEnvironment() Config {
+	config := DefaultConfig()
+	config.ErrorRate = getEnvFloatWithDefault("CHAOS_ERROR_RATE", config.ErrorRate)
+	config.LatencyRate = getEnvFloatWithDefault("CHAOS_LATENCY_RATE", config.LatencyRate)
+	config.MalformedRate = getEnvFloatWithDefault("CHAOS_MALFORMED_RATE", config.MalformedRate)
+
+	if value, err := time.ParseDuration(os.Getenv("CHAOS_LATENCY")); err == nil {
+		config.Latency = value
+	}
+	if value, err := strconv.ParseInt(os.Getenv("CHAOS_SEED"), 10, 64); err == nil {
+		config.Seed = value
+	}
+
+	return config
+}
+
+// getEnvFloatWithDefault retrieves an environment variable as float or returns the default value
+func getEnvFloatWithDefault(key string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// injector decides which faults to inject. It is shared by all wrappers
+// created from the same Config call so the fault sequence is reproducible.
+type injector struct {
+	config Config
+	rng    *rand.Rand
+	mu     sync.Mutex
+}
+
+// newInjector creates an injector for config
+func newInjector(config Config) *injector {
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &injector{
+		config: config,
+		rng:    rand.New(rand.NewSource(seed)),
+	}
+}
+
+// roll reports whether an event with the given probability happens
+func (i *injector) roll(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.rng.Float64() < rate
+}
+
+// before runs ahead of every wrapped call. It may sleep to simulate a latency
+// spike, returning early if ctx is done, and may return ErrInjected.
+func (i *injector) before(ctx context.Context) error {
+	if i.roll(i.config.LatencyRate) {
+		timer := time.NewTimer(i.config.Latency)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	if i.roll(i.config.ErrorRate) {
+		return ErrInjected
+	}
+	return nil
+}
+
+// malformed reports whether a successful call should return a malformed result
+func (i *injector) malformed() bool {
+	return i.roll(i.config.MalformedRate)
+}
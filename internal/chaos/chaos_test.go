@@ -0,0 +1,105 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/summarizer/providers"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+func TestZeroRatesPassThrough(t *testing.T) {
+	embedder := WrapEmbedder(vector.NewMockEmbedder(8), Config{Seed: 1})
+	for i := 0; i < 100; i++ {
+		embedding, err := embedder.CreateEmbedding("text")
+		if err != nil {
+			t.Fatalf("CreateEmbedding() error = %v", err)
+		}
+		if len(embedding) != 8 {
+			t.Fatalf("Expected 8 dimensions, got %d", len(embedding))
+		}
+	}
+}
+
+func TestErrorRateOneAlwaysFails(t *testing.T) {
+	store := WrapStore(contextstore.NewMemoryContextStore(), Config{ErrorRate: 1, Seed: 1})
+
+	if err := store.Store("id", "summary", nil, time.Now()); !errors.Is(err, ErrInjected) {
+		t.Errorf("Expected ErrInjected from Store, got %v", err)
+	}
+	if _, err := store.Search([]float32{1}, 5); !errors.Is(err, ErrInjected) {
+		t.Errorf("Expected ErrInjected from Search, got %v", err)
+	}
+	if _, err := store.Clear(); !errors.Is(err, ErrInjected) {
+		t.Errorf("Expected ErrInjected from Clear, got %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Errorf("Expected Close to pass through, got %v", err)
+	}
+}
+
+func TestErrorRateIsApproximate(t *testing.T) {
+	provider := WrapProvider(providers.NewTestProvider("test", "summary", nil), Config{ErrorRate: 0.3, Seed: 42})
+
+	failures := 0
+	for i := 0; i < 1000; i++ {
+		if _, err := provider.Summarize(context.Background(), "text", 100); err != nil {
+			failures++
+		}
+	}
+	if failures < 250 || failures > 350 {
+		t.Errorf("Expected about 300 failures at rate 0.3, got %d", failures)
+	}
+}
+
+func TestMalformedResponses(t *testing.T) {
+	provider := WrapProvider(providers.NewTestProvider("test", "summary", nil), Config{MalformedRate: 1, Seed: 1})
+	if summary, err := provider.Summarize(context.Background(), "text", 100); err != nil || summary != "" {
+		t.Errorf("Expected empty malformed summary, got %q, %v", summary, err)
+	}
+
+	embedder := WrapEmbedder(vector.NewMockEmbedder(8), Config{MalformedRate: 1, Seed: 1})
+	embedding, err := embedder.CreateEmbedding("text")
+	if err != nil {
+		t.Fatalf("CreateEmbedding() error = %v", err)
+	}
+	if err := vector.ValidateEmbedding(embedding); !errors.Is(err, vector.ErrInvalidEmbedding) {
+		t.Errorf("Expected malformed embedding to fail validation, got %v", err)
+	}
+}
+
+func TestLatencyRespectsContext(t *testing.T) {
+	provider := WrapProvider(providers.NewTestProvider("test", "summary", nil), Config{LatencyRate: 1, Latency: time.Hour, Seed: 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := provider.Summarize(ctx, "text", 100)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Latency spike ignored context cancellation, took %v", elapsed)
+	}
+}
+
+func TestLoadConfigFromEnvironment(t *testing.T) {
+	t.Setenv("CHAOS_ERROR_RATE", "0.5")
+	t.Setenv("CHAOS_LATENCY", "250ms")
+	t.Setenv("CHAOS_MALFORMED_RATE", "not-a-number")
+
+	config := LoadConfigFromEnvironment()
+	if config.ErrorRate != 0.5 {
+		t.Errorf("Expected error rate 0.5, got %v", config.ErrorRate)
+	}
+	if config.Latency != 250*time.Millisecond {
+		t.Errorf("Expected latency 250ms, got %v", config.Latency)
+	}
+	if config.MalformedRate != DefaultMalformedRate {
+		t.Errorf("Expected default malformed rate for invalid value, got %v", config.MalformedRate)
+	}
+}
@@ -0,0 +1,832 @@
+package chaos
+
+import (
+	"context"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/summarizer/providers"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+// Provider wraps a providers.LLMProvider with fault injection.
+// Malformed responses are empty summaries.
+type Provider struct {
+	provider providers.LLMProvider
+	faults   *injector
+}
+
+// WrapProvider returns provider with faults injected according to config.
+func WrapProvider(provider providers.LLMProvider, config Config) *Provider {
+	return &Provider{provider: provider, faults: newInjector(config)}
+}
+
+// Name returns the wrapped provider's name so metrics stay attributed to it.
+func (p *Provider) Name() string {
+	return p.provider.Name()
+}
+
+// Summarize calls the wrapped provider unless a fault is injected.
+func (p *Provider) Summarize(ctx context.Context, text string, maxLength int) (string, error) {
+	if err := p.faults.before(ctx); err != nil {
+		return "", err
+	}
+
+	summary, err := p.provider.Summarize(ctx, text, maxLength)
+	if err == nil && p.faults.malformed() {
+		return "", nil
+	}
+	return summary, err
+}
+
+// idleReleaser mirrors the IdleReleaser interfaces of the summarizer, vector
+// and contextstore packages.
+type idleReleaser interface {
+	ReleaseIdle() error
+}
+
+// releaseIdle releases the idle resources of wrapped, if it has any.
+// Faults are never injected here.
+func releaseIdle(wrapped interface{}) error {
+	if releaser, ok := wrapped.(idleReleaser); ok {
+		return releaser.ReleaseIdle()
+	}
+	return nil
+}
+
+// cacheShrinker mirrors the CacheShrinker interfaces of the summarizer and
+// vector packages.
+type cacheShrinker interface {
+	ShrinkCache()
+}
+
+// shrinkCache shrinks the cache of wrapped, if it has one. Faults are never
+// injected here.
+func shrinkCache(wrapped interface{}) {
+	if shrinker, ok := wrapped.(cacheShrinker); ok {
+		shrinker.ShrinkCache()
+	}
+}
+
+// CloseIdleConnections closes the wrapped provider's idle connections, if
+// it keeps any. Faults are never injected here.
+func (p *Provider) CloseIdleConnections() {
+	if closer, ok := p.provider.(providers.IdleConnectionCloser); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// summarizer mirrors summarizer.Summarizer. It is declared here so the
+// summarizer package's own tests can use this package without an import cycle.
+type summarizer interface {
+	Summarize(ctx context.Context, text string) (string, error)
+	Initialize() error
+}
+
+// Summarizer wraps a summarizer.Summarizer with fault injection.
+// Malformed responses are empty summaries.
+type Summarizer struct {
+	summarizer summarizer
+	faults     *injector
+}
+
+// WrapSummarizer returns s with faults injected according to config.
+func WrapSummarizer(s summarizer, config Config) *Summarizer {
+	return &Summarizer{summarizer: s, faults: newInjector(config)}
+}
+
+// Initialize initializes the wrapped summarizer. Faults are never injected here.
+func (s *Summarizer) Initialize() error {
+	return s.summarizer.Initialize()
+}
+
+// ReleaseIdle releases the wrapped summarizer's idle resources, if it has
+// any. Faults are never injected here.
+func (s *Summarizer) ReleaseIdle() error {
+	return releaseIdle(s.summarizer)
+}
+
+// ShrinkCache shrinks the wrapped summarizer's cache, if it has one.
+func (s *Summarizer) ShrinkCache() {
+	shrinkCache(s.summarizer)
+}
+
+// Summarize calls the wrapped summarizer unless a fault is injected.
+func (s *Summarizer) Summarize(ctx context.Context, text string) (string, error) {
+	if err := s.faults.before(ctx); err != nil {
+		return "", err
+	}
+
+	summary, err := s.summarizer.Summarize(ctx, text)
+	if err == nil && s.faults.malformed() {
+		return "", nil
+	}
+	return summary, err
+}
+
+// lengthSummarizer mirrors summarizer.LengthSummarizer
+type lengthSummarizer interface {
+	SummarizeWithLength(ctx context.Context, text string, maxLength int) (string, error)
+}
+
+// SummarizeWithLength calls the wrapped summarizer with a summary length
+// unless a fault is injected. A wrapped summarizer that cannot take a length
+// writes a summary of its configured length.
+func (s *Summarizer) SummarizeWithLength(ctx context.Context, text string, maxLength int) (string, error) {
+	lengths, ok := s.summarizer.(lengthSummarizer)
+	if !ok {
+		return s.Summarize(ctx, text)
+	}
+
+	if err := s.faults.before(ctx); err != nil {
+		return "", err
+	}
+
+	summary, err := lengths.SummarizeWithLength(ctx, text, maxLength)
+	if err == nil && s.faults.malformed() {
+		return "", nil
+	}
+	return summary, err
+}
+
+// Embedder wraps a vector.Embedder with fault injection. Malformed responses
+// are empty vectors, which callers must reject rather than store.
+type Embedder struct {
+	embedder vector.Embedder
+	faults   *injector
+}
+
+// WrapEmbedder returns embedder with faults injected according to config.
+func WrapEmbedder(embedder vector.Embedder, config Config) *Embedder {
+	return &Embedder{embedder: embedder, faults: newInjector(config)}
+}
+
+// Initialize initializes the wrapped embedder. Faults are never injected here.
+func (e *Embedder) Initialize() error {
+	return e.embedder.Initialize()
+}
+
+// ReleaseIdle releases the wrapped embedder's idle resources, if it has
+// any. Faults are never injected here.
+func (e *Embedder) ReleaseIdle() error {
+	return releaseIdle(e.embedder)
+}
+
+// ShrinkCache shrinks the wrapped embedder's cache, if it has one.
+func (e *Embedder) ShrinkCache() {
+	shrinkCache(e.embedder)
+}
+
+// CreateEmbedding calls the wrapped embedder unless a fault is injected.
+func (e *Embedder) CreateEmbedding(text string) ([]float32, error) {
+	if err := e.faults.before(context.Background()); err != nil {
+		return nil, err
+	}
+
+	embedding, err := e.embedder.CreateEmbedding(text)
+	if err == nil && e.faults.malformed() {
+		return []float32{}, nil
+	}
+	return embedding, err
+}
+
+// CreateSourcedEmbedding is CreateEmbedding with the provider that made the
+// embedding, as reported by vector.CreateSourcedEmbedding.
+func (e *Embedder) CreateSourcedEmbedding(text string) (vector.SourcedEmbedding, error) {
+	if err := e.faults.before(context.Background()); err != nil {
+		return vector.SourcedEmbedding{}, err
+	}
+
+	embedding, err := vector.CreateSourcedEmbedding(e.embedder, text)
+	if err == nil && e.faults.malformed() {
+		embedding.Vector = []float32{}
+	}
+	return embedding, err
+}
+
+// CreateSourcedEmbeddingContext is CreateSourcedEmbedding, returning
+// ctx.Err() once ctx is done, even during injected latency.
+func (e *Embedder) CreateSourcedEmbeddingContext(ctx context.Context, text string) (vector.SourcedEmbedding, error) {
+	if err := e.faults.before(ctx); err != nil {
+		return vector.SourcedEmbedding{}, err
+	}
+
+	embedding, err := vector.CreateEmbeddingContext(ctx, e.embedder, text)
+	if err == nil && e.faults.malformed() {
+		embedding.Vector = []float32{}
+	}
+	return embedding, err
+}
+
+// Store wraps a contextstore.ContextStore with error and latency injection.
+// Stores never return malformed data, so a --chaos session cannot corrupt
+// the database. Initialize and Close are passed through untouched.
+type Store struct {
+	store  contextstore.ContextStore
+	faults *injector
+}
+
+// WrapStore returns store with faults injected according to config.
+func WrapStore(store contextstore.ContextStore, config Config) *Store {
+	return &Store{store: store, faults: newInjector(config)}
+}
+
+// Initialize initializes the wrapped store.
+func (s *Store) Initialize(dbPath string) error {
+	return s.store.Initialize(dbPath)
+}
+
+// Close closes the wrapped store.
+func (s *Store) Close() error {
+	return s.store.Close()
+}
+
+// Store stores an entry unless a fault is injected.
+func (s *Store) Store(id string, summaryText string, embedding []byte, timestamp time.Time) error {
+	if err := s.faults.before(context.Background()); err != nil {
+		return err
+	}
+	return s.store.Store(id, summaryText, embedding, timestamp)
+}
+
+// StoreInNamespace stores an entry in a namespace unless a fault is
+// injected. It returns contextstore.ErrNamespacesUnsupported if the wrapped
+// store does not implement contextstore.NamespacedStore.
+func (s *Store) StoreInNamespace(namespace string, id string, summaryText string, embedding []byte, timestamp time.Time) error {
+	namespaced, ok := s.store.(contextstore.NamespacedStore)
+	if !ok {
+		return contextstore.ErrNamespacesUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return err
+	}
+	return namespaced.StoreInNamespace(namespace, id, summaryText, embedding, timestamp)
+}
+
+// Search searches the wrapped store unless a fault is injected.
+func (s *Store) Search(queryEmbedding []float32, limit int) ([]string, error) {
+	if err := s.faults.before(context.Background()); err != nil {
+		return nil, err
+	}
+	return s.store.Search(queryEmbedding, limit)
+}
+
+// SearchWithScores searches the wrapped store unless a fault is injected.
+// It returns contextstore.ErrScoresUnsupported if the wrapped store does not
+// implement contextstore.ScoredSearcher.
+func (s *Store) SearchWithScores(queryEmbedding []float32, limit int, filter contextstore.SearchFilter) ([]contextstore.SearchResult, error) {
+	scored, ok := s.store.(contextstore.ScoredSearcher)
+	if !ok {
+		return nil, contextstore.ErrScoresUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return nil, err
+	}
+	return scored.SearchWithScores(queryEmbedding, limit, filter)
+}
+
+// SetTags tags an entry unless a fault is injected. It returns
+// contextstore.ErrTagsUnsupported if the wrapped store does not implement
+// contextstore.TaggedStore.
+func (s *Store) SetTags(id string, tags []string) error {
+	tagged, ok := s.store.(contextstore.TaggedStore)
+	if !ok {
+		return contextstore.ErrTagsUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return err
+	}
+	return tagged.SetTags(id, tags)
+}
+
+// GetTags returns an entry's tags unless a fault is injected. It returns
+// contextstore.ErrTagsUnsupported if the wrapped store does not implement
+// contextstore.TaggedStore.
+func (s *Store) GetTags(id string) ([]string, error) {
+	tagged, ok := s.store.(contextstore.TaggedStore)
+	if !ok {
+		return nil, contextstore.ErrTagsUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return nil, err
+	}
+	return tagged.GetTags(id)
+}
+
+// RecordRetrievals records retrievals unless a fault is injected. It returns
+// contextstore.ErrUsageUnsupported if the wrapped store does not implement
+// contextstore.UsageStore.
+func (s *Store) RecordRetrievals(ids []string, at time.Time) error {
+	usage, ok := s.store.(contextstore.UsageStore)
+	if !ok {
+		return contextstore.ErrUsageUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return err
+	}
+	return usage.RecordRetrievals(ids, at)
+}
+
+// ListEntries lists the wrapped store's entries unless a fault is injected.
+// It returns contextstore.ErrUsageUnsupported if the wrapped store does not
+// implement contextstore.UsageStore.
+func (s *Store) ListEntries() ([]contextstore.Entry, error) {
+	usage, ok := s.store.(contextstore.UsageStore)
+	if !ok {
+		return nil, contextstore.ErrUsageUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return nil, err
+	}
+	return usage.ListEntries()
+}
+
+// MarkCleared clears the wrapped store recoverably unless a fault is
+// injected. It returns contextstore.ErrSoftClearUnsupported if the wrapped
+// store does not implement contextstore.SoftClearer.
+func (s *Store) MarkCleared(at time.Time) (int, error) {
+	clearer, ok := s.store.(contextstore.SoftClearer)
+	if !ok {
+		return 0, contextstore.ErrSoftClearUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return 0, err
+	}
+	return clearer.MarkCleared(at)
+}
+
+// UndoClear restores cleared entries unless a fault is injected. It returns
+// contextstore.ErrSoftClearUnsupported if the wrapped store does not
+// implement contextstore.SoftClearer.
+func (s *Store) UndoClear() (int, error) {
+	clearer, ok := s.store.(contextstore.SoftClearer)
+	if !ok {
+		return 0, contextstore.ErrSoftClearUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return 0, err
+	}
+	return clearer.UndoClear()
+}
+
+// PurgeCleared purges cleared entries unless a fault is injected. It returns
+// contextstore.ErrSoftClearUnsupported if the wrapped store does not
+// implement contextstore.SoftClearer.
+func (s *Store) PurgeCleared(before time.Time) (int, error) {
+	clearer, ok := s.store.(contextstore.SoftClearer)
+	if !ok {
+		return 0, contextstore.ErrSoftClearUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return 0, err
+	}
+	return clearer.PurgeCleared(before)
+}
+
+// Quarantine stores a quarantined entry unless a fault is injected. It
+// returns contextstore.ErrQuarantineUnsupported if the wrapped store does
+// not implement contextstore.QuarantineStore.
+func (s *Store) Quarantine(id string, summaryText string, embedding []byte, timestamp time.Time, tags []string, provider string) error {
+	quarantine, ok := s.store.(contextstore.QuarantineStore)
+	if !ok {
+		return contextstore.ErrQuarantineUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return err
+	}
+	return quarantine.Quarantine(id, summaryText, embedding, timestamp, tags, provider)
+}
+
+// ListQuarantined lists quarantined entries unless a fault is injected. It
+// returns contextstore.ErrQuarantineUnsupported if the wrapped store does
+// not implement contextstore.QuarantineStore.
+func (s *Store) ListQuarantined() ([]contextstore.QuarantinedEntry, error) {
+	quarantine, ok := s.store.(contextstore.QuarantineStore)
+	if !ok {
+		return nil, contextstore.ErrQuarantineUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return nil, err
+	}
+	return quarantine.ListQuarantined()
+}
+
+// ReleaseQuarantined releases a quarantined entry unless a fault is
+// injected. It returns contextstore.ErrQuarantineUnsupported if the wrapped
+// store does not implement contextstore.QuarantineStore.
+func (s *Store) ReleaseQuarantined(id string, embedding []byte) error {
+	quarantine, ok := s.store.(contextstore.QuarantineStore)
+	if !ok {
+		return contextstore.ErrQuarantineUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return err
+	}
+	return quarantine.ReleaseQuarantined(id, embedding)
+}
+
+// SetProvenance replaces the provenance chain of an entry unless a fault is
+// injected. It returns contextstore.ErrProvenanceUnsupported if the wrapped
+// store does not implement contextstore.ProvenanceStore.
+func (s *Store) SetProvenance(id string, chain []string) error {
+	provenance, ok := s.store.(contextstore.ProvenanceStore)
+	if !ok {
+		return contextstore.ErrProvenanceUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return err
+	}
+	return provenance.SetProvenance(id, chain)
+}
+
+// GetProvenance returns the provenance chain of an entry unless a fault is
+// injected. It returns contextstore.ErrProvenanceUnsupported if the wrapped
+// store does not implement contextstore.ProvenanceStore.
+func (s *Store) GetProvenance(id string) ([]string, error) {
+	provenance, ok := s.store.(contextstore.ProvenanceStore)
+	if !ok {
+		return nil, contextstore.ErrProvenanceUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return nil, err
+	}
+	return provenance.GetProvenance(id)
+}
+
+// SetGeneration records the generation of an entry's summary unless a fault
+// is injected. It returns contextstore.ErrGenerationUnsupported if the
+// wrapped store does not implement contextstore.GenerationStore.
+func (s *Store) SetGeneration(id string, generation contextstore.Generation) error {
+	generations, ok := s.store.(contextstore.GenerationStore)
+	if !ok {
+		return contextstore.ErrGenerationUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return err
+	}
+	return generations.SetGeneration(id, generation)
+}
+
+// GetGeneration returns the generation of an entry's summary unless a fault
+// is injected. It returns contextstore.ErrGenerationUnsupported if the
+// wrapped store does not implement contextstore.GenerationStore.
+func (s *Store) GetGeneration(id string) (contextstore.Generation, error) {
+	generations, ok := s.store.(contextstore.GenerationStore)
+	if !ok {
+		return contextstore.Generation{}, contextstore.ErrGenerationUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return contextstore.Generation{}, err
+	}
+	return generations.GetGeneration(id)
+}
+
+// SetTitle records the title of an entry's summary unless a fault is
+// injected. It returns contextstore.ErrTitlesUnsupported if the wrapped store
+// does not implement contextstore.TitleStore.
+func (s *Store) SetTitle(id string, title string) error {
+	titles, ok := s.store.(contextstore.TitleStore)
+	if !ok {
+		return contextstore.ErrTitlesUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return err
+	}
+	return titles.SetTitle(id, title)
+}
+
+// GetTitle returns the title of an entry's summary unless a fault is
+// injected. It returns contextstore.ErrTitlesUnsupported if the wrapped store
+// does not implement contextstore.TitleStore.
+func (s *Store) GetTitle(id string) (string, error) {
+	titles, ok := s.store.(contextstore.TitleStore)
+	if !ok {
+		return "", contextstore.ErrTitlesUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return "", err
+	}
+	return titles.GetTitle(id)
+}
+
+// SetPinned pins or unpins an entry unless a fault is injected. It returns
+// contextstore.ErrPinsUnsupported if the wrapped store does not implement
+// contextstore.PinStore.
+func (s *Store) SetPinned(id string, pinned bool) error {
+	pins, ok := s.store.(contextstore.PinStore)
+	if !ok {
+		return contextstore.ErrPinsUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return err
+	}
+	return pins.SetPinned(id, pinned)
+}
+
+// ListPinned returns the IDs of the pinned entries of a namespace unless a
+// fault is injected. It returns contextstore.ErrPinsUnsupported if the
+// wrapped store does not implement contextstore.PinStore.
+func (s *Store) ListPinned(namespace string) ([]string, error) {
+	pins, ok := s.store.(contextstore.PinStore)
+	if !ok {
+		return nil, contextstore.ErrPinsUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return nil, err
+	}
+	return pins.ListPinned(namespace)
+}
+
+// SetReferences replaces the references of an entry unless a fault is
+// injected. It returns contextstore.ErrReferencesUnsupported if the wrapped
+// store does not implement contextstore.ReferenceStore.
+func (s *Store) SetReferences(id string, references []contextstore.Reference) error {
+	store, ok := s.store.(contextstore.ReferenceStore)
+	if !ok {
+		return contextstore.ErrReferencesUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return err
+	}
+	return store.SetReferences(id, references)
+}
+
+// GetReferences returns the references of an entry unless a fault is
+// injected. It returns contextstore.ErrReferencesUnsupported if the wrapped
+// store does not implement contextstore.ReferenceStore.
+func (s *Store) GetReferences(id string) ([]contextstore.Reference, error) {
+	store, ok := s.store.(contextstore.ReferenceStore)
+	if !ok {
+		return nil, contextstore.ErrReferencesUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return nil, err
+	}
+	return store.GetReferences(id)
+}
+
+// ListReferencing returns the entries referencing a file unless a fault is
+// injected. It returns contextstore.ErrReferencesUnsupported if the wrapped
+// store does not implement contextstore.ReferenceStore.
+func (s *Store) ListReferencing(path string) ([]contextstore.LinkedEntry, error) {
+	store, ok := s.store.(contextstore.ReferenceStore)
+	if !ok {
+		return nil, contextstore.ErrReferencesUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return nil, err
+	}
+	return store.ListReferencing(path)
+}
+
+// SnapshotHashes returns the snapshot hash of each namespace unless a fault
+// is injected. It returns contextstore.ErrSnapshotUnsupported if the wrapped
+// store does not implement contextstore.SnapshotHasher.
+func (s *Store) SnapshotHashes() (map[string]string, error) {
+	hasher, ok := s.store.(contextstore.SnapshotHasher)
+	if !ok {
+		return nil, contextstore.ErrSnapshotUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return nil, err
+	}
+	return hasher.SnapshotHashes()
+}
+
+// SetBatch records the batch of an entry unless a fault is injected. It
+// returns contextstore.ErrBatchesUnsupported if the wrapped store does not
+// implement contextstore.BatchStore.
+func (s *Store) SetBatch(id string, batch string) error {
+	batches, ok := s.store.(contextstore.BatchStore)
+	if !ok {
+		return contextstore.ErrBatchesUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return err
+	}
+	return batches.SetBatch(id, batch)
+}
+
+// ListBatches lists the batches holding entries unless a fault is injected.
+// It returns contextstore.ErrBatchesUnsupported if the wrapped store does
+// not implement contextstore.BatchStore.
+func (s *Store) ListBatches() ([]contextstore.Batch, error) {
+	batches, ok := s.store.(contextstore.BatchStore)
+	if !ok {
+		return nil, contextstore.ErrBatchesUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return nil, err
+	}
+	return batches.ListBatches()
+}
+
+// DeleteBatch deletes the entries of a batch unless a fault is injected. It
+// returns contextstore.ErrBatchesUnsupported if the wrapped store does not
+// implement contextstore.BatchStore.
+func (s *Store) DeleteBatch(batch string) (int, error) {
+	batches, ok := s.store.(contextstore.BatchStore)
+	if !ok {
+		return 0, contextstore.ErrBatchesUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return 0, err
+	}
+	return batches.DeleteBatch(batch)
+}
+
+// SetSession records the session of an entry unless a fault is injected.
+// It returns contextstore.ErrSessionsUnsupported if the wrapped store does
+// not implement contextstore.SessionStore.
+func (s *Store) SetSession(id string, session string) error {
+	sessions, ok := s.store.(contextstore.SessionStore)
+	if !ok {
+		return contextstore.ErrSessionsUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return err
+	}
+	return sessions.SetSession(id, session)
+}
+
+// ListSessions lists the sessions holding entries unless a fault is
+// injected. It returns contextstore.ErrSessionsUnsupported if the wrapped
+// store does not implement contextstore.SessionStore.
+func (s *Store) ListSessions() ([]contextstore.Session, error) {
+	sessions, ok := s.store.(contextstore.SessionStore)
+	if !ok {
+		return nil, contextstore.ErrSessionsUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return nil, err
+	}
+	return sessions.ListSessions()
+}
+
+// DeleteSession deletes the entries of a session unless a fault is
+// injected. It returns contextstore.ErrSessionsUnsupported if the wrapped
+// store does not implement contextstore.SessionStore.
+func (s *Store) DeleteSession(session string) (int, error) {
+	sessions, ok := s.store.(contextstore.SessionStore)
+	if !ok {
+		return 0, contextstore.ErrSessionsUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return 0, err
+	}
+	return sessions.DeleteSession(session)
+}
+
+// Link records a relation between entries unless a fault is injected. It
+// returns contextstore.ErrRelationsUnsupported if the wrapped store does
+// not implement contextstore.RelationStore.
+func (s *Store) Link(relation contextstore.Relation) error {
+	relations, ok := s.store.(contextstore.RelationStore)
+	if !ok {
+		return contextstore.ErrRelationsUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return err
+	}
+	return relations.Link(relation)
+}
+
+// Unlink removes a relation between entries unless a fault is injected.
+// It returns contextstore.ErrRelationsUnsupported if the wrapped store
+// does not implement contextstore.RelationStore.
+func (s *Store) Unlink(id string, relatedID string, relationType string) (bool, error) {
+	relations, ok := s.store.(contextstore.RelationStore)
+	if !ok {
+		return false, contextstore.ErrRelationsUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return false, err
+	}
+	return relations.Unlink(id, relatedID, relationType)
+}
+
+// ListRelations lists the relations of an entry unless a fault is
+// injected. It returns contextstore.ErrRelationsUnsupported if the wrapped
+// store does not implement contextstore.RelationStore.
+func (s *Store) ListRelations(id string) ([]contextstore.RelatedEntry, error) {
+	relations, ok := s.store.(contextstore.RelationStore)
+	if !ok {
+		return nil, contextstore.ErrRelationsUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return nil, err
+	}
+	return relations.ListRelations(id)
+}
+
+// RecordGap records a retrieval gap unless a fault is injected. It returns
+// contextstore.ErrGapsUnsupported if the wrapped store does not implement
+// contextstore.GapStore.
+func (s *Store) RecordGap(namespace string, query string, at time.Time) error {
+	gaps, ok := s.store.(contextstore.GapStore)
+	if !ok {
+		return contextstore.ErrGapsUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return err
+	}
+	return gaps.RecordGap(namespace, query, at)
+}
+
+// ListGaps lists the retrieval gaps unless a fault is injected. It returns
+// contextstore.ErrGapsUnsupported if the wrapped store does not implement
+// contextstore.GapStore.
+func (s *Store) ListGaps(namespace string) ([]contextstore.Gap, error) {
+	gaps, ok := s.store.(contextstore.GapStore)
+	if !ok {
+		return nil, contextstore.ErrGapsUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return nil, err
+	}
+	return gaps.ListGaps(namespace)
+}
+
+// DeleteGaps deletes retrieval gaps unless a fault is injected. It returns
+// contextstore.ErrGapsUnsupported if the wrapped store does not implement
+// contextstore.GapStore.
+func (s *Store) DeleteGaps(namespace string, queries []string) (int, error) {
+	gaps, ok := s.store.(contextstore.GapStore)
+	if !ok {
+		return 0, contextstore.ErrGapsUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return 0, err
+	}
+	return gaps.DeleteGaps(namespace, queries)
+}
+
+// RecordReview records a review of a stale entry unless a fault is
+// injected. It returns contextstore.ErrReviewsUnsupported if the wrapped
+// store does not implement contextstore.ReviewStore.
+func (s *Store) RecordReview(review contextstore.Review) error {
+	reviews, ok := s.store.(contextstore.ReviewStore)
+	if !ok {
+		return contextstore.ErrReviewsUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return err
+	}
+	return reviews.RecordReview(review)
+}
+
+// ListReviews lists the reviews of an entry unless a fault is injected. It
+// returns contextstore.ErrReviewsUnsupported if the wrapped store does not
+// implement contextstore.ReviewStore.
+func (s *Store) ListReviews(id string) ([]contextstore.Review, error) {
+	reviews, ok := s.store.(contextstore.ReviewStore)
+	if !ok {
+		return nil, contextstore.ErrReviewsUnsupported
+	}
+	if err := s.faults.before(context.Background()); err != nil {
+		return nil, err
+	}
+	return reviews.ListReviews(id)
+}
+
+// ReleaseIdle releases the wrapped store's idle resources, if it has any.
+// Faults are never injected here.
+func (s *Store) ReleaseIdle() error {
+	return releaseIdle(s.store)
+}
+
+// Ping checks the wrapped store unless a fault is injected. Stores that do
+// not implement contextstore.Pinger are always reachable.
+func (s *Store) Ping() error {
+	if err := s.faults.before(context.Background()); err != nil {
+		return err
+	}
+	if pinger, ok := s.store.(contextstore.Pinger); ok {
+		return pinger.Ping()
+	}
+	return nil
+}
+
+// Delete deletes an entry unless a fault is injected.
+func (s *Store) Delete(id string) error {
+	if err := s.faults.before(context.Background()); err != nil {
+		return err
+	}
+	return s.store.Delete(id)
+}
+
+// Clear clears the wrapped store unless a fault is injected.
+func (s *Store) Clear() (int, error) {
+	if err := s.faults.before(context.Background()); err != nil {
+		return 0, err
+	}
+	return s.store.Clear()
+}
+
+// Replace replaces an entry unless a fault is injected.
+func (s *Store) Replace(id string, summaryText string, embedding []byte, timestamp time.Time) error {
+	if err := s.faults.before(context.Background()); err != nil {
+		return err
+	}
+	return s.store.Replace(id, summaryText, embedding, timestamp)
+}
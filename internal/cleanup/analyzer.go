@@ -0,0 +1,207 @@
+// Package cleanup scores stored context entries as likely junk so they can be
+// reviewed, or deleted under a policy, before they crowd out useful memories.
+// It also flags old entries that are still relied on, so a person can
+// confirm they still hold.
+package cleanup
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+// Reasons an entry is reported as a cleanup candidate
+const (
+	ReasonLowInformation = "low_information"
+	ReasonNeverRetrieved = "never_retrieved"
+	ReasonNearDuplicate  = "near_duplicate"
+)
+
+// Weights of each signal in the garbage score. They sum to 1, so scores are
+// in [0, 1]. A near-duplicate alone, or a never-retrieved entry with little
+// information in it, reaches DefaultMinScore. Neither of the other signals
+// does on its own.
+const (
+	WeightLowInformation = 0.3
+	WeightNeverRetrieved = 0.2
+	WeightNearDuplicate  = 0.5
+)
+
+// Defaults for zero Options fields
+const (
+	// DefaultMinAge is how old a never-retrieved entry must be before that
+	// counts against it.
+	DefaultMinAge = 7 * 24 * time.Hour
+
+	// DefaultDuplicateThreshold is the cosine similarity from which two
+	// entries are near-duplicates.
+	DefaultDuplicateThreshold = 0.95
+
+	// DefaultMinScore is the garbage score from which an entry is reported.
+	DefaultMinScore = 0.4
+)
+
+const (
+	// informativeWords is the number of distinct words from which an entry
+	// is not considered short.
+	informativeWords = 8
+
+	// repetitiveRatio is the share of distinct words below which an entry
+	// is considered repetitive.
+	repetitiveRatio = 0.5
+)
+
+// Options tune the analyzer. Zero fields take the defaults above.
+type Options struct {
+	// Now is the time entry ages are measured against. Zero means time.Now().
+	Now time.Time
+
+	// MinAge is how old a never-retrieved entry must be before that counts
+	// against it.
+	MinAge time.Duration
+
+	// DuplicateThreshold is the cosine similarity from which the older of
+	// two entries is a near-duplicate of the newer one.
+	DuplicateThreshold float64
+
+	// MinScore is the garbage score from which an entry is reported.
+	MinScore float64
+}
+
+// Candidate is an entry reported for deletion
+type Candidate struct {
+	ID          string
+	SummaryText string
+	Title       string
+
+	// Score is the garbage score in [0, 1]. Higher is more likely junk.
+	Score float64
+
+	// Reasons lists the signals that contributed most to Score.
+	Reasons []string
+
+	// DuplicateOf is the ID of the newer entry this one nearly duplicates.
+	DuplicateOf string
+
+	// Retrievals is how often the entry was retrieved.
+	Retrievals int
+}
+
+// withDefaults fills in zero fields
+func (o Options) withDefaults() Options {
+	if o.Now.IsZero() {
+		o.Now = time.Now()
+	}
+	if o.MinAge == 0 {
+		o.MinAge = DefaultMinAge
+	}
+	if o.DuplicateThreshold == 0 {
+		o.DuplicateThreshold = DefaultDuplicateThreshold
+	}
+	if o.MinScore == 0 {
+		o.MinScore = DefaultMinScore
+	}
+	return o
+}
+
+// Analyze scores entries and returns those scoring at least
+// options.MinScore, most likely junk first.
+func Analyze(entries []contextstore.Entry, options Options) []Candidate {
+	options = options.withDefaults()
+	duplicates := nearDuplicates(entries, options.DuplicateThreshold)
+
+	var candidates []Candidate
+	for _, entry := range entries {
+		var score float64
+		var reasons []string
+
+		if lowInformation := LowInformation(entry.SummaryText); lowInformation > 0 {
+			score += WeightLowInformation * lowInformation
+			if lowInformation >= 0.5 {
+				reasons = append(reasons, ReasonLowInformation)
+			}
+		}
+		if entry.Retrievals == 0 && options.Now.Sub(entry.Timestamp) >= options.MinAge {
+			score += WeightNeverRetrieved
+			reasons = append(reasons, ReasonNeverRetrieved)
+		}
+		duplicateOf, isDuplicate := duplicates[entry.ID]
+		if isDuplicate {
+			score += WeightNearDuplicate
+			reasons = append(reasons, ReasonNearDuplicate)
+		}
+
+		if score < options.MinScore {
+			continue
+		}
+		candidates = append(candidates, Candidate{
+			ID:          entry.ID,
+			SummaryText: entry.SummaryText,
+			Title:       entry.Title,
+			Score:       score,
+			Reasons:     reasons,
+			DuplicateOf: duplicateOf,
+			Retrievals:  entry.Retrievals,
+		})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		return candidates[i].ID < candidates[j].ID
+	})
+	return candidates
+}
+
+// LowInformation scores how little information text carries, in [0, 1].
+// Short texts with few distinct words, and texts that mostly repeat the same
+// words, score high.
+func LowInformation(text string) float64 {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) == 0 {
+		return 1
+	}
+
+	distinct := make(map[string]bool, len(words))
+	for _, word := range words {
+		distinct[word] = true
+	}
+
+	shortness := 1 - math.Min(float64(len(distinct))/informativeWords, 1)
+	ratio := float64(len(distinct)) / float64(len(words))
+	repetition := math.Max((repetitiveRatio-ratio)/repetitiveRatio, 0)
+	return math.Max(shortness, repetition)
+}
+
+// nearDuplicates maps the ID of every entry that nearly duplicates a newer
+// entry to the most similar such entry. The newest of a group of duplicates
+// is kept. entries must be sorted oldest first.
+func nearDuplicates(entries []contextstore.Entry, threshold float64) map[string]string {
+	norms := make([]float64, len(entries))
+	for i, entry := range entries {
+		norms[i] = vector.Norm(entry.Embedding)
+	}
+
+	duplicates := make(map[string]string)
+	for i := range entries {
+		best := threshold
+		for j := i + 1; j < len(entries); j++ {
+			// Entries with mismatched dimensions or zero norms are never duplicates
+			similarity, err := vector.CosineSimilarityWithNorms(entries[i].Embedding, entries[j].Embedding, norms[i], norms[j])
+			if err != nil || similarity < best {
+				continue
+			}
+			best = similarity
+			duplicates[entries[i].ID] = entries[j].ID
+		}
+	}
+	return duplicates
+}
@@ -0,0 +1,134 @@
+package cleanup
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+)
+
+func TestLowInformation(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want float64
+	}{
+		{"empty", "", 1},
+		{"punctuation only", "...!?", 1},
+		{"two words", "ok thanks", 0.75},
+		{"repeated word", "test test test test test test test test", 0.875},
+		{"informative", "The auth service issues JWTs signed with RS256 and rotates keys weekly", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := LowInformation(test.text); got != test.want {
+				t.Errorf("LowInformation(%q) = %v, want %v", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	old := now.Add(-30 * 24 * time.Hour)
+	informative := "The auth service issues JWTs signed with RS256 and rotates keys weekly"
+
+	entries := []contextstore.Entry{
+		{ID: "stale-copy", SummaryText: informative, Embedding: []float32{1, 0, 0}, Timestamp: old, Retrievals: 3},
+		{ID: "junk", SummaryText: "ok thanks", Embedding: []float32{0, 1, 0}, Timestamp: old},
+		{ID: "current", SummaryText: informative, Embedding: []float32{0.99, 0.01, 0}, Timestamp: old.Add(time.Hour), Retrievals: 1},
+		{ID: "unused", SummaryText: informative, Embedding: []float32{0, 0, 1}, Timestamp: old},
+		{ID: "recent-junk", SummaryText: "ok", Embedding: []float32{0, 1, 1}, Timestamp: now.Add(-time.Hour)},
+	}
+
+	candidates := Analyze(entries, Options{Now: now})
+
+	got := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		got[i] = fmt.Sprintf("%s %.3f %v %s", candidate.ID, candidate.Score, candidate.Reasons, candidate.DuplicateOf)
+	}
+	want := []string{
+		"stale-copy 0.500 [near_duplicate] current",
+		"junk 0.425 [low_information never_retrieved] ",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Analyze() = %v, want %v", got, want)
+	}
+
+	// Lowering the threshold reports weaker candidates too
+	candidates = Analyze(entries, Options{Now: now, MinScore: 0.2})
+	if len(candidates) != 4 {
+		t.Errorf("Expected 4 candidates at MinScore 0.2, got %d", len(candidates))
+	}
+}
+
+func TestPolicySelect(t *testing.T) {
+	candidates := []Candidate{
+		{ID: "a", Score: 1},
+		{ID: "b", Score: 0.9},
+		{ID: "c", Score: 0.8},
+		{ID: "d", Score: 0.5},
+	}
+
+	tests := []struct {
+		name   string
+		policy Policy
+		want   string
+	}{
+		{"default deletes nothing", DefaultPolicy(), "[]"},
+		{"auto apply above score", Policy{AutoApply: true, ApplyMinScore: 0.8, MaxDeletions: 10}, "[a b c]"},
+		{"auto apply bounded", Policy{AutoApply: true, ApplyMinScore: 0.5, MaxDeletions: 2}, "[a b]"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var ids []string
+			for _, candidate := range test.policy.Select(candidates) {
+				ids = append(ids, candidate.ID)
+			}
+			if got := fmt.Sprint(ids); got != test.want {
+				t.Errorf("Select() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFindStale(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	old := now.AddDate(-1, 0, 0)
+	used := now.Add(-24 * time.Hour)
+
+	entries := []contextstore.Entry{
+		{ID: "relied-on", Timestamp: old, Retrievals: 9, LastRetrieved: used},
+		{ID: "older", Timestamp: old.Add(-time.Hour), Retrievals: 5, LastRetrieved: used},
+		{ID: "young", Timestamp: now.AddDate(0, -5, 0), Retrievals: 9, LastRetrieved: used},
+		{ID: "rarely-used", Timestamp: old, Retrievals: 4, LastRetrieved: used},
+		{ID: "no-longer-used", Timestamp: old, Retrievals: 9, LastRetrieved: now.AddDate(0, -2, 0)},
+		{ID: "confirmed", Timestamp: old, Retrievals: 9, LastRetrieved: used},
+		{ID: "confirmed-long-ago", Timestamp: old, Retrievals: 5, LastRetrieved: used},
+	}
+	reviews := []contextstore.Review{
+		{ID: "confirmed", Action: contextstore.ReviewConfirm, At: now.AddDate(0, -7, 0)},
+		{ID: "confirmed", Action: contextstore.ReviewConfirm, At: now.AddDate(0, -1, 0)},
+		{ID: "confirmed-long-ago", Action: contextstore.ReviewConfirm, At: now.AddDate(0, -7, 0)},
+	}
+
+	var got []string
+	for _, entry := range FindStale(entries, reviews, StaleOptions{Now: now}) {
+		got = append(got, entry.ID)
+	}
+	if want := "[relied-on older confirmed-long-ago]"; fmt.Sprint(got) != want {
+		t.Errorf("FindStale() = %v, want %s", got, want)
+	}
+
+	// Loosening the options flags more entries
+	got = nil
+	for _, entry := range FindStale(entries, reviews, StaleOptions{Now: now, MinAgeMonths: 1, MinRetrievals: 1}) {
+		got = append(got, entry.ID)
+	}
+	if want := "[confirmed relied-on young older confirmed-long-ago rarely-used]"; fmt.Sprint(got) != want {
+		t.Errorf("FindStale() with loose options = %v, want %s", got, want)
+	}
+}
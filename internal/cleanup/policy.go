@@ -0,0 +1,56 @@
+package cleanup
+
+// Defaults for the auto-apply policy
+const (
+	// DefaultApplyMinScore is the garbage score from which a candidate is
+	// deleted under an auto-apply policy.
+	DefaultApplyMinScore = 0.8
+
+	// DefaultMaxDeletions bounds how many entries one cleanup run deletes
+	// under an auto-apply policy.
+	DefaultMaxDeletions = 10
+)
+
+// Policy decides whether cleanup reports only list candidates or also
+// delete them.
+type Policy struct {
+	// Options tune the analyzer.
+	Options Options
+
+	// AutoApply deletes the candidates selected by Select whenever a
+	// cleanup report runs.
+	AutoApply bool
+
+	// ApplyMinScore is the garbage score from which a candidate is deleted.
+	ApplyMinScore float64
+
+	// MaxDeletions bounds how many entries one run deletes.
+	MaxDeletions int
+}
+
+// DefaultPolicy reports candidates with the default options and deletes
+// nothing.
+func DefaultPolicy() Policy {
+	return Policy{
+		ApplyMinScore: DefaultApplyMinScore,
+		MaxDeletions:  DefaultMaxDeletions,
+	}
+}
+
+// Select returns the candidates the policy deletes, in order. candidates
+// must be sorted as returned by Analyze. Nothing is selected unless
+// AutoApply is set.
+func (p Policy) Select(candidates []Candidate) []Candidate {
+	if !p.AutoApply {
+		return nil
+	}
+
+	var selected []Candidate
+	for _, candidate := range candidates {
+		if candidate.Score < p.ApplyMinScore || len(selected) >= p.MaxDeletions {
+			break
+		}
+		selected = append(selected, candidate)
+	}
+	return selected
+}
@@ -0,0 +1,125 @@
+package cleanup
+
+import (
+	"sort"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+)
+
+// Defaults for zero StaleOptions fields
+const (
+	// DefaultStaleMinAgeMonths is how many months after it was stored or
+	// last reviewed an entry is due for review.
+	DefaultStaleMinAgeMonths = 6
+
+	// DefaultStaleMinRetrievals is how often an entry must have been
+	// retrieved to be worth reviewing.
+	DefaultStaleMinRetrievals = 5
+
+	// DefaultStaleRecentWindow is how recently an entry must have been
+	// retrieved to count as still in use.
+	DefaultStaleRecentWindow = 30 * 24 * time.Hour
+)
+
+// StaleOptions tune FindStale. Zero fields take the defaults above.
+type StaleOptions struct {
+	// Now is the time entry ages are measured against. Zero means time.Now().
+	Now time.Time
+
+	// MinAgeMonths is how many months after it was stored or last reviewed
+	// an entry is due for review.
+	MinAgeMonths int
+
+	// MinRetrievals is how often an entry must have been retrieved to be
+	// worth reviewing.
+	MinRetrievals int
+
+	// RecentWindow is how recently an entry must have been retrieved to
+	// count as still in use.
+	RecentWindow time.Duration
+}
+
+// StaleEntry is an old entry that is still retrieved often, flagged for a
+// person to confirm, refresh or retire
+type StaleEntry struct {
+	ID          string
+	SummaryText string
+	Title       string
+	Timestamp   time.Time
+
+	// Retrievals is how often the entry was retrieved, last at
+	// LastRetrieved.
+	Retrievals    int
+	LastRetrieved time.Time
+
+	// LastReviewed is when the entry was last reviewed. It is zero if it
+	// never was.
+	LastReviewed time.Time
+}
+
+// withDefaults fills in zero fields
+func (o StaleOptions) withDefaults() StaleOptions {
+	if o.Now.IsZero() {
+		o.Now = time.Now()
+	}
+	if o.MinAgeMonths == 0 {
+		o.MinAgeMonths = DefaultStaleMinAgeMonths
+	}
+	if o.MinRetrievals == 0 {
+		o.MinRetrievals = DefaultStaleMinRetrievals
+	}
+	if o.RecentWindow == 0 {
+		o.RecentWindow = DefaultStaleRecentWindow
+	}
+	return o
+}
+
+// FindStale returns the entries stored or last reviewed at least
+// options.MinAgeMonths ago that were retrieved at least
+// options.MinRetrievals times, last within options.RecentWindow. The most
+// retrieved come first, then the oldest. reviews may hold the reviews of
+// any entries, in any order.
+func FindStale(entries []contextstore.Entry, reviews []contextstore.Review, options StaleOptions) []StaleEntry {
+	options = options.withDefaults()
+	dueBefore := options.Now.AddDate(0, -options.MinAgeMonths, 0)
+	usedAfter := options.Now.Add(-options.RecentWindow)
+
+	lastReviewed := make(map[string]time.Time)
+	for _, review := range reviews {
+		if review.At.After(lastReviewed[review.ID]) {
+			lastReviewed[review.ID] = review.At
+		}
+	}
+
+	var stale []StaleEntry
+	for _, entry := range entries {
+		reviewed := lastReviewed[entry.ID]
+		if entry.Timestamp.After(dueBefore) || reviewed.After(dueBefore) {
+			continue
+		}
+		if entry.Retrievals < options.MinRetrievals || entry.LastRetrieved.Before(usedAfter) {
+			continue
+		}
+		stale = append(stale, StaleEntry{
+			ID:            entry.ID,
+			SummaryText:   entry.SummaryText,
+			Title:         entry.Title,
+			Timestamp:     entry.Timestamp,
+			Retrievals:    entry.Retrievals,
+			LastRetrieved: entry.LastRetrieved,
+			LastReviewed:  reviewed,
+		})
+	}
+
+	sort.Slice(stale, func(i, j int) bool {
+		if stale[i].Retrievals != stale[j].Retrievals {
+			return stale[i].Retrievals > stale[j].Retrievals
+		}
+		if !stale[i].Timestamp.Equal(stale[j].Timestamp) {
+			return stale[i].Timestamp.Before(stale[j].Timestamp)
+		}
+		return stale[i].ID < stale[j].ID
+	})
+	return stale
+}
@@ -4,37 +4,49 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
-	"sync"
+	"slices"
 	"time"
 
 	"github.com/localrivet/configurator"
 )
 
-// Global configuration instance
-var (
-	// Global is the global configuration instance
-	Global *Config
-	// initOnce ensures initialization happens only once
-	initOnce sync.Once
-)
-
-// InitGlobal initializes the global configuration
-func InitGlobal(configPath string) (*Config, error) {
-	var err error
-	initOnce.Do(func() {
-		Global, err = LoadConfigWithPath(configPath)
-	})
-	return Global, err
-}
-
-// Config represents the ProjectMemory configuration
+// Config represents the ProjectMemory configuration. There is no global
+// configuration: each Config is passed to what it configures. A Config is
+// plain data that may be copied, but like any struct it must not be
+// modified while another goroutine reads it; Clone gives each user a copy
+// of its own.
 type Config struct {
 	// Store contains storage-related configuration.
 	Store struct {
 		// SQLitePath is the path to the SQLite database file.
 		SQLitePath string `json:"sqlite_path" env:"SQLITE_PATH" validate:"required"`
+
+		// ClearGracePeriod is how long entries removed by clear_all_context can be restored
+		// with undo_clear, as a Go duration string. "0s" deletes them immediately.
+		ClearGracePeriod string `json:"clear_grace_period" env:"CLEAR_GRACE_PERIOD"`
+
+		// ArchiveTarget is where archive_namespace moves namespaces and snapshots are written:
+		// a directory or an s3://, gs:// or azblob:// URL. Empty disables archiving.
+		ArchiveTarget string `json:"archive_target" env:"ARCHIVE_TARGET"`
+
+		// EncryptedNamespaces maps each namespace whose summaries are encrypted to the ID of the
+		// master key that wraps its data key.
+		EncryptedNamespaces map[string]string `json:"encrypted_namespaces"`
+
+		// MasterKeys lists the master keys as comma-separated "id:key" pairs, each key 32 bytes in
+		// base64. Every server sharing the database reads the namespaces wrapped by the keys it holds.
+		MasterKeys string `json:"master_keys" env:"MASTER_KEYS"`
+
+		// WriteBatchSize is the most entries saved at the same time that are committed in one
+		// transaction. Below 2, each entry is committed on its own.
+		WriteBatchSize int `json:"write_batch_size" env:"WRITE_BATCH_SIZE"`
+
+		// WriteBatchDelay is how long a batch waits for more entries after its first, as a Go
+		// duration string. Empty or "0s" only batches the entries already waiting.
+		WriteBatchDelay string `json:"write_batch_delay" env:"WRITE_BATCH_DELAY"`
 	} `json:"store"`
 
 	// Summarizer contains summarization-related configuration.
@@ -44,6 +56,104 @@ type Config struct {
 
 		// ApiKey is the API key for the summarization provider.
 		ApiKey string `json:"api_key" env:"SUMMARIZER_API_KEY"`
+
+		// ApiKeys are further API keys for the "ai" summarizer's provider, used in turn with ApiKey.
+		ApiKeys []string `json:"api_keys" env:"SUMMARIZER_API_KEYS"`
+
+		// KeyRotation is "round-robin" to send each request with the next API key, or "failover" to keep
+		// one key until it is rate limited. Either way, a request answered 429 is retried with the next key.
+		KeyRotation string `json:"key_rotation" env:"SUMMARIZER_KEY_ROTATION"`
+
+		// AIProvider is the LLM provider used by the "ai" summarizer.
+		AIProvider string `json:"ai_provider" env:"SUMMARIZER_AI_PROVIDER"`
+
+		// ModelID is the model requested from the "ai" summarizer's provider.
+		ModelID string `json:"model_id" env:"SUMMARIZER_MODEL_ID"`
+
+		// MaxLength is the maximum summary length in characters.
+		MaxLength int `json:"max_length" env:"SUMMARIZER_MAX_LENGTH"`
+
+		// MaxInputLength is the longest text in bytes the "ai" summarizer sends to a provider at once.
+		// Longer text is summarized in chunks whose summaries are summarized again. 0 uses the default.
+		MaxInputLength int `json:"max_input_length" env:"SUMMARIZER_MAX_INPUT_LENGTH"`
+
+		// MinInputLength is the length in characters below which saved text is stored as it is,
+		// embedded but not summarized. 0 summarizes all text.
+		MinInputLength int `json:"min_input_length" env:"SUMMARIZER_MIN_INPUT_LENGTH"`
+
+		// MaxInputTokens also bounds the text the "ai" summarizer sends to a provider at once, in tokens
+		// as counted by Tokenizer. 0 bounds it in bytes only.
+		MaxInputTokens int `json:"max_input_tokens" env:"SUMMARIZER_MAX_INPUT_TOKENS"`
+
+		// Tokenizer counts tokens for chunking and cost estimates: "approximate" for about four bytes
+		// per token, or "bpe" for a byte-pair encoding read from TokenizerFile. Empty approximates
+		// each provider's own tokenizer.
+		Tokenizer string `json:"tokenizer" env:"SUMMARIZER_TOKENIZER"`
+
+		// TokenizerFile is the tiktoken rank file of the "bpe" tokenizer.
+		TokenizerFile string `json:"tokenizer_file" env:"SUMMARIZER_TOKENIZER_FILE"`
+
+		// ChunkConcurrency is how many chunks of a long text are summarized at once. 0 uses the default.
+		ChunkConcurrency int `json:"chunk_concurrency" env:"SUMMARIZER_CHUNK_CONCURRENCY"`
+
+		// MaxConcurrency is how many provider requests the "ai" summarizer has in flight at once, across
+		// all save_context calls. Further requests wait their turn. 0 uses the default.
+		MaxConcurrency int `json:"max_concurrency" env:"SUMMARIZER_MAX_CONCURRENCY"`
+
+		// Routing is "static" to try the "ai" summarizer's provider and then the fallbacks in order, or
+		// "latency" to try the currently fastest healthy provider first. Empty is "static".
+		Routing string `json:"routing" env:"SUMMARIZER_ROUTING"`
+
+		// RoutingInterval is how often "latency" routing re-ranks the providers, as a Go duration string.
+		RoutingInterval string `json:"routing_interval" env:"SUMMARIZER_ROUTING_INTERVAL"`
+
+		// HedgeDelay is how long the "ai" summarizer waits for its provider before also asking the first
+		// fallback and using whichever answers first, as a Go duration string. Empty never hedges.
+		HedgeDelay string `json:"hedge_delay" env:"SUMMARIZER_HEDGE_DELAY"`
+
+		// HealthProbeInterval is how often the "ai" summarizer's providers are probed in the background,
+		// as a Go duration string. Health reports then use the last probe. Empty probes them for every report.
+		HealthProbeInterval string `json:"health_probe_interval" env:"SUMMARIZER_HEALTH_PROBE_INTERVAL"`
+
+		// PromptTemplate is the Go text/template the "ai" summarizer sends to every provider.
+		// It is executed with {{.Text}} and {{.MaxLength}}; empty uses the built-in prompt.
+		PromptTemplate string `json:"prompt_template" env:"SUMMARIZER_PROMPT_TEMPLATE"`
+
+		// Timeout bounds each provider request, as a Go duration string.
+		Timeout string `json:"timeout" env:"SUMMARIZER_TIMEOUT"`
+
+		// MaxRetries is the number of retries per provider before moving to the next fallback.
+		MaxRetries int `json:"max_retries" env:"SUMMARIZER_MAX_RETRIES"`
+
+		// RetryDelay is the delay before the first retry, as a Go duration string.
+		RetryDelay string `json:"retry_delay" env:"SUMMARIZER_RETRY_DELAY"`
+
+		// CacheCapacity is the number of summaries cached in memory.
+		CacheCapacity int `json:"cache_capacity" env:"SUMMARIZER_CACHE_CAPACITY"`
+
+		// CacheMaxBytes bounds the memory of cached summaries. 0 bounds only the entry count.
+		CacheMaxBytes int64 `json:"cache_max_bytes" env:"SUMMARIZER_CACHE_MAX_BYTES"`
+
+		// CacheTTL is how long a cached summary stays valid, as a Go duration string.
+		CacheTTL string `json:"cache_ttl" env:"SUMMARIZER_CACHE_TTL"`
+
+		// MonthlyBudget is the estimated cost in US dollars the "ai" summarizer may spend per calendar month.
+		// Over it, summaries are written by the basic summarizer. 0 is unlimited.
+		MonthlyBudget float64 `json:"monthly_budget" env:"SUMMARIZER_MONTHLY_BUDGET"`
+
+		// Pricing overrides the built-in price of a model, keyed by model ID, in US dollars per million tokens.
+		Pricing map[string]struct {
+			Input  float64 `json:"input"`
+			Output float64 `json:"output"`
+		} `json:"pricing"`
+
+		// Fallbacks are tried in order when the "ai" summarizer's provider fails.
+		Fallbacks []struct {
+			Provider string   `json:"provider"`
+			ApiKey   string   `json:"api_key"`
+			ApiKeys  []string `json:"api_keys"`
+			ModelID  string   `json:"model_id"`
+		} `json:"fallbacks"`
 	} `json:"summarizer"`
 
 	// Embedder contains embedding-related configuration.
@@ -52,12 +162,440 @@ type Config struct {
 		Provider string `json:"provider" env:"EMBEDDER_PROVIDER"`
 
 		// Dimensions is the number of dimensions for the embeddings.
-		Dimensions int `json:"dimensions" env:"EMBEDDER_DIMENSIONS" validate:"min:1"`
+		Dimensions int `json:"dimensions" env:"EMBEDDER_DIMENSIONS" validate:"min:1,max:65536"`
 
 		// ApiKey is the API key for the embedding provider.
 		ApiKey string `json:"api_key" env:"EMBEDDER_API_KEY"`
+
+		// ModelID is the embedding model to request from the provider.
+		ModelID string `json:"model_id" env:"EMBEDDER_MODEL_ID"`
+
+		// Endpoint is the URL used by the "http" provider.
+		Endpoint string `json:"endpoint" env:"EMBEDDER_ENDPOINT"`
+
+		// BodyTemplate is the JSON request body template used by the "http" provider.
+		BodyTemplate string `json:"body_template" env:"EMBEDDER_BODY_TEMPLATE"`
+
+		// VectorPath is the JSONPath of the vector in "http" provider responses.
+		VectorPath string `json:"vector_path" env:"EMBEDDER_VECTOR_PATH"`
+
+		// ModelPath is the path to the .onnx model used by the "onnx" provider.
+		ModelPath string `json:"model_path" env:"EMBEDDER_MODEL_PATH"`
+
+		// VocabPath is the path to the vocab.txt used by the "onnx" provider.
+		VocabPath string `json:"vocab_path" env:"EMBEDDER_VOCAB_PATH"`
+
+		// LibraryPath is the path to the onnxruntime shared library.
+		LibraryPath string `json:"library_path" env:"EMBEDDER_LIBRARY_PATH"`
+
+		// Input is the text embedded for each entry: "summary", "original" or "both".
+		Input string `json:"input" env:"EMBEDDER_INPUT"`
+
+		// CacheCapacity is the number of embeddings cached in memory. 0 disables the cache.
+		CacheCapacity int `json:"cache_capacity" env:"EMBEDDER_CACHE_CAPACITY"`
+
+		// CacheMaxBytes bounds the memory of cached embeddings. 0 bounds only the entry count.
+		CacheMaxBytes int64 `json:"cache_max_bytes" env:"EMBEDDER_CACHE_MAX_BYTES"`
+
+		// CacheTTL is how long a cached embedding stays valid, as a Go duration string.
+		CacheTTL string `json:"cache_ttl" env:"EMBEDDER_CACHE_TTL"`
+
+		// CachePersist stores cached embeddings in the SQLite database so they survive restarts.
+		CachePersist bool `json:"cache_persist" env:"EMBEDDER_CACHE_PERSIST"`
+
+		// Fallbacks are tried in order when the primary provider keeps failing.
+		// Each entry takes the same provider settings as the primary.
+		Fallbacks []struct {
+			Provider     string `json:"provider"`
+			ApiKey       string `json:"api_key"`
+			ModelID      string `json:"model_id"`
+			Endpoint     string `json:"endpoint"`
+			BodyTemplate string `json:"body_template"`
+			VectorPath   string `json:"vector_path"`
+			ModelPath    string `json:"model_path"`
+			VocabPath    string `json:"vocab_path"`
+			LibraryPath  string `json:"library_path"`
+		} `json:"fallbacks"`
+
+		// MaxRetries is the number of retries per provider before moving to the next fallback.
+		MaxRetries int `json:"max_retries" env:"EMBEDDER_MAX_RETRIES"`
+
+		// RetryDelay is the delay before the first retry, as a Go duration string. It doubles on each retry.
+		RetryDelay string `json:"retry_delay" env:"EMBEDDER_RETRY_DELAY"`
 	} `json:"embedder"`
 
+	// Cleanup contains the cleanup_report policy.
+	Cleanup struct {
+		// MinScore is the garbage score from which entries are reported. 0 uses the default.
+		MinScore float64 `json:"min_score" env:"CLEANUP_MIN_SCORE"`
+
+		// MinAge is how old a never-retrieved entry must be before that counts against it, as a Go duration string.
+		MinAge string `json:"min_age" env:"CLEANUP_MIN_AGE"`
+
+		// DuplicateThreshold is the cosine similarity from which entries are near-duplicates. 0 uses the default.
+		DuplicateThreshold float64 `json:"duplicate_threshold" env:"CLEANUP_DUPLICATE_THRESHOLD"`
+
+		// AutoApply deletes candidates scoring at least ApplyMinScore whenever cleanup_report runs.
+		AutoApply bool `json:"auto_apply" env:"CLEANUP_AUTO_APPLY"`
+
+		// ApplyMinScore is the garbage score from which candidates are deleted. 0 uses the default.
+		ApplyMinScore float64 `json:"apply_min_score" env:"CLEANUP_APPLY_MIN_SCORE"`
+
+		// MaxDeletions bounds how many entries one cleanup_report deletes. 0 uses the default.
+		MaxDeletions int `json:"max_deletions" env:"CLEANUP_MAX_DELETIONS"`
+	} `json:"cleanup"`
+
+	// Review contains which entries review_queue flags as due for review.
+	Review struct {
+		// MinAgeMonths is how many months after it was stored or last reviewed an entry is due. 0 uses the default.
+		MinAgeMonths int `json:"min_age_months" env:"REVIEW_MIN_AGE_MONTHS"`
+
+		// MinRetrievals is how often an entry must have been retrieved to be flagged. 0 uses the default.
+		MinRetrievals int `json:"min_retrievals" env:"REVIEW_MIN_RETRIEVALS"`
+
+		// RecentWindow is how recently an entry must have been retrieved to be flagged, as a Go duration string.
+		RecentWindow string `json:"recent_window" env:"REVIEW_RECENT_WINDOW"`
+	} `json:"review"`
+
+	// Links contains the linking of saved text to the repository files and Go symbols it mentions.
+	Links struct {
+		// Root is the repository to index. Empty links nothing.
+		Root string `json:"root" env:"LINKS_ROOT"`
+
+		// RefreshInterval is how often the repository is indexed again, as a Go duration string.
+		// Empty indexes it once.
+		RefreshInterval string `json:"refresh_interval" env:"LINKS_REFRESH_INTERVAL"`
+	} `json:"links"`
+
+	// Watch contains the ingestion of documentation files again as they change.
+	Watch struct {
+		// Paths are the directories watched, with their subdirectories. Empty watches nothing.
+		Paths []string `json:"paths" env:"WATCH_PATHS"`
+
+		// Extensions are the extensions of the files ingested. Empty watches markdown, text,
+		// reStructuredText and AsciiDoc files.
+		Extensions []string `json:"extensions" env:"WATCH_EXTENSIONS"`
+
+		// Debounce is how long a file must be left alone after a change before it is ingested,
+		// as a Go duration string. Empty waits 2s.
+		Debounce string `json:"debounce" env:"WATCH_DEBOUNCE"`
+
+		// Chunker is how files are split: "auto", "headings", "tokens" or "symbols". Empty is
+		// "auto".
+		Chunker string `json:"chunker" env:"WATCH_CHUNKER"`
+
+		// MaxTokens is the token budget of a chunk. 0 is 500.
+		MaxTokens int `json:"max_tokens" env:"WATCH_MAX_TOKENS"`
+	} `json:"watch"`
+
+	// Consolidation contains the LLM merging of highly similar entries into single entries.
+	Consolidation struct {
+		// Enabled offers the consolidate tool.
+		Enabled bool `json:"enabled" env:"CONSOLIDATION_ENABLED"`
+
+		// Interval is how often every namespace is consolidated while the server runs, as a Go
+		// duration string. Empty consolidates only when the consolidate tool is called.
+		Interval string `json:"interval" env:"CONSOLIDATION_INTERVAL"`
+
+		// Threshold is the cosine similarity every two entries of a cluster reach. 0 uses 0.92.
+		Threshold float64 `json:"threshold" env:"CONSOLIDATION_THRESHOLD"`
+
+		// MaxClusterSize is the most entries merged into one. 0 uses 8.
+		MaxClusterSize int `json:"max_cluster_size" env:"CONSOLIDATION_MAX_CLUSTER_SIZE"`
+
+		// Provider is the LLM provider asked to merge: "anthropic", "openai", "google" or
+		// "xai". Empty uses the summarizer's AI provider.
+		Provider string `json:"provider" env:"CONSOLIDATION_PROVIDER"`
+
+		// ModelID is the model asked to merge. Empty uses the summarizer's model if the
+		// providers match, then the provider's default model.
+		ModelID string `json:"model_id" env:"CONSOLIDATION_MODEL_ID"`
+
+		// ApiKey is the provider's API key. Empty uses the summarizer's key if the providers
+		// match, then the provider's API key environment variable.
+		ApiKey string `json:"api_key" env:"CONSOLIDATION_API_KEY"`
+	} `json:"consolidation"`
+
+	// Retrieval contains the retrieve_context defaults.
+	Retrieval struct {
+		// Namespaces maps a namespace to the defaults of requests that name it. Zero values
+		// keep the server-wide defaults.
+		Namespaces map[string]struct {
+			// Limit is the number of results returned when a request sets none.
+			Limit int `json:"limit"`
+
+			// MinScore drops results less similar to the query than this, between 0 and 1.
+			MinScore float64 `json:"min_score"`
+
+			// RecencyHalfLife is the age at which recency ranking halves an entry's weight, as a Go duration string.
+			RecencyHalfLife string `json:"recency_half_life"`
+
+			// RecencyFloor is the share of an entry's ranking score recency ranking keeps however
+			// old the entry is, between 0 and 1.
+			RecencyFloor float64 `json:"recency_floor"`
+
+			// HybridWeights balances vector and keyword scores in hybrid ranking.
+			HybridWeights struct {
+				Vector  float64 `json:"vector"`
+				Keyword float64 `json:"keyword"`
+			} `json:"hybrid_weights"`
+		} `json:"namespaces"`
+
+		// InjectionMode is what retrieve_context does with instructions planted in retrieved
+		// summaries: "off", "detect" to count and log them, or "scrub" to also remove them.
+		InjectionMode string `json:"injection_mode" env:"RETRIEVAL_INJECTION_MODE"`
+
+		// Tokenizer counts the tokens of results against a request's max_tokens: "approximate"
+		// for about four bytes per token, or "bpe" for a byte-pair encoding read from
+		// TokenizerFile. Empty approximates.
+		Tokenizer string `json:"tokenizer" env:"RETRIEVAL_TOKENIZER"`
+
+		// TokenizerFile is the tiktoken rank file of the "bpe" tokenizer.
+		TokenizerFile string `json:"tokenizer_file" env:"RETRIEVAL_TOKENIZER_FILE"`
+
+		// Rerank configures the LLM reranking of retrieve_context results.
+		Rerank struct {
+			// Mode is which requests are reranked: "off", "request" for requests setting rerank,
+			// or "always". Empty is "off".
+			Mode string `json:"mode" env:"RETRIEVAL_RERANK_MODE"`
+
+			// Provider is the LLM provider asked to rerank: "anthropic", "openai", "google" or
+			// "xai". Empty uses the summarizer's AI provider.
+			Provider string `json:"provider" env:"RETRIEVAL_RERANK_PROVIDER"`
+
+			// ModelID is the model asked to rerank. Empty uses the summarizer's model if the
+			// providers match, then the provider's default model.
+			ModelID string `json:"model_id" env:"RETRIEVAL_RERANK_MODEL_ID"`
+
+			// ApiKey is the provider's API key. Empty uses the summarizer's key if the providers
+			// match, then the provider's API key environment variable.
+			ApiKey string `json:"api_key" env:"RETRIEVAL_RERANK_API_KEY"`
+
+			// Candidates is how many of the best results the model picks from. 0 uses 20.
+			Candidates int `json:"candidates" env:"RETRIEVAL_RERANK_CANDIDATES"`
+
+			// MaxCandidateLength is the most bytes of each candidate sent to the model. 0 uses 1000.
+			MaxCandidateLength int `json:"max_candidate_length" env:"RETRIEVAL_RERANK_MAX_CANDIDATE_LENGTH"`
+		} `json:"rerank"`
+
+		// Expansion configures the LLM expansion of retrieve_context queries into paraphrases.
+		Expansion struct {
+			// Mode is which requests are expanded: "off", "request" for requests setting expand,
+			// or "always". Empty is "off".
+			Mode string `json:"mode" env:"RETRIEVAL_EXPANSION_MODE"`
+
+			// Provider is the LLM provider asked to expand: "anthropic", "openai", "google" or
+			// "xai". Empty uses the summarizer's AI provider.
+			Provider string `json:"provider" env:"RETRIEVAL_EXPANSION_PROVIDER"`
+
+			// ModelID is the model asked to expand. Empty uses the summarizer's model if the
+			// providers match, then the provider's default model.
+			ModelID string `json:"model_id" env:"RETRIEVAL_EXPANSION_MODEL_ID"`
+
+			// ApiKey is the provider's API key. Empty uses the summarizer's key if the providers
+			// match, then the provider's API key environment variable.
+			ApiKey string `json:"api_key" env:"RETRIEVAL_EXPANSION_API_KEY"`
+
+			// Queries is how many alternative queries are searched besides the request's. 0 uses 3.
+			Queries int `json:"queries" env:"RETRIEVAL_EXPANSION_QUERIES"`
+		} `json:"expansion"`
+
+		// HyDE configures the LLM drafting of hypothetical answers to retrieve_context queries,
+		// searched with in place of the queries.
+		HyDE struct {
+			// Mode is which requests are drafted for: "off", "request" for requests setting hyde,
+			// or "always". Empty is "off".
+			Mode string `json:"mode" env:"RETRIEVAL_HYDE_MODE"`
+
+			// Provider is the LLM provider asked to draft: "anthropic", "openai", "google" or
+			// "xai". Empty uses the summarizer's AI provider.
+			Provider string `json:"provider" env:"RETRIEVAL_HYDE_PROVIDER"`
+
+			// ModelID is the model asked to draft. Empty uses the summarizer's model if the
+			// providers match, then the provider's default model.
+			ModelID string `json:"model_id" env:"RETRIEVAL_HYDE_MODEL_ID"`
+
+			// ApiKey is the provider's API key. Empty uses the summarizer's key if the providers
+			// match, then the provider's API key environment variable.
+			ApiKey string `json:"api_key" env:"RETRIEVAL_HYDE_API_KEY"`
+		} `json:"hyde"`
+	} `json:"retrieval"`
+
+	// Requests contains the limits applied to each tool call.
+	Requests struct {
+		// Timeout is how long a tool call may wait on the summarizer and embedder before it is
+		// cancelled and fails, as a Go duration string. "0s" leaves calls unbounded.
+		Timeout string `json:"timeout" env:"REQUEST_TIMEOUT"`
+
+		// MaxTextLength is the most characters of text a tool call may save. 0 keeps the default.
+		MaxTextLength int `json:"max_text_length" env:"REQUEST_MAX_TEXT_LENGTH"`
+
+		// MaxQueryLength is the most characters of a retrieve_context query. 0 keeps the default.
+		MaxQueryLength int `json:"max_query_length" env:"REQUEST_MAX_QUERY_LENGTH"`
+
+		// MaxLimit is the highest limit a tool call may ask for. 0 keeps the default.
+		MaxLimit int `json:"max_limit" env:"REQUEST_MAX_LIMIT"`
+	} `json:"requests"`
+
+	// Tools contains which MCP tools the server offers.
+	Tools struct {
+		// Disabled lists tools the server does not offer, such as "clear_all_context".
+		Disabled []string `json:"disabled" env:"TOOLS_DISABLED"`
+
+		// ReadOnly withholds every tool that changes stored context.
+		ReadOnly bool `json:"read_only" env:"TOOLS_READ_ONLY"`
+	} `json:"tools"`
+
+	// Shutdown contains how the server stops on Stop, SIGINT or SIGTERM.
+	Shutdown struct {
+		// Timeout is how long the server waits for tool calls in flight and queued captures before
+		// closing the store anyway, as a Go duration string.
+		Timeout string `json:"timeout" env:"SHUTDOWN_TIMEOUT"`
+	} `json:"shutdown"`
+
+	// Idle contains the release of resources while the server sits idle.
+	Idle struct {
+		// Timeout is how long the server waits without tool calls before closing idle
+		// provider connections and shrinking caches, as a Go duration string. "0s" disables it.
+		Timeout string `json:"timeout" env:"IDLE_TIMEOUT"`
+
+		// ReleaseStore also checkpoints the SQLite write-ahead log and shrinks its memory when idle.
+		ReleaseStore bool `json:"release_store" env:"IDLE_RELEASE_STORE"`
+	} `json:"idle"`
+
+	// Memory contains the shrinking of caches under memory pressure.
+	Memory struct {
+		// HeapLimit is the live heap size in bytes above which the summary and embedding
+		// caches are shrunk and freed memory is returned to the OS. 0 disables it.
+		HeapLimit int64 `json:"heap_limit" env:"MEMORY_HEAP_LIMIT"`
+
+		// CheckInterval is how often the live heap is compared with HeapLimit, as a Go duration string.
+		CheckInterval string `json:"check_interval" env:"MEMORY_CHECK_INTERVAL"`
+	} `json:"memory"`
+
+	// HealthReport contains the periodic sending of the health report.
+	HealthReport struct {
+		// Sink is where the report is sent: "log", "file" or "http". Empty sends none.
+		Sink string `json:"sink" env:"HEALTH_REPORT_SINK"`
+
+		// Interval is how often the report is sent, as a Go duration string.
+		Interval string `json:"interval" env:"HEALTH_REPORT_INTERVAL"`
+
+		// Path is the file the "file" sink replaces with each report.
+		Path string `json:"path" env:"HEALTH_REPORT_PATH"`
+
+		// URL is the endpoint the "http" sink POSTs each report to.
+		URL string `json:"url" env:"HEALTH_REPORT_URL"`
+	} `json:"health_report"`
+
+	// UsageReport contains the periodic usage analytics report: most retrieved entries, dead tags, hit rate
+	// and queries without results.
+	UsageReport struct {
+		// Sink is where the report is sent: "log", "file" or "http". Empty sends none.
+		Sink string `json:"sink" env:"USAGE_REPORT_SINK"`
+
+		// Interval is how often the report is sent, as a Go duration string.
+		Interval string `json:"interval" env:"USAGE_REPORT_INTERVAL"`
+
+		// Format is "markdown" or "json". Empty is "markdown".
+		Format string `json:"format" env:"USAGE_REPORT_FORMAT"`
+
+		// Top is how many entries, tags and queries each list of the report holds. 0 uses the default.
+		Top int `json:"top" env:"USAGE_REPORT_TOP"`
+
+		// SuggestIngestion adds topics worth ingesting documentation about, from the queries logged by
+		// memory_gaps, to the report.
+		SuggestIngestion bool `json:"suggest_ingestion" env:"USAGE_REPORT_SUGGEST_INGESTION"`
+
+		// Path is the file the "file" sink replaces with each report.
+		Path string `json:"path" env:"USAGE_REPORT_PATH"`
+
+		// URL is the endpoint the "http" sink POSTs each report to.
+		URL string `json:"url" env:"USAGE_REPORT_URL"`
+	} `json:"usage_report"`
+
+	// QuickCapture contains the localhost endpoint that saves text sent by hotkey scripts.
+	QuickCapture struct {
+		// Addr is the loopback address, such as "127.0.0.1:7077", that POST /quick-capture is
+		// served on. Empty disables the endpoint.
+		Addr string `json:"addr" env:"QUICK_CAPTURE_ADDR"`
+
+		// Token is the shared secret every capture sends as a bearer token. Required with Addr.
+		Token string `json:"token" env:"QUICK_CAPTURE_TOKEN"`
+	} `json:"quick_capture"`
+
+	// GRPC contains the endpoint that serves the ProjectMemory gRPC service to backend services.
+	GRPC struct {
+		// Addr is the address, such as ":7078", that the gRPC service is served on. Empty
+		// disables the endpoint.
+		Addr string `json:"addr" env:"GRPC_ADDR"`
+
+		// Token is the shared secret every call sends as a bearer token. Required unless Addr
+		// is a loopback address.
+		Token string `json:"token" env:"GRPC_TOKEN"`
+	} `json:"grpc"`
+
+	// Metrics contains the endpoint that serves metrics to Prometheus.
+	Metrics struct {
+		// Addr is the address, such as ":9464", that GET /metrics is served on. Empty disables the
+		// endpoint.
+		Addr string `json:"addr" env:"METRICS_ADDR"`
+	} `json:"metrics"`
+
+	// Auth contains the authentication of callers of the quick-capture and gRPC endpoints, in addition
+	// to their tokens, and the namespaces each caller may use.
+	Auth struct {
+		// APIKeys are further bearer tokens, each naming its caller and the namespaces it may use.
+		APIKeys []struct {
+			Key        string   `json:"key"`
+			Subject    string   `json:"subject"`
+			Namespaces []string `json:"namespaces"`
+		} `json:"api_keys"`
+
+		// OIDC accepts bearer tokens issued by an OpenID Connect provider.
+		OIDC struct {
+			// Issuer is the URL of the provider, which tokens must name. Empty disables OIDC.
+			Issuer string `json:"issuer" env:"AUTH_OIDC_ISSUER"`
+
+			// Audience must be in the "aud" claim of tokens. Required with Issuer.
+			Audience string `json:"audience" env:"AUTH_OIDC_AUDIENCE"`
+
+			// JWKSURL is where the provider's signing keys are published. Empty discovers it from Issuer.
+			JWKSURL string `json:"jwks_url" env:"AUTH_OIDC_JWKS_URL"`
+
+			// NamespacesClaim is the token claim listing the caller's namespaces. Empty is "namespaces".
+			NamespacesClaim string `json:"namespaces_claim" env:"AUTH_OIDC_NAMESPACES_CLAIM"`
+		} `json:"oidc"`
+
+		// TLS serves the endpoints over TLS, and authenticates callers by client certificate.
+		TLS struct {
+			// CertFile and KeyFile are the PEM certificate and key the endpoints serve. Empty serves
+			// plain connections.
+			CertFile string `json:"cert_file" env:"AUTH_TLS_CERT_FILE"`
+			KeyFile  string `json:"key_file" env:"AUTH_TLS_KEY_FILE"`
+
+			// ClientCAFile is the PEM bundle client certificates are verified against. Empty accepts
+			// no client certificates.
+			ClientCAFile string `json:"client_ca_file" env:"AUTH_TLS_CLIENT_CA_FILE"`
+
+			// ClientNamespaces maps the common name of each allowed client certificate to the
+			// namespaces it may use.
+			ClientNamespaces map[string][]string `json:"client_namespaces"`
+		} `json:"tls"`
+	} `json:"auth"`
+
+	// SaveLimit contains the per-source guardrail against runaway save loops.
+	SaveLimit struct {
+		// Window is the sliding window saves are counted over, as a Go duration string.
+		Window string `json:"window" env:"SAVE_LIMIT_WINDOW"`
+
+		// MaxSaves is how many saves one source may make per window. 0 is unlimited.
+		MaxSaves int `json:"max_saves" env:"SAVE_LIMIT_MAX_SAVES"`
+
+		// MaxBytes is how many bytes of context text one source may save per window. 0 is unlimited.
+		MaxBytes int `json:"max_bytes" env:"SAVE_LIMIT_MAX_BYTES"`
+	} `json:"save_limit"`
+
 	// Logging contains logging-related configuration.
 	Logging struct {
 		// Level is the minimum log level to display ("debug", "info", "warn", "error").
@@ -68,9 +606,8 @@ type Config struct {
 	} `json:"logging"`
 
 	// Internal state (not saved to config file)
-	configPath     string       `json:"-"`
-	mutex          sync.RWMutex `json:"-"`
-	lastModifiedAt time.Time    `json:"-"`
+	configPath     string    `json:"-"`
+	lastModifiedAt time.Time `json:"-"`
 }
 
 // Default configuration values
@@ -79,15 +616,31 @@ const (
 	DefaultSQLitePath     = ".projectmemory.db"
 	DefaultLogLevel       = "info"
 	DefaultLogFormat      = "text"
+
+	DefaultEmbedderCacheCapacity = 1000
+	DefaultEmbedderCacheTTL      = "24h"
+	DefaultEmbedderInput         = "summary"
+
+	DefaultClearGracePeriod = "24h"
+
+	DefaultWriteBatchSize = 64
+
+	DefaultIdleTimeout = "10m"
 )
 
 // NewConfig creates a new Config instance with default values
 func NewConfig() *Config {
 	config := &Config{}
 	config.Store.SQLitePath = DefaultSQLitePath
+	config.Store.ClearGracePeriod = DefaultClearGracePeriod
+	config.Store.WriteBatchSize = DefaultWriteBatchSize
+	config.Idle.Timeout = DefaultIdleTimeout
 	config.Summarizer.Provider = "basic"
 	config.Embedder.Provider = "mock"
 	config.Embedder.Dimensions = 768 // Using a common embedding dimension
+	config.Embedder.CacheCapacity = DefaultEmbedderCacheCapacity
+	config.Embedder.CacheTTL = DefaultEmbedderCacheTTL
+	config.Embedder.Input = DefaultEmbedderInput
 	config.Logging.Level = DefaultLogLevel
 	config.Logging.Format = DefaultLogFormat
 	return config
@@ -148,11 +701,37 @@ func LoadConfigWithPath(configPath string) (*Config, error) {
 	return cfg, nil
 }
 
+// Clone returns a deep copy of the configuration, sharing no maps or
+// slices with it
+func (c *Config) Clone() *Config {
+	clone := *c
+	clone.Store.EncryptedNamespaces = maps.Clone(c.Store.EncryptedNamespaces)
+	clone.Summarizer.ApiKeys = slices.Clone(c.Summarizer.ApiKeys)
+	clone.Summarizer.Pricing = maps.Clone(c.Summarizer.Pricing)
+	clone.Summarizer.Fallbacks = slices.Clone(c.Summarizer.Fallbacks)
+	for i := range clone.Summarizer.Fallbacks {
+		clone.Summarizer.Fallbacks[i].ApiKeys = slices.Clone(c.Summarizer.Fallbacks[i].ApiKeys)
+	}
+	clone.Embedder.Fallbacks = slices.Clone(c.Embedder.Fallbacks)
+	clone.Retrieval.Namespaces = maps.Clone(c.Retrieval.Namespaces)
+	clone.Tools.Disabled = slices.Clone(c.Tools.Disabled)
+	clone.Watch.Paths = slices.Clone(c.Watch.Paths)
+	clone.Watch.Extensions = slices.Clone(c.Watch.Extensions)
+	clone.Auth.APIKeys = slices.Clone(c.Auth.APIKeys)
+	for i := range clone.Auth.APIKeys {
+		clone.Auth.APIKeys[i].Namespaces = slices.Clone(c.Auth.APIKeys[i].Namespaces)
+	}
+	if c.Auth.TLS.ClientNamespaces != nil {
+		clone.Auth.TLS.ClientNamespaces = make(map[string][]string, len(c.Auth.TLS.ClientNamespaces))
+		for subject, namespaces := range c.Auth.TLS.ClientNamespaces {
+			clone.Auth.TLS.ClientNamespaces[subject] = slices.Clone(namespaces)
+		}
+	}
+	return &clone
+}
+
 // SaveToFile saves the configuration to the specified file
 func (c *Config) SaveToFile(path string) error {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-
 	// Create directory if needed
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0755); err != nil {
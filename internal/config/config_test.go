@@ -0,0 +1,169 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestLoadConfigRejectsOversizedDimensions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{"store": {"sqlite_path": "test.db"}, "embedder": {"dimensions": 100000000}, "logging": {"level": "info"}}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	if _, err := LoadConfigWithPath(path); err == nil {
+		t.Error("Expected validation error for oversized dimensions")
+	}
+}
+
+// fullConfig is a config file setting every map and slice
+const fullConfig = `{
+	"store": {"sqlite_path": "test.db", "encrypted_namespaces": {"team": "key-1"}},
+	"summarizer": {
+		"provider": "ai",
+		"api_keys": ["a", "b"],
+		"pricing": {"gpt-4o": {"input": 2.5, "output": 10}},
+		"fallbacks": [{"provider": "openai", "api_keys": ["c"]}]
+	},
+	"embedder": {"provider": "mock", "dimensions": 8, "fallbacks": [{"provider": "mock"}]},
+	"retrieval": {"namespaces": {"team": {"limit": 3}}},
+	"auth": {
+		"api_keys": [{"key": "k", "subject": "ci", "namespaces": ["team"]}],
+		"tls": {"client_namespaces": {"indexer": ["team"]}}
+	},
+	"logging": {"level": "info"}
+}`
+
+func TestClone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(fullConfig), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	cfg, err := LoadConfigWithPath(path)
+	if err != nil {
+		t.Fatalf("LoadConfigWithPath() error = %v", err)
+	}
+
+	clone := cfg.Clone()
+	if !reflect.DeepEqual(clone, cfg) {
+		t.Fatalf("Clone() = %+v, want %+v", clone, cfg)
+	}
+	if shared := sharedReferences(reflect.ValueOf(cfg).Elem(), reflect.ValueOf(clone).Elem(), "Config"); len(shared) > 0 {
+		t.Errorf("Clone() shares %v with the original", shared)
+	}
+
+	clone.Summarizer.Fallbacks[0].ApiKeys[0] = "changed"
+	clone.Store.EncryptedNamespaces["other"] = "key-2"
+	clone.Auth.TLS.ClientNamespaces["indexer"][0] = "changed"
+	if cfg.Summarizer.Fallbacks[0].ApiKeys[0] != "c" || len(cfg.Store.EncryptedNamespaces) != 1 || cfg.Auth.TLS.ClientNamespaces["indexer"][0] != "team" {
+		t.Errorf("Changing the clone changed the original: %+v", cfg)
+	}
+}
+
+// sharedReferences returns the paths of the non-empty maps and slices that
+// a and b share
+func sharedReferences(a, b reflect.Value, path string) []string {
+	var shared []string
+	switch a.Kind() {
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			shared = append(shared, sharedReferences(a.Field(i), b.Field(i), path+"."+a.Type().Field(i).Name)...)
+		}
+	case reflect.Slice:
+		if a.Len() > 0 && a.Pointer() == b.Pointer() {
+			shared = append(shared, path)
+		}
+		for i := 0; i < min(a.Len(), b.Len()); i++ {
+			shared = append(shared, sharedReferences(a.Index(i), b.Index(i), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case reflect.Map:
+		if a.Len() > 0 && a.Pointer() == b.Pointer() {
+			shared = append(shared, path)
+		}
+	}
+	return shared
+}
+
+// TestConcurrentConfigs loads, changes and saves configs from many
+// goroutines at once. Run with -race, it checks that they share no state.
+func TestConcurrentConfigs(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte(fullConfig), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	shared, err := LoadConfigWithPath(path)
+	if err != nil {
+		t.Fatalf("LoadConfigWithPath() error = %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			loaded, err := LoadConfigWithPath(path)
+			if err != nil {
+				errs <- err
+				return
+			}
+			for j, cfg := range []*Config{loaded, shared.Clone()} {
+				cfg.Store.SQLitePath = fmt.Sprintf("instance-%d.db", i)
+				cfg.Summarizer.ApiKeys[0] = fmt.Sprintf("key-%d", i)
+				target := filepath.Join(dir, fmt.Sprintf("config-%d-%d.json", i, j))
+				if err := cfg.SaveToFile(target); err != nil {
+					errs <- err
+					return
+				}
+				if cfg.GetConfigPath() != target {
+					errs <- fmt.Errorf("GetConfigPath() = %q, want %q", cfg.GetConfigPath(), target)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if shared.Store.SQLitePath != "test.db" || shared.Summarizer.ApiKeys[0] != "a" || shared.GetConfigPath() != path {
+		t.Errorf("Changing clones changed the shared config: %+v", shared)
+	}
+}
+
+// FuzzLoadConfigWithPath loads arbitrary config file contents. Loading must
+// never panic, and any config that loads must satisfy its validation tags.
+func FuzzLoadConfigWithPath(f *testing.F) {
+	f.Add([]byte(`{"store": {"sqlite_path": ".projectmemory.db"}, "embedder": {"provider": "mock", "dimensions": 768}, "logging": {"level": "info"}}`))
+	f.Add([]byte(`{"embedder": {"dimensions": -1}}`))
+	f.Add([]byte(`{"store": null}`))
+	f.Add([]byte(`[]`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		cfg, err := LoadConfigWithPath(path)
+		if err != nil {
+			return
+		}
+
+		if cfg.Store.SQLitePath == "" {
+			t.Error("Loaded config has empty sqlite_path")
+		}
+		if cfg.Embedder.Dimensions < 1 || cfg.Embedder.Dimensions > 65536 {
+			t.Errorf("Loaded config has out of range dimensions %d", cfg.Embedder.Dimensions)
+		}
+		if cfg.Logging.Level == "" {
+			t.Error("Loaded config has empty logging level")
+		}
+	})
+}
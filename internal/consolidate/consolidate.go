@@ -0,0 +1,354 @@
+// Package consolidate merges clusters of highly similar entries into single
+// consolidated entries. Agents save the same decisions and conventions again
+// and again over weeks of use; each cluster of near-identical entries is
+// merged by an LLM into one entry that replaces them, recording them in its
+// provenance and taking over their tags and relations.
+package consolidate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/summarizer/providers"
+	"github.com/localrivet/projectmemory/internal/util"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+const (
+	// DefaultThreshold is the cosine similarity every two entries of a
+	// cluster reach when Options.Threshold is 0
+	DefaultThreshold = 0.92
+
+	// DefaultMaxClusterSize is the most entries merged into one when
+	// Options.MaxClusterSize is 0. Larger clusters are split.
+	DefaultMaxClusterSize = 8
+)
+
+// ErrEmptyMerge is returned when the model's answer holds no merged entry.
+var ErrEmptyMerge = errors.New("consolidation answer holds no merged entry")
+
+// Merger merges the summaries of similar entries into one
+type Merger interface {
+	// Merge returns one summary holding what texts, oldest first, say
+	Merge(ctx context.Context, texts []string) (string, error)
+}
+
+// LLMMerger is a Merger asking an LLM provider for the merged summary
+type LLMMerger struct {
+	provider providers.Completer
+}
+
+// NewLLMMerger creates a merger asking provider
+func NewLLMMerger(provider providers.Completer) *LLMMerger {
+	return &LLMMerger{provider: provider}
+}
+
+// Merge implements Merger. It returns an error wrapping ErrEmptyMerge if
+// the model's answer is blank.
+func (m *LLMMerger) Merge(ctx context.Context, texts []string) (string, error) {
+	answer, err := m.provider.Complete(ctx, prompt(texts))
+	if err != nil {
+		return "", err
+	}
+	merged := strings.TrimSpace(answer)
+	if merged == "" {
+		return "", ErrEmptyMerge
+	}
+	return merged, nil
+}
+
+// prompt returns the prompt asking to merge texts
+func prompt(texts []string) string {
+	var b strings.Builder
+	b.WriteString("You maintain the memory of a software project: notes on its decisions, conventions and past work. " +
+		"The notes below, oldest first, say much the same thing.\n\n")
+	for i, text := range texts {
+		fmt.Fprintf(&b, "Note %d:\n%s\n\n", i+1, strings.TrimSpace(text))
+	}
+	b.WriteString("Merge them into one note that keeps every distinct fact, decision and detail once. Where the " +
+		"notes disagree, keep what the newest says. Do not add anything they do not say. Answer with the note only.")
+	return b.String()
+}
+
+// Options control a run. The zero value merges clusters of every namespace
+// with DefaultThreshold and DefaultMaxClusterSize.
+type Options struct {
+	// Threshold is the cosine similarity every two entries of a cluster
+	// reach, DefaultThreshold if 0
+	Threshold float64
+
+	// MaxClusterSize is the most entries merged into one,
+	// DefaultMaxClusterSize if 0. It is capped at contextstore.MaxProvenance
+	// so the consolidated entry's provenance names every entry it replaces.
+	MaxClusterSize int
+
+	// Namespace restricts the run to one namespace, every namespace if empty
+	Namespace string
+
+	// DryRun finds the clusters without merging them
+	DryRun bool
+
+	// Progress, if set, is called after each cluster
+	Progress func(Report)
+}
+
+// Cluster is a group of highly similar entries of one namespace
+type Cluster struct {
+	Namespace string
+
+	// IDs are the entries' IDs, oldest first
+	IDs []string
+
+	// Consolidated is the ID of the entry that replaced them, empty if they
+	// were not merged
+	Consolidated string
+}
+
+// Report lists the clusters of a run
+type Report struct {
+	// Clusters are the clusters found, oldest first
+	Clusters []Cluster
+
+	// Consolidated clusters were merged; their Entries were replaced.
+	// Failed clusters could not be merged or embedded and were kept.
+	Consolidated int
+	Entries      int
+	Failed       int
+}
+
+// Run finds the clusters of similar entries in store and merges each with
+// merger into one entry that replaces them. Pinned entries are left alone.
+// Errors merging or embedding a cluster are counted in the report; store
+// errors and cancellation of ctx stop the run. It returns
+// contextstore.ErrUsageUnsupported if the store cannot list its entries.
+func Run(ctx context.Context, store contextstore.ContextStore, merger Merger, embedder vector.Embedder, options Options) (Report, error) {
+	lister, ok := store.(contextstore.UsageStore)
+	if !ok {
+		return Report{}, contextstore.ErrUsageUnsupported
+	}
+	threshold := options.Threshold
+	if threshold <= 0 {
+		threshold = DefaultThreshold
+	}
+	maxSize := options.MaxClusterSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxClusterSize
+	}
+	maxSize = min(maxSize, contextstore.MaxProvenance)
+
+	entries, err := lister.ListEntries()
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to list entries: %w", err)
+	}
+	candidates := entries[:0]
+	for _, entry := range entries {
+		if !entry.Pinned && (options.Namespace == "" || entry.Namespace == options.Namespace) {
+			candidates = append(candidates, entry)
+		}
+	}
+
+	var report Report
+	clusters := findClusters(candidates, threshold, maxSize)
+	for _, cluster := range clusters {
+		report.Clusters = append(report.Clusters, Cluster{Namespace: cluster[0].Namespace, IDs: clusterIDs(cluster)})
+	}
+	if options.DryRun {
+		return report, nil
+	}
+
+	for i, cluster := range clusters {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		id, err := consolidate(ctx, store, merger, embedder, cluster)
+		if err != nil {
+			return report, err
+		}
+		if id == "" {
+			report.Failed++
+		} else {
+			report.Clusters[i].Consolidated = id
+			report.Consolidated++
+			report.Entries += len(cluster)
+		}
+		if options.Progress != nil {
+			options.Progress(report)
+		}
+	}
+	return report, nil
+}
+
+// findClusters groups entries, oldest first, into clusters of up to maxSize
+// entries of one namespace whose every two embeddings reach threshold. Each
+// entry starts a cluster with the newer entries similar to all its members;
+// entries left alone are not returned.
+func findClusters(entries []contextstore.Entry, threshold float64, maxSize int) [][]contextstore.Entry {
+	norms := make([]float64, len(entries))
+	for i, entry := range entries {
+		norms[i] = vector.Norm(entry.Embedding)
+	}
+	similar := func(i, j int) bool {
+		// Entries with mismatched dimensions or zero norms are never similar
+		similarity, err := vector.CosineSimilarityWithNorms(entries[i].Embedding, entries[j].Embedding, norms[i], norms[j])
+		return err == nil && similarity >= threshold
+	}
+
+	var clusters [][]contextstore.Entry
+	clustered := make([]bool, len(entries))
+	for i := range entries {
+		if clustered[i] {
+			continue
+		}
+		members := []int{i}
+		for j := i + 1; j < len(entries) && len(members) < maxSize; j++ {
+			if clustered[j] || entries[j].Namespace != entries[i].Namespace {
+				continue
+			}
+			if !slices.ContainsFunc(members, func(member int) bool { return !similar(member, j) }) {
+				members = append(members, j)
+			}
+		}
+		if len(members) < 2 {
+			continue
+		}
+		cluster := make([]contextstore.Entry, len(members))
+		for k, member := range members {
+			clustered[member] = true
+			cluster[k] = entries[member]
+		}
+		clusters = append(clusters, cluster)
+	}
+	return clusters
+}
+
+// clusterIDs returns the IDs of the entries of cluster
+func clusterIDs(cluster []contextstore.Entry) []string {
+	ids := make([]string, len(cluster))
+	for i, entry := range cluster {
+		ids[i] = entry.ID
+	}
+	return ids
+}
+
+// consolidate merges cluster, oldest first, into a new entry stored at the
+// time of its newest entry, then deletes the cluster's entries. It returns
+// the new entry's ID, or "" if the cluster could not be merged or embedded.
+// Only store errors are returned.
+func consolidate(ctx context.Context, store contextstore.ContextStore, merger Merger, embedder vector.Embedder, cluster []contextstore.Entry) (string, error) {
+	texts := make([]string, len(cluster))
+	for i, entry := range cluster {
+		texts[i] = entry.SummaryText
+	}
+	summary, err := merger.Merge(ctx, texts)
+	if err != nil || strings.TrimSpace(summary) == "" {
+		return "", nil
+	}
+
+	// A fallback embedding would not be comparable with the rest of the
+	// index, so the cluster is left for a later run
+	embedding, err := vector.CreateEmbeddingContext(ctx, embedder, summary)
+	if err != nil || embedding.Fallback {
+		return "", nil
+	}
+	embeddingBytes, err := vector.Float32SliceToBytes(embedding.Vector)
+	if err != nil {
+		return "", nil
+	}
+
+	newest := cluster[len(cluster)-1]
+	id := util.GenerateHash(summary, newest.Timestamp.UnixNano())
+	namespaced, ok := store.(contextstore.NamespacedStore)
+	if ok && newest.Namespace != "" && newest.Namespace != contextstore.DefaultNamespace {
+		err = namespaced.StoreInNamespace(newest.Namespace, id, summary, embeddingBytes, newest.Timestamp)
+	} else {
+		err = store.Store(id, summary, embeddingBytes, newest.Timestamp)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to store consolidated entry: %w", err)
+	}
+	if err := inherit(store, id, cluster); err != nil {
+		return "", fmt.Errorf("failed to consolidate entry %s: %w", id, err)
+	}
+
+	// A merge repeating the newest entry word for word replaced it in place
+	for _, entry := range cluster {
+		if entry.ID == id {
+			continue
+		}
+		if err := store.Delete(entry.ID); err != nil {
+			return "", fmt.Errorf("failed to delete consolidated entry %s: %w", entry.ID, err)
+		}
+	}
+	return id, nil
+}
+
+// inherit records the entries of cluster in the provenance of the entry id
+// and gives it their tags and their relations with entries outside the
+// cluster, as far as the store supports them
+func inherit(store contextstore.ContextStore, id string, cluster []contextstore.Entry) error {
+	if provenance, ok := store.(contextstore.ProvenanceStore); ok {
+		sources := make([]string, len(cluster))
+		for i, entry := range cluster {
+			sources[i] = contextstore.SourceConsolidated + ":" + entry.ID
+		}
+		if err := provenance.SetProvenance(id, contextstore.AppendProvenance(nil, sources...)); err != nil {
+			return err
+		}
+	}
+
+	if tagged, ok := store.(contextstore.TaggedStore); ok {
+		var tags []string
+		for _, entry := range cluster {
+			entryTags, err := tagged.GetTags(entry.ID)
+			if err != nil {
+				return err
+			}
+			tags = append(tags, entryTags...)
+		}
+		slices.Sort(tags)
+		if tags = slices.Compact(tags); len(tags) > 0 {
+			if err := tagged.SetTags(id, tags); err != nil {
+				return err
+			}
+		}
+	}
+
+	relations, ok := store.(contextstore.RelationStore)
+	if !ok {
+		return nil
+	}
+	members := make(map[string]bool, len(cluster))
+	for _, entry := range cluster {
+		members[entry.ID] = true
+	}
+	for _, entry := range cluster {
+		related, err := relations.ListRelations(entry.ID)
+		if err != nil {
+			return err
+		}
+		for _, other := range related {
+			if members[other.ID] {
+				continue
+			}
+			relation := other.Relation
+			if relation.EntryID == entry.ID {
+				relation.EntryID = id
+			} else {
+				relation.RelatedID = id
+			}
+			if err := relations.Link(relation); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// String describes the report in one line
+func (r Report) String() string {
+	return fmt.Sprintf("%d clusters: %d consolidated, replacing %d entries, %d failed", len(r.Clusters), r.Consolidated, r.Entries, r.Failed)
+}
@@ -0,0 +1,151 @@
+package consolidate
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/summarizer/providers"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+func TestLLMMerger(t *testing.T) {
+	provider := &providers.AnswerCompleter{Answer: "\n We deploy with Helm from CI. \n"}
+	got, err := NewLLMMerger(provider).Merge(context.Background(), []string{"Deploys use Helm.", "We deploy from CI."})
+	if err != nil || got != "We deploy with Helm from CI." {
+		t.Fatalf("Merge() = %q, %v", got, err)
+	}
+	if !strings.Contains(provider.Prompt, "Note 1:\nDeploys use Helm.\n") || !strings.Contains(provider.Prompt, "Note 2:\nWe deploy from CI.\n") {
+		t.Errorf("Expected the prompt to list the notes in order, got:\n%s", provider.Prompt)
+	}
+
+	if _, err := NewLLMMerger(&providers.AnswerCompleter{Answer: " \n "}).Merge(context.Background(), []string{"a", "b"}); !errors.Is(err, ErrEmptyMerge) {
+		t.Errorf("Expected ErrEmptyMerge, got %v", err)
+	}
+	failure := errors.New("rate limited")
+	if _, err := NewLLMMerger(&providers.AnswerCompleter{Err: failure}).Merge(context.Background(), []string{"a", "b"}); !errors.Is(err, failure) {
+		t.Errorf("Expected the provider's error, got %v", err)
+	}
+}
+
+func TestFindClusters(t *testing.T) {
+	entries := []contextstore.Entry{
+		{ID: "a", Embedding: []float32{1, 0, 0}, Namespace: "default"},
+		{ID: "b", Embedding: []float32{0, 1, 0}, Namespace: "default"},
+		{ID: "c", Embedding: []float32{0.99, 0.1, 0}, Namespace: "default"},
+		{ID: "d", Embedding: []float32{1, 0, 0}, Namespace: "work"},
+		{ID: "e", Embedding: []float32{0.9, 0.44, 0}, Namespace: "default"},
+		{ID: "f", Embedding: []float32{1, 0.01, 0}, Namespace: "default"},
+		{ID: "g", Embedding: []float32{1, 0, 0.01}, Namespace: "default"},
+	}
+
+	// e is close to c but not to a, and g is past the size limit
+	clusters := findClusters(entries, 0.95, 3)
+	var got []string
+	for _, cluster := range clusters {
+		got = append(got, strings.Join(clusterIDs(cluster), " "))
+	}
+	if strings.Join(got, ", ") != "a c f" {
+		t.Errorf("findClusters() = %q, want a c f", got)
+	}
+}
+
+// fakeMerger joins the texts it merges, or fails for texts containing
+// "fail"
+type fakeMerger struct{}
+
+func (fakeMerger) Merge(_ context.Context, texts []string) (string, error) {
+	for _, text := range texts {
+		if strings.Contains(text, "fail") {
+			return "", errors.New("provider unavailable")
+		}
+	}
+	return "Merged: " + strings.Join(texts, " / "), nil
+}
+
+func TestRun(t *testing.T) {
+	store := contextstore.NewMemoryContextStore()
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	for i, entry := range []struct {
+		id, text  string
+		embedding []float32
+	}{
+		{"a", "Deploys use Helm", []float32{1, 0, 0}},
+		{"b", "Tests run in CI", []float32{0, 1, 0}},
+		{"c", "We deploy with Helm", []float32{0.99, 0.05, 0}},
+		{"d", "Please fail", []float32{0, 0, 1}},
+		{"e", "Please fail too", []float32{0, 0.05, 0.99}},
+		{"f", "Pinned deploy note", []float32{1, 0, 0}},
+	} {
+		data, err := vector.Float32SliceToBytes(entry.embedding)
+		if err != nil {
+			t.Fatalf("Failed to encode embedding: %v", err)
+		}
+		if err := store.Store(entry.id, entry.text, data, start.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatalf("Failed to store entry: %v", err)
+		}
+	}
+	if err := store.SetPinned("f", true); err != nil {
+		t.Fatalf("Failed to pin entry: %v", err)
+	}
+	if err := store.SetTags("a", []string{"deploy"}); err != nil {
+		t.Fatalf("Failed to tag entry: %v", err)
+	}
+	if err := store.SetTags("c", []string{"deploy", "helm"}); err != nil {
+		t.Fatalf("Failed to tag entry: %v", err)
+	}
+	if err := store.Link(contextstore.Relation{EntryID: "b", RelatedID: "c", Type: contextstore.RelationElaborates, CreatedAt: start}); err != nil {
+		t.Fatalf("Failed to link entries: %v", err)
+	}
+
+	report, err := Run(context.Background(), store, fakeMerger{}, vector.NewMockEmbedder(8), Options{DryRun: true})
+	if err != nil || len(report.Clusters) != 2 || report.Consolidated != 0 {
+		t.Fatalf("Run(dry run) = %+v, %v; want 2 clusters and nothing consolidated", report, err)
+	}
+	if entries, _ := store.ListEntries(); len(entries) != 6 {
+		t.Fatalf("Expected a dry run to keep every entry, got %d", len(entries))
+	}
+
+	report, err = Run(context.Background(), store, fakeMerger{}, vector.NewMockEmbedder(8), Options{})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if report.Consolidated != 1 || report.Entries != 2 || report.Failed != 1 {
+		t.Fatalf("Run() = %+v, want 1 cluster of 2 consolidated and 1 failed", report)
+	}
+	id := report.Clusters[0].Consolidated
+	if strings.Join(report.Clusters[0].IDs, " ") != "a c" || id == "" || report.Clusters[1].Consolidated != "" {
+		t.Fatalf("Expected a and c consolidated, got %+v", report.Clusters)
+	}
+
+	entries, err := store.ListEntries()
+	if err != nil {
+		t.Fatalf("Failed to list entries: %v", err)
+	}
+	var ids []string
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+		if entry.ID != id {
+			continue
+		}
+		if entry.SummaryText != "Merged: Deploys use Helm / We deploy with Helm" || !entry.Timestamp.Equal(start.Add(2*time.Hour)) {
+			t.Errorf("Consolidated entry = %q at %v", entry.SummaryText, entry.Timestamp)
+		}
+		if strings.Join(entry.Provenance, " ") != "consolidated:a consolidated:c" {
+			t.Errorf("Consolidated provenance = %q", entry.Provenance)
+		}
+	}
+	if strings.Join(ids, " ") != "b "+id+" d e f" {
+		t.Errorf("Expected a and c replaced, got %q", ids)
+	}
+	if tags, _ := store.GetTags(id); strings.Join(tags, " ") != "deploy helm" {
+		t.Errorf("Expected the tags of a and c, got %q", tags)
+	}
+	related, err := store.ListRelations("b")
+	if err != nil || len(related) != 1 || related[0].RelatedID != id || related[0].Type != contextstore.RelationElaborates {
+		t.Errorf("Expected b to elaborate the consolidated entry, got %+v, %v", related, err)
+	}
+}
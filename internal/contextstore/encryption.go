@@ -0,0 +1,193 @@
+package contextstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MasterKeySize is the size in bytes of a master key and of a data key
+const MasterKeySize = 32
+
+// sealedPrefix starts every encrypted summary
+const sealedPrefix = "enc1:"
+
+var (
+	// ErrNamespaceLocked is returned when entries are written to or exported
+	// from a namespace whose data key is wrapped by a master key that is not
+	// loaded. Searches and listings skip such entries instead.
+	ErrNamespaceLocked = errors.New("namespace is encrypted with a master key that is not loaded")
+
+	// ErrEncryptionUnsupported is returned when namespaces are encrypted in a
+	// store that cannot encrypt entries.
+	ErrEncryptionUnsupported = errors.New("store does not support encrypted namespaces")
+)
+
+// Keyring holds the master keys of a server and the namespaces it encrypts.
+// Each encrypted namespace has its own random data key, stored in the
+// database wrapped by one master key, so a shared database can hold
+// namespaces that only the holders of their master key can read.
+type Keyring struct {
+	masters map[string]cipher.AEAD
+
+	// namespaces maps each encrypted namespace to the ID of the master key
+	// wrapping its data key when one is created
+	namespaces map[string]string
+}
+
+// NewKeyring returns a keyring holding the given master keys, keyed by ID,
+// that encrypts each namespace in namespaces with a data key wrapped by the
+// master key it maps to. Master keys must be MasterKeySize bytes.
+func NewKeyring(masterKeys map[string][]byte, namespaces map[string]string) (*Keyring, error) {
+	keyring := &Keyring{
+		masters:    make(map[string]cipher.AEAD, len(masterKeys)),
+		namespaces: make(map[string]string, len(namespaces)),
+	}
+	for id, key := range masterKeys {
+		if id == "" {
+			return nil, errors.New("master key ID must not be empty")
+		}
+		if len(key) != MasterKeySize {
+			return nil, fmt.Errorf("master key %s is %d bytes, want %d", id, len(key), MasterKeySize)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid master key %s: %w", id, err)
+		}
+		keyring.masters[id] = aead
+	}
+	for namespace, masterID := range namespaces {
+		if _, ok := keyring.masters[masterID]; !ok {
+			return nil, fmt.Errorf("namespace %s is encrypted with master key %q, which is not loaded", namespace, masterID)
+		}
+		keyring.namespaces[namespace] = masterID
+	}
+	return keyring, nil
+}
+
+// ParseMasterKeys parses comma-separated "id:key" pairs, where each key is
+// MasterKeySize bytes encoded in standard base64.
+func ParseMasterKeys(pairs string) (map[string][]byte, error) {
+	keys := make(map[string][]byte)
+	for _, pair := range strings.Split(pairs, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		id, encoded, found := strings.Cut(pair, ":")
+		if !found {
+			return nil, fmt.Errorf("master key %q must be written as id:base64", pair)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("master key %s is not valid base64: %w", id, err)
+		}
+		keys[strings.TrimSpace(id)] = key
+	}
+	return keys, nil
+}
+
+// Namespaces returns the namespaces the keyring encrypts, sorted.
+func (k *Keyring) Namespaces() []string {
+	namespaces := make([]string, 0, len(k.namespaces))
+	for namespace := range k.namespaces {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// newDataKey creates a data key for namespace and returns it with the ID of
+// the master key that wrapped it and the wrapped key
+func (k *Keyring) newDataKey(namespace string) (cipher.AEAD, string, []byte, error) {
+	masterID := k.namespaces[namespace]
+	master := k.masters[masterID]
+
+	key := make([]byte, MasterKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, "", nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return aead, masterID, sealBytes(master, key, []byte(namespace)), nil
+}
+
+// unwrap returns the data key of namespace wrapped by the master key
+// masterID, or ErrNamespaceLocked if that key is not loaded. A nil keyring
+// holds no keys.
+func (k *Keyring) unwrap(namespace, masterID string, wrapped []byte) (cipher.AEAD, error) {
+	var master cipher.AEAD
+	if k != nil {
+		master = k.masters[masterID]
+	}
+	if master == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNamespaceLocked, namespace)
+	}
+	key, err := openBytes(master, wrapped, []byte(namespace))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key of %s with master key %s: %w", namespace, masterID, err)
+	}
+	return newAEAD(key)
+}
+
+// sealSummary encrypts the summary of entry id in namespace. The ciphertext
+// is bound to both, so it cannot be moved to another entry.
+func sealSummary(key cipher.AEAD, namespace, id, summary string) string {
+	sealed := sealBytes(key, []byte(summary), entryData(namespace, id))
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed)
+}
+
+// openSummary decrypts a summary sealed by sealSummary
+func openSummary(key cipher.AEAD, namespace, id, sealed string) (string, error) {
+	encoded, found := strings.CutPrefix(sealed, sealedPrefix)
+	if !found {
+		return "", fmt.Errorf("summary of entry %s is not encrypted", id)
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode summary of entry %s: %w", id, err)
+	}
+	summary, err := openBytes(key, data, entryData(namespace, id))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt summary of entry %s: %w", id, err)
+	}
+	return string(summary), nil
+}
+
+// entryData is the additional data authenticated with an entry's summary
+func entryData(namespace, id string) []byte {
+	return []byte(namespace + "\x00" + id)
+}
+
+// newAEAD returns AES-256-GCM with key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealBytes encrypts plaintext with a random nonce, which prefixes the result
+func sealBytes(aead cipher.AEAD, plaintext, data []byte) []byte {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		// crypto/rand never fails on supported platforms
+		panic(fmt.Sprintf("failed to generate nonce: %v", err))
+	}
+	return aead.Seal(nonce, nonce, plaintext, data)
+}
+
+// openBytes decrypts the result of sealBytes
+func openBytes(aead cipher.AEAD, sealed, data []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], data)
+}
@@ -0,0 +1,308 @@
+package contextstore
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileFlushInterval is how often FileContextStore writes its changes to
+// disk. Changes made since the last write are also written by Flush and
+// Close.
+const FileFlushInterval = time.Second
+
+// fileStoreFormat is the version of the file FileContextStore writes.
+// Files of other versions are refused rather than misread.
+const fileStoreFormat = 1
+
+// sqliteHeader starts every SQLite database file
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// ErrFileStoreFormat is returned when FileContextStore is initialized with
+// a file it did not write, or wrote in a format it cannot read
+var ErrFileStoreFormat = errors.New("not a context store file")
+
+// FileContextStore is a MemoryContextStore kept in a file. It needs no
+// cgo, so it stands in for SQLiteContextStore in builds without SQLite,
+// such as static binaries for musl and ARM systems. The whole store is
+// held in memory and written to the file, replacing it, within
+// FileFlushInterval of a change; changes since the last write are lost
+// if the process dies. It supports everything MemoryContextStore does.
+type FileContextStore struct {
+	*MemoryContextStore
+
+	path string
+
+	// saveMu serializes writes of the file. saved is the write count of
+	// the MemoryContextStore when it was last written.
+	saveMu sync.Mutex
+	saved  uint64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewFileContextStore creates a new FileContextStore instance.
+func NewFileContextStore() *FileContextStore {
+	return &FileContextStore{MemoryContextStore: NewMemoryContextStore()}
+}
+
+// Initialize loads the store from the file at path, which is created on
+// the first write if it does not exist, and starts writing changes to it.
+func (s *FileContextStore) Initialize(path string) error {
+	if path == "" {
+		return errors.New("file store path is empty")
+	}
+	if err := s.MemoryContextStore.Initialize(path); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("failed to read context store file: %w", err)
+	default:
+		if err := s.load(data); err != nil {
+			return fmt.Errorf("failed to load %s: %w", path, err)
+		}
+	}
+
+	s.MemoryContextStore.mu.RLock()
+	s.saved = s.MemoryContextStore.mu.writes
+	s.MemoryContextStore.mu.RUnlock()
+	s.path = path
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.flushEvery(FileFlushInterval)
+	return nil
+}
+
+// Flush writes the store to its file if it changed since it was last
+// written.
+func (s *FileContextStore) Flush() error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	if s.path == "" {
+		return errors.New("file store is not initialized")
+	}
+	data, writes, err := s.encode()
+	if err != nil || writes == s.saved {
+		return err
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("failed to write context store file: %w", err)
+	}
+	s.saved = writes
+	return nil
+}
+
+// Close stops writing changes in the background and writes the changes
+// left.
+func (s *FileContextStore) Close() error {
+	if s.stop == nil {
+		return nil
+	}
+	close(s.stop)
+	<-s.done
+	s.stop = nil
+	return s.Flush()
+}
+
+// flushEvery writes changes every interval until the store is closed.
+// A failed write is retried at the next tick, and reported by Close.
+func (s *FileContextStore) flushEvery(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.Flush()
+		}
+	}
+}
+
+// fileState is the content of a FileContextStore file
+type fileState struct {
+	Format      int
+	Entries     map[string]fileEntry
+	Cleared     map[string]fileEntry
+	Quarantined map[string]fileEntry
+	Gaps        []Gap
+	Reviews     []Review
+	Relations   []Relation
+}
+
+// fileEntry is a memoryEntry in a file. ClearedAt is only set for cleared
+// entries and Provider for quarantined ones.
+type fileEntry struct {
+	SummaryText   string
+	Embedding     []byte
+	Timestamp     time.Time
+	Tags          []string
+	Provenance    []string
+	Generation    Generation
+	Title         string
+	References    []Reference
+	Batch         string
+	Session       string
+	PinnedAt      time.Time
+	Namespace     string
+	Retrievals    int
+	LastRetrieved time.Time
+	ClearedAt     time.Time
+	Provider      string
+}
+
+// newFileEntry returns the file form of e
+func newFileEntry(e memoryEntry) fileEntry {
+	return fileEntry{
+		SummaryText:   e.summaryText,
+		Embedding:     e.embedding,
+		Timestamp:     e.timestamp,
+		Tags:          e.tags,
+		Provenance:    e.provenance,
+		Generation:    e.generation,
+		Title:         e.title,
+		References:    e.references,
+		Batch:         e.batch,
+		Session:       e.session,
+		PinnedAt:      e.pinnedAt,
+		Namespace:     e.namespace,
+		Retrievals:    e.retrievals,
+		LastRetrieved: e.lastRetrieved,
+	}
+}
+
+// memoryEntry returns the entry read from a file, with its norm
+func (e fileEntry) memoryEntry() memoryEntry {
+	norm, _ := embeddingNorm(e.Embedding)
+	return memoryEntry{
+		summaryText:   e.SummaryText,
+		embedding:     e.Embedding,
+		timestamp:     e.Timestamp,
+		tags:          e.Tags,
+		provenance:    e.Provenance,
+		generation:    e.Generation,
+		title:         e.Title,
+		references:    e.References,
+		batch:         e.Batch,
+		session:       e.Session,
+		pinnedAt:      e.PinnedAt,
+		namespace:     e.Namespace,
+		retrievals:    e.Retrievals,
+		lastRetrieved: e.LastRetrieved,
+		norm:          norm,
+	}
+}
+
+// encode returns the store's file content and its write count
+func (s *FileContextStore) encode() ([]byte, uint64, error) {
+	m := s.MemoryContextStore
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	state := fileState{
+		Format:      fileStoreFormat,
+		Entries:     make(map[string]fileEntry, len(m.entries)),
+		Cleared:     make(map[string]fileEntry, len(m.cleared)),
+		Quarantined: make(map[string]fileEntry, len(m.quarantined)),
+		Gaps:        make([]Gap, 0, len(m.gaps)),
+		Reviews:     m.reviews,
+		Relations:   m.relations,
+	}
+	for id, entry := range m.entries {
+		state.Entries[id] = newFileEntry(entry)
+	}
+	for id, entry := range m.cleared {
+		cleared := newFileEntry(entry.memoryEntry)
+		cleared.ClearedAt = entry.clearedAt
+		state.Cleared[id] = cleared
+	}
+	for id, entry := range m.quarantined {
+		quarantined := newFileEntry(entry.memoryEntry)
+		quarantined.Provider = entry.provider
+		state.Quarantined[id] = quarantined
+	}
+	for _, gap := range m.gaps {
+		state.Gaps = append(state.Gaps, gap)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(state); err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), m.mu.writes, nil
+}
+
+// load replaces the store's content with the file content data
+func (s *FileContextStore) load(data []byte) error {
+	if bytes.HasPrefix(data, sqliteHeader) {
+		return fmt.Errorf("%w: it is a SQLite database", ErrFileStoreFormat)
+	}
+	var state fileState
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); err != nil {
+		return fmt.Errorf("%w: %v", ErrFileStoreFormat, err)
+	}
+	if state.Format != fileStoreFormat {
+		return fmt.Errorf("%w: unknown format %d", ErrFileStoreFormat, state.Format)
+	}
+
+	m := s.MemoryContextStore
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries = make(map[string]memoryEntry, len(state.Entries))
+	for id, entry := range state.Entries {
+		m.entries[id] = entry.memoryEntry()
+	}
+	m.cleared = make(map[string]clearedEntry, len(state.Cleared))
+	for id, entry := range state.Cleared {
+		m.cleared[id] = clearedEntry{memoryEntry: entry.memoryEntry(), clearedAt: entry.ClearedAt}
+	}
+	m.quarantined = make(map[string]quarantinedEntry, len(state.Quarantined))
+	for id, entry := range state.Quarantined {
+		m.quarantined[id] = quarantinedEntry{memoryEntry: entry.memoryEntry(), provider: entry.Provider}
+	}
+	m.gaps = make(map[gapKey]Gap, len(state.Gaps))
+	for _, gap := range state.Gaps {
+		m.gaps[gapKey{namespace: gap.Namespace, query: gap.Query}] = gap
+	}
+	m.reviews = state.Reviews
+	m.relations = state.Relations
+	return nil
+}
+
+// writeFileAtomic replaces the file at path with data, so a crash leaves
+// either the old file or the new one
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
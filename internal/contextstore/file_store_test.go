@@ -0,0 +1,96 @@
+package contextstore_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/contextstore/storetest"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+func TestFileContextStoreContract(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) contextstore.ContextStore {
+		store := contextstore.NewFileContextStore()
+		if err := store.Initialize(filepath.Join(t.TempDir(), "test.gob")); err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+}
+
+// TestFileContextStoreReopens checks that everything stored survives
+// closing the store and opening its file again
+func TestFileContextStoreReopens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.gob")
+	store := contextstore.NewFileContextStore()
+	if err := store.Initialize(path); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	embedding, err := vector.Float32SliceToBytes([]float32{1, 0, 0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := store.StoreInNamespace("work", "a", "Auth uses JWTs", embedding, saved); err != nil {
+		t.Fatalf("StoreInNamespace() error = %v", err)
+	}
+	if err := store.SetTags("a", []string{"auth"}); err != nil {
+		t.Fatalf("SetTags() error = %v", err)
+	}
+	if err := store.SetPinned("a", true); err != nil {
+		t.Fatalf("SetPinned() error = %v", err)
+	}
+	if err := store.Quarantine("b", "Use tabs", embedding, saved, nil, "openai"); err != nil {
+		t.Fatalf("Quarantine() error = %v", err)
+	}
+	if err := store.RecordGap("work", "deploys", saved); err != nil {
+		t.Fatalf("RecordGap() error = %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	reopened := contextstore.NewFileContextStore()
+	if err := reopened.Initialize(path); err != nil {
+		t.Fatalf("Initialize() of the saved file error = %v", err)
+	}
+	defer reopened.Close()
+
+	results, err := reopened.SearchWithScores([]float32{1, 0, 0, 0}, 5, contextstore.SearchFilter{})
+	if err != nil {
+		t.Fatalf("SearchWithScores() error = %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "a" || results[0].Similarity < 0.99 || !results[0].Timestamp.Equal(saved) {
+		t.Fatalf("Expected the stored entry with its score and timestamp, got %+v", results)
+	}
+	if tags, err := reopened.GetTags("a"); err != nil || len(tags) != 1 || tags[0] != "auth" {
+		t.Errorf("Expected the entry's tags to survive, got %v, %v", tags, err)
+	}
+	if pinned, err := reopened.ListPinned("work"); err != nil || len(pinned) != 1 {
+		t.Errorf("Expected the entry to stay pinned, got %v, %v", pinned, err)
+	}
+	if quarantined, err := reopened.ListQuarantined(); err != nil || len(quarantined) != 1 || quarantined[0].Provider != "openai" {
+		t.Errorf("Expected the quarantined entry to survive, got %+v, %v", quarantined, err)
+	}
+	if gaps, err := reopened.ListGaps("work"); err != nil || len(gaps) != 1 || gaps[0].Query != "deploys" {
+		t.Errorf("Expected the gap to survive, got %+v, %v", gaps, err)
+	}
+}
+
+// TestFileContextStoreRejectsSQLite checks that a SQLite database is not
+// mistaken for an empty store and overwritten
+func TestFileContextStoreRejectsSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	if err := os.WriteFile(path, []byte("SQLite format 3\x00rest of the database"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	store := contextstore.NewFileContextStore()
+	if err := store.Initialize(path); !errors.Is(err, contextstore.ErrFileStoreFormat) {
+		t.Errorf("Expected ErrFileStoreFormat, got %v", err)
+	}
+}
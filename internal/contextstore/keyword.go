@@ -0,0 +1,88 @@
+package contextstore
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// BM25 parameters: how quickly repeated words stop adding to a score, and
+// how much long summaries are penalized. They are the usual defaults, and
+// those of SQLite's bm25 function.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// keywordTerms returns the words of text, lowercased: runs of letters,
+// digits and underscores, so identifiers such as parse_half_life stay whole
+func keywordTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+}
+
+// keywordIndex scores summaries against the words of a query by BM25
+type keywordIndex struct {
+	terms []string
+
+	// documents holds the words of each summary, and frequencies how
+	// many summaries contain each query word
+	documents   [][]string
+	frequencies map[string]int
+	totalLength int
+}
+
+// newKeywordIndex returns an index for the query, to add the summaries
+// searched to
+func newKeywordIndex(query string) *keywordIndex {
+	index := &keywordIndex{frequencies: make(map[string]int)}
+	seen := make(map[string]bool)
+	for _, term := range keywordTerms(query) {
+		if !seen[term] {
+			seen[term] = true
+			index.terms = append(index.terms, term)
+		}
+	}
+	return index
+}
+
+// add indexes a summary and returns its position for score
+func (k *keywordIndex) add(summary string) int {
+	words := keywordTerms(summary)
+	present := make(map[string]bool)
+	for _, word := range words {
+		present[word] = true
+	}
+	for _, term := range k.terms {
+		if present[term] {
+			k.frequencies[term]++
+		}
+	}
+	k.documents = append(k.documents, words)
+	k.totalLength += len(words)
+	return len(k.documents) - 1
+}
+
+// score returns the BM25 score of the summary added at position i, 0 if it
+// contains no query word. Every summary must be added first.
+func (k *keywordIndex) score(i int) float64 {
+	words := k.documents[i]
+	counts := make(map[string]int)
+	for _, word := range words {
+		counts[word]++
+	}
+	n := float64(len(k.documents))
+	averageLength := float64(k.totalLength) / n
+	score := 0.0
+	for _, term := range k.terms {
+		count := float64(counts[term])
+		if count == 0 {
+			continue
+		}
+		frequency := float64(k.frequencies[term])
+		idf := math.Log(1 + (n-frequency+0.5)/(frequency+0.5))
+		score += idf * count * (bm25K1 + 1) / (count + bm25K1*(1-bm25B+bm25B*float64(len(words))/averageLength))
+	}
+	return score
+}
@@ -0,0 +1,1154 @@
+package contextstore
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+// memoryEntry is a single context entry held by MemoryContextStore.
+type memoryEntry struct {
+	summaryText string
+	embedding   []byte
+	timestamp   time.Time
+	tags        []string
+	provenance  []string
+	generation  Generation
+	title       string
+	references  []Reference
+	batch       string
+	session     string
+
+	// pinnedAt is zero for entries that are not pinned
+	pinnedAt time.Time
+
+	// namespace is empty for entries in DefaultNamespace
+	namespace string
+
+	// Usage statistics for UsageStore
+	retrievals    int
+	lastRetrieved time.Time
+
+	// norm is the L2 norm of embedding, computed once at write time
+	norm float64
+}
+
+// namespaceOrDefault returns the namespace of the entry
+func (e memoryEntry) namespaceOrDefault() string {
+	if e.namespace == "" {
+		return DefaultNamespace
+	}
+	return e.namespace
+}
+
+// clearedEntry is an entry hidden by MarkCleared
+type clearedEntry struct {
+	memoryEntry
+	clearedAt time.Time
+}
+
+// quarantinedEntry is an entry held out of the index by Quarantine
+type quarantinedEntry struct {
+	memoryEntry
+	provider string
+}
+
+// MemoryContextStore is an in-memory implementation of ContextStore.
+// It is intended for tests, examples and short-lived processes where
+// persistence is not required.
+type MemoryContextStore struct {
+	entries     map[string]memoryEntry
+	cleared     map[string]clearedEntry
+	quarantined map[string]quarantinedEntry
+	gaps        map[gapKey]Gap
+	reviews     []Review
+	relations   []Relation
+	mu          writeLock
+}
+
+// writeLock is a sync.RWMutex that counts its write locks, so
+// FileContextStore can tell whether the store changed since it was saved
+type writeLock struct {
+	sync.RWMutex
+
+	// writes is only changed under the write lock
+	writes uint64
+}
+
+// Unlock counts the write and releases the write lock
+func (l *writeLock) Unlock() {
+	l.writes++
+	l.RWMutex.Unlock()
+}
+
+// gapKey identifies a gap of MemoryContextStore
+type gapKey struct {
+	namespace string
+	query     string
+}
+
+var (
+	_ ScoredSearcher  = (*MemoryContextStore)(nil)
+	_ KeywordSearcher = (*MemoryContextStore)(nil)
+	_ TaggedStore     = (*MemoryContextStore)(nil)
+	_ UsageStore      = (*MemoryContextStore)(nil)
+	_ SoftClearer     = (*MemoryContextStore)(nil)
+	_ QuarantineStore = (*MemoryContextStore)(nil)
+	_ ProvenanceStore = (*MemoryContextStore)(nil)
+	_ SnapshotHasher  = (*MemoryContextStore)(nil)
+	_ BatchStore      = (*MemoryContextStore)(nil)
+	_ SessionStore    = (*MemoryContextStore)(nil)
+	_ RelationStore   = (*MemoryContextStore)(nil)
+	_ GapStore        = (*MemoryContextStore)(nil)
+	_ ReviewStore     = (*MemoryContextStore)(nil)
+	_ GenerationStore = (*MemoryContextStore)(nil)
+	_ TitleStore      = (*MemoryContextStore)(nil)
+	_ PinStore        = (*MemoryContextStore)(nil)
+	_ ReferenceStore  = (*MemoryContextStore)(nil)
+	_ NamespacedStore = (*MemoryContextStore)(nil)
+)
+
+// NewMemoryContextStore creates a new MemoryContextStore instance.
+func NewMemoryContextStore() *MemoryContextStore {
+	return &MemoryContextStore{
+		entries:     make(map[string]memoryEntry),
+		cleared:     make(map[string]clearedEntry),
+		quarantined: make(map[string]quarantinedEntry),
+		gaps:        make(map[gapKey]Gap),
+	}
+}
+
+// Initialize initializes the store. The database path is ignored.
+func (s *MemoryContextStore) Initialize(dbPath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.entries == nil {
+		s.entries = make(map[string]memoryEntry)
+	}
+	if s.cleared == nil {
+		s.cleared = make(map[string]clearedEntry)
+	}
+	if s.quarantined == nil {
+		s.quarantined = make(map[string]quarantinedEntry)
+	}
+	if s.gaps == nil {
+		s.gaps = make(map[gapKey]Gap)
+	}
+	return nil
+}
+
+// Close closes the store and releases any resources.
+func (s *MemoryContextStore) Close() error {
+	return nil
+}
+
+// Store stores the context data in memory, in the namespace the ID is
+// already stored in or else in DefaultNamespace.
+func (s *MemoryContextStore) Store(id string, summaryText string, embedding []byte, timestamp time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.store(s.entries[id].namespace, id, summaryText, embedding, timestamp)
+	return nil
+}
+
+// StoreInNamespace stores the context data in namespace, moving the entry
+// there if its ID is stored in another namespace.
+func (s *MemoryContextStore) StoreInNamespace(namespace string, id string, summaryText string, embedding []byte, timestamp time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if namespace == DefaultNamespace {
+		namespace = ""
+	}
+	s.store(namespace, id, summaryText, embedding, timestamp)
+	return nil
+}
+
+// store stores an entry in namespace, empty for DefaultNamespace. The
+// caller must hold mu.
+func (s *MemoryContextStore) store(namespace string, id string, summaryText string, embedding []byte, timestamp time.Time) {
+	// Copy the embedding so callers can reuse their buffer
+	stored := make([]byte, len(embedding))
+	copy(stored, embedding)
+
+	// An undecodable embedding gets no norm and fails in Search, as before
+	norm, _ := embeddingNorm(stored)
+
+	// Tags, provenance, generation, title, references, batch, session, pin
+	// and usage belong to the ID, so they survive overwriting the entry. The title is dropped
+	// when the entry moves to another namespace, as SQLite stores do.
+	previous := s.entries[id]
+	title := previous.title
+	if previous.namespace != namespace {
+		title = ""
+	}
+	s.entries[id] = memoryEntry{
+		summaryText:   summaryText,
+		embedding:     stored,
+		timestamp:     timestamp,
+		tags:          previous.tags,
+		provenance:    previous.provenance,
+		generation:    previous.generation,
+		title:         title,
+		references:    previous.references,
+		batch:         previous.batch,
+		session:       previous.session,
+		pinnedAt:      previous.pinnedAt,
+		namespace:     namespace,
+		retrievals:    previous.retrievals,
+		lastRetrieved: previous.lastRetrieved,
+		norm:          norm,
+	}
+}
+
+// Search searches for context entries similar to the given embedding.
+// Like SQLiteContextStore, entries are ranked by cosine similarity and
+// ties are broken by recency.
+func (s *MemoryContextStore) Search(queryEmbedding []float32, limit int) ([]string, error) {
+	results, err := s.SearchWithScores(queryEmbedding, limit, SearchFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	topSummaries := make([]string, len(results))
+	for i, result := range results {
+		topSummaries[i] = result.SummaryText
+	}
+
+	return topSummaries, nil
+}
+
+// SearchWithScores is Search with the similarity of each result. Entries
+// excluded by filter are skipped.
+func (s *MemoryContextStore) SearchWithScores(queryEmbedding []float32, limit int, filter SearchFilter) ([]SearchResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	queryNorm := vector.Norm(queryEmbedding)
+	exclusions := filter.compile()
+	results := make([]SearchResult, 0, len(s.entries))
+	buffer := searchBuffers.Get().(*searchBuffer)
+	defer searchBuffers.Put(buffer)
+
+	for id, entry := range s.entries {
+		if exclusions.excludes(id, entry.summaryText, entry.tags, entry.timestamp) {
+			continue
+		}
+		if filter.Namespace != "" && entry.namespaceOrDefault() != filter.Namespace {
+			continue
+		}
+		if filter.Pinned && entry.pinnedAt.IsZero() {
+			continue
+		}
+		if filter.Session != "" && entry.session != filter.Session {
+			continue
+		}
+
+		var err error
+		buffer.vector, err = vector.DecodeFloat32s(buffer.vector, entry.embedding)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert embedding bytes for entry %s: %w", id, err)
+		}
+
+		similarity, err := vector.CosineSimilarityWithNorms(queryEmbedding, buffer.vector, queryNorm, entry.norm)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate similarity for entry %s: %w", id, err)
+		}
+
+		results = append(results, SearchResult{
+			ID:          id,
+			SummaryText: entry.summaryText,
+			Timestamp:   entry.timestamp,
+			Similarity:  similarity,
+		})
+	}
+
+	// Sort results by similarity (highest first), newest first on ties,
+	// then by ID so repeated searches always return the same order
+	slices.SortFunc(results, func(a, b SearchResult) int {
+		if a.Similarity != b.Similarity {
+			return cmp.Compare(b.Similarity, a.Similarity)
+		}
+		if !a.Timestamp.Equal(b.Timestamp) {
+			return b.Timestamp.Compare(a.Timestamp)
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	if limit > len(results) {
+		limit = len(results)
+	}
+	if limit < 0 {
+		limit = 0
+	}
+
+	return results[:limit], nil
+}
+
+// SearchKeywords implements KeywordSearcher, scoring the summaries not
+// excluded by filter against each other
+func (s *MemoryContextStore) SearchKeywords(query string, limit int, filter SearchFilter) ([]SearchResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	exclusions := filter.compile()
+	index := newKeywordIndex(query)
+	var candidates []SearchResult
+	for id, entry := range s.entries {
+		if exclusions.excludes(id, entry.summaryText, entry.tags, entry.timestamp) {
+			continue
+		}
+		if filter.Namespace != "" && entry.namespaceOrDefault() != filter.Namespace {
+			continue
+		}
+		if filter.Pinned && entry.pinnedAt.IsZero() {
+			continue
+		}
+		if filter.Session != "" && entry.session != filter.Session {
+			continue
+		}
+		index.add(entry.summaryText)
+		candidates = append(candidates, SearchResult{ID: id, SummaryText: entry.summaryText, Timestamp: entry.timestamp})
+	}
+
+	results := make([]SearchResult, 0, len(candidates))
+	for i, candidate := range candidates {
+		if candidate.Similarity = index.score(i); candidate.Similarity > 0 {
+			results = append(results, candidate)
+		}
+	}
+	slices.SortFunc(results, func(a, b SearchResult) int {
+		if a.Similarity != b.Similarity {
+			return cmp.Compare(b.Similarity, a.Similarity)
+		}
+		if !a.Timestamp.Equal(b.Timestamp) {
+			return b.Timestamp.Compare(a.Timestamp)
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	if limit > len(results) {
+		limit = len(results)
+	}
+	if limit < 0 {
+		limit = 0
+	}
+	return results[:limit], nil
+}
+
+// SetTags replaces the tags of an existing entry.
+func (s *MemoryContextStore) SetTags(id string, tags []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, exists := s.entries[id]
+	if !exists {
+		return fmt.Errorf("no context entry found with ID: %s", id)
+	}
+	entry.tags = NormalizeTags(tags)
+	s.entries[id] = entry
+	return nil
+}
+
+// GetTags returns the tags of an entry, sorted.
+func (s *MemoryContextStore) GetTags(id string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, exists := s.entries[id]
+	if !exists {
+		return nil, fmt.Errorf("no context entry found with ID: %s", id)
+	}
+	return append([]string{}, entry.tags...), nil
+}
+
+// SetProvenance replaces the provenance chain of an existing or
+// quarantined entry.
+func (s *MemoryContextStore) SetProvenance(id string, chain []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chain = append([]string{}, chain...)
+	if entry, exists := s.entries[id]; exists {
+		entry.provenance = chain
+		s.entries[id] = entry
+		return nil
+	}
+	if entry, exists := s.quarantined[id]; exists {
+		entry.provenance = chain
+		s.quarantined[id] = entry
+		return nil
+	}
+	return fmt.Errorf("no context entry found with ID: %s", id)
+}
+
+// GetProvenance returns the provenance chain of an existing or quarantined
+// entry.
+func (s *MemoryContextStore) GetProvenance(id string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if entry, exists := s.entries[id]; exists {
+		return append([]string{}, entry.provenance...), nil
+	}
+	if entry, exists := s.quarantined[id]; exists {
+		return append([]string{}, entry.provenance...), nil
+	}
+	return nil, fmt.Errorf("no context entry found with ID: %s", id)
+}
+
+// SetGeneration records the generation of an existing or quarantined
+// entry's summary.
+func (s *MemoryContextStore) SetGeneration(id string, generation Generation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, exists := s.entries[id]; exists {
+		entry.generation = generation
+		s.entries[id] = entry
+		return nil
+	}
+	if entry, exists := s.quarantined[id]; exists {
+		entry.generation = generation
+		s.quarantined[id] = entry
+		return nil
+	}
+	return fmt.Errorf("no context entry found with ID: %s", id)
+}
+
+// GetGeneration returns the generation of an existing or quarantined
+// entry's summary.
+func (s *MemoryContextStore) GetGeneration(id string) (Generation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if entry, exists := s.entries[id]; exists {
+		return entry.generation, nil
+	}
+	if entry, exists := s.quarantined[id]; exists {
+		return entry.generation, nil
+	}
+	return Generation{}, fmt.Errorf("no context entry found with ID: %s", id)
+}
+
+// SetTitle records the title of an existing or quarantined entry's
+// summary.
+func (s *MemoryContextStore) SetTitle(id string, title string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, exists := s.entries[id]; exists {
+		entry.title = title
+		s.entries[id] = entry
+		return nil
+	}
+	if entry, exists := s.quarantined[id]; exists {
+		entry.title = title
+		s.quarantined[id] = entry
+		return nil
+	}
+	return fmt.Errorf("no context entry found with ID: %s", id)
+}
+
+// GetTitle returns the title of an existing or quarantined entry's summary.
+func (s *MemoryContextStore) GetTitle(id string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if entry, exists := s.entries[id]; exists {
+		return entry.title, nil
+	}
+	if entry, exists := s.quarantined[id]; exists {
+		return entry.title, nil
+	}
+	return "", fmt.Errorf("no context entry found with ID: %s", id)
+}
+
+// SetReferences replaces the references of an existing or quarantined
+// entry.
+func (s *MemoryContextStore) SetReferences(id string, references []Reference) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, exists := s.entries[id]; exists {
+		entry.references = NormalizeReferences(references)
+		s.entries[id] = entry
+		return nil
+	}
+	if entry, exists := s.quarantined[id]; exists {
+		entry.references = NormalizeReferences(references)
+		s.quarantined[id] = entry
+		return nil
+	}
+	return fmt.Errorf("no context entry found with ID: %s", id)
+}
+
+// GetReferences returns the references of an existing or quarantined
+// entry, sorted.
+func (s *MemoryContextStore) GetReferences(id string) ([]Reference, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if entry, exists := s.entries[id]; exists {
+		return append([]Reference{}, entry.references...), nil
+	}
+	if entry, exists := s.quarantined[id]; exists {
+		return append([]Reference{}, entry.references...), nil
+	}
+	return nil, fmt.Errorf("no context entry found with ID: %s", id)
+}
+
+// ListReferencing returns the visible entries referencing the file at path
+// or a symbol declared in it, newest first.
+func (s *MemoryContextStore) ListReferencing(path string) ([]LinkedEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	linked := []LinkedEntry{}
+	for id, entry := range s.entries {
+		var references []Reference
+		for _, reference := range entry.references {
+			if reference.Path == path {
+				references = append(references, reference)
+			}
+		}
+		if len(references) == 0 {
+			continue
+		}
+		linked = append(linked, LinkedEntry{
+			ID:          id,
+			SummaryText: entry.summaryText,
+			Title:       entry.title,
+			Timestamp:   entry.timestamp,
+			References:  references,
+		})
+	}
+
+	sort.Slice(linked, func(i, j int) bool {
+		if !linked[i].Timestamp.Equal(linked[j].Timestamp) {
+			return linked[i].Timestamp.After(linked[j].Timestamp)
+		}
+		return linked[i].ID < linked[j].ID
+	})
+	return linked, nil
+}
+
+// SetPinned pins or unpins an existing entry. Pinning a pinned entry keeps
+// its place in ListPinned.
+func (s *MemoryContextStore) SetPinned(id string, pinned bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, exists := s.entries[id]
+	if !exists {
+		return fmt.Errorf("no context entry found with ID: %s", id)
+	}
+	switch {
+	case !pinned:
+		entry.pinnedAt = time.Time{}
+	case entry.pinnedAt.IsZero():
+		entry.pinnedAt = time.Now()
+	}
+	s.entries[id] = entry
+	return nil
+}
+
+// ListPinned returns the IDs of the pinned entries of a namespace, earliest
+// pinned first. An empty namespace lists every namespace.
+func (s *MemoryContextStore) ListPinned(namespace string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	type pin struct {
+		id       string
+		pinnedAt time.Time
+	}
+	var pins []pin
+	for id, entry := range s.entries {
+		if entry.pinnedAt.IsZero() || (namespace != "" && entry.namespaceOrDefault() != namespace) {
+			continue
+		}
+		pins = append(pins, pin{id, entry.pinnedAt})
+	}
+	sort.Slice(pins, func(i, j int) bool {
+		if !pins[i].pinnedAt.Equal(pins[j].pinnedAt) {
+			return pins[i].pinnedAt.Before(pins[j].pinnedAt)
+		}
+		return pins[i].id < pins[j].id
+	})
+
+	ids := make([]string, len(pins))
+	for i, pin := range pins {
+		ids[i] = pin.id
+	}
+	return ids, nil
+}
+
+// SetBatch records that an existing or quarantined entry was written by
+// the batch.
+func (s *MemoryContextStore) SetBatch(id string, batch string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, exists := s.entries[id]; exists {
+		entry.batch = batch
+		s.entries[id] = entry
+		return nil
+	}
+	if entry, exists := s.quarantined[id]; exists {
+		entry.batch = batch
+		s.quarantined[id] = entry
+		return nil
+	}
+	return fmt.Errorf("no context entry found with ID: %s", id)
+}
+
+// ListBatches returns every batch that holds entries, oldest first.
+func (s *MemoryContextStore) ListBatches() ([]Batch, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	byID := make(map[string]*Batch)
+	add := func(entry memoryEntry) {
+		if entry.batch == "" {
+			return
+		}
+		batch, exists := byID[entry.batch]
+		if !exists {
+			batch = &Batch{ID: entry.batch, FirstStored: entry.timestamp, LastStored: entry.timestamp}
+			byID[entry.batch] = batch
+		}
+		batch.Entries++
+		if entry.timestamp.Before(batch.FirstStored) {
+			batch.FirstStored = entry.timestamp
+		}
+		if entry.timestamp.After(batch.LastStored) {
+			batch.LastStored = entry.timestamp
+		}
+	}
+	for _, entry := range s.entries {
+		add(entry)
+	}
+	for _, entry := range s.quarantined {
+		add(entry.memoryEntry)
+	}
+
+	batches := make([]Batch, 0, len(byID))
+	for _, batch := range byID {
+		batches = append(batches, *batch)
+	}
+	sortBatches(batches)
+	return batches, nil
+}
+
+// DeleteBatch deletes every entry of the batch, quarantined ones included.
+func (s *MemoryContextStore) DeleteBatch(batch string) (int, error) {
+	if batch == "" {
+		return 0, errEmptyBatch
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for id, entry := range s.entries {
+		if entry.batch == batch {
+			delete(s.entries, id)
+			deleted++
+		}
+	}
+	for id, entry := range s.quarantined {
+		if entry.batch == batch {
+			delete(s.quarantined, id)
+			deleted++
+		}
+	}
+	s.pruneRelations()
+	return deleted, nil
+}
+
+// SetSession records that an existing or quarantined entry was saved in
+// the session.
+func (s *MemoryContextStore) SetSession(id string, session string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, exists := s.entries[id]; exists {
+		entry.session = session
+		s.entries[id] = entry
+		return nil
+	}
+	if entry, exists := s.quarantined[id]; exists {
+		entry.session = session
+		s.quarantined[id] = entry
+		return nil
+	}
+	return fmt.Errorf("no context entry found with ID: %s", id)
+}
+
+// ListSessions returns every session that holds entries, most recently
+// active first.
+func (s *MemoryContextStore) ListSessions() ([]Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	byID := make(map[string]*Session)
+	add := func(entry memoryEntry) {
+		if entry.session == "" {
+			return
+		}
+		session, exists := byID[entry.session]
+		if !exists {
+			session = &Session{ID: entry.session, FirstStored: entry.timestamp, LastStored: entry.timestamp}
+			byID[entry.session] = session
+		}
+		session.Entries++
+		if entry.timestamp.Before(session.FirstStored) {
+			session.FirstStored = entry.timestamp
+		}
+		if entry.timestamp.After(session.LastStored) {
+			session.LastStored = entry.timestamp
+		}
+	}
+	for _, entry := range s.entries {
+		add(entry)
+	}
+	for _, entry := range s.quarantined {
+		add(entry.memoryEntry)
+	}
+
+	sessions := make([]Session, 0, len(byID))
+	for _, session := range byID {
+		sessions = append(sessions, *session)
+	}
+	sortSessions(sessions)
+	return sessions, nil
+}
+
+// DeleteSession deletes every entry of the session, quarantined ones
+// included.
+func (s *MemoryContextStore) DeleteSession(session string) (int, error) {
+	if session == "" {
+		return 0, errEmptySession
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for id, entry := range s.entries {
+		if entry.session == session {
+			delete(s.entries, id)
+			deleted++
+		}
+	}
+	for id, entry := range s.quarantined {
+		if entry.session == session {
+			delete(s.quarantined, id)
+			deleted++
+		}
+	}
+	s.pruneRelations()
+	return deleted, nil
+}
+
+// Link records a relation between two visible entries. Linking a pair
+// again with the same type keeps the original relation.
+func (s *MemoryContextStore) Link(relation Relation) error {
+	if err := checkRelation(relation); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range []string{relation.EntryID, relation.RelatedID} {
+		if _, exists := s.entries[id]; !exists {
+			return fmt.Errorf("%w: %s", ErrEntryNotFound, id)
+		}
+	}
+	for _, linked := range s.relations {
+		if linked.EntryID == relation.EntryID && linked.RelatedID == relation.RelatedID && linked.Type == relation.Type {
+			return nil
+		}
+	}
+	s.relations = append(s.relations, relation)
+	return nil
+}
+
+// Unlink removes the relation of the given type from id to relatedID.
+func (s *MemoryContextStore) Unlink(id string, relatedID string, relationType string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, linked := range s.relations {
+		if linked.EntryID == id && linked.RelatedID == relatedID && linked.Type == relationType {
+			s.relations = slices.Delete(s.relations, i, i+1)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ListRelations returns the relations from and to a visible entry whose
+// other end is visible too, oldest first.
+func (s *MemoryContextStore) ListRelations(id string) ([]RelatedEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, exists := s.entries[id]; !exists {
+		return nil, fmt.Errorf("%w: %s", ErrEntryNotFound, id)
+	}
+	related := []RelatedEntry{}
+	for _, relation := range s.relations {
+		other := relation.RelatedID
+		switch id {
+		case relation.EntryID:
+		case relation.RelatedID:
+			other = relation.EntryID
+		default:
+			continue
+		}
+		entry, exists := s.entries[other]
+		if !exists {
+			continue
+		}
+		related = append(related, RelatedEntry{
+			Relation:    relation,
+			ID:          other,
+			SummaryText: entry.summaryText,
+			Title:       entry.title,
+			Timestamp:   entry.timestamp,
+		})
+	}
+	sortRelations(related)
+	return related, nil
+}
+
+// pruneRelations drops the relations of entries that are neither visible
+// nor cleared. It must be called with the write lock held.
+func (s *MemoryContextStore) pruneRelations() {
+	s.relations = slices.DeleteFunc(s.relations, func(relation Relation) bool {
+		return !s.holds(relation.EntryID) || !s.holds(relation.RelatedID)
+	})
+}
+
+// holds reports whether id is a visible or cleared entry
+func (s *MemoryContextStore) holds(id string) bool {
+	if _, exists := s.entries[id]; exists {
+		return true
+	}
+	_, exists := s.cleared[id]
+	return exists
+}
+
+// RecordGap counts one retrieval of query in namespace that found nothing.
+func (s *MemoryContextStore) RecordGap(namespace string, query string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := gapKey{namespace: namespace, query: query}
+	gap, exists := s.gaps[key]
+	if !exists {
+		gap = Gap{Namespace: namespace, Query: query, FirstSeen: at}
+	}
+	gap.Count++
+	gap.LastSeen = at
+	s.gaps[key] = gap
+	return nil
+}
+
+// ListGaps returns the gaps of namespace, or of every namespace if it is
+// empty, most often asked first.
+func (s *MemoryContextStore) ListGaps(namespace string) ([]Gap, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	gaps := []Gap{}
+	for key, gap := range s.gaps {
+		if namespace == "" || key.namespace == namespace {
+			gaps = append(gaps, gap)
+		}
+	}
+	sortGaps(gaps)
+	return gaps, nil
+}
+
+// DeleteGaps forgets the listed queries of namespace.
+func (s *MemoryContextStore) DeleteGaps(namespace string, queries []string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, query := range queries {
+		key := gapKey{namespace: namespace, query: query}
+		if _, exists := s.gaps[key]; exists {
+			delete(s.gaps, key)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// RecordReview records a review.
+func (s *MemoryContextStore) RecordReview(review Review) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reviews = append(s.reviews, review)
+	return nil
+}
+
+// ListReviews returns the reviews of the entry with the given ID, or of
+// every entry if it is empty, latest first.
+func (s *MemoryContextStore) ListReviews(id string) ([]Review, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	reviews := []Review{}
+	for i := len(s.reviews) - 1; i >= 0; i-- {
+		if id == "" || s.reviews[i].ID == id {
+			reviews = append(reviews, s.reviews[i])
+		}
+	}
+	sortReviews(reviews)
+	return reviews, nil
+}
+
+// RecordRetrievals counts one retrieval at the given time for each ID.
+func (s *MemoryContextStore) RecordRetrievals(ids []string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range ids {
+		entry, exists := s.entries[id]
+		if !exists {
+			continue
+		}
+		entry.retrievals++
+		entry.lastRetrieved = at
+		s.entries[id] = entry
+	}
+	return nil
+}
+
+// ListEntries returns every entry, oldest first.
+func (s *MemoryContextStore) ListEntries() ([]Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := make([]Entry, 0, len(s.entries))
+	for id, entry := range s.entries {
+		embedding, err := vector.BytesToFloat32Slice(entry.embedding)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert embedding bytes for entry %s: %w", id, err)
+		}
+		entries = append(entries, Entry{
+			ID:            id,
+			SummaryText:   entry.summaryText,
+			Embedding:     embedding,
+			Timestamp:     entry.timestamp,
+			Retrievals:    entry.retrievals,
+			LastRetrieved: entry.lastRetrieved,
+			Provenance:    append([]string{}, entry.provenance...),
+			Generation:    entry.generation,
+			Pinned:        !entry.pinnedAt.IsZero(),
+			Title:         entry.title,
+			Namespace:     entry.namespaceOrDefault(),
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].Timestamp.Equal(entries[j].Timestamp) {
+			return entries[i].Timestamp.Before(entries[j].Timestamp)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	return entries, nil
+}
+
+// SnapshotHashes returns the snapshot hash of each namespace that holds
+// entries.
+func (s *MemoryContextStore) SnapshotHashes() (map[string]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tree := make(snapshotTree)
+	for id, entry := range s.entries {
+		tree.add(entry.namespaceOrDefault(), snapshotEntry{
+			id:          id,
+			summaryText: entry.summaryText,
+			embedding:   entry.embedding,
+			timestamp:   entry.timestamp,
+			tags:        entry.tags,
+			provenance:  entry.provenance,
+		})
+	}
+	return tree.roots(), nil
+}
+
+// Delete deletes a specific context entry from the store by ID.
+func (s *MemoryContextStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.entries[id]; exists {
+		delete(s.entries, id)
+		s.pruneRelations()
+		return nil
+	}
+	if _, exists := s.quarantined[id]; exists {
+		delete(s.quarantined, id)
+		return nil
+	}
+	return fmt.Errorf("no context entry found with ID: %s", id)
+}
+
+// Clear removes all context entries from the store, including entries
+// hidden by MarkCleared. Returns the number of visible entries deleted.
+func (s *MemoryContextStore) Clear() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := len(s.entries)
+	s.entries = make(map[string]memoryEntry)
+	s.cleared = make(map[string]clearedEntry)
+	s.quarantined = make(map[string]quarantinedEntry)
+	s.relations = nil
+	return count, nil
+}
+
+// MarkCleared hides every entry until it is restored by UndoClear or
+// deleted by PurgeCleared. Quarantined entries are deleted.
+func (s *MemoryContextStore) MarkCleared(at time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.quarantined = make(map[string]quarantinedEntry)
+
+	count := len(s.entries)
+	for id, entry := range s.entries {
+		s.cleared[id] = clearedEntry{memoryEntry: entry, clearedAt: at}
+	}
+	s.entries = make(map[string]memoryEntry)
+	return count, nil
+}
+
+// UndoClear restores every cleared entry whose ID was not stored again.
+func (s *MemoryContextStore) UndoClear() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	restored := 0
+	for id, entry := range s.cleared {
+		if _, exists := s.entries[id]; !exists {
+			s.entries[id] = entry.memoryEntry
+			restored++
+		}
+	}
+	s.cleared = make(map[string]clearedEntry)
+	return restored, nil
+}
+
+// PurgeCleared permanently deletes entries cleared before the given time.
+func (s *MemoryContextStore) PurgeCleared(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+	for id, entry := range s.cleared {
+		if entry.clearedAt.Before(before) {
+			delete(s.cleared, id)
+			purged++
+		}
+	}
+	s.pruneRelations()
+	return purged, nil
+}
+
+// Quarantine stores an entry and its tags outside the search index.
+func (s *MemoryContextStore) Quarantine(id string, summaryText string, embedding []byte, timestamp time.Time, tags []string, provider string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := make([]byte, len(embedding))
+	copy(stored, embedding)
+	s.quarantined[id] = quarantinedEntry{
+		memoryEntry: memoryEntry{
+			summaryText: summaryText,
+			embedding:   stored,
+			timestamp:   timestamp,
+			tags:        NormalizeTags(tags),
+		},
+		provider: provider,
+	}
+	return nil
+}
+
+// ListQuarantined returns every quarantined entry, oldest first.
+func (s *MemoryContextStore) ListQuarantined() ([]QuarantinedEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := make([]QuarantinedEntry, 0, len(s.quarantined))
+	for id, entry := range s.quarantined {
+		entries = append(entries, QuarantinedEntry{
+			ID:          id,
+			SummaryText: entry.summaryText,
+			Timestamp:   entry.timestamp,
+			Provider:    entry.provider,
+			Dimensions:  embeddingDimensions(entry.embedding),
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].Timestamp.Equal(entries[j].Timestamp) {
+			return entries[i].Timestamp.Before(entries[j].Timestamp)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	return entries, nil
+}
+
+// ReleaseQuarantined moves a quarantined entry into the search index with a
+// new embedding.
+func (s *MemoryContextStore) ReleaseQuarantined(id string, embedding []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, exists := s.quarantined[id]
+	if !exists {
+		return fmt.Errorf("no quarantined context entry found with ID: %s", id)
+	}
+
+	stored := make([]byte, len(embedding))
+	copy(stored, embedding)
+	norm, _ := embeddingNorm(stored)
+
+	entry.embedding = stored
+	entry.norm = norm
+	s.entries[id] = entry.memoryEntry
+	delete(s.quarantined, id)
+	return nil
+}
+
+// Replace replaces a context entry with updated information.
+func (s *MemoryContextStore) Replace(id string, summaryText string, embedding []byte, timestamp time.Time) error {
+	s.mu.RLock()
+	_, exists := s.entries[id]
+	s.mu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("no context entry found with ID: %s", id)
+	}
+
+	return s.Store(id, summaryText, embedding, timestamp)
+}
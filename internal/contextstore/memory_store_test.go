@@ -0,0 +1,55 @@
+package contextstore_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/contextstore/storetest"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+func TestMemoryContextStoreContract(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) contextstore.ContextStore {
+		return contextstore.NewMemoryContextStore()
+	})
+}
+
+func BenchmarkMemoryContextStoreSearch(b *testing.B) {
+	benchmarkSearch(b, contextstore.NewMemoryContextStore())
+}
+
+// benchmarkSearch measures a retrieval-sized search of store: one query
+// against a thousand stored 768-dimension entries, keeping the top ten.
+// Allocations are reported, since a long editor session runs many of them.
+func benchmarkSearch(b *testing.B, store contextstore.ContextStore) {
+	scored, ok := store.(contextstore.ScoredSearcher)
+	if !ok {
+		b.Fatalf("%T cannot search with scores", store)
+	}
+	rng := rand.New(rand.NewSource(1))
+	randomVector := func() []float32 {
+		v := make([]float32, 768)
+		for i := range v {
+			v[i] = rng.Float32()*2 - 1
+		}
+		return v
+	}
+	for i := range 1000 {
+		embedding, _ := vector.Float32SliceToBytes(randomVector())
+		if err := store.Store(fmt.Sprintf("entry-%d", i), fmt.Sprintf("benchmark entry %d", i), embedding, time.Unix(int64(i), 0)); err != nil {
+			b.Fatalf("Store() error = %v", err)
+		}
+	}
+	query := randomVector()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for b.Loop() {
+		if _, err := scored.SearchWithScores(query, 10, contextstore.SearchFilter{}); err != nil {
+			b.Fatalf("SearchWithScores() error = %v", err)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package contextstore
+
+import "sync"
+
+// searchBuffer is the scratch space a search scores stored entries in. The
+// vector of each entry is decoded into it, so scoring an entry allocates
+// nothing once the buffer has grown to the embedding size.
+type searchBuffer struct {
+	// embedding holds an entry's encoded vector, for stores that must copy
+	// it out of the database
+	embedding []byte
+
+	// vector holds an entry's decoded vector
+	vector []float32
+}
+
+// searchBuffers holds the buffers of finished searches for later ones.
+// Searches run on many goroutines at once, and a pool lets the garbage
+// collector reclaim the buffers of an idle server.
+var searchBuffers = sync.Pool{
+	New: func() any { return new(searchBuffer) },
+}
+
+// bytes returns the embedding buffer resized to n bytes
+func (b *searchBuffer) bytes(n int) []byte {
+	if cap(b.embedding) < n {
+		b.embedding = make([]byte, n)
+	}
+	b.embedding = b.embedding[:n]
+	return b.embedding
+}
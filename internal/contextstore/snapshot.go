@@ -0,0 +1,130 @@
+package contextstore
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"sort"
+	"time"
+)
+
+// Domain separation bytes, so a leaf can never hash like an inner node
+const (
+	snapshotLeafPrefix  = 0x00
+	snapshotInnerPrefix = 0x01
+)
+
+// snapshotEntry is the content of an entry covered by a snapshot hash:
+// everything that is copied when an entry is replicated, exported or
+// imported. Retrieval statistics are left out, since reading a store
+// changes them.
+type snapshotEntry struct {
+	id          string
+	summaryText string
+	embedding   []byte
+	timestamp   time.Time
+	tags        []string
+	provenance  []string
+}
+
+// snapshotTree collects entry hashes per namespace and reduces each
+// namespace to a Merkle root
+type snapshotTree map[string][]snapshotLeaf
+
+// snapshotLeaf is the hash of one entry
+type snapshotLeaf struct {
+	id   string
+	hash []byte
+}
+
+// add hashes entry into namespace
+func (t snapshotTree) add(namespace string, entry snapshotEntry) {
+	t[namespace] = append(t[namespace], snapshotLeaf{id: entry.id, hash: entry.hash()})
+}
+
+// roots returns the hex Merkle root of each namespace. Leaves are ordered by
+// ID, so the roots do not depend on the order entries were added in.
+func (t snapshotTree) roots() map[string]string {
+	roots := make(map[string]string, len(t))
+	for namespace, leaves := range t {
+		sort.Slice(leaves, func(i, j int) bool { return leaves[i].id < leaves[j].id })
+
+		level := make([][]byte, len(leaves))
+		for i, leaf := range leaves {
+			level[i] = leaf.hash
+		}
+		for len(level) > 1 {
+			next := make([][]byte, 0, (len(level)+1)/2)
+			for i := 0; i < len(level); i += 2 {
+				if i+1 == len(level) {
+					// An odd node is carried up unchanged
+					next = append(next, level[i])
+					continue
+				}
+				h := sha256.New()
+				h.Write([]byte{snapshotInnerPrefix})
+				h.Write(level[i])
+				h.Write(level[i+1])
+				next = append(next, h.Sum(nil))
+			}
+			level = next
+		}
+		roots[namespace] = hex.EncodeToString(level[0])
+	}
+	return roots
+}
+
+// ArchiveHash returns the snapshot hash a namespace holding exactly entries
+// has, so an archive can be checked before it is restored. It is empty for
+// no entries, which have no hash.
+func ArchiveHash(entries []ArchivedEntry) string {
+	if len(entries) == 0 {
+		return ""
+	}
+	tree := make(snapshotTree)
+	for _, entry := range entries {
+		tree.add(DefaultNamespace, snapshotEntry{
+			id:          entry.ID,
+			summaryText: entry.SummaryText,
+			embedding:   entry.Embedding,
+			timestamp:   entry.Timestamp,
+			tags:        entry.Tags,
+			provenance:  entry.Provenance,
+		})
+	}
+	return tree.roots()[DefaultNamespace]
+}
+
+// hash returns the leaf hash of the entry. Every field is length-prefixed,
+// timestamps count whole seconds like SQLiteContextStore, and tags are
+// normalized, so equal entries hash equally in every store.
+func (e snapshotEntry) hash() []byte {
+	h := sha256.New()
+	h.Write([]byte{snapshotLeafPrefix})
+	writeSnapshotField(h, []byte(e.id))
+	writeSnapshotField(h, []byte(e.summaryText))
+	writeSnapshotField(h, e.embedding)
+
+	var timestamp [8]byte
+	binary.BigEndian.PutUint64(timestamp[:], uint64(e.timestamp.Unix()))
+	h.Write(timestamp[:])
+
+	for _, list := range [][]string{NormalizeTags(e.tags), e.provenance} {
+		var count [8]byte
+		binary.BigEndian.PutUint64(count[:], uint64(len(list)))
+		h.Write(count[:])
+		for _, item := range list {
+			writeSnapshotField(h, []byte(item))
+		}
+	}
+	return h.Sum(nil)
+}
+
+// writeSnapshotField writes field to h behind its length
+func writeSnapshotField(h hash.Hash, field []byte) {
+	var length [8]byte
+	binary.BigEndian.PutUint64(length[:], uint64(len(field)))
+	h.Write(length[:])
+	h.Write(field)
+}
@@ -0,0 +1,232 @@
+//go:build cgo && !purego
+
+package contextstore
+
+import (
+	"fmt"
+	"time"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+// ExportNamespace returns the visible entries of a namespace, oldest first.
+func (s *SQLiteContextStore) ExportNamespace(namespace string) ([]ArchivedEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tags, err := s.listTags()
+	if err != nil {
+		return nil, err
+	}
+	chains, err := s.listProvenance()
+	if err != nil {
+		return nil, err
+	}
+	generations, err := s.listGenerations()
+	if err != nil {
+		return nil, err
+	}
+	titles, err := s.listTitles()
+	if err != nil {
+		return nil, err
+	}
+	references, err := s.listReferences()
+	if err != nil {
+		return nil, err
+	}
+	pins, err := s.listPins()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []ArchivedEntry{}
+	summaries := s.newSummaryReader()
+	err = sqlitex.Exec(s.conn, `
+	SELECT m.id, m.summary_text, m.embedding, m.timestamp, COALESCE(b.batch_id, ''), COALESCE(c.session_id, '')
+	FROM context_memory m LEFT JOIN context_batches b ON b.context_id = m.id
+	LEFT JOIN context_sessions c ON c.context_id = m.id
+	WHERE m.namespace = ?
+	ORDER BY m.timestamp ASC, m.id ASC;`, func(stmt *sqlite.Stmt) error {
+		id := stmt.ColumnText(0)
+		summaryText, err := summaries.open(namespace, id, stmt.ColumnText(1))
+		if err != nil {
+			return err
+		}
+		var title string
+		if stored, ok := titles[id]; ok {
+			if title, err = summaries.openTitle(namespace, id, stored); err != nil {
+				return err
+			}
+		}
+		embedding := make([]byte, stmt.ColumnLen(2))
+		stmt.ColumnBytes(2, embedding)
+		var generation *Generation
+		if g, ok := generations[id]; ok {
+			generation = &g
+		}
+		entries = append(entries, ArchivedEntry{
+			ID:          id,
+			SummaryText: summaryText,
+			Embedding:   embedding,
+			Timestamp:   time.Unix(stmt.ColumnInt64(3), 0).UTC(),
+			Tags:        tags[id],
+			Provenance:  chains[id],
+			Batch:       stmt.ColumnText(4),
+			Session:     stmt.ColumnText(5),
+			Generation:  generation,
+			Title:       title,
+			References:  references[id],
+			Pinned:      pins[id],
+		})
+		return nil
+	}, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export namespace %s: %w", namespace, err)
+	}
+	return entries, nil
+}
+
+// DeleteArchived deletes the listed visible entries of a namespace with
+// their tags, usage, provenance, generation, title, references, pin, batch,
+// session and relations.
+func (s *SQLiteContextStore) DeleteArchived(namespace string, ids []string) (count int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	defer sqlitex.Save(s.conn)(&err)
+
+	for _, id := range ids {
+		err = sqlitex.Exec(s.conn, `DELETE FROM context_memory WHERE id = ? AND namespace = ?;`, nil, id, namespace)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete archived entry %s: %w", id, err)
+		}
+		if s.conn.Changes() == 0 {
+			continue
+		}
+		count++
+
+		// Cleared entries keep their tags, usage, provenance, generation,
+		// title, references, pin, batch and session until they are restored
+		// or purged
+		cleared := false
+		err = sqlitex.Exec(s.conn, `SELECT id FROM context_cleared WHERE id = ?;`, func(stmt *sqlite.Stmt) error {
+			cleared = true
+			return nil
+		}, id)
+		if err != nil {
+			return 0, fmt.Errorf("failed to check for cleared context entry: %w", err)
+		}
+		if cleared {
+			continue
+		}
+		for _, table := range []string{"context_tags", "context_usage", "context_provenance", "context_generations", "context_titles", "context_references", "context_pins", "context_batches", "context_sessions"} {
+			if err = sqlitex.Exec(s.conn, `DELETE FROM `+table+` WHERE context_id = ?;`, nil, id); err != nil {
+				return 0, fmt.Errorf("failed to delete archived entry from %s: %w", table, err)
+			}
+		}
+	}
+	return count, s.pruneRelations()
+}
+
+// ImportNamespace stores entries in a namespace that holds none. Nothing is
+// stored if the namespace holds entries or any ID is stored, quarantined or
+// cleared.
+func (s *SQLiteContextStore) ImportNamespace(namespace string, entries []ArchivedEntry) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count, err := s.countRows("context_memory", namespace)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %s", ErrNamespaceNotEmpty, namespace)
+	}
+
+	defer sqlitex.Save(s.conn)(&err)
+
+	for _, entry := range entries {
+		taken := false
+		err = sqlitex.Exec(s.conn, `
+		SELECT id FROM context_memory WHERE id = ?1
+		UNION ALL SELECT id FROM context_quarantine WHERE id = ?1
+		UNION ALL SELECT id FROM context_cleared WHERE id = ?1;`, func(stmt *sqlite.Stmt) error {
+			taken = true
+			return nil
+		}, entry.ID)
+		if err != nil {
+			return fmt.Errorf("failed to check for context entry: %w", err)
+		}
+		if taken {
+			return fmt.Errorf("context entry %s already exists", entry.ID)
+		}
+
+		var norm interface{}
+		if n, ok := embeddingNorm(entry.Embedding); ok {
+			norm = n
+		}
+		summaryText, err := s.storedSummary(namespace, entry.ID, entry.SummaryText)
+		if err != nil {
+			return err
+		}
+		err = sqlitex.Exec(s.conn, `
+		INSERT INTO context_memory (id, summary_text, embedding, timestamp, norm, namespace)
+		VALUES (?, ?, ?, ?, ?, ?);`, nil,
+			entry.ID, summaryText, entry.Embedding, entry.Timestamp.Unix(), norm, namespace)
+		if err != nil {
+			return fmt.Errorf("failed to import context entry %s: %w", entry.ID, err)
+		}
+
+		if err := s.insertTags(entry.ID, entry.Tags); err != nil {
+			return err
+		}
+		for position, source := range entry.Provenance {
+			err = sqlitex.Exec(s.conn, `INSERT INTO context_provenance (context_id, position, source) VALUES (?, ?, ?);`, nil,
+				entry.ID, position, source)
+			if err != nil {
+				return fmt.Errorf("failed to insert source %q: %w", source, err)
+			}
+		}
+		if g := entry.Generation; g != nil {
+			err = sqlitex.Exec(s.conn, `
+			INSERT INTO context_generations (context_id, summarizer, provider, model, prompt_version)
+			VALUES (?, ?, ?, ?, ?);`, nil, entry.ID, g.Summarizer, g.Provider, g.Model, g.PromptVersion)
+			if err != nil {
+				return fmt.Errorf("failed to set generation: %w", err)
+			}
+		}
+		if entry.Title != "" {
+			title, err := s.storedTitle(namespace, entry.ID, entry.Title)
+			if err != nil {
+				return err
+			}
+			err = sqlitex.Exec(s.conn, `INSERT INTO context_titles (context_id, title) VALUES (?, ?);`, nil, entry.ID, title)
+			if err != nil {
+				return fmt.Errorf("failed to set title: %w", err)
+			}
+		}
+		if err := s.insertReferences(entry.ID, entry.References); err != nil {
+			return err
+		}
+		if entry.Pinned {
+			err = sqlitex.Exec(s.conn, `INSERT INTO context_pins (context_id, pinned_at) VALUES (?, ?);`, nil, entry.ID, time.Now().Unix())
+			if err != nil {
+				return fmt.Errorf("failed to set pin: %w", err)
+			}
+		}
+		if entry.Batch != "" {
+			err = sqlitex.Exec(s.conn, `INSERT INTO context_batches (context_id, batch_id) VALUES (?, ?);`, nil, entry.ID, entry.Batch)
+			if err != nil {
+				return fmt.Errorf("failed to set batch: %w", err)
+			}
+		}
+		if entry.Session != "" {
+			err = sqlitex.Exec(s.conn, `INSERT INTO context_sessions (context_id, session_id) VALUES (?, ?);`, nil, entry.ID, entry.Session)
+			if err != nil {
+				return fmt.Errorf("failed to set session: %w", err)
+			}
+		}
+	}
+	return nil
+}
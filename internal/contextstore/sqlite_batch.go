@@ -0,0 +1,158 @@
+//go:build cgo && !purego
+
+package contextstore
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+// ErrStoreClosed is returned for writes that reach a store after Close
+var ErrStoreClosed = errors.New("store is closed")
+
+// writeBatcher hands the entries written by Store and StoreInNamespace to
+// the goroutine committing them in groups
+type writeBatcher struct {
+	writes chan *pendingWrite
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// pendingWrite is one entry waiting to be committed, and where its error
+// is sent once it is
+type pendingWrite struct {
+	namespace   string
+	id          string
+	summaryText string
+	embedding   []byte
+	timestamp   time.Time
+	done        chan error
+}
+
+// SetWriteBatching groups the entries written by Store and StoreInNamespace
+// at the same time into one transaction of at most maxSize entries, so a
+// burst of saves costs a few commits rather than one each. Entries written
+// while a group commits form the next group; a maxDelay above 0 also waits
+// up to that long after the first entry of a group for more. Each call
+// still returns once its own entry is committed, with its own error. A
+// maxSize below 2 commits every entry on its own, as the store does by
+// default. It must not be called while the store is being written.
+func (s *SQLiteContextStore) SetWriteBatching(maxSize int, maxDelay time.Duration) {
+	s.stopWriteBatching()
+	if maxSize < 2 {
+		return
+	}
+
+	batcher := &writeBatcher{
+		writes: make(chan *pendingWrite),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	s.batcher.Store(batcher)
+	go s.commitWrites(batcher, maxSize, maxDelay)
+}
+
+// stopWriteBatching stops the goroutine committing groups, once it has
+// committed the group it holds. Writes still waiting fail with
+// ErrStoreClosed.
+func (s *SQLiteContextStore) stopWriteBatching() {
+	batcher := s.batcher.Swap(nil)
+	if batcher == nil {
+		return
+	}
+	close(batcher.stop)
+	<-batcher.done
+}
+
+// write queues an entry for the next group and waits until it is committed
+func (b *writeBatcher) write(write *pendingWrite) error {
+	write.done = make(chan error, 1)
+	select {
+	case b.writes <- write:
+		return <-write.done
+	case <-b.stop:
+		return ErrStoreClosed
+	}
+}
+
+// commitWrites collects the queued entries into groups and commits them
+// until stop is closed
+func (s *SQLiteContextStore) commitWrites(b *writeBatcher, maxSize int, maxDelay time.Duration) {
+	defer close(b.done)
+
+	for {
+		var batch []*pendingWrite
+		select {
+		case <-b.stop:
+			return
+		case write := <-b.writes:
+			batch = append(batch, write)
+		}
+
+		// Take the entries already waiting, then those arriving within
+		// maxDelay
+		var timer *time.Timer
+		var deadline <-chan time.Time
+		if maxDelay > 0 {
+			timer = time.NewTimer(maxDelay)
+			deadline = timer.C
+		}
+	collect:
+		for len(batch) < maxSize {
+			select {
+			case write := <-b.writes:
+				batch = append(batch, write)
+				continue
+			default:
+			}
+			if deadline == nil {
+				break
+			}
+			select {
+			case write := <-b.writes:
+				batch = append(batch, write)
+			case <-deadline:
+				break collect
+			case <-b.stop:
+				break collect
+			}
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+
+		s.commitBatch(batch)
+	}
+}
+
+// commitBatch writes the entries of a group in one transaction. Each entry
+// is written in its own savepoint, so one that fails is rolled back alone
+// and the others are still committed.
+func (s *SQLiteContextStore) commitBatch(batch []*pendingWrite) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errs := make([]error, len(batch))
+	err := func() (err error) {
+		defer sqlitex.Save(s.conn)(&err)
+		for i, write := range batch {
+			errs[i] = s.storeInSavepoint(write)
+		}
+		return nil
+	}()
+	for i, write := range batch {
+		if err != nil && errs[i] == nil {
+			errs[i] = fmt.Errorf("failed to commit write batch: %w", err)
+		}
+		write.done <- errs[i]
+	}
+}
+
+// storeInSavepoint writes one entry of a group, rolling it back if it fails
+func (s *SQLiteContextStore) storeInSavepoint(write *pendingWrite) (err error) {
+	defer sqlitex.Save(s.conn)(&err)
+	return s.store(write.namespace, write.id, write.summaryText, write.embedding, write.timestamp)
+}
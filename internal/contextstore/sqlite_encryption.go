@@ -0,0 +1,205 @@
+//go:build cgo && !purego
+
+package contextstore
+
+import (
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"time"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+// SetKeyring sets the master keys used to read and write encrypted
+// namespaces. Each namespace the keyring encrypts that has no data key yet
+// gets one, and its entries, visible, cleared and quarantined, are encrypted
+// in place. A namespace that already has a data key keeps it, whichever
+// master key wraps it. A nil keyring leaves every encrypted namespace
+// locked.
+func (s *SQLiteContextStore) SetKeyring(keyring *Keyring) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keyring = keyring
+	if keyring == nil {
+		return nil
+	}
+
+	defer sqlitex.Save(s.conn)(&err)
+
+	for _, namespace := range keyring.Namespaces() {
+		key, err := s.dataKey(namespace)
+		if err != nil {
+			return err
+		}
+		if key != nil {
+			continue
+		}
+
+		key, masterID, wrapped, err := keyring.newDataKey(namespace)
+		if err != nil {
+			return err
+		}
+		err = sqlitex.Exec(s.conn, `INSERT INTO namespace_keys (namespace, master_key_id, wrapped_key, created_at) VALUES (?, ?, ?, ?);`, nil,
+			namespace, masterID, wrapped, time.Now().Unix())
+		if err != nil {
+			return fmt.Errorf("failed to store data key of %s: %w", namespace, err)
+		}
+		if err := s.encryptNamespace(key, namespace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encryptNamespace encrypts the summaries and titles of every entry of
+// namespace that was stored before the namespace had a data key
+func (s *SQLiteContextStore) encryptNamespace(key cipher.AEAD, namespace string) error {
+	tables := []string{"context_memory", "context_cleared"}
+	if namespace == DefaultNamespace {
+		// Quarantined entries join the default namespace when released
+		tables = append(tables, "context_quarantine")
+	}
+
+	for _, table := range tables {
+		query := `SELECT id, summary_text FROM ` + table + ` WHERE namespace = ?;`
+		args := []interface{}{namespace}
+		if table == "context_quarantine" {
+			query, args = `SELECT id, summary_text FROM context_quarantine;`, nil
+		}
+
+		summaries := make(map[string]string)
+		err := sqlitex.Exec(s.conn, query, func(stmt *sqlite.Stmt) error {
+			summaries[stmt.ColumnText(0)] = stmt.ColumnText(1)
+			return nil
+		}, args...)
+		if err != nil {
+			return fmt.Errorf("failed to read %s entries of %s: %w", table, namespace, err)
+		}
+
+		for id, summary := range summaries {
+			err = sqlitex.Exec(s.conn, `UPDATE `+table+` SET summary_text = ? WHERE id = ?;`, nil,
+				sealSummary(key, namespace, id, summary), id)
+			if err != nil {
+				return fmt.Errorf("failed to encrypt entry %s: %w", id, err)
+			}
+			if err := s.encryptTitle(key, namespace, id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// encryptTitle encrypts the title of entry id in namespace, if it has one
+func (s *SQLiteContextStore) encryptTitle(key cipher.AEAD, namespace, id string) error {
+	var title string
+	found := false
+	err := sqlitex.Exec(s.conn, `SELECT title FROM context_titles WHERE context_id = ?;`, func(stmt *sqlite.Stmt) error {
+		title = stmt.ColumnText(0)
+		found = true
+		return nil
+	}, id)
+	if err != nil {
+		return fmt.Errorf("failed to read title of entry %s: %w", id, err)
+	}
+	if !found {
+		return nil
+	}
+	err = sqlitex.Exec(s.conn, `UPDATE context_titles SET title = ? WHERE context_id = ?;`, nil,
+		sealSummary(key, namespace, titleID(id), title), id)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt title of entry %s: %w", id, err)
+	}
+	return nil
+}
+
+// dataKey returns the data key of namespace, nil if the namespace is not
+// encrypted, or an error wrapping ErrNamespaceLocked if the master key
+// wrapping it is not loaded
+func (s *SQLiteContextStore) dataKey(namespace string) (cipher.AEAD, error) {
+	var masterID string
+	var wrapped []byte
+	err := sqlitex.Exec(s.conn, `SELECT master_key_id, wrapped_key FROM namespace_keys WHERE namespace = ?;`, func(stmt *sqlite.Stmt) error {
+		masterID = stmt.ColumnText(0)
+		wrapped = make([]byte, stmt.ColumnLen(1))
+		stmt.ColumnBytes(1, wrapped)
+		return nil
+	}, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data key of %s: %w", namespace, err)
+	}
+	if wrapped == nil {
+		return nil, nil
+	}
+	return s.keyring.unwrap(namespace, masterID, wrapped)
+}
+
+// storedSummary returns summary as it is stored for entry id in namespace:
+// encrypted if the namespace has a data key
+func (s *SQLiteContextStore) storedSummary(namespace, id, summary string) (string, error) {
+	key, err := s.dataKey(namespace)
+	if err != nil || key == nil {
+		return summary, err
+	}
+	return sealSummary(key, namespace, id, summary), nil
+}
+
+// storedTitle returns title as it is stored for entry id in namespace:
+// encrypted if the namespace has a data key
+func (s *SQLiteContextStore) storedTitle(namespace, id, title string) (string, error) {
+	return s.storedSummary(namespace, titleID(id), title)
+}
+
+// titleID is the ID a title is sealed for, so a sealed title and summary
+// cannot be swapped
+func titleID(id string) string {
+	return id + "\x00title"
+}
+
+// summaryReader decrypts the summaries read by one call, looking up the
+// data key of each namespace once
+type summaryReader struct {
+	store *SQLiteContextStore
+	keys  map[string]cipher.AEAD
+	errs  map[string]error
+}
+
+// newSummaryReader returns a summaryReader for one call
+func (s *SQLiteContextStore) newSummaryReader() *summaryReader {
+	return &summaryReader{store: s, keys: make(map[string]cipher.AEAD), errs: make(map[string]error)}
+}
+
+// open returns the summary of entry id in namespace from its stored form.
+// It returns an error wrapping ErrNamespaceLocked if the namespace's data
+// key cannot be unwrapped.
+func (r *summaryReader) open(namespace, id, stored string) (string, error) {
+	key, loaded := r.keys[namespace]
+	err := r.errs[namespace]
+	if !loaded && err == nil {
+		key, err = r.store.dataKey(namespace)
+		if err != nil {
+			r.errs[namespace] = err
+		} else {
+			r.keys[namespace] = key
+		}
+	}
+	if err != nil || key == nil {
+		return stored, err
+	}
+	return openSummary(key, namespace, id, stored)
+}
+
+// openTitle returns the title of entry id in namespace from its stored form,
+// like open
+func (r *summaryReader) openTitle(namespace, id, stored string) (string, error) {
+	return r.open(namespace, titleID(id), stored)
+}
+
+// locked reports whether err means an entry's namespace is locked, so the
+// entry is skipped rather than failing the call
+func locked(err error) bool {
+	return errors.Is(err, ErrNamespaceLocked)
+}
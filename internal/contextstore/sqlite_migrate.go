@@ -0,0 +1,372 @@
+//go:build cgo && !purego
+
+package contextstore
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+// ErrMigrationVerification is returned when a migration changes the number
+// of rows it was meant to carry over. The migration is rolled back.
+var ErrMigrationVerification = errors.New("migration verification failed")
+
+// sqliteMigration is one versioned change to the SQLite schema
+type sqliteMigration struct {
+	version     int
+	description string
+	apply       func(s *SQLiteContextStore) error
+}
+
+// sqliteMigrations are applied in order to databases whose schema_version is
+// lower than their version. Add new migrations at the end and never change
+// one that has shipped.
+var sqliteMigrations = []sqliteMigration{
+	{1, "assign existing entries to the default namespace", (*SQLiteContextStore).migrateNamespaces},
+	{2, "add wrapped data keys of encrypted namespaces", (*SQLiteContextStore).migrateNamespaceKeys},
+	{3, "add retrieval queries that found nothing", (*SQLiteContextStore).migrateRetrievalGaps},
+	{4, "add the generation of each summary", (*SQLiteContextStore).migrateGenerations},
+	{5, "add pinned entries", (*SQLiteContextStore).migratePins},
+	{6, "add the title of each summary", (*SQLiteContextStore).migrateTitles},
+	{7, "index entries by namespace and time and tags by name", (*SQLiteContextStore).migrateSearchIndexes},
+	{8, "add reviews of stale entries", (*SQLiteContextStore).migrateReviews},
+	{9, "add references of entries to repository files", (*SQLiteContextStore).migrateReferences},
+	{10, "index summaries for keyword search", (*SQLiteContextStore).migrateKeywordIndex},
+	{11, "add the agent session of each entry", (*SQLiteContextStore).migrateSessions},
+	{12, "add relations between entries", (*SQLiteContextStore).migrateRelations},
+}
+
+// LatestSchemaVersion is the schema version of a fully migrated database.
+var LatestSchemaVersion = sqliteMigrations[len(sqliteMigrations)-1].version
+
+// migrate applies every migration the database has not seen yet. Each one
+// runs in its own savepoint together with its schema_version record, so a
+// failed migration leaves the database as it was.
+func (s *SQLiteContextStore) migrate() error {
+	err := sqlitex.Exec(s.conn, `
+	CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at INTEGER NOT NULL
+	);`, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create schema version table: %w", err)
+	}
+
+	current, err := s.schemaVersion()
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range sqliteMigrations {
+		if migration.version <= current {
+			continue
+		}
+		if err := s.applyMigration(migration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyMigration runs one migration and records it in schema_version
+func (s *SQLiteContextStore) applyMigration(migration sqliteMigration) (err error) {
+	defer sqlitex.Save(s.conn)(&err)
+
+	if err := migration.apply(s); err != nil {
+		return fmt.Errorf("migration %d (%s) failed: %w", migration.version, migration.description, err)
+	}
+
+	err = sqlitex.Exec(s.conn, `INSERT INTO schema_version (version, description, applied_at) VALUES (?, ?, ?);`,
+		nil, migration.version, migration.description, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", migration.version, err)
+	}
+	return nil
+}
+
+// SchemaVersion returns the version of the last migration applied to the
+// database, or 0 if none has been.
+func (s *SQLiteContextStore) SchemaVersion() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.schemaVersion()
+}
+
+// schemaVersion is SchemaVersion for callers already holding mu
+func (s *SQLiteContextStore) schemaVersion() (int, error) {
+	version := 0
+	err := sqlitex.Exec(s.conn, `SELECT COALESCE(MAX(version), 0) FROM schema_version;`, func(stmt *sqlite.Stmt) error {
+		version = stmt.ColumnInt(0)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// migrateNamespaces adds a namespace column to the entry tables and assigns
+// every existing entry, visible or cleared, to DefaultNamespace.
+func (s *SQLiteContextStore) migrateNamespaces() error {
+	for _, table := range []string{"context_memory", "context_cleared"} {
+		before, err := s.countRows(table, "")
+		if err != nil {
+			return err
+		}
+
+		hasNamespace, err := s.hasColumn(table, "namespace")
+		if err != nil {
+			return err
+		}
+		if !hasNamespace {
+			err = sqlitex.Exec(s.conn, `ALTER TABLE `+table+` ADD COLUMN namespace TEXT NOT NULL DEFAULT '`+DefaultNamespace+`';`, nil)
+			if err != nil {
+				return fmt.Errorf("failed to add namespace column to %s: %w", table, err)
+			}
+		}
+
+		err = sqlitex.Exec(s.conn, `UPDATE `+table+` SET namespace = ? WHERE namespace = '';`, nil, DefaultNamespace)
+		if err != nil {
+			return fmt.Errorf("failed to assign %s rows to the default namespace: %w", table, err)
+		}
+
+		err = sqlitex.Exec(s.conn, `CREATE INDEX IF NOT EXISTS `+table+`_namespace ON `+table+` (namespace);`, nil)
+		if err != nil {
+			return fmt.Errorf("failed to index namespace column of %s: %w", table, err)
+		}
+
+		// Every row must have been carried over into the default namespace
+		after, err := s.countRows(table, DefaultNamespace)
+		if err != nil {
+			return err
+		}
+		if after != before {
+			return fmt.Errorf("%w: %s has %d rows in namespace %q, want %d", ErrMigrationVerification, table, after, DefaultNamespace, before)
+		}
+	}
+	return nil
+}
+
+// migrateNamespaceKeys adds the table holding the data key of each encrypted
+// namespace, wrapped by a master key. Existing namespaces stay unencrypted.
+func (s *SQLiteContextStore) migrateNamespaceKeys() error {
+	err := sqlitex.Exec(s.conn, `
+	CREATE TABLE IF NOT EXISTS namespace_keys (
+		namespace TEXT PRIMARY KEY,
+		master_key_id TEXT NOT NULL,
+		wrapped_key BLOB NOT NULL,
+		created_at INTEGER NOT NULL
+	);`, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create namespace keys table: %w", err)
+	}
+	return nil
+}
+
+// migrateRetrievalGaps adds the table counting retrieval queries that found
+// nothing, per namespace and query.
+func (s *SQLiteContextStore) migrateRetrievalGaps() error {
+	err := sqlitex.Exec(s.conn, `
+	CREATE TABLE IF NOT EXISTS retrieval_gaps (
+		namespace TEXT NOT NULL,
+		query TEXT NOT NULL,
+		count INTEGER NOT NULL,
+		first_seen INTEGER NOT NULL,
+		last_seen INTEGER NOT NULL,
+		PRIMARY KEY (namespace, query)
+	);`, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create retrieval gaps table: %w", err)
+	}
+	return nil
+}
+
+// migrateGenerations adds the table recording what wrote each summary,
+// keyed by entry ID like the provenance table. Existing summaries have no
+// recorded generation.
+func (s *SQLiteContextStore) migrateGenerations() error {
+	err := sqlitex.Exec(s.conn, `
+	CREATE TABLE IF NOT EXISTS context_generations (
+		context_id TEXT PRIMARY KEY,
+		summarizer TEXT NOT NULL,
+		provider TEXT NOT NULL,
+		model TEXT NOT NULL,
+		prompt_version TEXT NOT NULL
+	);`, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create generations table: %w", err)
+	}
+	return nil
+}
+
+// migratePins adds the table of pinned entries, keyed by entry ID like the
+// tags table. No existing entry is pinned.
+func (s *SQLiteContextStore) migratePins() error {
+	err := sqlitex.Exec(s.conn, `
+	CREATE TABLE IF NOT EXISTS context_pins (
+		context_id TEXT PRIMARY KEY,
+		pinned_at INTEGER NOT NULL
+	);`, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create pins table: %w", err)
+	}
+	return nil
+}
+
+// migrateTitles adds the table of summary titles, keyed by entry ID like
+// the generations table. Existing summaries have no title.
+func (s *SQLiteContextStore) migrateTitles() error {
+	err := sqlitex.Exec(s.conn, `
+	CREATE TABLE IF NOT EXISTS context_titles (
+		context_id TEXT PRIMARY KEY,
+		title TEXT NOT NULL
+	);`, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create titles table: %w", err)
+	}
+	return nil
+}
+
+// migrateSearchIndexes adds the indexes searches filter entries with: by
+// namespace and time, by time alone, and by tag. The namespace and time
+// index replaces the namespace index of migration 1.
+func (s *SQLiteContextStore) migrateSearchIndexes() error {
+	err := sqlitex.ExecScript(s.conn, `
+	DROP INDEX IF EXISTS context_memory_namespace;
+	CREATE INDEX IF NOT EXISTS context_memory_namespace_timestamp ON context_memory (namespace, timestamp);
+	CREATE INDEX IF NOT EXISTS context_memory_timestamp ON context_memory (timestamp);
+	CREATE INDEX IF NOT EXISTS context_tags_tag ON context_tags (tag, context_id);`)
+	if err != nil {
+		return fmt.Errorf("failed to create search indexes: %w", err)
+	}
+	return nil
+}
+
+// migrateReviews adds the table recording the reviews of stale entries. It
+// has no foreign key, so the review that retired an entry outlives it.
+func (s *SQLiteContextStore) migrateReviews() error {
+	err := sqlitex.ExecScript(s.conn, `
+	CREATE TABLE IF NOT EXISTS context_reviews (
+		context_id TEXT NOT NULL,
+		action TEXT NOT NULL,
+		reviewer TEXT NOT NULL,
+		note TEXT NOT NULL,
+		reviewed_at INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS context_reviews_context_id ON context_reviews (context_id, reviewed_at);`)
+	if err != nil {
+		return fmt.Errorf("failed to create reviews table: %w", err)
+	}
+	return nil
+}
+
+// migrateReferences adds the table recording which repository files and
+// symbols each entry mentions, keyed by entry ID like the tags table and
+// indexed by file for ListReferencing. An empty symbol references the file
+// itself.
+func (s *SQLiteContextStore) migrateReferences() error {
+	err := sqlitex.ExecScript(s.conn, `
+	CREATE TABLE IF NOT EXISTS context_references (
+		context_id TEXT NOT NULL,
+		path TEXT NOT NULL,
+		symbol TEXT NOT NULL,
+		PRIMARY KEY (context_id, path, symbol)
+	);
+	CREATE INDEX IF NOT EXISTS context_references_path ON context_references (path, context_id);`)
+	if err != nil {
+		return fmt.Errorf("failed to create references table: %w", err)
+	}
+	return nil
+}
+
+// migrateKeywordIndex adds the FTS5 index SearchKeywords searches, keyed by
+// the rowid of each entry and kept up to date by triggers, and indexes the
+// existing entries. Summaries of encrypted namespaces are left out, since
+// the index would hold their words in the clear.
+func (s *SQLiteContextStore) migrateKeywordIndex() error {
+	err := sqlitex.ExecScript(s.conn, `
+	CREATE VIRTUAL TABLE IF NOT EXISTS context_fts USING fts5(summary_text, tokenize = "unicode61 tokenchars '_'");
+	CREATE TRIGGER IF NOT EXISTS context_fts_insert AFTER INSERT ON context_memory
+	WHEN new.namespace NOT IN (SELECT namespace FROM namespace_keys)
+	BEGIN
+		INSERT INTO context_fts (rowid, summary_text) VALUES (new.rowid, new.summary_text);
+	END;
+	CREATE TRIGGER IF NOT EXISTS context_fts_delete AFTER DELETE ON context_memory
+	BEGIN
+		DELETE FROM context_fts WHERE rowid = old.rowid;
+	END;
+	CREATE TRIGGER IF NOT EXISTS context_fts_update AFTER UPDATE OF summary_text, namespace ON context_memory
+	BEGIN
+		DELETE FROM context_fts WHERE rowid = old.rowid;
+		INSERT INTO context_fts (rowid, summary_text) SELECT new.rowid, new.summary_text
+		WHERE new.namespace NOT IN (SELECT namespace FROM namespace_keys);
+	END;
+	DELETE FROM context_fts;
+	INSERT INTO context_fts (rowid, summary_text) SELECT rowid, summary_text FROM context_memory
+	WHERE namespace NOT IN (SELECT namespace FROM namespace_keys);`)
+	if err != nil {
+		return fmt.Errorf("failed to create keyword index: %w", err)
+	}
+	return nil
+}
+
+// migrateSessions adds the table recording the agent session that saved
+// each entry, keyed by entry ID like the batches table and indexed by
+// session for searches and expiry. Existing entries have no session.
+func (s *SQLiteContextStore) migrateSessions() error {
+	err := sqlitex.ExecScript(s.conn, `
+	CREATE TABLE IF NOT EXISTS context_sessions (
+		context_id TEXT PRIMARY KEY,
+		session_id TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS context_sessions_session_id ON context_sessions (session_id, context_id);`)
+	if err != nil {
+		return fmt.Errorf("failed to create sessions table: %w", err)
+	}
+	return nil
+}
+
+// migrateRelations adds the table of typed links between entries. Its key
+// covers lookups from an entry and the index lookups to one, so relations
+// can be listed and removed from either end.
+func (s *SQLiteContextStore) migrateRelations() error {
+	err := sqlitex.ExecScript(s.conn, `
+	CREATE TABLE IF NOT EXISTS context_relations (
+		entry_id TEXT NOT NULL,
+		related_id TEXT NOT NULL,
+		relation_type TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		PRIMARY KEY (entry_id, related_id, relation_type)
+	);
+	CREATE INDEX IF NOT EXISTS context_relations_related_id ON context_relations (related_id);`)
+	if err != nil {
+		return fmt.Errorf("failed to create relations table: %w", err)
+	}
+	return nil
+}
+
+// countRows counts the rows of table, only those in namespace if it is set
+func (s *SQLiteContextStore) countRows(table, namespace string) (int, error) {
+	query := `SELECT COUNT(*) FROM ` + table + `;`
+	var args []interface{}
+	if namespace != "" {
+		query = `SELECT COUNT(*) FROM ` + table + ` WHERE namespace = ?;`
+		args = append(args, namespace)
+	}
+
+	count := 0
+	err := sqlitex.Exec(s.conn, query, func(stmt *sqlite.Stmt) error {
+		count = stmt.ColumnInt(0)
+		return nil
+	}, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count rows of %s: %w", table, err)
+	}
+	return count, nil
+}
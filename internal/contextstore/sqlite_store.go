@@ -1,11 +1,18 @@
+//go:build cgo && !purego
+
 package contextstore
 
 import (
+	"cmp"
 	"fmt"
-	"sort"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
 	"github.com/localrivet/projectmemory/internal/vector"
 )
 
@@ -13,8 +20,49 @@ import (
 type SQLiteContextStore struct {
 	conn   *sqlite.Conn
 	dbPath string
+
+	// mu serializes every use of conn. A crawshaw connection must not be
+	// used by two goroutines at once, and tool calls, quick captures and
+	// scheduled reports all reach the store from their own goroutines.
+	mu sync.Mutex
+
+	// keyring unwraps the data keys of encrypted namespaces
+	keyring *Keyring
+
+	// batcher groups the entries written at the same time into one
+	// transaction. nil commits each on its own.
+	batcher atomic.Pointer[writeBatcher]
 }
 
+var (
+	_ ScoredSearcher  = (*SQLiteContextStore)(nil)
+	_ KeywordSearcher = (*SQLiteContextStore)(nil)
+	_ TaggedStore     = (*SQLiteContextStore)(nil)
+	_ UsageStore      = (*SQLiteContextStore)(nil)
+	_ SoftClearer     = (*SQLiteContextStore)(nil)
+	_ QuarantineStore = (*SQLiteContextStore)(nil)
+	_ ProvenanceStore = (*SQLiteContextStore)(nil)
+	_ IdleReleaser    = (*SQLiteContextStore)(nil)
+	_ SnapshotHasher  = (*SQLiteContextStore)(nil)
+	_ BatchStore      = (*SQLiteContextStore)(nil)
+	_ SessionStore    = (*SQLiteContextStore)(nil)
+	_ RelationStore   = (*SQLiteContextStore)(nil)
+	_ GapStore        = (*SQLiteContextStore)(nil)
+	_ ReviewStore     = (*SQLiteContextStore)(nil)
+	_ GenerationStore = (*SQLiteContextStore)(nil)
+	_ TitleStore      = (*SQLiteContextStore)(nil)
+	_ PinStore        = (*SQLiteContextStore)(nil)
+	_ ReferenceStore  = (*SQLiteContextStore)(nil)
+	_ Pinger          = (*SQLiteContextStore)(nil)
+
+	_ NamespacedStore   = (*SQLiteContextStore)(nil)
+	_ NamespaceArchiver = (*SQLiteContextStore)(nil)
+	_ EncryptedStore    = (*SQLiteContextStore)(nil)
+)
+
+// SQLiteContextStore also persists embeddings for vector.CachedEmbedder.
+var _ vector.EmbeddingCacheStore = (*SQLiteContextStore)(nil)
+
 // NewSQLiteContextStore creates a new SQLiteContextStore instance.
 func NewSQLiteContextStore() *SQLiteContextStore {
 	return &SQLiteContextStore{}
@@ -22,6 +70,9 @@ func NewSQLiteContextStore() *SQLiteContextStore {
 
 // Initialize initializes the store with the given database path.
 func (s *SQLiteContextStore) Initialize(dbPath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.dbPath = dbPath
 
 	// Open the SQLite database
@@ -39,6 +90,12 @@ func (s *SQLiteContextStore) Initialize(dbPath string) error {
 		return fmt.Errorf("failed to create table: %w", err)
 	}
 
+	// Bring databases created by older versions up to date
+	if err := s.migrate(); err != nil {
+		s.conn.Close()
+		return fmt.Errorf("failed to migrate schema: %w", err)
+	}
+
 	return nil
 }
 
@@ -63,23 +120,340 @@ func (s *SQLiteContextStore) createTable() error {
 		return fmt.Errorf("failed to execute create table statement: %w", err)
 	}
 
+	// Create the embedding cache table used by vector.CachedEmbedder
+	createCacheTableSQL := `
+	CREATE TABLE IF NOT EXISTS embedding_cache (
+		cache_key TEXT PRIMARY KEY,
+		embedding BLOB NOT NULL,
+		created_at INTEGER NOT NULL
+	);`
+
+	cacheStmt, err := s.conn.Prepare(createCacheTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to prepare create embedding cache table statement: %w", err)
+	}
+	defer cacheStmt.Reset()
+
+	_, err = cacheStmt.Step()
+	if err != nil {
+		return fmt.Errorf("failed to execute create embedding cache table statement: %w", err)
+	}
+
+	// Create the tags table. Tags are keyed by entry ID so they survive
+	// INSERT OR REPLACE of the entry itself
+	createTagsTableSQL := `
+	CREATE TABLE IF NOT EXISTS context_tags (
+		context_id TEXT NOT NULL,
+		tag TEXT NOT NULL,
+		PRIMARY KEY (context_id, tag)
+	);`
+
+	tagsStmt, err := s.conn.Prepare(createTagsTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to prepare create tags table statement: %w", err)
+	}
+	defer tagsStmt.Reset()
+
+	_, err = tagsStmt.Step()
+	if err != nil {
+		return fmt.Errorf("failed to execute create tags table statement: %w", err)
+	}
+
+	// Create the usage table, keyed by entry ID like the tags table
+	createUsageTableSQL := `
+	CREATE TABLE IF NOT EXISTS context_usage (
+		context_id TEXT PRIMARY KEY,
+		retrievals INTEGER NOT NULL,
+		last_retrieved INTEGER NOT NULL
+	);`
+
+	usageStmt, err := s.conn.Prepare(createUsageTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to prepare create usage table statement: %w", err)
+	}
+	defer usageStmt.Reset()
+
+	_, err = usageStmt.Step()
+	if err != nil {
+		return fmt.Errorf("failed to execute create usage table statement: %w", err)
+	}
+
+	// Create the table holding entries hidden by MarkCleared. Their tags
+	// and usage stay in the tags and usage tables until they are purged
+	createClearedTableSQL := `
+	CREATE TABLE IF NOT EXISTS context_cleared (
+		id TEXT PRIMARY KEY,
+		summary_text TEXT NOT NULL,
+		embedding BLOB NOT NULL,
+		timestamp INTEGER NOT NULL,
+		norm REAL,
+		cleared_at INTEGER NOT NULL
+	);`
+
+	clearedStmt, err := s.conn.Prepare(createClearedTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to prepare create cleared table statement: %w", err)
+	}
+	defer clearedStmt.Reset()
+
+	_, err = clearedStmt.Step()
+	if err != nil {
+		return fmt.Errorf("failed to execute create cleared table statement: %w", err)
+	}
+
+	// Create the table holding entries embedded by a fallback provider.
+	// Their tags are kept in the tags table like everyone else's
+	createQuarantineTableSQL := `
+	CREATE TABLE IF NOT EXISTS context_quarantine (
+		id TEXT PRIMARY KEY,
+		summary_text TEXT NOT NULL,
+		embedding BLOB NOT NULL,
+		timestamp INTEGER NOT NULL,
+		provider TEXT NOT NULL
+	);`
+
+	if err := sqlitex.Exec(s.conn, createQuarantineTableSQL, nil); err != nil {
+		return fmt.Errorf("failed to execute create quarantine table statement: %w", err)
+	}
+
+	// Create the provenance table, keyed by entry ID like the tags table
+	createProvenanceTableSQL := `
+	CREATE TABLE IF NOT EXISTS context_provenance (
+		context_id TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		source TEXT NOT NULL,
+		PRIMARY KEY (context_id, position)
+	);`
+
+	if err := sqlitex.Exec(s.conn, createProvenanceTableSQL, nil); err != nil {
+		return fmt.Errorf("failed to execute create provenance table statement: %w", err)
+	}
+
+	// Create the batch table, keyed by entry ID like the tags table and
+	// indexed by batch for rollbacks
+	createBatchesTableSQL := `
+	CREATE TABLE IF NOT EXISTS context_batches (
+		context_id TEXT PRIMARY KEY,
+		batch_id TEXT NOT NULL
+	);`
+
+	if err := sqlitex.Exec(s.conn, createBatchesTableSQL, nil); err != nil {
+		return fmt.Errorf("failed to execute create batches table statement: %w", err)
+	}
+	if err := sqlitex.Exec(s.conn, `CREATE INDEX IF NOT EXISTS context_batches_batch_id ON context_batches (batch_id);`, nil); err != nil {
+		return fmt.Errorf("failed to execute create batches index statement: %w", err)
+	}
+
+	return s.addNormColumn()
+}
+
+// addNormColumn adds the norm column to databases created before it existed
+// and fills it in for existing rows.
+func (s *SQLiteContextStore) addNormColumn() error {
+	hasNorm, err := s.hasColumn("context_memory", "norm")
+	if err != nil {
+		return err
+	}
+	if hasNorm {
+		return nil
+	}
+
+	alterStmt, err := s.conn.Prepare(`ALTER TABLE context_memory ADD COLUMN norm REAL;`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare add norm column statement: %w", err)
+	}
+	defer alterStmt.Reset()
+
+	if _, err := alterStmt.Step(); err != nil {
+		return fmt.Errorf("failed to add norm column: %w", err)
+	}
+
+	return s.backfillNorms()
+}
+
+// hasColumn reports whether table has the named column
+func (s *SQLiteContextStore) hasColumn(table, column string) (bool, error) {
+	infoStmt, err := s.conn.Prepare(`PRAGMA table_info(` + table + `);`)
+	if err != nil {
+		return false, fmt.Errorf("failed to prepare table info statement: %w", err)
+	}
+	defer infoStmt.Reset()
+
+	for {
+		hasRow, err := infoStmt.Step()
+		if err != nil {
+			return false, fmt.Errorf("failed to read table info: %w", err)
+		}
+		if !hasRow {
+			return false, nil
+		}
+		// Column 1 of table_info is the column name
+		if infoStmt.ColumnText(1) == column {
+			return true, nil
+		}
+	}
+}
+
+// backfillNorms computes the norm of every row that does not have one yet
+func (s *SQLiteContextStore) backfillNorms() (err error) {
+	defer sqlitex.Save(s.conn)(&err)
+
+	selectStmt, err := s.conn.Prepare(`SELECT id, embedding FROM context_memory WHERE norm IS NULL;`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare select embeddings statement: %w", err)
+	}
+	defer selectStmt.Reset()
+
+	norms := make(map[string]float64)
+	for {
+		hasRow, err := selectStmt.Step()
+		if err != nil {
+			return fmt.Errorf("failed to select embeddings: %w", err)
+		}
+		if !hasRow {
+			break
+		}
+
+		embeddingBytes := make([]byte, selectStmt.ColumnLen(1))
+		selectStmt.ColumnBytes(1, embeddingBytes)
+
+		// Rows whose embedding cannot be decoded keep a NULL norm and
+		// report the decoding error when searched, as before
+		if norm, ok := embeddingNorm(embeddingBytes); ok {
+			norms[selectStmt.ColumnText(0)] = norm
+		}
+	}
+
+	updateStmt, err := s.conn.Prepare(`UPDATE context_memory SET norm = ? WHERE id = ?;`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare update norm statement: %w", err)
+	}
+	for id, norm := range norms {
+		updateStmt.BindFloat(1, norm)
+		updateStmt.BindText(2, id)
+		_, err = updateStmt.Step()
+		updateStmt.Reset()
+		if err != nil {
+			return fmt.Errorf("failed to update norm for entry %s: %w", id, err)
+		}
+	}
+
 	return nil
 }
 
-// Close closes the store and releases any resources.
+// Close closes the store and releases any resources. Entries being written
+// in a group are committed first.
 func (s *SQLiteContextStore) Close() error {
+	s.stopWriteBatching()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.conn != nil {
-		return s.conn.Close()
+		conn := s.conn
+		s.conn = nil
+		return conn.Close()
+	}
+	return nil
+}
+
+// Ping reads the schema of the entries table, failing if the store is not
+// open or the database is no longer readable.
+func (s *SQLiteContextStore) Ping() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return fmt.Errorf("store is not open")
+	}
+	if err := sqlitex.Exec(s.conn, `SELECT 1 FROM context_memory LIMIT 0;`, nil); err != nil {
+		return fmt.Errorf("failed to reach database: %w", err)
+	}
+	return nil
+}
+
+// ReleaseIdle checkpoints and truncates the write-ahead log, if the
+// database uses one, and gives back the connection's page cache memory.
+func (s *SQLiteContextStore) ReleaseIdle() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	if err := sqlitex.Exec(s.conn, `PRAGMA wal_checkpoint(TRUNCATE);`, nil); err != nil {
+		return fmt.Errorf("failed to checkpoint write-ahead log: %w", err)
+	}
+	if err := sqlitex.Exec(s.conn, `PRAGMA shrink_memory;`, nil); err != nil {
+		return fmt.Errorf("failed to shrink memory: %w", err)
 	}
 	return nil
 }
 
-// Store stores the context data in the database.
+// Store stores the context data in the database, in the namespace the ID
+// is already stored in or else in DefaultNamespace.
 func (s *SQLiteContextStore) Store(id string, summaryText string, embedding []byte, timestamp time.Time) error {
-	// Insert or replace the context entry
+	if batcher := s.batcher.Load(); batcher != nil {
+		return batcher.write(&pendingWrite{id: id, summaryText: summaryText, embedding: embedding, timestamp: timestamp})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store("", id, summaryText, embedding, timestamp)
+}
+
+// StoreInNamespace stores the context data in namespace, moving the entry
+// there if its ID is stored in another namespace.
+func (s *SQLiteContextStore) StoreInNamespace(namespace string, id string, summaryText string, embedding []byte, timestamp time.Time) error {
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	if batcher := s.batcher.Load(); batcher != nil {
+		return batcher.write(&pendingWrite{namespace: namespace, id: id, summaryText: summaryText, embedding: embedding, timestamp: timestamp})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store(namespace, id, summaryText, embedding, timestamp)
+}
+
+// store is StoreInNamespace for callers already holding mu. An empty
+// namespace keeps the namespace of a stored ID, as Store does.
+func (s *SQLiteContextStore) store(namespace string, id string, summaryText string, embedding []byte, timestamp time.Time) error {
+	if s.conn == nil {
+		return ErrStoreClosed
+	}
+	previous, err := s.entryNamespace(id)
+	if err != nil {
+		return err
+	}
+	if namespace == "" {
+		namespace = previous
+	}
+
+	// A title sealed for the namespace the entry leaves cannot be opened in
+	// the new one
+	if namespace != previous {
+		if err := s.deleteTitle(id); err != nil {
+			return err
+		}
+	}
+
+	// The summary is encrypted if the namespace is
+	summaryText, err = s.storedSummary(namespace, id, summaryText)
+	if err != nil {
+		return err
+	}
+
+	// Insert or update the context entry. Updating in place keeps its
+	// rowid, which keys it in the keyword index.
 	insertSQL := `
-	INSERT OR REPLACE INTO context_memory (id, summary_text, embedding, timestamp)
-	VALUES (?, ?, ?, ?);`
+	INSERT INTO context_memory (id, summary_text, embedding, timestamp, norm, namespace)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT (id) DO UPDATE SET summary_text = excluded.summary_text, embedding = excluded.embedding,
+		timestamp = excluded.timestamp, norm = excluded.norm, namespace = excluded.namespace;`
 
 	stmt, err := s.conn.Prepare(insertSQL)
 	if err != nil {
@@ -93,6 +467,14 @@ func (s *SQLiteContextStore) Store(id string, summaryText string, embedding []by
 	stmt.BindBytes(3, embedding)
 	stmt.BindInt64(4, timestamp.Unix())
 
+	// Store the norm so searches only need the dot product
+	if norm, ok := embeddingNorm(embedding); ok {
+		stmt.BindFloat(5, norm)
+	} else {
+		stmt.BindNull(5)
+	}
+	stmt.BindText(6, namespace)
+
 	// Execute the statement
 	_, err = stmt.Step()
 	if err != nil {
@@ -102,32 +484,70 @@ func (s *SQLiteContextStore) Store(id string, summaryText string, embedding []by
 	return nil
 }
 
+// entryNamespace returns the namespace of a stored entry, DefaultNamespace
+// if the ID is not stored
+func (s *SQLiteContextStore) entryNamespace(id string) (string, error) {
+	namespace := DefaultNamespace
+	err := sqlitex.Exec(s.conn, `SELECT namespace FROM context_memory WHERE id = ?;`, func(stmt *sqlite.Stmt) error {
+		namespace = stmt.ColumnText(0)
+		return nil
+	}, id)
+	if err != nil {
+		return "", fmt.Errorf("failed to read namespace of context entry: %w", err)
+	}
+	return namespace, nil
+}
+
 // Search searches for context entries similar to the given embedding.
 func (s *SQLiteContextStore) Search(queryEmbedding []float32, limit int) ([]string, error) {
-	// First, convert query embedding to bytes for debugging purposes
-	// (won't be used directly for search as we'll do similarity calculations in Go)
-	_, err := vector.Float32SliceToBytes(queryEmbedding)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results, err := s.searchWithScores(queryEmbedding, limit, SearchFilter{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to convert query embedding to bytes: %w", err)
+		return nil, err
 	}
 
-	// Retrieve all entries from the database
-	selectSQL := `
-	SELECT id, summary_text, embedding FROM context_memory
-	ORDER BY timestamp DESC;`
+	// Extract the top summaries
+	topSummaries := make([]string, len(results))
+	for i, result := range results {
+		topSummaries[i] = result.SummaryText
+	}
 
-	stmt, err := s.conn.Prepare(selectSQL)
+	return topSummaries, nil
+}
+
+// SearchWithScores is Search with the similarity of each result. Entries
+// excluded by filter are skipped.
+func (s *SQLiteContextStore) SearchWithScores(queryEmbedding []float32, limit int, filter SearchFilter) ([]SearchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.searchWithScores(queryEmbedding, limit, filter)
+}
+
+// searchWithScores is SearchWithScores for callers already holding mu
+func (s *SQLiteContextStore) searchWithScores(queryEmbedding []float32, limit int, filter SearchFilter) ([]SearchResult, error) {
+	queryNorm := vector.Norm(queryEmbedding)
+
+	exclusions := filter.compile()
+
+	// Namespace, pins, tags and time are filtered by the database, through
+	// its indexes, so only the remaining entries are read and scored. The
+	// statement is cached, so searches with the same kind of filter reuse it.
+	query, args := searchQuery(filter)
+	stmt, err := s.conn.Prepare(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to prepare select statement: %w", err)
 	}
+	defer stmt.ClearBindings()
 	defer stmt.Reset()
+	bindArgs(stmt, args)
 
-	// Maps to store results for sorting
-	type Result struct {
-		SummaryText string
-		Similarity  float64
-	}
-	var results []Result
+	var results []SearchResult
+	summaries := s.newSummaryReader()
+	buffer := searchBuffers.Get().(*searchBuffer)
+	defer searchBuffers.Put(buffer)
 
 	// Execute the query and process results
 	for {
@@ -142,123 +562,1838 @@ func (s *SQLiteContextStore) Search(queryEmbedding []float32, limit int) ([]stri
 		// Get values from the current row
 		// Column indices are 0-based
 		id := stmt.ColumnText(0)
-		summaryText := stmt.ColumnText(1)
+		summaryText, err := summaries.open(stmt.ColumnText(5), id, stmt.ColumnText(1))
+		if locked(err) {
+			// Entries of namespaces this server holds no key for are not found
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if exclusions.ids[id] || exclusions.excludesSummary(summaryText) {
+			continue
+		}
 
-		// For binary data, we need to create a buffer and use ColumnBytes to fill it
-		embeddingBytesLen := stmt.ColumnLen(2)
-		embeddingBytes := make([]byte, embeddingBytesLen)
+		// Copy the embedding out of the row and decode it, both into the
+		// search's buffer
+		embeddingBytes := buffer.bytes(stmt.ColumnLen(2))
 		stmt.ColumnBytes(2, embeddingBytes)
-
-		// Convert embedding bytes to float32 slice
-		storedEmbedding, err := vector.BytesToFloat32Slice(embeddingBytes)
+		buffer.vector, err = vector.DecodeFloat32s(buffer.vector, embeddingBytes)
 		if err != nil {
 			return nil, fmt.Errorf("failed to convert embedding bytes for entry %s: %w", id, err)
 		}
 
-		// Calculate cosine similarity
-		similarity, err := vector.CosineSimilarity(queryEmbedding, storedEmbedding)
+		// Calculate cosine similarity, using the stored norm when there is one
+		var similarity float64
+		if stmt.ColumnType(4) == sqlite.SQLITE_NULL {
+			similarity, err = vector.CosineSimilarity(queryEmbedding, buffer.vector)
+		} else {
+			similarity, err = vector.CosineSimilarityWithNorms(queryEmbedding, buffer.vector, queryNorm, stmt.ColumnFloat(4))
+		}
 		if err != nil {
 			return nil, fmt.Errorf("failed to calculate similarity for entry %s: %w", id, err)
 		}
 
 		// Add to results
-		results = append(results, Result{
+		results = append(results, SearchResult{
+			ID:          id,
 			SummaryText: summaryText,
+			Timestamp:   time.Unix(stmt.ColumnInt64(3), 0),
 			Similarity:  similarity,
 		})
 	}
 
-	// Sort results by similarity (highest first)
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].Similarity > results[j].Similarity
+	// Sort results by similarity (highest first). The sort is stable so ties
+	// keep the query order: newest first, then by ID
+	slices.SortStableFunc(results, func(a, b SearchResult) int {
+		return cmp.Compare(b.Similarity, a.Similarity)
 	})
 
 	// If limit is greater than available results, adjust it
 	if limit > len(results) {
 		limit = len(results)
 	}
-
-	// Extract the top summaries
-	topSummaries := make([]string, limit)
-	for i := 0; i < limit; i++ {
-		if i < len(results) {
-			topSummaries[i] = results[i].SummaryText
-		}
+	if limit < 0 {
+		limit = 0
 	}
 
-	return topSummaries, nil
+	return results[:limit], nil
 }
 
-// Delete deletes a specific context entry from the store by ID.
-func (s *SQLiteContextStore) Delete(id string) error {
-	deleteSQL := `DELETE FROM context_memory WHERE id = ?;`
+// SearchKeywords implements KeywordSearcher with the FTS5 index of the
+// summaries. BM25 weighs words by how rare they are across every indexed
+// summary, not only those filter keeps. Entries of encrypted namespaces are
+// not indexed, so they are never found.
+func (s *SQLiteContextStore) SearchKeywords(query string, limit int, filter SearchFilter) ([]SearchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	stmt, err := s.conn.Prepare(deleteSQL)
+	match := keywordMatch(query)
+	if match == "" || limit <= 0 {
+		return nil, nil
+	}
+	conditions, args := searchConditions(filter)
+	statement := `SELECT m.id, m.summary_text, m.timestamp, -bm25(context_fts), m.namespace
+	FROM context_fts JOIN context_memory m ON m.rowid = context_fts.rowid
+	WHERE ` + strings.Join(append([]string{`context_fts MATCH ?`}, conditions...), ` AND `) + `
+	ORDER BY bm25(context_fts), m.timestamp DESC, m.id ASC;`
+	stmt, err := s.conn.Prepare(statement)
 	if err != nil {
-		return fmt.Errorf("failed to prepare delete statement: %w", err)
+		return nil, fmt.Errorf("failed to prepare keyword search statement: %w", err)
 	}
+	defer stmt.ClearBindings()
 	defer stmt.Reset()
+	bindArgs(stmt, append([]any{match}, args...))
 
-	// Bind parameter
-	stmt.BindText(1, id)
+	exclusions := filter.compile()
+	summaries := s.newSummaryReader()
+	var results []SearchResult
+	for len(results) < limit {
+		hasRow, err := stmt.Step()
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute keyword search statement: %w", err)
+		}
+		if !hasRow {
+			break
+		}
+		id := stmt.ColumnText(0)
+		summaryText, err := summaries.open(stmt.ColumnText(4), id, stmt.ColumnText(1))
+		if locked(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if exclusions.ids[id] || exclusions.excludesSummary(summaryText) {
+			continue
+		}
+		results = append(results, SearchResult{
+			ID:          id,
+			SummaryText: summaryText,
+			Timestamp:   time.Unix(stmt.ColumnInt64(2), 0),
+			Similarity:  stmt.ColumnFloat(3),
+		})
+	}
+	return results, nil
+}
 
-	// Execute the statement
-	_, err = stmt.Step()
-	if err != nil {
-		return fmt.Errorf("failed to delete context entry: %w", err)
+// keywordMatch returns the FTS5 query matching summaries that contain any
+// word of query, each quoted so no word is read as an operator. It is
+// empty if query has no words.
+func keywordMatch(query string) string {
+	terms := keywordTerms(query)
+	for i, term := range terms {
+		terms[i] = `"` + term + `"`
 	}
+	return strings.Join(terms, " OR ")
+}
 
-	// Check if any rows were affected
-	changes := s.conn.Changes()
-	if changes == 0 {
-		return fmt.Errorf("no context entry found with ID: %s", id)
+// searchQuery builds the statement selecting the entries a search with
+// filter scores, newest first, and its arguments. Only the conditions the
+// filter sets are included, so SQLite can pick the index that fits them.
+// Excluded IDs and hashes are left to the caller.
+func searchQuery(filter SearchFilter) (string, []any) {
+	conditions, args := searchConditions(filter)
+	query := `SELECT m.id, m.summary_text, m.embedding, m.timestamp, m.norm, m.namespace FROM context_memory m`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, ` AND `)
 	}
+	return query + ` ORDER BY m.timestamp DESC, m.id ASC;`, args
+}
 
-	return nil
+// searchConditions returns the conditions on the entries m of a search
+// with filter, and their arguments
+func searchConditions(filter SearchFilter) ([]string, []any) {
+	var conditions []string
+	var args []any
+	if filter.Namespace != "" {
+		conditions = append(conditions, `m.namespace = ?`)
+		args = append(args, filter.Namespace)
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, `m.timestamp >= ?`)
+		args = append(args, filter.Since.Unix())
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, `m.timestamp < ?`)
+		args = append(args, filter.Until.Unix())
+	}
+	if filter.Pinned {
+		conditions = append(conditions, `m.id IN (SELECT context_id FROM context_pins)`)
+	}
+	if filter.Session != "" {
+		conditions = append(conditions, `m.id IN (SELECT context_id FROM context_sessions WHERE session_id = ?)`)
+		args = append(args, filter.Session)
+	}
+	if tags := NormalizeTags(filter.Tags); len(tags) > 0 {
+		conditions = append(conditions, `m.id IN (SELECT context_id FROM context_tags WHERE tag IN (`+placeholders(len(tags))+`))`)
+		for _, tag := range tags {
+			args = append(args, tag)
+		}
+	}
+	if tags := NormalizeTags(filter.ExcludeTags); len(tags) > 0 {
+		conditions = append(conditions, `NOT EXISTS (SELECT 1 FROM context_tags t WHERE t.context_id = m.id AND t.tag IN (`+placeholders(len(tags))+`))`)
+		for _, tag := range tags {
+			args = append(args, tag)
+		}
+	}
+
+	return conditions, args
 }
 
-// Clear removes all context entries from the store.
-// Returns the number of entries that were deleted.
-func (s *SQLiteContextStore) Clear() (int, error) {
-	deleteSQL := `DELETE FROM context_memory;`
+// placeholders returns n comma-separated parameters
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
 
-	stmt, err := s.conn.Prepare(deleteSQL)
-	if err != nil {
-		return 0, fmt.Errorf("failed to prepare delete all statement: %w", err)
+// bindArgs binds args, strings and int64s, to the parameters of stmt
+func bindArgs(stmt *sqlite.Stmt, args []any) {
+	for i, arg := range args {
+		switch arg := arg.(type) {
+		case string:
+			stmt.BindText(i+1, arg)
+		case int64:
+			stmt.BindInt64(i+1, arg)
+		}
 	}
-	defer stmt.Reset()
+}
 
-	// Execute the statement
-	_, err = stmt.Step()
+// ExplainSearch returns SQLite's plan for the statement a search with filter
+// runs, one line per step, to check which indexes it uses.
+func (s *SQLiteContextStore) ExplainSearch(filter SearchFilter) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query, args := searchQuery(filter)
+	var plan []string
+	err := sqlitex.ExecTransient(s.conn, `EXPLAIN QUERY PLAN `+query, func(stmt *sqlite.Stmt) error {
+		plan = append(plan, stmt.ColumnText(3))
+		return nil
+	}, args...)
 	if err != nil {
-		return 0, fmt.Errorf("failed to delete all context entries: %w", err)
+		return nil, fmt.Errorf("failed to explain search: %w", err)
 	}
-
-	// Get the number of rows affected
-	changes := s.conn.Changes()
-	return changes, nil
+	return plan, nil
 }
 
-// Replace replaces a context entry with updated information.
-func (s *SQLiteContextStore) Replace(id string, summaryText string, embedding []byte, timestamp time.Time) error {
-	// First check if the entry exists
-	checkSQL := `SELECT id FROM context_memory WHERE id = ?;`
+// exists reports whether an entry with the given ID is stored
+func (s *SQLiteContextStore) exists(id string) (bool, error) {
+	stmt, err := s.conn.Prepare(`SELECT id FROM context_memory WHERE id = ?;`)
+	if err != nil {
+		return false, fmt.Errorf("failed to prepare check statement: %w", err)
+	}
+	defer stmt.Reset()
+	stmt.BindText(1, id)
 
-	checkStmt, err := s.conn.Prepare(checkSQL)
+	hasRow, err := stmt.Step()
 	if err != nil {
-		return fmt.Errorf("failed to prepare check statement: %w", err)
+		return false, fmt.Errorf("failed to check for context entry: %w", err)
 	}
-	checkStmt.BindText(1, id)
+	return hasRow, nil
+}
 
-	hasRow, err := checkStmt.Step()
-	checkStmt.Reset()
+// SetTags replaces the tags of an existing entry.
+func (s *SQLiteContextStore) SetTags(id string, tags []string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exists, err := s.exists(id)
 	if err != nil {
-		return fmt.Errorf("failed to check for context entry: %w", err)
+		return err
 	}
-	if !hasRow {
+	if !exists {
 		return fmt.Errorf("no context entry found with ID: %s", id)
 	}
 
-	// Then perform the update
-	return s.Store(id, summaryText, embedding, timestamp)
+	defer sqlitex.Save(s.conn)(&err)
+
+	if err := s.deleteTags(id); err != nil {
+		return err
+	}
+	return s.insertTags(id, tags)
+}
+
+// insertTags adds normalized tags to an entry
+func (s *SQLiteContextStore) insertTags(id string, tags []string) error {
+	insertStmt, err := s.conn.Prepare(`INSERT INTO context_tags (context_id, tag) VALUES (?, ?);`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert tag statement: %w", err)
+	}
+	for _, tag := range NormalizeTags(tags) {
+		insertStmt.BindText(1, id)
+		insertStmt.BindText(2, tag)
+		_, err = insertStmt.Step()
+		insertStmt.Reset()
+		if err != nil {
+			return fmt.Errorf("failed to insert tag %q: %w", tag, err)
+		}
+	}
+
+	return nil
+}
+
+// GetTags returns the tags of an entry, sorted.
+func (s *SQLiteContextStore) GetTags(id string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exists, err := s.exists(id)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("no context entry found with ID: %s", id)
+	}
+
+	stmt, err := s.conn.Prepare(`SELECT tag FROM context_tags WHERE context_id = ? ORDER BY tag;`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare select tags statement: %w", err)
+	}
+	defer stmt.Reset()
+	stmt.BindText(1, id)
+
+	tags := []string{}
+	for {
+		hasRow, err := stmt.Step()
+		if err != nil {
+			return nil, fmt.Errorf("failed to select tags: %w", err)
+		}
+		if !hasRow {
+			return tags, nil
+		}
+		tags = append(tags, stmt.ColumnText(0))
+	}
+}
+
+// deleteTags removes every tag of an entry
+func (s *SQLiteContextStore) deleteTags(id string) error {
+	stmt, err := s.conn.Prepare(`DELETE FROM context_tags WHERE context_id = ?;`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare delete tags statement: %w", err)
+	}
+	defer stmt.Reset()
+	stmt.BindText(1, id)
+
+	if _, err := stmt.Step(); err != nil {
+		return fmt.Errorf("failed to delete tags: %w", err)
+	}
+	return nil
+}
+
+// SetProvenance replaces the provenance chain of an existing or
+// quarantined entry.
+func (s *SQLiteContextStore) SetProvenance(id string, chain []string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkProvenanceTarget(id); err != nil {
+		return err
+	}
+
+	defer sqlitex.Save(s.conn)(&err)
+
+	if err := s.deleteProvenance(id); err != nil {
+		return err
+	}
+
+	insertStmt, err := s.conn.Prepare(`INSERT INTO context_provenance (context_id, position, source) VALUES (?, ?, ?);`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert provenance statement: %w", err)
+	}
+	for position, source := range chain {
+		insertStmt.BindText(1, id)
+		insertStmt.BindInt64(2, int64(position))
+		insertStmt.BindText(3, source)
+		_, err = insertStmt.Step()
+		insertStmt.Reset()
+		if err != nil {
+			return fmt.Errorf("failed to insert source %q: %w", source, err)
+		}
+	}
+
+	return nil
+}
+
+// GetProvenance returns the provenance chain of an existing or quarantined
+// entry.
+func (s *SQLiteContextStore) GetProvenance(id string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkProvenanceTarget(id); err != nil {
+		return nil, err
+	}
+
+	chain := []string{}
+	err := sqlitex.Exec(s.conn, `SELECT source FROM context_provenance WHERE context_id = ? ORDER BY position;`, func(stmt *sqlite.Stmt) error {
+		chain = append(chain, stmt.ColumnText(0))
+		return nil
+	}, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select provenance: %w", err)
+	}
+	return chain, nil
+}
+
+// checkProvenanceTarget returns an error unless id is stored or quarantined
+func (s *SQLiteContextStore) checkProvenanceTarget(id string) error {
+	exists, err := s.exists(id)
+	if err != nil || exists {
+		return err
+	}
+
+	quarantined := false
+	err = sqlitex.Exec(s.conn, `SELECT id FROM context_quarantine WHERE id = ?;`, func(stmt *sqlite.Stmt) error {
+		quarantined = true
+		return nil
+	}, id)
+	if err != nil {
+		return fmt.Errorf("failed to check for quarantined context entry: %w", err)
+	}
+	if !quarantined {
+		return fmt.Errorf("no context entry found with ID: %s", id)
+	}
+	return nil
+}
+
+// deleteProvenance removes the provenance chain of an entry
+func (s *SQLiteContextStore) deleteProvenance(id string) error {
+	if err := sqlitex.Exec(s.conn, `DELETE FROM context_provenance WHERE context_id = ?;`, nil, id); err != nil {
+		return fmt.Errorf("failed to delete provenance: %w", err)
+	}
+	return nil
+}
+
+// SetGeneration records the generation of an existing or quarantined
+// entry's summary.
+func (s *SQLiteContextStore) SetGeneration(id string, generation Generation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkProvenanceTarget(id); err != nil {
+		return err
+	}
+
+	err := sqlitex.Exec(s.conn, `
+	INSERT OR REPLACE INTO context_generations (context_id, summarizer, provider, model, prompt_version)
+	VALUES (?, ?, ?, ?, ?);`, nil,
+		id, generation.Summarizer, generation.Provider, generation.Model, generation.PromptVersion)
+	if err != nil {
+		return fmt.Errorf("failed to set generation: %w", err)
+	}
+	return nil
+}
+
+// GetGeneration returns the generation of an existing or quarantined
+// entry's summary.
+func (s *SQLiteContextStore) GetGeneration(id string) (Generation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkProvenanceTarget(id); err != nil {
+		return Generation{}, err
+	}
+
+	var generation Generation
+	err := sqlitex.Exec(s.conn, `
+	SELECT summarizer, provider, model, prompt_version FROM context_generations WHERE context_id = ?;`, func(stmt *sqlite.Stmt) error {
+		generation = scanGeneration(stmt, 0)
+		return nil
+	}, id)
+	if err != nil {
+		return Generation{}, fmt.Errorf("failed to select generation: %w", err)
+	}
+	return generation, nil
+}
+
+// scanGeneration reads a generation from the four columns of stmt starting
+// at col
+func scanGeneration(stmt *sqlite.Stmt, col int) Generation {
+	return Generation{
+		Summarizer:    stmt.ColumnText(col),
+		Provider:      stmt.ColumnText(col + 1),
+		Model:         stmt.ColumnText(col + 2),
+		PromptVersion: stmt.ColumnText(col + 3),
+	}
+}
+
+// listGenerations returns the generation of every entry that has one
+func (s *SQLiteContextStore) listGenerations() (map[string]Generation, error) {
+	generations := make(map[string]Generation)
+	err := sqlitex.Exec(s.conn, `
+	SELECT context_id, summarizer, provider, model, prompt_version FROM context_generations;`, func(stmt *sqlite.Stmt) error {
+		generations[stmt.ColumnText(0)] = scanGeneration(stmt, 1)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list generations: %w", err)
+	}
+	return generations, nil
+}
+
+// deleteGeneration removes the generation of an entry's summary
+func (s *SQLiteContextStore) deleteGeneration(id string) error {
+	if err := sqlitex.Exec(s.conn, `DELETE FROM context_generations WHERE context_id = ?;`, nil, id); err != nil {
+		return fmt.Errorf("failed to delete generation: %w", err)
+	}
+	return nil
+}
+
+// SetTitle records the title of an existing or quarantined entry's summary,
+// encrypted if the entry's namespace is.
+func (s *SQLiteContextStore) SetTitle(id string, title string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkProvenanceTarget(id); err != nil {
+		return err
+	}
+	namespace, err := s.entryNamespace(id)
+	if err != nil {
+		return err
+	}
+	stored, err := s.storedTitle(namespace, id, title)
+	if err != nil {
+		return err
+	}
+
+	err = sqlitex.Exec(s.conn, `INSERT OR REPLACE INTO context_titles (context_id, title) VALUES (?, ?);`, nil, id, stored)
+	if err != nil {
+		return fmt.Errorf("failed to set title: %w", err)
+	}
+	return nil
+}
+
+// GetTitle returns the title of an existing or quarantined entry's summary.
+// It returns an error wrapping ErrNamespaceLocked if the entry's namespace
+// is encrypted with a master key that is not loaded.
+func (s *SQLiteContextStore) GetTitle(id string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkProvenanceTarget(id); err != nil {
+		return "", err
+	}
+	namespace, err := s.entryNamespace(id)
+	if err != nil {
+		return "", err
+	}
+
+	var stored string
+	found := false
+	err = sqlitex.Exec(s.conn, `SELECT title FROM context_titles WHERE context_id = ?;`, func(stmt *sqlite.Stmt) error {
+		stored = stmt.ColumnText(0)
+		found = true
+		return nil
+	}, id)
+	if err != nil {
+		return "", fmt.Errorf("failed to select title: %w", err)
+	}
+	if !found {
+		return "", nil
+	}
+	return s.newSummaryReader().openTitle(namespace, id, stored)
+}
+
+// listTitles returns the stored form of the title of every entry that has
+// one
+func (s *SQLiteContextStore) listTitles() (map[string]string, error) {
+	titles := make(map[string]string)
+	err := sqlitex.Exec(s.conn, `SELECT context_id, title FROM context_titles;`, func(stmt *sqlite.Stmt) error {
+		titles[stmt.ColumnText(0)] = stmt.ColumnText(1)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list titles: %w", err)
+	}
+	return titles, nil
+}
+
+// deleteTitle removes the title of an entry's summary
+func (s *SQLiteContextStore) deleteTitle(id string) error {
+	if err := sqlitex.Exec(s.conn, `DELETE FROM context_titles WHERE context_id = ?;`, nil, id); err != nil {
+		return fmt.Errorf("failed to delete title: %w", err)
+	}
+	return nil
+}
+
+// SetReferences replaces the references of an existing or quarantined
+// entry.
+func (s *SQLiteContextStore) SetReferences(id string, references []Reference) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkProvenanceTarget(id); err != nil {
+		return err
+	}
+
+	defer sqlitex.Save(s.conn)(&err)
+
+	if err := s.deleteReferences(id); err != nil {
+		return err
+	}
+	return s.insertReferences(id, references)
+}
+
+// insertReferences adds normalized references to an entry
+func (s *SQLiteContextStore) insertReferences(id string, references []Reference) error {
+	for _, reference := range NormalizeReferences(references) {
+		err := sqlitex.Exec(s.conn, `INSERT INTO context_references (context_id, path, symbol) VALUES (?, ?, ?);`, nil,
+			id, reference.Path, reference.Symbol)
+		if err != nil {
+			return fmt.Errorf("failed to insert reference to %s: %w", reference.Path, err)
+		}
+	}
+	return nil
+}
+
+// GetReferences returns the references of an existing or quarantined
+// entry, sorted.
+func (s *SQLiteContextStore) GetReferences(id string) ([]Reference, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkProvenanceTarget(id); err != nil {
+		return nil, err
+	}
+
+	references := []Reference{}
+	err := sqlitex.Exec(s.conn, `
+	SELECT path, symbol FROM context_references WHERE context_id = ?
+	ORDER BY path, symbol;`, func(stmt *sqlite.Stmt) error {
+		references = append(references, Reference{Path: stmt.ColumnText(0), Symbol: stmt.ColumnText(1)})
+		return nil
+	}, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select references: %w", err)
+	}
+	return references, nil
+}
+
+// ListReferencing returns the visible entries referencing the file at path
+// or a symbol declared in it, newest first. Entries of namespaces whose
+// master key is not loaded are skipped.
+func (s *SQLiteContextStore) ListReferencing(path string) ([]LinkedEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	linked := []LinkedEntry{}
+	summaries := s.newSummaryReader()
+	err := sqlitex.Exec(s.conn, `
+	SELECT m.id, m.summary_text, m.timestamp, m.namespace, t.title, r.symbol
+	FROM context_references r
+	JOIN context_memory m ON m.id = r.context_id
+	LEFT JOIN context_titles t ON t.context_id = m.id
+	WHERE r.path = ?
+	ORDER BY m.timestamp DESC, m.id ASC, r.symbol ASC;`, func(stmt *sqlite.Stmt) error {
+		id := stmt.ColumnText(0)
+		reference := Reference{Path: path, Symbol: stmt.ColumnText(5)}
+		if n := len(linked); n > 0 && linked[n-1].ID == id {
+			linked[n-1].References = append(linked[n-1].References, reference)
+			return nil
+		}
+
+		namespace := stmt.ColumnText(3)
+		summaryText, err := summaries.open(namespace, id, stmt.ColumnText(1))
+		if locked(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var title string
+		if stmt.ColumnType(4) != sqlite.SQLITE_NULL {
+			if title, err = summaries.openTitle(namespace, id, stmt.ColumnText(4)); err != nil {
+				return err
+			}
+		}
+		linked = append(linked, LinkedEntry{
+			ID:          id,
+			SummaryText: summaryText,
+			Title:       title,
+			Timestamp:   time.Unix(stmt.ColumnInt64(2), 0),
+			References:  []Reference{reference},
+		})
+		return nil
+	}, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list entries referencing %s: %w", path, err)
+	}
+	return linked, nil
+}
+
+// listReferences returns the references of every entry that has some
+func (s *SQLiteContextStore) listReferences() (map[string][]Reference, error) {
+	references := make(map[string][]Reference)
+	err := sqlitex.Exec(s.conn, `
+	SELECT context_id, path, symbol FROM context_references
+	ORDER BY context_id, path, symbol;`, func(stmt *sqlite.Stmt) error {
+		id := stmt.ColumnText(0)
+		references[id] = append(references[id], Reference{Path: stmt.ColumnText(1), Symbol: stmt.ColumnText(2)})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list references: %w", err)
+	}
+	return references, nil
+}
+
+// deleteReferences removes every reference of an entry
+func (s *SQLiteContextStore) deleteReferences(id string) error {
+	if err := sqlitex.Exec(s.conn, `DELETE FROM context_references WHERE context_id = ?;`, nil, id); err != nil {
+		return fmt.Errorf("failed to delete references: %w", err)
+	}
+	return nil
+}
+
+// SetPinned pins or unpins an existing entry. Pinning a pinned entry keeps
+// its place in ListPinned.
+func (s *SQLiteContextStore) SetPinned(id string, pinned bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exists, err := s.exists(id)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("no context entry found with ID: %s", id)
+	}
+
+	if !pinned {
+		return s.deletePin(id)
+	}
+	err = sqlitex.Exec(s.conn, `INSERT OR IGNORE INTO context_pins (context_id, pinned_at) VALUES (?, ?);`, nil,
+		id, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to set pin: %w", err)
+	}
+	return nil
+}
+
+// ListPinned returns the IDs of the pinned entries of a namespace, earliest
+// pinned first. An empty namespace lists every namespace.
+func (s *SQLiteContextStore) ListPinned(namespace string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := []string{}
+	err := sqlitex.Exec(s.conn, `
+	SELECT p.context_id FROM context_pins p JOIN context_memory m ON m.id = p.context_id
+	WHERE ? = '' OR m.namespace = ?
+	ORDER BY p.pinned_at ASC, p.context_id ASC;`, func(stmt *sqlite.Stmt) error {
+		ids = append(ids, stmt.ColumnText(0))
+		return nil
+	}, namespace, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pinned entries: %w", err)
+	}
+	return ids, nil
+}
+
+// listPins returns the IDs of every pinned entry
+func (s *SQLiteContextStore) listPins() (map[string]bool, error) {
+	pins := make(map[string]bool)
+	err := sqlitex.Exec(s.conn, `SELECT context_id FROM context_pins;`, func(stmt *sqlite.Stmt) error {
+		pins[stmt.ColumnText(0)] = true
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pins: %w", err)
+	}
+	return pins, nil
+}
+
+// deletePin unpins an entry
+func (s *SQLiteContextStore) deletePin(id string) error {
+	if err := sqlitex.Exec(s.conn, `DELETE FROM context_pins WHERE context_id = ?;`, nil, id); err != nil {
+		return fmt.Errorf("failed to delete pin: %w", err)
+	}
+	return nil
+}
+
+// SetBatch records that an existing or quarantined entry was written by
+// the batch.
+func (s *SQLiteContextStore) SetBatch(id string, batch string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkProvenanceTarget(id); err != nil {
+		return err
+	}
+
+	err := sqlitex.Exec(s.conn, `INSERT OR REPLACE INTO context_batches (context_id, batch_id) VALUES (?, ?);`, nil, id, batch)
+	if err != nil {
+		return fmt.Errorf("failed to set batch: %w", err)
+	}
+	return nil
+}
+
+// ListBatches returns every batch that holds entries, oldest first.
+func (s *SQLiteContextStore) ListBatches() ([]Batch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batches := []Batch{}
+	err := sqlitex.Exec(s.conn, `
+	SELECT b.batch_id, COUNT(*), MIN(e.timestamp), MAX(e.timestamp)
+	FROM context_batches b JOIN (
+		SELECT id, timestamp FROM context_memory
+		UNION ALL SELECT id, timestamp FROM context_quarantine
+	) e ON e.id = b.context_id
+	WHERE b.batch_id != ''
+	GROUP BY b.batch_id;`, func(stmt *sqlite.Stmt) error {
+		batches = append(batches, Batch{
+			ID:          stmt.ColumnText(0),
+			Entries:     stmt.ColumnInt(1),
+			FirstStored: time.Unix(stmt.ColumnInt64(2), 0),
+			LastStored:  time.Unix(stmt.ColumnInt64(3), 0),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list batches: %w", err)
+	}
+	sortBatches(batches)
+	return batches, nil
+}
+
+// DeleteBatch deletes every entry of the batch, quarantined ones included,
+// with their tags, usage, provenance and generation.
+func (s *SQLiteContextStore) DeleteBatch(batch string) (count int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if batch == "" {
+		return 0, errEmptyBatch
+	}
+
+	defer sqlitex.Save(s.conn)(&err)
+
+	for _, table := range []string{"context_memory", "context_quarantine"} {
+		err = sqlitex.Exec(s.conn, `
+		DELETE FROM `+table+` WHERE id IN (
+			SELECT context_id FROM context_batches WHERE batch_id = ?
+		);`, nil, batch)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete batch entries from %s: %w", table, err)
+		}
+		count += s.conn.Changes()
+	}
+
+	// Cleared entries keep their tags, usage, provenance, generation, title,
+	// references, pin, batch and session until they are restored or purged
+	for _, table := range []string{"context_tags", "context_usage", "context_provenance", "context_generations", "context_titles", "context_references", "context_pins", "context_batches", "context_sessions"} {
+		err = sqlitex.Exec(s.conn, `
+		DELETE FROM `+table+` WHERE context_id IN (
+			SELECT context_id FROM context_batches WHERE batch_id = ?
+			AND context_id NOT IN (SELECT id FROM context_cleared)
+		);`, nil, batch)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete batch entries from %s: %w", table, err)
+		}
+	}
+	return count, s.pruneRelations()
+}
+
+// deleteBatch removes the batch of an entry
+func (s *SQLiteContextStore) deleteBatch(id string) error {
+	if err := sqlitex.Exec(s.conn, `DELETE FROM context_batches WHERE context_id = ?;`, nil, id); err != nil {
+		return fmt.Errorf("failed to delete batch: %w", err)
+	}
+	return nil
+}
+
+// SetSession records that an existing or quarantined entry was saved in
+// the session.
+func (s *SQLiteContextStore) SetSession(id string, session string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkProvenanceTarget(id); err != nil {
+		return err
+	}
+
+	err := sqlitex.Exec(s.conn, `INSERT OR REPLACE INTO context_sessions (context_id, session_id) VALUES (?, ?);`, nil, id, session)
+	if err != nil {
+		return fmt.Errorf("failed to set session: %w", err)
+	}
+	return nil
+}
+
+// ListSessions returns every session that holds entries, most recently
+// active first.
+func (s *SQLiteContextStore) ListSessions() ([]Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := []Session{}
+	err := sqlitex.Exec(s.conn, `
+	SELECT c.session_id, COUNT(*), MIN(e.timestamp), MAX(e.timestamp)
+	FROM context_sessions c JOIN (
+		SELECT id, timestamp FROM context_memory
+		UNION ALL SELECT id, timestamp FROM context_quarantine
+	) e ON e.id = c.context_id
+	WHERE c.session_id != ''
+	GROUP BY c.session_id;`, func(stmt *sqlite.Stmt) error {
+		sessions = append(sessions, Session{
+			ID:          stmt.ColumnText(0),
+			Entries:     stmt.ColumnInt(1),
+			FirstStored: time.Unix(stmt.ColumnInt64(2), 0),
+			LastStored:  time.Unix(stmt.ColumnInt64(3), 0),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	sortSessions(sessions)
+	return sessions, nil
+}
+
+// DeleteSession deletes every entry of the session, quarantined ones
+// included, with their tags, usage, provenance and generation.
+func (s *SQLiteContextStore) DeleteSession(session string) (count int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session == "" {
+		return 0, errEmptySession
+	}
+
+	defer sqlitex.Save(s.conn)(&err)
+
+	for _, table := range []string{"context_memory", "context_quarantine"} {
+		err = sqlitex.Exec(s.conn, `
+		DELETE FROM `+table+` WHERE id IN (
+			SELECT context_id FROM context_sessions WHERE session_id = ?
+		);`, nil, session)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete session entries from %s: %w", table, err)
+		}
+		count += s.conn.Changes()
+	}
+
+	// Cleared entries keep their tags, usage, provenance, generation, title,
+	// references, pin, batch and session until they are restored or purged
+	for _, table := range []string{"context_tags", "context_usage", "context_provenance", "context_generations", "context_titles", "context_references", "context_pins", "context_batches", "context_sessions"} {
+		err = sqlitex.Exec(s.conn, `
+		DELETE FROM `+table+` WHERE context_id IN (
+			SELECT context_id FROM context_sessions WHERE session_id = ?
+			AND context_id NOT IN (SELECT id FROM context_cleared)
+		);`, nil, session)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete session entries from %s: %w", table, err)
+		}
+	}
+	return count, s.pruneRelations()
+}
+
+// deleteSession removes the session of an entry
+func (s *SQLiteContextStore) deleteSession(id string) error {
+	if err := sqlitex.Exec(s.conn, `DELETE FROM context_sessions WHERE context_id = ?;`, nil, id); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// Link records a relation between two visible entries. Linking a pair
+// again with the same type keeps the original relation.
+func (s *SQLiteContextStore) Link(relation Relation) error {
+	if err := checkRelation(relation); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range []string{relation.EntryID, relation.RelatedID} {
+		exists, err := s.exists(id)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%w: %s", ErrEntryNotFound, id)
+		}
+	}
+
+	err := sqlitex.Exec(s.conn, `
+	INSERT OR IGNORE INTO context_relations (entry_id, related_id, relation_type, created_at)
+	VALUES (?, ?, ?, ?);`, nil, relation.EntryID, relation.RelatedID, relation.Type, relation.CreatedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to link context entries: %w", err)
+	}
+	return nil
+}
+
+// Unlink removes the relation of the given type from id to relatedID.
+func (s *SQLiteContextStore) Unlink(id string, relatedID string, relationType string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := sqlitex.Exec(s.conn, `
+	DELETE FROM context_relations WHERE entry_id = ? AND related_id = ? AND relation_type = ?;`, nil,
+		id, relatedID, relationType)
+	if err != nil {
+		return false, fmt.Errorf("failed to unlink context entries: %w", err)
+	}
+	return s.conn.Changes() > 0, nil
+}
+
+// ListRelations returns the relations from and to a visible entry whose
+// other end is visible too, oldest first. Relations to entries of a locked
+// namespace are left out.
+func (s *SQLiteContextStore) ListRelations(id string) ([]RelatedEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exists, err := s.exists(id)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrEntryNotFound, id)
+	}
+
+	related := []RelatedEntry{}
+	summaries := s.newSummaryReader()
+	err = sqlitex.Exec(s.conn, `
+	SELECT r.entry_id, r.related_id, r.relation_type, r.created_at,
+		m.id, m.summary_text, m.timestamp, m.namespace, t.title
+	FROM context_relations r
+	JOIN context_memory m ON m.id = CASE WHEN r.entry_id = ?1 THEN r.related_id ELSE r.entry_id END
+	LEFT JOIN context_titles t ON t.context_id = m.id
+	WHERE r.entry_id = ?1 OR r.related_id = ?1;`, func(stmt *sqlite.Stmt) error {
+		other := stmt.ColumnText(4)
+		namespace := stmt.ColumnText(7)
+		summaryText, err := summaries.open(namespace, other, stmt.ColumnText(5))
+		if locked(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var title string
+		if stmt.ColumnType(8) != sqlite.SQLITE_NULL {
+			if title, err = summaries.openTitle(namespace, other, stmt.ColumnText(8)); err != nil {
+				return err
+			}
+		}
+		related = append(related, RelatedEntry{
+			Relation: Relation{
+				EntryID:   stmt.ColumnText(0),
+				RelatedID: stmt.ColumnText(1),
+				Type:      stmt.ColumnText(2),
+				CreatedAt: time.Unix(stmt.ColumnInt64(3), 0),
+			},
+			ID:          other,
+			SummaryText: summaryText,
+			Title:       title,
+			Timestamp:   time.Unix(stmt.ColumnInt64(6), 0),
+		})
+		return nil
+	}, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list relations of %s: %w", id, err)
+	}
+	sortRelations(related)
+	return related, nil
+}
+
+// pruneRelations removes the relations of entries that are neither visible
+// nor cleared, once entries are deleted
+func (s *SQLiteContextStore) pruneRelations() error {
+	err := sqlitex.Exec(s.conn, `
+	DELETE FROM context_relations
+	WHERE entry_id NOT IN (SELECT id FROM context_memory UNION SELECT id FROM context_cleared)
+	OR related_id NOT IN (SELECT id FROM context_memory UNION SELECT id FROM context_cleared);`, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete relations: %w", err)
+	}
+	return nil
+}
+
+// RecordGap counts one retrieval of query in namespace that found nothing.
+func (s *SQLiteContextStore) RecordGap(namespace string, query string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := sqlitex.Exec(s.conn, `
+	INSERT INTO retrieval_gaps (namespace, query, count, first_seen, last_seen)
+	VALUES (?, ?, 1, ?, ?)
+	ON CONFLICT(namespace, query) DO UPDATE SET
+		count = count + 1,
+		last_seen = excluded.last_seen;`, nil, namespace, query, at.Unix(), at.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to record retrieval gap: %w", err)
+	}
+	return nil
+}
+
+// ListGaps returns the gaps of namespace, or of every namespace if it is
+// empty, most often asked first.
+func (s *SQLiteContextStore) ListGaps(namespace string) ([]Gap, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gaps := []Gap{}
+	err := sqlitex.Exec(s.conn, `
+	SELECT namespace, query, count, first_seen, last_seen FROM retrieval_gaps
+	WHERE ? = '' OR namespace = ?;`, func(stmt *sqlite.Stmt) error {
+		gaps = append(gaps, Gap{
+			Namespace: stmt.ColumnText(0),
+			Query:     stmt.ColumnText(1),
+			Count:     stmt.ColumnInt(2),
+			FirstSeen: time.Unix(stmt.ColumnInt64(3), 0),
+			LastSeen:  time.Unix(stmt.ColumnInt64(4), 0),
+		})
+		return nil
+	}, namespace, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list retrieval gaps: %w", err)
+	}
+	sortGaps(gaps)
+	return gaps, nil
+}
+
+// DeleteGaps forgets the listed queries of namespace.
+func (s *SQLiteContextStore) DeleteGaps(namespace string, queries []string) (count int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	defer sqlitex.Save(s.conn)(&err)
+
+	for _, query := range queries {
+		err = sqlitex.Exec(s.conn, `DELETE FROM retrieval_gaps WHERE namespace = ? AND query = ?;`, nil, namespace, query)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete retrieval gap %q: %w", query, err)
+		}
+		count += s.conn.Changes()
+	}
+	return count, nil
+}
+
+// RecordReview records a review.
+func (s *SQLiteContextStore) RecordReview(review Review) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := sqlitex.Exec(s.conn, `
+	INSERT INTO context_reviews (context_id, action, reviewer, note, reviewed_at)
+	VALUES (?, ?, ?, ?, ?);`, nil, review.ID, review.Action, review.Reviewer, review.Note, review.At.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to record review of %s: %w", review.ID, err)
+	}
+	return nil
+}
+
+// ListReviews returns the reviews of the entry with the given ID, or of
+// every entry if it is empty, latest first.
+func (s *SQLiteContextStore) ListReviews(id string) ([]Review, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reviews := []Review{}
+	err := sqlitex.Exec(s.conn, `
+	SELECT context_id, action, reviewer, note, reviewed_at FROM context_reviews
+	WHERE ? = '' OR context_id = ?
+	ORDER BY rowid DESC;`, func(stmt *sqlite.Stmt) error {
+		reviews = append(reviews, Review{
+			ID:       stmt.ColumnText(0),
+			Action:   stmt.ColumnText(1),
+			Reviewer: stmt.ColumnText(2),
+			Note:     stmt.ColumnText(3),
+			At:       time.Unix(stmt.ColumnInt64(4), 0),
+		})
+		return nil
+	}, id, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reviews: %w", err)
+	}
+	sortReviews(reviews)
+	return reviews, nil
+}
+
+// RecordRetrievals counts one retrieval at the given time for each ID.
+func (s *SQLiteContextStore) RecordRetrievals(ids []string, at time.Time) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	defer sqlitex.Save(s.conn)(&err)
+
+	// Only stored entries are counted
+	stmt, err := s.conn.Prepare(`
+	INSERT INTO context_usage (context_id, retrievals, last_retrieved)
+	SELECT id, 1, ? FROM context_memory WHERE id = ?
+	ON CONFLICT(context_id) DO UPDATE SET
+		retrievals = retrievals + 1,
+		last_retrieved = excluded.last_retrieved;`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare record retrieval statement: %w", err)
+	}
+	for _, id := range ids {
+		stmt.BindInt64(1, at.Unix())
+		stmt.BindText(2, id)
+		_, err = stmt.Step()
+		stmt.Reset()
+		if err != nil {
+			return fmt.Errorf("failed to record retrieval of %s: %w", id, err)
+		}
+	}
+
+	return nil
+}
+
+// ListEntries returns every entry, oldest first.
+func (s *SQLiteContextStore) ListEntries() ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chains, err := s.listProvenance()
+	if err != nil {
+		return nil, err
+	}
+	generations, err := s.listGenerations()
+	if err != nil {
+		return nil, err
+	}
+	titles, err := s.listTitles()
+	if err != nil {
+		return nil, err
+	}
+	pins, err := s.listPins()
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := s.conn.Prepare(`
+	SELECT m.id, m.summary_text, m.embedding, m.timestamp, u.retrievals, u.last_retrieved, m.namespace
+	FROM context_memory m LEFT JOIN context_usage u ON u.context_id = m.id
+	ORDER BY m.timestamp ASC, m.id ASC;`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare list statement: %w", err)
+	}
+	defer stmt.Reset()
+
+	var entries []Entry
+	summaries := s.newSummaryReader()
+	for {
+		hasRow, err := stmt.Step()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list context entries: %w", err)
+		}
+		if !hasRow {
+			return entries, nil
+		}
+
+		id := stmt.ColumnText(0)
+		summaryText, err := summaries.open(stmt.ColumnText(6), id, stmt.ColumnText(1))
+		if locked(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var title string
+		if stored, ok := titles[id]; ok {
+			if title, err = summaries.openTitle(stmt.ColumnText(6), id, stored); err != nil {
+				return nil, err
+			}
+		}
+		embeddingBytes := make([]byte, stmt.ColumnLen(2))
+		stmt.ColumnBytes(2, embeddingBytes)
+		embedding, err := vector.BytesToFloat32Slice(embeddingBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert embedding bytes for entry %s: %w", id, err)
+		}
+
+		entry := Entry{
+			ID:          id,
+			SummaryText: summaryText,
+			Embedding:   embedding,
+			Timestamp:   time.Unix(stmt.ColumnInt64(3), 0),
+			Provenance:  chains[id],
+			Generation:  generations[id],
+			Pinned:      pins[id],
+			Title:       title,
+			Namespace:   stmt.ColumnText(6),
+		}
+		if stmt.ColumnType(4) != sqlite.SQLITE_NULL {
+			entry.Retrievals = stmt.ColumnInt(4)
+			entry.LastRetrieved = time.Unix(stmt.ColumnInt64(5), 0)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// listProvenance returns the provenance chain of every entry that has one
+func (s *SQLiteContextStore) listProvenance() (map[string][]string, error) {
+	chains := make(map[string][]string)
+	err := sqlitex.Exec(s.conn, `SELECT context_id, source FROM context_provenance ORDER BY context_id, position;`, func(stmt *sqlite.Stmt) error {
+		id := stmt.ColumnText(0)
+		chains[id] = append(chains[id], stmt.ColumnText(1))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list provenance: %w", err)
+	}
+	return chains, nil
+}
+
+// SnapshotHashes returns the snapshot hash of each namespace that holds
+// entries. Encrypted namespaces are hashed over their decrypted summaries,
+// and those this server holds no key for are left out.
+func (s *SQLiteContextStore) SnapshotHashes() (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tags, err := s.listTags()
+	if err != nil {
+		return nil, err
+	}
+	chains, err := s.listProvenance()
+	if err != nil {
+		return nil, err
+	}
+
+	tree := make(snapshotTree)
+	summaries := s.newSummaryReader()
+	lockedNamespaces := make(map[string]bool)
+	err = sqlitex.Exec(s.conn, `SELECT id, summary_text, embedding, timestamp, namespace FROM context_memory;`, func(stmt *sqlite.Stmt) error {
+		id, namespace := stmt.ColumnText(0), stmt.ColumnText(4)
+		summaryText, err := summaries.open(namespace, id, stmt.ColumnText(1))
+		if locked(err) {
+			lockedNamespaces[namespace] = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		embedding := make([]byte, stmt.ColumnLen(2))
+		stmt.ColumnBytes(2, embedding)
+		tree.add(namespace, snapshotEntry{
+			id:          id,
+			summaryText: summaryText,
+			embedding:   embedding,
+			timestamp:   time.Unix(stmt.ColumnInt64(3), 0),
+			tags:        tags[id],
+			provenance:  chains[id],
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash context entries: %w", err)
+	}
+	hashes := tree.roots()
+	for namespace := range lockedNamespaces {
+		delete(hashes, namespace)
+	}
+	return hashes, nil
+}
+
+// listTags returns the tags of every entry that has any
+func (s *SQLiteContextStore) listTags() (map[string][]string, error) {
+	tags := make(map[string][]string)
+	err := sqlitex.Exec(s.conn, `SELECT context_id, tag FROM context_tags ORDER BY context_id, tag;`, func(stmt *sqlite.Stmt) error {
+		id := stmt.ColumnText(0)
+		tags[id] = append(tags[id], stmt.ColumnText(1))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+	return tags, nil
+}
+
+// deleteUsage removes the usage statistics of an entry
+func (s *SQLiteContextStore) deleteUsage(id string) error {
+	stmt, err := s.conn.Prepare(`DELETE FROM context_usage WHERE context_id = ?;`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare delete usage statement: %w", err)
+	}
+	defer stmt.Reset()
+	stmt.BindText(1, id)
+
+	if _, err := stmt.Step(); err != nil {
+		return fmt.Errorf("failed to delete usage: %w", err)
+	}
+	return nil
+}
+
+// Delete deletes a specific context entry from the store by ID.
+func (s *SQLiteContextStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleteSQL := `DELETE FROM context_memory WHERE id = ?;`
+
+	stmt, err := s.conn.Prepare(deleteSQL)
+	if err != nil {
+		return fmt.Errorf("failed to prepare delete statement: %w", err)
+	}
+	defer stmt.Reset()
+
+	// Bind parameter
+	stmt.BindText(1, id)
+
+	// Execute the statement
+	_, err = stmt.Step()
+	if err != nil {
+		return fmt.Errorf("failed to delete context entry: %w", err)
+	}
+
+	// Check if any rows were affected, then look for a quarantined entry
+	changes := s.conn.Changes()
+	if changes == 0 {
+		if err := sqlitex.Exec(s.conn, `DELETE FROM context_quarantine WHERE id = ?;`, nil, id); err != nil {
+			return fmt.Errorf("failed to delete quarantined context entry: %w", err)
+		}
+		if s.conn.Changes() == 0 {
+			return fmt.Errorf("no context entry found with ID: %s", id)
+		}
+	}
+
+	if err := s.deleteTags(id); err != nil {
+		return err
+	}
+	if err := s.deleteProvenance(id); err != nil {
+		return err
+	}
+	if err := s.deleteGeneration(id); err != nil {
+		return err
+	}
+	if err := s.deleteTitle(id); err != nil {
+		return err
+	}
+	if err := s.deleteReferences(id); err != nil {
+		return err
+	}
+	if err := s.deletePin(id); err != nil {
+		return err
+	}
+	if err := s.deleteBatch(id); err != nil {
+		return err
+	}
+	if err := s.deleteSession(id); err != nil {
+		return err
+	}
+	if err := s.pruneRelations(); err != nil {
+		return err
+	}
+	return s.deleteUsage(id)
+}
+
+// Clear removes all context entries from the store, including entries
+// hidden by MarkCleared. Returns the number of visible entries deleted.
+func (s *SQLiteContextStore) Clear() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleteSQL := `DELETE FROM context_memory;`
+
+	stmt, err := s.conn.Prepare(deleteSQL)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare delete all statement: %w", err)
+	}
+	defer stmt.Reset()
+
+	// Execute the statement
+	_, err = stmt.Step()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete all context entries: %w", err)
+	}
+
+	// Get the number of rows affected
+	changes := s.conn.Changes()
+
+	clearTagsStmt, err := s.conn.Prepare(`DELETE FROM context_tags;`)
+	if err != nil {
+		return changes, fmt.Errorf("failed to prepare delete all tags statement: %w", err)
+	}
+	defer clearTagsStmt.Reset()
+
+	if _, err := clearTagsStmt.Step(); err != nil {
+		return changes, fmt.Errorf("failed to delete all tags: %w", err)
+	}
+
+	clearUsageStmt, err := s.conn.Prepare(`DELETE FROM context_usage;`)
+	if err != nil {
+		return changes, fmt.Errorf("failed to prepare delete all usage statement: %w", err)
+	}
+	defer clearUsageStmt.Reset()
+
+	if _, err := clearUsageStmt.Step(); err != nil {
+		return changes, fmt.Errorf("failed to delete all usage: %w", err)
+	}
+
+	if err := sqlitex.Exec(s.conn, `DELETE FROM context_cleared;`, nil); err != nil {
+		return changes, fmt.Errorf("failed to delete all cleared entries: %w", err)
+	}
+
+	if err := sqlitex.Exec(s.conn, `DELETE FROM context_quarantine;`, nil); err != nil {
+		return changes, fmt.Errorf("failed to delete all quarantined entries: %w", err)
+	}
+
+	if err := sqlitex.Exec(s.conn, `DELETE FROM context_provenance;`, nil); err != nil {
+		return changes, fmt.Errorf("failed to delete all provenance: %w", err)
+	}
+
+	if err := sqlitex.Exec(s.conn, `DELETE FROM context_generations;`, nil); err != nil {
+		return changes, fmt.Errorf("failed to delete all generations: %w", err)
+	}
+
+	if err := sqlitex.Exec(s.conn, `DELETE FROM context_titles;`, nil); err != nil {
+		return changes, fmt.Errorf("failed to delete all titles: %w", err)
+	}
+
+	if err := sqlitex.Exec(s.conn, `DELETE FROM context_references;`, nil); err != nil {
+		return changes, fmt.Errorf("failed to delete all references: %w", err)
+	}
+
+	if err := sqlitex.Exec(s.conn, `DELETE FROM context_pins;`, nil); err != nil {
+		return changes, fmt.Errorf("failed to delete all pins: %w", err)
+	}
+
+	if err := sqlitex.Exec(s.conn, `DELETE FROM context_batches;`, nil); err != nil {
+		return changes, fmt.Errorf("failed to delete all batches: %w", err)
+	}
+
+	if err := sqlitex.Exec(s.conn, `DELETE FROM context_sessions;`, nil); err != nil {
+		return changes, fmt.Errorf("failed to delete all sessions: %w", err)
+	}
+
+	if err := sqlitex.Exec(s.conn, `DELETE FROM context_relations;`, nil); err != nil {
+		return changes, fmt.Errorf("failed to delete all relations: %w", err)
+	}
+
+	return changes, nil
+}
+
+// MarkCleared hides every entry until it is restored by UndoClear or
+// deleted by PurgeCleared. Quarantined entries are deleted.
+func (s *SQLiteContextStore) MarkCleared(at time.Time) (count int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	defer sqlitex.Save(s.conn)(&err)
+
+	if err := s.deleteQuarantined(); err != nil {
+		return 0, err
+	}
+
+	err = sqlitex.Exec(s.conn, `
+	INSERT OR REPLACE INTO context_cleared (id, summary_text, embedding, timestamp, norm, namespace, cleared_at)
+	SELECT id, summary_text, embedding, timestamp, norm, namespace, ? FROM context_memory;`, nil, at.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark context entries cleared: %w", err)
+	}
+
+	if err := sqlitex.Exec(s.conn, `DELETE FROM context_memory;`, nil); err != nil {
+		return 0, fmt.Errorf("failed to hide cleared context entries: %w", err)
+	}
+	return s.conn.Changes(), nil
+}
+
+// UndoClear restores every cleared entry whose ID was not stored again.
+func (s *SQLiteContextStore) UndoClear() (count int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	defer sqlitex.Save(s.conn)(&err)
+
+	// Entries stored again since the clear win. Their tags and usage now
+	// belong to the new entry, so only the cleared row is dropped
+	err = sqlitex.Exec(s.conn, `DELETE FROM context_cleared WHERE id IN (SELECT id FROM context_memory);`, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to drop superseded cleared entries: %w", err)
+	}
+
+	err = sqlitex.Exec(s.conn, `
+	INSERT INTO context_memory (id, summary_text, embedding, timestamp, norm, namespace)
+	SELECT id, summary_text, embedding, timestamp, norm, namespace FROM context_cleared;`, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to restore cleared context entries: %w", err)
+	}
+	count = s.conn.Changes()
+
+	if err := sqlitex.Exec(s.conn, `DELETE FROM context_cleared;`, nil); err != nil {
+		return 0, fmt.Errorf("failed to delete restored cleared entries: %w", err)
+	}
+	return count, nil
+}
+
+// PurgeCleared permanently deletes entries cleared before the given time.
+func (s *SQLiteContextStore) PurgeCleared(before time.Time) (count int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	defer sqlitex.Save(s.conn)(&err)
+
+	// Tags, usage, provenance, generations, titles, references, pins,
+	// batches and sessions go with the entry unless its ID was stored again
+	for _, table := range []string{"context_tags", "context_usage", "context_provenance", "context_generations", "context_titles", "context_references", "context_pins", "context_batches", "context_sessions"} {
+		err = sqlitex.Exec(s.conn, `
+		DELETE FROM `+table+` WHERE context_id IN (
+			SELECT id FROM context_cleared WHERE cleared_at < ?
+			AND id NOT IN (SELECT id FROM context_memory)
+		);`, nil, before.Unix())
+		if err != nil {
+			return 0, fmt.Errorf("failed to purge cleared entries from %s: %w", table, err)
+		}
+	}
+
+	if err := sqlitex.Exec(s.conn, `DELETE FROM context_cleared WHERE cleared_at < ?;`, nil, before.Unix()); err != nil {
+		return 0, fmt.Errorf("failed to purge cleared context entries: %w", err)
+	}
+	count = s.conn.Changes()
+	return count, s.pruneRelations()
+}
+
+// Quarantine stores an entry and its tags outside the search index.
+func (s *SQLiteContextStore) Quarantine(id string, summaryText string, embedding []byte, timestamp time.Time, tags []string, provider string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	defer sqlitex.Save(s.conn)(&err)
+
+	// Released entries join the default namespace, so they are encrypted
+	// like it
+	summaryText, err = s.storedSummary(DefaultNamespace, id, summaryText)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := s.conn.Prepare(`
+	INSERT OR REPLACE INTO context_quarantine (id, summary_text, embedding, timestamp, provider)
+	VALUES (?, ?, ?, ?, ?);`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert quarantined statement: %w", err)
+	}
+	defer stmt.Reset()
+
+	// Bound explicitly so the embedding is stored as a BLOB
+	stmt.BindText(1, id)
+	stmt.BindText(2, summaryText)
+	stmt.BindBytes(3, embedding)
+	stmt.BindInt64(4, timestamp.Unix())
+	stmt.BindText(5, provider)
+	if _, err := stmt.Step(); err != nil {
+		return fmt.Errorf("failed to insert quarantined context entry: %w", err)
+	}
+
+	if err := s.deleteTags(id); err != nil {
+		return err
+	}
+	return s.insertTags(id, tags)
+}
+
+// ListQuarantined returns every quarantined entry, oldest first.
+func (s *SQLiteContextStore) ListQuarantined() ([]QuarantinedEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var entries []QuarantinedEntry
+	summaries := s.newSummaryReader()
+	err := sqlitex.Exec(s.conn, `
+	SELECT id, summary_text, timestamp, provider, embedding
+	FROM context_quarantine ORDER BY timestamp, id;`, func(stmt *sqlite.Stmt) error {
+		id := stmt.ColumnText(0)
+		summaryText, err := summaries.open(DefaultNamespace, id, stmt.ColumnText(1))
+		if locked(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		embedding := make([]byte, stmt.ColumnLen(4))
+		stmt.ColumnBytes(4, embedding)
+		entries = append(entries, QuarantinedEntry{
+			ID:          id,
+			SummaryText: summaryText,
+			Timestamp:   time.Unix(stmt.ColumnInt64(2), 0),
+			Provider:    stmt.ColumnText(3),
+			Dimensions:  embeddingDimensions(embedding),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list quarantined context entries: %w", err)
+	}
+	return entries, nil
+}
+
+// ReleaseQuarantined moves a quarantined entry into the search index with a
+// new embedding.
+func (s *SQLiteContextStore) ReleaseQuarantined(id string, embedding []byte) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	defer sqlitex.Save(s.conn)(&err)
+
+	var summaryText string
+	var timestamp int64
+	found := false
+	err = sqlitex.Exec(s.conn, `SELECT summary_text, timestamp FROM context_quarantine WHERE id = ?;`, func(stmt *sqlite.Stmt) error {
+		summaryText = stmt.ColumnText(0)
+		timestamp = stmt.ColumnInt64(1)
+		found = true
+		return nil
+	}, id)
+	if err != nil {
+		return fmt.Errorf("failed to read quarantined context entry: %w", err)
+	}
+	if !found {
+		return fmt.Errorf("no quarantined context entry found with ID: %s", id)
+	}
+	summaryText, err = s.newSummaryReader().open(DefaultNamespace, id, summaryText)
+	if err != nil {
+		return err
+	}
+
+	if err := s.store(DefaultNamespace, id, summaryText, embedding, time.Unix(timestamp, 0)); err != nil {
+		return err
+	}
+	if err := sqlitex.Exec(s.conn, `DELETE FROM context_quarantine WHERE id = ?;`, nil, id); err != nil {
+		return fmt.Errorf("failed to delete released quarantined context entry: %w", err)
+	}
+	return nil
+}
+
+// deleteQuarantined deletes every quarantined entry with its tags,
+// provenance, generation, title, references, batch and session
+func (s *SQLiteContextStore) deleteQuarantined() error {
+	for _, table := range []string{"context_tags", "context_provenance", "context_generations", "context_titles", "context_references", "context_batches", "context_sessions"} {
+		err := sqlitex.Exec(s.conn, `
+		DELETE FROM `+table+` WHERE context_id IN (
+			SELECT id FROM context_quarantine WHERE id NOT IN (SELECT id FROM context_memory)
+		);`, nil)
+		if err != nil {
+			return fmt.Errorf("failed to delete quarantined entries from %s: %w", table, err)
+		}
+	}
+
+	if err := sqlitex.Exec(s.conn, `DELETE FROM context_quarantine;`, nil); err != nil {
+		return fmt.Errorf("failed to delete quarantined context entries: %w", err)
+	}
+	return nil
+}
+
+// Replace replaces a context entry with updated information.
+func (s *SQLiteContextStore) Replace(id string, summaryText string, embedding []byte, timestamp time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// First check if the entry exists
+	checkSQL := `SELECT id FROM context_memory WHERE id = ?;`
+
+	checkStmt, err := s.conn.Prepare(checkSQL)
+	if err != nil {
+		return fmt.Errorf("failed to prepare check statement: %w", err)
+	}
+	checkStmt.BindText(1, id)
+
+	hasRow, err := checkStmt.Step()
+	checkStmt.Reset()
+	if err != nil {
+		return fmt.Errorf("failed to check for context entry: %w", err)
+	}
+	if !hasRow {
+		return fmt.Errorf("no context entry found with ID: %s", id)
+	}
+
+	// Then perform the update, keeping the entry's namespace
+	return s.store("", id, summaryText, embedding, timestamp)
+}
+
+// LoadCachedEmbedding returns the cached embedding for key if it was created
+// at or after notBefore. Expired entries are deleted as they are found.
+func (s *SQLiteContextStore) LoadCachedEmbedding(key string, notBefore time.Time) ([]float32, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	selectSQL := `SELECT embedding, created_at FROM embedding_cache WHERE cache_key = ?;`
+
+	stmt, err := s.conn.Prepare(selectSQL)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to prepare embedding cache select statement: %w", err)
+	}
+	stmt.BindText(1, key)
+
+	hasRow, err := stmt.Step()
+	if err != nil {
+		stmt.Reset()
+		return nil, false, fmt.Errorf("failed to read embedding cache: %w", err)
+	}
+	if !hasRow {
+		stmt.Reset()
+		return nil, false, nil
+	}
+
+	embeddingBytes := make([]byte, stmt.ColumnLen(0))
+	stmt.ColumnBytes(0, embeddingBytes)
+	createdAt := time.Unix(stmt.ColumnInt64(1), 0)
+	stmt.Reset()
+
+	if createdAt.Before(notBefore) {
+		return nil, false, s.deleteCachedEmbedding(key)
+	}
+
+	embedding, err := vector.BytesToFloat32Slice(embeddingBytes)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to convert cached embedding bytes: %w", err)
+	}
+
+	return embedding, true, nil
+}
+
+// SaveCachedEmbedding stores an embedding in the embedding cache table.
+func (s *SQLiteContextStore) SaveCachedEmbedding(key string, embedding []float32, createdAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	embeddingBytes, err := vector.Float32SliceToBytes(embedding)
+	if err != nil {
+		return fmt.Errorf("failed to convert embedding to bytes: %w", err)
+	}
+
+	insertSQL := `
+	INSERT OR REPLACE INTO embedding_cache (cache_key, embedding, created_at)
+	VALUES (?, ?, ?);`
+
+	stmt, err := s.conn.Prepare(insertSQL)
+	if err != nil {
+		return fmt.Errorf("failed to prepare embedding cache insert statement: %w", err)
+	}
+	defer stmt.Reset()
+
+	stmt.BindText(1, key)
+	stmt.BindBytes(2, embeddingBytes)
+	stmt.BindInt64(3, createdAt.Unix())
+
+	_, err = stmt.Step()
+	if err != nil {
+		return fmt.Errorf("failed to insert embedding cache entry: %w", err)
+	}
+
+	return nil
+}
+
+// deleteCachedEmbedding removes an expired embedding cache entry.
+func (s *SQLiteContextStore) deleteCachedEmbedding(key string) error {
+	deleteSQL := `DELETE FROM embedding_cache WHERE cache_key = ?;`
+
+	stmt, err := s.conn.Prepare(deleteSQL)
+	if err != nil {
+		return fmt.Errorf("failed to prepare embedding cache delete statement: %w", err)
+	}
+	defer stmt.Reset()
+
+	stmt.BindText(1, key)
+
+	_, err = stmt.Step()
+	if err != nil {
+		return fmt.Errorf("failed to delete embedding cache entry: %w", err)
+	}
+
+	return nil
 }
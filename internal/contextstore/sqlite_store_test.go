@@ -0,0 +1,492 @@
+//go:build cgo && !purego
+
+package contextstore_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/contextstore/storetest"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+func TestSQLiteContextStoreContract(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) contextstore.ContextStore {
+		store := contextstore.NewSQLiteContextStore()
+		if err := store.Initialize(filepath.Join(t.TempDir(), "test.db")); err != nil {
+			t.Fatalf("Failed to initialize store: %v", err)
+		}
+		return store
+	})
+}
+
+func TestSQLiteContextStoreContractWithWriteBatching(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) contextstore.ContextStore {
+		store := contextstore.NewSQLiteContextStore()
+		if err := store.Initialize(filepath.Join(t.TempDir(), "test.db")); err != nil {
+			t.Fatalf("Failed to initialize store: %v", err)
+		}
+		store.SetWriteBatching(16, 0)
+		return store
+	})
+}
+
+// TestSQLiteContextStoreWriteBatching writes entries at the same time, one
+// of them to a namespace the store cannot write, and checks that only that
+// one fails and the others are committed
+func TestSQLiteContextStoreWriteBatching(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	masterKeys, err := contextstore.ParseMasterKeys("team-a:" + base64.StdEncoding.EncodeToString(make([]byte, contextstore.MasterKeySize)))
+	if err != nil {
+		t.Fatalf("ParseMasterKeys() error = %v", err)
+	}
+	keyring, err := contextstore.NewKeyring(masterKeys, map[string]string{"secret": "team-a"})
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	owner := contextstore.NewSQLiteContextStore()
+	if err := owner.Initialize(dbPath); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+	if err := owner.SetKeyring(keyring); err != nil {
+		t.Fatalf("SetKeyring() error = %v", err)
+	}
+	owner.Close()
+
+	// Without the master key, the secret namespace is locked
+	store := contextstore.NewSQLiteContextStore()
+	if err := store.Initialize(dbPath); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+	store.SetWriteBatching(64, 50*time.Millisecond)
+	embedding, _ := vector.Float32SliceToBytes([]float32{1, 0})
+
+	const writers = 20
+	var wg sync.WaitGroup
+	errs := make([]error, writers)
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			namespace := contextstore.DefaultNamespace
+			if i == 0 {
+				namespace = "secret"
+			}
+			errs[i] = store.StoreInNamespace(namespace, fmt.Sprintf("entry-%d", i), fmt.Sprintf("entry %d", i), embedding, time.Unix(int64(i), 0))
+		}()
+	}
+	wg.Wait()
+
+	if !errors.Is(errs[0], contextstore.ErrNamespaceLocked) {
+		t.Errorf("Expected the locked namespace to fail, got %v", errs[0])
+	}
+	for i, err := range errs[1:] {
+		if err != nil {
+			t.Errorf("Write %d failed: %v", i+1, err)
+		}
+	}
+	results, err := store.SearchWithScores([]float32{1, 0}, writers, contextstore.SearchFilter{})
+	if err != nil || len(results) != writers-1 {
+		t.Errorf("Expected %d entries, got %d, %v", writers-1, len(results), err)
+	}
+
+	// Writes after Close fail rather than wait
+	store.Close()
+	if err := store.Store("late", "written after close", embedding, time.Now()); !errors.Is(err, contextstore.ErrStoreClosed) {
+		t.Errorf("Expected a write after Close to fail, got %v", err)
+	}
+}
+
+// BenchmarkSQLiteContextStoreConcurrentWrites compares committing each
+// entry on its own with committing them in groups
+func BenchmarkSQLiteContextStoreConcurrentWrites(b *testing.B) {
+	embedding, _ := vector.Float32SliceToBytes(make([]float32, 768))
+	for _, maxSize := range []int{1, 64} {
+		b.Run(fmt.Sprintf("batch-%d", maxSize), func(b *testing.B) {
+			store := contextstore.NewSQLiteContextStore()
+			if err := store.Initialize(filepath.Join(b.TempDir(), "bench.db")); err != nil {
+				b.Fatalf("Failed to initialize store: %v", err)
+			}
+			defer store.Close()
+			store.SetWriteBatching(maxSize, 0)
+
+			var next atomic.Int64
+			b.SetParallelism(16)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					id := fmt.Sprintf("entry-%d", next.Add(1))
+					if err := store.Store(id, "benchmark entry", embedding, time.Now()); err != nil {
+						b.Errorf("Store() error = %v", err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkSQLiteContextStoreSearch(b *testing.B) {
+	store := contextstore.NewSQLiteContextStore()
+	if err := store.Initialize(filepath.Join(b.TempDir(), "bench.db")); err != nil {
+		b.Fatalf("Failed to initialize store: %v", err)
+	}
+	defer store.Close()
+	benchmarkSearch(b, store)
+}
+
+// TestSQLiteSearchUsesIndexes checks under EXPLAIN QUERY PLAN that filtered
+// searches narrow the entries through indexes rather than scanning them all
+func TestSQLiteSearchUsesIndexes(t *testing.T) {
+	store := contextstore.NewSQLiteContextStore()
+	if err := store.Initialize(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+	defer store.Close()
+
+	now := time.Now()
+	tests := []struct {
+		name    string
+		filter  contextstore.SearchFilter
+		indexes []string
+	}{
+		{"namespace", contextstore.SearchFilter{Namespace: "work"}, []string{"context_memory_namespace_timestamp (namespace=?)"}},
+		{"time", contextstore.SearchFilter{Since: now.Add(-time.Hour), Until: now}, []string{"context_memory_timestamp (timestamp>? AND timestamp<?)"}},
+		{"namespace and time", contextstore.SearchFilter{Namespace: "work", Since: now}, []string{"context_memory_namespace_timestamp (namespace=? AND timestamp>?)"}},
+		{"tags", contextstore.SearchFilter{Tags: []string{"auth", "billing"}}, []string{"context_tags_tag (tag=?)"}},
+		{"excluded tags", contextstore.SearchFilter{ExcludeTags: []string{"deprecated"}}, []string{"sqlite_autoindex_context_tags_1 (context_id=? AND tag=?)"}},
+		{"pinned", contextstore.SearchFilter{Pinned: true}, []string{"sqlite_autoindex_context_pins_1"}},
+		{"session", contextstore.SearchFilter{Session: "s1"}, []string{"context_sessions_session_id (session_id=?)"}},
+		{"everything", contextstore.SearchFilter{Namespace: "work", Since: now, Tags: []string{"auth"}, ExcludeTags: []string{"deprecated"}}, []string{
+			"context_memory_namespace_timestamp (namespace=? AND timestamp>?)",
+			"context_tags_tag (tag=?)",
+			"sqlite_autoindex_context_tags_1 (context_id=? AND tag=?)",
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plan, err := store.ExplainSearch(test.filter)
+			if err != nil {
+				t.Fatalf("ExplainSearch() error = %v", err)
+			}
+			joined := strings.Join(plan, "\n")
+			for _, index := range test.indexes {
+				if !strings.Contains(joined, index) {
+					t.Errorf("Expected the plan to use %s, got:\n%s", index, joined)
+				}
+			}
+			for _, step := range plan {
+				if strings.HasPrefix(step, "SCAN") && !strings.Contains(step, "USING") {
+					t.Errorf("Expected no full table scan, got %q in:\n%s", step, joined)
+				}
+			}
+		})
+	}
+}
+
+// TestSQLiteContextStoreAddsNormColumn opens a database created before the
+// norm column existed and checks that existing rows are still searchable.
+func TestSQLiteContextStoreAddsNormColumn(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "legacy.db")
+
+	conn, err := sqlite.OpenConn(dbPath, sqlite.SQLITE_OPEN_CREATE|sqlite.SQLITE_OPEN_READWRITE)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	embedding, _ := vector.Float32SliceToBytes([]float32{3, 4})
+	err = sqlitex.ExecScript(conn, `
+		CREATE TABLE context_memory (
+			id TEXT PRIMARY KEY,
+			summary_text TEXT NOT NULL,
+			embedding BLOB NOT NULL,
+			timestamp INTEGER NOT NULL
+		);`)
+	if err == nil {
+		err = sqlitex.Exec(conn, `INSERT INTO context_memory VALUES ('legacy', 'legacy entry', ?, 0);`, nil, embedding)
+	}
+	conn.Close()
+	if err != nil {
+		t.Fatalf("Failed to create legacy schema: %v", err)
+	}
+
+	store := contextstore.NewSQLiteContextStore()
+	if err := store.Initialize(dbPath); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+	defer store.Close()
+
+	results, err := store.SearchWithScores([]float32{3, 4}, 1, contextstore.SearchFilter{})
+	if err != nil {
+		t.Fatalf("SearchWithScores() error = %v", err)
+	}
+	if len(results) != 1 || math.Abs(results[0].Similarity-1) > 1e-6 {
+		t.Errorf("Expected the legacy entry with similarity 1, got %v", results)
+	}
+}
+
+// TestSQLiteContextStoreMigratesLegacySchema opens a database created before
+// schema versioning and checks that its entries land in the default
+// namespace and the migration is recorded once.
+func TestSQLiteContextStoreMigratesLegacySchema(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "legacy.db")
+
+	conn, err := sqlite.OpenConn(dbPath, sqlite.SQLITE_OPEN_CREATE|sqlite.SQLITE_OPEN_READWRITE)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	embedding, _ := vector.Float32SliceToBytes([]float32{1, 0})
+	err = sqlitex.ExecScript(conn, `
+		CREATE TABLE context_memory (
+			id TEXT PRIMARY KEY,
+			summary_text TEXT NOT NULL,
+			embedding BLOB NOT NULL,
+			timestamp INTEGER NOT NULL
+		);`)
+	for _, id := range []string{"first", "second"} {
+		if err == nil {
+			err = sqlitex.Exec(conn, `INSERT INTO context_memory VALUES (?, 'legacy entry', ?, 0);`, nil, id, embedding)
+		}
+	}
+	conn.Close()
+	if err != nil {
+		t.Fatalf("Failed to create legacy schema: %v", err)
+	}
+
+	// Opening twice must not apply the migration again
+	for i := 0; i < 2; i++ {
+		store := contextstore.NewSQLiteContextStore()
+		if err := store.Initialize(dbPath); err != nil {
+			t.Fatalf("Failed to initialize store: %v", err)
+		}
+		version, err := store.SchemaVersion()
+		if err != nil {
+			t.Fatalf("SchemaVersion() error = %v", err)
+		}
+		if version != contextstore.LatestSchemaVersion {
+			t.Errorf("Expected schema version %d, got %d", contextstore.LatestSchemaVersion, version)
+		}
+		if results, _ := store.Search([]float32{1, 0}, 10); len(results) != 2 {
+			t.Errorf("Expected both legacy entries to be searchable, got %v", results)
+		}
+		store.Close()
+	}
+
+	conn, err = sqlite.OpenConn(dbPath, sqlite.SQLITE_OPEN_READONLY)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer conn.Close()
+
+	var namespaced, migrations int
+	err = sqlitex.Exec(conn, `SELECT COUNT(*) FROM context_memory WHERE namespace = ?;`, func(stmt *sqlite.Stmt) error {
+		namespaced = stmt.ColumnInt(0)
+		return nil
+	}, contextstore.DefaultNamespace)
+	if err == nil {
+		err = sqlitex.Exec(conn, `SELECT COUNT(*) FROM schema_version;`, func(stmt *sqlite.Stmt) error {
+			migrations = stmt.ColumnInt(0)
+			return nil
+		})
+	}
+	if err != nil {
+		t.Fatalf("Failed to inspect migrated database: %v", err)
+	}
+	if namespaced != 2 {
+		t.Errorf("Expected 2 entries in the default namespace, got %d", namespaced)
+	}
+	if migrations != contextstore.LatestSchemaVersion {
+		t.Errorf("Expected %d recorded migrations, got %d", contextstore.LatestSchemaVersion, migrations)
+	}
+}
+
+// TestSnapshotHashesMatchAcrossStores fills a memory store and a SQLite
+// store with the same content in different orders and checks that their
+// snapshot hashes agree.
+func TestSnapshotHashesMatchAcrossStores(t *testing.T) {
+	sqliteStore := contextstore.NewSQLiteContextStore()
+	if err := sqliteStore.Initialize(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+	defer sqliteStore.Close()
+	memoryStore := contextstore.NewMemoryContextStore()
+
+	type stored struct {
+		id, summary string
+		embedding   []float32
+		tags        []string
+		provenance  []string
+	}
+	entries := []stored{
+		{"a", "alpha", []float32{1, 0}, []string{"design", "api"}, []string{"notes.md", "tool:save_context"}},
+		{"b", "beta", []float32{0, 1}, nil, nil},
+		{"c", "gamma", []float32{1, 1}, []string{"bug"}, nil},
+	}
+	// Sub-second precision is dropped by SQLite and ignored by the hash
+	timestamp := time.Date(2024, 1, 1, 0, 0, 0, 500, time.UTC)
+
+	fill := func(store interface {
+		contextstore.ContextStore
+		contextstore.TaggedStore
+		contextstore.ProvenanceStore
+	}, order []int) {
+		for _, i := range order {
+			e := entries[i]
+			data, _ := vector.Float32SliceToBytes(e.embedding)
+			if err := store.Store(e.id, e.summary, data, timestamp); err != nil {
+				t.Fatalf("Store(%q) error = %v", e.id, err)
+			}
+			if err := store.SetTags(e.id, e.tags); err != nil {
+				t.Fatalf("SetTags(%q) error = %v", e.id, err)
+			}
+			if err := store.SetProvenance(e.id, e.provenance); err != nil {
+				t.Fatalf("SetProvenance(%q) error = %v", e.id, err)
+			}
+		}
+	}
+	fill(sqliteStore, []int{0, 1, 2})
+	fill(memoryStore, []int{2, 0, 1})
+
+	sqliteHashes, err := sqliteStore.SnapshotHashes()
+	if err != nil {
+		t.Fatalf("SnapshotHashes() error = %v", err)
+	}
+	memoryHashes, err := memoryStore.SnapshotHashes()
+	if err != nil {
+		t.Fatalf("SnapshotHashes() error = %v", err)
+	}
+	if len(sqliteHashes) != 1 || sqliteHashes[contextstore.DefaultNamespace] != memoryHashes[contextstore.DefaultNamespace] {
+		t.Errorf("Expected equal snapshot hashes, got SQLite %v and memory %v", sqliteHashes, memoryHashes)
+	}
+}
+
+// TestSQLiteContextStoreEncryptsNamespaces checks that summaries and titles
+// of an encrypted namespace are unreadable in the database, readable with
+// its master key, and hidden from a store without it.
+func TestSQLiteContextStoreEncryptsNamespaces(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	masterKeys, err := contextstore.ParseMasterKeys("team-a:" + base64.StdEncoding.EncodeToString(make([]byte, contextstore.MasterKeySize)))
+	if err != nil {
+		t.Fatalf("ParseMasterKeys() error = %v", err)
+	}
+	keyring, err := contextstore.NewKeyring(masterKeys, map[string]string{contextstore.DefaultNamespace: "team-a"})
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	embedding, _ := vector.Float32SliceToBytes([]float32{1, 0})
+
+	store := contextstore.NewSQLiteContextStore()
+	if err := store.Initialize(dbPath); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+	if err := store.Store("before", "stored before encryption", embedding, time.Unix(1000, 0)); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	if err := store.SetTitle("before", "Titled before encryption"); err != nil {
+		t.Fatalf("SetTitle() error = %v", err)
+	}
+	plainHashes, _ := store.SnapshotHashes()
+	if err := store.SetKeyring(keyring); err != nil {
+		t.Fatalf("SetKeyring() error = %v", err)
+	}
+	if err := store.Store("after", "stored after encryption", embedding, time.Unix(2000, 0)); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	if err := store.SetTitle("after", "Titled after encryption"); err != nil {
+		t.Fatalf("SetTitle() error = %v", err)
+	}
+
+	entries, err := store.ListEntries()
+	if err != nil || len(entries) != 2 || entries[0].SummaryText != "stored before encryption" || entries[1].SummaryText != "stored after encryption" {
+		t.Errorf("Expected both summaries decrypted, got %v, %v", entries, err)
+	}
+	if len(entries) == 2 && (entries[0].Title != "Titled before encryption" || entries[1].Title != "Titled after encryption") {
+		t.Errorf("Expected both titles decrypted, got %q and %q", entries[0].Title, entries[1].Title)
+	}
+	if title, err := store.GetTitle("before"); err != nil || title != "Titled before encryption" {
+		t.Errorf("GetTitle() = %q, %v, want the decrypted title", title, err)
+	}
+	if err := store.Delete("after"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if hashes, _ := store.SnapshotHashes(); hashes[contextstore.DefaultNamespace] != plainHashes[contextstore.DefaultNamespace] {
+		t.Errorf("Expected the snapshot hash to ignore encryption, got %v, want %v", hashes, plainHashes)
+	}
+	store.Close()
+
+	conn, err := sqlite.OpenConn(dbPath, sqlite.SQLITE_OPEN_READONLY)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	err = sqlitex.Exec(conn, `SELECT summary_text FROM context_memory;`, func(stmt *sqlite.Stmt) error {
+		if summary := stmt.ColumnText(0); strings.Contains(summary, "encryption") {
+			t.Errorf("Expected the summary to be encrypted at rest, got %q", summary)
+		}
+		return nil
+	})
+	if err != nil {
+		conn.Close()
+		t.Fatalf("Failed to read summaries: %v", err)
+	}
+	err = sqlitex.Exec(conn, `SELECT summary_text FROM context_fts;`, func(stmt *sqlite.Stmt) error {
+		t.Errorf("Expected encrypted summaries to be left out of the keyword index, got %q", stmt.ColumnText(0))
+		return nil
+	})
+	if err != nil {
+		conn.Close()
+		t.Fatalf("Failed to read keyword index: %v", err)
+	}
+	err = sqlitex.Exec(conn, `SELECT title FROM context_titles;`, func(stmt *sqlite.Stmt) error {
+		if title := stmt.ColumnText(0); strings.Contains(title, "encryption") {
+			t.Errorf("Expected the title to be encrypted at rest, got %q", title)
+		}
+		return nil
+	})
+	conn.Close()
+	if err != nil {
+		t.Fatalf("Failed to read titles: %v", err)
+	}
+
+	// Without the master key, the namespace is locked
+	locked := contextstore.NewSQLiteContextStore()
+	if err := locked.Initialize(dbPath); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+	defer locked.Close()
+	if results, err := locked.Search([]float32{1, 0}, 5); err != nil || len(results) != 0 {
+		t.Errorf("Expected no readable entries, got %v, %v", results, err)
+	}
+	if hashes, err := locked.SnapshotHashes(); err != nil || len(hashes) != 0 {
+		t.Errorf("Expected the locked namespace to be left out, got %v, %v", hashes, err)
+	}
+	if err := locked.Store("new", "text", embedding, time.Now()); !errors.Is(err, contextstore.ErrNamespaceLocked) {
+		t.Errorf("Expected ErrNamespaceLocked writing without the key, got %v", err)
+	}
+	if _, err := locked.ExportNamespace(contextstore.DefaultNamespace); !errors.Is(err, contextstore.ErrNamespaceLocked) {
+		t.Errorf("Expected ErrNamespaceLocked exporting without the key, got %v", err)
+	}
+}
+
+func TestNewKeyringRejectsInvalidKeys(t *testing.T) {
+	if _, err := contextstore.NewKeyring(map[string][]byte{"short": make([]byte, 16)}, nil); err == nil {
+		t.Error("Expected an error for a short master key")
+	}
+	if _, err := contextstore.NewKeyring(nil, map[string]string{"team": "missing"}); err == nil {
+		t.Error("Expected an error for a namespace with an unknown master key")
+	}
+	if _, err := contextstore.ParseMasterKeys("no-separator"); err == nil {
+		t.Error("Expected an error for a key without an ID")
+	}
+}
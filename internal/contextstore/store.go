@@ -3,9 +3,993 @@
 package contextstore
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+// DefaultNamespace is the namespace of entries stored without one, including
+// every entry saved before namespaces existed.
+const DefaultNamespace = "default"
+
+// Sources recorded in provenance chains by this module. Callers may record
+// any other source, such as an importer name, a file path or a URL.
+const (
+	// SourceTool prefixes the MCP tool that stored an entry, as in
+	// "tool:save_context".
+	SourceTool = "tool"
+
+	// SourceAPI marks entries stored through the Go API.
+	SourceAPI = "api"
+
+	// SourceGit prefixes the commit an entry was captured from, as in
+	// "git:9fceb02d0ae598e95dc970b74767f19372d61af8".
+	SourceGit = "git"
+
+	// SourceConsolidated prefixes each entry merged into a consolidated
+	// entry, as in "consolidated:9fceb02d0ae598e9".
+	SourceConsolidated = "consolidated"
 )
 
+// MaxProvenance bounds the length of a provenance chain. Longer chains keep
+// their origin and their most recent sources.
+const MaxProvenance = 16
+
+// Errors returned when a caller needs an optional store capability
+var (
+	// ErrScoresUnsupported is returned when similarity scores or search
+	// filters are requested from a store that cannot provide them.
+	ErrScoresUnsupported = errors.New("store does not support scored search")
+
+	// ErrKeywordSearchUnsupported is returned when a keyword search is
+	// requested from a store without a keyword index.
+	ErrKeywordSearchUnsupported = errors.New("store does not support keyword search")
+
+	// ErrTagsUnsupported is returned when tags are requested from a store
+	// that cannot hold them.
+	ErrTagsUnsupported = errors.New("store does not support tags")
+
+	// ErrUsageUnsupported is returned when retrieval statistics are
+	// requested from a store that does not track them.
+	ErrUsageUnsupported = errors.New("store does not support usage tracking")
+
+	// ErrSoftClearUnsupported is returned when a recoverable clear is
+	// requested from a store that can only delete entries outright.
+	ErrSoftClearUnsupported = errors.New("store does not support recoverable clears")
+
+	// ErrQuarantineUnsupported is returned when an entry embedded by a
+	// fallback provider is saved to a store that cannot keep it apart from
+	// the search index.
+	ErrQuarantineUnsupported = errors.New("store does not support quarantined entries")
+
+	// ErrProvenanceUnsupported is returned when a source is recorded in a
+	// store that cannot hold provenance.
+	ErrProvenanceUnsupported = errors.New("store does not support provenance")
+
+	// ErrGenerationUnsupported is returned when the generation of a summary
+	// is recorded in a store that cannot hold it.
+	ErrGenerationUnsupported = errors.New("store does not support summary generations")
+
+	// ErrPinsUnsupported is returned when an entry is pinned in a store
+	// that cannot pin entries.
+	ErrPinsUnsupported = errors.New("store does not support pinned entries")
+
+	// ErrReferencesUnsupported is returned when references to repository
+	// files are recorded in or looked up from a store that cannot keep them.
+	ErrReferencesUnsupported = errors.New("store does not support file references")
+
+	// ErrTitlesUnsupported is returned when the title of a summary is
+	// recorded in a store that cannot hold it.
+	ErrTitlesUnsupported = errors.New("store does not support summary titles")
+
+	// ErrSnapshotUnsupported is returned when a snapshot hash is requested
+	// from a store that cannot compute one.
+	ErrSnapshotUnsupported = errors.New("store does not support snapshot hashes")
+
+	// ErrBatchesUnsupported is returned when entries are grouped into a
+	// batch in a store that cannot track batches.
+	ErrBatchesUnsupported = errors.New("store does not support batches")
+
+	// ErrSessionsUnsupported is returned when entries are grouped into an
+	// agent session in a store that cannot track sessions.
+	ErrSessionsUnsupported = errors.New("store does not support sessions")
+
+	// ErrRelationsUnsupported is returned when entries are linked in or
+	// their relations looked up from a store that cannot keep them.
+	ErrRelationsUnsupported = errors.New("store does not support relations")
+
+	// ErrEntryNotFound is returned when an entry that is not stored is
+	// linked or its relations are listed.
+	ErrEntryNotFound = errors.New("context entry not found")
+
+	// ErrArchiveUnsupported is returned when a namespace is archived or
+	// restored in a store that cannot move namespaces in and out.
+	ErrArchiveUnsupported = errors.New("store does not support namespace archives")
+
+	// ErrNamespaceNotEmpty is returned when a namespace is restored over
+	// one that still holds entries.
+	ErrNamespaceNotEmpty = errors.New("namespace already holds entries")
+
+	// ErrGapsUnsupported is returned when retrieval gaps are recorded in or
+	// listed from a store that cannot keep them.
+	ErrGapsUnsupported = errors.New("store does not support retrieval gaps")
+
+	// ErrReviewsUnsupported is returned when reviews of stale entries are
+	// recorded in or listed from a store that cannot keep them.
+	ErrReviewsUnsupported = errors.New("store does not support entry reviews")
+
+	// ErrNamespacesUnsupported is returned when an entry is saved to a
+	// namespace in a store that keeps every entry in DefaultNamespace.
+	ErrNamespacesUnsupported = errors.New("store does not support namespaces")
+)
+
+// SearchResult is a context entry returned by a scored search.
+type SearchResult struct {
+	ID          string
+	SummaryText string
+	Timestamp   time.Time
+
+	// Similarity is the cosine similarity between the entry and the query,
+	// or its BM25 score for a keyword search.
+	Similarity float64
+}
+
+// SearchFilter excludes entries from a scored search. Excluded entries do not
+// count towards the limit.
+type SearchFilter struct {
+	// ExcludeIDs lists entries that must not be returned.
+	ExcludeIDs []string
+
+	// ExcludeTags drops every entry carrying any of these tags.
+	ExcludeTags []string
+
+	// ExcludeHashes drops every entry whose summary has one of these
+	// ContentHash values.
+	ExcludeHashes []string
+
+	// Namespace restricts the search to the entries of one namespace.
+	// Empty searches every namespace.
+	Namespace string
+
+	// Pinned restricts the search to pinned entries. Only stores that
+	// implement PinStore honor it.
+	Pinned bool
+
+	// Tags restricts the search to entries carrying at least one of these
+	// tags. Only stores that implement TaggedStore honor it.
+	Tags []string
+
+	// Session restricts the search to the entries saved in one agent
+	// session. Only stores that implement SessionStore honor it.
+	Session string
+
+	// Since and Until restrict the search to entries saved at or after
+	// Since and before Until. A zero time leaves that end open.
+	Since time.Time
+	Until time.Time
+}
+
+// ScoredSearcher is implemented by stores that can report the similarity
+// of each search result, which retrieval features such as adaptive limits
+// rely on.
+type ScoredSearcher interface {
+	// SearchWithScores returns up to limit entries not excluded by filter,
+	// ordered like Search.
+	SearchWithScores(queryEmbedding []float32, limit int, filter SearchFilter) ([]SearchResult, error)
+}
+
+// KeywordSearcher is implemented by stores that can search summaries for
+// the words of a query without embeddings, for exact identifiers and for
+// when the embedder is unavailable.
+type KeywordSearcher interface {
+	// SearchKeywords returns up to limit entries not excluded by filter
+	// whose summaries contain a word of query, by their BM25 score, best
+	// first. Words are runs of letters, digits and underscores, compared
+	// without case.
+	SearchKeywords(query string, limit int, filter SearchFilter) ([]SearchResult, error)
+}
+
+// TaggedStore is implemented by stores that can label entries with tags.
+// Tags survive Store and Replace of the same ID and are removed with the entry.
+type TaggedStore interface {
+	// SetTags replaces the tags of an existing entry.
+	SetTags(id string, tags []string) error
+
+	// GetTags returns the tags of an entry, sorted.
+	GetTags(id string) ([]string, error)
+}
+
+// Entry is a stored context entry with its retrieval statistics.
+type Entry struct {
+	ID          string
+	SummaryText string
+	Embedding   []float32
+	Timestamp   time.Time
+
+	// Retrievals is the number of times the entry was returned by
+	// retrieve_context. LastRetrieved is zero if it never was.
+	Retrievals    int
+	LastRetrieved time.Time
+
+	// Provenance is the entry's provenance chain, if the store is a
+	// ProvenanceStore.
+	Provenance []string
+
+	// Generation records what wrote the summary, if the store is a
+	// GenerationStore. It is zero if nothing was recorded.
+	Generation Generation
+
+	// Pinned reports whether the entry is pinned, if the store is a
+	// PinStore.
+	Pinned bool
+
+	// Title is the one-line title of the summary, if the store is a
+	// TitleStore. It is empty if none was recorded.
+	Title string
+
+	// Namespace is the namespace of the entry, DefaultNamespace if the
+	// store is not a NamespacedStore.
+	Namespace string
+}
+
+// UsageStore is implemented by stores that track how often entries are
+// retrieved and can list every entry for analysis such as cleanup reports.
+// Statistics survive Store and Replace of the same ID and are removed with
+// the entry.
+type UsageStore interface {
+	// RecordRetrievals counts one retrieval at the given time for each ID.
+	// IDs that are not stored are ignored.
+	RecordRetrievals(ids []string, at time.Time) error
+
+	// ListEntries returns every entry, oldest first.
+	ListEntries() ([]Entry, error)
+}
+
+// SoftClearer is implemented by stores that can clear entries recoverably.
+// Cleared entries are hidden from every other method until they are
+// restored or purged. Their tags and usage are kept with them.
+type SoftClearer interface {
+	// MarkCleared hides every entry, recording that it was cleared at the
+	// given time. It returns the number of entries hidden.
+	MarkCleared(at time.Time) (int, error)
+
+	// UndoClear restores every cleared entry that has not been purged. An
+	// entry whose ID was stored again since it was cleared is purged rather
+	// than restored. It returns the number of entries restored.
+	UndoClear() (int, error)
+
+	// PurgeCleared permanently deletes entries cleared before the given
+	// time. It returns the number of entries deleted.
+	PurgeCleared(before time.Time) (int, error)
+}
+
+// QuarantinedEntry is an entry held out of the search index until it is
+// re-embedded by the primary embedding provider.
+type QuarantinedEntry struct {
+	ID          string
+	SummaryText string
+	Timestamp   time.Time
+
+	// Provider is the fallback provider that embedded the entry.
+	Provider string
+
+	// Dimensions is the size of the fallback embedding.
+	Dimensions int
+}
+
+// QuarantineStore is implemented by stores that can hold entries embedded
+// by a fallback provider. Their embeddings may come from another model, so
+// they are hidden from searches and listings until ReleaseQuarantined moves
+// them into the index with a primary embedding. Delete and Clear remove
+// quarantined entries too, and so does MarkCleared: a cleared quarantined
+// entry cannot be restored by UndoClear.
+type QuarantineStore interface {
+	// Quarantine stores an entry and its tags outside the search index.
+	Quarantine(id string, summaryText string, embedding []byte, timestamp time.Time, tags []string, provider string) error
+
+	// ListQuarantined returns every quarantined entry, oldest first.
+	ListQuarantined() ([]QuarantinedEntry, error)
+
+	// ReleaseQuarantined moves a quarantined entry into the search index
+	// with a new embedding, keeping its summary, timestamp and tags.
+	ReleaseQuarantined(id string, embedding []byte) error
+}
+
+// ProvenanceStore is implemented by stores that record where each entry came
+// from. A provenance chain lists sources from the origin of the content,
+// such as a file path or URL, to the last thing that stored it, such as
+// "tool:replace_context". Chains belong to the ID like tags do, and reach
+// quarantined entries too.
+type ProvenanceStore interface {
+	// SetProvenance replaces the provenance chain of an existing entry.
+	SetProvenance(id string, chain []string) error
+
+	// GetProvenance returns the provenance chain of an entry, empty if none
+	// was recorded.
+	GetProvenance(id string) ([]string, error)
+}
+
+// Generation records what wrote a summary, so summaries of poor quality can
+// be traced to a model and regenerated.
+type Generation struct {
+	// Summarizer is the kind of summarizer that wrote the summary, such as
+	// "ai" or "basic", or "verbatim" for text stored as it was.
+	Summarizer string `json:"summarizer"`
+
+	// Provider and Model name the LLM provider and model that wrote an AI
+	// summary.
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+
+	// PromptVersion identifies the prompt template an AI summary was
+	// written with.
+	PromptVersion string `json:"prompt_version,omitempty"`
+}
+
+// IsZero reports whether no generation was recorded
+func (g Generation) IsZero() bool {
+	return g == Generation{}
+}
+
+// GenerationStore is implemented by stores that record the generation of
+// each summary. Like provenance, a generation belongs to the ID and reaches
+// quarantined entries too, so whoever replaces a summary records the
+// generation of the new one.
+type GenerationStore interface {
+	// SetGeneration records the generation of an existing entry's summary.
+	SetGeneration(id string, generation Generation) error
+
+	// GetGeneration returns the generation of an entry's summary, zero if
+	// none was recorded.
+	GetGeneration(id string) (Generation, error)
+}
+
+// TitleStore is implemented by stores that record a one-line title with
+// each summary, so listings can show entries compactly. Like a generation, a
+// title belongs to the ID and reaches quarantined entries too, so whoever
+// replaces a summary records the title of the new one. Titles are encrypted
+// with the summaries of encrypted namespaces; an entry moved to another
+// namespace loses its title.
+type TitleStore interface {
+	// SetTitle records the title of an existing entry's summary.
+	SetTitle(id string, title string) error
+
+	// GetTitle returns the title of an entry's summary, empty if none was
+	// recorded.
+	GetTitle(id string) (string, error)
+}
+
+// PinStore is implemented by stores that can pin entries, so retrieval
+// includes them whatever the query. Like tags, a pin belongs to the ID: it
+// survives Store and Replace and is removed with the entry. Only visible
+// entries can be pinned.
+type PinStore interface {
+	// SetPinned pins or unpins an existing entry.
+	SetPinned(id string, pinned bool) error
+
+	// ListPinned returns the IDs of the pinned entries of a namespace,
+	// earliest pinned first. An empty namespace lists every namespace.
+	ListPinned(namespace string) ([]string, error)
+}
+
+// Reference links an entry to a file of the indexed repository, or to a Go
+// symbol declared in it
+type Reference struct {
+	// Path is the file's slash-separated path from the repository root.
+	Path string `json:"path"`
+
+	// Symbol is the symbol's name, "Type.Method" for a method. It is empty
+	// for a reference to the file itself.
+	Symbol string `json:"symbol,omitempty"`
+}
+
+// LinkedEntry is an entry returned by ListReferencing, with its references
+// to the file it was looked up by
+type LinkedEntry struct {
+	ID          string
+	SummaryText string
+	Title       string
+	Timestamp   time.Time
+	References  []Reference
+}
+
+// ReferenceStore is implemented by stores that record which repository
+// files and symbols each entry mentions. Like tags, references belong to
+// the ID: they survive Store and Replace and are removed with the entry.
+type ReferenceStore interface {
+	// SetReferences replaces the references of an existing or quarantined
+	// entry.
+	SetReferences(id string, references []Reference) error
+
+	// GetReferences returns the references of an entry, sorted.
+	GetReferences(id string) ([]Reference, error)
+
+	// ListReferencing returns the visible entries referencing the file at
+	// path or a symbol declared in it, newest first.
+	ListReferencing(path string) ([]LinkedEntry, error)
+}
+
+// SnapshotHasher is implemented by stores that can hash their content, so
+// two stores can be compared cheaply after replication or an export and
+// import round trip. The hash of a namespace is the root of a Merkle tree
+// over its visible entries ordered by ID. Each leaf covers the ID, summary,
+// embedding, timestamp to the second, tags and provenance chain of an
+// entry, so equal content hashes equally in every store. Generations,
+// titles, pins, retrieval statistics and cleared or quarantined entries are
+// not covered.
+type SnapshotHasher interface {
+	// SnapshotHashes returns the hex snapshot hash of each namespace that
+	// holds entries.
+	SnapshotHashes() (map[string]string, error)
+}
+
+// Batch summarizes the entries written by one import or ingestion run.
+type Batch struct {
+	ID string
+
+	// Entries is the number of entries in the batch, quarantined ones
+	// included.
+	Entries int
+
+	// FirstStored and LastStored are the oldest and newest timestamps of
+	// the batch's entries.
+	FirstStored time.Time
+	LastStored  time.Time
+}
+
+// BatchStore is implemented by stores that can group entries by the import
+// or ingestion run that wrote them, so a bad run can be undone in one call.
+// The batch of an entry belongs to its ID like tags do, and reaches
+// quarantined entries too. Cleared entries keep their batch but are not
+// listed or rolled back until they are restored.
+type BatchStore interface {
+	// SetBatch records that an existing or quarantined entry was written
+	// by the batch.
+	SetBatch(id string, batch string) error
+
+	// ListBatches returns every batch that holds entries, oldest first.
+	ListBatches() ([]Batch, error)
+
+	// DeleteBatch deletes every entry of the batch, quarantined ones
+	// included. It returns the number of entries deleted.
+	DeleteBatch(batch string) (int, error)
+}
+
+// Session summarizes the entries saved during one agent session.
+type Session struct {
+	ID string
+
+	// Entries is the number of entries in the session, quarantined ones
+	// included.
+	Entries int
+
+	// FirstStored and LastStored are the oldest and newest timestamps of
+	// the session's entries.
+	FirstStored time.Time
+	LastStored  time.Time
+}
+
+// SessionStore is implemented by stores that can group entries by the
+// agent session that saved them, so a session's memories can be listed,
+// searched together with SearchFilter.Session, and expired in one call.
+// Like a batch, the session of an entry belongs to its ID and reaches
+// quarantined entries too, and cleared entries keep their session but are
+// not listed or expired until they are restored.
+type SessionStore interface {
+	// SetSession records that an existing or quarantined entry was saved
+	// in the session.
+	SetSession(id string, session string) error
+
+	// ListSessions returns every session that holds entries, most
+	// recently active first.
+	ListSessions() ([]Session, error)
+
+	// DeleteSession deletes every entry of the session, quarantined ones
+	// included. It returns the number of entries deleted.
+	DeleteSession(session string) (int, error)
+}
+
+// Types of the relations between entries
+const (
+	// RelationSupersedes marks an entry that replaces an outdated one,
+	// such as a reversed decision.
+	RelationSupersedes = "supersedes"
+
+	// RelationElaborates marks an entry that adds detail to another.
+	RelationElaborates = "elaborates"
+
+	// RelationContradicts marks an entry at odds with another, for a
+	// person or agent to resolve.
+	RelationContradicts = "contradicts"
+)
+
+// Relation is a typed link from the entry EntryID to the entry RelatedID,
+// read as "EntryID supersedes RelatedID".
+type Relation struct {
+	EntryID   string
+	RelatedID string
+	Type      string
+	CreatedAt time.Time
+}
+
+// RelatedEntry is a relation of an entry together with the visible entry
+// at its other end.
+type RelatedEntry struct {
+	Relation
+
+	// ID, SummaryText, Title and Timestamp describe the entry at the
+	// other end: RelatedID for an outgoing relation, EntryID for an
+	// incoming one.
+	ID          string
+	SummaryText string
+	Title       string
+	Timestamp   time.Time
+}
+
+// Outgoing reports whether the relation starts at the listed entry rather
+// than at the related one.
+func (r RelatedEntry) Outgoing() bool {
+	return r.ID == r.RelatedID
+}
+
+// RelationStore is implemented by stores that can link entries with typed
+// relations, so agents can record which memory supersedes, elaborates or
+// contradicts which and follow those links later. Relations are kept apart
+// from the entries: they survive Store and Replace of either end, go with
+// an entry when it is deleted and, like tags, stay with cleared entries
+// until they are restored or purged. They are not archived.
+type RelationStore interface {
+	// Link records a relation between two visible entries, or returns
+	// ErrEntryNotFound. Linking a pair again with the same type keeps the
+	// original relation.
+	Link(relation Relation) error
+
+	// Unlink removes the relation of the given type from id to relatedID.
+	// It reports whether there was one.
+	Unlink(id string, relatedID string, relationType string) (bool, error)
+
+	// ListRelations returns the relations from and to a visible entry
+	// whose other end is visible too, oldest first, or returns
+	// ErrEntryNotFound.
+	ListRelations(id string) ([]RelatedEntry, error)
+}
+
+// Gap is a retrieval query that returned nothing above the score threshold,
+// pointing at knowledge the store is missing.
+type Gap struct {
+	Namespace string
+	Query     string
+
+	// Count is how often the query found nothing, first at FirstSeen and
+	// last at LastSeen.
+	Count     int
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// GapStore is implemented by stores that log the retrieval queries that
+// found nothing, so the missing knowledge can be ingested. Gaps are kept
+// per namespace and query, apart from the entries.
+type GapStore interface {
+	// RecordGap counts one retrieval of query in namespace that found
+	// nothing at the given time.
+	RecordGap(namespace string, query string, at time.Time) error
+
+	// ListGaps returns the gaps of namespace, or of every namespace if it
+	// is empty, most often asked first.
+	ListGaps(namespace string) ([]Gap, error)
+
+	// DeleteGaps forgets the listed queries of namespace, once they are
+	// filled. It returns the number of gaps deleted.
+	DeleteGaps(namespace string, queries []string) (int, error)
+}
+
+// Actions a Review records
+const (
+	// ReviewConfirm vouches that the entry still holds.
+	ReviewConfirm = "confirm"
+
+	// ReviewRefresh replaces the entry with up-to-date text.
+	ReviewRefresh = "refresh"
+
+	// ReviewRetire deletes the entry as out of date.
+	ReviewRetire = "retire"
+)
+
+// Review is a person's decision on an entry flagged as stale: that it
+// still holds, that it was refreshed, or that it was retired.
+type Review struct {
+	ID       string
+	Action   string
+	Reviewer string
+	Note     string
+	At       time.Time
+}
+
+// ReviewStore is implemented by stores that record the reviews of stale
+// entries. Reviews are kept apart from the entries, so the review that
+// retired an entry outlives it.
+type ReviewStore interface {
+	// RecordReview records a review.
+	RecordReview(review Review) error
+
+	// ListReviews returns the reviews of the entry with the given ID, or
+	// of every entry if it is empty, latest first.
+	ListReviews(id string) ([]Review, error)
+}
+
+// NamespacedStore is implemented by stores that can keep entries in
+// namespaces other than DefaultNamespace. Store and Replace keep the
+// namespace of an ID that is already stored and put new IDs in
+// DefaultNamespace.
+type NamespacedStore interface {
+	// StoreInNamespace stores an entry in namespace, moving it there if
+	// its ID is stored in another one.
+	StoreInNamespace(namespace string, id string, summaryText string, embedding []byte, timestamp time.Time) error
+}
+
+// ArchivedEntry is an entry moved out of the live store with a namespace:
+// the content covered by its snapshot hash, plus its batch, session,
+// generation, title, references and pin.
+type ArchivedEntry struct {
+	ID          string    `json:"id"`
+	SummaryText string    `json:"summary_text"`
+	Embedding   []byte    `json:"embedding"`
+	Timestamp   time.Time `json:"timestamp"`
+	Tags        []string  `json:"tags,omitempty"`
+	Provenance  []string  `json:"provenance,omitempty"`
+	Batch       string    `json:"batch,omitempty"`
+	Session     string    `json:"session,omitempty"`
+
+	// Generation is nil for entries without a recorded generation and in
+	// archives written before generations were recorded.
+	Generation *Generation `json:"generation,omitempty"`
+
+	// Title is empty for entries without a recorded title.
+	Title string `json:"title,omitempty"`
+
+	// References are the repository files and symbols the entry mentions.
+	References []Reference `json:"references,omitempty"`
+
+	// Pinned restores the entry's pin with it.
+	Pinned bool `json:"pinned,omitempty"`
+}
+
+// NamespaceArchiver is implemented by stores that can move a namespace out
+// of the live store and back, so finished projects stop weighing on every
+// search. Retrieval statistics are not archived, and cleared and
+// quarantined entries are left alone.
+type NamespaceArchiver interface {
+	// ExportNamespace returns the visible entries of a namespace, oldest
+	// first.
+	ExportNamespace(namespace string) ([]ArchivedEntry, error)
+
+	// DeleteArchived deletes the listed visible entries of a namespace with
+	// their tags, usage, provenance, generation, title, references, pin,
+	// batch, session and relations, leaving entries stored since the export. It
+	// returns the number deleted.
+	DeleteArchived(namespace string, ids []string) (int, error)
+
+	// ImportNamespace stores entries in a namespace that holds none, or
+	// returns ErrNamespaceNotEmpty. It stores nothing if any ID is taken.
+	ImportNamespace(namespace string, entries []ArchivedEntry) error
+}
+
+// EncryptedStore is implemented by stores that can encrypt the summaries of
+// chosen namespaces with envelope encryption: each namespace has a data key,
+// stored wrapped by a master key from a Keyring. Entries of a namespace whose
+// master key is not loaded are skipped by searches, listings and snapshot
+// hashes, and writing or exporting them returns ErrNamespaceLocked.
+// Only summaries and their titles are encrypted: embeddings, tags,
+// provenance, generations, pins, references, usage, retrieval gaps, reviews
+// and the embedding cache stay in plaintext.
+type EncryptedStore interface {
+	// SetKeyring sets the master keys and the namespaces to encrypt.
+	SetKeyring(keyring *Keyring) error
+}
+
+// IdleReleaser is implemented by stores that can give back memory and
+// flush their journal while the server sits idle.
+type IdleReleaser interface {
+	// ReleaseIdle releases idle resources. The store stays usable.
+	ReleaseIdle() error
+}
+
+// Pinger is implemented by stores whose backing storage can become
+// unreachable, such as a database file.
+type Pinger interface {
+	// Ping checks that the store can be read, without reading entries.
+	Ping() error
+}
+
+// errEmptyBatch is returned by DeleteBatch for an empty batch ID, which
+// would otherwise match every entry outside a batch
+var errEmptyBatch = errors.New("batch ID must not be empty")
+
+// sortBatches orders batches oldest first, then by ID
+func sortBatches(batches []Batch) {
+	sort.Slice(batches, func(i, j int) bool {
+		if !batches[i].FirstStored.Equal(batches[j].FirstStored) {
+			return batches[i].FirstStored.Before(batches[j].FirstStored)
+		}
+		return batches[i].ID < batches[j].ID
+	})
+}
+
+// errEmptySession is returned by DeleteSession for an empty session ID,
+// which would otherwise match every entry outside a session
+var errEmptySession = errors.New("session ID must not be empty")
+
+// sortSessions orders sessions most recently active first, then by ID
+func sortSessions(sessions []Session) {
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].LastStored.Equal(sessions[j].LastStored) {
+			return sessions[i].LastStored.After(sessions[j].LastStored)
+		}
+		return sessions[i].ID < sessions[j].ID
+	})
+}
+
+// errSelfRelation is returned by Link for a relation from an entry to itself
+var errSelfRelation = errors.New("an entry cannot be related to itself")
+
+// checkRelation checks that a relation links two distinct entries with a type
+func checkRelation(relation Relation) error {
+	switch {
+	case relation.EntryID == "" || relation.RelatedID == "":
+		return errors.New("relation entry IDs must not be empty")
+	case relation.Type == "":
+		return errors.New("relation type must not be empty")
+	case relation.EntryID == relation.RelatedID:
+		return errSelfRelation
+	}
+	return nil
+}
+
+// sortRelations orders relations oldest first, then by the entry at the
+// other end and type
+func sortRelations(relations []RelatedEntry) {
+	sort.Slice(relations, func(i, j int) bool {
+		if !relations[i].CreatedAt.Equal(relations[j].CreatedAt) {
+			return relations[i].CreatedAt.Before(relations[j].CreatedAt)
+		}
+		if relations[i].ID != relations[j].ID {
+			return relations[i].ID < relations[j].ID
+		}
+		return relations[i].Type < relations[j].Type
+	})
+}
+
+// sortGaps orders gaps most often asked first, then most recently asked,
+// then by namespace and query
+func sortGaps(gaps []Gap) {
+	sort.Slice(gaps, func(i, j int) bool {
+		if gaps[i].Count != gaps[j].Count {
+			return gaps[i].Count > gaps[j].Count
+		}
+		if !gaps[i].LastSeen.Equal(gaps[j].LastSeen) {
+			return gaps[i].LastSeen.After(gaps[j].LastSeen)
+		}
+		if gaps[i].Namespace != gaps[j].Namespace {
+			return gaps[i].Namespace < gaps[j].Namespace
+		}
+		return gaps[i].Query < gaps[j].Query
+	})
+}
+
+// sortReviews orders reviews latest first, then by ID. It is stable, so
+// reviews of an entry made at the same time keep the order they are given in.
+func sortReviews(reviews []Review) {
+	sort.SliceStable(reviews, func(i, j int) bool {
+		if !reviews[i].At.Equal(reviews[j].At) {
+			return reviews[i].At.After(reviews[j].At)
+		}
+		return reviews[i].ID < reviews[j].ID
+	})
+}
+
+// AppendProvenance returns chain followed by sources. Sources are trimmed and
+// empty ones dropped. The result is capped at MaxProvenance by dropping the
+// oldest sources after the origin.
+func AppendProvenance(chain []string, sources ...string) []string {
+	appended := append([]string{}, chain...)
+	for _, source := range sources {
+		if source = strings.TrimSpace(source); source != "" {
+			appended = append(appended, source)
+		}
+	}
+	if len(appended) > MaxProvenance {
+		appended = append(appended[:1], appended[len(appended)-MaxProvenance+1:]...)
+	}
+	return appended
+}
+
+// Origin is where an entry's content came from, read from the origin of its
+// provenance chain: the lines of a file, recorded as "docs/setup.md#L12-L40",
+// or a commit, recorded as SourceGit and its hash
+type Origin struct {
+	// Path is the file's slash-separated path, and StartLine and EndLine
+	// the first and last of its lines, counted from 1
+	Path      string `json:"path,omitempty"`
+	StartLine int    `json:"start_line,omitempty"`
+	EndLine   int    `json:"end_line,omitempty"`
+
+	// Commit is the full hash of the commit
+	Commit string `json:"commit,omitempty"`
+}
+
+// ParseOrigin reads the origin of a provenance chain. It reports false for
+// an empty chain and for origins naming neither a file's lines nor a
+// commit, such as "tool:save_context" or an importer's name.
+func ParseOrigin(chain []string) (Origin, bool) {
+	if len(chain) == 0 {
+		return Origin{}, false
+	}
+	origin := strings.TrimSpace(chain[0])
+	if commit, ok := strings.CutPrefix(origin, SourceGit+":"); ok && commit != "" {
+		return Origin{Commit: commit}, true
+	}
+	hash := strings.LastIndex(origin, "#L")
+	if hash < 1 {
+		return Origin{}, false
+	}
+	path, lines := origin[:hash], origin[hash+len("#L"):]
+	first, last, ranged := strings.Cut(lines, "-L")
+	if !ranged {
+		last = first
+	}
+	start, err := strconv.Atoi(first)
+	if err != nil || start < 1 {
+		return Origin{}, false
+	}
+	end, err := strconv.Atoi(last)
+	if err != nil || end < start {
+		return Origin{}, false
+	}
+	return Origin{Path: path, StartLine: start, EndLine: end}, true
+}
+
+// NormalizeTags trims and lowercases tags, dropping empty and duplicate ones.
+// The result is sorted.
+func NormalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// NormalizeReferences returns references sorted by path and symbol, without
+// duplicates or references without a path.
+func NormalizeReferences(references []Reference) []Reference {
+	normalized := make([]Reference, 0, len(references))
+	for _, reference := range references {
+		if reference.Path != "" {
+			normalized = append(normalized, reference)
+		}
+	}
+	sortReferences(normalized)
+	return slices.Compact(normalized)
+}
+
+// sortReferences orders references by path, the file itself before its
+// symbols
+func sortReferences(references []Reference) {
+	sort.Slice(references, func(i, j int) bool {
+		if references[i].Path != references[j].Path {
+			return references[i].Path < references[j].Path
+		}
+		return references[i].Symbol < references[j].Symbol
+	})
+}
+
+// ContentHash identifies a summary by its content, so callers can refer to
+// context they already hold without knowing its ID. It is the first 16 hex
+// characters of the SHA-256 of the summary text.
+func ContentHash(summary string) string {
+	sum := sha256.Sum256([]byte(summary))
+	return hex.EncodeToString(sum[:8])
+}
+
+// embeddingNorm returns the L2 norm of an encoded embedding. It reports false
+// if the embedding cannot be decoded.
+func embeddingNorm(embedding []byte) (float64, bool) {
+	decoded, err := vector.BytesToFloat32Slice(embedding)
+	if err != nil {
+		return 0, false
+	}
+	return vector.Norm(decoded), true
+}
+
+// embeddingDimensions returns the size of an encoded embedding, or 0 if it
+// cannot be decoded.
+func embeddingDimensions(embedding []byte) int {
+	decoded, err := vector.BytesToFloat32Slice(embedding)
+	if err != nil {
+		return 0
+	}
+	return len(decoded)
+}
+
+// compiledFilter is a SearchFilter prepared for lookups
+type compiledFilter struct {
+	ids    map[string]bool
+	tags   map[string]bool
+	hashes map[string]bool
+
+	// tagged holds the tags of which entries must carry one. Empty
+	// requires none.
+	tagged map[string]bool
+	since  time.Time
+	until  time.Time
+}
+
+// compile prepares the filter for lookups. Tags are normalized.
+func (f SearchFilter) compile() compiledFilter {
+	compiled := compiledFilter{
+		ids:    make(map[string]bool, len(f.ExcludeIDs)),
+		tags:   make(map[string]bool, len(f.ExcludeTags)),
+		hashes: make(map[string]bool, len(f.ExcludeHashes)),
+		tagged: make(map[string]bool, len(f.Tags)),
+		since:  f.Since,
+		until:  f.Until,
+	}
+	for _, id := range f.ExcludeIDs {
+		compiled.ids[id] = true
+	}
+	for _, tag := range NormalizeTags(f.ExcludeTags) {
+		compiled.tags[tag] = true
+	}
+	for _, hash := range f.ExcludeHashes {
+		compiled.hashes[strings.ToLower(hash)] = true
+	}
+	for _, tag := range NormalizeTags(f.Tags) {
+		compiled.tagged[tag] = true
+	}
+	return compiled
+}
+
+// excludes reports whether an entry with the given ID, summary, tags and
+// timestamp is filtered out
+func (f compiledFilter) excludes(id, summary string, tags []string, timestamp time.Time) bool {
+	if f.ids[id] || f.excludesSummary(summary) {
+		return true
+	}
+	if !f.since.IsZero() && timestamp.Before(f.since) {
+		return true
+	}
+	if !f.until.IsZero() && !timestamp.Before(f.until) {
+		return true
+	}
+	tagged := len(f.tagged) == 0
+	for _, tag := range tags {
+		if f.tags[tag] {
+			return true
+		}
+		tagged = tagged || f.tagged[tag]
+	}
+	return !tagged
+}
+
+// excludesSummary reports whether a summary is filtered out by its hash
+func (f compiledFilter) excludesSummary(summary string) bool {
+	return len(f.hashes) > 0 && f.hashes[ContentHash(summary)]
+}
+
 // ContextStore defines the interface for storing and retrieving context data.
 type ContextStore interface {
 	// Initialize initializes the store with configuration options.
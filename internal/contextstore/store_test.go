@@ -0,0 +1,27 @@
+package contextstore
+
+import "testing"
+
+func TestParseOrigin(t *testing.T) {
+	tests := []struct {
+		chain  []string
+		want   Origin
+		wantOK bool
+	}{
+		{[]string{"docs/deploy.md#L12-L40", "tool:save_context"}, Origin{Path: "docs/deploy.md", StartLine: 12, EndLine: 40}, true},
+		{[]string{"notes.txt#L7"}, Origin{Path: "notes.txt", StartLine: 7, EndLine: 7}, true},
+		{[]string{"git:9fceb02d0ae598e95dc970b74767f19372d61af8", "api"}, Origin{Commit: "9fceb02d0ae598e95dc970b74767f19372d61af8"}, true},
+		{[]string{"tool:save_context"}, Origin{}, false},
+		{[]string{"slack-import"}, Origin{}, false},
+		{[]string{"docs/deploy.md#L40-L12"}, Origin{}, false},
+		{[]string{"#L1-L2"}, Origin{}, false},
+		{[]string{"git:"}, Origin{}, false},
+		{nil, Origin{}, false},
+	}
+	for _, test := range tests {
+		got, ok := ParseOrigin(test.chain)
+		if got != test.want || ok != test.wantOK {
+			t.Errorf("ParseOrigin(%q) = %+v, %v; want %+v, %v", test.chain, got, ok, test.want, test.wantOK)
+		}
+	}
+}
@@ -0,0 +1,1854 @@
+// Package storetest provides a conformance suite that every
+// contextstore.ContextStore implementation must pass.
+//
+// A new backend only needs a test that hands the suite a constructor:
+//
+//	func TestContract(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) contextstore.ContextStore {
+//			store := NewMyStore()
+//			if err := store.Initialize(filepath.Join(t.TempDir(), "test.db")); err != nil {
+//				t.Fatal(err)
+//			}
+//			return store
+//		})
+//	}
+package storetest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+// NewStoreFunc returns a fresh, initialized, empty store. The suite closes it.
+type NewStoreFunc func(t *testing.T) contextstore.ContextStore
+
+// propertyRuns is how many random data sets each property test checks.
+const propertyRuns = 25
+
+// baseTime anchors entry timestamps. Entries are spaced a second apart because
+// some backends only persist second precision.
+var baseTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Run runs the full ContextStore contract against stores from newStore.
+func Run(t *testing.T, newStore NewStoreFunc) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store contextstore.ContextStore)
+	}{
+		{"StoreThenSearch", testStoreThenSearch},
+		{"StoreOverwritesID", testStoreOverwritesID},
+		{"DeleteRemoves", testDeleteRemoves},
+		{"DeleteMissing", testDeleteMissing},
+		{"ClearCounts", testClearCounts},
+		{"ReplacePreservesID", testReplacePreservesID},
+		{"ReplaceMissing", testReplaceMissing},
+		{"LimitBounds", testLimitBounds},
+		{"TiesNewestFirst", testTiesNewestFirst},
+		{"PropertyRankedBySimilarity", testPropertyRankedBySimilarity},
+		{"PropertyOrderingStable", testPropertyOrderingStable},
+		{"ScoresMatchSearch", testScoresMatchSearch},
+		{"ExcludeIDs", testExcludeIDs},
+		{"Tags", testTags},
+		{"ExcludeTags", testExcludeTags},
+		{"ExcludeHashes", testExcludeHashes},
+		{"SearchFilters", testSearchFilters},
+		{"KeywordSearch", testKeywordSearch},
+		{"Usage", testUsage},
+		{"SoftClear", testSoftClear},
+		{"Quarantine", testQuarantine},
+		{"Provenance", testProvenance},
+		{"Generations", testGenerations},
+		{"Titles", testTitles},
+		{"Pins", testPins},
+		{"References", testReferences},
+		{"SnapshotHashes", testSnapshotHashes},
+		{"Batches", testBatches},
+		{"Sessions", testSessions},
+		{"Relations", testRelations},
+		{"Gaps", testGaps},
+		{"Reviews", testReviews},
+		{"Namespaces", testNamespaces},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newStore(t)
+			defer store.Close()
+			test.fn(t, store)
+		})
+	}
+}
+
+// entry is a context entry used by the suite.
+type entry struct {
+	id        string
+	summary   string
+	embedding []float32
+	timestamp time.Time
+}
+
+func put(t *testing.T, s contextstore.ContextStore, e entry) {
+	t.Helper()
+	data, err := vector.Float32SliceToBytes(e.embedding)
+	if err != nil {
+		t.Fatalf("Failed to encode embedding: %v", err)
+	}
+	if err := s.Store(e.id, e.summary, data, e.timestamp); err != nil {
+		t.Fatalf("Store(%q) error = %v", e.id, err)
+	}
+}
+
+func search(t *testing.T, s contextstore.ContextStore, query []float32, limit int) []string {
+	t.Helper()
+	results, err := s.Search(query, limit)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	return results
+}
+
+func contains(results []string, summary string) bool {
+	for _, result := range results {
+		if result == summary {
+			return true
+		}
+	}
+	return false
+}
+
+func testStoreThenSearch(t *testing.T, s contextstore.ContextStore) {
+	entries := []entry{
+		{"a", "alpha", []float32{1, 0, 0}, baseTime},
+		{"b", "beta", []float32{0, 1, 0}, baseTime.Add(time.Second)},
+		{"c", "gamma", []float32{0, 0, 1}, baseTime.Add(2 * time.Second)},
+	}
+	for _, e := range entries {
+		put(t, s, e)
+	}
+
+	for _, e := range entries {
+		results := search(t, s, e.embedding, 1)
+		if len(results) != 1 || results[0] != e.summary {
+			t.Errorf("Searching for %q's own embedding returned %v", e.summary, results)
+		}
+	}
+}
+
+func testStoreOverwritesID(t *testing.T, s contextstore.ContextStore) {
+	put(t, s, entry{"a", "first", []float32{1, 0}, baseTime})
+	put(t, s, entry{"a", "second", []float32{1, 0}, baseTime.Add(time.Second)})
+
+	results := search(t, s, []float32{1, 0}, 10)
+	if len(results) != 1 || results[0] != "second" {
+		t.Errorf("Expected [second] after storing the same ID twice, got %v", results)
+	}
+}
+
+func testDeleteRemoves(t *testing.T, s contextstore.ContextStore) {
+	put(t, s, entry{"a", "alpha", []float32{1, 0}, baseTime})
+	put(t, s, entry{"b", "beta", []float32{0, 1}, baseTime.Add(time.Second)})
+
+	if err := s.Delete("a"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	results := search(t, s, []float32{1, 0}, 10)
+	if contains(results, "alpha") {
+		t.Errorf("Deleted entry still returned: %v", results)
+	}
+	if !contains(results, "beta") {
+		t.Errorf("Delete removed the wrong entry: %v", results)
+	}
+}
+
+func testDeleteMissing(t *testing.T, s contextstore.ContextStore) {
+	if err := s.Delete("missing"); err == nil {
+		t.Error("Expected error deleting a missing ID")
+	}
+}
+
+func testClearCounts(t *testing.T, s contextstore.ContextStore) {
+	count, err := s.Clear()
+	if err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected 0 cleared from an empty store, got %d", count)
+	}
+
+	for i := 0; i < 3; i++ {
+		put(t, s, entry{fmt.Sprintf("id-%d", i), fmt.Sprintf("summary %d", i), []float32{1, float32(i)}, baseTime.Add(time.Duration(i) * time.Second)})
+	}
+
+	count, err = s.Clear()
+	if err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 cleared, got %d", count)
+	}
+
+	if results := search(t, s, []float32{1, 0}, 10); len(results) != 0 {
+		t.Errorf("Expected no results after Clear, got %v", results)
+	}
+}
+
+func testReplacePreservesID(t *testing.T, s contextstore.ContextStore) {
+	put(t, s, entry{"a", "original", []float32{1, 0}, baseTime})
+
+	data, _ := vector.Float32SliceToBytes([]float32{0, 1})
+	if err := s.Replace("a", "replacement", data, baseTime.Add(time.Second)); err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+
+	results := search(t, s, []float32{0, 1}, 10)
+	if len(results) != 1 || results[0] != "replacement" {
+		t.Errorf("Expected [replacement], got %v", results)
+	}
+
+	// The replaced entry is still addressable by its original ID
+	if err := s.Delete("a"); err != nil {
+		t.Errorf("Delete() of replaced ID error = %v", err)
+	}
+}
+
+func testReplaceMissing(t *testing.T, s contextstore.ContextStore) {
+	data, _ := vector.Float32SliceToBytes([]float32{1, 0})
+	if err := s.Replace("missing", "summary", data, baseTime); err == nil {
+		t.Error("Expected error replacing a missing ID")
+	}
+
+	if results := search(t, s, []float32{1, 0}, 10); len(results) != 0 {
+		t.Errorf("Replace of a missing ID created an entry: %v", results)
+	}
+}
+
+func testLimitBounds(t *testing.T, s contextstore.ContextStore) {
+	for i := 0; i < 5; i++ {
+		put(t, s, entry{fmt.Sprintf("id-%d", i), fmt.Sprintf("summary %d", i), []float32{1, float32(i)}, baseTime.Add(time.Duration(i) * time.Second)})
+	}
+
+	tests := []struct {
+		limit int
+		want  int
+	}{
+		{-1, 0},
+		{0, 0},
+		{3, 3},
+		{5, 5},
+		{100, 5},
+	}
+	for _, test := range tests {
+		if got := len(search(t, s, []float32{1, 0}, test.limit)); got != test.want {
+			t.Errorf("Search(limit=%d) returned %d results, want %d", test.limit, got, test.want)
+		}
+	}
+}
+
+func testTiesNewestFirst(t *testing.T, s contextstore.ContextStore) {
+	put(t, s, entry{"old", "older", []float32{1, 0}, baseTime})
+	put(t, s, entry{"new", "newer", []float32{1, 0}, baseTime.Add(time.Hour)})
+
+	results := search(t, s, []float32{1, 0}, 2)
+	if len(results) != 2 || results[0] != "newer" || results[1] != "older" {
+		t.Errorf("Expected equally similar entries newest first, got %v", results)
+	}
+}
+
+// randomEntries returns n entries with random embeddings and unique summaries.
+func randomEntries(rng *rand.Rand, n, dimensions int) []entry {
+	entries := make([]entry, n)
+	for i := range entries {
+		embedding := make([]float32, dimensions)
+		for j := range embedding {
+			embedding[j] = rng.Float32()*2 - 1
+		}
+		entries[i] = entry{
+			id:        fmt.Sprintf("id-%d", i),
+			summary:   fmt.Sprintf("summary %d", i),
+			embedding: embedding,
+			timestamp: baseTime.Add(time.Duration(i) * time.Second),
+		}
+	}
+	return entries
+}
+
+func testPropertyRankedBySimilarity(t *testing.T, s contextstore.ContextStore) {
+	rng := rand.New(rand.NewSource(1))
+
+	for run := 0; run < propertyRuns; run++ {
+		if _, err := s.Clear(); err != nil {
+			t.Fatalf("Clear() error = %v", err)
+		}
+
+		entries := randomEntries(rng, 1+rng.Intn(20), 8)
+		bySummary := make(map[string][]float32, len(entries))
+		for _, e := range entries {
+			put(t, s, e)
+			bySummary[e.summary] = e.embedding
+		}
+
+		query := randomEntries(rng, 1, 8)[0].embedding
+		limit := 1 + rng.Intn(len(entries)+5)
+		results := search(t, s, query, limit)
+
+		want := min(limit, len(entries))
+		if len(results) != want {
+			t.Fatalf("Run %d: Search(limit=%d) over %d entries returned %d results, want %d", run, limit, len(entries), len(results), want)
+		}
+
+		previous := 2.0
+		for _, summary := range results {
+			embedding, exists := bySummary[summary]
+			if !exists {
+				t.Fatalf("Run %d: Search returned unknown summary %q", run, summary)
+			}
+			similarity, _ := vector.CosineSimilarity(query, embedding)
+			if similarity > previous {
+				t.Fatalf("Run %d: results not ordered by similarity: %v", run, results)
+			}
+			previous = similarity
+		}
+	}
+}
+
+func testPropertyOrderingStable(t *testing.T, s contextstore.ContextStore) {
+	rng := rand.New(rand.NewSource(2))
+
+	// Few distinct vectors force many exact ties
+	entries := randomEntries(rng, 12, 4)
+	for i := range entries {
+		entries[i].embedding = entries[i%3].embedding
+		entries[i].timestamp = baseTime.Add(time.Duration(i%2) * time.Second)
+		put(t, s, entries[i])
+	}
+
+	query := entries[0].embedding
+	first := search(t, s, query, len(entries))
+	for i := 0; i < 10; i++ {
+		again := search(t, s, query, len(entries))
+		if fmt.Sprint(again) != fmt.Sprint(first) {
+			t.Fatalf("Search order changed between identical calls:\n%v\n%v", first, again)
+		}
+	}
+}
+
+func testScoresMatchSearch(t *testing.T, s contextstore.ContextStore) {
+	scored, ok := s.(contextstore.ScoredSearcher)
+	if !ok {
+		t.Skip("store does not implement contextstore.ScoredSearcher")
+	}
+
+	rng := rand.New(rand.NewSource(3))
+	entries := randomEntries(rng, 10, 8)
+	for _, e := range entries {
+		put(t, s, e)
+	}
+
+	query := randomEntries(rng, 1, 8)[0].embedding
+	summaries := search(t, s, query, 5)
+	results, err := scored.SearchWithScores(query, 5, contextstore.SearchFilter{})
+	if err != nil {
+		t.Fatalf("SearchWithScores() error = %v", err)
+	}
+	if len(results) != len(summaries) {
+		t.Fatalf("SearchWithScores returned %d results, Search returned %d", len(results), len(summaries))
+	}
+
+	for i, result := range results {
+		if result.SummaryText != summaries[i] {
+			t.Errorf("Result %d: SearchWithScores returned %q, Search returned %q", i, result.SummaryText, summaries[i])
+		}
+		index, _ := strconv.Atoi(strings.TrimPrefix(result.ID, "id-"))
+		want, _ := vector.CosineSimilarity(query, entries[index].embedding)
+		if math.Abs(result.Similarity-want) > 1e-6 {
+			t.Errorf("Result %d (%s): similarity %f, want %f", i, result.ID, result.Similarity, want)
+		}
+		if !result.Timestamp.Equal(entries[index].timestamp) {
+			t.Errorf("Result %d (%s): timestamp %v, want %v", i, result.ID, result.Timestamp, entries[index].timestamp)
+		}
+	}
+}
+
+func testExcludeIDs(t *testing.T, s contextstore.ContextStore) {
+	scored, ok := s.(contextstore.ScoredSearcher)
+	if !ok {
+		t.Skip("store does not implement contextstore.ScoredSearcher")
+	}
+
+	put(t, s, entry{"a", "alpha", []float32{1, 0}, baseTime})
+	put(t, s, entry{"b", "beta", []float32{0.9, 0.1}, baseTime.Add(time.Second)})
+	put(t, s, entry{"c", "gamma", []float32{0, 1}, baseTime.Add(2 * time.Second)})
+
+	results, err := scored.SearchWithScores([]float32{1, 0}, 2, contextstore.SearchFilter{ExcludeIDs: []string{"a"}})
+	if err != nil {
+		t.Fatalf("SearchWithScores() error = %v", err)
+	}
+
+	// Excluded entries do not use up the limit
+	if len(results) != 2 || results[0].ID != "b" || results[1].ID != "c" {
+		t.Errorf("Expected [b c] with a excluded, got %v", results)
+	}
+}
+
+func testTags(t *testing.T, s contextstore.ContextStore) {
+	tagged, ok := s.(contextstore.TaggedStore)
+	if !ok {
+		t.Skip("store does not implement contextstore.TaggedStore")
+	}
+
+	if err := tagged.SetTags("missing", []string{"auth"}); err == nil {
+		t.Error("Expected error tagging a missing ID")
+	}
+
+	put(t, s, entry{"a", "alpha", []float32{1, 0}, baseTime})
+	if err := tagged.SetTags("a", []string{" Auth ", "v1", "auth", ""}); err != nil {
+		t.Fatalf("SetTags() error = %v", err)
+	}
+
+	tags, err := tagged.GetTags("a")
+	if err != nil {
+		t.Fatalf("GetTags() error = %v", err)
+	}
+	if fmt.Sprint(tags) != "[auth v1]" {
+		t.Errorf("Expected normalized tags [auth v1], got %v", tags)
+	}
+
+	// Tags survive replacing the entry's content
+	data, _ := vector.Float32SliceToBytes([]float32{0, 1})
+	if err := s.Replace("a", "replacement", data, baseTime.Add(time.Second)); err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+	if tags, _ := tagged.GetTags("a"); fmt.Sprint(tags) != "[auth v1]" {
+		t.Errorf("Expected tags to survive Replace, got %v", tags)
+	}
+
+	// Tags are removed with the entry
+	if err := s.Delete("a"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	put(t, s, entry{"a", "alpha again", []float32{1, 0}, baseTime.Add(2 * time.Second)})
+	if tags, _ := tagged.GetTags("a"); len(tags) != 0 {
+		t.Errorf("Expected a re-created entry to have no tags, got %v", tags)
+	}
+}
+
+func testExcludeTags(t *testing.T, s contextstore.ContextStore) {
+	scored, ok := s.(contextstore.ScoredSearcher)
+	tagged, tagsOK := s.(contextstore.TaggedStore)
+	if !ok || !tagsOK {
+		t.Skip("store does not implement contextstore.ScoredSearcher and contextstore.TaggedStore")
+	}
+
+	put(t, s, entry{"a", "auth v1 design", []float32{1, 0}, baseTime})
+	put(t, s, entry{"b", "auth v2 design", []float32{0.9, 0.1}, baseTime.Add(time.Second)})
+	put(t, s, entry{"c", "billing", []float32{0, 1}, baseTime.Add(2 * time.Second)})
+	if err := tagged.SetTags("a", []string{"auth", "deprecated"}); err != nil {
+		t.Fatalf("SetTags() error = %v", err)
+	}
+	if err := tagged.SetTags("b", []string{"auth"}); err != nil {
+		t.Fatalf("SetTags() error = %v", err)
+	}
+
+	results, err := scored.SearchWithScores([]float32{1, 0}, 10, contextstore.SearchFilter{ExcludeTags: []string{"Deprecated"}})
+	if err != nil {
+		t.Fatalf("SearchWithScores() error = %v", err)
+	}
+	if len(results) != 2 || results[0].ID != "b" || results[1].ID != "c" {
+		t.Errorf("Expected [b c] with deprecated entries excluded, got %v", results)
+	}
+}
+
+func testExcludeHashes(t *testing.T, s contextstore.ContextStore) {
+	scored, ok := s.(contextstore.ScoredSearcher)
+	if !ok {
+		t.Skip("store does not implement contextstore.ScoredSearcher")
+	}
+
+	put(t, s, entry{"a", "alpha", []float32{1, 0}, baseTime})
+	put(t, s, entry{"b", "beta", []float32{0.9, 0.1}, baseTime.Add(time.Second)})
+	put(t, s, entry{"c", "alpha", []float32{0.8, 0.2}, baseTime.Add(2 * time.Second)})
+
+	// Every entry with a matching summary is excluded, whatever its ID
+	hash := strings.ToUpper(contextstore.ContentHash("alpha"))
+	results, err := scored.SearchWithScores([]float32{1, 0}, 10, contextstore.SearchFilter{ExcludeHashes: []string{hash}})
+	if err != nil {
+		t.Fatalf("SearchWithScores() error = %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "b" {
+		t.Errorf("Expected [b] with alpha summaries excluded, got %v", results)
+	}
+}
+
+func testSearchFilters(t *testing.T, s contextstore.ContextStore) {
+	scored, ok := s.(contextstore.ScoredSearcher)
+	tagged, tagsOK := s.(contextstore.TaggedStore)
+	namespaced, namespacesOK := s.(contextstore.NamespacedStore)
+	if !ok || !tagsOK || !namespacesOK {
+		t.Skip("store does not implement contextstore.ScoredSearcher, contextstore.TaggedStore and contextstore.NamespacedStore")
+	}
+
+	data, err := vector.Float32SliceToBytes([]float32{1, 0})
+	if err != nil {
+		t.Fatalf("Failed to encode embedding: %v", err)
+	}
+	for i, e := range []struct {
+		namespace string
+		id        string
+		tags      []string
+	}{
+		{"work", "a", []string{"auth"}},
+		{"work", "b", []string{"auth", "deprecated"}},
+		{"work", "c", []string{"billing"}},
+		{"home", "d", []string{"auth"}},
+		{"work", "e", nil},
+	} {
+		if err := namespaced.StoreInNamespace(e.namespace, e.id, "entry "+e.id, data, baseTime.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatalf("StoreInNamespace() error = %v", err)
+		}
+		if err := tagged.SetTags(e.id, e.tags); err != nil {
+			t.Fatalf("SetTags() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter contextstore.SearchFilter
+		want   string
+	}{
+		{"none", contextstore.SearchFilter{}, "e d c b a"},
+		{"tags", contextstore.SearchFilter{Tags: []string{"Auth", "billing"}}, "d c b a"},
+		{"tags and excluded tags", contextstore.SearchFilter{Tags: []string{"auth"}, ExcludeTags: []string{"deprecated"}}, "d a"},
+		{"since", contextstore.SearchFilter{Since: baseTime.Add(2 * time.Hour)}, "e d c"},
+		{"until", contextstore.SearchFilter{Until: baseTime.Add(2 * time.Hour)}, "b a"},
+		{"time range", contextstore.SearchFilter{Since: baseTime.Add(time.Hour), Until: baseTime.Add(4 * time.Hour)}, "d c b"},
+		{"namespace, tags and time", contextstore.SearchFilter{Namespace: "work", Tags: []string{"auth"}, Since: baseTime.Add(time.Hour)}, "b"},
+		{"namespace and excluded IDs", contextstore.SearchFilter{Namespace: "work", ExcludeIDs: []string{"e"}, ExcludeTags: []string{"billing"}}, "b a"},
+		{"unknown tag", contextstore.SearchFilter{Tags: []string{"missing"}}, ""},
+	}
+	for _, test := range tests {
+		results, err := scored.SearchWithScores([]float32{1, 0}, 10, test.filter)
+		if err != nil {
+			t.Fatalf("%s: SearchWithScores() error = %v", test.name, err)
+		}
+		var ids []string
+		for _, result := range results {
+			ids = append(ids, result.ID)
+		}
+		if got := strings.Join(ids, " "); got != test.want {
+			t.Errorf("%s: expected %q, got %q", test.name, test.want, got)
+		}
+	}
+}
+
+func testKeywordSearch(t *testing.T, s contextstore.ContextStore) {
+	keywords, ok := s.(contextstore.KeywordSearcher)
+	if !ok {
+		t.Skip("store does not implement contextstore.KeywordSearcher")
+	}
+	searchKeywords := func(query string, filter contextstore.SearchFilter) []string {
+		t.Helper()
+		results, err := keywords.SearchKeywords(query, 10, filter)
+		if err != nil {
+			t.Fatalf("SearchKeywords(%q) error = %v", query, err)
+		}
+		ids := make([]string, len(results))
+		for i, result := range results {
+			ids[i] = result.ID
+			if result.Similarity <= 0 || (i > 0 && result.Similarity > results[i-1].Similarity) {
+				t.Errorf("Expected positive scores, best first, got %+v", results)
+			}
+		}
+		return ids
+	}
+
+	put(t, s, entry{"a", "Recency uses parse_half_life from the Helm chart", []float32{1, 0}, baseTime})
+	put(t, s, entry{"b", "Helm chart release notes: Helm upgrades, Helm rollbacks", []float32{0, 1}, baseTime})
+	put(t, s, entry{"c", "Logs are JSON", []float32{1, 1}, baseTime})
+
+	tests := []struct {
+		query  string
+		filter contextstore.SearchFilter
+		want   string
+	}{
+		{"parse_half_life", contextstore.SearchFilter{}, "[a]"},
+		{"HELM", contextstore.SearchFilter{}, "[b a]"},
+		{"helm", contextstore.SearchFilter{ExcludeIDs: []string{"b"}}, "[a]"},
+		{"-- !!", contextstore.SearchFilter{}, "[]"},
+		{"kubernetes", contextstore.SearchFilter{}, "[]"},
+	}
+	for _, test := range tests {
+		if got := fmt.Sprint(searchKeywords(test.query, test.filter)); got != test.want {
+			t.Errorf("SearchKeywords(%q) = %s, want %s", test.query, got, test.want)
+		}
+	}
+	// Operators and quotes are words like any other
+	if got := searchKeywords(`json NOT "release" AND`, contextstore.SearchFilter{}); len(got) != 2 {
+		t.Errorf("Expected b and c to be found, got %s", got)
+	}
+	results, err := keywords.SearchKeywords("helm", 1, contextstore.SearchFilter{})
+	if err != nil || len(results) != 1 {
+		t.Errorf("Expected the limit to apply, got %+v, %v", results, err)
+	}
+
+	// Overwritten and deleted summaries are no longer found by their words
+	put(t, s, entry{"a", "Recency ranking", []float32{1, 0}, baseTime})
+	if err := s.Delete("b"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if got := fmt.Sprint(searchKeywords("parse_half_life helm recency", contextstore.SearchFilter{})); got != "[a]" {
+		t.Errorf("Expected only the new summary of a to be found, got %s", got)
+	}
+
+	// Cleared entries are found again once the clear is undone
+	if clearer, ok := s.(contextstore.SoftClearer); ok {
+		if _, err := clearer.MarkCleared(baseTime); err != nil {
+			t.Fatalf("MarkCleared() error = %v", err)
+		}
+		if got := fmt.Sprint(searchKeywords("json", contextstore.SearchFilter{})); got != "[]" {
+			t.Errorf("Expected cleared entries not to be found, got %s", got)
+		}
+		if _, err := clearer.UndoClear(); err != nil {
+			t.Fatalf("UndoClear() error = %v", err)
+		}
+		if got := fmt.Sprint(searchKeywords("json", contextstore.SearchFilter{})); got != "[c]" {
+			t.Errorf("Expected restored entries to be found, got %s", got)
+		}
+	}
+}
+
+func testUsage(t *testing.T, s contextstore.ContextStore) {
+	usage, ok := s.(contextstore.UsageStore)
+	if !ok {
+		t.Skip("store does not implement contextstore.UsageStore")
+	}
+
+	put(t, s, entry{"b", "beta", []float32{0, 1}, baseTime.Add(time.Second)})
+	put(t, s, entry{"a", "alpha", []float32{1, 0}, baseTime})
+
+	retrievedAt := baseTime.Add(time.Hour)
+	if err := usage.RecordRetrievals([]string{"a", "missing"}, baseTime.Add(time.Minute)); err != nil {
+		t.Fatalf("RecordRetrievals() error = %v", err)
+	}
+	if err := usage.RecordRetrievals([]string{"a"}, retrievedAt); err != nil {
+		t.Fatalf("RecordRetrievals() error = %v", err)
+	}
+
+	entries, err := usage.ListEntries()
+	if err != nil {
+		t.Fatalf("ListEntries() error = %v", err)
+	}
+	if len(entries) != 2 || entries[0].ID != "a" || entries[1].ID != "b" {
+		t.Fatalf("Expected entries [a b] oldest first, got %v", entries)
+	}
+	if entries[0].Retrievals != 2 || !entries[0].LastRetrieved.Equal(retrievedAt) {
+		t.Errorf("Expected a retrieved twice, last at %v, got %d at %v", retrievedAt, entries[0].Retrievals, entries[0].LastRetrieved)
+	}
+	if entries[1].Retrievals != 0 || !entries[1].LastRetrieved.IsZero() {
+		t.Errorf("Expected b never retrieved, got %d at %v", entries[1].Retrievals, entries[1].LastRetrieved)
+	}
+	if entries[0].SummaryText != "alpha" || len(entries[0].Embedding) != 2 || !entries[0].Timestamp.Equal(baseTime) {
+		t.Errorf("Unexpected entry contents: %+v", entries[0])
+	}
+
+	// Usage survives replacing the entry's content
+	data, _ := vector.Float32SliceToBytes([]float32{0, 1})
+	if err := s.Replace("a", "replacement", data, baseTime.Add(2*time.Second)); err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+	if entries, _ := usage.ListEntries(); len(entries) != 2 || entries[1].ID != "a" || entries[1].Retrievals != 2 {
+		t.Errorf("Expected usage to survive Replace, got %v", entries)
+	}
+
+	// Usage is removed with the entry
+	if err := s.Delete("a"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	put(t, s, entry{"a", "alpha again", []float32{1, 0}, baseTime.Add(3 * time.Second)})
+	if entries, _ := usage.ListEntries(); len(entries) != 2 || entries[1].Retrievals != 0 {
+		t.Errorf("Expected a re-created entry to have no usage, got %v", entries)
+	}
+}
+
+func testSoftClear(t *testing.T, s contextstore.ContextStore) {
+	clearer, ok := s.(contextstore.SoftClearer)
+	if !ok {
+		t.Skip("store does not implement contextstore.SoftClearer")
+	}
+
+	put(t, s, entry{"a", "alpha", []float32{1, 0}, baseTime})
+	put(t, s, entry{"b", "beta", []float32{0, 1}, baseTime.Add(time.Second)})
+	if tagged, ok := s.(contextstore.TaggedStore); ok {
+		if err := tagged.SetTags("a", []string{"auth"}); err != nil {
+			t.Fatalf("SetTags() error = %v", err)
+		}
+	}
+
+	clearedAt := baseTime.Add(time.Hour)
+	count, err := clearer.MarkCleared(clearedAt)
+	if err != nil {
+		t.Fatalf("MarkCleared() error = %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 entries cleared, got %d", count)
+	}
+	if results, _ := s.Search([]float32{1, 0}, 10); len(results) != 0 {
+		t.Errorf("Expected cleared entries to be hidden, got %v", results)
+	}
+	if err := s.Delete("a"); err == nil {
+		t.Error("Expected error deleting a cleared entry")
+	}
+
+	// An ID stored again while cleared keeps its new content
+	put(t, s, entry{"b", "beta again", []float32{0, 1}, baseTime.Add(2 * time.Second)})
+
+	restored, err := clearer.UndoClear()
+	if err != nil {
+		t.Fatalf("UndoClear() error = %v", err)
+	}
+	if restored != 1 {
+		t.Errorf("Expected 1 entry restored, got %d", restored)
+	}
+	results, err := s.Search([]float32{1, 0}, 10)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if fmt.Sprint(results) != "[alpha beta again]" {
+		t.Errorf("Expected [alpha beta again] after undo, got %v", results)
+	}
+	if tagged, ok := s.(contextstore.TaggedStore); ok {
+		if tags, _ := tagged.GetTags("a"); fmt.Sprint(tags) != "[auth]" {
+			t.Errorf("Expected tags to be restored, got %v", tags)
+		}
+	}
+
+	// Nothing is left to undo
+	if restored, _ := clearer.UndoClear(); restored != 0 {
+		t.Errorf("Expected nothing to restore twice, got %d", restored)
+	}
+
+	// Purged entries cannot be restored
+	if _, err := clearer.MarkCleared(clearedAt); err != nil {
+		t.Fatalf("MarkCleared() error = %v", err)
+	}
+	if purged, err := clearer.PurgeCleared(clearedAt); err != nil || purged != 0 {
+		t.Errorf("Expected nothing cleared before %v to be purged, got %d (%v)", clearedAt, purged, err)
+	}
+	if purged, err := clearer.PurgeCleared(clearedAt.Add(time.Second)); err != nil || purged != 2 {
+		t.Errorf("Expected 2 entries purged, got %d (%v)", purged, err)
+	}
+	if restored, _ := clearer.UndoClear(); restored != 0 {
+		t.Errorf("Expected purged entries not to be restored, got %d", restored)
+	}
+
+	// Entries stored again after a purge start without tags
+	put(t, s, entry{"a", "alpha", []float32{1, 0}, baseTime})
+	if tagged, ok := s.(contextstore.TaggedStore); ok {
+		if tags, _ := tagged.GetTags("a"); len(tags) != 0 {
+			t.Errorf("Expected purged tags to be removed, got %v", tags)
+		}
+	}
+}
+
+func testQuarantine(t *testing.T, s contextstore.ContextStore) {
+	quarantine, ok := s.(contextstore.QuarantineStore)
+	if !ok {
+		t.Skip("store does not implement contextstore.QuarantineStore")
+	}
+
+	put(t, s, entry{"a", "alpha", []float32{1, 0}, baseTime})
+	fallback, err := vector.Float32SliceToBytes([]float32{1, 0, 0})
+	if err != nil {
+		t.Fatalf("Failed to encode embedding: %v", err)
+	}
+	if err := quarantine.Quarantine("q", "quarantined", fallback, baseTime.Add(time.Second), []string{"Auth"}, "fallback"); err != nil {
+		t.Fatalf("Quarantine() error = %v", err)
+	}
+
+	// Quarantined entries are not searched or listed
+	if results := search(t, s, []float32{1, 0}, 10); fmt.Sprint(results) != "[alpha]" {
+		t.Errorf("Expected [alpha] while quarantined, got %v", results)
+	}
+	if usage, ok := s.(contextstore.UsageStore); ok {
+		if entries, _ := usage.ListEntries(); len(entries) != 1 {
+			t.Errorf("Expected 1 listed entry while quarantined, got %d", len(entries))
+		}
+	}
+
+	quarantined, err := quarantine.ListQuarantined()
+	if err != nil {
+		t.Fatalf("ListQuarantined() error = %v", err)
+	}
+	if len(quarantined) != 1 {
+		t.Fatalf("Expected 1 quarantined entry, got %d", len(quarantined))
+	}
+	got := quarantined[0]
+	if got.ID != "q" || got.SummaryText != "quarantined" || got.Provider != "fallback" || got.Dimensions != 3 || !got.Timestamp.Equal(baseTime.Add(time.Second)) {
+		t.Errorf("Unexpected quarantined entry %+v", got)
+	}
+
+	// Releasing moves the entry into the index with its new embedding and tags
+	primary, err := vector.Float32SliceToBytes([]float32{0, 1})
+	if err != nil {
+		t.Fatalf("Failed to encode embedding: %v", err)
+	}
+	if err := quarantine.ReleaseQuarantined("q", primary); err != nil {
+		t.Fatalf("ReleaseQuarantined() error = %v", err)
+	}
+	if results := search(t, s, []float32{0, 1}, 1); fmt.Sprint(results) != "[quarantined]" {
+		t.Errorf("Expected [quarantined] after release, got %v", results)
+	}
+	if tagged, ok := s.(contextstore.TaggedStore); ok {
+		if tags, _ := tagged.GetTags("q"); fmt.Sprint(tags) != "[auth]" {
+			t.Errorf("Expected tags to survive release, got %v", tags)
+		}
+	}
+	if quarantined, _ := quarantine.ListQuarantined(); len(quarantined) != 0 {
+		t.Errorf("Expected empty quarantine after release, got %v", quarantined)
+	}
+	if err := quarantine.ReleaseQuarantined("q", primary); err == nil {
+		t.Error("Expected error releasing an entry twice")
+	}
+
+	// Delete and Clear reach quarantined entries
+	if err := quarantine.Quarantine("d", "deleted", fallback, baseTime, nil, "fallback"); err != nil {
+		t.Fatalf("Quarantine() error = %v", err)
+	}
+	if err := s.Delete("d"); err != nil {
+		t.Errorf("Delete() of a quarantined entry error = %v", err)
+	}
+	if err := quarantine.Quarantine("c", "cleared", fallback, baseTime, nil, "fallback"); err != nil {
+		t.Fatalf("Quarantine() error = %v", err)
+	}
+	if _, err := s.Clear(); err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	if quarantined, _ := quarantine.ListQuarantined(); len(quarantined) != 0 {
+		t.Errorf("Expected empty quarantine after Delete and Clear, got %v", quarantined)
+	}
+}
+
+func testProvenance(t *testing.T, s contextstore.ContextStore) {
+	provenance, ok := s.(contextstore.ProvenanceStore)
+	if !ok {
+		t.Skip("store does not implement contextstore.ProvenanceStore")
+	}
+
+	put(t, s, entry{"a", "alpha", []float32{1, 0}, baseTime})
+	if chain, err := provenance.GetProvenance("a"); err != nil || len(chain) != 0 {
+		t.Errorf("Expected empty provenance for a new entry, got %v, %v", chain, err)
+	}
+	if err := provenance.SetProvenance("a", []string{"notes.md", "tool:save_context"}); err != nil {
+		t.Fatalf("SetProvenance() error = %v", err)
+	}
+	if err := provenance.SetProvenance("missing", []string{"notes.md"}); err == nil {
+		t.Error("Expected error setting provenance of a missing entry")
+	}
+	if _, err := provenance.GetProvenance("missing"); err == nil {
+		t.Error("Expected error getting provenance of a missing entry")
+	}
+
+	// The chain keeps its order and survives overwriting the entry
+	put(t, s, entry{"a", "alpha v2", []float32{1, 0}, baseTime.Add(time.Second)})
+	if chain, _ := provenance.GetProvenance("a"); fmt.Sprint(chain) != "[notes.md tool:save_context]" {
+		t.Errorf("Expected provenance to survive Store, got %v", chain)
+	}
+	if usage, ok := s.(contextstore.UsageStore); ok {
+		entries, err := usage.ListEntries()
+		if err != nil {
+			t.Fatalf("ListEntries() error = %v", err)
+		}
+		if len(entries) != 1 || fmt.Sprint(entries[0].Provenance) != "[notes.md tool:save_context]" {
+			t.Errorf("Expected provenance in ListEntries, got %+v", entries)
+		}
+	}
+
+	// Setting replaces the whole chain
+	if err := provenance.SetProvenance("a", []string{"cli"}); err != nil {
+		t.Fatalf("SetProvenance() error = %v", err)
+	}
+	if chain, _ := provenance.GetProvenance("a"); fmt.Sprint(chain) != "[cli]" {
+		t.Errorf("Expected [cli], got %v", chain)
+	}
+
+	// Deleting and re-storing an ID starts a fresh chain
+	if err := s.Delete("a"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	put(t, s, entry{"a", "alpha v3", []float32{1, 0}, baseTime})
+	if chain, _ := provenance.GetProvenance("a"); len(chain) != 0 {
+		t.Errorf("Expected provenance to go with Delete, got %v", chain)
+	}
+
+	// Quarantined entries carry their chain through release
+	quarantine, ok := s.(contextstore.QuarantineStore)
+	if !ok {
+		return
+	}
+	embedding, err := vector.Float32SliceToBytes([]float32{1, 0, 0})
+	if err != nil {
+		t.Fatalf("Failed to encode embedding: %v", err)
+	}
+	if err := quarantine.Quarantine("q", "quarantined", embedding, baseTime, nil, "fallback"); err != nil {
+		t.Fatalf("Quarantine() error = %v", err)
+	}
+	if err := provenance.SetProvenance("q", []string{"importer"}); err != nil {
+		t.Fatalf("SetProvenance() of a quarantined entry error = %v", err)
+	}
+	primary, err := vector.Float32SliceToBytes([]float32{0, 1})
+	if err != nil {
+		t.Fatalf("Failed to encode embedding: %v", err)
+	}
+	if err := quarantine.ReleaseQuarantined("q", primary); err != nil {
+		t.Fatalf("ReleaseQuarantined() error = %v", err)
+	}
+	if chain, _ := provenance.GetProvenance("q"); fmt.Sprint(chain) != "[importer]" {
+		t.Errorf("Expected provenance to survive release, got %v", chain)
+	}
+}
+
+func testGenerations(t *testing.T, s contextstore.ContextStore) {
+	generations, ok := s.(contextstore.GenerationStore)
+	if !ok {
+		t.Skip("store does not implement contextstore.GenerationStore")
+	}
+
+	put(t, s, entry{"a", "alpha", []float32{1, 0}, baseTime})
+	if generation, err := generations.GetGeneration("a"); err != nil || !generation.IsZero() {
+		t.Errorf("Expected no generation for a new entry, got %+v, %v", generation, err)
+	}
+	written := contextstore.Generation{Summarizer: "ai", Provider: "openai", Model: "gpt-4o", PromptVersion: "default"}
+	if err := generations.SetGeneration("a", written); err != nil {
+		t.Fatalf("SetGeneration() error = %v", err)
+	}
+	if err := generations.SetGeneration("missing", written); err == nil {
+		t.Error("Expected error setting the generation of a missing entry")
+	}
+	if _, err := generations.GetGeneration("missing"); err == nil {
+		t.Error("Expected error getting the generation of a missing entry")
+	}
+	if generation, _ := generations.GetGeneration("a"); generation != written {
+		t.Errorf("Expected %+v, got %+v", written, generation)
+	}
+	if usage, ok := s.(contextstore.UsageStore); ok {
+		entries, err := usage.ListEntries()
+		if err != nil {
+			t.Fatalf("ListEntries() error = %v", err)
+		}
+		if len(entries) != 1 || entries[0].Generation != written {
+			t.Errorf("Expected the generation in ListEntries, got %+v", entries)
+		}
+	}
+
+	// Setting replaces the generation
+	basic := contextstore.Generation{Summarizer: "basic"}
+	if err := generations.SetGeneration("a", basic); err != nil {
+		t.Fatalf("SetGeneration() error = %v", err)
+	}
+	if generation, _ := generations.GetGeneration("a"); generation != basic {
+		t.Errorf("Expected %+v, got %+v", basic, generation)
+	}
+
+	// Deleting and re-storing an ID forgets the generation
+	if err := s.Delete("a"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	put(t, s, entry{"a", "alpha v2", []float32{1, 0}, baseTime})
+	if generation, _ := generations.GetGeneration("a"); !generation.IsZero() {
+		t.Errorf("Expected the generation to go with Delete, got %+v", generation)
+	}
+
+	// Quarantined entries carry their generation through release
+	quarantine, ok := s.(contextstore.QuarantineStore)
+	if !ok {
+		return
+	}
+	embedding, err := vector.Float32SliceToBytes([]float32{1, 0, 0})
+	if err != nil {
+		t.Fatalf("Failed to encode embedding: %v", err)
+	}
+	if err := quarantine.Quarantine("q", "quarantined", embedding, baseTime, nil, "fallback"); err != nil {
+		t.Fatalf("Quarantine() error = %v", err)
+	}
+	if err := generations.SetGeneration("q", written); err != nil {
+		t.Fatalf("SetGeneration() of a quarantined entry error = %v", err)
+	}
+	primary, err := vector.Float32SliceToBytes([]float32{0, 1})
+	if err != nil {
+		t.Fatalf("Failed to encode embedding: %v", err)
+	}
+	if err := quarantine.ReleaseQuarantined("q", primary); err != nil {
+		t.Fatalf("ReleaseQuarantined() error = %v", err)
+	}
+	if generation, _ := generations.GetGeneration("q"); generation != written {
+		t.Errorf("Expected the generation to survive release, got %+v", generation)
+	}
+}
+
+func testTitles(t *testing.T, s contextstore.ContextStore) {
+	titles, ok := s.(contextstore.TitleStore)
+	if !ok {
+		t.Skip("store does not implement contextstore.TitleStore")
+	}
+
+	put(t, s, entry{"a", "alpha", []float32{1, 0}, baseTime})
+	if title, err := titles.GetTitle("a"); err != nil || title != "" {
+		t.Errorf("Expected no title for a new entry, got %q, %v", title, err)
+	}
+	if err := titles.SetTitle("a", "Alpha"); err != nil {
+		t.Fatalf("SetTitle() error = %v", err)
+	}
+	if err := titles.SetTitle("missing", "Missing"); err == nil {
+		t.Error("Expected error setting the title of a missing entry")
+	}
+	if _, err := titles.GetTitle("missing"); err == nil {
+		t.Error("Expected error getting the title of a missing entry")
+	}
+	if title, _ := titles.GetTitle("a"); title != "Alpha" {
+		t.Errorf("Expected %q, got %q", "Alpha", title)
+	}
+	if usage, ok := s.(contextstore.UsageStore); ok {
+		entries, err := usage.ListEntries()
+		if err != nil {
+			t.Fatalf("ListEntries() error = %v", err)
+		}
+		if len(entries) != 1 || entries[0].Title != "Alpha" {
+			t.Errorf("Expected the title in ListEntries, got %+v", entries)
+		}
+	}
+
+	// Setting replaces the title, and storing the ID again keeps it
+	if err := titles.SetTitle("a", "Alpha v2"); err != nil {
+		t.Fatalf("SetTitle() error = %v", err)
+	}
+	put(t, s, entry{"a", "alpha v2", []float32{1, 0}, baseTime})
+	if title, _ := titles.GetTitle("a"); title != "Alpha v2" {
+		t.Errorf("Expected %q, got %q", "Alpha v2", title)
+	}
+
+	// Deleting and re-storing an ID forgets the title
+	if err := s.Delete("a"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	put(t, s, entry{"a", "alpha v3", []float32{1, 0}, baseTime})
+	if title, _ := titles.GetTitle("a"); title != "" {
+		t.Errorf("Expected the title to go with Delete, got %q", title)
+	}
+
+	// Moving an entry to another namespace forgets the title
+	if namespaced, ok := s.(contextstore.NamespacedStore); ok {
+		if err := titles.SetTitle("a", "Alpha"); err != nil {
+			t.Fatalf("SetTitle() error = %v", err)
+		}
+		data, err := vector.Float32SliceToBytes([]float32{1, 0})
+		if err != nil {
+			t.Fatalf("Failed to encode embedding: %v", err)
+		}
+		if err := namespaced.StoreInNamespace("work", "a", "alpha", data, baseTime); err != nil {
+			t.Fatalf("StoreInNamespace() error = %v", err)
+		}
+		if title, _ := titles.GetTitle("a"); title != "" {
+			t.Errorf("Expected the title to go with a namespace move, got %q", title)
+		}
+	}
+
+	// Quarantined entries carry their title through release
+	quarantine, ok := s.(contextstore.QuarantineStore)
+	if !ok {
+		return
+	}
+	embedding, err := vector.Float32SliceToBytes([]float32{1, 0, 0})
+	if err != nil {
+		t.Fatalf("Failed to encode embedding: %v", err)
+	}
+	if err := quarantine.Quarantine("q", "quarantined", embedding, baseTime, nil, "fallback"); err != nil {
+		t.Fatalf("Quarantine() error = %v", err)
+	}
+	if err := titles.SetTitle("q", "Quarantined"); err != nil {
+		t.Fatalf("SetTitle() of a quarantined entry error = %v", err)
+	}
+	primary, err := vector.Float32SliceToBytes([]float32{0, 1})
+	if err != nil {
+		t.Fatalf("Failed to encode embedding: %v", err)
+	}
+	if err := quarantine.ReleaseQuarantined("q", primary); err != nil {
+		t.Fatalf("ReleaseQuarantined() error = %v", err)
+	}
+	if title, _ := titles.GetTitle("q"); title != "Quarantined" {
+		t.Errorf("Expected the title to survive release, got %q", title)
+	}
+}
+
+func testReferences(t *testing.T, s contextstore.ContextStore) {
+	references, ok := s.(contextstore.ReferenceStore)
+	if !ok {
+		t.Skip("store does not implement contextstore.ReferenceStore")
+	}
+	referencing := func(path string) string {
+		t.Helper()
+		linked, err := references.ListReferencing(path)
+		if err != nil {
+			t.Fatalf("ListReferencing(%q) error = %v", path, err)
+		}
+		var summary []string
+		for _, entry := range linked {
+			var symbols []string
+			for _, reference := range entry.References {
+				if reference.Path != path {
+					t.Errorf("Expected only references to %s, got %+v", path, reference)
+				}
+				symbols = append(symbols, reference.Symbol)
+			}
+			summary = append(summary, entry.ID+":"+entry.SummaryText+":"+strings.Join(symbols, ","))
+		}
+		return strings.Join(summary, " ")
+	}
+
+	put(t, s, entry{"a", "alpha", []float32{1, 0}, baseTime})
+	put(t, s, entry{"b", "beta", []float32{0, 1}, baseTime.Add(time.Second)})
+	if err := references.SetReferences("missing", []contextstore.Reference{{Path: "store.go"}}); err == nil {
+		t.Error("Expected error setting the references of a missing entry")
+	}
+
+	err := references.SetReferences("a", []contextstore.Reference{
+		{Path: "internal/store.go", Symbol: "Store.Close"},
+		{Path: "internal/store.go"},
+		{Path: "main.go", Symbol: "main"},
+		{Path: "internal/store.go"},
+		{Symbol: "orphan"},
+	})
+	if err != nil {
+		t.Fatalf("SetReferences() error = %v", err)
+	}
+	if err := references.SetReferences("b", []contextstore.Reference{{Path: "internal/store.go", Symbol: "Store"}}); err != nil {
+		t.Fatalf("SetReferences() error = %v", err)
+	}
+
+	got, err := references.GetReferences("a")
+	if err != nil {
+		t.Fatalf("GetReferences() error = %v", err)
+	}
+	if fmt.Sprint(got) != "[{internal/store.go } {internal/store.go Store.Close} {main.go main}]" {
+		t.Errorf("Expected sorted references without duplicates, got %v", got)
+	}
+
+	// Newest first, with the entry's references to the file
+	if got := referencing("internal/store.go"); got != "b:beta:Store a:alpha:,Store.Close" {
+		t.Errorf("Expected both entries referencing the file, got %q", got)
+	}
+	if got := referencing("store.go"); got != "" {
+		t.Errorf("Expected paths to match exactly, got %q", got)
+	}
+
+	// References survive overwriting the entry and go with it
+	put(t, s, entry{"a", "alpha v2", []float32{1, 0}, baseTime.Add(2 * time.Second)})
+	if got := referencing("main.go"); got != "a:alpha v2:main" {
+		t.Errorf("Expected references to survive Store, got %q", got)
+	}
+	if err := references.SetReferences("a", nil); err != nil {
+		t.Fatalf("SetReferences(nil) error = %v", err)
+	}
+	if got := referencing("main.go"); got != "" {
+		t.Errorf("Expected SetReferences to replace the references, got %q", got)
+	}
+	if err := s.Delete("b"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if got := referencing("internal/store.go"); got != "" {
+		t.Errorf("Expected references to go with their entry, got %q", got)
+	}
+}
+
+func testPins(t *testing.T, s contextstore.ContextStore) {
+	pins, ok := s.(contextstore.PinStore)
+	if !ok {
+		t.Skip("store does not implement contextstore.PinStore")
+	}
+	scored, ok := s.(contextstore.ScoredSearcher)
+	if !ok {
+		t.Skip("store does not implement contextstore.ScoredSearcher")
+	}
+	listPinned := func(namespace string) string {
+		t.Helper()
+		ids, err := pins.ListPinned(namespace)
+		if err != nil {
+			t.Fatalf("ListPinned(%q) error = %v", namespace, err)
+		}
+		return fmt.Sprint(ids)
+	}
+
+	put(t, s, entry{"a", "alpha", []float32{1, 0}, baseTime})
+	put(t, s, entry{"b", "beta", []float32{0, 1}, baseTime})
+	put(t, s, entry{"c", "gamma", []float32{1, 1}, baseTime})
+	if got := listPinned(""); got != "[]" {
+		t.Errorf("Expected nothing pinned, got %s", got)
+	}
+	if err := pins.SetPinned("missing", true); err == nil {
+		t.Error("Expected error pinning a missing entry")
+	}
+	for _, id := range []string{"b", "a", "b"} {
+		if err := pins.SetPinned(id, true); err != nil {
+			t.Fatalf("SetPinned(%q) error = %v", id, err)
+		}
+	}
+	if got := listPinned(""); got != "[a b]" && got != "[b a]" {
+		t.Errorf("Expected a and b pinned once each, got %s", got)
+	}
+	if got := listPinned(contextstore.DefaultNamespace); got != "[a b]" && got != "[b a]" {
+		t.Errorf("Expected a and b pinned in the default namespace, got %s", got)
+	}
+	if got := listPinned("other"); got != "[]" {
+		t.Errorf("Expected nothing pinned in another namespace, got %s", got)
+	}
+
+	// A pinned search only finds pinned entries, most similar first
+	results, err := scored.SearchWithScores([]float32{1, 0}, 10, contextstore.SearchFilter{Pinned: true})
+	if err != nil {
+		t.Fatalf("SearchWithScores() error = %v", err)
+	}
+	if len(results) != 2 || results[0].ID != "a" || results[1].ID != "b" {
+		t.Errorf("Expected pinned a then b, got %+v", results)
+	}
+	results, _ = scored.SearchWithScores([]float32{1, 0}, 10, contextstore.SearchFilter{Pinned: true, ExcludeIDs: []string{"a"}})
+	if len(results) != 1 || results[0].ID != "b" {
+		t.Errorf("Expected the filter to apply to pinned entries, got %+v", results)
+	}
+
+	// The pin survives overwriting the entry and shows in ListEntries
+	put(t, s, entry{"a", "alpha v2", []float32{1, 0}, baseTime.Add(time.Second)})
+	if usage, ok := s.(contextstore.UsageStore); ok {
+		entries, err := usage.ListEntries()
+		if err != nil {
+			t.Fatalf("ListEntries() error = %v", err)
+		}
+		pinned := map[string]bool{}
+		for _, e := range entries {
+			pinned[e.ID] = e.Pinned
+		}
+		if !pinned["a"] || !pinned["b"] || pinned["c"] {
+			t.Errorf("Expected a and b pinned in ListEntries, got %v", pinned)
+		}
+	}
+
+	// Unpinning and deleting remove the pin
+	if err := pins.SetPinned("b", false); err != nil {
+		t.Fatalf("SetPinned(b, false) error = %v", err)
+	}
+	if err := s.Delete("a"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	put(t, s, entry{"a", "alpha v3", []float32{1, 0}, baseTime})
+	if got := listPinned(""); got != "[]" {
+		t.Errorf("Expected nothing pinned after unpinning and deleting, got %s", got)
+	}
+}
+
+func testSnapshotHashes(t *testing.T, s contextstore.ContextStore) {
+	hasher, ok := s.(contextstore.SnapshotHasher)
+	if !ok {
+		t.Skip("store does not implement contextstore.SnapshotHasher")
+	}
+	snapshot := func() map[string]string {
+		t.Helper()
+		hashes, err := hasher.SnapshotHashes()
+		if err != nil {
+			t.Fatalf("SnapshotHashes() error = %v", err)
+		}
+		return hashes
+	}
+
+	if hashes := snapshot(); len(hashes) != 0 {
+		t.Errorf("Expected no namespaces in an empty store, got %v", hashes)
+	}
+
+	put(t, s, entry{"a", "alpha", []float32{1, 0}, baseTime})
+	put(t, s, entry{"b", "beta", []float32{0, 1}, baseTime.Add(time.Second)})
+	original := snapshot()
+	if len(original) != 1 || original[contextstore.DefaultNamespace] == "" {
+		t.Fatalf("Expected a hash for the default namespace, got %v", original)
+	}
+	if again := snapshot(); fmt.Sprint(again) != fmt.Sprint(original) {
+		t.Errorf("Expected the same hash twice, got %v and %v", original, again)
+	}
+
+	// Reads do not change the hash
+	search(t, s, []float32{1, 0}, 2)
+	if usage, ok := s.(contextstore.UsageStore); ok {
+		if err := usage.RecordRetrievals([]string{"a"}, baseTime); err != nil {
+			t.Fatalf("RecordRetrievals() error = %v", err)
+		}
+	}
+	if hashes := snapshot(); fmt.Sprint(hashes) != fmt.Sprint(original) {
+		t.Errorf("Expected reads to keep the hash, got %v, want %v", hashes, original)
+	}
+
+	// Changing the content changes the hash, and changing it back restores it
+	put(t, s, entry{"a", "alpha v2", []float32{1, 0}, baseTime})
+	if hashes := snapshot(); hashes[contextstore.DefaultNamespace] == original[contextstore.DefaultNamespace] {
+		t.Error("Expected a new summary to change the hash")
+	}
+	put(t, s, entry{"a", "alpha", []float32{1, 0}, baseTime})
+	if hashes := snapshot(); fmt.Sprint(hashes) != fmt.Sprint(original) {
+		t.Errorf("Expected the original content to restore the hash, got %v, want %v", hashes, original)
+	}
+
+	// Tags and provenance are content too
+	if tagged, ok := s.(contextstore.TaggedStore); ok {
+		if err := tagged.SetTags("a", []string{"design"}); err != nil {
+			t.Fatalf("SetTags() error = %v", err)
+		}
+		if hashes := snapshot(); hashes[contextstore.DefaultNamespace] == original[contextstore.DefaultNamespace] {
+			t.Error("Expected tags to change the hash")
+		}
+		if err := tagged.SetTags("a", nil); err != nil {
+			t.Fatalf("SetTags() error = %v", err)
+		}
+	}
+	if provenance, ok := s.(contextstore.ProvenanceStore); ok {
+		if err := provenance.SetProvenance("a", []string{"notes.md"}); err != nil {
+			t.Fatalf("SetProvenance() error = %v", err)
+		}
+		if hashes := snapshot(); hashes[contextstore.DefaultNamespace] == original[contextstore.DefaultNamespace] {
+			t.Error("Expected provenance to change the hash")
+		}
+	}
+
+	// Hidden entries are not covered
+	if err := s.Delete("a"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	withoutA := snapshot()
+	if withoutA[contextstore.DefaultNamespace] == original[contextstore.DefaultNamespace] {
+		t.Error("Expected Delete to change the hash")
+	}
+	if clearer, ok := s.(contextstore.SoftClearer); ok {
+		if _, err := clearer.MarkCleared(baseTime); err != nil {
+			t.Fatalf("MarkCleared() error = %v", err)
+		}
+		if hashes := snapshot(); len(hashes) != 0 {
+			t.Errorf("Expected no namespaces after MarkCleared, got %v", hashes)
+		}
+		if _, err := clearer.UndoClear(); err != nil {
+			t.Fatalf("UndoClear() error = %v", err)
+		}
+		if hashes := snapshot(); fmt.Sprint(hashes) != fmt.Sprint(withoutA) {
+			t.Errorf("Expected UndoClear to restore the hash, got %v, want %v", hashes, withoutA)
+		}
+	}
+}
+
+func testBatches(t *testing.T, s contextstore.ContextStore) {
+	batches, ok := s.(contextstore.BatchStore)
+	if !ok {
+		t.Skip("store does not implement contextstore.BatchStore")
+	}
+	list := func() string {
+		t.Helper()
+		listed, err := batches.ListBatches()
+		if err != nil {
+			t.Fatalf("ListBatches() error = %v", err)
+		}
+		var summary []string
+		for _, batch := range listed {
+			summary = append(summary, fmt.Sprintf("%s:%d:%d-%d", batch.ID, batch.Entries,
+				batch.FirstStored.Sub(baseTime)/time.Second, batch.LastStored.Sub(baseTime)/time.Second))
+		}
+		return strings.Join(summary, " ")
+	}
+
+	put(t, s, entry{"a", "alpha", []float32{1, 0}, baseTime.Add(2 * time.Second)})
+	put(t, s, entry{"b", "beta", []float32{0, 1}, baseTime.Add(3 * time.Second)})
+	put(t, s, entry{"c", "gamma", []float32{1, 1}, baseTime})
+	put(t, s, entry{"d", "delta", []float32{1, 0}, baseTime.Add(4 * time.Second)})
+	for id, batch := range map[string]string{"a": "import-2", "b": "import-2", "c": "import-1"} {
+		if err := batches.SetBatch(id, batch); err != nil {
+			t.Fatalf("SetBatch(%q) error = %v", id, err)
+		}
+	}
+	if err := batches.SetBatch("missing", "import-1"); err == nil {
+		t.Error("Expected error setting the batch of a missing entry")
+	}
+
+	// Batches are listed oldest first, and entries outside a batch are not listed
+	if got := list(); got != "import-1:1:0-0 import-2:2:2-3" {
+		t.Errorf("Expected two batches, got %q", got)
+	}
+
+	// The batch survives overwriting the entry
+	put(t, s, entry{"a", "alpha v2", []float32{1, 0}, baseTime.Add(2 * time.Second)})
+	if got := list(); got != "import-1:1:0-0 import-2:2:2-3" {
+		t.Errorf("Expected the batch to survive Store, got %q", got)
+	}
+
+	if _, err := batches.DeleteBatch(""); err == nil {
+		t.Error("Expected error deleting the empty batch")
+	}
+	if deleted, err := batches.DeleteBatch("unknown"); err != nil || deleted != 0 {
+		t.Errorf("DeleteBatch(unknown) = %d, %v, want 0", deleted, err)
+	}
+
+	// Deleting a batch removes its entries and nothing else
+	deleted, err := batches.DeleteBatch("import-2")
+	if err != nil {
+		t.Fatalf("DeleteBatch() error = %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("Expected 2 entries deleted, got %d", deleted)
+	}
+	results := search(t, s, []float32{1, 0}, 10)
+	if len(results) != 2 || !contains(results, "gamma") || !contains(results, "delta") {
+		t.Errorf("Expected gamma and delta to remain, got %v", results)
+	}
+	if got := list(); got != "import-1:1:0-0" {
+		t.Errorf("Expected only import-1 to remain, got %q", got)
+	}
+
+	// A deleted ID stored again starts outside any batch
+	put(t, s, entry{"a", "alpha v3", []float32{1, 0}, baseTime})
+	if got := list(); got != "import-1:1:0-0" {
+		t.Errorf("Expected the batch to go with DeleteBatch, got %q", got)
+	}
+
+	// Quarantined entries belong to their batch too
+	quarantine, ok := s.(contextstore.QuarantineStore)
+	if !ok {
+		return
+	}
+	embedding, err := vector.Float32SliceToBytes([]float32{1, 0, 0})
+	if err != nil {
+		t.Fatalf("Failed to encode embedding: %v", err)
+	}
+	if err := quarantine.Quarantine("q", "quarantined", embedding, baseTime.Add(time.Second), nil, "fallback"); err != nil {
+		t.Fatalf("Quarantine() error = %v", err)
+	}
+	if err := batches.SetBatch("q", "import-1"); err != nil {
+		t.Fatalf("SetBatch() of a quarantined entry error = %v", err)
+	}
+	if got := list(); got != "import-1:2:0-1" {
+		t.Errorf("Expected the quarantined entry in import-1, got %q", got)
+	}
+	if deleted, err := batches.DeleteBatch("import-1"); err != nil || deleted != 2 {
+		t.Errorf("DeleteBatch(import-1) = %d, %v, want 2", deleted, err)
+	}
+	if listed, err := quarantine.ListQuarantined(); err != nil || len(listed) != 0 {
+		t.Errorf("Expected no quarantined entries left, got %v, %v", listed, err)
+	}
+}
+
+func testSessions(t *testing.T, s contextstore.ContextStore) {
+	sessions, ok := s.(contextstore.SessionStore)
+	if !ok {
+		t.Skip("store does not implement contextstore.SessionStore")
+	}
+	list := func() string {
+		t.Helper()
+		listed, err := sessions.ListSessions()
+		if err != nil {
+			t.Fatalf("ListSessions() error = %v", err)
+		}
+		var summary []string
+		for _, session := range listed {
+			summary = append(summary, fmt.Sprintf("%s:%d:%d-%d", session.ID, session.Entries,
+				session.FirstStored.Sub(baseTime)/time.Second, session.LastStored.Sub(baseTime)/time.Second))
+		}
+		return strings.Join(summary, " ")
+	}
+
+	put(t, s, entry{"a", "alpha", []float32{1, 0}, baseTime.Add(2 * time.Second)})
+	put(t, s, entry{"b", "beta", []float32{0, 1}, baseTime.Add(3 * time.Second)})
+	put(t, s, entry{"c", "gamma", []float32{1, 1}, baseTime})
+	put(t, s, entry{"d", "delta", []float32{1, 0}, baseTime.Add(4 * time.Second)})
+	for id, session := range map[string]string{"a": "session-2", "b": "session-2", "c": "session-1"} {
+		if err := sessions.SetSession(id, session); err != nil {
+			t.Fatalf("SetSession(%q) error = %v", id, err)
+		}
+	}
+	if err := sessions.SetSession("missing", "session-1"); err == nil {
+		t.Error("Expected error setting the session of a missing entry")
+	}
+
+	// Sessions are listed most recently active first, and entries outside
+	// a session are not listed
+	if got := list(); got != "session-2:2:2-3 session-1:1:0-0" {
+		t.Errorf("Expected two sessions, got %q", got)
+	}
+
+	// The session survives overwriting the entry
+	put(t, s, entry{"a", "alpha v2", []float32{1, 0}, baseTime.Add(2 * time.Second)})
+	if got := list(); got != "session-2:2:2-3 session-1:1:0-0" {
+		t.Errorf("Expected the session to survive Store, got %q", got)
+	}
+
+	// A session filter finds the session's entries and nothing else
+	if scored, ok := s.(contextstore.ScoredSearcher); ok {
+		results, err := scored.SearchWithScores([]float32{1, 0}, 10, contextstore.SearchFilter{Session: "session-2"})
+		if err != nil {
+			t.Fatalf("SearchWithScores() error = %v", err)
+		}
+		if len(results) != 2 || results[0].ID != "a" || results[1].ID != "b" {
+			t.Errorf("Expected alpha then beta in session-2, got %+v", results)
+		}
+	}
+
+	if _, err := sessions.DeleteSession(""); err == nil {
+		t.Error("Expected error deleting the empty session")
+	}
+	if deleted, err := sessions.DeleteSession("unknown"); err != nil || deleted != 0 {
+		t.Errorf("DeleteSession(unknown) = %d, %v, want 0", deleted, err)
+	}
+
+	// Deleting a session removes its entries and nothing else
+	deleted, err := sessions.DeleteSession("session-2")
+	if err != nil {
+		t.Fatalf("DeleteSession() error = %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("Expected 2 entries deleted, got %d", deleted)
+	}
+	results := search(t, s, []float32{1, 0}, 10)
+	if len(results) != 2 || !contains(results, "gamma") || !contains(results, "delta") {
+		t.Errorf("Expected gamma and delta to remain, got %v", results)
+	}
+	if got := list(); got != "session-1:1:0-0" {
+		t.Errorf("Expected only session-1 to remain, got %q", got)
+	}
+
+	// A deleted ID stored again starts outside any session
+	put(t, s, entry{"a", "alpha v3", []float32{1, 0}, baseTime})
+	if got := list(); got != "session-1:1:0-0" {
+		t.Errorf("Expected the session to go with DeleteSession, got %q", got)
+	}
+
+	// Quarantined entries belong to their session too
+	quarantine, ok := s.(contextstore.QuarantineStore)
+	if !ok {
+		return
+	}
+	embedding, err := vector.Float32SliceToBytes([]float32{1, 0, 0})
+	if err != nil {
+		t.Fatalf("Failed to encode embedding: %v", err)
+	}
+	if err := quarantine.Quarantine("q", "quarantined", embedding, baseTime.Add(time.Second), nil, "fallback"); err != nil {
+		t.Fatalf("Quarantine() error = %v", err)
+	}
+	if err := sessions.SetSession("q", "session-1"); err != nil {
+		t.Fatalf("SetSession() of a quarantined entry error = %v", err)
+	}
+	if got := list(); got != "session-1:2:0-1" {
+		t.Errorf("Expected the quarantined entry in session-1, got %q", got)
+	}
+	if deleted, err := sessions.DeleteSession("session-1"); err != nil || deleted != 2 {
+		t.Errorf("DeleteSession(session-1) = %d, %v, want 2", deleted, err)
+	}
+	if listed, err := quarantine.ListQuarantined(); err != nil || len(listed) != 0 {
+		t.Errorf("Expected no quarantined entries left, got %v, %v", listed, err)
+	}
+}
+
+func testRelations(t *testing.T, s contextstore.ContextStore) {
+	relations, ok := s.(contextstore.RelationStore)
+	if !ok {
+		t.Skip("store does not implement contextstore.RelationStore")
+	}
+	link := func(id, relatedID, relationType string, at time.Duration) {
+		t.Helper()
+		relation := contextstore.Relation{EntryID: id, RelatedID: relatedID, Type: relationType, CreatedAt: baseTime.Add(at)}
+		if err := relations.Link(relation); err != nil {
+			t.Fatalf("Link(%s %s %s) error = %v", id, relationType, relatedID, err)
+		}
+	}
+	list := func(id string) string {
+		t.Helper()
+		listed, err := relations.ListRelations(id)
+		if err != nil {
+			t.Fatalf("ListRelations(%q) error = %v", id, err)
+		}
+		var summary []string
+		for _, related := range listed {
+			summary = append(summary, fmt.Sprintf("%s>%s:%s=%s", related.EntryID, related.RelatedID, related.Type, related.SummaryText))
+		}
+		return strings.Join(summary, " ")
+	}
+
+	put(t, s, entry{"a", "alpha", []float32{1, 0}, baseTime})
+	put(t, s, entry{"b", "beta", []float32{0, 1}, baseTime.Add(time.Second)})
+	put(t, s, entry{"c", "gamma", []float32{1, 1}, baseTime.Add(2 * time.Second)})
+
+	if err := relations.Link(contextstore.Relation{EntryID: "a", RelatedID: "missing", Type: contextstore.RelationElaborates}); !errors.Is(err, contextstore.ErrEntryNotFound) {
+		t.Errorf("Expected ErrEntryNotFound linking a missing entry, got %v", err)
+	}
+	if err := relations.Link(contextstore.Relation{EntryID: "a", RelatedID: "a", Type: contextstore.RelationElaborates}); err == nil {
+		t.Error("Expected error linking an entry to itself")
+	}
+	if _, err := relations.ListRelations("missing"); !errors.Is(err, contextstore.ErrEntryNotFound) {
+		t.Errorf("Expected ErrEntryNotFound listing a missing entry, got %v", err)
+	}
+
+	// Relations are listed from either end, oldest first, with the entry
+	// at the other end
+	link("b", "a", contextstore.RelationSupersedes, time.Second)
+	link("c", "a", contextstore.RelationElaborates, 2*time.Second)
+	link("b", "c", contextstore.RelationContradicts, 3*time.Second)
+	link("b", "a", contextstore.RelationSupersedes, 4*time.Second)
+	if got := list("a"); got != "b>a:supersedes=beta c>a:elaborates=gamma" {
+		t.Errorf("Expected the relations to alpha, got %q", got)
+	}
+	if got := list("b"); got != "b>a:supersedes=alpha b>c:contradicts=gamma" {
+		t.Errorf("Expected the relations of beta, got %q", got)
+	}
+	listed, err := relations.ListRelations("b")
+	if err != nil || len(listed) == 0 || !listed[0].Outgoing() || !listed[0].CreatedAt.Equal(baseTime.Add(time.Second)) {
+		t.Errorf("Expected the original outgoing relation kept, got %+v, %v", listed, err)
+	}
+
+	// Relations survive overwriting an entry
+	put(t, s, entry{"a", "alpha v2", []float32{1, 0}, baseTime})
+	if got := list("b"); got != "b>a:supersedes=alpha v2 b>c:contradicts=gamma" {
+		t.Errorf("Expected the relations to survive Store, got %q", got)
+	}
+
+	if removed, err := relations.Unlink("b", "c", contextstore.RelationContradicts); err != nil || !removed {
+		t.Errorf("Unlink() = %v, %v, want true", removed, err)
+	}
+	if removed, err := relations.Unlink("c", "b", contextstore.RelationContradicts); err != nil || removed {
+		t.Errorf("Unlink() of a missing relation = %v, %v, want false", removed, err)
+	}
+	if got := list("c"); got != "c>a:elaborates=alpha v2" {
+		t.Errorf("Expected one relation of gamma left, got %q", got)
+	}
+
+	// Relations go with either end, and a deleted ID stored again starts
+	// without any
+	if err := s.Delete("a"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	put(t, s, entry{"a", "alpha v3", []float32{1, 0}, baseTime})
+	if got := list("a") + list("b") + list("c"); got != "" {
+		t.Errorf("Expected the relations to go with the entry, got %q", got)
+	}
+
+	// Cleared entries keep their relations until they are restored
+	clearer, ok := s.(contextstore.SoftClearer)
+	if !ok {
+		return
+	}
+	link("c", "b", contextstore.RelationElaborates, 5*time.Second)
+	if _, err := clearer.MarkCleared(baseTime.Add(time.Hour)); err != nil {
+		t.Fatalf("MarkCleared() error = %v", err)
+	}
+	if _, err := relations.ListRelations("c"); !errors.Is(err, contextstore.ErrEntryNotFound) {
+		t.Errorf("Expected a cleared entry not found, got %v", err)
+	}
+	if _, err := clearer.UndoClear(); err != nil {
+		t.Fatalf("UndoClear() error = %v", err)
+	}
+	if got := list("c"); got != "c>b:elaborates=beta" {
+		t.Errorf("Expected the relation restored with the entries, got %q", got)
+	}
+}
+
+func testGaps(t *testing.T, s contextstore.ContextStore) {
+	gaps, ok := s.(contextstore.GapStore)
+	if !ok {
+		t.Skip("store does not implement contextstore.GapStore")
+	}
+	list := func(namespace string) string {
+		t.Helper()
+		listed, err := gaps.ListGaps(namespace)
+		if err != nil {
+			t.Fatalf("ListGaps(%q) error = %v", namespace, err)
+		}
+		var summary []string
+		for _, gap := range listed {
+			summary = append(summary, fmt.Sprintf("%s/%s:%d:%d-%d", gap.Namespace, gap.Query, gap.Count,
+				gap.FirstSeen.Sub(baseTime)/time.Second, gap.LastSeen.Sub(baseTime)/time.Second))
+		}
+		return strings.Join(summary, " ")
+	}
+
+	if got := list(""); got != "" {
+		t.Errorf("Expected no gaps, got %q", got)
+	}
+
+	record := func(namespace, query string, at time.Duration) {
+		t.Helper()
+		if err := gaps.RecordGap(namespace, query, baseTime.Add(at)); err != nil {
+			t.Fatalf("RecordGap(%q, %q) error = %v", namespace, query, err)
+		}
+	}
+	record("default", "deploy steps", 0)
+	record("default", "billing", time.Second)
+	record("default", "deploy steps", 2*time.Second)
+	record("work", "deploy steps", 3*time.Second)
+
+	// Most often asked first, then most recently asked
+	if got := list(""); got != "default/deploy steps:2:0-2 work/deploy steps:1:3-3 default/billing:1:1-1" {
+		t.Errorf("Expected gaps of every namespace, got %q", got)
+	}
+	if got := list("work"); got != "work/deploy steps:1:3-3" {
+		t.Errorf("Expected the gaps of one namespace, got %q", got)
+	}
+
+	// Gaps are kept apart from the entries
+	put(t, s, entry{"a", "alpha", []float32{1, 0}, baseTime})
+	if _, err := s.Clear(); err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	if got := list("default"); got != "default/deploy steps:2:0-2 default/billing:1:1-1" {
+		t.Errorf("Expected gaps to survive Clear, got %q", got)
+	}
+
+	deleted, err := gaps.DeleteGaps("default", []string{"deploy steps", "unknown"})
+	if err != nil || deleted != 1 {
+		t.Errorf("DeleteGaps() = %d, %v, want 1", deleted, err)
+	}
+	if got := list(""); got != "work/deploy steps:1:3-3 default/billing:1:1-1" {
+		t.Errorf("Expected only the deleted gap gone, got %q", got)
+	}
+}
+
+func testReviews(t *testing.T, s contextstore.ContextStore) {
+	reviews, ok := s.(contextstore.ReviewStore)
+	if !ok {
+		t.Skip("store does not implement contextstore.ReviewStore")
+	}
+	list := func(id string) string {
+		t.Helper()
+		listed, err := reviews.ListReviews(id)
+		if err != nil {
+			t.Fatalf("ListReviews(%q) error = %v", id, err)
+		}
+		var summary []string
+		for _, review := range listed {
+			summary = append(summary, fmt.Sprintf("%s:%s:%s:%s:%d", review.ID, review.Action,
+				review.Reviewer, review.Note, review.At.Sub(baseTime)/time.Second))
+		}
+		return strings.Join(summary, " ")
+	}
+
+	if got := list(""); got != "" {
+		t.Errorf("Expected no reviews, got %q", got)
+	}
+
+	record := func(id, action, note string, at time.Duration) {
+		t.Helper()
+		review := contextstore.Review{ID: id, Action: action, Reviewer: "ana", Note: note, At: baseTime.Add(at)}
+		if err := reviews.RecordReview(review); err != nil {
+			t.Fatalf("RecordReview(%q) error = %v", id, err)
+		}
+	}
+	put(t, s, entry{"a", "alpha", []float32{1, 0}, baseTime})
+	record("a", contextstore.ReviewConfirm, "still true", 0)
+	record("b", contextstore.ReviewRetire, "", time.Second)
+	record("a", contextstore.ReviewRefresh, "new port", 2*time.Second)
+	record("a", contextstore.ReviewConfirm, "", 2*time.Second)
+
+	// Latest first, in the order recorded when made at the same time
+	if got := list(""); got != "a:confirm:ana::2 a:refresh:ana:new port:2 b:retire:ana::1 a:confirm:ana:still true:0" {
+		t.Errorf("Expected the reviews of every entry, got %q", got)
+	}
+	if got := list("b"); got != "b:retire:ana::1" {
+		t.Errorf("Expected the reviews of one entry, got %q", got)
+	}
+
+	// Reviews are kept apart from the entries
+	if err := s.Delete("a"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if got := list("a"); got != "a:confirm:ana::2 a:refresh:ana:new port:2 a:confirm:ana:still true:0" {
+		t.Errorf("Expected reviews to outlive their entry, got %q", got)
+	}
+}
+
+func testNamespaces(t *testing.T, s contextstore.ContextStore) {
+	namespaced, ok := s.(contextstore.NamespacedStore)
+	if !ok {
+		t.Skip("store does not implement contextstore.NamespacedStore")
+	}
+	hasher, ok := s.(contextstore.SnapshotHasher)
+	if !ok {
+		t.Skip("store does not implement contextstore.SnapshotHasher")
+	}
+	namespaces := func() string {
+		t.Helper()
+		hashes, err := hasher.SnapshotHashes()
+		if err != nil {
+			t.Fatalf("SnapshotHashes() error = %v", err)
+		}
+		var names []string
+		for namespace := range hashes {
+			names = append(names, namespace)
+		}
+		sort.Strings(names)
+		return strings.Join(names, " ")
+	}
+	data, err := vector.Float32SliceToBytes([]float32{1, 0})
+	if err != nil {
+		t.Fatalf("Failed to encode embedding: %v", err)
+	}
+
+	if err := namespaced.StoreInNamespace("work", "a", "alpha", data, baseTime); err != nil {
+		t.Fatalf("StoreInNamespace() error = %v", err)
+	}
+	put(t, s, entry{"b", "beta", []float32{0, 1}, baseTime.Add(time.Second)})
+	if got := namespaces(); got != "default work" {
+		t.Fatalf("Expected entries in default and work, got %q", got)
+	}
+	if usage, ok := s.(contextstore.UsageStore); ok {
+		entries, err := usage.ListEntries()
+		if err != nil {
+			t.Fatalf("ListEntries() error = %v", err)
+		}
+		if len(entries) != 2 || entries[0].Namespace != "work" || entries[1].Namespace != contextstore.DefaultNamespace {
+			t.Errorf("Expected ListEntries to report namespaces, got %+v", entries)
+		}
+	}
+	if scored, ok := s.(contextstore.ScoredSearcher); ok {
+		for namespace, want := range map[string]string{"": "a b", "work": "a", contextstore.DefaultNamespace: "b", "other": ""} {
+			results, err := scored.SearchWithScores([]float32{1, 0}, 5, contextstore.SearchFilter{Namespace: namespace})
+			if err != nil {
+				t.Fatalf("SearchWithScores(%q) error = %v", namespace, err)
+			}
+			var ids []string
+			for _, result := range results {
+				ids = append(ids, result.ID)
+			}
+			if got := strings.Join(ids, " "); got != want {
+				t.Errorf("Expected namespace %q to find %q, got %q", namespace, want, got)
+			}
+		}
+	}
+
+	// Storing or replacing an ID keeps its namespace
+	put(t, s, entry{"a", "alpha again", []float32{1, 0}, baseTime.Add(2 * time.Second)})
+	if err := s.Replace("a", "alpha replaced", data, baseTime.Add(3*time.Second)); err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+	if err := s.Delete("b"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if got := namespaces(); got != "work" {
+		t.Errorf("Expected the stored and replaced entry to stay in work, got %q", got)
+	}
+	if results := search(t, s, []float32{1, 0}, 1); !contains(results, "alpha replaced") {
+		t.Errorf("Expected the replaced summary, got %v", results)
+	}
+
+	// Storing an ID in another namespace moves it
+	if err := namespaced.StoreInNamespace(contextstore.DefaultNamespace, "a", "alpha moved", data, baseTime.Add(4*time.Second)); err != nil {
+		t.Fatalf("StoreInNamespace() error = %v", err)
+	}
+	if got := namespaces(); got != "default" {
+		t.Errorf("Expected the entry to move to default, got %q", got)
+	}
+}
@@ -0,0 +1,285 @@
+// Package eval measures how well a summarizer and embedder retrieve the
+// right entries for a workload. A preset holds a sample corpus and golden
+// queries, each naming the documents that answer it. The corpus is saved
+// into a scratch store the way save_context saves text, every query is
+// searched, and the report gives recall and mean reciprocal rank over the
+// top K results, so providers can be compared before committing to one.
+package eval
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/summarizer"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+// DefaultK is the number of results each query is judged on when
+// Options.K is 0
+const DefaultK = 5
+
+var (
+	// ErrUnknownPreset is returned by LoadPreset for a name that is not a
+	// built-in preset
+	ErrUnknownPreset = errors.New("unknown eval preset")
+
+	// ErrInvalidPreset is returned for a preset without documents or
+	// queries, with duplicate document IDs, or with queries naming
+	// documents it does not have
+	ErrInvalidPreset = errors.New("invalid eval preset")
+)
+
+//go:embed presets/*.json
+var presetFiles embed.FS
+
+// Preset is a sample corpus with golden queries
+type Preset struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Documents   []Document `json:"documents"`
+	Queries     []Query    `json:"queries"`
+}
+
+// Document is one text of a preset's corpus
+type Document struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+// Query is a golden query and the IDs of the documents that answer it
+type Query struct {
+	Query    string   `json:"query"`
+	Relevant []string `json:"relevant"`
+}
+
+// Options configures a run
+type Options struct {
+	// K is the number of results each query is judged on. 0 uses DefaultK.
+	K int
+
+	// Input is the text embedded for each document, as configured for
+	// saves. Empty embeds summaries.
+	Input vector.EmbedInput
+}
+
+// Report is the outcome of a run
+type Report struct {
+	Preset    string `json:"preset"`
+	Documents int    `json:"documents"`
+	Queries   int    `json:"queries"`
+	K         int    `json:"k"`
+
+	// Recall is the mean fraction of each query's relevant documents found
+	// in its top K results
+	Recall float64 `json:"recall"`
+
+	// MRR is the mean reciprocal rank of each query's first relevant
+	// document in its top K results, 0 for a query that found none
+	MRR float64 `json:"mrr"`
+
+	// IndexTime is how long summarizing and embedding the corpus took, and
+	// QueryTime how long embedding and searching every query took
+	IndexTime time.Duration `json:"index_time"`
+	QueryTime time.Duration `json:"query_time"`
+
+	// Results holds the outcome of each query, in preset order
+	Results []QueryResult `json:"results"`
+}
+
+// QueryResult is the outcome of one query
+type QueryResult struct {
+	Query          string   `json:"query"`
+	Relevant       []string `json:"relevant"`
+	Retrieved      []string `json:"retrieved"`
+	Recall         float64  `json:"recall"`
+	ReciprocalRank float64  `json:"reciprocal_rank"`
+}
+
+// PresetNames returns the names of the built-in presets, sorted
+func PresetNames() []string {
+	entries, err := presetFiles.ReadDir("presets")
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), path.Ext(entry.Name())))
+	}
+	slices.Sort(names)
+	return names
+}
+
+// LoadPreset returns the built-in preset with the given name
+func LoadPreset(name string) (Preset, error) {
+	data, err := presetFiles.ReadFile("presets/" + name + ".json")
+	if err != nil || strings.ContainsAny(name, "/.") {
+		return Preset{}, fmt.Errorf("%w %q: want one of %s", ErrUnknownPreset, name, strings.Join(PresetNames(), ", "))
+	}
+	return parsePreset(data, name)
+}
+
+// LoadFile reads a preset from a JSON file in the format of the built-in
+// presets, so a workload of one's own can be evaluated. A preset without a
+// name is named after the file.
+func LoadFile(filename string) (Preset, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return Preset{}, fmt.Errorf("failed to read eval preset: %w", err)
+	}
+	return parsePreset(data, strings.TrimSuffix(path.Base(filename), path.Ext(filename)))
+}
+
+// parsePreset decodes and validates a preset, naming it name if it has no
+// name of its own
+func parsePreset(data []byte, name string) (Preset, error) {
+	var preset Preset
+	if err := json.Unmarshal(data, &preset); err != nil {
+		return Preset{}, fmt.Errorf("%w %s: %w", ErrInvalidPreset, name, err)
+	}
+	if preset.Name == "" {
+		preset.Name = name
+	}
+	if err := preset.Validate(); err != nil {
+		return Preset{}, err
+	}
+	return preset, nil
+}
+
+// Validate returns ErrInvalidPreset unless the preset has documents and
+// queries, its document IDs are unique and each query names at least one
+// of them
+func (p Preset) Validate() error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w %s: %s", ErrInvalidPreset, p.Name, fmt.Sprintf(format, args...))
+	}
+	if len(p.Documents) == 0 || len(p.Queries) == 0 {
+		return invalid("needs documents and queries")
+	}
+
+	ids := make(map[string]bool, len(p.Documents))
+	for _, document := range p.Documents {
+		switch {
+		case document.ID == "" || strings.TrimSpace(document.Text) == "":
+			return invalid("document %q needs an ID and text", document.ID)
+		case ids[document.ID]:
+			return invalid("duplicate document ID %q", document.ID)
+		}
+		ids[document.ID] = true
+	}
+	for _, query := range p.Queries {
+		if strings.TrimSpace(query.Query) == "" || len(query.Relevant) == 0 {
+			return invalid("query %q needs text and relevant documents", query.Query)
+		}
+		for _, id := range query.Relevant {
+			if !ids[id] {
+				return invalid("query %q names unknown document %q", query.Query, id)
+			}
+		}
+	}
+	return nil
+}
+
+// Run saves the preset's corpus into a scratch store with summaries and
+// embeddings, searches each query and scores the results. It stops at the
+// first summarizer or embedder error, since a report missing documents
+// would not compare with others.
+func Run(ctx context.Context, preset Preset, summaries summarizer.Summarizer, embedder vector.Embedder, options Options) (Report, error) {
+	if err := preset.Validate(); err != nil {
+		return Report{}, err
+	}
+	if options.K <= 0 {
+		options.K = DefaultK
+	}
+
+	report := Report{
+		Preset:    preset.Name,
+		Documents: len(preset.Documents),
+		Queries:   len(preset.Queries),
+		K:         options.K,
+	}
+
+	store := contextstore.NewMemoryContextStore()
+	started := time.Now()
+	for _, document := range preset.Documents {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		summary, err := summaries.Summarize(ctx, document.Text)
+		if err != nil {
+			return report, fmt.Errorf("failed to summarize document %s: %w", document.ID, err)
+		}
+		embedding, err := vector.CreateEntryEmbedding(ctx, embedder, options.Input, summary, document.Text)
+		if err == nil {
+			err = vector.ValidateEmbedding(embedding.Vector)
+		}
+		if err != nil {
+			return report, fmt.Errorf("failed to embed document %s: %w", document.ID, err)
+		}
+		embeddingBytes, err := vector.Float32SliceToBytes(embedding.Vector)
+		if err != nil {
+			return report, fmt.Errorf("failed to embed document %s: %w", document.ID, err)
+		}
+		if err := store.Store(document.ID, summary, embeddingBytes, started); err != nil {
+			return report, fmt.Errorf("failed to store document %s: %w", document.ID, err)
+		}
+	}
+	report.IndexTime = time.Since(started)
+
+	started = time.Now()
+	for _, query := range preset.Queries {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		embedding, err := embedder.CreateEmbedding(query.Query)
+		if err == nil {
+			err = vector.ValidateEmbedding(embedding)
+		}
+		if err != nil {
+			return report, fmt.Errorf("failed to embed query %q: %w", query.Query, err)
+		}
+		found, err := store.SearchWithScores(embedding, options.K, contextstore.SearchFilter{})
+		if err != nil {
+			return report, fmt.Errorf("failed to search query %q: %w", query.Query, err)
+		}
+
+		retrieved := make([]string, len(found))
+		for i, result := range found {
+			retrieved[i] = result.ID
+		}
+		result := score(query, retrieved)
+		report.Results = append(report.Results, result)
+		report.Recall += result.Recall
+		report.MRR += result.ReciprocalRank
+	}
+	report.QueryTime = time.Since(started)
+
+	report.Recall /= float64(len(preset.Queries))
+	report.MRR /= float64(len(preset.Queries))
+	return report, nil
+}
+
+// score judges the documents retrieved for query against its relevant ones
+func score(query Query, retrieved []string) QueryResult {
+	result := QueryResult{Query: query.Query, Relevant: query.Relevant, Retrieved: retrieved}
+	found := 0
+	for rank, id := range retrieved {
+		if !slices.Contains(query.Relevant, id) {
+			continue
+		}
+		if found == 0 {
+			result.ReciprocalRank = 1 / float64(rank+1)
+		}
+		found++
+	}
+	result.Recall = float64(found) / float64(len(query.Relevant))
+	return result
+}
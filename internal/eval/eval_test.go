@@ -0,0 +1,118 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/localrivet/projectmemory/internal/summarizer"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+func TestPresets(t *testing.T) {
+	names := PresetNames()
+	if len(names) != 3 {
+		t.Fatalf("Expected the code, meetings and research presets, got %v", names)
+	}
+	for _, name := range names {
+		preset, err := LoadPreset(name)
+		if err != nil {
+			t.Errorf("LoadPreset(%q) failed: %v", name, err)
+			continue
+		}
+		if preset.Name != name || preset.Description == "" {
+			t.Errorf("Expected preset %q to be named after its file and described, got %q, %q", name, preset.Name, preset.Description)
+		}
+	}
+
+	for _, name := range []string{"unknown", "../presets/code", ""} {
+		if _, err := LoadPreset(name); !errors.Is(err, ErrUnknownPreset) {
+			t.Errorf("LoadPreset(%q) = %v, want ErrUnknownPreset", name, err)
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		wantErr error
+	}{
+		{"valid", `{"documents":[{"id":"a","text":"A"}],"queries":[{"query":"a","relevant":["a"]}]}`, nil},
+		{"malformed", `{"documents":`, ErrInvalidPreset},
+		{"no queries", `{"documents":[{"id":"a","text":"A"}]}`, ErrInvalidPreset},
+		{"duplicate ID", `{"documents":[{"id":"a","text":"A"},{"id":"a","text":"B"}],"queries":[{"query":"a","relevant":["a"]}]}`, ErrInvalidPreset},
+		{"unknown relevant", `{"documents":[{"id":"a","text":"A"}],"queries":[{"query":"a","relevant":["b"]}]}`, ErrInvalidPreset},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, "custom.json")
+			if err := os.WriteFile(path, []byte(test.content), 0o644); err != nil {
+				t.Fatalf("Failed to write preset: %v", err)
+			}
+			preset, err := LoadFile(path)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("LoadFile() error = %v, want %v", err, test.wantErr)
+			}
+			if err == nil && preset.Name != "custom" {
+				t.Errorf("Expected a preset without a name to be named after its file, got %q", preset.Name)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	// The mock embedder gives equal vectors only to equal texts, so queries
+	// repeating a document's text find it first and other queries find
+	// nothing relevant
+	preset := Preset{
+		Name: "test",
+		Documents: []Document{
+			{ID: "jwt", Text: "The API uses JWT tokens."},
+			{ID: "deploy", Text: "Deploys run from the release branch."},
+			{ID: "logs", Text: "Request bodies are never logged."},
+		},
+		Queries: []Query{
+			{Query: "The API uses JWT tokens.", Relevant: []string{"jwt"}},
+			{Query: "Deploys run from the release branch.", Relevant: []string{"deploy", "logs"}},
+		},
+	}
+
+	report, err := Run(context.Background(), preset, summarizer.NewBasicSummarizer(1000), vector.NewMockEmbedder(64), Options{K: 1})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if report.Documents != 3 || report.Queries != 2 || report.K != 1 || len(report.Results) != 2 {
+		t.Fatalf("Unexpected report counts: %+v", report)
+	}
+	if got := report.Results[0]; got.Recall != 1 || got.ReciprocalRank != 1 {
+		t.Errorf("Expected the first query to find its document first, got %+v", got)
+	}
+	if got := report.Results[1]; got.Recall != 0.5 || got.ReciprocalRank != 1 {
+		t.Errorf("Expected the second query to find one of its two documents first, got %+v", got)
+	}
+	if report.Recall != 0.75 || report.MRR != 1 {
+		t.Errorf("Expected recall 0.75 and MRR 1, got %v and %v", report.Recall, report.MRR)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Run(ctx, preset, summarizer.NewBasicSummarizer(1000), vector.NewMockEmbedder(64), Options{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a canceled run to fail with context.Canceled, got %v", err)
+	}
+}
+
+func TestScore(t *testing.T) {
+	result := score(Query{Query: "q", Relevant: []string{"a", "b"}}, []string{"x", "b", "a"})
+	if result.Recall != 1 || result.ReciprocalRank != 0.5 {
+		t.Errorf("Expected recall 1 and reciprocal rank 0.5, got %+v", result)
+	}
+	result = score(Query{Query: "q", Relevant: []string{"a"}}, []string{"x", "y"})
+	if result.Recall != 0 || result.ReciprocalRank != 0 {
+		t.Errorf("Expected recall 0 and reciprocal rank 0, got %+v", result)
+	}
+}
@@ -0,0 +1,120 @@
+// Package expansion asks an LLM for other ways to phrase a search query.
+// A terse query embeds close to few of the entries that answer it;
+// searching its paraphrases and the keywords they spell out as well finds
+// entries worded unlike the query, at the cost of a call and an embedding
+// per alternative.
+package expansion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/localrivet/projectmemory/internal/summarizer/providers"
+)
+
+const (
+	// DefaultQueries is how many alternative queries are asked for when
+	// no number is configured
+	DefaultQueries = 3
+
+	// maxQueryLength is the most bytes of an alternative query kept
+	maxQueryLength = 500
+)
+
+// ErrNoQueries is returned when the model's answer holds no alternative
+// query.
+var ErrNoQueries = errors.New("expansion answer holds no query")
+
+// Expander phrases a search query in other ways
+type Expander interface {
+	// Expand returns at most n alternative queries for query, none equal
+	// to it.
+	Expand(ctx context.Context, query string, n int) ([]string, error)
+}
+
+// LLMExpander is an Expander asking an LLM provider for the alternatives
+type LLMExpander struct {
+	provider providers.Completer
+}
+
+// NewLLMExpander creates an expander asking provider
+func NewLLMExpander(provider providers.Completer) *LLMExpander {
+	return &LLMExpander{provider: provider}
+}
+
+// Expand implements Expander. It returns an error wrapping ErrNoQueries if
+// the model's answer holds no alternative query.
+func (e *LLMExpander) Expand(ctx context.Context, query string, n int) ([]string, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	answer, err := e.provider.Complete(ctx, prompt(query, n))
+	if err != nil {
+		return nil, err
+	}
+	return parseQueries(answer, query, n)
+}
+
+// prompt returns the prompt asking for n alternatives to query
+func prompt(query string, n int) string {
+	var b strings.Builder
+	b.WriteString("You help a search engine over a project's notes find what a query is looking for.\n\n")
+	fmt.Fprintf(&b, "Query: %s\n\n", strings.Join(strings.Fields(query), " "))
+	fmt.Fprintf(&b, "Write %d other search queries for the same information: paraphrases, "+
+		"and the keywords or technical terms a note answering it would likely use. "+
+		"Answer with one query per line and nothing else.", n)
+	return b.String()
+}
+
+// parseQueries returns the queries of answer, one per line, without list
+// markers, skipping blank lines and lines repeating query or one another,
+// up to n
+func parseQueries(answer, query string, n int) ([]string, error) {
+	var queries []string
+	seen := map[string]bool{strings.ToLower(strings.TrimSpace(query)): true}
+	for _, line := range strings.Split(answer, "\n") {
+		line = strings.Join(strings.Fields(trimMarker(line)), " ")
+		line = strings.Trim(line, `"'`)
+		if len(line) > maxQueryLength {
+			continue
+		}
+		key := strings.ToLower(line)
+		if line == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		queries = append(queries, line)
+		if len(queries) == n {
+			break
+		}
+	}
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("%w: %q", ErrNoQueries, answer)
+	}
+	return queries, nil
+}
+
+// trimMarker returns line without a leading bullet or number such as "-",
+// "*", "1." or "2)"
+func trimMarker(line string) string {
+	line = strings.TrimSpace(line)
+	if rest, ok := strings.CutPrefix(line, "-"); ok {
+		return rest
+	}
+	if rest, ok := strings.CutPrefix(line, "*"); ok {
+		return rest
+	}
+	digits := strings.TrimLeftFunc(line, unicode.IsDigit)
+	if len(digits) < len(line) {
+		if rest, ok := strings.CutPrefix(digits, "."); ok {
+			return rest
+		}
+		if rest, ok := strings.CutPrefix(digits, ")"); ok {
+			return rest
+		}
+	}
+	return line
+}
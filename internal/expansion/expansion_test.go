@@ -0,0 +1,60 @@
+package expansion
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/localrivet/projectmemory/internal/summarizer/providers"
+)
+
+func TestLLMExpander(t *testing.T) {
+	tests := []struct {
+		name    string
+		answer  string
+		n       int
+		want    []string
+		wantErr error
+	}{
+		{"one per line", "deploy to staging\nrelease process", 3, []string{"deploy to staging", "release process"}, nil},
+		{"list markers", "1. deploy to staging\n2) release process\n- rollout\n* ship", 4, []string{"deploy to staging", "release process", "rollout", "ship"}, nil},
+		{"cut at n", "a\nb\nc", 2, []string{"a", "b"}, nil},
+		{"original and repeats skipped", "How do we deploy?\n\n\"rollout\"\nRollout\n", 3, []string{"rollout"}, nil},
+		{"numbers kept", "2024 release", 1, []string{"2024 release"}, nil},
+		{"nothing new", "how do we deploy?", 3, nil, ErrNoQueries},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider := &providers.AnswerCompleter{Answer: test.answer}
+			got, err := NewLLMExpander(provider).Expand(context.Background(), "how do we deploy?", test.n)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("Expand() error = %v, want %v", err, test.wantErr)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("Expand() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLLMExpanderPrompt(t *testing.T) {
+	provider := &providers.AnswerCompleter{Answer: "rollout"}
+	if _, err := NewLLMExpander(provider).Expand(context.Background(), "how do\nwe deploy?", 3); err != nil {
+		t.Fatalf("Expand() error = %v", err)
+	}
+	for _, want := range []string{"Query: how do we deploy?\n", "Write 3 other search queries"} {
+		if !strings.Contains(provider.Prompt, want) {
+			t.Errorf("Expected the prompt to contain %q, got:\n%s", want, provider.Prompt)
+		}
+	}
+}
+
+func TestLLMExpanderProviderError(t *testing.T) {
+	failure := errors.New("rate limited")
+	_, err := NewLLMExpander(&providers.AnswerCompleter{Err: failure}).Expand(context.Background(), "deploy", 3)
+	if !errors.Is(err, failure) {
+		t.Errorf("Expected the provider's error, got %v", err)
+	}
+}
@@ -0,0 +1,401 @@
+// Package git reads the commits of a repository with the git command, so
+// their messages, and optionally their diffs, can be saved as memories of
+// how and why the project changed. Captures pick up where the last one
+// stopped, and a post-commit hook can run them after every commit.
+package git
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+)
+
+const (
+	// DefaultMaxCommits is the number of commits read when
+	// Options.MaxCommits is 0
+	DefaultMaxCommits = 100
+
+	// MaxDiffSize is the largest diff kept with a commit, in bytes. Longer
+	// diffs are cut at a line and marked as truncated.
+	MaxDiffSize = 16 << 10
+
+	// maxListedFiles is the number of changed files named in a commit's
+	// document; all of them are kept in Commit.Files
+	maxListedFiles = 20
+
+	// hookMarker marks the hooks written by InstallHook, so they can be
+	// replaced while other hooks are left alone
+	hookMarker = "# Installed by projectmemory capture-git"
+)
+
+var (
+	// ErrNotRepository is returned when a directory is not in a git
+	// repository.
+	ErrNotRepository = errors.New("not a git repository")
+
+	// ErrUnknownCommit is returned when the commit to capture from is not
+	// in the repository, such as after history was rewritten.
+	ErrUnknownCommit = errors.New("unknown commit")
+
+	// ErrHookExists is returned by InstallHook when the repository already
+	// has a post-commit hook it did not write.
+	ErrHookExists = errors.New("repository already has a post-commit hook")
+)
+
+// Commit is a commit saved as an entry
+type Commit struct {
+	// SHA is the commit's full hash
+	SHA string
+
+	// Author is the name of the commit's author, and Date when they wrote
+	// it
+	Author string
+	Date   time.Time
+
+	// Subject is the first line of the message, and Body the rest of it
+	Subject string
+	Body    string
+
+	// Files are the paths of the files the commit changed, relative to the
+	// repository's root
+	Files []string
+
+	// Diff is the commit's patch, up to MaxDiffSize, when diffs are read
+	Diff string
+}
+
+// Short returns the commit's hash abbreviated to 12 characters
+func (c Commit) Short() string {
+	if len(c.SHA) > 12 {
+		return c.SHA[:12]
+	}
+	return c.SHA
+}
+
+// Tag returns the tag of the commit's entry, "commit:" and its full hash
+func (c Commit) Tag() string {
+	return "commit:" + c.SHA
+}
+
+// Source returns the commit as the origin of its entry's provenance chain,
+// "git:" and its full hash
+func (c Commit) Source() string {
+	return contextstore.SourceGit + ":" + c.SHA
+}
+
+// Document returns the text saved for the commit: a line naming it, its
+// author and date, then its message, the files it changed and its diff
+func (c Commit) Document() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Commit %s by %s on %s: %s", c.Short(), c.Author, c.Date.Format("2006-01-02"), c.Subject)
+	if c.Body != "" {
+		b.WriteString("\n\n" + c.Body)
+	}
+	if len(c.Files) > 0 {
+		listed := c.Files
+		if len(listed) > maxListedFiles {
+			listed = listed[:maxListedFiles]
+		}
+		b.WriteString("\n\nFiles changed: " + strings.Join(listed, ", "))
+		if more := len(c.Files) - len(listed); more > 0 {
+			fmt.Fprintf(&b, " and %d more", more)
+		}
+	}
+	if c.Diff != "" {
+		b.WriteString("\n\n" + c.Diff)
+	}
+	return b.String()
+}
+
+// Options control a capture. The zero value reads the messages of the
+// commits since the last capture, or of the last DefaultMaxCommits.
+type Options struct {
+	// Since is the commit after which commits are read, overriding the
+	// state file. Empty reads from the commit recorded there, or the last
+	// MaxCommits commits if there is none.
+	Since string
+
+	// MaxCommits is the most commits read, the newest first; 0 is
+	// DefaultMaxCommits
+	MaxCommits int
+
+	// Diffs reads each commit's patch along with its message
+	Diffs bool
+
+	// StatePath is the file recording the last commit captured. Empty is
+	// projectmemory-capture.json in the repository's git directory, so it
+	// is never committed.
+	StatePath string
+
+	// DryRun counts the commits without saving them or the state
+	DryRun bool
+
+	// Progress, if set, is called after each commit
+	Progress func(Report)
+}
+
+// Report counts the commits of a capture
+type Report struct {
+	// Commits is the number of commits read. Saved commits are stored;
+	// Failed commits could not be saved.
+	Commits int
+	Saved   int
+	Failed  int
+
+	// Last is the hash of the last commit saved
+	Last string
+}
+
+// SaveFunc saves a commit as an entry
+type SaveFunc func(ctx context.Context, commit Commit) error
+
+// state is the content of the state file
+type state struct {
+	LastCommit string `json:"last_commit"`
+}
+
+// Capture reads the commits of the repository holding dir made since the
+// last capture, oldest first, and saves each with save, recording it in
+// the state file once saved. A commit that cannot be saved stops the
+// capture and is counted in the report, so the next one starts with it;
+// errors running git and cancellation of ctx stop it too. Merge commits
+// are left out.
+func Capture(ctx context.Context, dir string, save SaveFunc, options Options) (Report, error) {
+	statePath := options.StatePath
+	if statePath == "" {
+		var err error
+		if statePath, err = StatePath(ctx, dir); err != nil {
+			return Report{}, err
+		}
+	}
+	since := options.Since
+	if since == "" {
+		var err error
+		if since, err = loadState(statePath); err != nil {
+			return Report{}, err
+		}
+	}
+	commits, err := Log(ctx, dir, since, options.MaxCommits, options.Diffs)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{Commits: len(commits)}
+	for _, commit := range commits {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if options.DryRun {
+			continue
+		}
+		if err := save(ctx, commit); err != nil {
+			report.Failed++
+			break
+		}
+		report.Saved++
+		report.Last = commit.SHA
+		if err := saveState(statePath, commit.SHA); err != nil {
+			return report, err
+		}
+		if options.Progress != nil {
+			options.Progress(report)
+		}
+	}
+	return report, nil
+}
+
+// Log returns up to maxCommits of the newest commits after since reachable
+// from HEAD, oldest first, without merge commits. Empty since reads the
+// whole history, and maxCommits 0 is DefaultMaxCommits. A repository
+// without commits has none. It returns ErrUnknownCommit if since is not a
+// commit of the repository.
+func Log(ctx context.Context, dir, since string, maxCommits int, diffs bool) ([]Commit, error) {
+	if maxCommits <= 0 {
+		maxCommits = DefaultMaxCommits
+	}
+	if _, err := run(ctx, dir, "rev-parse", "--git-dir"); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotRepository, dir)
+	}
+	if _, err := run(ctx, dir, "rev-parse", "--verify", "--quiet", "HEAD^{commit}"); err != nil {
+		return nil, nil
+	}
+	revisions := "HEAD"
+	if since != "" {
+		sha, err := run(ctx, dir, "rev-parse", "--verify", "--quiet", since+"^{commit}")
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownCommit, since)
+		}
+		revisions = strings.TrimSpace(sha) + "..HEAD"
+	}
+
+	// Each commit starts with a record separator, its fields end with unit
+	// separators, and the files it changed follow one per line
+	out, err := run(ctx, dir, "-c", "core.quotePath=false", "log", "--no-merges", "--reverse",
+		fmt.Sprintf("--max-count=%d", maxCommits), "--format=%x1e%H%x1f%an%x1f%aI%x1f%s%x1f%b%x1f",
+		"--name-only", revisions, "--")
+	if err != nil {
+		return nil, err
+	}
+	var commits []Commit
+	for _, record := range strings.Split(out, "\x1e") {
+		fields := strings.Split(record, "\x1f")
+		if len(fields) != 6 {
+			continue
+		}
+		date, err := time.Parse(time.RFC3339, fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the date of commit %s: %w", fields[0], err)
+		}
+		commit := Commit{
+			SHA:     fields[0],
+			Author:  fields[1],
+			Date:    date,
+			Subject: fields[3],
+			Body:    strings.TrimSpace(fields[4]),
+		}
+		for _, file := range strings.Split(fields[5], "\n") {
+			if file = strings.TrimSpace(file); file != "" {
+				commit.Files = append(commit.Files, file)
+			}
+		}
+		if diffs {
+			diff, err := run(ctx, dir, "show", "--format=", "--patch", "--no-color", "--no-ext-diff", commit.SHA, "--")
+			if err != nil {
+				return nil, err
+			}
+			commit.Diff = truncateDiff(strings.TrimSpace(diff))
+		}
+		commits = append(commits, commit)
+	}
+	return commits, nil
+}
+
+// StatePath returns the default state file of the repository holding dir,
+// in its git directory
+func StatePath(ctx context.Context, dir string) (string, error) {
+	return gitPath(ctx, dir, "projectmemory-capture.json")
+}
+
+// InstallHook writes a post-commit hook to the repository holding dir that
+// runs command in the background after every commit, with its output
+// discarded, and returns the hook's path. A hook written by an earlier
+// InstallHook is replaced; any other hook is left alone and ErrHookExists
+// returned.
+func InstallHook(ctx context.Context, dir, command string) (string, error) {
+	path, err := gitPath(ctx, dir, "hooks/post-commit")
+	if err != nil {
+		return "", err
+	}
+	existing, err := os.ReadFile(path)
+	if err == nil && !strings.Contains(string(existing), hookMarker) {
+		return "", fmt.Errorf("%w: %s", ErrHookExists, path)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	script := "#!/bin/sh\n" + hookMarker + "\n" + command + " >/dev/null 2>&1 &\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// gitPath returns the path of name in the git directory of the repository
+// holding dir
+func gitPath(ctx context.Context, dir, name string) (string, error) {
+	out, err := run(ctx, dir, "rev-parse", "--git-path", name)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrNotRepository, dir)
+	}
+	path := strings.TrimSpace(out)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	return path, nil
+}
+
+// run runs git in dir with args and returns its output
+func run(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("git %s: %w: %s", args[0], err, message)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return stdout.String(), nil
+}
+
+// truncateDiff cuts diff to MaxDiffSize at the end of a line
+func truncateDiff(diff string) string {
+	if len(diff) <= MaxDiffSize {
+		return diff
+	}
+	cut := strings.LastIndexByte(diff[:MaxDiffSize], '\n')
+	if cut < 0 {
+		cut = MaxDiffSize
+	}
+	return diff[:cut] + "\n[diff truncated]"
+}
+
+// String describes the report in one line
+func (r Report) String() string {
+	return fmt.Sprintf("%d commits: %d saved, %d failed", r.Commits, r.Saved, r.Failed)
+}
+
+// loadState returns the last commit recorded in the state file at path,
+// or "" if there is no state file
+func loadState(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read state file: %w", err)
+	}
+	var saved state
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return "", fmt.Errorf("failed to parse state file: %w", err)
+	}
+	return saved.LastCommit, nil
+}
+
+// saveState writes the state file next to its final name and renames it
+// into place, so an interrupted write leaves the previous state
+func saveState(path, sha string) error {
+	data, err := json.Marshal(state{LastCommit: sha})
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+	return nil
+}
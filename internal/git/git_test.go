@@ -0,0 +1,141 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newRepository creates a repository in a temporary directory, skipping the
+// test if git is not installed
+func newRepository(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	gitRun(t, dir, "init", "--quiet")
+	gitRun(t, dir, "config", "user.name", "Ada")
+	gitRun(t, dir, "config", "user.email", "ada@example.com")
+	gitRun(t, dir, "config", "commit.gpgsign", "false")
+	return dir
+}
+
+// commitFile writes file in dir and commits it with message
+func commitFile(t *testing.T, dir, file, content, message string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, dir, "add", file)
+	gitRun(t, dir, "commit", "--quiet", "-m", message)
+}
+
+func gitRun(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	if _, err := run(context.Background(), dir, args...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCapture(t *testing.T) {
+	ctx := context.Background()
+	dir := newRepository(t)
+
+	if report, err := Capture(ctx, dir, nil, Options{}); err != nil || report.Commits != 0 {
+		t.Fatalf("Capture() of an empty repository = %+v, %v", report, err)
+	}
+
+	commitFile(t, dir, "auth.go", "package auth\n", "Add auth package\n\nTokens are JWTs signed with the deploy key.")
+	commitFile(t, dir, "deploy.md", "# Deploys\n", "Document deploys")
+
+	var saved []Commit
+	save := func(ctx context.Context, commit Commit) error {
+		saved = append(saved, commit)
+		return nil
+	}
+	report, err := Capture(ctx, dir, save, Options{Diffs: true})
+	if err != nil || report.Saved != 2 || len(saved) != 2 {
+		t.Fatalf("Capture() = %+v, %v; saved %+v", report, err, saved)
+	}
+	first := saved[0]
+	if first.Subject != "Add auth package" || first.Author != "Ada" || len(first.Files) != 1 || first.Files[0] != "auth.go" {
+		t.Errorf("Expected the oldest commit first, got %+v", first)
+	}
+	document := first.Document()
+	for _, want := range []string{"Commit " + first.Short() + " by Ada", "Tokens are JWTs", "Files changed: auth.go", "+package auth"} {
+		if !strings.Contains(document, want) {
+			t.Errorf("Expected document containing %q, got %q", want, document)
+		}
+	}
+	if report.Last != saved[1].SHA || first.Tag() != "commit:"+first.SHA {
+		t.Errorf("Expected the last commit recorded, got %+v", report)
+	}
+
+	// The next capture starts after the last one
+	commitFile(t, dir, "deploy.md", "# Deploys\nFrom the release branch.\n", "Deploy from the release branch")
+	saved = nil
+	if report, err := Capture(ctx, dir, save, Options{}); err != nil || report.Saved != 1 || saved[0].Diff != "" {
+		t.Fatalf("Capture() after a commit = %+v, %v; saved %+v", report, err, saved)
+	}
+	if report, err := Capture(ctx, dir, save, Options{}); err != nil || report.Commits != 0 {
+		t.Errorf("Expected nothing new to capture, got %+v, %v", report, err)
+	}
+
+	// A commit that cannot be saved is read again by the next capture
+	commitFile(t, dir, "notes.txt", "notes\n", "Add notes")
+	failing := func(ctx context.Context, commit Commit) error { return errors.New("store is down") }
+	if report, err := Capture(ctx, dir, failing, Options{}); err != nil || report.Failed != 1 {
+		t.Fatalf("Capture() with failing saves = %+v, %v", report, err)
+	}
+	saved = nil
+	if report, err := Capture(ctx, dir, save, Options{}); err != nil || report.Saved != 1 || saved[0].Subject != "Add notes" {
+		t.Errorf("Expected the failed commit captured again, got %+v, %v", report, err)
+	}
+
+	if _, err := Capture(ctx, dir, save, Options{Since: "0123456789abcdef"}); !errors.Is(err, ErrUnknownCommit) {
+		t.Errorf("Expected ErrUnknownCommit, got %v", err)
+	}
+	if _, err := Capture(ctx, t.TempDir(), save, Options{}); !errors.Is(err, ErrNotRepository) {
+		t.Errorf("Expected ErrNotRepository, got %v", err)
+	}
+}
+
+func TestTruncateDiff(t *testing.T) {
+	diff := strings.Repeat("+a line of the patch\n", MaxDiffSize/10)
+	truncated := truncateDiff(diff)
+	if len(truncated) > MaxDiffSize+len("\n[diff truncated]") || !strings.HasSuffix(truncated, "patch\n[diff truncated]") {
+		t.Errorf("Expected the diff cut at a line, got %d bytes ending %q", len(truncated), truncated[len(truncated)-40:])
+	}
+	if got := truncateDiff("+short"); got != "+short" {
+		t.Errorf("truncateDiff() = %q, want it unchanged", got)
+	}
+}
+
+func TestInstallHook(t *testing.T) {
+	ctx := context.Background()
+	dir := newRepository(t)
+
+	path, err := InstallHook(ctx, dir, "'/usr/local/bin/projectmemory' capture-git")
+	if err != nil {
+		t.Fatalf("InstallHook() error = %v", err)
+	}
+	script, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(script), "'/usr/local/bin/projectmemory' capture-git >/dev/null 2>&1 &") {
+		t.Fatalf("Expected the hook to run the command, got %q, %v", script, err)
+	}
+	if _, err := InstallHook(ctx, dir, "projectmemory capture-git --diffs"); err != nil {
+		t.Errorf("Expected the hook replaced, got %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("#!/bin/sh\nmake lint\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := InstallHook(ctx, dir, "projectmemory capture-git"); !errors.Is(err, ErrHookExists) {
+		t.Errorf("Expected ErrHookExists, got %v", err)
+	}
+}
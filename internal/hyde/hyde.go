@@ -0,0 +1,72 @@
+// Package hyde drafts hypothetical answers to search queries, for
+// hypothetical document embeddings. A question embeds close to other
+// questions rather than to the notes that answer it; a passage answering
+// it, even a wrong one, is worded like those notes and embeds close to
+// them. The draft is only searched with, never returned.
+package hyde
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/localrivet/projectmemory/internal/summarizer/providers"
+)
+
+// maxDraftLength is the most bytes of a draft kept. Embedders read the
+// start of long texts, and a draft longer than a note embeds unlike one.
+const maxDraftLength = 2000
+
+// ErrEmptyDraft is returned when the model's answer holds no draft.
+var ErrEmptyDraft = errors.New("hyde answer holds no draft")
+
+// Drafter writes a hypothetical answer to a search query
+type Drafter interface {
+	// Draft returns a passage answering query as a note in the searched
+	// project would
+	Draft(ctx context.Context, query string) (string, error)
+}
+
+// LLMDrafter is a Drafter asking an LLM provider for the draft
+type LLMDrafter struct {
+	provider providers.Completer
+}
+
+// NewLLMDrafter creates a drafter asking provider
+func NewLLMDrafter(provider providers.Completer) *LLMDrafter {
+	return &LLMDrafter{provider: provider}
+}
+
+// Draft implements Drafter. It returns an error wrapping ErrEmptyDraft if
+// the model's answer is blank.
+func (d *LLMDrafter) Draft(ctx context.Context, query string) (string, error) {
+	answer, err := d.provider.Complete(ctx, prompt(query))
+	if err != nil {
+		return "", err
+	}
+	draft := strings.TrimSpace(answer)
+	if draft == "" {
+		return "", ErrEmptyDraft
+	}
+	if len(draft) > maxDraftLength {
+		cut := maxDraftLength
+		for cut > 0 && !utf8.RuneStart(draft[cut]) {
+			cut--
+		}
+		draft = draft[:cut]
+	}
+	return draft, nil
+}
+
+// prompt returns the prompt asking for a hypothetical answer to query
+func prompt(query string) string {
+	var b strings.Builder
+	b.WriteString("You help a search engine over a software project's notes find what a query is looking for.\n\n")
+	fmt.Fprintf(&b, "Query: %s\n\n", strings.Join(strings.Fields(query), " "))
+	b.WriteString("Write a short passage, a few sentences, that answers the query as a note in the project " +
+		"would: a decision, convention, explanation or summary of past work. Use the terms such a note would " +
+		"likely use. If you do not know the answer, write a plausible one. Answer with the passage only.")
+	return b.String()
+}
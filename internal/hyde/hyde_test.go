@@ -0,0 +1,52 @@
+package hyde
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/localrivet/projectmemory/internal/summarizer/providers"
+)
+
+func TestLLMDrafter(t *testing.T) {
+	tests := []struct {
+		name    string
+		answer  string
+		want    string
+		wantErr error
+	}{
+		{"trimmed", "\n We deploy with Helm from CI. \n", "We deploy with Helm from CI.", nil},
+		{"cut to the maximum length", strings.Repeat("é", maxDraftLength), strings.Repeat("é", maxDraftLength/2), nil},
+		{"blank", " \n ", "", ErrEmptyDraft},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := NewLLMDrafter(&providers.AnswerCompleter{Answer: test.answer}).Draft(context.Background(), "how do we deploy?")
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("Draft() error = %v, want %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("Draft() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLLMDrafterPrompt(t *testing.T) {
+	provider := &providers.AnswerCompleter{Answer: "We deploy with Helm."}
+	if _, err := NewLLMDrafter(provider).Draft(context.Background(), "how do\nwe deploy?"); err != nil {
+		t.Fatalf("Draft() error = %v", err)
+	}
+	if !strings.Contains(provider.Prompt, "Query: how do we deploy?\n") {
+		t.Errorf("Expected the prompt to contain the query on one line, got:\n%s", provider.Prompt)
+	}
+}
+
+func TestLLMDrafterProviderError(t *testing.T) {
+	failure := errors.New("rate limited")
+	_, err := NewLLMDrafter(&providers.AnswerCompleter{Err: failure}).Draft(context.Background(), "deploy")
+	if !errors.Is(err, failure) {
+		t.Errorf("Expected the provider's error, got %v", err)
+	}
+}
@@ -0,0 +1,293 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"strings"
+
+	"github.com/localrivet/projectmemory/internal/tokenizer"
+)
+
+// Chunker names
+const (
+	// ChunkerAuto splits markdown by headings, Go by symbols and other
+	// files by tokens
+	ChunkerAuto = "auto"
+
+	// ChunkerHeadings splits markdown into its sections
+	ChunkerHeadings = "headings"
+
+	// ChunkerTokens splits text into runs of whole lines within the token
+	// budget
+	ChunkerTokens = "tokens"
+
+	// ChunkerSymbols splits Go source into its top-level declarations
+	ChunkerSymbols = "symbols"
+)
+
+// DefaultMaxTokens is the token budget of a chunk when Options.MaxTokens is
+// 0
+const DefaultMaxTokens = 500
+
+// ErrUnknownChunker is returned by NewChunker for a name it does not know.
+var ErrUnknownChunker = errors.New("unknown chunker")
+
+// Chunk is a part of a file saved as an entry of its own
+type Chunk struct {
+	// Path is the file's slash-separated path
+	Path string
+
+	// StartLine and EndLine are the first and last lines of the file the
+	// chunk holds, counted from 1
+	StartLine int
+	EndLine   int
+
+	// Section is the markdown heading the chunk falls under, or the Go
+	// symbol it declares, "Type.Method" for a method. It is empty for
+	// chunks of plain text.
+	Section string
+
+	// Text is the chunk's content
+	Text string
+}
+
+// Source returns where the chunk came from, as "path#L3-L20", for its
+// entry's provenance chain
+func (c Chunk) Source() string {
+	return fmt.Sprintf("%s#L%d-L%d", c.Path, c.StartLine, c.EndLine)
+}
+
+// Document returns the text saved for the chunk: its content after a line
+// naming its file, lines and section, so its summary can tell where it is
+// from
+func (c Chunk) Document() string {
+	header := fmt.Sprintf("%s, lines %d-%d", c.Path, c.StartLine, c.EndLine)
+	if c.Section != "" {
+		header += ": " + c.Section
+	}
+	return header + "\n\n" + c.Text
+}
+
+// Chunker splits the content of a file into chunks
+type Chunker interface {
+	// Chunk returns the chunks of content, the file at path, in order.
+	// Blank content has none.
+	Chunk(path, content string) []Chunk
+}
+
+// NewChunker returns the chunker named name, ChunkerAuto if empty, whose
+// chunks stay within maxTokens as counter counts them where whole lines
+// allow. maxTokens 0 is DefaultMaxTokens and a nil counter estimates
+// tokens with tokenizer.Approximate.
+func NewChunker(name string, maxTokens int, counter tokenizer.Tokenizer) (Chunker, error) {
+	if maxTokens <= 0 {
+		maxTokens = DefaultMaxTokens
+	}
+	if counter == nil {
+		counter = tokenizer.Approximate{}
+	}
+	tokens := TokenChunker{MaxTokens: maxTokens, Tokenizer: counter}
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", ChunkerAuto:
+		return autoChunker{
+			headings: HeadingChunker{tokens},
+			symbols:  SymbolChunker{tokens},
+			tokens:   tokens,
+		}, nil
+	case ChunkerHeadings:
+		return HeadingChunker{tokens}, nil
+	case ChunkerTokens:
+		return tokens, nil
+	case ChunkerSymbols:
+		return SymbolChunker{tokens}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q (want %s, %s, %s or %s)", ErrUnknownChunker, name,
+			ChunkerAuto, ChunkerHeadings, ChunkerTokens, ChunkerSymbols)
+	}
+}
+
+// autoChunker picks a chunker by the file's extension
+type autoChunker struct {
+	headings HeadingChunker
+	symbols  SymbolChunker
+	tokens   TokenChunker
+}
+
+// Chunk splits markdown by headings, Go by symbols and anything else by
+// tokens
+func (a autoChunker) Chunk(file, content string) []Chunk {
+	switch strings.ToLower(path.Ext(file)) {
+	case ".md", ".markdown":
+		return a.headings.Chunk(file, content)
+	case ".go":
+		return a.symbols.Chunk(file, content)
+	default:
+		return a.tokens.Chunk(file, content)
+	}
+}
+
+// TokenChunker splits text into runs of whole lines of up to MaxTokens
+// tokens. A line over the budget is a chunk of its own.
+type TokenChunker struct {
+	MaxTokens int
+	Tokenizer tokenizer.Tokenizer
+}
+
+// Chunk splits content into runs of lines within the token budget, leaving
+// out blank runs
+func (t TokenChunker) Chunk(file, content string) []Chunk {
+	return t.split(file, strings.Split(content, "\n"), 1, "")
+}
+
+// split chunks lines, the first of which is line first of the file, under
+// section
+func (t TokenChunker) split(file string, lines []string, first int, section string) []Chunk {
+	var chunks []Chunk
+	start, used := 0, 0
+	flush := func(end int) {
+		if text := strings.TrimSpace(strings.Join(lines[start:end], "\n")); text != "" {
+			// Leading and trailing blank lines are not part of the range
+			for strings.TrimSpace(lines[start]) == "" {
+				start++
+			}
+			last := end - 1
+			for strings.TrimSpace(lines[last]) == "" {
+				last--
+			}
+			chunks = append(chunks, Chunk{Path: file, StartLine: first + start, EndLine: first + last, Section: section, Text: text})
+		}
+		start, used = end, 0
+	}
+	for i, line := range lines {
+		tokens := t.Tokenizer.Count(line + "\n")
+		if used > 0 && used+tokens > t.MaxTokens {
+			flush(i)
+		}
+		used += tokens
+	}
+	flush(len(lines))
+	return chunks
+}
+
+// HeadingChunker splits markdown into the sections its headings start,
+// each under its heading's text. Sections over the budget are split by
+// tokens, and headings in fenced code blocks are not headings.
+type HeadingChunker struct {
+	Tokens TokenChunker
+}
+
+// Chunk splits content into its sections
+func (h HeadingChunker) Chunk(file, content string) []Chunk {
+	lines := strings.Split(content, "\n")
+	var chunks []Chunk
+	start, heading, fenced := 0, "", false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fenced = !fenced
+		}
+		if fenced || !isHeading(trimmed) {
+			continue
+		}
+		chunks = append(chunks, h.Tokens.split(file, lines[start:i], start+1, heading)...)
+		start, heading = i, strings.TrimSpace(strings.TrimLeft(trimmed, "#"))
+	}
+	return append(chunks, h.Tokens.split(file, lines[start:], start+1, heading)...)
+}
+
+// isHeading reports whether a trimmed line is an ATX heading, one to six
+// #s followed by a space
+func isHeading(line string) bool {
+	level := len(line) - len(strings.TrimLeft(line, "#"))
+	return level >= 1 && level <= 6 && (len(line) == level || line[level] == ' ')
+}
+
+// SymbolChunker splits Go source into its top-level declarations, each
+// with its doc comment, under the declared symbol's name. The package
+// clause and imports are left out, declarations over the budget are split
+// by tokens, and files that are not Go or do not parse are split by tokens.
+type SymbolChunker struct {
+	Tokens TokenChunker
+}
+
+// Chunk splits content into its declarations
+func (s SymbolChunker) Chunk(file, content string) []Chunk {
+	if strings.ToLower(path.Ext(file)) != ".go" {
+		return s.Tokens.Chunk(file, content)
+	}
+	fset := token.NewFileSet()
+	parsed, err := parser.ParseFile(fset, file, content, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return s.Tokens.Chunk(file, content)
+	}
+
+	lines := strings.Split(content, "\n")
+	var chunks []Chunk
+	for _, decl := range parsed.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			continue
+		}
+		start := decl.Pos()
+		if doc := declDoc(decl); doc != nil {
+			start = doc.Pos()
+		}
+		first, last := fset.Position(start).Line, fset.Position(decl.End()).Line
+		chunks = append(chunks, s.Tokens.split(file, lines[first-1:last], first, declName(decl))...)
+	}
+	return chunks
+}
+
+// declDoc returns the doc comment of a declaration, if any
+func declDoc(decl ast.Decl) *ast.CommentGroup {
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		return decl.Doc
+	case *ast.GenDecl:
+		return decl.Doc
+	}
+	return nil
+}
+
+// declName names what a declaration declares: "Type.Method" for a method,
+// and the first name of a group of types, constants or variables
+func declName(decl ast.Decl) string {
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		if decl.Recv != nil && len(decl.Recv.List) > 0 {
+			return receiverName(decl.Recv.List[0].Type) + "." + decl.Name.Name
+		}
+		return decl.Name.Name
+	case *ast.GenDecl:
+		for _, spec := range decl.Specs {
+			switch spec := spec.(type) {
+			case *ast.TypeSpec:
+				return spec.Name.Name
+			case *ast.ValueSpec:
+				if len(spec.Names) > 0 {
+					return spec.Names[0].Name
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// receiverName returns the type name of a method receiver, without pointer
+// or type parameters
+func receiverName(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(expr.X)
+	case *ast.IndexExpr:
+		return receiverName(expr.X)
+	case *ast.IndexListExpr:
+		return receiverName(expr.X)
+	case *ast.Ident:
+		return expr.Name
+	}
+	return ""
+}
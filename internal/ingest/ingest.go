@@ -0,0 +1,232 @@
+// Package ingest reads markdown, code and text files, splits them into
+// chunks and hands each chunk to be saved as an entry of its own, with the
+// file and lines it came from, so documentation and code can be searched
+// alongside the memories agents save.
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/localrivet/projectmemory/internal/tokenizer"
+)
+
+// MaxFileSize is the largest file ingested. Larger files are skipped, as
+// they are rarely notes and would crowd out everything else.
+const MaxFileSize = 1 << 20
+
+var (
+	// ErrNoFiles is returned by Files and Run when the paths hold no file
+	// to ingest.
+	ErrNoFiles = errors.New("no files to ingest")
+
+	// ErrSkippedFile is returned by ReadChunks for a file over MaxFileSize
+	// or holding NUL bytes.
+	ErrSkippedFile = errors.New("file is too large or binary to ingest")
+)
+
+// textExtensions are the extensions of the files found in directories.
+// Files named explicitly are ingested whatever their extension.
+var textExtensions = map[string]bool{
+	".md": true, ".markdown": true, ".txt": true, ".rst": true, ".adoc": true,
+	".go": true, ".py": true, ".js": true, ".jsx": true, ".ts": true, ".tsx": true,
+	".java": true, ".kt": true, ".rb": true, ".rs": true, ".c": true, ".h": true,
+	".cc": true, ".cpp": true, ".hpp": true, ".cs": true, ".php": true, ".swift": true,
+	".scala": true, ".sh": true, ".sql": true, ".proto": true,
+	".yaml": true, ".yml": true, ".toml": true,
+}
+
+// skippedDirs are directories that hold dependencies or build output rather
+// than a repository's own files. Directories whose names start with a dot
+// are skipped too.
+var skippedDirs = map[string]bool{
+	"vendor":       true,
+	"node_modules": true,
+}
+
+// Options control a run. The zero value chunks files with ChunkerAuto.
+type Options struct {
+	// Chunker names the chunker splitting files, ChunkerAuto if empty
+	Chunker string
+
+	// MaxTokens is the token budget of a chunk, DefaultMaxTokens if 0
+	MaxTokens int
+
+	// Tokenizer counts the tokens of chunks. Nil estimates them with
+	// tokenizer.Approximate.
+	Tokenizer tokenizer.Tokenizer
+
+	// Root is the directory chunk paths are relative to, the working
+	// directory if empty. Files outside it keep their absolute paths.
+	Root string
+
+	// DryRun chunks the files without saving anything
+	DryRun bool
+
+	// Progress, if set, is called after each file
+	Progress func(Report)
+}
+
+// Report counts the files and chunks of a run
+type Report struct {
+	// Files is the number of files found, and Skipped those too large or
+	// binary to ingest
+	Files   int
+	Skipped int
+
+	// Chunks is the number of chunks the ingested files were split into.
+	// Saved chunks are stored; Failed chunks could not be saved.
+	Chunks int
+	Saved  int
+	Failed int
+}
+
+// SaveFunc saves a chunk as an entry
+type SaveFunc func(ctx context.Context, chunk Chunk) error
+
+// Files returns the files to ingest under paths, sorted and each once:
+// files named explicitly, and the markdown, code and text files found in
+// directories, without hidden directories, dependencies and build output.
+func Files(paths []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+	add := func(file string) {
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+	for _, root := range paths {
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			add(filepath.Clean(root))
+			continue
+		}
+		err = filepath.WalkDir(root, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			name := entry.Name()
+			if entry.IsDir() {
+				if file != root && skippedDir(name) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if entry.Type().IsRegular() && textExtensions[strings.ToLower(filepath.Ext(name))] {
+				add(file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(files) == 0 {
+		return nil, ErrNoFiles
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Run splits the files under paths into chunks and saves each with save,
+// file by file. Files over MaxFileSize or holding NUL bytes are skipped.
+// Errors saving a chunk are counted in the report; errors reading files
+// and cancellation of ctx stop the run.
+func Run(ctx context.Context, paths []string, save SaveFunc, options Options) (Report, error) {
+	chunker, err := NewChunker(options.Chunker, options.MaxTokens, options.Tokenizer)
+	if err != nil {
+		return Report{}, err
+	}
+	root := options.Root
+	if root == "" {
+		if root, err = os.Getwd(); err != nil {
+			return Report{}, err
+		}
+	}
+	files, err := Files(paths)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{Files: len(files)}
+	for _, file := range files {
+		chunks, err := ReadChunks(chunker, root, file)
+		if errors.Is(err, ErrSkippedFile) {
+			report.Skipped++
+			if options.Progress != nil {
+				options.Progress(report)
+			}
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+
+		for _, chunk := range chunks {
+			if err := ctx.Err(); err != nil {
+				return report, err
+			}
+			report.Chunks++
+			if options.DryRun {
+				continue
+			}
+			if err := save(ctx, chunk); err != nil {
+				report.Failed++
+				continue
+			}
+			report.Saved++
+		}
+		if options.Progress != nil {
+			options.Progress(report)
+		}
+	}
+	return report, nil
+}
+
+// ReadChunks reads file and splits it with chunker, the chunks' paths
+// relative to root. It returns ErrSkippedFile for a file over MaxFileSize
+// or holding NUL bytes.
+func ReadChunks(chunker Chunker, root, file string) ([]Chunk, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > MaxFileSize || bytes.IndexByte(content, 0) >= 0 {
+		return nil, fmt.Errorf("%w: %s", ErrSkippedFile, file)
+	}
+	return chunker.Chunk(RelativePath(root, file), string(content)), nil
+}
+
+// RelativePath returns the slash-separated path of file from root, or its
+// absolute path if it is outside root
+func RelativePath(root, file string) string {
+	absolute, err := filepath.Abs(file)
+	if err != nil {
+		return filepath.ToSlash(file)
+	}
+	absoluteRoot, err := filepath.Abs(root)
+	if err != nil {
+		return filepath.ToSlash(absolute)
+	}
+	relative, err := filepath.Rel(absoluteRoot, absolute)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(absolute)
+	}
+	return filepath.ToSlash(relative)
+}
+
+// String describes the report in one line
+func (r Report) String() string {
+	return fmt.Sprintf("%d files, %d skipped: %d chunks, %d saved, %d failed", r.Files, r.Skipped, r.Chunks, r.Saved, r.Failed)
+}
@@ -0,0 +1,170 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/localrivet/projectmemory/internal/tokenizer"
+)
+
+// wordTokens counts a token per word, so budgets are easy to follow
+type wordTokens struct{}
+
+func (wordTokens) Count(text string) int {
+	return len(strings.Fields(text))
+}
+
+// describe renders chunks as "source section: first words" lines
+func describe(chunks []Chunk) string {
+	lines := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		first, _, _ := strings.Cut(chunk.Text, "\n")
+		lines[i] = fmt.Sprintf("%s %s: %s", chunk.Source(), chunk.Section, first)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestTokenChunker(t *testing.T) {
+	chunker := TokenChunker{MaxTokens: 4, Tokenizer: wordTokens{}}
+	content := "one two\nthree four\n\n\nfive six seven eight nine\nten\n"
+	want := strings.Join([]string{
+		"notes.txt#L1-L2 : one two",
+		"notes.txt#L5-L5 : five six seven eight nine",
+		"notes.txt#L6-L6 : ten",
+	}, "\n")
+	if got := describe(chunker.Chunk("notes.txt", content)); got != want {
+		t.Errorf("Chunk() =\n%s\nwant\n%s", got, want)
+	}
+	if chunks := chunker.Chunk("blank.txt", "\n  \n"); len(chunks) != 0 {
+		t.Errorf("Expected no chunks of blank text, got %+v", chunks)
+	}
+}
+
+func TestHeadingChunker(t *testing.T) {
+	chunker := HeadingChunker{TokenChunker{MaxTokens: 100, Tokenizer: wordTokens{}}}
+	content := strings.Join([]string{
+		"Intro text",
+		"",
+		"# Setup",
+		"Install it.",
+		"```sh",
+		"# not a heading",
+		"```",
+		"## Deploy",
+		"Run make deploy.",
+		"#hashtag is not a heading",
+	}, "\n")
+	want := strings.Join([]string{
+		"README.md#L1-L1 : Intro text",
+		"README.md#L3-L7 Setup: # Setup",
+		"README.md#L8-L10 Deploy: ## Deploy",
+	}, "\n")
+	if got := describe(chunker.Chunk("README.md", content)); got != want {
+		t.Errorf("Chunk() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSymbolChunker(t *testing.T) {
+	chunker := SymbolChunker{TokenChunker{MaxTokens: 100, Tokenizer: wordTokens{}}}
+	content := strings.Join([]string{
+		"package store",
+		"",
+		`import "errors"`,
+		"",
+		"// ErrMissing is returned for missing entries",
+		`var ErrMissing = errors.New("missing")`,
+		"",
+		"// Store holds entries",
+		"type Store[T any] struct{}",
+		"",
+		"// Get returns an entry",
+		"func (s *Store[T]) Get() error {",
+		"	return ErrMissing",
+		"}",
+	}, "\n")
+	want := strings.Join([]string{
+		"store.go#L5-L6 ErrMissing: // ErrMissing is returned for missing entries",
+		"store.go#L8-L9 Store: // Store holds entries",
+		"store.go#L11-L14 Store.Get: // Get returns an entry",
+	}, "\n")
+	if got := describe(chunker.Chunk("store.go", content)); got != want {
+		t.Errorf("Chunk() =\n%s\nwant\n%s", got, want)
+	}
+
+	// Files that do not parse are split by tokens
+	if got := describe(chunker.Chunk("broken.go", "func {")); got != "broken.go#L1-L1 : func {" {
+		t.Errorf("Expected a broken file split by tokens, got %s", got)
+	}
+}
+
+func TestNewChunker(t *testing.T) {
+	chunker, err := NewChunker("", 0, nil)
+	if err != nil {
+		t.Fatalf("NewChunker() failed: %v", err)
+	}
+	if chunks := chunker.Chunk("doc.md", "# Title\ntext"); len(chunks) != 1 || chunks[0].Section != "Title" {
+		t.Errorf("Expected markdown split by headings, got %+v", chunks)
+	}
+	if chunks := chunker.Chunk("main.go", "package main\n\nfunc main() {}\n"); len(chunks) != 1 || chunks[0].Section != "main" {
+		t.Errorf("Expected Go split by symbols, got %+v", chunks)
+	}
+	if _, err := NewChunker("sentences", 0, tokenizer.Approximate{}); !errors.Is(err, ErrUnknownChunker) {
+		t.Errorf("Expected ErrUnknownChunker, got %v", err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"README.md":            "# Project\nIt remembers.\n# Usage\nRun it.\n",
+		"cmd/main.go":          "package main\n\nfunc main() {}\n",
+		"image.png":            "\x89PNG",
+		"data.bin.txt":         "text\x00with a NUL",
+		".git/config":          "[core]",
+		"node_modules/x/a.js":  "module.exports = 1",
+		"notes/unreadable.exe": "MZ",
+	} {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var saved []string
+	save := func(ctx context.Context, chunk Chunk) error {
+		if chunk.Section == "Usage" {
+			return errors.New("summarizer is down")
+		}
+		saved = append(saved, chunk.Source())
+		return nil
+	}
+	report, err := Run(context.Background(), []string{root}, save, Options{Root: root})
+	if err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+	want := Report{Files: 3, Skipped: 1, Chunks: 3, Saved: 2, Failed: 1}
+	if report != want {
+		t.Errorf("Run() = %+v, want %+v", report, want)
+	}
+	if got := strings.Join(saved, " "); got != "README.md#L1-L2 cmd/main.go#L3-L3" {
+		t.Errorf("Expected the chunks saved with their sources, got %s", got)
+	}
+
+	// Files named explicitly are ingested whatever their extension
+	report, err = Run(context.Background(), []string{filepath.Join(root, "image.png")}, save, Options{Root: root, DryRun: true})
+	if err != nil || report.Chunks != 1 || report.Saved != 0 {
+		t.Errorf("Expected a dry run chunking the named file, got %+v, %v", report, err)
+	}
+
+	if _, err := Run(context.Background(), []string{filepath.Join(root, ".git")}, save, Options{}); !errors.Is(err, ErrNoFiles) {
+		t.Errorf("Expected ErrNoFiles, got %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package ingest
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultDebounce is how long a watched file must be left alone before it
+// is reported when WatchOptions.Debounce is 0
+const DefaultDebounce = 2 * time.Second
+
+// DocExtensions are the extensions of the files watched when
+// WatchOptions.Extensions is empty: documentation and decision records
+// rather than code, which changes too often to re-ingest on every save.
+var DocExtensions = []string{".md", ".markdown", ".txt", ".rst", ".adoc"}
+
+// WatchOptions control Watch. The zero value reports documentation files
+// DefaultDebounce after their last change.
+type WatchOptions struct {
+	// Extensions are the extensions of the files reported, DocExtensions
+	// if empty
+	Extensions []string
+
+	// Debounce is how long a file must be left alone after a change
+	// before it is reported, so an editor's burst of writes is reported
+	// once. 0 is DefaultDebounce.
+	Debounce time.Duration
+
+	// Errors, if set, is called with errors of the watcher, such as a
+	// directory that could not be watched. They do not stop Watch.
+	Errors func(error)
+}
+
+// Watch watches the directories and their subdirectories, without hidden
+// directories, dependencies and build output, and calls changed with the
+// path of each file with a watched extension that is written, created,
+// renamed or removed, once it has been left alone for the debounce. A
+// removed file is reported too, so whoever handles it must check whether
+// it still exists. Directories created later are watched as they appear.
+// Watch returns when ctx is done, or with an error if a directory cannot
+// be watched at the start.
+func Watch(ctx context.Context, dirs []string, options WatchOptions, changed func(file string)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	extensions := make(map[string]bool)
+	for _, extension := range options.Extensions {
+		extension = strings.ToLower(strings.TrimSpace(extension))
+		if extension != "" && !strings.HasPrefix(extension, ".") {
+			extension = "." + extension
+		}
+		extensions[extension] = true
+	}
+	if len(options.Extensions) == 0 {
+		for _, extension := range DocExtensions {
+			extensions[extension] = true
+		}
+	}
+	debounce := options.Debounce
+	if debounce <= 0 {
+		debounce = DefaultDebounce
+	}
+	report := func(err error) {
+		if options.Errors != nil {
+			options.Errors(err)
+		}
+	}
+
+	for _, dir := range dirs {
+		if err := watchTree(watcher, dir); err != nil {
+			return err
+		}
+	}
+
+	// Each changed file waits until it has been left alone for the
+	// debounce; a file changed again starts waiting over
+	pending := make(map[string]time.Time)
+	ticker := time.NewTicker(debounce / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if !skippedDir(filepath.Base(event.Name)) {
+						if err := watchTree(watcher, event.Name); err != nil {
+							report(err)
+						}
+					}
+					continue
+				}
+			}
+			if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			if extensions[strings.ToLower(filepath.Ext(event.Name))] {
+				pending[event.Name] = time.Now()
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			report(err)
+		case now := <-ticker.C:
+			for file, last := range pending {
+				if now.Sub(last) >= debounce {
+					delete(pending, file)
+					changed(file)
+				}
+			}
+		}
+	}
+}
+
+// watchTree adds root and the directories under it to watcher, skipping
+// hidden directories, dependencies and build output
+func watchTree(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(dir string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if dir != root && skippedDir(entry.Name()) {
+			return filepath.SkipDir
+		}
+		return watcher.Add(dir)
+	})
+}
+
+// skippedDir reports whether a directory named name is left out of walks
+func skippedDir(name string) bool {
+	return skippedDirs[name] || strings.HasPrefix(name, ".")
+}
@@ -0,0 +1,72 @@
+package ingest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changed := make(chan string, 16)
+	done := make(chan error, 1)
+	go func() {
+		done <- Watch(ctx, []string{dir}, WatchOptions{Debounce: 50 * time.Millisecond}, func(file string) {
+			changed <- file
+		})
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case file := <-changed:
+			if file != want {
+				t.Errorf("Expected %s reported, got %s", want, file)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected %s reported", want)
+		}
+	}
+
+	// A burst of writes is reported once, and code is not watched
+	write("main.go", "package main")
+	for i := 0; i < 3; i++ {
+		write("ADR-1.md", "# Decision\n")
+	}
+	expect(filepath.Join(dir, "ADR-1.md"))
+
+	// Directories created later are watched too
+	if err := os.Mkdir(filepath.Join(dir, "adr"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	write(filepath.Join("adr", "ADR-2.md"), "# Another\n")
+	expect(filepath.Join(dir, "adr", "ADR-2.md"))
+
+	if err := os.Remove(filepath.Join(dir, "ADR-1.md")); err != nil {
+		t.Fatal(err)
+	}
+	expect(filepath.Join(dir, "ADR-1.md"))
+
+	select {
+	case file := <-changed:
+		t.Errorf("Expected nothing more reported, got %s", file)
+	case <-time.After(200 * time.Millisecond):
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Watch() failed: %v", err)
+	}
+}
@@ -0,0 +1,293 @@
+// Package links indexes the files and Go symbols of a repository, and finds
+// those a text mentions, so saved memories can be linked to the code they
+// are about.
+package links
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+)
+
+const (
+	// MaxFiles bounds the files an index holds, so pointing it at a home
+	// directory fails instead of walking it for minutes
+	MaxFiles = 50000
+
+	// maxMatches is the most files or declarations a mention may match
+	// before it counts as too ambiguous to link
+	maxMatches = 5
+)
+
+// ErrTooManyFiles is returned by Build for a repository holding more than
+// MaxFiles files.
+var ErrTooManyFiles = fmt.Errorf("repository holds more than %d files", MaxFiles)
+
+// skippedDirs are directories that hold dependencies or build output rather
+// than the repository's own code. Directories whose names start with a dot
+// are skipped too.
+var skippedDirs = map[string]bool{
+	"vendor":       true,
+	"node_modules": true,
+}
+
+var (
+	// pathPattern matches mentions of files, such as "store.go" or
+	// "internal/contextstore/store.go"
+	pathPattern = regexp.MustCompile(`[\w.-]*[\w-]/[\w./-]*\w|[\w-][\w.-]*\.[A-Za-z0-9]+`)
+
+	// symbolPattern matches identifiers, optionally qualified by a package
+	// or receiver, such as "ReviewStore" or "SQLiteContextStore.Store"
+	symbolPattern = regexp.MustCompile(`[A-Za-z_]\w*(?:\.[A-Za-z_]\w*)*`)
+
+	// codePattern matches spans in backticks, whose identifiers are
+	// linked even when they read like ordinary words
+	codePattern = regexp.MustCompile("`[^`\n]+`")
+)
+
+// Index holds the files of a repository and the Go symbols declared in them
+type Index struct {
+	root string
+
+	// byBase maps each file name to the slash-separated paths of the
+	// files with that name, relative to root
+	byBase map[string][]string
+	files  int
+
+	// symbols maps a symbol's name, "Type.Method" and "package.Name" to
+	// its declarations
+	symbols map[string][]contextstore.Reference
+}
+
+// Build indexes the files under root and the top-level declarations of its
+// Go files. Dependencies, build output and hidden directories are skipped,
+// as are Go files that do not parse.
+func Build(root string) (*Index, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve repository root: %w", err)
+	}
+	index := &Index{
+		root:    root,
+		byBase:  make(map[string][]string),
+		symbols: make(map[string][]contextstore.Reference),
+	}
+
+	fset := token.NewFileSet()
+	err = filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if file != root && (strings.HasPrefix(d.Name(), ".") || skippedDirs[d.Name()]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if index.files == MaxFiles {
+			return ErrTooManyFiles
+		}
+
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		index.byBase[d.Name()] = append(index.byBase[d.Name()], rel)
+		index.files++
+
+		if strings.HasSuffix(rel, ".go") {
+			if parsed, err := parser.ParseFile(fset, file, nil, parser.SkipObjectResolution); err == nil {
+				index.addDeclarations(rel, parsed)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to index %s: %w", root, err)
+	}
+	return index, nil
+}
+
+// addDeclarations indexes the top-level functions, methods, types,
+// constants and variables of a Go file
+func (ix *Index) addDeclarations(file string, parsed *ast.File) {
+	pkg := parsed.Name.Name
+	add := func(name string, keys ...string) {
+		if name == "_" || name == "init" {
+			return
+		}
+		reference := contextstore.Reference{Path: file, Symbol: name}
+		for _, key := range append(keys, name) {
+			ix.symbols[key] = append(ix.symbols[key], reference)
+		}
+	}
+
+	for _, decl := range parsed.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil || len(decl.Recv.List) == 0 {
+				add(decl.Name.Name, pkg+"."+decl.Name.Name)
+				continue
+			}
+			// Methods are also found by their bare name
+			if receiver := receiverName(decl.Recv.List[0].Type); receiver != "" {
+				add(receiver+"."+decl.Name.Name, decl.Name.Name)
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					add(spec.Name.Name, pkg+"."+spec.Name.Name)
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						add(name.Name, pkg+"."+name.Name)
+					}
+				}
+			}
+		}
+	}
+}
+
+// receiverName returns the type name of a method receiver, without its
+// pointer or type parameters
+func receiverName(expr ast.Expr) string {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// Root returns the absolute path of the indexed repository
+func (ix *Index) Root() string {
+	return ix.root
+}
+
+// Files returns the number of indexed files
+func (ix *Index) Files() int {
+	return ix.files
+}
+
+// Resolve returns the indexed files a path names, sorted: the file at an
+// absolute path inside the repository, at a path from its root, or every
+// file whose path ends with it, such as "store.go".
+func (ix *Index) Resolve(name string) []string {
+	if filepath.IsAbs(name) {
+		rel, err := filepath.Rel(ix.root, name)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+		name = rel
+	}
+	name = path.Clean(filepath.ToSlash(name))
+	if name == "." || strings.HasPrefix(name, "../") {
+		return nil
+	}
+
+	var files []string
+	for _, file := range ix.byBase[path.Base(name)] {
+		if file == name || strings.HasSuffix(file, "/"+name) {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// Find returns the references to indexed files and Go symbols that text
+// mentions, sorted. Symbols are linked when qualified, such as
+// "contextstore.Entry", when their names could not be ordinary words, such
+// as "ListEntries", or when they appear in backticks. Mentions matching more
+// than a few files or declarations are left out as ambiguous.
+func (ix *Index) Find(text string) []contextstore.Reference {
+	var references []contextstore.Reference
+
+	for _, mention := range pathPattern.FindAllString(text, -1) {
+		mention = strings.TrimRight(strings.TrimPrefix(mention, "./"), ".")
+		if files := ix.Resolve(mention); len(files) <= maxMatches {
+			for _, file := range files {
+				references = append(references, contextstore.Reference{Path: file})
+			}
+		}
+	}
+
+	code := make(map[string]bool)
+	for _, span := range codePattern.FindAllString(text, -1) {
+		for _, name := range symbolPattern.FindAllString(span, -1) {
+			code[name] = true
+		}
+	}
+	for _, mention := range symbolPattern.FindAllString(text, -1) {
+		references = append(references, ix.findSymbol(mention, code[mention])...)
+	}
+
+	return contextstore.NormalizeReferences(references)
+}
+
+// findSymbol returns the declarations a possibly qualified identifier
+// names. An unknown qualified identifier, such as "s.store.Close", is tried
+// by its last two parts and then its last part.
+func (ix *Index) findSymbol(mention string, quoted bool) []contextstore.Reference {
+	parts := strings.Split(mention, ".")
+	for len(parts) > 1 {
+		if declarations := ix.symbols[strings.Join(parts, ".")]; len(declarations) > 0 {
+			if len(declarations) > maxMatches {
+				return nil
+			}
+			return declarations
+		}
+		if len(parts) > 2 {
+			parts = parts[len(parts)-2:]
+			continue
+		}
+		parts = parts[1:]
+	}
+
+	name := parts[0]
+	if !quoted && !distinctive(name) {
+		return nil
+	}
+	if declarations := ix.symbols[name]; len(declarations) <= maxMatches {
+		return declarations
+	}
+	return nil
+}
+
+// distinctive reports whether an identifier could not be an ordinary word:
+// it mixes cases past its first letter, like "ListEntries", or joins words
+// with underscores
+func distinctive(name string) bool {
+	lower, inner := false, false
+	for i, r := range name {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case i > 0 && (unicode.IsUpper(r) || r == '_'):
+			inner = true
+		}
+	}
+	return lower && inner
+}
@@ -0,0 +1,155 @@
+package links
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+)
+
+// buildRepository writes files to a temporary directory and indexes it
+func buildRepository(t *testing.T, files map[string]string) *Index {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	index, err := Build(root)
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	return index
+}
+
+func TestResolve(t *testing.T) {
+	index := buildRepository(t, map[string]string{
+		"internal/contextstore/store.go": "package contextstore\n",
+		"internal/cache/store.go":        "package cache\n",
+		"README.md":                      "# Project\n",
+		"vendor/lib/store.go":            "package lib\n",
+		".git/config":                    "",
+	})
+
+	tests := []struct {
+		name string
+		path string
+		want []string
+	}{
+		{"file name", "store.go", []string{"internal/cache/store.go", "internal/contextstore/store.go"}},
+		{"trailing path", "contextstore/store.go", []string{"internal/contextstore/store.go"}},
+		{"relative path", "./internal/contextstore/store.go", []string{"internal/contextstore/store.go"}},
+		{"absolute path", filepath.Join(index.Root(), "README.md"), []string{"README.md"}},
+		{"partial file name", "ore.go", nil},
+		{"outside root", "../store.go", nil},
+		{"skipped directory", "lib/store.go", nil},
+		{"hidden directory", ".git/config", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := index.Resolve(test.path); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Resolve(%q) = %v, want %v", test.path, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	index := buildRepository(t, map[string]string{
+		"internal/contextstore/store.go": `package contextstore
+
+type ContextStore interface{}
+
+type Entry struct{}
+
+func NormalizeTags(tags []string) []string { return tags }
+`,
+		"internal/contextstore/sqlite_store.go": `package contextstore
+
+type SQLiteContextStore struct{}
+
+func (s *SQLiteContextStore) Store() error { return nil }
+
+func (s *SQLiteContextStore) Close() error { return nil }
+`,
+		"internal/server/server.go": `package server
+
+func (s *Server) Close() error { return nil }
+
+func init() {}
+`,
+		"broken.go": "package broken\n\nfunc Broken(",
+	})
+
+	store := "internal/contextstore/store.go"
+	sqlite := "internal/contextstore/sqlite_store.go"
+	tests := []struct {
+		name string
+		text string
+		want []contextstore.Reference
+	}{
+		{
+			name: "file path",
+			text: "The schema lives in contextstore/store.go.",
+			want: []contextstore.Reference{{Path: store}},
+		},
+		{
+			name: "distinctive symbol",
+			text: "Tags go through NormalizeTags before they are stored",
+			want: []contextstore.Reference{{Path: store, Symbol: "NormalizeTags"}},
+		},
+		{
+			name: "ordinary word",
+			text: "Every Entry is embedded before it is stored",
+		},
+		{
+			name: "quoted symbol",
+			text: "Every `Entry` is embedded before it is stored",
+			want: []contextstore.Reference{{Path: store, Symbol: "Entry"}},
+		},
+		{
+			name: "qualified symbol",
+			text: "contextstore.Entry holds the summary",
+			want: []contextstore.Reference{{Path: store, Symbol: "Entry"}},
+		},
+		{
+			name: "method",
+			text: "SQLiteContextStore.Store wraps the insert in a transaction",
+			want: []contextstore.Reference{{Path: sqlite, Symbol: "SQLiteContextStore.Store"}},
+		},
+		{
+			name: "method through a field",
+			text: "call `s.store.Close` on shutdown",
+			want: []contextstore.Reference{
+				{Path: sqlite, Symbol: "SQLiteContextStore.Close"},
+				{Path: "internal/server/server.go", Symbol: "Server.Close"},
+			},
+		},
+		{
+			name: "unknown names",
+			text: "Use `Frobnicate` and FooBar in widget.go",
+		},
+		{
+			name: "init functions",
+			text: "The `init` hook registers nothing",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := index.Find(test.text)
+			if (len(got) != 0 || len(test.want) != 0) && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Find(%q) = %v, want %v", test.text, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,388 @@
+// Package regenerate re-runs summarization and embedding for stored entries
+// whose summaries were written a certain way, such as by the basic fallback
+// while the AI provider was down. The store keeps summaries rather than the
+// text they were written from, so each entry's stored text is summarized
+// again: a verbatim entry gets its first real summary, while a summary is
+// only condensed further.
+package regenerate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/summarizer"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+// DefaultBatchSize is the number of entries regenerated between checkpoints
+// when Options.BatchSize is 0
+const DefaultBatchSize = 20
+
+// NoGeneration is the filter value matching entries with no recorded
+// generation, such as entries saved before generations were recorded
+const NoGeneration = "none"
+
+var (
+	// ErrEmptyFilter is returned for a filter that matches nothing in
+	// particular. Use "all" to regenerate every entry.
+	ErrEmptyFilter = errors.New("filter is empty; use \"all\" to regenerate every entry")
+
+	// ErrInvalidFilter is returned for a filter that cannot be parsed
+	ErrInvalidFilter = errors.New("invalid filter")
+
+	// ErrStateMismatch is returned when the state file was written for a
+	// different filter
+	ErrStateMismatch = errors.New("state file was written for a different filter")
+)
+
+// Filter selects entries by the generation of their summaries. Empty fields
+// match anything; All matches every entry.
+type Filter struct {
+	All bool
+
+	// Summarizer is the kind of summarizer that wrote the summary, such as
+	// "ai", "basic" or "verbatim", or NoGeneration.
+	Summarizer    string
+	Provider      string
+	Model         string
+	PromptVersion string
+}
+
+// ParseFilter parses "all" or comma-separated key=value pairs, such as
+// "summarizer=basic" or "provider=openai,model=gpt-4o-mini". The keys are
+// summarizer, provider, model and prompt_version.
+func ParseFilter(s string) (Filter, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Filter{}, ErrEmptyFilter
+	}
+	if s == "all" {
+		return Filter{All: true}, nil
+	}
+
+	var filter Filter
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || value == "" {
+			return Filter{}, fmt.Errorf("%w: %q is not key=value", ErrInvalidFilter, pair)
+		}
+		var field *string
+		switch key {
+		case "summarizer":
+			field = &filter.Summarizer
+		case "provider":
+			field = &filter.Provider
+		case "model":
+			field = &filter.Model
+		case "prompt_version":
+			field = &filter.PromptVersion
+		default:
+			return Filter{}, fmt.Errorf("%w: unknown key %q", ErrInvalidFilter, key)
+		}
+		if *field != "" {
+			return Filter{}, fmt.Errorf("%w: %q is given twice", ErrInvalidFilter, key)
+		}
+		*field = value
+	}
+	if filter.Summarizer == NoGeneration && (filter.Provider != "" || filter.Model != "" || filter.PromptVersion != "") {
+		return Filter{}, fmt.Errorf("%w: summarizer=%s cannot be combined with other keys", ErrInvalidFilter, NoGeneration)
+	}
+	return filter, nil
+}
+
+// Matches reports whether an entry with the given generation is selected
+func (f Filter) Matches(generation contextstore.Generation) bool {
+	if f.All {
+		return true
+	}
+	if f.Summarizer == NoGeneration {
+		return generation.IsZero()
+	}
+	return matchField(f.Summarizer, generation.Summarizer) &&
+		matchField(f.Provider, generation.Provider) &&
+		matchField(f.Model, generation.Model) &&
+		matchField(f.PromptVersion, generation.PromptVersion)
+}
+
+// String returns the filter in the form ParseFilter reads
+func (f Filter) String() string {
+	if f.All {
+		return "all"
+	}
+	var pairs []string
+	for _, pair := range [][2]string{
+		{"summarizer", f.Summarizer},
+		{"provider", f.Provider},
+		{"model", f.Model},
+		{"prompt_version", f.PromptVersion},
+	} {
+		if pair[1] != "" {
+			pairs = append(pairs, pair[0]+"="+pair[1])
+		}
+	}
+	return strings.Join(pairs, ",")
+}
+
+func matchField(want, got string) bool {
+	return want == "" || strings.EqualFold(want, got)
+}
+
+// Options control a run. Only Filter is required.
+type Options struct {
+	Filter Filter
+
+	// BatchSize is the number of entries regenerated between checkpoints.
+	// 0 means DefaultBatchSize.
+	BatchSize int
+
+	// Interval is how long to wait between batches, to stay within the
+	// providers' rate limits.
+	Interval time.Duration
+
+	// StatePath is a file recording which entries are done. A run that
+	// finds it skips them, so an interrupted run can be resumed; a
+	// completed run removes it. Empty means runs are not resumable.
+	StatePath string
+
+	// DryRun counts the matching entries without changing them.
+	DryRun bool
+
+	// Progress, if set, is called after each batch.
+	Progress func(Progress)
+}
+
+// Progress counts the entries of a run
+type Progress struct {
+	// Total is the number of entries matching the filter, including those
+	// done by an earlier run.
+	Total int
+
+	// Done is the number of entries handled so far, including those done
+	// by an earlier run.
+	Done int
+
+	// Regenerated entries have a new summary and embedding. Skipped
+	// entries were refused by the summarizer's providers and kept as they
+	// were. Failed entries could not be summarized or embedded; they are
+	// not recorded as done, so a resumed run retries them.
+	Regenerated int
+	Skipped     int
+	Failed      int
+}
+
+// state is the content of the state file
+type state struct {
+	Filter string   `json:"filter"`
+	Done   []string `json:"done"`
+}
+
+// Run regenerates the summary and embedding of every entry in store that
+// matches options.Filter, keeping the entries' IDs and timestamps. Entries
+// are handled oldest first, in batches of options.BatchSize, with the state
+// file written after each one. Errors summarizing or embedding an entry are
+// counted in the progress; store errors and cancellation of ctx stop the
+// run. It returns contextstore.ErrUsageUnsupported if the store cannot list
+// its entries.
+func Run(ctx context.Context, store contextstore.ContextStore, summaries summarizer.Summarizer, embedder vector.Embedder, options Options) (Progress, error) {
+	lister, ok := store.(contextstore.UsageStore)
+	if !ok {
+		return Progress{}, contextstore.ErrUsageUnsupported
+	}
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	done, err := loadState(options.StatePath, options.Filter)
+	if err != nil {
+		return Progress{}, err
+	}
+
+	entries, err := lister.ListEntries()
+	if err != nil {
+		return Progress{}, fmt.Errorf("failed to list entries: %w", err)
+	}
+	var progress Progress
+	var pending []contextstore.Entry
+	for _, entry := range entries {
+		switch {
+		case done[entry.ID]:
+			progress.Total++
+			progress.Done++
+		case options.Filter.Matches(entry.Generation):
+			progress.Total++
+			pending = append(pending, entry)
+		}
+	}
+	if options.DryRun {
+		return progress, nil
+	}
+
+	for start := 0; start < len(pending); start += batchSize {
+		if start > 0 && options.Interval > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(options.Interval):
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return progress, err
+		}
+
+		batch := pending[start:min(start+batchSize, len(pending))]
+		for _, entry := range batch {
+			outcome, err := regenerate(ctx, store, summaries, embedder, entry)
+			if err != nil {
+				saveErr := saveState(options.StatePath, options.Filter, done)
+				return progress, errors.Join(err, saveErr)
+			}
+			switch outcome {
+			case regenerated:
+				progress.Regenerated++
+			case skipped:
+				progress.Skipped++
+			case failed:
+				progress.Failed++
+				continue
+			}
+			progress.Done++
+			done[entry.ID] = true
+		}
+
+		if err := saveState(options.StatePath, options.Filter, done); err != nil {
+			return progress, err
+		}
+		if options.Progress != nil {
+			options.Progress(progress)
+		}
+	}
+
+	if progress.Failed == 0 && options.StatePath != "" {
+		if err := os.Remove(options.StatePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return progress, fmt.Errorf("failed to remove state file: %w", err)
+		}
+	}
+	return progress, nil
+}
+
+// outcome is what happened to one entry
+type outcome int
+
+const (
+	regenerated outcome = iota
+	skipped
+	failed
+)
+
+// regenerate summarizes, titles and embeds the stored text of entry and
+// replaces the entry with the result. Only store errors are returned.
+func regenerate(ctx context.Context, store contextstore.ContextStore, summaries summarizer.Summarizer, embedder vector.Embedder, entry contextstore.Entry) (outcome, error) {
+	written, err := summarizer.SummarizeWithTitle(ctx, summaries, entry.SummaryText, 0)
+	summary, generation := written.Text, written.Generation
+	if errors.Is(err, summarizer.ErrContentFiltered) {
+		return skipped, nil
+	}
+	if err == nil && strings.TrimSpace(summary) == "" {
+		err = summarizer.ErrEmptySummary
+	}
+	if err != nil {
+		return failed, nil
+	}
+
+	// A fallback embedding would not be comparable with the rest of the
+	// index, so the entry is left for a later run
+	embedding, err := vector.CreateEmbeddingContext(ctx, embedder, summary)
+	if err != nil || embedding.Fallback {
+		return failed, nil
+	}
+	embeddingBytes, err := vector.Float32SliceToBytes(embedding.Vector)
+	if err != nil {
+		return failed, nil
+	}
+
+	if err := store.Replace(entry.ID, summary, embeddingBytes, entry.Timestamp); err != nil {
+		return failed, fmt.Errorf("failed to replace entry %s: %w", entry.ID, err)
+	}
+	if generations, ok := store.(contextstore.GenerationStore); ok && generation != (summarizer.Generation{}) {
+		if err := generations.SetGeneration(entry.ID, contextstore.Generation(generation)); err != nil {
+			return failed, fmt.Errorf("failed to record generation of entry %s: %w", entry.ID, err)
+		}
+	}
+	if titles, ok := store.(contextstore.TitleStore); ok && written.Title != "" {
+		if err := titles.SetTitle(entry.ID, written.Title); err != nil {
+			return failed, fmt.Errorf("failed to record title of entry %s: %w", entry.ID, err)
+		}
+	}
+	return regenerated, nil
+}
+
+// loadState returns the IDs recorded as done in the state file at path, or
+// none if there is no state file
+func loadState(path string, filter Filter) (map[string]bool, error) {
+	done := make(map[string]bool)
+	if path == "" {
+		return done, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	var saved state
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("failed to parse state file: %w", err)
+	}
+	if saved.Filter != filter.String() {
+		return nil, fmt.Errorf("%w: %q", ErrStateMismatch, saved.Filter)
+	}
+	for _, id := range saved.Done {
+		done[id] = true
+	}
+	return done, nil
+}
+
+// saveState writes the state file next to its final name and renames it
+// into place, so an interrupted write leaves the previous state
+func saveState(path string, filter Filter, done map[string]bool) error {
+	if path == "" {
+		return nil
+	}
+	saved := state{Filter: filter.String(), Done: make([]string, 0, len(done))}
+	for id := range done {
+		saved.Done = append(saved.Done, id)
+	}
+	slices.Sort(saved.Done)
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+	return nil
+}
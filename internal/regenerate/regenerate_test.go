@@ -0,0 +1,263 @@
+package regenerate
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/summarizer"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Filter
+		wantErr error
+	}{
+		{"all", Filter{All: true}, nil},
+		{"summarizer=basic", Filter{Summarizer: "basic"}, nil},
+		{" provider=openai , model=gpt-4o-mini ", Filter{Provider: "openai", Model: "gpt-4o-mini"}, nil},
+		{"summarizer=none", Filter{Summarizer: NoGeneration}, nil},
+		{"", Filter{}, ErrEmptyFilter},
+		{"basic", Filter{}, ErrInvalidFilter},
+		{"summarizer=", Filter{}, ErrInvalidFilter},
+		{"colour=red", Filter{}, ErrInvalidFilter},
+		{"model=a,model=b", Filter{}, ErrInvalidFilter},
+		{"summarizer=none,model=a", Filter{}, ErrInvalidFilter},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			got, err := ParseFilter(test.input)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("ParseFilter(%q) error = %v, want %v", test.input, err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("ParseFilter(%q) = %+v, want %+v", test.input, got, test.want)
+			}
+			if err == nil {
+				if again, err := ParseFilter(got.String()); err != nil || again != got {
+					t.Errorf("ParseFilter(%q) = %+v, %v; want %+v", got.String(), again, err, got)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterMatches(t *testing.T) {
+	basic := contextstore.Generation{Summarizer: "basic"}
+	ai := contextstore.Generation{Summarizer: "ai", Provider: "openai", Model: "gpt-4o-mini", PromptVersion: "default"}
+
+	tests := []struct {
+		filter     Filter
+		generation contextstore.Generation
+		want       bool
+	}{
+		{Filter{All: true}, contextstore.Generation{}, true},
+		{Filter{Summarizer: "basic"}, basic, true},
+		{Filter{Summarizer: "basic"}, ai, false},
+		{Filter{Summarizer: "basic"}, contextstore.Generation{}, false},
+		{Filter{Provider: "OpenAI"}, ai, true},
+		{Filter{Provider: "openai", Model: "gpt-4o"}, ai, false},
+		{Filter{Summarizer: NoGeneration}, contextstore.Generation{}, true},
+		{Filter{Summarizer: NoGeneration}, basic, false},
+	}
+
+	for _, test := range tests {
+		if got := test.filter.Matches(test.generation); got != test.want {
+			t.Errorf("%q.Matches(%+v) = %v, want %v", test.filter, test.generation, got, test.want)
+		}
+	}
+}
+
+// fakeSummarizer reports AI generations and fails or refuses texts
+// containing "fail" or "refuse"
+type fakeSummarizer struct {
+	calls int
+}
+
+func (f *fakeSummarizer) Initialize() error { return nil }
+
+func (f *fakeSummarizer) Summarize(ctx context.Context, text string) (string, error) {
+	summary, _, err := f.SummarizeWithGeneration(ctx, text, 0)
+	return summary, err
+}
+
+func (f *fakeSummarizer) SummarizeWithGeneration(_ context.Context, text string, _ int) (string, summarizer.Generation, error) {
+	f.calls++
+	switch {
+	case strings.Contains(text, "fail"):
+		return "", summarizer.Generation{}, errors.New("provider unavailable")
+	case strings.Contains(text, "refuse"):
+		return "", summarizer.Generation{}, summarizer.ErrContentFiltered
+	}
+	return "AI: " + text, summarizer.Generation{Summarizer: summarizer.GeneratedByAI, Provider: "openai", Model: "gpt-4o-mini", PromptVersion: summarizer.DefaultPromptVersion}, nil
+}
+
+func newStore(t *testing.T, generations map[string]string) *contextstore.MemoryContextStore {
+	t.Helper()
+	store := contextstore.NewMemoryContextStore()
+	embedder := vector.NewMockEmbedder(8)
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	for i, id := range []string{"a", "b", "c", "d", "e"} {
+		text := "entry " + id
+		if id == "d" {
+			text = "please fail"
+		}
+		embedding, err := embedder.CreateEmbedding(text)
+		if err != nil {
+			t.Fatalf("Failed to embed: %v", err)
+		}
+		embeddingBytes, err := vector.Float32SliceToBytes(embedding)
+		if err != nil {
+			t.Fatalf("Failed to encode embedding: %v", err)
+		}
+		if err := store.Store(id, text, embeddingBytes, start.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatalf("Failed to store entry: %v", err)
+		}
+		if generations[id] != "" {
+			if err := store.SetGeneration(id, contextstore.Generation{Summarizer: generations[id]}); err != nil {
+				t.Fatalf("Failed to set generation: %v", err)
+			}
+		}
+	}
+	return store
+}
+
+func TestRun(t *testing.T) {
+	store := newStore(t, map[string]string{"a": "basic", "b": "ai", "c": "basic", "d": "basic"})
+	before, err := store.ListEntries()
+	if err != nil {
+		t.Fatalf("Failed to list entries: %v", err)
+	}
+	summaries := &fakeSummarizer{}
+	options := Options{Filter: Filter{Summarizer: "basic"}, BatchSize: 2}
+
+	dryRun := options
+	dryRun.DryRun = true
+	progress, err := Run(context.Background(), store, summaries, vector.NewMockEmbedder(8), dryRun)
+	if err != nil {
+		t.Fatalf("Run(dry run) error = %v", err)
+	}
+	if progress != (Progress{Total: 3}) || summaries.calls != 0 {
+		t.Errorf("Run(dry run) = %+v after %d summarizer calls, want 3 entries and no calls", progress, summaries.calls)
+	}
+
+	var batches []Progress
+	options.Progress = func(progress Progress) { batches = append(batches, progress) }
+	progress, err = Run(context.Background(), store, summaries, vector.NewMockEmbedder(8), options)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	want := Progress{Total: 3, Done: 2, Regenerated: 2, Failed: 1}
+	if progress != want {
+		t.Errorf("Run() = %+v, want %+v", progress, want)
+	}
+	if len(batches) != 2 || batches[0].Done != 2 {
+		t.Errorf("Progress reported %+v, want 2 batches with the first one done", batches)
+	}
+
+	after, err := store.ListEntries()
+	if err != nil {
+		t.Fatalf("Failed to list entries: %v", err)
+	}
+	for i, entry := range after {
+		old := before[i]
+		if entry.ID != old.ID || !entry.Timestamp.Equal(old.Timestamp) {
+			t.Fatalf("Entry %s at %v replaced %s at %v", entry.ID, entry.Timestamp, old.ID, old.Timestamp)
+		}
+		regenerated := entry.ID == "a" || entry.ID == "c"
+		if got := entry.SummaryText == "AI: "+old.SummaryText; got != regenerated {
+			t.Errorf("Entry %s summary = %q, regenerated = %v, want %v", entry.ID, entry.SummaryText, got, regenerated)
+		}
+		if regenerated && entry.Generation.Summarizer != summarizer.GeneratedByAI {
+			t.Errorf("Entry %s generation = %+v, want an AI generation", entry.ID, entry.Generation)
+		}
+		if regenerated && equalEmbeddings(entry.Embedding, old.Embedding) {
+			t.Errorf("Entry %s kept its old embedding", entry.ID)
+		}
+	}
+}
+
+func TestRunResumes(t *testing.T) {
+	store := newStore(t, nil)
+	statePath := filepath.Join(t.TempDir(), "regenerate.json")
+	summaries := &fakeSummarizer{}
+	options := Options{Filter: Filter{Summarizer: NoGeneration}, BatchSize: 2, StatePath: statePath}
+
+	// Cancel after the first batch
+	ctx, cancel := context.WithCancel(context.Background())
+	options.Progress = func(Progress) { cancel() }
+	progress, err := Run(ctx, store, summaries, vector.NewMockEmbedder(8), options)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run() error = %v, want context.Canceled", err)
+	}
+	if progress.Done != 2 || summaries.calls != 2 {
+		t.Fatalf("Run() = %+v after %d summarizer calls, want 2 done", progress, summaries.calls)
+	}
+	if _, err := os.Stat(statePath); err != nil {
+		t.Fatalf("State file not written: %v", err)
+	}
+
+	other := options
+	other.Filter = Filter{All: true}
+	if _, err := Run(context.Background(), store, summaries, vector.NewMockEmbedder(8), other); !errors.Is(err, ErrStateMismatch) {
+		t.Errorf("Run() with another filter error = %v, want ErrStateMismatch", err)
+	}
+
+	// The regenerated entries now have generations, so only the state file
+	// keeps them in the total
+	options.Progress = nil
+	progress, err = Run(context.Background(), store, summaries, vector.NewMockEmbedder(8), options)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	want := Progress{Total: 5, Done: 4, Regenerated: 2, Failed: 1}
+	if progress != want || summaries.calls != 5 {
+		t.Errorf("Run() = %+v after %d summarizer calls, want %+v after 5", progress, summaries.calls, want)
+	}
+	if _, err := os.Stat(statePath); err != nil {
+		t.Errorf("State file removed with an entry failed: %v", err)
+	}
+}
+
+func TestRunSkipsRefusedEntries(t *testing.T) {
+	store := contextstore.NewMemoryContextStore()
+	embedding, err := vector.Float32SliceToBytes([]float32{1, 0})
+	if err != nil {
+		t.Fatalf("Failed to encode embedding: %v", err)
+	}
+	if err := store.Store("x", "refuse this", embedding, time.Now()); err != nil {
+		t.Fatalf("Failed to store entry: %v", err)
+	}
+	statePath := filepath.Join(t.TempDir(), "regenerate.json")
+
+	progress, err := Run(context.Background(), store, &fakeSummarizer{}, vector.NewMockEmbedder(8), Options{Filter: Filter{All: true}, StatePath: statePath})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if progress != (Progress{Total: 1, Done: 1, Skipped: 1}) {
+		t.Errorf("Run() = %+v, want 1 skipped", progress)
+	}
+	if _, err := os.Stat(statePath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("State file kept after a complete run: %v", err)
+	}
+}
+
+func equalEmbeddings(a, b []float32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
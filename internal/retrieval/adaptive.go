@@ -0,0 +1,65 @@
+// Package retrieval post-processes ranked search results before they are
+// returned to MCP clients.
+package retrieval
+
+const (
+	// AdaptiveMaxFactor bounds adaptive retrieval to this many times the
+	// requested limit when scores are flat.
+	AdaptiveMaxFactor = 2
+
+	// AdaptiveCliffGap is the smallest drop in similarity between two
+	// neighbouring results that counts as a relevance cliff.
+	AdaptiveCliffGap = 0.1
+
+	// AdaptiveCliffShare is the smallest share of the total score spread a
+	// single drop must account for to count as a relevance cliff.
+	AdaptiveCliffShare = 0.5
+
+	// AdaptiveFlatSpread is the largest spread between the best and worst
+	// candidate for which scores are considered flat.
+	AdaptiveFlatSpread = 0.05
+)
+
+// AdaptiveLimit chooses how many of the candidates to return instead of
+// always returning exactly limit. similarities must be sorted from most to
+// least similar and should hold up to limit*AdaptiveMaxFactor candidates.
+//
+// When there is a sharp relevance cliff, only the results above it are kept,
+// even if that is fewer than limit. When the scores are flat, so no result is
+// clearly better than the next, every candidate is kept. Otherwise limit
+// results are kept. At least one result is always returned if any exist.
+func AdaptiveLimit(similarities []float64, limit int) int {
+	if limit <= 0 || len(similarities) == 0 {
+		return 0
+	}
+
+	maxResults := limit * AdaptiveMaxFactor
+	if maxResults > len(similarities) {
+		maxResults = len(similarities)
+	}
+	candidates := similarities[:maxResults]
+	if len(candidates) == 1 {
+		return 1
+	}
+
+	spread := candidates[0] - candidates[len(candidates)-1]
+	if spread <= AdaptiveFlatSpread {
+		return len(candidates)
+	}
+
+	// Find the largest drop between neighbouring candidates
+	cliff, cliffGap := 0, 0.0
+	for i := 0; i < len(candidates)-1; i++ {
+		if gap := candidates[i] - candidates[i+1]; gap > cliffGap {
+			cliff, cliffGap = i+1, gap
+		}
+	}
+	if cliffGap >= AdaptiveCliffGap && cliffGap >= spread*AdaptiveCliffShare {
+		return cliff
+	}
+
+	if limit > len(candidates) {
+		return len(candidates)
+	}
+	return limit
+}
@@ -0,0 +1,31 @@
+package retrieval
+
+import "testing"
+
+func TestAdaptiveLimit(t *testing.T) {
+	tests := []struct {
+		name         string
+		similarities []float64
+		limit        int
+		want         int
+	}{
+		{"no candidates", nil, 5, 0},
+		{"zero limit", []float64{0.9, 0.8}, 0, 0},
+		{"single candidate", []float64{0.9}, 5, 1},
+		{"sharp cliff after first", []float64{0.92, 0.41, 0.40, 0.38, 0.37, 0.35}, 3, 1},
+		{"sharp cliff past limit", []float64{0.90, 0.89, 0.88, 0.87, 0.50, 0.49}, 3, 4},
+		{"flat scores", []float64{0.71, 0.70, 0.70, 0.69, 0.69, 0.68}, 3, 6},
+		{"flat scores fewer than max", []float64{0.71, 0.70, 0.70}, 3, 3},
+		{"gradual decline", []float64{0.9, 0.8, 0.7, 0.6, 0.5, 0.4}, 3, 3},
+		{"only max candidates considered", []float64{0.70, 0.70, 0.69, 0.69, 0.1}, 2, 4},
+		{"small drop is not a cliff", []float64{0.50, 0.44, 0.43, 0.42, 0.41, 0.40}, 3, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := AdaptiveLimit(test.similarities, test.limit); got != test.want {
+				t.Errorf("AdaptiveLimit(%v, %d) = %d, want %d", test.similarities, test.limit, got, test.want)
+			}
+		})
+	}
+}
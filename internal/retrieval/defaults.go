@@ -0,0 +1,61 @@
+package retrieval
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Errors returned by Defaults.Validate
+var (
+	ErrInvalidLimit           = errors.New("limit must not be negative")
+	ErrInvalidMinScore        = errors.New("min_score must be between 0 and 1")
+	ErrInvalidRecencyHalfLife = errors.New("recency_half_life must not be negative")
+	ErrInvalidRecencyFloor    = errors.New("recency_floor must be between 0 and 1")
+	ErrInvalidHybridWeights   = errors.New("hybrid weights must not be negative")
+)
+
+// Defaults are the retrieval settings a namespace uses when a request does
+// not set them. Zero values leave the server-wide default in place.
+type Defaults struct {
+	// Limit is the number of results returned when a request sets none
+	Limit int
+
+	// MinScore drops results less similar to the query than this
+	MinScore float64
+
+	// RecencyHalfLife is the age at which recency ranking halves an
+	// entry's weight
+	RecencyHalfLife time.Duration
+
+	// RecencyFloor is the share of an entry's ranking score that recency
+	// ranking keeps however old the entry is, between 0 and 1. 0 lets the
+	// score of old entries fall towards 0.
+	RecencyFloor float64
+
+	// HybridWeights balances vector and keyword scores in hybrid ranking
+	HybridWeights HybridWeights
+}
+
+// HybridWeights are the relative weights of vector and keyword scores
+type HybridWeights struct {
+	Vector  float64
+	Keyword float64
+}
+
+// Validate reports the first setting that is out of range
+func (d Defaults) Validate() error {
+	switch {
+	case d.Limit < 0:
+		return fmt.Errorf("%w: %d", ErrInvalidLimit, d.Limit)
+	case d.MinScore < 0 || d.MinScore > 1:
+		return fmt.Errorf("%w: %v", ErrInvalidMinScore, d.MinScore)
+	case d.RecencyHalfLife < 0:
+		return fmt.Errorf("%w: %v", ErrInvalidRecencyHalfLife, d.RecencyHalfLife)
+	case d.RecencyFloor < 0 || d.RecencyFloor > 1:
+		return fmt.Errorf("%w: %v", ErrInvalidRecencyFloor, d.RecencyFloor)
+	case d.HybridWeights.Vector < 0 || d.HybridWeights.Keyword < 0:
+		return fmt.Errorf("%w: vector %v, keyword %v", ErrInvalidHybridWeights, d.HybridWeights.Vector, d.HybridWeights.Keyword)
+	}
+	return nil
+}
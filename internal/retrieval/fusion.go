@@ -0,0 +1,44 @@
+package retrieval
+
+import "sort"
+
+// FusionConstant is the k of reciprocal rank fusion, damping the weight of
+// the top ranks so one ranking cannot outvote several agreeing ones.
+const FusionConstant = 60
+
+// FuseRanks merges rankings of items, each best first, by reciprocal rank
+// fusion: an item scores 1/(FusionConstant+rank) in each ranking it is in,
+// ranks counted from 1, and the scores are summed. It returns every item
+// once, by falling fused score, in the order first seen on ties, and the
+// fused score of each.
+func FuseRanks(rankings [][]string) ([]string, []float64) {
+	var keys []string
+	index := make(map[string]int)
+	var scores []float64
+	for _, ranking := range rankings {
+		for rank, key := range ranking {
+			i, ok := index[key]
+			if !ok {
+				i = len(keys)
+				index[key] = i
+				keys = append(keys, key)
+				scores = append(scores, 0)
+			}
+			scores[i] += 1 / float64(FusionConstant+rank+1)
+		}
+	}
+
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] > scores[order[j]]
+	})
+	fused := make([]string, len(order))
+	fusedScores := make([]float64, len(order))
+	for i, o := range order {
+		fused[i], fusedScores[i] = keys[o], scores[o]
+	}
+	return fused, fusedScores
+}
@@ -0,0 +1,43 @@
+package retrieval
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestFuseRanks(t *testing.T) {
+	tests := []struct {
+		name     string
+		rankings [][]string
+		want     []string
+	}{
+		{"no rankings", nil, nil},
+		{"one ranking", [][]string{{"a", "b", "c"}}, []string{"a", "b", "c"}},
+		{"agreement beats one top rank", [][]string{{"a", "b"}, {"c", "b"}, {"d", "b"}}, []string{"b", "a", "c", "d"}},
+		{"ties keep first seen", [][]string{{"a", "b"}, {"b", "a"}}, []string{"a", "b"}},
+		{"disjoint rankings interleave", [][]string{{"a", "b"}, {"c", "d"}}, []string{"a", "c", "b", "d"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, _ := FuseRanks(test.rankings)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("FuseRanks(%v) = %v, want %v", test.rankings, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFuseRanksScores(t *testing.T) {
+	keys, scores := FuseRanks([][]string{{"a", "b"}, {"b"}})
+	want := map[string]float64{
+		"a": 1.0 / 61,
+		"b": 1.0/62 + 1.0/61,
+	}
+	for i, key := range keys {
+		if math.Abs(scores[i]-want[key]) > 1e-12 {
+			t.Errorf("score of %s = %v, want %v", key, scores[i], want[key])
+		}
+	}
+}
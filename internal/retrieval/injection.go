@@ -0,0 +1,142 @@
+package retrieval
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// InjectionMode selects what happens to retrieved summaries holding what
+// looks like instructions to the agent reading them.
+type InjectionMode string
+
+const (
+	// InjectionOff returns summaries as stored, the default.
+	InjectionOff InjectionMode = "off"
+
+	// InjectionDetect counts and logs suspected instructions but returns
+	// summaries as stored.
+	InjectionDetect InjectionMode = "detect"
+
+	// InjectionScrub replaces each sentence holding a suspected instruction
+	// with InjectionPlaceholder.
+	InjectionScrub InjectionMode = "scrub"
+)
+
+// InjectionPlaceholder replaces scrubbed instructions, so the agent sees
+// that something was removed.
+const InjectionPlaceholder = "[removed: possible prompt injection]"
+
+// ErrUnknownInjectionMode is returned by ParseInjectionMode for a name that
+// is not an InjectionMode.
+var ErrUnknownInjectionMode = errors.New("unknown injection mode")
+
+// ParseInjectionMode returns the InjectionMode named by s. An empty s is
+// InjectionOff.
+func ParseInjectionMode(s string) (InjectionMode, error) {
+	switch mode := InjectionMode(strings.ToLower(strings.TrimSpace(s))); mode {
+	case "":
+		return InjectionOff, nil
+	case InjectionOff, InjectionDetect, InjectionScrub:
+		return mode, nil
+	}
+	return "", fmt.Errorf("%w %q: want %q, %q or %q", ErrUnknownInjectionMode, s, InjectionOff, InjectionDetect, InjectionScrub)
+}
+
+// injectionPatterns match the phrasing and markup of common prompt
+// injections. They favour precision: a summary that merely discusses
+// instructions should not lose sentences.
+var injectionPatterns = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"ignore_instructions", regexp.MustCompile(`(?i)\b(ignore|disregard|forget|override|bypass)\b[^.!?\n]{0,40}?\b(previous|prior|above|earlier|preceding|all|any|your|the system)\b[^.!?\n]{0,20}?\b(instructions?|prompts?|rules|directions|guidelines)\b`)},
+	{"role_override", regexp.MustCompile(`(?i)\b(you are now|from now on,? you (are|will|must|should)|pretend (to be|you are)|act as an? (unrestricted|unfiltered|jailbroken))\b`)},
+	{"new_instructions", regexp.MustCompile(`(?i)\b(new|updated|real|actual|additional) (system )?instructions?\s*:`)},
+	{"prompt_exfiltration", regexp.MustCompile(`(?i)\b(reveal|print|show|output|repeat|leak)\b[^.!?\n]{0,30}?\b(system prompt|hidden instructions|your instructions)\b`)},
+	{"role_header", regexp.MustCompile(`(?im)^[ \t]*(system|assistant|developer)[ \t]*:`)},
+	{"chat_template", regexp.MustCompile(`<\|(im_start|im_end|system|user|assistant|endoftext)\|>|\[/?INST\]|<</?SYS>>`)},
+	{"instruction_tag", regexp.MustCompile(`(?i)</?\s*(system|instructions?)\s*>`)},
+}
+
+// Injection is a suspected instruction found in a summary
+type Injection struct {
+	// Start and End delimit the sentence holding the instruction
+	Start, End int
+
+	// Patterns name the patterns that matched in the sentence
+	Patterns []string
+}
+
+// FindInjections returns the sentences of text holding suspected
+// instructions, in order and without overlaps
+func FindInjections(text string) []Injection {
+	var found []Injection
+	for _, p := range injectionPatterns {
+		for _, match := range p.pattern.FindAllStringIndex(text, -1) {
+			start, end := sentenceBounds(text, match[0], match[1])
+			found = append(found, Injection{Start: start, End: end, Patterns: []string{p.name}})
+		}
+	}
+	if len(found) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(found, func(i, j int) bool { return found[i].Start < found[j].Start })
+	merged := found[:1]
+	for _, injection := range found[1:] {
+		last := &merged[len(merged)-1]
+		if injection.Start >= last.End {
+			merged = append(merged, injection)
+			continue
+		}
+		last.End = max(last.End, injection.End)
+		for _, name := range injection.Patterns {
+			if !slices.Contains(last.Patterns, name) {
+				last.Patterns = append(last.Patterns, name)
+			}
+		}
+	}
+	return merged
+}
+
+// ScrubInjections replaces the sentences of text holding suspected
+// instructions with InjectionPlaceholder, and returns what it found
+func ScrubInjections(text string) (string, []Injection) {
+	injections := FindInjections(text)
+	if len(injections) == 0 {
+		return text, nil
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, injection := range injections {
+		b.WriteString(text[last:injection.Start])
+		b.WriteString(InjectionPlaceholder)
+		last = injection.End
+	}
+	b.WriteString(text[last:])
+	return b.String(), injections
+}
+
+// sentenceBounds widens text[start:end] to the sentence around it: from
+// after the previous sentence end or line break to the next one, including
+// its punctuation
+func sentenceBounds(text string, start, end int) (int, int) {
+	start = strings.LastIndexAny(text[:start], ".!?\n") + 1
+	for start < len(text) && (text[start] == ' ' || text[start] == '\t') {
+		start++
+	}
+	if next := strings.IndexAny(text[end:], ".!?\n"); next < 0 {
+		end = len(text)
+	} else {
+		end += next
+		if text[end] != '\n' {
+			end++
+		}
+	}
+	return start, end
+}
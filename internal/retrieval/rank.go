@@ -0,0 +1,67 @@
+package retrieval
+
+import (
+	"math"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// RerankFactor is how many times the requested limit of the most similar
+// candidates are re-scored when a namespace ranks by recency or keywords,
+// so an older or less similar entry can still move into the results.
+const RerankFactor = 4
+
+// Reranks reports whether d ranks results by anything but similarity
+func (d Defaults) Reranks() bool {
+	return d.RecencyHalfLife > 0 || d.HybridWeights.Keyword > 0
+}
+
+// Score returns the ranking score of a result with the given similarity to
+// the query, summary text and age. With a keyword weight, the similarity is
+// blended with KeywordScore in proportion to the hybrid weights; with a
+// recency half-life, the score then decays exponentially with age,
+// halving every half-life down to the recency floor's share of it.
+// Otherwise the score is the similarity.
+func (d Defaults) Score(similarity float64, query, text string, age time.Duration) float64 {
+	score := similarity
+	if weights := d.HybridWeights; weights.Keyword > 0 {
+		score = (weights.Vector*similarity + weights.Keyword*KeywordScore(query, text)) /
+			(weights.Vector + weights.Keyword)
+	}
+	if d.RecencyHalfLife > 0 && age > 0 {
+		decay := math.Pow(0.5, float64(age)/float64(d.RecencyHalfLife))
+		score *= d.RecencyFloor + (1-d.RecencyFloor)*decay
+	}
+	return score
+}
+
+// KeywordScore returns the share of the distinct words of query that occur
+// as words in text, from 0 to 1. Words are compared case-insensitively.
+func KeywordScore(query, text string) float64 {
+	queryWords := words(query)
+	if len(queryWords) == 0 {
+		return 0
+	}
+	textWords := words(text)
+
+	matched := 0
+	for word := range queryWords {
+		if textWords[word] {
+			matched++
+		}
+	}
+	return float64(matched) / float64(len(queryWords))
+}
+
+// words returns the distinct lowercase words of s, split at anything but
+// letters and digits
+func words(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		set[word] = true
+	}
+	return set
+}
@@ -0,0 +1,67 @@
+package retrieval
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestScore(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		name     string
+		defaults Defaults
+		text     string
+		age      time.Duration
+		want     float64
+	}{
+		{"similarity only", Defaults{}, "unrelated", 10 * day, 0.8},
+		{"one half-life", Defaults{RecencyHalfLife: day}, "unrelated", day, 0.4},
+		{"two half-lives", Defaults{RecencyHalfLife: day}, "unrelated", 2 * day, 0.2},
+		{"future entries are not boosted", Defaults{RecencyHalfLife: day}, "unrelated", -day, 0.8},
+		{"floor keeps a share", Defaults{RecencyHalfLife: day, RecencyFloor: 0.5}, "unrelated", day, 0.6},
+		{"floor bounds the decay", Defaults{RecencyHalfLife: day, RecencyFloor: 0.5}, "unrelated", 100 * day, 0.4},
+		{"floor without a half-life", Defaults{RecencyFloor: 0.5}, "unrelated", 10 * day, 0.8},
+		{"equal weights", Defaults{HybridWeights: HybridWeights{Vector: 1, Keyword: 1}}, "Deploy the service", 0, 0.65},
+		{"keyword only", Defaults{HybridWeights: HybridWeights{Keyword: 1}}, "deploy notes", 0, 0.5},
+		{"vector weight alone is similarity", Defaults{HybridWeights: HybridWeights{Vector: 2}}, "deploy api", 0, 0.8},
+		{"hybrid then decay", Defaults{RecencyHalfLife: day, HybridWeights: HybridWeights{Vector: 1, Keyword: 1}}, "deploy api", day, 0.45},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.defaults.Score(0.8, "deploy API", test.text, test.age)
+			if math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("Score() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestKeywordScore(t *testing.T) {
+	tests := []struct {
+		query, text string
+		want        float64
+	}{
+		{"", "anything", 0},
+		{"deploy", "", 0},
+		{"Deploy steps", "deploy-steps for staging", 1},
+		{"deploy deploy steps", "how to deploy", 0.5},
+		{"auth", "authentication", 0},
+	}
+
+	for _, test := range tests {
+		if got := KeywordScore(test.query, test.text); got != test.want {
+			t.Errorf("KeywordScore(%q, %q) = %v, want %v", test.query, test.text, got, test.want)
+		}
+	}
+}
+
+func TestReranks(t *testing.T) {
+	if (Defaults{Limit: 3, MinScore: 0.5, HybridWeights: HybridWeights{Vector: 1}}).Reranks() {
+		t.Error("Expected limits, scores and a vector weight alone not to rerank")
+	}
+	if !(Defaults{RecencyHalfLife: time.Hour}).Reranks() || !(Defaults{HybridWeights: HybridWeights{Keyword: 1}}).Reranks() {
+		t.Error("Expected a half-life or keyword weight to rerank")
+	}
+}
@@ -0,0 +1,38 @@
+package retrieval
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// StageMode selects which retrieve_context requests an optional LLM stage
+// of retrieval, such as reranking or query expansion, runs for. Each costs
+// a call to an LLM provider.
+type StageMode string
+
+const (
+	// StageOff never runs the stage, the default.
+	StageOff StageMode = "off"
+
+	// StageRequest runs the stage for the requests that ask for it.
+	StageRequest StageMode = "request"
+
+	// StageAlways runs the stage for every request.
+	StageAlways StageMode = "always"
+)
+
+// ErrUnknownStageMode is returned by ParseStageMode for a name that is not
+// a StageMode.
+var ErrUnknownStageMode = errors.New("unknown stage mode")
+
+// ParseStageMode returns the StageMode named by s. An empty s is StageOff.
+func ParseStageMode(s string) (StageMode, error) {
+	switch mode := StageMode(strings.ToLower(strings.TrimSpace(s))); mode {
+	case "":
+		return StageOff, nil
+	case StageOff, StageRequest, StageAlways:
+		return mode, nil
+	}
+	return "", fmt.Errorf("%w %q: want %q, %q or %q", ErrUnknownStageMode, s, StageOff, StageRequest, StageAlways)
+}
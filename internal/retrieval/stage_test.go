@@ -0,0 +1,17 @@
+package retrieval
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseStageMode(t *testing.T) {
+	for input, want := range map[string]StageMode{"": StageOff, "off": StageOff, "Request": StageRequest, " always ": StageAlways} {
+		if got, err := ParseStageMode(input); err != nil || got != want {
+			t.Errorf("ParseStageMode(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+	if _, err := ParseStageMode("sometimes"); !errors.Is(err, ErrUnknownStageMode) {
+		t.Errorf("Expected ErrUnknownStageMode, got %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/tools"
+)
+
+// requestTracker records the tool calls that are currently executing so
+// list_active_requests can show which stage a slow or wedged call is stuck in.
+type requestTracker struct {
+	mu       sync.Mutex
+	nextID   uint64
+	requests map[uint64]*trackedRequest
+
+	// lastActivity is when a call last began or ended
+	lastActivity time.Time
+
+	// active is held for reading by every in-flight call, so idle release
+	// can shut calls out by holding it for writing
+	active sync.RWMutex
+
+	// drained is closed once no call is in flight after drain was called
+	drained chan struct{}
+}
+
+// trackedRequest is a single in-flight tool call
+type trackedRequest struct {
+	tracker        *requestTracker
+	id             uint64
+	tool           string
+	stage          string
+	startedAt      time.Time
+	stageStartedAt time.Time
+
+	// progress sends the call's progress notifications. nil sends none.
+	progress *progressReporter
+}
+
+// newRequestTracker creates an empty requestTracker
+func newRequestTracker() *requestTracker {
+	return &requestTracker{
+		requests:     make(map[uint64]*trackedRequest),
+		lastActivity: time.Now(),
+	}
+}
+
+// begin records the start of a call to tool. Callers must call end when the
+// call returns.
+func (t *requestTracker) begin(tool string) *trackedRequest {
+	t.active.RLock()
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.lastActivity = now
+	t.nextID++
+	request := &trackedRequest{
+		tracker:        t,
+		id:             t.nextID,
+		tool:           tool,
+		stage:          tools.StageValidating,
+		startedAt:      now,
+		stageStartedAt: now,
+	}
+	t.requests[request.id] = request
+	return request
+}
+
+// setStage records that the call has moved on to stage, and reports it as
+// progress. It does nothing on a nil call, for work done outside a tool call.
+func (r *trackedRequest) setStage(stage string) {
+	if r == nil {
+		return
+	}
+	now := time.Now()
+
+	r.tracker.mu.Lock()
+	r.stage = stage
+	r.stageStartedAt = now
+	r.tracker.mu.Unlock()
+
+	r.report(stage)
+}
+
+// report sends a progress notification with message if the client asked
+// for them
+func (r *trackedRequest) report(message string) {
+	if r.progress != nil {
+		r.progress.report(message)
+	}
+}
+
+// end removes the call from the tracker
+func (r *trackedRequest) end() {
+	defer r.tracker.active.RUnlock()
+
+	r.tracker.mu.Lock()
+	defer r.tracker.mu.Unlock()
+
+	r.tracker.lastActivity = time.Now()
+	delete(r.tracker.requests, r.id)
+	r.tracker.closeIfDrained()
+}
+
+// drain returns a channel that is closed once no call is in flight
+func (t *requestTracker) drain() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.drained == nil {
+		t.drained = make(chan struct{})
+		t.closeIfDrained()
+	}
+	return t.drained
+}
+
+// closeIfDrained closes drained if it is being waited on and no call is in
+// flight. t.mu must be held.
+func (t *requestTracker) closeIfDrained() {
+	if t.drained == nil || len(t.requests) > 0 {
+		return
+	}
+	select {
+	case <-t.drained:
+	default:
+		close(t.drained)
+	}
+}
+
+// runIfIdle runs fn if no call is in flight and the last call ended before
+// cutoff, unless fn already ran after that call, at ranAt. New calls wait
+// until fn returns. It reports whether fn ran.
+func (t *requestTracker) runIfIdle(cutoff time.Time, ranAt time.Time, fn func()) bool {
+	if !t.active.TryLock() {
+		return false
+	}
+	defer t.active.Unlock()
+
+	t.mu.Lock()
+	lastActivity := t.lastActivity
+	t.mu.Unlock()
+
+	if lastActivity.After(cutoff) || ranAt.After(lastActivity) {
+		return false
+	}
+	fn()
+	return true
+}
+
+// snapshot returns the in-flight calls as of now, oldest first
+func (t *requestTracker) snapshot(now time.Time) []tools.ActiveRequest {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	requests := make([]tools.ActiveRequest, 0, len(t.requests))
+	for _, request := range t.requests {
+		requests = append(requests, tools.ActiveRequest{
+			ID:             request.id,
+			Tool:           request.tool,
+			Stage:          request.stage,
+			StartedAt:      request.startedAt.Format(time.RFC3339),
+			ElapsedMs:      now.Sub(request.startedAt).Milliseconds(),
+			StageElapsedMs: now.Sub(request.stageStartedAt).Milliseconds(),
+		})
+	}
+
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].ID < requests[j].ID
+	})
+	return requests
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/localrivet/gomcp/server"
+	"github.com/localrivet/projectmemory/internal/archive"
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/errortypes"
+	"github.com/localrivet/projectmemory/internal/tools"
+)
+
+var (
+	// ErrMissingNamespace is returned when a namespace is archived or
+	// restored without naming it
+	ErrMissingNamespace = errors.New("namespace is required")
+
+	// ErrArchiveNotConfigured is returned when a namespace is archived or
+	// restored without an archive target
+	ErrArchiveNotConfigured = errors.New("no archive target is configured")
+)
+
+// SetArchiveTarget sets where archive_namespace writes namespaces and
+// restore_namespace reads them from. nil disables both tools. It must be
+// called before Start.
+func (s *MCPContextToolServer) SetArchiveTarget(target archive.Target) {
+	s.archiveTarget = target
+}
+
+// checkArchiveRequest returns the trimmed namespace of an archive or restore
+// request, or the reason the request cannot be served
+func (s *MCPContextToolServer) checkArchiveRequest(namespace string) (string, error) {
+	namespace = strings.TrimSpace(namespace)
+	switch {
+	case s.archiveTarget == nil:
+		return "", ErrArchiveNotConfigured
+	case namespace == "":
+		return "", ErrMissingNamespace
+	}
+	if _, ok := s.store.(contextstore.NamespaceArchiver); !ok {
+		return "", contextstore.ErrArchiveUnsupported
+	}
+	return namespace, nil
+}
+
+// handleArchiveNamespace handles the archive_namespace MCP tool call.
+func (s *MCPContextToolServer) handleArchiveNamespace(ctx *server.Context, req tools.ArchiveNamespaceRequest) (tools.ArchiveNamespaceResponse, error) {
+	s.logger.Info("Processing archive_namespace request", "namespace", req.Namespace)
+	call := s.beginCall(ctx, tools.ToolArchiveNamespace)
+	defer call.end()
+
+	response := tools.ArchiveNamespaceResponse{
+		Status: "success",
+	}
+
+	// Resolve the schema version the client was built against
+	version, err := tools.ResolveSchemaVersion(req.Version)
+	if err != nil {
+		err = errortypes.ValidationError(err, "invalid archive_namespace request").
+			WithField("version", req.Version)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+	response.Version = version
+
+	namespace, err := s.checkArchiveRequest(req.Namespace)
+	if err != nil {
+		err = errortypes.ValidationError(err, "invalid archive_namespace request").
+			WithField("namespace", req.Namespace)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	call.setStage(tools.StageArchiving)
+	bundle, err := archive.Archive(s.store, s.archiveTarget, namespace, time.Now())
+	if err != nil {
+		appErr := errortypes.DatabaseError(err, "failed to archive namespace")
+		if errors.Is(err, archive.ErrEmptyNamespace) {
+			appErr = errortypes.ValidationError(err, "invalid archive_namespace request")
+		}
+		appErr = appErr.WithField("namespace", namespace)
+		errortypes.LogError(s.logger, appErr)
+
+		response.Status = "error"
+		response.Error = appErr.Error()
+		return response, nil
+	}
+
+	response.ArchivedCount = len(bundle.Entries)
+	response.SnapshotHash = bundle.SnapshotHash
+	s.logger.Info("Successfully archived namespace", "namespace", namespace, "count", response.ArchivedCount)
+	return response, nil
+}
+
+// handleRestoreNamespace handles the restore_namespace MCP tool call.
+func (s *MCPContextToolServer) handleRestoreNamespace(ctx *server.Context, req tools.RestoreNamespaceRequest) (tools.RestoreNamespaceResponse, error) {
+	s.logger.Info("Processing restore_namespace request", "namespace", req.Namespace)
+	call := s.beginCall(ctx, tools.ToolRestoreNamespace)
+	defer call.end()
+
+	response := tools.RestoreNamespaceResponse{
+		Status: "success",
+	}
+
+	// Resolve the schema version the client was built against
+	version, err := tools.ResolveSchemaVersion(req.Version)
+	if err != nil {
+		err = errortypes.ValidationError(err, "invalid restore_namespace request").
+			WithField("version", req.Version)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+	response.Version = version
+
+	namespace, err := s.checkArchiveRequest(req.Namespace)
+	if err != nil {
+		err = errortypes.ValidationError(err, "invalid restore_namespace request").
+			WithField("namespace", req.Namespace)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	call.setStage(tools.StageRestoring)
+	count, err := archive.Restore(s.store, s.archiveTarget, namespace)
+	if err != nil {
+		appErr := errortypes.DatabaseError(err, "failed to restore namespace")
+		if errors.Is(err, archive.ErrNotArchived) || errors.Is(err, contextstore.ErrNamespaceNotEmpty) {
+			appErr = errortypes.ValidationError(err, "invalid restore_namespace request")
+		}
+		appErr = appErr.WithField("namespace", namespace)
+		errortypes.LogError(s.logger, appErr)
+
+		response.Status = "error"
+		response.Error = appErr.Error()
+		return response, nil
+	}
+
+	response.RestoredCount = count
+	s.logger.Info("Successfully restored namespace", "namespace", namespace, "count", count)
+	return response, nil
+}
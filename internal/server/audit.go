@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/localrivet/projectmemory/internal/auth"
+)
+
+// SetAuthenticator authenticates the callers of the quick-capture and gRPC
+// endpoints with authenticator, in addition to their tokens, and restricts
+// each caller to the namespaces of its identity. It must be called before
+// SetQuickCapture and SetGRPC, which then no longer require a token.
+func (s *MCPContextToolServer) SetAuthenticator(authenticator auth.Authenticator) {
+	s.authenticator = authenticator
+}
+
+// SetTLS serves the quick-capture and gRPC endpoints over TLS with config.
+// Client certificates it verifies reach the authenticator. It must be
+// called before Start.
+func (s *MCPContextToolServer) SetTLS(config *tls.Config) {
+	s.tlsConfig = config
+}
+
+// transportAuthenticator returns the authenticator of an endpoint accepting
+// token, for a caller named subject with every namespace, and whatever the
+// server's authenticator accepts. It returns nil if the endpoint has
+// neither, and serves anyone.
+func (s *MCPContextToolServer) transportAuthenticator(token, subject string) auth.Authenticator {
+	var tokenAuthenticator auth.Authenticator
+	if token != "" {
+		tokenAuthenticator = auth.NewAPIKeyAuthenticator(map[string]auth.Identity{
+			token: {Subject: subject, Namespaces: []string{auth.AllNamespaces}},
+		})
+	}
+	if tokenAuthenticator == nil && s.authenticator == nil {
+		return nil
+	}
+	return auth.Chain(tokenAuthenticator, s.authenticator)
+}
+
+// audit logs an operation on namespace made through a network transport,
+// with the identity of the caller ctx carries and its outcome: "ok",
+// "denied" if the caller may not use the namespace, or "failed"
+func (s *MCPContextToolServer) audit(ctx context.Context, operation, namespace string, err error) {
+	identity, _ := auth.FromContext(ctx)
+	attrs := []any{"operation", operation, "namespace", namespace, "subject", identity.Subject, "auth_method", identity.Method}
+	switch {
+	case err == nil:
+		s.logger.Info("Audit", append(attrs, "outcome", "ok")...)
+	case errors.Is(err, auth.ErrForbidden) || status.Code(err) == codes.PermissionDenied:
+		s.logger.Warn("Audit", append(attrs, "outcome", "denied", "error", err)...)
+	default:
+		s.logger.Info("Audit", append(attrs, "outcome", "failed", "error", err)...)
+	}
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/localrivet/gomcp/server"
+	"github.com/localrivet/projectmemory/internal/consolidate"
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/errortypes"
+	"github.com/localrivet/projectmemory/internal/tools"
+)
+
+var (
+	// ErrConsolidationNotConfigured is returned when consolidate is called
+	// on a server without a merger
+	ErrConsolidationNotConfigured = errors.New("consolidation is not configured on this server")
+
+	// ErrInvalidThreshold is returned by consolidate for a threshold
+	// outside 0 to 1
+	ErrInvalidThreshold = errors.New("threshold must be between 0 and 1")
+)
+
+// SetConsolidation sets the merger the consolidate tool merges clusters of
+// similar entries with, and the clustering options it starts from. A
+// positive interval also consolidates every namespace every interval while
+// the server runs. nil, the default, disables consolidation. It must be
+// called before Start.
+func (s *MCPContextToolServer) SetConsolidation(merger consolidate.Merger, options consolidate.Options, interval time.Duration) {
+	s.merger = merger
+	s.consolidateOptions = options
+	s.consolidateInterval = interval
+}
+
+// Consolidate merges each cluster of highly similar entries into one entry
+// that replaces them, with options overriding the server's non-zero
+// threshold and cluster size. Runs never overlap: a run waits for the one in
+// progress. It returns ErrConsolidationNotConfigured without a merger and
+// contextstore.ErrUsageUnsupported if the store cannot list its entries.
+func (s *MCPContextToolServer) Consolidate(ctx context.Context, options consolidate.Options) (consolidate.Report, error) {
+	if s.merger == nil {
+		return consolidate.Report{}, ErrConsolidationNotConfigured
+	}
+	if options.Threshold == 0 {
+		options.Threshold = s.consolidateOptions.Threshold
+	}
+	if options.MaxClusterSize == 0 {
+		options.MaxClusterSize = s.consolidateOptions.MaxClusterSize
+	}
+
+	s.consolidating.Lock()
+	defer s.consolidating.Unlock()
+	return consolidate.Run(ctx, s.store, s.merger, s.embedder, options)
+}
+
+// consolidatePeriodically consolidates every namespace every interval until
+// stop is closed, which cancels a run in progress
+func (s *MCPContextToolServer) consolidatePeriodically(interval time.Duration, stop <-chan struct{}) {
+	defer s.background.Done()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		report, err := s.Consolidate(ctx, consolidate.Options{})
+		if err != nil && ctx.Err() == nil {
+			s.logger.Warn("Failed to consolidate context", "error", err)
+			continue
+		}
+		if report.Consolidated > 0 || report.Failed > 0 {
+			s.logger.Info("Consolidated context", "report", report.String())
+		}
+	}
+}
+
+// handleConsolidate handles the consolidate MCP tool call.
+func (s *MCPContextToolServer) handleConsolidate(ctx *server.Context, req tools.ConsolidateRequest) (tools.ConsolidateResponse, error) {
+	s.logger.Info("Processing consolidate request", "namespace", req.Namespace, "threshold", req.Threshold, "dry_run", req.DryRun)
+	call := s.beginCall(ctx, tools.ToolConsolidate)
+	defer call.end()
+
+	response := tools.ConsolidateResponse{
+		Status:   "success",
+		Clusters: []tools.ConsolidatedCluster{},
+	}
+
+	// Resolve the schema version the client was built against
+	version, err := tools.ResolveSchemaVersion(req.Version)
+	if err != nil {
+		err = errortypes.ValidationError(err, "invalid consolidate request").
+			WithField("version", req.Version)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+	response.Version = version
+
+	// Check confirmation string, unless nothing is replaced
+	if !req.DryRun && req.Confirmation != "confirm" {
+		response.Status = "error"
+		response.Error = "Confirmation required. Set confirmation to 'confirm' to proceed with replacing entries, or set dry_run to list the clusters"
+		s.logger.Warn("Consolidate operation rejected: missing confirmation")
+		return response, nil
+	}
+
+	// Validate the request's fields
+	if invalid := s.validateConsolidate(req); invalid != nil {
+		response.Status = "error"
+		response.Error = s.rejectRequest(tools.ToolConsolidate, invalid).Error()
+		response.FieldErrors = invalid.fields
+		return response, nil
+	}
+
+	callCtx, cancel := s.callContext(ctx)
+	defer cancel()
+
+	call.setStage(tools.StageConsolidating)
+	report, err := s.Consolidate(callCtx, consolidate.Options{
+		Threshold: req.Threshold,
+		Namespace: strings.TrimSpace(req.Namespace),
+		DryRun:    req.DryRun,
+	})
+	if err != nil {
+		appErr := errortypes.DatabaseError(err, "failed to consolidate context")
+		if errors.Is(err, ErrConsolidationNotConfigured) || errors.Is(err, contextstore.ErrUsageUnsupported) {
+			appErr = errortypes.ValidationError(err, "invalid consolidate request")
+		}
+		appErr = appErr.WithField("namespace", req.Namespace)
+		errortypes.LogError(s.logger, appErr)
+
+		response.Status = "error"
+		response.Error = appErr.Error()
+		return response, nil
+	}
+
+	for _, cluster := range report.Clusters {
+		response.Clusters = append(response.Clusters, tools.ConsolidatedCluster{
+			Namespace:      cluster.Namespace,
+			IDs:            cluster.IDs,
+			ConsolidatedID: cluster.Consolidated,
+		})
+	}
+	response.ConsolidatedCount = report.Consolidated
+	response.ReplacedCount = report.Entries
+	response.FailedCount = report.Failed
+	s.logger.Info("Successfully consolidated context", "clusters", len(report.Clusters),
+		"consolidated", report.Consolidated, "replaced", report.Entries, "failed", report.Failed, "dry_run", req.DryRun)
+	return response, nil
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/expansion"
+	"github.com/localrivet/projectmemory/internal/telemetry"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+// ErrExpansionUnavailable is returned for a retrieve_context request asking
+// for query expansion from a server without a query expander.
+var ErrExpansionUnavailable = errors.New("query expansion is not configured on this server")
+
+// SetQueryExpander sets the expander retrieve_context asks for alternative
+// phrasings of its query, each searched as well, and how many it asks for;
+// 0 uses expansion.DefaultQueries. With always, every request is expanded;
+// otherwise only the requests that ask for it. nil, the default, searches
+// the query alone. It must be called before Start.
+func (s *MCPContextToolServer) SetQueryExpander(e expansion.Expander, queries int, always bool) {
+	if queries <= 0 {
+		queries = expansion.DefaultQueries
+	}
+	s.expander = e
+	s.expansionQueries = queries
+	s.expansionAlways = always
+}
+
+// expands reports whether a query asking for expansion or not is expanded
+func (s *MCPContextToolServer) expands(requested bool) bool {
+	return s.expander != nil && (requested || s.expansionAlways)
+}
+
+// expandQuery returns the embeddings of the expander's alternatives to
+// query. Alternatives the embedder fails on are left out. If the expander
+// fails, none are returned, and the failure is logged and counted: the
+// query is then searched alone.
+func (s *MCPContextToolServer) expandQuery(ctx context.Context, query string) [][]float32 {
+	start := time.Now()
+	alternatives, err := s.expander.Expand(ctx, query, s.expansionQueries)
+	s.metrics.RecordTimer(telemetry.MetricExpansionDuration, time.Since(start))
+	if err != nil {
+		s.metrics.IncrementCounter(telemetry.MetricExpansionFailures, 1)
+		s.logger.Warn("Failed to expand query, searching it alone", "error", err)
+		return nil
+	}
+	s.metrics.IncrementCounter(telemetry.MetricExpansionCalls, 1)
+
+	var embeddings [][]float32
+	for _, alternative := range alternatives {
+		sourced, err := vector.CreateEmbeddingContext(ctx, s.embedder, alternative)
+		if err == nil {
+			err = vector.ValidateEmbedding(sourced.Vector)
+		}
+		if err != nil {
+			s.logger.Warn("Failed to create embedding for expanded query, leaving it out", "query", alternative, "error", err)
+			continue
+		}
+		embeddings = append(embeddings, sourced.Vector)
+	}
+	s.logger.Debug("Expanded query", "alternatives", len(alternatives), "searched", len(embeddings))
+	return embeddings
+}
+
+// fuseCandidates merges the candidates of searches for several phrasings
+// of a query, keeping each entry once with its best similarity, and returns
+// at most limit of them by similarity, highest first. Entries are told
+// apart by ID, or by summary if the store reports no IDs.
+func fuseCandidates(sets [][]contextstore.SearchResult, limit int) []contextstore.SearchResult {
+	var fused []contextstore.SearchResult
+	index := make(map[string]int)
+	for _, set := range sets {
+		for _, candidate := range set {
+			key := candidate.ID
+			if key == "" {
+				key = "summary:" + candidate.SummaryText
+			}
+			if i, ok := index[key]; ok {
+				if candidate.Similarity > fused[i].Similarity {
+					fused[i] = candidate
+				}
+				continue
+			}
+			index[key] = len(fused)
+			fused = append(fused, candidate)
+		}
+	}
+	sort.SliceStable(fused, func(i, j int) bool {
+		return fused[i].Similarity > fused[j].Similarity
+	})
+	if len(fused) > limit {
+		fused = fused[:limit]
+	}
+	return fused
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/localrivet/projectmemory/internal/tools"
+)
+
+// ErrUnknownFormat is returned for a retrieve_context format other than
+// tools.FormatJSON, tools.FormatMarkdownBullets or tools.FormatXMLTags.
+var ErrUnknownFormat = errors.New("unknown result format")
+
+// xmlEscaper escapes text and attribute values for tools.FormatXMLTags.
+// Unlike xml.EscapeText it leaves newlines alone, so multi-line entries stay
+// readable in a prompt.
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+// formattedResult is one entry of a tools.FormatJSON rendering
+type formattedResult struct {
+	ID   string `json:"id,omitempty"`
+	Text string `json:"text"`
+}
+
+// validateFormat returns an error unless format is empty or a known format
+func validateFormat(format string) error {
+	switch format {
+	case "", tools.FormatJSON, tools.FormatMarkdownBullets, tools.FormatXMLTags:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+}
+
+// renderResults renders results in format with the ID of each result
+// embedded. ids is either nil, for stores that cannot report IDs, or aligned
+// with results. An empty format renders nothing.
+func renderResults(format string, results []string, ids []string) (string, error) {
+	idOf := func(i int) string {
+		if i < len(ids) {
+			return ids[i]
+		}
+		return ""
+	}
+
+	switch format {
+	case "":
+		return "", nil
+
+	case tools.FormatJSON:
+		entries := make([]formattedResult, len(results))
+		for i, text := range results {
+			entries[i] = formattedResult{ID: idOf(i), Text: text}
+		}
+		// Agents paste this into prompts, so keep <, > and & readable
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(entries); err != nil {
+			return "", fmt.Errorf("failed to render results as JSON: %w", err)
+		}
+		return strings.TrimSuffix(buf.String(), "\n"), nil
+
+	case tools.FormatMarkdownBullets:
+		var b strings.Builder
+		for i, text := range results {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			b.WriteString("- ")
+			if id := idOf(i); id != "" {
+				b.WriteString("[" + id + "] ")
+			}
+			// Indent continuation lines so they stay inside the bullet
+			b.WriteString(strings.ReplaceAll(text, "\n", "\n  "))
+		}
+		return b.String(), nil
+
+	case tools.FormatXMLTags:
+		var b strings.Builder
+		for i, text := range results {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			b.WriteString("<context")
+			if id := idOf(i); id != "" {
+				b.WriteString(` id="` + xmlEscaper.Replace(id) + `"`)
+			}
+			b.WriteString(">" + xmlEscaper.Replace(text) + "</context>")
+		}
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/summarizer"
+	"github.com/localrivet/projectmemory/internal/tools"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+// FuzzToolRequests decodes arbitrary JSON the way the MCP transport does and
+// feeds it to every tool handler. Handlers must never panic or return a Go
+// error, and every response must carry a definite status.
+func FuzzToolRequests(f *testing.F) {
+	f.Add(`{"context_text": "Deploys run from the release branch."}`)
+	f.Add(`{"query": "deploys", "limit": 3}`)
+	f.Add(`{"query": "", "limit": -1, "version": "2"}`)
+	f.Add(`{"id": "abc", "context_text": "héllo wörld ✓"}`)
+	f.Add(`{"confirmation": "confirm"}`)
+
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer slog.SetDefault(defaultLogger)
+
+	f.Fuzz(func(t *testing.T, payload string) {
+		store := contextstore.NewMemoryContextStore()
+		srv := NewContextToolServer(store, summarizer.NewBasicSummarizer(32), vector.NewMockEmbedder(16))
+		if err := srv.Initialize(); err != nil {
+			t.Fatalf("Failed to initialize server: %v", err)
+		}
+
+		checkStatus := func(tool, status, errMsg string, err error) {
+			if err != nil {
+				t.Fatalf("%s returned Go error: %v", tool, err)
+			}
+			if status != "success" && status != "error" {
+				t.Fatalf("%s returned status %q", tool, status)
+			}
+			if status == "error" && errMsg == "" {
+				t.Fatalf("%s returned error status without a message", tool)
+			}
+		}
+
+		var saveReq tools.SaveContextRequest
+		if json.Unmarshal([]byte(payload), &saveReq) == nil {
+			resp, err := srv.handleSaveContext(nil, saveReq)
+			checkStatus(tools.ToolSaveContext, resp.Status, resp.Error, err)
+
+			// Summaries of valid UTF-8 must stay valid UTF-8
+			if resp.Status == "success" && utf8.ValidString(saveReq.ContextText) {
+				query, _ := vector.NewMockEmbedder(16).CreateEmbedding("query")
+				results, _ := store.Search(query, 1)
+				for _, result := range results {
+					if !utf8.ValidString(result) {
+						t.Fatalf("Stored summary is not valid UTF-8: %q", result)
+					}
+				}
+			}
+		}
+
+		var retrieveReq tools.RetrieveContextRequest
+		if json.Unmarshal([]byte(payload), &retrieveReq) == nil {
+			resp, err := srv.handleRetrieveContext(nil, retrieveReq)
+			checkStatus(tools.ToolRetrieveContext, resp.Status, resp.Error, err)
+		}
+
+		var replaceReq tools.ReplaceContextRequest
+		if json.Unmarshal([]byte(payload), &replaceReq) == nil {
+			resp, err := srv.handleReplaceContext(nil, replaceReq)
+			checkStatus(tools.ToolReplaceContext, resp.Status, resp.Error, err)
+		}
+
+		var deleteReq tools.DeleteContextRequest
+		if json.Unmarshal([]byte(payload), &deleteReq) == nil {
+			resp, err := srv.handleDeleteContext(nil, deleteReq)
+			checkStatus(tools.ToolDeleteContext, resp.Status, resp.Error, err)
+		}
+
+		var clearReq tools.ClearAllContextRequest
+		if json.Unmarshal([]byte(payload), &clearReq) == nil {
+			resp, err := srv.handleClearAllContext(nil, clearReq)
+			checkStatus(tools.ToolClearAllContext, resp.Status, resp.Error, err)
+		}
+
+		var undoReq tools.UndoClearRequest
+		if json.Unmarshal([]byte(payload), &undoReq) == nil {
+			resp, err := srv.handleUndoClear(nil, undoReq)
+			checkStatus(tools.ToolUndoClear, resp.Status, resp.Error, err)
+		}
+
+		var listReq tools.ListActiveRequestsRequest
+		if json.Unmarshal([]byte(payload), &listReq) == nil {
+			resp, err := srv.handleListActiveRequests(nil, listReq)
+			checkStatus(tools.ToolListActiveRequests, resp.Status, resp.Error, err)
+			if len(resp.Requests) != 0 {
+				t.Fatalf("Expected no active requests between calls, got %v", resp.Requests)
+			}
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/localrivet/gomcp/server"
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/errortypes"
+	"github.com/localrivet/projectmemory/internal/tools"
+)
+
+// ErrResolveNamespace is returned when memory_gaps is asked to resolve gaps
+// without naming their namespace.
+var ErrResolveNamespace = errors.New("namespace is required to resolve gaps")
+
+// recordGap logs query as a gap of namespace if the store keeps gaps.
+// Failures are logged rather than failing the retrieval.
+func (s *MCPContextToolServer) recordGap(namespace, query string) {
+	gaps, ok := s.store.(contextstore.GapStore)
+	query = strings.TrimSpace(query)
+	if !ok || query == "" {
+		return
+	}
+	if err := gaps.RecordGap(namespace, query, time.Now()); err != nil && !errors.Is(err, contextstore.ErrGapsUnsupported) {
+		s.logger.Warn("Failed to record retrieval gap", "namespace", namespace, "error", err)
+	}
+}
+
+// handleMemoryGaps handles the memory_gaps MCP tool call.
+func (s *MCPContextToolServer) handleMemoryGaps(ctx *server.Context, req tools.MemoryGapsRequest) (tools.MemoryGapsResponse, error) {
+	s.logger.Info("Processing memory_gaps request", "namespace", req.Namespace, "limit", req.Limit, "resolve", len(req.Resolve))
+	call := s.beginCall(ctx, tools.ToolMemoryGaps)
+	defer call.end()
+
+	response := tools.MemoryGapsResponse{
+		Status: "success",
+		Gaps:   []tools.GapInfo{},
+	}
+
+	// Resolve the schema version the client was built against
+	version, err := tools.ResolveSchemaVersion(req.Version)
+	if err != nil {
+		err = errortypes.ValidationError(err, "invalid memory_gaps request").
+			WithField("version", req.Version)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+	response.Version = version
+
+	// Validate the request's fields
+	if invalid := s.validateMemoryGaps(req); invalid != nil {
+		response.Status = "error"
+		response.Error = s.rejectRequest(tools.ToolMemoryGaps, invalid).Error()
+		response.FieldErrors = invalid.fields
+		return response, nil
+	}
+
+	// Gaps need a store that records them
+	store, ok := s.store.(contextstore.GapStore)
+	if !ok {
+		err = errortypes.ValidationError(contextstore.ErrGapsUnsupported, "invalid memory_gaps request")
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = tools.DefaultMemoryGapsLimit
+	}
+
+	// Forget the gaps the caller has filled
+	if len(req.Resolve) > 0 {
+		call.setStage(tools.StageDeleting)
+		response.Resolved, err = store.DeleteGaps(req.Namespace, req.Resolve)
+		if err != nil {
+			err = errortypes.DatabaseError(err, "failed to resolve retrieval gaps").
+				WithField("namespace", req.Namespace)
+			errortypes.LogError(s.logger, err)
+
+			response.Status = "error"
+			response.Error = err.Error()
+			return response, nil
+		}
+	}
+
+	call.setStage(tools.StageListing)
+	gaps, err := store.ListGaps(req.Namespace)
+	if err != nil {
+		err = errortypes.DatabaseError(err, "failed to list retrieval gaps").
+			WithField("namespace", req.Namespace)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	for i, gap := range gaps {
+		if i == limit {
+			break
+		}
+		response.Gaps = append(response.Gaps, tools.GapInfo{
+			Namespace: gap.Namespace,
+			Query:     gap.Query,
+			Count:     gap.Count,
+			FirstSeen: gap.FirstSeen.Format(time.RFC3339),
+			LastSeen:  gap.LastSeen.Format(time.RFC3339),
+		})
+	}
+
+	s.logger.Info("Listed retrieval gaps", "count", len(response.Gaps), "resolved", response.Resolved)
+	return response, nil
+}
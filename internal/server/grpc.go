@@ -0,0 +1,282 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	projectmemoryv1 "github.com/localrivet/projectmemory/api/projectmemory/v1"
+	"github.com/localrivet/projectmemory/internal/auth"
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/tools"
+)
+
+// grpcShutdownTimeout bounds the wait for calls in flight when the server
+// stops
+const grpcShutdownTimeout = 5 * time.Second
+
+// ErrGRPCToken is returned when the gRPC endpoint would listen on an
+// address other than a loopback one without a token or an authenticator.
+var ErrGRPCToken = errors.New("gRPC token is required for a non-loopback address")
+
+// grpcService serves the ProjectMemory gRPC service by calling the MCP tool
+// handlers, so both APIs validate and answer alike
+type grpcService struct {
+	projectmemoryv1.UnimplementedProjectMemoryServer
+	server *MCPContextToolServer
+}
+
+// SetGRPC serves the ProjectMemory gRPC service, defined in
+// api/projectmemory/v1/projectmemory.proto, on addr while the server runs.
+// If token is set, each call must carry it as a bearer token in its
+// "authorization" metadata, or credentials the authenticator set with
+// SetAuthenticator accepts. Only a loopback address may be served without
+// either. It must be called before Start.
+func (s *MCPContextToolServer) SetGRPC(addr, token string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid gRPC address %q: %w", addr, err)
+	}
+	if ip := net.ParseIP(host); token == "" && s.authenticator == nil && host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("%w: %s", ErrGRPCToken, addr)
+	}
+
+	s.grpcAddr = addr
+	s.grpcToken = token
+	return nil
+}
+
+// serveGRPC listens on the gRPC address and serves calls until stop is
+// closed
+func (s *MCPContextToolServer) serveGRPC(stop <-chan struct{}) error {
+	listener, err := net.Listen("tcp", s.grpcAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for gRPC calls: %w", err)
+	}
+
+	grpcServer := s.newGRPCServer()
+	go func() {
+		if err := grpcServer.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			s.logger.Error("gRPC endpoint failed", "error", err)
+		}
+	}()
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		<-stop
+		timer := time.AfterFunc(grpcShutdownTimeout, grpcServer.Stop)
+		defer timer.Stop()
+		grpcServer.GracefulStop()
+	}()
+
+	s.logger.Info("Listening for gRPC calls", "addr", listener.Addr().String())
+	return nil
+}
+
+// newGRPCServer returns a gRPC server with the ProjectMemory service
+// registered, authenticating each call if a token or an authenticator is
+// set
+func (s *MCPContextToolServer) newGRPCServer() *grpc.Server {
+	var options []grpc.ServerOption
+	if authenticator := s.transportAuthenticator(s.grpcToken, "grpc-token"); authenticator != nil {
+		options = append(options,
+			grpc.UnaryInterceptor(auth.UnaryServerInterceptor(authenticator, s.logger)),
+			grpc.StreamInterceptor(auth.StreamServerInterceptor(authenticator, s.logger)),
+		)
+	}
+	if s.tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(s.tlsConfig)))
+	}
+
+	grpcServer := grpc.NewServer(options...)
+	projectmemoryv1.RegisterProjectMemoryServer(grpcServer, &grpcService{server: s})
+	return grpcServer
+}
+
+// authorizeGRPC returns a PermissionDenied error if the caller may not use
+// namespace
+func authorizeGRPC(ctx context.Context, namespace string) error {
+	if err := auth.Authorize(ctx, namespace); err != nil {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return nil
+}
+
+// grpcError converts a failed handler response to a gRPC status. Handlers
+// report invalid requests with messages starting "invalid", which become
+// InvalidArgument; other failures become Internal.
+func grpcError(responseStatus, message string) error {
+	switch {
+	case responseStatus == StatusThrottled:
+		return status.Error(codes.ResourceExhausted, message)
+	case strings.HasPrefix(message, "invalid "):
+		return status.Error(codes.InvalidArgument, message)
+	default:
+		return status.Error(codes.Internal, message)
+	}
+}
+
+// SaveContext saves a text like save_context. A throttled save fails with
+// ResourceExhausted, and a server that does not offer save_context answers
+// Unimplemented.
+func (g *grpcService) SaveContext(ctx context.Context, req *projectmemoryv1.SaveContextRequest) (_ *projectmemoryv1.SaveContextResponse, err error) {
+	namespace := cmp.Or(strings.TrimSpace(req.GetNamespace()), contextstore.DefaultNamespace)
+	defer func() { g.server.audit(ctx, "SaveContext", namespace, err) }()
+	if err := authorizeGRPC(ctx, namespace); err != nil {
+		return nil, err
+	}
+	if err := g.server.checkToolEnabled(tools.ToolSaveContext); err != nil {
+		return nil, status.Error(codes.Unimplemented, err.Error())
+	}
+	if strings.TrimSpace(req.GetText()) == "" {
+		return nil, status.Error(codes.InvalidArgument, "invalid SaveContext request: text is required")
+	}
+
+	response, err := g.server.handleSaveContext(nil, tools.SaveContextRequest{
+		ContextText:      req.GetText(),
+		Tags:             req.GetTags(),
+		Source:           req.GetSource(),
+		BatchID:          req.GetBatchId(),
+		MaxSummaryLength: int(req.GetMaxSummaryLength()),
+		Namespace:        req.GetNamespace(),
+	})
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if response.Status != "success" {
+		message := response.Error
+		if response.RetryAfterSeconds > 0 {
+			message = fmt.Sprintf("%s (retry after %ds)", message, response.RetryAfterSeconds)
+		}
+		return nil, grpcError(response.Status, message)
+	}
+
+	return &projectmemoryv1.SaveContextResponse{
+		Id:                 response.ID,
+		Title:              response.Title,
+		Quarantined:        response.Quarantined,
+		Coalesced:          response.Coalesced,
+		SummaryUnavailable: response.SummaryUnavailable,
+	}, nil
+}
+
+// RetrieveContext searches like retrieve_context and sends each result as
+// its own message, most relevant first. Searching every namespace, as a
+// request without one does, needs access to every namespace.
+func (g *grpcService) RetrieveContext(req *projectmemoryv1.RetrieveContextRequest, stream grpc.ServerStreamingServer[projectmemoryv1.RetrieveContextResponse]) (err error) {
+	ctx := stream.Context()
+	namespace := cmp.Or(strings.TrimSpace(req.GetNamespace()), auth.AllNamespaces)
+	defer func() { g.server.audit(ctx, "RetrieveContext", namespace, err) }()
+	if err := authorizeGRPC(ctx, namespace); err != nil {
+		return err
+	}
+
+	response, err := g.server.handleRetrieveContext(nil, tools.RetrieveContextRequest{
+		Query:       req.GetQuery(),
+		Limit:       int(req.GetLimit()),
+		Adaptive:    req.GetAdaptive(),
+		MinScore:    req.GetMinScore(),
+		Namespace:   req.GetNamespace(),
+		ExcludeIDs:  req.GetExcludeIds(),
+		ExcludeTags: req.GetExcludeTags(),
+		Tags:        req.GetTags(),
+		Since:       formatBound(req.GetSince()),
+		Until:       formatBound(req.GetUntil()),
+		KnownIDs:    req.GetKnownIds(),
+		Dedup:       req.GetDedup(),
+		Version:     tools.CurrentSchemaVersion,
+	})
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if response.Status != "success" {
+		return grpcError(response.Status, response.Error)
+	}
+	for i, entry := range response.Results {
+		result := &projectmemoryv1.RetrieveContextResponse{Id: entry.ID, Summary: entry.Summary}
+		if i < len(response.Provenance) {
+			result.Provenance = response.Provenance[i]
+		}
+		if i < len(response.Generations) && response.Generations[i] != nil {
+			generation := response.Generations[i]
+			result.Generation = &projectmemoryv1.SummaryGeneration{
+				Summarizer:    generation.Summarizer,
+				Provider:      generation.Provider,
+				Model:         generation.Model,
+				PromptVersion: generation.PromptVersion,
+			}
+		}
+		if err := stream.Send(result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteContext deletes an entry like delete_context. The namespace of the
+// entry is not known beforehand, so it needs access to every namespace. A
+// server that does not offer delete_context answers Unimplemented.
+func (g *grpcService) DeleteContext(ctx context.Context, req *projectmemoryv1.DeleteContextRequest) (_ *projectmemoryv1.DeleteContextResponse, err error) {
+	defer func() { g.server.audit(ctx, "DeleteContext", auth.AllNamespaces, err) }()
+	if err := authorizeGRPC(ctx, auth.AllNamespaces); err != nil {
+		return nil, err
+	}
+	if err := g.server.checkToolEnabled(tools.ToolDeleteContext); err != nil {
+		return nil, status.Error(codes.Unimplemented, err.Error())
+	}
+	if strings.TrimSpace(req.GetId()) == "" {
+		return nil, status.Error(codes.InvalidArgument, "invalid DeleteContext request: id is required")
+	}
+
+	response, err := g.server.handleDeleteContext(nil, tools.DeleteContextRequest{ID: req.GetId()})
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if response.Status != "success" {
+		return nil, grpcError(response.Status, response.Error)
+	}
+	return &projectmemoryv1.DeleteContextResponse{}, nil
+}
+
+// GetStats reports summarization load and provider health like
+// memory_status, to any caller
+func (g *grpcService) GetStats(ctx context.Context, req *projectmemoryv1.GetStatsRequest) (_ *projectmemoryv1.GetStatsResponse, err error) {
+	defer func() { g.server.audit(ctx, "GetStats", "", err) }()
+	response, err := g.server.handleMemoryStatus(nil, tools.MemoryStatusRequest{})
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if response.Status != "success" {
+		return nil, grpcError(response.Status, response.Error)
+	}
+
+	return &projectmemoryv1.GetStatsResponse{
+		QueueDepth:       int32(response.QueueDepth),
+		ProviderRequests: int32(response.ProviderRequests),
+		MaxConcurrency:   int32(response.MaxConcurrency),
+		ActiveRequests:   int32(response.ActiveRequests),
+		Providers:        response.Providers,
+		OverBudget:       response.OverBudget,
+		DeferNonCritical: response.DeferNonCritical,
+		DeferReasons:     response.DeferReasons,
+	}, nil
+}
+
+// formatBound formats a search bound as retrieve_context takes it. An
+// unset bound is empty.
+func formatBound(bound *timestamppb.Timestamp) string {
+	if bound == nil {
+		return ""
+	}
+	return bound.AsTime().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	projectmemoryv1 "github.com/localrivet/projectmemory/api/projectmemory/v1"
+	"github.com/localrivet/projectmemory/internal/auth"
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+func TestSetGRPC(t *testing.T) {
+	srv := NewContextToolServer(&MockStore{}, &MockSummarizer{}, &MockEmbedder{})
+
+	if err := srv.SetGRPC("0.0.0.0:7078", ""); !errors.Is(err, ErrGRPCToken) {
+		t.Errorf("Expected ErrGRPCToken for a public address without a token, got %v", err)
+	}
+	if err := srv.SetGRPC("7078", "secret"); err == nil {
+		t.Error("Expected an error for an address without a port")
+	}
+	for _, test := range []struct{ addr, token string }{
+		{"0.0.0.0:7078", "secret"},
+		{":7078", "secret"},
+		{"127.0.0.1:7078", ""},
+		{"localhost:7078", ""},
+	} {
+		if err := srv.SetGRPC(test.addr, test.token); err != nil {
+			t.Errorf("Expected %s with token %q to be accepted, got %v", test.addr, test.token, err)
+		}
+	}
+	srv.SetAuthenticator(auth.NewAPIKeyAuthenticator(map[string]auth.Identity{"key": {Subject: "ci"}}))
+	if err := srv.SetGRPC("0.0.0.0:7078", ""); err != nil {
+		t.Errorf("Expected a public address without a token to be accepted with an authenticator, got %v", err)
+	}
+}
+
+// newGRPCTestClient serves srv's gRPC service in memory and returns a
+// client calling it
+func newGRPCTestClient(t *testing.T, srv *MCPContextToolServer) projectmemoryv1.ProjectMemoryClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	grpcServer := srv.newGRPCServer()
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return projectmemoryv1.NewProjectMemoryClient(conn)
+}
+
+func TestGRPCService(t *testing.T) {
+	store := contextstore.NewMemoryContextStore()
+
+	srv := NewContextToolServer(store, &MockSummarizer{}, vector.NewMockEmbedder(8))
+	if err := srv.SetGRPC("127.0.0.1:0", "secret"); err != nil {
+		t.Fatalf("SetGRPC failed: %v", err)
+	}
+	client := newGRPCTestClient(t, srv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := client.GetStats(ctx, &projectmemoryv1.GetStatsRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Expected Unauthenticated without a token, got %v", err)
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret")
+
+	var ids []string
+	for _, text := range []string{"Deploys go through make release", "The API uses JWT tokens"} {
+		saved, err := client.SaveContext(ctx, &projectmemoryv1.SaveContextRequest{Text: text, Tags: []string{"ops"}})
+		if err != nil {
+			t.Fatalf("SaveContext failed: %v", err)
+		}
+		ids = append(ids, saved.GetId())
+	}
+	if _, err := client.SaveContext(ctx, &projectmemoryv1.SaveContextRequest{Text: " "}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for an empty text, got %v", err)
+	}
+
+	retrieve := func(req *projectmemoryv1.RetrieveContextRequest) ([]*projectmemoryv1.RetrieveContextResponse, error) {
+		stream, err := client.RetrieveContext(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		var results []*projectmemoryv1.RetrieveContextResponse
+		for {
+			result, err := stream.Recv()
+			if err == io.EOF {
+				return results, nil
+			}
+			if err != nil {
+				return results, err
+			}
+			results = append(results, result)
+		}
+	}
+
+	results, err := retrieve(&projectmemoryv1.RetrieveContextRequest{Query: "The API uses JWT tokens", Limit: 5})
+	if err != nil {
+		t.Fatalf("RetrieveContext failed: %v", err)
+	}
+	if len(results) != 2 || results[0].GetId() != ids[1] || results[0].GetSummary() != "The API uses JWT tokens" {
+		t.Fatalf("Expected both entries, the closest first, got %v", results)
+	}
+	results, err = retrieve(&projectmemoryv1.RetrieveContextRequest{Query: "JWT", Since: timestamppb.New(time.Now().Add(time.Hour))})
+	if err != nil || len(results) != 0 {
+		t.Errorf("Expected no entries saved after an hour from now, got %v, %v", results, err)
+	}
+	if _, err := retrieve(&projectmemoryv1.RetrieveContextRequest{Query: "JWT", Dedup: "unknown"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for an unknown dedup mode, got %v", err)
+	}
+
+	if _, err := client.DeleteContext(ctx, &projectmemoryv1.DeleteContextRequest{Id: ids[0]}); err != nil {
+		t.Fatalf("DeleteContext failed: %v", err)
+	}
+	results, err = retrieve(&projectmemoryv1.RetrieveContextRequest{Query: "Deploys"})
+	if err != nil || len(results) != 1 || results[0].GetId() != ids[1] {
+		t.Errorf("Expected only the remaining entry after DeleteContext, got %v, %v", results, err)
+	}
+
+	if _, err := client.GetStats(ctx, &projectmemoryv1.GetStatsRequest{}); err != nil {
+		t.Errorf("GetStats failed: %v", err)
+	}
+}
+
+func TestGRPCNamespaceAuthorization(t *testing.T) {
+	store := contextstore.NewMemoryContextStore()
+
+	srv := NewContextToolServer(store, &MockSummarizer{}, vector.NewMockEmbedder(8))
+	srv.SetAuthenticator(auth.NewAPIKeyAuthenticator(map[string]auth.Identity{
+		"docs-key": {Subject: "docs-bot", Namespaces: []string{"docs"}},
+	}))
+	if err := srv.SetGRPC("0.0.0.0:0", ""); err != nil {
+		t.Fatalf("SetGRPC failed: %v", err)
+	}
+	client := newGRPCTestClient(t, srv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := client.GetStats(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer wrong"), &projectmemoryv1.GetStatsRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Expected Unauthenticated with an unknown key, got %v", err)
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer docs-key")
+
+	if _, err := client.SaveContext(ctx, &projectmemoryv1.SaveContextRequest{Text: "The docs site builds with Hugo", Namespace: "docs"}); err != nil {
+		t.Fatalf("Expected a save to an allowed namespace to succeed, got %v", err)
+	}
+	if _, err := client.SaveContext(ctx, &projectmemoryv1.SaveContextRequest{Text: "Secret"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected PermissionDenied for the default namespace, got %v", err)
+	}
+
+	stream, err := client.RetrieveContext(ctx, &projectmemoryv1.RetrieveContextRequest{Query: "Hugo", Namespace: "docs"})
+	if err != nil {
+		t.Fatalf("RetrieveContext failed: %v", err)
+	}
+	if result, err := stream.Recv(); err != nil || result.GetSummary() != "The docs site builds with Hugo" {
+		t.Errorf("Expected the docs entry, got %v, %v", result, err)
+	}
+	stream, err = client.RetrieveContext(ctx, &projectmemoryv1.RetrieveContextRequest{Query: "Hugo"})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected PermissionDenied for a search of every namespace, got %v", err)
+	}
+	if _, err := client.DeleteContext(ctx, &projectmemoryv1.DeleteContextRequest{Id: "any"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected PermissionDenied for a delete, got %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/summarizer"
+)
+
+// DefaultHealthReportInterval is how often the health report is sent when
+// no interval is configured.
+const DefaultHealthReportInterval = 5 * time.Minute
+
+// healthReportTimeout bounds each POST of the health report
+const healthReportTimeout = 10 * time.Second
+
+// ErrHealthReportRejected is returned when an endpoint answers a health
+// report with a non-2xx status.
+var ErrHealthReportRejected = errors.New("health report rejected by endpoint")
+
+// HealthReport is the server health sent to a HealthSink
+type HealthReport struct {
+	Status         summarizer.HealthStatus `json:"status"`
+	Timestamp      time.Time               `json:"timestamp"`
+	ActiveRequests int                     `json:"active_requests"`
+
+	// Summarizer is the summarizer's report, if it checks providers
+	Summarizer *summarizer.HealthReport `json:"summarizer,omitempty"`
+}
+
+// HealthSink receives the JSON health report on every interval. The usage
+// report is sent to the same kinds of sink.
+type HealthSink interface {
+	// Send delivers one report
+	Send(report []byte) error
+}
+
+// LogHealthSink logs each report at info level with Message, by default
+// "Health report", to Logger, by default slog.Default()
+type LogHealthSink struct {
+	Message string
+	Logger  *slog.Logger
+}
+
+// Send logs the report, as a string if it is not JSON
+func (l LogHealthSink) Send(report []byte) error {
+	message := l.Message
+	if message == "" {
+		message = "Health report"
+	}
+	logger := l.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if !json.Valid(report) {
+		logger.Info(message, "report", string(report))
+		return nil
+	}
+	logger.Info(message, "report", json.RawMessage(report))
+	return nil
+}
+
+// FileHealthSink replaces the file at Path with each report, so the file
+// always holds one complete report
+type FileHealthSink struct {
+	Path string
+}
+
+// Send writes the report next to Path and renames it into place
+func (f FileHealthSink) Send(report []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(f.Path), filepath.Base(f.Path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create health report file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(report); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write health report: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write health report: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.Path); err != nil {
+		return fmt.Errorf("failed to replace health report file: %w", err)
+	}
+	return nil
+}
+
+// HTTPHealthSink POSTs each report to URL as ContentType, by default
+// application/json
+type HTTPHealthSink struct {
+	URL         string
+	ContentType string
+	Client      *http.Client
+}
+
+// Send POSTs the report
+func (h HTTPHealthSink) Send(report []byte) error {
+	client := h.Client
+	if client == nil {
+		client = &http.Client{Timeout: healthReportTimeout}
+	}
+
+	contentType := h.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	resp, err := client.Post(h.URL, contentType, bytes.NewReader(report))
+	if err != nil {
+		return fmt.Errorf("failed to send health report: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: %s", ErrHealthReportRejected, resp.Status)
+	}
+	return nil
+}
+
+// SetHealthReporting sends the health report to sink every interval while
+// the server runs. A nil sink sends nothing; an interval of 0 uses
+// DefaultHealthReportInterval. It must be called before Start.
+func (s *MCPContextToolServer) SetHealthReporting(interval time.Duration, sink HealthSink) {
+	if interval <= 0 {
+		interval = DefaultHealthReportInterval
+	}
+	s.healthReportInterval = interval
+	s.healthSink = sink
+}
+
+// reportHealth sends the health report to sink every interval until stop
+// is closed.
+func (s *MCPContextToolServer) reportHealth(interval time.Duration, sink HealthSink, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := s.sendHealthReport(sink); err != nil {
+				s.logger.Warn("Failed to send health report", "error", err)
+			}
+		}
+	}
+}
+
+// probeHealth probes the summarizer's providers now and then every
+// interval until stop is closed
+func (s *MCPContextToolServer) probeHealth(prober summarizer.HealthProber, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		health := prober.CheckProviderHealth()
+		s.logger.Debug("Probed summarizer providers", "providers", health)
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendHealthReport builds the health report and sends it to sink
+func (s *MCPContextToolServer) sendHealthReport(sink HealthSink) error {
+	report := HealthReport{
+		Status:         summarizer.StatusHealthy,
+		Timestamp:      time.Now(),
+		ActiveRequests: len(s.requests.snapshot(time.Now())),
+	}
+
+	// Checking providers sends each of them a short request, unless they
+	// are probed in the background
+	if reporter, ok := s.summarizer.(summarizer.HealthReporter); ok {
+		summarizerReport, err := reporter.HealthReport()
+		if err != nil {
+			return fmt.Errorf("failed to check summarizer health: %w", err)
+		}
+		report.Summarizer = summarizerReport
+		report.Status = summarizerReport.Status
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal health report: %w", err)
+	}
+	return sink.Send(data)
+}
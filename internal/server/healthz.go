@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/localrivet/projectmemory/internal/summarizer"
+	"github.com/localrivet/projectmemory/internal/tools"
+)
+
+const (
+	// HealthzPath answers whether the server is alive. It fails only when
+	// the store is unreachable, since restarting cannot fix a provider.
+	HealthzPath = "/healthz"
+
+	// ReadyzPath answers whether the server can serve requests. It fails
+	// whenever a component is unhealthy.
+	ReadyzPath = "/readyz"
+)
+
+// ComponentHealth is the health of one component in a HealthCheck
+type ComponentHealth struct {
+	Status summarizer.HealthStatus `json:"status"`
+
+	// Detail explains a status other than healthy
+	Detail string `json:"detail,omitempty"`
+
+	// Providers maps each LLM provider of the summarizer to its health
+	Providers map[string]summarizer.HealthStatus `json:"providers,omitempty"`
+}
+
+// HealthCheck is the body of /healthz and /readyz: the worst status of
+// the components and the health of each
+type HealthCheck struct {
+	Status     summarizer.HealthStatus    `json:"status"`
+	Components map[string]ComponentHealth `json:"components"`
+}
+
+// checkComponents checks the store and the embedder, and judges the
+// summarizer's providers by their recent calls and background probes, so
+// frequent probes of the endpoints never call a provider. The embedder
+// check gives up once ctx is done.
+func (s *MCPContextToolServer) checkComponents(ctx context.Context) HealthCheck {
+	check := HealthCheck{Status: summarizer.StatusHealthy, Components: map[string]ComponentHealth{}}
+
+	health, detail := s.checkStoreHealth()
+	check.Components[tools.ComponentStore] = ComponentHealth{Status: health, Detail: detail}
+
+	health, detail = s.checkEmbedderHealth(ctx)
+	check.Components[tools.ComponentEmbedder] = ComponentHealth{Status: health, Detail: detail}
+
+	check.Components[tools.ComponentSummarizer] = s.cachedSummarizerHealth()
+
+	for _, component := range check.Components {
+		if healthRank(string(component.Status)) > healthRank(string(check.Status)) {
+			check.Status = component.Status
+		}
+	}
+	return check
+}
+
+// cachedSummarizerHealth returns the summarizer's health from what it
+// already knows: unhealthy when no provider is, degraded when some are not
+// or the monthly budget is spent. Summarizers without providers are healthy.
+func (s *MCPContextToolServer) cachedSummarizerHealth() ComponentHealth {
+	reporter, ok := s.summarizer.(summarizer.LoadReporter)
+	if !ok {
+		return ComponentHealth{Status: summarizer.StatusHealthy}
+	}
+	load := reporter.Load()
+
+	component := ComponentHealth{Status: summarizer.StatusHealthy, Providers: load.Providers}
+	var failing []string
+	for name, health := range load.Providers {
+		if health != summarizer.StatusHealthy {
+			failing = append(failing, name)
+		}
+	}
+	sort.Strings(failing)
+	switch {
+	case len(failing) > 0 && len(failing) == len(load.Providers):
+		component.Status = summarizer.StatusUnhealthy
+		component.Detail = "every provider is failing: " + strings.Join(failing, ", ")
+	case len(failing) > 0:
+		component.Status = summarizer.StatusDegraded
+		component.Detail = "failing providers: " + strings.Join(failing, ", ")
+	case load.OverBudget:
+		component.Status = summarizer.StatusDegraded
+		component.Detail = "monthly budget spent; summarizing without a provider"
+	}
+	return component
+}
+
+// healthHandler returns the handler of /healthz or /readyz. Both answer
+// with the JSON HealthCheck, with 503 when failed judges it a failure.
+func (s *MCPContextToolServer) healthHandler(failed func(HealthCheck) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		check := s.checkComponents(r.Context())
+		body, err := json.Marshal(check)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to encode health: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if failed(check) {
+			s.logger.Warn("Health check failed", "path", r.URL.Path, "status", check.Status)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write(body)
+	})
+}
+
+// handleHealth serves /healthz and /readyz on mux
+func (s *MCPContextToolServer) handleHealth(mux *http.ServeMux) {
+	mux.Handle(HealthzPath, s.healthHandler(func(check HealthCheck) bool {
+		return check.Components[tools.ComponentStore].Status == summarizer.StatusUnhealthy
+	}))
+	mux.Handle(ReadyzPath, s.healthHandler(func(check HealthCheck) bool {
+		return check.Status == summarizer.StatusUnhealthy
+	}))
+}
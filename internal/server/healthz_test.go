@@ -0,0 +1,66 @@
+//go:build cgo && !purego
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/summarizer"
+	"github.com/localrivet/projectmemory/internal/tools"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	store := contextstore.NewSQLiteContextStore()
+	if err := store.Initialize(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+	defer store.Close()
+
+	sum := &loadedSummarizer{load: summarizer.Load{Providers: map[string]summarizer.HealthStatus{
+		"anthropic": summarizer.StatusHealthy,
+		"openai":    summarizer.StatusUnhealthy,
+	}}}
+	srv := NewContextToolServer(store, sum, &MockEmbedder{})
+	get := func(path string) (int, HealthCheck) {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		srv.metricsHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		var check HealthCheck
+		if err := json.Unmarshal(recorder.Body.Bytes(), &check); err != nil {
+			t.Fatalf("Failed to decode %s: %v: %s", path, err, recorder.Body)
+		}
+		return recorder.Code, check
+	}
+
+	// A failing fallback provider degrades the server without failing it
+	code, check := get(ReadyzPath)
+	if code != http.StatusOK || check.Status != summarizer.StatusDegraded {
+		t.Errorf("Expected a degraded, ready server, got %d %+v", code, check)
+	}
+	if summarizerHealth := check.Components[tools.ComponentSummarizer]; summarizerHealth.Detail != "failing providers: openai" || len(summarizerHealth.Providers) != 2 {
+		t.Errorf("Expected the failing provider in the detail, got %+v", summarizerHealth)
+	}
+
+	// Without any provider, the server is not ready but still alive
+	sum.load.Providers["anthropic"] = summarizer.StatusUnhealthy
+	if code, check := get(ReadyzPath); code != http.StatusServiceUnavailable || check.Status != summarizer.StatusUnhealthy {
+		t.Errorf("Expected /readyz to fail without providers, got %d %+v", code, check)
+	}
+	if code, _ := get(HealthzPath); code != http.StatusOK {
+		t.Errorf("Expected /healthz to pass without providers, got %d", code)
+	}
+
+	// An unreachable store fails both
+	store.Close()
+	if code, check := get(HealthzPath); code != http.StatusServiceUnavailable || check.Components[tools.ComponentStore].Detail == "" {
+		t.Errorf("Expected /healthz to fail with a closed store, got %d %+v", code, check)
+	}
+	if code, _ := get(ReadyzPath); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz to fail with a closed store, got %d", code)
+	}
+}
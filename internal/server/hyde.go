@@ -0,0 +1,47 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/hyde"
+	"github.com/localrivet/projectmemory/internal/telemetry"
+)
+
+// ErrHyDEUnavailable is returned for a retrieve_context request asking for
+// a hypothetical answer from a server without a drafter.
+var ErrHyDEUnavailable = errors.New("hyde is not configured on this server")
+
+// SetDrafter sets the drafter retrieve_context asks for a hypothetical
+// answer to its query, whose embedding is searched with in place of the
+// query's. With always, every request is drafted for; otherwise only the
+// requests that ask for it. nil, the default, searches with the query's
+// embedding. It must be called before Start.
+func (s *MCPContextToolServer) SetDrafter(d hyde.Drafter, always bool) {
+	s.drafter = d
+	s.hydeAlways = always
+}
+
+// drafts reports whether a query asking for a hypothetical answer or not
+// is searched with one
+func (s *MCPContextToolServer) drafts(requested bool) bool {
+	return s.drafter != nil && (requested || s.hydeAlways)
+}
+
+// draftAnswer asks the drafter for a hypothetical answer to query. If it
+// fails, ok is false, and the failure is logged and counted: the query is
+// then searched with its own embedding.
+func (s *MCPContextToolServer) draftAnswer(ctx context.Context, query string) (draft string, ok bool) {
+	start := time.Now()
+	draft, err := s.drafter.Draft(ctx, query)
+	s.metrics.RecordTimer(telemetry.MetricHyDEDuration, time.Since(start))
+	if err != nil {
+		s.metrics.IncrementCounter(telemetry.MetricHyDEFailures, 1)
+		s.logger.Warn("Failed to draft a hypothetical answer, searching with the query", "error", err)
+		return "", false
+	}
+	s.metrics.IncrementCounter(telemetry.MetricHyDECalls, 1)
+	s.logger.Debug("Drafted a hypothetical answer", "length", len(draft))
+	return draft, true
+}
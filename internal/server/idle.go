@@ -0,0 +1,72 @@
+package server
+
+import (
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/summarizer"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+// DefaultIdleTimeout is how long the server waits without tool calls before
+// releasing idle resources.
+const DefaultIdleTimeout = 10 * time.Minute
+
+// minIdleCheckInterval bounds how often the idle timer checks for activity
+const minIdleCheckInterval = time.Second
+
+// SetIdleRelease sets how long the server waits without tool calls before
+// closing idle provider connections and shrinking caches. 0 never releases
+// them. With releaseStore, the store also checkpoints its write-ahead log
+// and gives back memory. It must be called before Start.
+func (s *MCPContextToolServer) SetIdleRelease(timeout time.Duration, releaseStore bool) {
+	s.idleTimeout = timeout
+	s.idleReleaseStore = releaseStore
+}
+
+// watchIdle releases idle resources once the server has gone timeout without
+// a tool call, and again after each later burst of calls, until stop is
+// closed.
+func (s *MCPContextToolServer) watchIdle(timeout time.Duration, stop <-chan struct{}) {
+	interval := timeout / 4
+	if interval < minIdleCheckInterval {
+		interval = minIdleCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var releasedAt time.Time
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if s.requests.runIfIdle(now.Add(-timeout), releasedAt, s.releaseIdle) {
+				releasedAt = now
+			}
+		}
+	}
+}
+
+// releaseIdle releases the idle resources of the summarizer, the embedder
+// and, if configured, the store. Failures are logged rather than returned,
+// since every component stays usable.
+func (s *MCPContextToolServer) releaseIdle() {
+	s.logger.Debug("Releasing idle resources")
+
+	if releaser, ok := s.summarizer.(summarizer.IdleReleaser); ok {
+		if err := releaser.ReleaseIdle(); err != nil {
+			s.logger.Warn("Failed to release idle summarizer resources", "error", err)
+		}
+	}
+	if releaser, ok := s.embedder.(vector.IdleReleaser); ok {
+		if err := releaser.ReleaseIdle(); err != nil {
+			s.logger.Warn("Failed to release idle embedder resources", "error", err)
+		}
+	}
+	if releaser, ok := s.store.(contextstore.IdleReleaser); ok && s.idleReleaseStore {
+		if err := releaser.ReleaseIdle(); err != nil {
+			s.logger.Warn("Failed to release idle store resources", "error", err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"slices"
+
+	"github.com/localrivet/projectmemory/internal/retrieval"
+	"github.com/localrivet/projectmemory/internal/telemetry"
+)
+
+// SetInjectionMode sets whether retrieve_context looks for instructions
+// planted in retrieved summaries, and whether it scrubs them before the
+// agent reads them. The default, retrieval.InjectionOff, returns summaries
+// as stored. It must be called before Start.
+func (s *MCPContextToolServer) SetInjectionMode(mode retrieval.InjectionMode) {
+	s.injectionMode = mode
+}
+
+// checkInjections counts and logs the suspected instructions in results,
+// whose IDs are ids when the store reports them, and returns them scrubbed
+// if the injection mode asks for it. results itself is left alone, since
+// the store may share it.
+func (s *MCPContextToolServer) checkInjections(results, ids []string) []string {
+	if s.injectionMode != retrieval.InjectionDetect && s.injectionMode != retrieval.InjectionScrub {
+		return results
+	}
+
+	checked := results
+	if s.injectionMode == retrieval.InjectionScrub {
+		checked = slices.Clone(results)
+	}
+	for i, result := range results {
+		scrubbed, injections := retrieval.ScrubInjections(result)
+		if len(injections) == 0 {
+			continue
+		}
+
+		var patterns []string
+		for _, injection := range injections {
+			patterns = append(patterns, injection.Patterns...)
+		}
+		id := ""
+		if i < len(ids) {
+			id = ids[i]
+		}
+		s.metrics.IncrementCounter(telemetry.MetricInjectionsDetected, int64(len(injections)))
+		s.logger.Warn("Retrieved context holds a possible prompt injection",
+			"id", id, "patterns", patterns, "mode", s.injectionMode)
+
+		if s.injectionMode == retrieval.InjectionScrub {
+			checked[i] = scrubbed
+			s.metrics.IncrementCounter(telemetry.MetricInjectionsScrubbed, 1)
+		}
+	}
+	return checked
+}
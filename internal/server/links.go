@@ -0,0 +1,196 @@
+package server
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/localrivet/gomcp/server"
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/errortypes"
+	"github.com/localrivet/projectmemory/internal/links"
+	"github.com/localrivet/projectmemory/internal/tools"
+)
+
+// ErrMissingPath is returned when retrieve_by_file names no file.
+var ErrMissingPath = errors.New("path is required")
+
+// SetLinks indexes the repository at root, so saved and replaced text is
+// linked to the files and Go symbols it mentions, and rebuilds the index
+// every refresh while the server runs. A refresh of 0 indexes the
+// repository once. It must be called before Start.
+func (s *MCPContextToolServer) SetLinks(root string, refresh time.Duration) error {
+	index, err := links.Build(root)
+	if err != nil {
+		return err
+	}
+	s.linkIndex.Store(index)
+	s.linkRefresh = refresh
+	s.logger.Info("Indexed repository for links", "root", index.Root(), "files", index.Files())
+	return nil
+}
+
+// refreshLinks rebuilds the repository index every interval until stop is
+// closed. A failed rebuild keeps the previous index.
+func (s *MCPContextToolServer) refreshLinks(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		index, err := links.Build(s.linkIndex.Load().Root())
+		if err != nil {
+			s.logger.Warn("Failed to refresh the repository index", "error", err)
+			continue
+		}
+		s.linkIndex.Store(index)
+		s.logger.Debug("Refreshed the repository index", "files", index.Files())
+	}
+}
+
+// recordReferences records the repository files and symbols text mentions
+// as the references of an entry, if a repository is indexed and the store
+// can. References found earlier are replaced, even by none. The entry is
+// already stored, so a failure is only logged.
+func (s *MCPContextToolServer) recordReferences(id string, text string) {
+	index := s.linkIndex.Load()
+	references, ok := s.store.(contextstore.ReferenceStore)
+	if index == nil || !ok {
+		return
+	}
+	if err := references.SetReferences(id, index.Find(text)); err != nil {
+		s.logger.Warn("Failed to record the references of an entry", "id", id, "error", err)
+	}
+}
+
+// handleRetrieveByFile handles the retrieve_by_file MCP tool call.
+func (s *MCPContextToolServer) handleRetrieveByFile(ctx *server.Context, req tools.RetrieveByFileRequest) (tools.RetrieveByFileResponse, error) {
+	s.logger.Info("Processing retrieve_by_file request", "path", req.Path, "limit", req.Limit)
+	call := s.beginCall(ctx, tools.ToolRetrieveByFile)
+	defer call.end()
+
+	response := tools.RetrieveByFileResponse{
+		Status:  "success",
+		Paths:   []string{},
+		Results: []tools.LinkedResult{},
+	}
+
+	// Resolve the schema version the client was built against
+	version, err := tools.ResolveSchemaVersion(req.Version)
+	if err != nil {
+		err = errortypes.ValidationError(err, "invalid retrieve_by_file request").
+			WithField("version", req.Version)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+	response.Version = version
+
+	// Validate the request's fields
+	if invalid := s.validateRetrieveByFile(req); invalid != nil {
+		response.Status = "error"
+		response.Error = s.rejectRequest(tools.ToolRetrieveByFile, invalid).Error()
+		response.FieldErrors = invalid.fields
+		return response, nil
+	}
+
+	// Linking needs a store that records references
+	references, isReferenceStore := s.store.(contextstore.ReferenceStore)
+	name := strings.TrimSpace(req.Path)
+	if !isReferenceStore {
+		err = errortypes.ValidationError(contextstore.ErrReferencesUnsupported, "invalid retrieve_by_file request")
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = tools.DefaultRetrieveByFileLimit
+	}
+
+	// The index finds the files a partial path names. Without one, the
+	// path is taken to be from the repository root.
+	if index := s.linkIndex.Load(); index != nil {
+		response.Paths = append(response.Paths, index.Resolve(name)...)
+	} else {
+		response.Paths = append(response.Paths, path.Clean(strings.TrimPrefix(filepath.ToSlash(name), "/")))
+	}
+
+	call.setStage(tools.StageSearching)
+	type fileEntry struct {
+		path  string
+		entry contextstore.LinkedEntry
+	}
+	var found []fileEntry
+	for _, file := range response.Paths {
+		linked, err := references.ListReferencing(file)
+		if err != nil {
+			err = errortypes.DatabaseError(err, "failed to list context referencing a file").
+				WithField("path", file)
+			errortypes.LogError(s.logger, err)
+
+			response.Status = "error"
+			response.Error = err.Error()
+			return response, nil
+		}
+		for _, entry := range linked {
+			found = append(found, fileEntry{path: file, entry: entry})
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].entry.Timestamp.After(found[j].entry.Timestamp)
+	})
+	if len(found) > limit {
+		found = found[:limit]
+	}
+
+	results := make([]tools.LinkedResult, len(found))
+	for i, linked := range found {
+		results[i] = tools.LinkedResult{
+			ID:        linked.entry.ID,
+			Title:     linked.entry.Title,
+			Summary:   linked.entry.SummaryText,
+			Timestamp: linked.entry.Timestamp.Format(time.RFC3339),
+			Path:      linked.path,
+		}
+		for _, reference := range linked.entry.References {
+			if reference.Symbol != "" {
+				results[i].Symbols = append(results[i].Symbols, reference.Symbol)
+			}
+		}
+	}
+
+	// Stored summaries can carry instructions aimed at the agent
+	ids := make([]string, len(results))
+	summaries := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.ID
+		summaries[i] = result.Summary
+	}
+	summaries = s.checkInjections(summaries, ids)
+	provenance := s.resultProvenance(ids)
+	for i := range results {
+		results[i].Summary = summaries[i]
+		if i < len(provenance) {
+			results[i].Source = entrySource(provenance[i])
+		}
+	}
+	s.recordRetrievals(ids)
+
+	response.Results = append(response.Results, results...)
+	s.logger.Info("Retrieved context by file", "path", name, "files", len(response.Paths), "count", len(results))
+	return response.ForVersion(version), nil
+}
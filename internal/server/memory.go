@@ -0,0 +1,74 @@
+package server
+
+import (
+	"runtime/debug"
+	"runtime/metrics"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/summarizer"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+// DefaultMemoryCheckInterval is how often the server compares its live heap
+// with the memory limit.
+const DefaultMemoryCheckInterval = 30 * time.Second
+
+// heapLiveMetric is the runtime/metrics sample holding the bytes of heap
+// occupied by live objects as of the last garbage collection
+const heapLiveMetric = "/gc/heap/live:bytes"
+
+// SetMemoryPressure sets the live heap size in bytes above which the server
+// shrinks the summarizer's and embedder's caches and returns the freed
+// memory to the operating system, checked every interval. A limit of 0
+// never shrinks them; an interval of 0 uses DefaultMemoryCheckInterval. It
+// must be called before Start.
+func (s *MCPContextToolServer) SetMemoryPressure(limit uint64, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultMemoryCheckInterval
+	}
+	s.memoryLimit = limit
+	s.memoryCheckInterval = interval
+}
+
+// watchMemory checks the live heap against limit every interval until stop
+// is closed.
+func (s *MCPContextToolServer) watchMemory(limit uint64, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.checkMemory(limit)
+		}
+	}
+}
+
+// checkMemory shrinks the caches if the live heap is above limit, and
+// reports whether it did.
+func (s *MCPContextToolServer) checkMemory(limit uint64) bool {
+	sample := []metrics.Sample{{Name: heapLiveMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return false
+	}
+	live := sample[0].Value.Uint64()
+	if live <= limit {
+		return false
+	}
+
+	s.logger.Info("Shrinking caches under memory pressure", "heap_live_bytes", live, "limit_bytes", limit)
+	if shrinker, ok := s.summarizer.(summarizer.CacheShrinker); ok {
+		shrinker.ShrinkCache()
+	}
+	if shrinker, ok := s.embedder.(vector.CacheShrinker); ok {
+		shrinker.ShrinkCache()
+	}
+
+	// Collect the dropped entries now rather than at the next cycle, and
+	// hand the pages back so the process actually gets smaller
+	debug.FreeOSMemory()
+	return true
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/localrivet/gomcp/server"
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/errortypes"
+	"github.com/localrivet/projectmemory/internal/summarizer"
+	"github.com/localrivet/projectmemory/internal/tools"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+// healthProbeText is embedded to check the embedder. It never changes, so
+// a caching embedder may answer it without calling its provider.
+const healthProbeText = "memory_health probe"
+
+// handleMemoryHealth handles the memory_health MCP tool call. Unlike
+// memory_status, it checks each component: the summarizer's providers are
+// sent a short request unless they were probed recently, the embedder
+// embeds a probe text and the store is pinged.
+func (s *MCPContextToolServer) handleMemoryHealth(ctx *server.Context, req tools.MemoryHealthRequest) (tools.MemoryHealthResponse, error) {
+	s.logger.Debug("Processing memory_health request")
+
+	response := tools.MemoryHealthResponse{
+		Status:     "success",
+		Components: map[string]string{},
+		Problems:   map[string]string{},
+	}
+
+	// Resolve the schema version the client was built against
+	version, err := tools.ResolveSchemaVersion(req.Version)
+	if err != nil {
+		err = errortypes.ValidationError(err, "invalid memory_health request").
+			WithField("version", req.Version)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		response.Components = nil
+		response.Problems = nil
+		return response, nil
+	}
+	response.Version = version
+
+	// The summarizer's own report, the one CreateHealthReportJSON renders,
+	// covers its providers, cache and budget. Summarizers without one need
+	// no provider.
+	health := summarizer.StatusHealthy
+	if reporter, ok := s.summarizer.(summarizer.HealthReporter); ok {
+		report, err := reporter.HealthReport()
+		if err == nil {
+			response.Summarizer, err = json.Marshal(report)
+		}
+		if err != nil {
+			health = summarizer.StatusUnhealthy
+			response.Problems[tools.ComponentSummarizer] = err.Error()
+		} else {
+			health = report.Status
+		}
+	}
+	response.Components[tools.ComponentSummarizer] = string(health)
+
+	callCtx, cancel := s.callContext(ctx)
+	defer cancel()
+	health, problem := s.checkEmbedderHealth(callCtx)
+	response.Components[tools.ComponentEmbedder] = string(health)
+	if problem != "" {
+		response.Problems[tools.ComponentEmbedder] = problem
+	}
+
+	health, problem = s.checkStoreHealth()
+	response.Components[tools.ComponentStore] = string(health)
+	if problem != "" {
+		response.Problems[tools.ComponentStore] = problem
+	}
+
+	response.Health = string(summarizer.StatusHealthy)
+	for _, component := range response.Components {
+		if healthRank(component) > healthRank(response.Health) {
+			response.Health = component
+		}
+	}
+	if response.Health != string(summarizer.StatusHealthy) {
+		s.logger.Warn("Memory health check found problems", "health", response.Health, "problems", response.Problems)
+	}
+	return response, nil
+}
+
+// checkEmbedderHealth embeds the probe text and returns the embedder's
+// health, with the problem found if it is not healthy. An embedding from a
+// fallback provider would be quarantined on save, so it is degraded. An
+// embedder still busy when ctx is done is unhealthy.
+func (s *MCPContextToolServer) checkEmbedderHealth(ctx context.Context) (summarizer.HealthStatus, string) {
+	embedding, err := vector.CreateEmbeddingContext(ctx, s.embedder, healthProbeText)
+	if err == nil {
+		err = vector.ValidateEmbedding(embedding.Vector)
+	}
+	if err != nil {
+		return summarizer.StatusUnhealthy, err.Error()
+	}
+	if embedding.Fallback {
+		return summarizer.StatusDegraded, "embedded by fallback provider " + embedding.Provider
+	}
+	return summarizer.StatusHealthy, ""
+}
+
+// checkStoreHealth pings the store, if it can be pinged, and returns its
+// health with the problem found if it is not healthy
+func (s *MCPContextToolServer) checkStoreHealth() (summarizer.HealthStatus, string) {
+	if pinger, ok := s.store.(contextstore.Pinger); ok {
+		if err := pinger.Ping(); err != nil {
+			return summarizer.StatusUnhealthy, err.Error()
+		}
+	}
+	return summarizer.StatusHealthy, ""
+}
+
+// healthRank orders health statuses from healthy to unhealthy
+func healthRank(health string) int {
+	switch summarizer.HealthStatus(health) {
+	case summarizer.StatusHealthy:
+		return 0
+	case summarizer.StatusDegraded:
+		return 1
+	}
+	return 2
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/telemetry"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+const (
+	// MetricsPath is the path Prometheus scrapes
+	MetricsPath = "/metrics"
+
+	// metricsShutdownTimeout bounds the wait for scrapes in flight when the
+	// server stops
+	metricsShutdownTimeout = 5 * time.Second
+)
+
+// SetMetrics serves the metrics of the server, its summarizer, its
+// embedders and its store operations at GET /metrics on addr, such as
+// ":9464", in the Prometheus text format. The metrics hold no memory
+// content, so the endpoint is not authenticated. It must be called before
+// Start.
+func (s *MCPContextToolServer) SetMetrics(addr string) error {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return fmt.Errorf("invalid metrics address %q: %w", addr, err)
+	}
+	s.metricsAddr = addr
+	return nil
+}
+
+// metricsCollectors returns the collectors of the server and of whichever
+// summarizer and embedders collect their own metrics
+func (s *MCPContextToolServer) metricsCollectors() []*telemetry.MetricsCollector {
+	collectors := []*telemetry.MetricsCollector{s.metrics}
+	if source, ok := s.summarizer.(telemetry.MetricsSource); ok {
+		collectors = append(collectors, source.GetMetrics())
+	}
+	// A cache wraps the fallback embedder, and each collects its own
+	embedder := s.embedder
+	for embedder != nil {
+		if source, ok := embedder.(telemetry.MetricsSource); ok {
+			collectors = append(collectors, source.GetMetrics())
+		}
+		wrapper, ok := embedder.(interface{ Unwrap() vector.Embedder })
+		if !ok {
+			break
+		}
+		embedder = wrapper.Unwrap()
+	}
+	return collectors
+}
+
+// metricsHandler returns the handler of the metrics endpoint, which also
+// answers health checks
+func (s *MCPContextToolServer) metricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, telemetry.PrometheusHandler(s.metricsCollectors()...))
+	s.handleHealth(mux)
+	return mux
+}
+
+// serveMetrics listens on the metrics address and serves scrapes until
+// stop is closed
+func (s *MCPContextToolServer) serveMetrics(stop <-chan struct{}) error {
+	listener, err := net.Listen("tcp", s.metricsAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for metrics scrapes: %w", err)
+	}
+
+	httpServer := &http.Server{
+		Handler:           s.metricsHandler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          slog.NewLogLogger(s.logger.Handler(), slog.LevelError),
+	}
+
+	go func() {
+		if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("Metrics endpoint failed", "error", err)
+		}
+	}()
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		<-stop
+		ctx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+		defer cancel()
+		httpServer.Shutdown(ctx)
+	}()
+
+	s.logger.Info("Serving metrics", "addr", listener.Addr().String(), "path", MetricsPath)
+	return nil
+}
+
+// recordStoreOperation records how long a store operation started at start
+// took, and counts it as an error if err is not nil
+func (s *MCPContextToolServer) recordStoreOperation(operation string, start time.Time, err error) {
+	s.metrics.RecordTimer(telemetry.MetricStoreDurationPrefix+operation, time.Since(start))
+	if err != nil {
+		s.metrics.IncrementCounter(telemetry.MetricStoreErrorsPrefix+operation, 1)
+	}
+}
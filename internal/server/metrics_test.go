@@ -0,0 +1,63 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/summarizer"
+	"github.com/localrivet/projectmemory/internal/tools"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	store := contextstore.NewMemoryContextStore()
+	if err := store.Initialize(""); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+	embedder := vector.NewCachedEmbedder(vector.NewMockEmbedder(16), vector.EmbeddingCacheConfig{})
+	srv := NewContextToolServer(store, summarizer.NewBasicSummarizer(200), embedder)
+
+	if resp, _ := srv.handleSaveContext(nil, tools.SaveContextRequest{ContextText: "Deploys go through make release"}); resp.Status != "success" {
+		t.Fatalf("Save failed: %+v", resp)
+	}
+	if resp, _ := srv.handleRetrieveContext(nil, tools.RetrieveContextRequest{Query: "Deploys go through make release", Limit: 1}); resp.Status != "success" {
+		t.Fatalf("Retrieve failed: %+v", resp)
+	}
+
+	recorder := httptest.NewRecorder()
+	srv.metricsHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, MetricsPath, nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", recorder.Code)
+	}
+	body := recorder.Body.String()
+	for _, want := range []string{
+		"# TYPE projectmemory_store_duration_seconds histogram\n",
+		`projectmemory_store_duration_seconds_count{operation="save"} 1` + "\n",
+		`projectmemory_store_duration_seconds_count{operation="search"} 1` + "\n",
+		"projectmemory_embedder_cache_misses_total 1\n",
+		"projectmemory_embedder_cache_hits_total 1\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected the metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+
+	recorder = httptest.NewRecorder()
+	srv.metricsHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, MetricsPath, nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for a POST, got %d", recorder.Code)
+	}
+}
+
+func TestSetMetrics(t *testing.T) {
+	srv := NewContextToolServer(nil, nil, nil)
+	if err := srv.SetMetrics("9464"); err == nil {
+		t.Errorf("Expected an address without a port to be rejected")
+	}
+	if err := srv.SetMetrics(":9464"); err != nil {
+		t.Errorf("SetMetrics failed: %v", err)
+	}
+}
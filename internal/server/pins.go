@@ -0,0 +1,138 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/localrivet/gomcp/server"
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/errortypes"
+	"github.com/localrivet/projectmemory/internal/tools"
+)
+
+var (
+	// ErrMissingID is returned when a request names no entry.
+	ErrMissingID = errors.New("id is required")
+
+	// ErrTooManyPinned is returned by pin_context when tools.MaxPinned
+	// entries are pinned already.
+	ErrTooManyPinned = fmt.Errorf("at most %d entries can be pinned", tools.MaxPinned)
+)
+
+// searchPinned returns the pinned entries search finds that pass filter,
+// best first, for retrieve_context to include whatever their score. Stores
+// that cannot pin entries have none.
+func (s *MCPContextToolServer) searchPinned(search searchFunc, filter contextstore.SearchFilter) ([]QueryResult, error) {
+	pins, ok := s.store.(contextstore.PinStore)
+	if !ok {
+		return nil, nil
+	}
+	pinned, err := pins.ListPinned(filter.Namespace)
+	if errors.Is(err, contextstore.ErrPinsUnsupported) {
+		return nil, nil
+	}
+	if err != nil || len(pinned) == 0 {
+		return nil, err
+	}
+
+	filter.Pinned = true
+	found, err := search(len(pinned), filter)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]QueryResult, len(found))
+	for i, result := range found {
+		results[i] = QueryResult{ID: result.ID, Summary: result.SummaryText, Score: result.Similarity, Timestamp: result.Timestamp, Pinned: true}
+	}
+	s.recordRetrievals(resultIDs(results))
+	return results, nil
+}
+
+// handlePinContext handles the pin_context MCP tool call.
+func (s *MCPContextToolServer) handlePinContext(ctx *server.Context, req tools.PinContextRequest) (tools.PinContextResponse, error) {
+	s.logger.Info("Processing pin_context request", "id", req.ID, "unpin", req.Unpin)
+	call := s.beginCall(ctx, tools.ToolPinContext)
+	defer call.end()
+
+	response := tools.PinContextResponse{
+		Status: "success",
+	}
+
+	// Resolve the schema version the client was built against
+	version, err := tools.ResolveSchemaVersion(req.Version)
+	if err != nil {
+		err = errortypes.ValidationError(err, "invalid pin_context request").
+			WithField("version", req.Version)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+	response.Version = version
+
+	// Validate the request's fields
+	if invalid := s.validatePinContext(req); invalid != nil {
+		response.Status = "error"
+		response.Error = s.rejectRequest(tools.ToolPinContext, invalid).Error()
+		response.FieldErrors = invalid.fields
+		return response, nil
+	}
+
+	// Pins need a store that can hold them
+	store, ok := s.store.(contextstore.PinStore)
+	id := strings.TrimSpace(req.ID)
+	if !ok {
+		err = errortypes.ValidationError(contextstore.ErrPinsUnsupported, "invalid pin_context request").
+			WithField("context_id", req.ID)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	// Every pinned entry is returned by every retrieval, so their number
+	// is capped
+	if !req.Unpin {
+		call.setStage(tools.StageListing)
+		pinned, err := store.ListPinned("")
+		if err != nil {
+			err = errortypes.DatabaseError(err, "failed to list pinned context").
+				WithField("context_id", id)
+			errortypes.LogError(s.logger, err)
+
+			response.Status = "error"
+			response.Error = err.Error()
+			return response, nil
+		}
+		if len(pinned) >= tools.MaxPinned && !slices.Contains(pinned, id) {
+			err = errortypes.ValidationError(ErrTooManyPinned, "invalid pin_context request").
+				WithField("context_id", id).
+				WithField("pinned", len(pinned))
+			errortypes.LogError(s.logger, err)
+
+			response.Status = "error"
+			response.Error = err.Error()
+			return response, nil
+		}
+	}
+
+	call.setStage(tools.StageStoring)
+	if err := store.SetPinned(id, !req.Unpin); err != nil {
+		err = errortypes.DatabaseError(err, "failed to pin context").
+			WithField("context_id", id).
+			WithField("unpin", req.Unpin)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	response.Pinned = !req.Unpin
+	s.logger.Info("Successfully pinned context", "id", id, "pinned", response.Pinned)
+	return response, nil
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/localrivet/gomcp/server"
+)
+
+// errNoTransport is returned when a message is sent before the MCP server
+// is serving
+var errNoTransport = errors.New("MCP server is not serving")
+
+// progressReporter sends the MCP progress notifications of one tool call,
+// for a client that asked for them by giving the call a progress token. A
+// slow call then shows each stage it enters, and what it found, instead of
+// a silent wait.
+type progressReporter struct {
+	token  json.RawMessage
+	send   func(message []byte) error
+	logger *slog.Logger
+
+	mu       sync.Mutex
+	progress int
+}
+
+// progressNotification is a notifications/progress message
+type progressNotification struct {
+	JSONRPC string         `json:"jsonrpc"`
+	Method  string         `json:"method"`
+	Params  progressParams `json:"params"`
+}
+
+// progressParams are the parameters of a progress notification. Progress
+// increases with each notification of a call; the total is unknown.
+type progressParams struct {
+	ProgressToken json.RawMessage `json:"progressToken"`
+	Progress      int             `json:"progress"`
+	Message       string          `json:"message,omitempty"`
+}
+
+// report sends the next progress notification with message. Failures are
+// logged: progress is a courtesy and never fails the call.
+func (p *progressReporter) report(message string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.progress++
+	notification, err := json.Marshal(progressNotification{
+		JSONRPC: "2.0",
+		Method:  "notifications/progress",
+		Params:  progressParams{ProgressToken: p.token, Progress: p.progress, Message: message},
+	})
+	if err == nil {
+		err = p.send(notification)
+	}
+	if err != nil {
+		p.logger.Debug("Failed to send progress notification", "message", message, "error", err)
+	}
+}
+
+// progressToken returns the progress token of an MCP request, a string or
+// a number, or nil if the client asked for no progress notifications
+func progressToken(ctx *server.Context) json.RawMessage {
+	if ctx == nil || ctx.Request == nil || len(ctx.Request.Params) == 0 {
+		return nil
+	}
+	var params struct {
+		Meta struct {
+			ProgressToken json.RawMessage `json:"progressToken"`
+		} `json:"_meta"`
+	}
+	if err := json.Unmarshal(ctx.Request.Params, &params); err != nil {
+		return nil
+	}
+	var token interface{}
+	if err := json.Unmarshal(params.Meta.ProgressToken, &token); err != nil {
+		return nil
+	}
+	switch token.(type) {
+	case string, float64:
+		return params.Meta.ProgressToken
+	}
+	return nil
+}
+
+// beginCall records the start of an MCP call to tool, like
+// requestTracker.begin. If the client gave the request a progress token,
+// the call sends a progress notification for each stage it enters.
+func (s *MCPContextToolServer) beginCall(ctx *server.Context, tool string) *trackedRequest {
+	call := s.requests.begin(tool)
+	if token := progressToken(ctx); token != nil {
+		call.progress = &progressReporter{token: token, send: s.sendMessage, logger: s.logger}
+	}
+	return call
+}
+
+// sendMessage sends a message to the MCP client
+func (s *MCPContextToolServer) sendMessage(message []byte) error {
+	if s.mcpServer == nil {
+		return errNoTransport
+	}
+	transport := s.mcpServer.GetServer().GetTransport()
+	if transport == nil {
+		return errNoTransport
+	}
+	return transport.Send(message)
+}
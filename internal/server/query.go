@@ -0,0 +1,436 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/errortypes"
+	"github.com/localrivet/projectmemory/internal/retrieval"
+	"github.com/localrivet/projectmemory/internal/tools"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+// Query is a search of the stored context: the text to search for and how
+// to filter and rank what it finds. retrieve_context runs one for each
+// call, mapping its request fields onto it.
+type Query struct {
+	// Text is what to search for
+	Text string
+
+	// Queries are further texts searched as well as Text, each on its own
+	// with the query's other settings. Their results are merged by
+	// retrieval.FuseRanks and scored by it, pinned entries still first,
+	// and up to the limit are returned. Text may be empty when Queries
+	// are given.
+	Queries []string
+
+	// Namespace restricts the search to one namespace and selects whose
+	// retrieval defaults apply. Empty searches every namespace with the
+	// defaults of contextstore.DefaultNamespace.
+	Namespace string
+
+	// Limit is the most results returned. 0 uses the namespace's default,
+	// then tools.DefaultRetrieveLimit. With MaxTokens and no Limit, it is
+	// the highest limit the request limits allow.
+	Limit int
+
+	// MaxTokens bounds the tokens of the results' summaries together: the
+	// best results are kept while they fit, as the server's tokenizer
+	// counts them. 0 leaves the results unbounded.
+	MaxTokens int
+
+	// Adaptive returns fewer results than Limit when there is a sharp
+	// drop in relevance, and up to twice Limit when scores are flat
+	Adaptive bool
+
+	// MinScore drops results less similar to Text than this, between 0
+	// and 1. 0 uses the namespace's default.
+	MinScore float64
+
+	// Tags restricts the search to entries carrying at least one of these
+	// tags, and ExcludeTags drops entries carrying any of them
+	Tags        []string
+	ExcludeTags []string
+
+	// Session restricts the search to the entries saved in one agent
+	// session. It needs a store that implements contextstore.SessionStore.
+	Session string
+
+	// ExcludeIDs lists entries that must not be returned
+	ExcludeIDs []string
+
+	// Since and Until restrict the search to entries saved at or after
+	// Since and before Until. Either may be zero.
+	Since time.Time
+	Until time.Time
+
+	// KnownIDs and KnownHashes identify entries the caller already has,
+	// by ID or by contextstore.ContentHash of their summary. Dedup selects
+	// whether they are excluded, tools.DedupExclude and the default, or
+	// moved behind the others, tools.DedupDownrank.
+	KnownIDs    []string
+	KnownHashes []string
+	Dedup       string
+
+	// Rerank has the server's reranker pick the results from the best
+	// candidates. Servers reranking every query rerank it either way.
+	Rerank bool
+
+	// Expand searches the server's query expander's other phrasings of
+	// Text as well, scoring each entry by its similarity to the closest
+	// one. Servers expanding every query expand it either way.
+	Expand bool
+
+	// HyDE searches with the embedding of the server's drafter's
+	// hypothetical answer to Text in place of Text's, so scores are
+	// similarities to the answer. Servers drafting for every query draft
+	// for it either way.
+	HyDE bool
+
+	// Mode is how the context is searched: tools.SearchModeVector, the
+	// default, or tools.SearchModeKeyword, which searches the store's
+	// keyword index for the words of Text without embedding it. Keyword
+	// searches score entries by BM25 and cannot set MinScore, Expand, HyDE
+	// or HybridWeights.
+	Mode string
+
+	// RecencyHalfLife, RecencyFloor and HybridWeights override the
+	// namespace's ranking when set
+	RecencyHalfLife time.Duration
+	RecencyFloor    float64
+	HybridWeights   retrieval.HybridWeights
+}
+
+// QueryResult is an entry found by a Query
+type QueryResult struct {
+	// ID identifies the entry. It is empty if the store cannot report IDs.
+	ID string
+
+	// Summary is the stored summary, checked for planted instructions as
+	// the server's injection mode asks
+	Summary string
+
+	// Score is how well the entry matches: its similarity to the query,
+	// or its ranking score if the namespace's ranking reranks, or its
+	// fused score for several queries. It is 0 if the store cannot score
+	// results.
+	Score float64
+
+	// Timestamp is when the entry was saved. It is zero if the store
+	// cannot report it.
+	Timestamp time.Time
+
+	// Pinned reports that the entry is pinned, so it is returned first
+	// whatever its score
+	Pinned bool
+}
+
+// Query runs q against the stored context. Failures are errortypes
+// errors: a validation error for an invalid query, an API error if the
+// embedder fails and a database error if the store does.
+func (s *MCPContextToolServer) Query(ctx context.Context, q Query) ([]QueryResult, error) {
+	call := s.requests.begin(tools.ToolRetrieveContext)
+	defer call.end()
+
+	v := s.validator()
+	v.query(q)
+	if invalid := v.err(); invalid != nil {
+		return nil, errortypes.ValidationError(invalid, "invalid query")
+	}
+
+	queryCtx, cancel := s.boundContext(ctx)
+	defer cancel()
+	return s.query(queryCtx, call, q)
+}
+
+// query runs a validated query, reporting its stages on call. Several
+// texts are searched one after another and their results fused.
+func (s *MCPContextToolServer) query(ctx context.Context, call *trackedRequest, q Query) ([]QueryResult, error) {
+	texts := q.texts()
+	rankings := make([][]QueryResult, len(texts))
+	for i, text := range texts {
+		search := q
+		search.Text, search.Queries = text, nil
+		found, err := s.searchText(ctx, call, search)
+		if err != nil {
+			return nil, err
+		}
+		rankings[i] = found
+	}
+
+	results := rankings[0]
+	if len(rankings) > 1 {
+		results = fuseQueries(rankings, s.resultLimit(q))
+		s.logger.Debug("Fused the results of several queries", "queries", len(texts), "results", len(results))
+	}
+	if q.MaxTokens > 0 {
+		results = s.packTokens(results, q.MaxTokens)
+	}
+	if len(texts) == 1 {
+		s.queries.Record(texts[0], len(results))
+	} else {
+		for i, text := range texts {
+			s.queries.Record(text, len(rankings[i]))
+		}
+	}
+	return results, nil
+}
+
+// resultLimit returns the most results q asks for: its Limit, the highest
+// limit allowed when a token budget rather than a limit bounds them, or
+// the default of its namespace, then tools.DefaultRetrieveLimit
+func (s *MCPContextToolServer) resultLimit(q Query) int {
+	if q.Limit > 0 {
+		return q.Limit
+	}
+	if q.MaxTokens > 0 {
+		return s.limits.MaxLimit
+	}
+	namespace := strings.TrimSpace(q.Namespace)
+	if namespace == "" {
+		namespace = contextstore.DefaultNamespace
+	}
+	if limit := s.retrievalDefaults[namespace].Limit; limit > 0 {
+		return limit
+	}
+	return tools.DefaultRetrieveLimit
+}
+
+// texts returns the texts q searches: Text unless it is blank, then its
+// Queries
+func (q Query) texts() []string {
+	var texts []string
+	if strings.TrimSpace(q.Text) != "" {
+		texts = append(texts, q.Text)
+	}
+	return append(texts, q.Queries...)
+}
+
+// searchText searches the stored context for the text of a validated
+// query, leaving its token budget to query
+func (s *MCPContextToolServer) searchText(ctx context.Context, call *trackedRequest, q Query) ([]QueryResult, error) {
+	// Settings the query leaves out come from its namespace's defaults,
+	// then from the server-wide defaults
+	namespace := strings.TrimSpace(q.Namespace)
+	if namespace == "" {
+		namespace = contextstore.DefaultNamespace
+	}
+	defaults := s.retrievalDefaults[namespace]
+	if q.RecencyHalfLife > 0 {
+		defaults.RecencyHalfLife = q.RecencyHalfLife
+	}
+	if q.RecencyFloor > 0 {
+		defaults.RecencyFloor = q.RecencyFloor
+	}
+	if q.HybridWeights != (retrieval.HybridWeights{}) {
+		defaults.HybridWeights = q.HybridWeights
+	}
+
+	limit := s.resultLimit(q)
+	minScore := q.MinScore
+	if minScore == 0 {
+		minScore = defaults.MinScore
+	}
+	if limit != q.Limit || minScore != q.MinScore {
+		s.logger.Debug("Using default settings for query", "namespace", namespace, "limit", limit, "min_score", minScore)
+	}
+
+	// Build exclusion and deduplication options
+	options := newSearchOptions(q)
+	options.minScore = minScore
+	options.ranking = defaults
+	if q.Rerank && s.reranker == nil {
+		return nil, errortypes.ValidationError(ErrRerankUnavailable, "invalid query").
+			WithField("rerank", true)
+	}
+	options.rerank = s.reranks(q.Rerank)
+	if q.Expand && s.expander == nil {
+		return nil, errortypes.ValidationError(ErrExpansionUnavailable, "invalid query").
+			WithField("expand", true)
+	}
+	if q.HyDE && s.drafter == nil {
+		return nil, errortypes.ValidationError(ErrHyDEUnavailable, "invalid query").
+			WithField("hyde", true)
+	}
+	if _, ok := s.store.(contextstore.SessionStore); options.filter.Session != "" && !ok {
+		return nil, errortypes.ValidationError(contextstore.ErrSessionsUnsupported, "invalid query").
+			WithField("session_id", q.Session)
+	}
+	keyword := q.Mode == tools.SearchModeKeyword
+	if keyword {
+		// Namespace defaults compare embeddings too
+		options.minScore = 0
+		options.ranking.HybridWeights = retrieval.HybridWeights{}
+	} else if options.needsScores() {
+		if _, ok := s.store.(contextstore.ScoredSearcher); !ok {
+			return nil, errortypes.ValidationError(contextstore.ErrScoresUnsupported, "invalid query").
+				WithField("namespace", q.Namespace).
+				WithField("min_score", minScore)
+		}
+	}
+
+	// Keyword searches look the query's words up in the store's index,
+	// vector searches compare its embedding with the entries'
+	var search, pinnedSearch searchFunc
+	var queryEmbedding []float32
+	var err error
+	if keyword {
+		keywords, ok := s.store.(contextstore.KeywordSearcher)
+		if !ok {
+			return nil, errortypes.ValidationError(contextstore.ErrKeywordSearchUnsupported, "invalid query").
+				WithField("mode", q.Mode)
+		}
+		search = keywordSearch(keywords, q.Text)
+		pinnedSearch = search
+	} else {
+		// A hypothetical answer is worded like the entries answering the
+		// query, so its embedding lands closer to them than the query's
+		searchText := q.Text
+		if s.drafts(q.HyDE) {
+			call.setStage(tools.StageDrafting)
+			if draft, ok := s.draftAnswer(ctx, q.Text); ok {
+				searchText = draft
+			}
+		}
+
+		// Create embedding for query
+		call.setStage(tools.StageEmbedding)
+		var sourced vector.SourcedEmbedding
+		sourced, err = vector.CreateEmbeddingContext(ctx, s.embedder, searchText)
+		queryEmbedding = sourced.Vector
+		if err == nil {
+			err = vector.ValidateEmbedding(queryEmbedding)
+		}
+		if err != nil {
+			return nil, errortypes.APIError(err, "failed to create embedding for query").
+				WithField("query", q.Text)
+		}
+
+		// Other phrasings of the query find entries worded unlike it.
+		// Pinned entries are searched with the query alone.
+		embeddings := [][]float32{queryEmbedding}
+		if s.expands(q.Expand) {
+			call.setStage(tools.StageExpanding)
+			embeddings = append(embeddings, s.expandQuery(ctx, q.Text)...)
+		}
+		if scored, ok := s.store.(contextstore.ScoredSearcher); ok {
+			search = vectorSearch(scored, embeddings...)
+			pinnedSearch = vectorSearch(scored, queryEmbedding)
+		}
+	}
+
+	// Search context store
+	call.setStage(tools.StageSearching)
+	var results, pinned []QueryResult
+	searchStart := time.Now()
+	if search != nil {
+		// Pinned entries come first, whatever their score, and are not
+		// returned twice
+		pinned, err = s.searchPinned(pinnedSearch, options.filter)
+		if err == nil {
+			excluded := append([]string{}, options.filter.ExcludeIDs...)
+			for _, result := range pinned {
+				excluded = append(excluded, result.ID)
+			}
+			options.filter.ExcludeIDs = excluded
+			results, err = s.searchScored(ctx, search, limit, options)
+		}
+	}
+	if !keyword && (search == nil || errors.Is(err, contextstore.ErrScoresUnsupported) && !options.needsScores()) {
+		// Stores that cannot score results are searched without options
+		var summaries []string
+		pinned, results = nil, nil
+		summaries, err = s.store.Search(queryEmbedding, limit)
+		for _, summary := range summaries {
+			results = append(results, QueryResult{Summary: summary})
+		}
+	}
+	if keyword && errors.Is(err, contextstore.ErrKeywordSearchUnsupported) {
+		return nil, errortypes.ValidationError(err, "invalid query").
+			WithField("mode", q.Mode)
+	}
+	s.recordStoreOperation("search", searchStart, err)
+	if err != nil {
+		return nil, errortypes.DatabaseError(err, "failed to search context store").
+			WithField("limit", limit)
+	}
+
+	// A query that only found pinned entries is still a gap
+	found := len(results)
+	results = append(pinned, results...)
+	call.report(fmt.Sprintf("found %d entries", len(results)))
+
+	// Stored summaries can carry instructions aimed at the agent
+	summaries := make([]string, len(results))
+	for i, result := range results {
+		summaries[i] = result.Summary
+	}
+	summaries = s.checkInjections(summaries, resultIDs(results))
+	for i := range results {
+		results[i].Summary = summaries[i]
+	}
+	if found == 0 {
+		s.recordGap(namespace, q.Text)
+	}
+	return results, nil
+}
+
+// fuseQueries merges the results of several queries by reciprocal rank
+// fusion, each entry once with its fused score. Pinned entries come first,
+// and up to limit are kept, or as many as the longest of rankings if
+// adaptive limits returned more.
+func fuseQueries(rankings [][]QueryResult, limit int) []QueryResult {
+	keyed := make([][]string, len(rankings))
+	entries := make(map[string]QueryResult)
+	count := limit
+	for i, ranking := range rankings {
+		count = max(count, len(ranking))
+		keyed[i] = make([]string, len(ranking))
+		for j, result := range ranking {
+			key := result.ID
+			if key == "" {
+				key = "summary:" + result.Summary
+			}
+			keyed[i][j] = key
+			if entry, ok := entries[key]; !ok || result.Pinned && !entry.Pinned {
+				entries[key] = result
+			}
+		}
+	}
+
+	keys, scores := retrieval.FuseRanks(keyed)
+	var pinned, results []QueryResult
+	for i, key := range keys {
+		result := entries[key]
+		result.Score = scores[i]
+		if result.Pinned {
+			pinned = append(pinned, result)
+		} else {
+			results = append(results, result)
+		}
+	}
+	results = append(pinned, results...)
+	if len(results) > count {
+		results = results[:count]
+	}
+	return results
+}
+
+// resultIDs returns the ID of each result, or nil if the store reported
+// none
+func resultIDs(results []QueryResult) []string {
+	ids := make([]string, len(results))
+	reported := false
+	for i, result := range results {
+		ids[i] = result.ID
+		reported = reported || result.ID != ""
+	}
+	if !reported {
+		return nil
+	}
+	return ids
+}
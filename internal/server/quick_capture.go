@@ -0,0 +1,263 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/auth"
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/tools"
+)
+
+const (
+	// QuickCapturePath is the path hotkey scripts POST text to
+	QuickCapturePath = "/quick-capture"
+
+	// QuickCaptureSource is the source recorded for captured entries that
+	// name none
+	QuickCaptureSource = "quick-capture"
+
+	// quickCaptureQueueSize is the most captures waiting to be saved
+	quickCaptureQueueSize = 64
+
+	// quickCaptureMaxBytes bounds the body of a capture
+	quickCaptureMaxBytes = 1 << 20
+
+	// quickCaptureShutdownTimeout bounds the wait for captures in flight
+	// when the server stops
+	quickCaptureShutdownTimeout = 5 * time.Second
+)
+
+var (
+	// ErrQuickCaptureToken is returned when the quick-capture endpoint is
+	// configured without a token or an authenticator.
+	ErrQuickCaptureToken = errors.New("quick-capture token is required")
+
+	// ErrQuickCaptureAddr is returned when the quick-capture endpoint would
+	// listen on an address other than a loopback one.
+	ErrQuickCaptureAddr = errors.New("quick-capture address must be a loopback address")
+
+	// errQuickCaptureQueueFull answers captures while the queue is full
+	errQuickCaptureQueueFull = errors.New("capture queue is full")
+)
+
+// QuickCaptureRequest is the JSON body of a capture. A text/plain body is
+// the text itself, with tags, source and untrusted in the query string
+// instead. Untrusted marks third-party text, as in save_context.
+type QuickCaptureRequest struct {
+	Text      string   `json:"text"`
+	Tags      []string `json:"tags,omitempty"`
+	Source    string   `json:"source,omitempty"`
+	Untrusted bool     `json:"untrusted,omitempty"`
+}
+
+// quickCapture accepts captures and queues them for saving
+type quickCapture struct {
+	server *MCPContextToolServer
+	queue  chan tools.SaveContextRequest
+}
+
+// SetQuickCapture serves POST /quick-capture on addr while the server runs.
+// Each request must carry token as a bearer token, or credentials the
+// authenticator set with SetAuthenticator accepts, which is required
+// without a token; its text is queued and saved like a save_context call
+// to the default namespace. addr must be a loopback address such as
+// "127.0.0.1:7077". It must be called before Start.
+func (s *MCPContextToolServer) SetQuickCapture(addr, token string) error {
+	if token == "" && s.authenticator == nil {
+		return ErrQuickCaptureToken
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid quick-capture address %q: %w", addr, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("%w: %s", ErrQuickCaptureAddr, addr)
+	}
+
+	s.quickCaptureAddr = addr
+	s.quickCaptureToken = token
+	return nil
+}
+
+// serveQuickCapture listens on the quick-capture address and saves the
+// captures it accepts until stop is closed
+func (s *MCPContextToolServer) serveQuickCapture(stop <-chan struct{}) error {
+	listener, err := net.Listen("tcp", s.quickCaptureAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for quick captures: %w", err)
+	}
+
+	if s.tlsConfig != nil {
+		listener = tls.NewListener(listener, s.tlsConfig)
+	}
+
+	capture := &quickCapture{server: s, queue: make(chan tools.SaveContextRequest, quickCaptureQueueSize)}
+	httpServer := &http.Server{
+		Handler:           s.quickCaptureHandler(capture),
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          slog.NewLogLogger(s.logger.Handler(), slog.LevelError),
+	}
+
+	// Captures accepted until the endpoint shuts down are saved before the
+	// server stops
+	closed := make(chan struct{})
+	s.background.Add(2)
+	go func() {
+		defer s.background.Done()
+		s.saveCaptures(capture.queue, closed)
+	}()
+	go func() {
+		if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("Quick-capture endpoint failed", "error", err)
+		}
+	}()
+	go func() {
+		defer s.background.Done()
+		defer close(closed)
+		<-stop
+		ctx, cancel := context.WithTimeout(context.Background(), quickCaptureShutdownTimeout)
+		defer cancel()
+		httpServer.Shutdown(ctx)
+	}()
+
+	s.logger.Info("Listening for quick captures", "addr", listener.Addr().String())
+	return nil
+}
+
+// quickCaptureHandler returns the handler of the quick-capture endpoint,
+// authenticating each request before capture accepts it. Health checks are
+// answered without authentication.
+func (s *MCPContextToolServer) quickCaptureHandler(capture *quickCapture) http.Handler {
+	var handler http.Handler = capture
+	if authenticator := s.transportAuthenticator(s.quickCaptureToken, "quick-capture-token"); authenticator != nil {
+		handler = auth.Middleware(authenticator, s.logger, handler)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(QuickCapturePath, handler)
+	s.handleHealth(mux)
+	return mux
+}
+
+// saveCaptures saves each queued capture until stop is closed, then saves
+// the captures still queued.
+func (s *MCPContextToolServer) saveCaptures(queue <-chan tools.SaveContextRequest, stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			if len(queue) > 0 {
+				s.logger.Info("Saving queued quick captures before stopping", "count", len(queue))
+			}
+			for len(queue) > 0 {
+				s.saveCapture(<-queue)
+			}
+			return
+		case req := <-queue:
+			s.saveCapture(req)
+		}
+	}
+}
+
+// saveCapture saves one capture like a save_context call. Tags and source
+// are dropped if the store cannot hold them, since the capture was already
+// accepted.
+func (s *MCPContextToolServer) saveCapture(req tools.SaveContextRequest) {
+	if _, canTag := s.store.(contextstore.TaggedStore); !canTag {
+		req.Tags = nil
+	}
+	if _, canTrace := s.store.(contextstore.ProvenanceStore); !canTrace {
+		req.Source = ""
+	}
+	response, err := s.handleSaveContext(nil, req)
+	if err != nil || response.Status != "success" {
+		s.logger.Warn("Failed to save quick capture", "error", response.Error, "handler_error", err)
+		return
+	}
+	s.logger.Info("Saved quick capture", "id", response.ID)
+}
+
+// ServeHTTP accepts one capture and queues it, answering 202 Accepted. A
+// caller that may not use the default namespace, or a server that does not
+// offer save_context, is answered 403 Forbidden.
+func (c *quickCapture) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := c.server.checkToolEnabled(tools.ToolSaveContext); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err := auth.Authorize(r.Context(), contextstore.DefaultNamespace); err != nil {
+		c.server.audit(r.Context(), "QuickCapture", contextstore.DefaultNamespace, err)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	capture, err := readCapture(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(capture.Text) == "" {
+		http.Error(w, "text is required", http.StatusBadRequest)
+		return
+	}
+	if capture.Source == "" {
+		capture.Source = QuickCaptureSource
+	}
+
+	select {
+	case c.queue <- tools.SaveContextRequest{ContextText: capture.Text, Tags: capture.Tags, Source: capture.Source, Untrusted: capture.Untrusted}:
+	default:
+		c.server.audit(r.Context(), "QuickCapture", contextstore.DefaultNamespace, errQuickCaptureQueueFull)
+		http.Error(w, errQuickCaptureQueueFull.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	c.server.audit(r.Context(), "QuickCapture", contextstore.DefaultNamespace, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(`{"status":"queued"}` + "\n"))
+}
+
+// readCapture reads a capture from a JSON or plain-text body
+func readCapture(w http.ResponseWriter, r *http.Request) (QuickCaptureRequest, error) {
+	var capture QuickCaptureRequest
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, quickCaptureMaxBytes))
+	if err != nil {
+		return capture, fmt.Errorf("failed to read capture: %w", err)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		if err := json.Unmarshal(body, &capture); err != nil {
+			return capture, fmt.Errorf("invalid capture: %w", err)
+		}
+		return capture, nil
+	}
+
+	capture.Text = string(body)
+	capture.Source = r.URL.Query().Get("source")
+	if tags := r.URL.Query().Get("tags"); tags != "" {
+		capture.Tags = strings.Split(tags, ",")
+	}
+	if untrusted := r.URL.Query().Get("untrusted"); untrusted != "" {
+		if capture.Untrusted, err = strconv.ParseBool(untrusted); err != nil {
+			return capture, fmt.Errorf("invalid untrusted: %w", err)
+		}
+	}
+	return capture, nil
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/localrivet/projectmemory/internal/auth"
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/summarizer"
+	"github.com/localrivet/projectmemory/internal/tools"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+func TestQuickCapture(t *testing.T) {
+	store := contextstore.NewMemoryContextStore()
+	if err := store.Initialize(""); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+	srv := NewContextToolServer(store, summarizer.NewBasicSummarizer(200), vector.NewMockEmbedder(16))
+	srv.SetAuthenticator(auth.NewAPIKeyAuthenticator(map[string]auth.Identity{"docs-key": {Subject: "docs-bot", Namespaces: []string{"docs"}}}))
+	if err := srv.SetQuickCapture("127.0.0.1:7077", "secret"); err != nil {
+		t.Fatalf("SetQuickCapture failed: %v", err)
+	}
+	capture := &quickCapture{server: srv, queue: make(chan tools.SaveContextRequest, 1)}
+	handler := srv.quickCaptureHandler(capture)
+	post := func(body, contentType, token, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, QuickCapturePath+query, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	if code := post("note", "text/plain", "", "").Code; code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a token, got %d", code)
+	}
+	if code := post("note", "text/plain", "wrong", "").Code; code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 with a wrong token, got %d", code)
+	}
+	if code := post("note", "text/plain", "docs-key", "").Code; code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a caller without the default namespace, got %d", code)
+	}
+	if code := post(`{"text":"  "}`, "application/json", "secret", "").Code; code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without text, got %d", code)
+	}
+	if code := post("note", "text/plain", "secret", "?untrusted=maybe").Code; code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid untrusted, got %d", code)
+	}
+
+	if code := post(`{"text":"Deploys go through make release","tags":["ops"]}`, "application/json", "secret", "").Code; code != http.StatusAccepted {
+		t.Fatalf("Expected 202 for a JSON capture, got %d", code)
+	}
+	if code := post("queue is full", "text/plain", "secret", "").Code; code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 with a full queue, got %d", code)
+	}
+	req := <-capture.queue
+	if req.ContextText != "Deploys go through make release" || len(req.Tags) != 1 || req.Source != QuickCaptureSource {
+		t.Errorf("Unexpected queued capture %+v", req)
+	}
+
+	if code := post("Plain text note", "text/plain; charset=utf-8", "secret", "?tags=a,b&source=raycast&untrusted=true").Code; code != http.StatusAccepted {
+		t.Fatalf("Expected 202 for a plain-text capture, got %d", code)
+	}
+	req = <-capture.queue
+	if req.ContextText != "Plain text note" || len(req.Tags) != 2 || req.Source != "raycast" || !req.Untrusted {
+		t.Errorf("Unexpected queued capture %+v", req)
+	}
+
+	// Queued captures are saved like save_context calls
+	srv.saveCapture(req)
+	entries, err := store.ListEntries()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Expected the capture to be saved, got %v, %v", entries, err)
+	}
+	if provenance := entries[0].Provenance; len(provenance) == 0 || provenance[0] != "raycast" {
+		t.Errorf("Expected the capture's source first in its provenance, got %v", provenance)
+	}
+}
+
+func TestSetQuickCapture(t *testing.T) {
+	srv := NewContextToolServer(nil, nil, nil)
+	if err := srv.SetQuickCapture("127.0.0.1:7077", ""); !errors.Is(err, ErrQuickCaptureToken) {
+		t.Errorf("Expected ErrQuickCaptureToken, got %v", err)
+	}
+	if err := srv.SetQuickCapture("0.0.0.0:7077", "secret"); !errors.Is(err, ErrQuickCaptureAddr) {
+		t.Errorf("Expected ErrQuickCaptureAddr, got %v", err)
+	}
+	for _, addr := range []string{"127.0.0.1:7077", "[::1]:7077", "localhost:7077"} {
+		if err := srv.SetQuickCapture(addr, "secret"); err != nil {
+			t.Errorf("Expected %s to be accepted, got %v", addr, err)
+		}
+	}
+	srv.SetAuthenticator(auth.NewAPIKeyAuthenticator(map[string]auth.Identity{"key": {Subject: "ci"}}))
+	if err := srv.SetQuickCapture("127.0.0.1:7077", ""); err != nil {
+		t.Errorf("Expected no token to be needed with an authenticator, got %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/localrivet/gomcp/server"
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/errortypes"
+	"github.com/localrivet/projectmemory/internal/tools"
+)
+
+var (
+	// ErrUnknownRelation is returned by link_context and get_linked_context
+	// for a relation type other than supersedes, elaborates and contradicts.
+	ErrUnknownRelation = fmt.Errorf("relation_type must be %q, %q or %q",
+		contextstore.RelationSupersedes, contextstore.RelationElaborates, contextstore.RelationContradicts)
+
+	// ErrSelfRelation is returned when link_context is asked to relate an
+	// entry to itself.
+	ErrSelfRelation = errors.New("an entry cannot be related to itself")
+
+	// ErrInvalidDepth is returned by get_linked_context for a negative
+	// depth or one above tools.MaxLinkDepth.
+	ErrInvalidDepth = fmt.Errorf("depth must be between 0 and %d", tools.MaxLinkDepth)
+)
+
+// relationType returns the normalized relation type of a request
+func relationType(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// knownRelation reports whether name is a relation type entries can be
+// linked with
+func knownRelation(name string) bool {
+	switch name {
+	case contextstore.RelationSupersedes, contextstore.RelationElaborates, contextstore.RelationContradicts:
+		return true
+	}
+	return false
+}
+
+// handleLinkContext handles the link_context MCP tool call.
+func (s *MCPContextToolServer) handleLinkContext(ctx *server.Context, req tools.LinkContextRequest) (tools.LinkContextResponse, error) {
+	s.logger.Info("Processing link_context request", "id", req.ID, "related_id", req.RelatedID, "relation_type", req.RelationType, "unlink", req.Unlink)
+	call := s.beginCall(ctx, tools.ToolLinkContext)
+	defer call.end()
+
+	response := tools.LinkContextResponse{
+		Status: "success",
+	}
+
+	// Resolve the schema version the client was built against
+	version, err := tools.ResolveSchemaVersion(req.Version)
+	if err != nil {
+		err = errortypes.ValidationError(err, "invalid link_context request").
+			WithField("version", req.Version)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+	response.Version = version
+
+	// Validate the request's fields
+	if invalid := s.validateLinkContext(req); invalid != nil {
+		response.Status = "error"
+		response.Error = s.rejectRequest(tools.ToolLinkContext, invalid).Error()
+		response.FieldErrors = invalid.fields
+		return response, nil
+	}
+
+	// Relations need a store that can hold them
+	store, ok := s.store.(contextstore.RelationStore)
+	relation := contextstore.Relation{
+		EntryID:   strings.TrimSpace(req.ID),
+		RelatedID: strings.TrimSpace(req.RelatedID),
+		Type:      relationType(req.RelationType),
+		CreatedAt: time.Now(),
+	}
+	if !ok {
+		err = errortypes.ValidationError(contextstore.ErrRelationsUnsupported, "invalid link_context request").
+			WithField("context_id", req.ID)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	call.setStage(tools.StageStoring)
+	if req.Unlink {
+		_, err = store.Unlink(relation.EntryID, relation.RelatedID, relation.Type)
+	} else {
+		err = store.Link(relation)
+	}
+	if err != nil {
+		appErr := errortypes.DatabaseError(err, "failed to link context")
+		if errors.Is(err, contextstore.ErrEntryNotFound) {
+			appErr = errortypes.ValidationError(err, "invalid link_context request")
+		}
+		appErr = appErr.WithField("context_id", relation.EntryID).
+			WithField("related_id", relation.RelatedID).
+			WithField("relation_type", relation.Type)
+		errortypes.LogError(s.logger, appErr)
+
+		response.Status = "error"
+		response.Error = appErr.Error()
+		return response, nil
+	}
+
+	response.Linked = !req.Unlink
+	s.logger.Info("Successfully linked context", "id", relation.EntryID, "related_id", relation.RelatedID,
+		"relation_type", relation.Type, "linked", response.Linked)
+	return response, nil
+}
+
+// handleGetLinkedContext handles the get_linked_context MCP tool call.
+func (s *MCPContextToolServer) handleGetLinkedContext(ctx *server.Context, req tools.GetLinkedContextRequest) (tools.GetLinkedContextResponse, error) {
+	s.logger.Info("Processing get_linked_context request", "id", req.ID, "relation_type", req.RelationType, "depth", req.Depth)
+	call := s.beginCall(ctx, tools.ToolGetLinkedContext)
+	defer call.end()
+
+	response := tools.GetLinkedContextResponse{
+		Status:  "success",
+		Results: []tools.LinkedContextResult{},
+	}
+
+	// Resolve the schema version the client was built against
+	version, err := tools.ResolveSchemaVersion(req.Version)
+	if err != nil {
+		err = errortypes.ValidationError(err, "invalid get_linked_context request").
+			WithField("version", req.Version)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+	response.Version = version
+
+	// Validate the request's fields
+	if invalid := s.validateGetLinkedContext(req); invalid != nil {
+		response.Status = "error"
+		response.Error = s.rejectRequest(tools.ToolGetLinkedContext, invalid).Error()
+		response.FieldErrors = invalid.fields
+		return response, nil
+	}
+
+	store, ok := s.store.(contextstore.RelationStore)
+	id := strings.TrimSpace(req.ID)
+	if !ok {
+		err = errortypes.ValidationError(contextstore.ErrRelationsUnsupported, "invalid get_linked_context request").
+			WithField("context_id", req.ID)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	depth := req.Depth
+	if depth <= 0 {
+		depth = 1
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = tools.DefaultLinkedContextLimit
+	}
+
+	call.setStage(tools.StageSearching)
+	results, err := followRelations(store, id, relationType(req.RelationType), depth, limit)
+	if err != nil {
+		appErr := errortypes.DatabaseError(err, "failed to list linked context")
+		if errors.Is(err, contextstore.ErrEntryNotFound) {
+			appErr = errortypes.ValidationError(err, "invalid get_linked_context request")
+		}
+		appErr = appErr.WithField("context_id", id)
+		errortypes.LogError(s.logger, appErr)
+
+		response.Status = "error"
+		response.Error = appErr.Error()
+		return response, nil
+	}
+
+	// Stored summaries can carry instructions aimed at the agent
+	ids := make([]string, len(results))
+	summaries := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.ID
+		summaries[i] = result.Summary
+	}
+	summaries = s.checkInjections(summaries, ids)
+	for i := range results {
+		results[i].Summary = summaries[i]
+	}
+	s.recordRetrievals(ids)
+
+	response.Results = append(response.Results, results...)
+	s.logger.Info("Retrieved linked context", "id", id, "depth", depth, "count", len(results))
+	return response, nil
+}
+
+// followRelations follows the relations of the entry id breadth first, up
+// to depth relations away and only those of relationType if it is set. It
+// returns each entry reached once, nearest first, up to limit. It returns
+// an error wrapping contextstore.ErrEntryNotFound if id is not stored.
+func followRelations(store contextstore.RelationStore, id, relationType string, depth, limit int) ([]tools.LinkedContextResult, error) {
+	results := []tools.LinkedContextResult{}
+	seen := map[string]bool{id: true}
+	frontier := []string{id}
+	for level := 1; level <= depth && len(frontier) > 0; level++ {
+		var next []string
+		for _, from := range frontier {
+			related, err := store.ListRelations(from)
+			if errors.Is(err, contextstore.ErrEntryNotFound) && from != id {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range related {
+				if seen[entry.ID] || (relationType != "" && entry.Type != relationType) {
+					continue
+				}
+				seen[entry.ID] = true
+				direction := tools.DirectionIncoming
+				if entry.Outgoing() {
+					direction = tools.DirectionOutgoing
+				}
+				results = append(results, tools.LinkedContextResult{
+					ID:           entry.ID,
+					Title:        entry.Title,
+					Summary:      entry.SummaryText,
+					Timestamp:    entry.Timestamp.Format(time.RFC3339),
+					From:         from,
+					RelationType: entry.Type,
+					Direction:    direction,
+					Depth:        level,
+				})
+				if len(results) == limit {
+					return results, nil
+				}
+				next = append(next, entry.ID)
+			}
+		}
+		frontier = next
+	}
+	return results, nil
+}
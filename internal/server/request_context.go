@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/localrivet/gomcp/server"
+)
+
+// mcpContext adapts a gomcp request context to context.Context. gomcp's
+// Context has the other methods of context.Context but an untyped Deadline.
+type mcpContext struct {
+	*server.Context
+}
+
+// Deadline returns the request's deadline, if it has one
+func (c mcpContext) Deadline() (time.Time, bool) {
+	deadline, ok := c.Context.Deadline()
+	if !ok {
+		return time.Time{}, false
+	}
+	t, ok := deadline.(time.Time)
+	return t, ok
+}
+
+// requestContext returns the context of an MCP request, so its
+// cancellation and deadline reach provider calls. Handlers called directly,
+// without a request, get a background context.
+func requestContext(ctx *server.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return mcpContext{ctx}
+}
+
+// DefaultRequestTimeout bounds each tool call, so a stuck summarizer or
+// embedding provider cannot hold a call, and the editor waiting on it,
+// forever.
+const DefaultRequestTimeout = 2 * time.Minute
+
+// SetRequestTimeout sets how long a tool call may run before its
+// summarizer and embedding calls are cancelled and it fails. A timeout of 0
+// leaves calls unbounded, apart from the client's own deadline. It must be
+// called before Start.
+func (s *MCPContextToolServer) SetRequestTimeout(timeout time.Duration) {
+	s.requestTimeout = timeout
+}
+
+// callContext returns the context of an MCP request bounded by the request
+// timeout. The caller must call cancel once the call is done.
+func (s *MCPContextToolServer) callContext(ctx *server.Context) (context.Context, context.CancelFunc) {
+	return s.boundContext(requestContext(ctx))
+}
+
+// boundContext returns parent bounded by the request timeout. The caller
+// must call cancel once the call is done.
+func (s *MCPContextToolServer) boundContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if s.requestTimeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, s.requestTimeout)
+}
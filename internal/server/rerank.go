@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/rerank"
+	"github.com/localrivet/projectmemory/internal/telemetry"
+)
+
+// ErrRerankUnavailable is returned for a retrieve_context request asking
+// for reranking from a server without a reranker.
+var ErrRerankUnavailable = errors.New("rerank is not configured on this server")
+
+// SetReranker sets the reranker retrieve_context asks to pick its results
+// from the best candidates, and how many candidates it is given; 0 uses
+// rerank.DefaultCandidates. With always, every request is reranked;
+// otherwise only the requests that ask for it. nil, the default, ranks
+// results by score alone. It must be called before Start.
+func (s *MCPContextToolServer) SetReranker(r rerank.Reranker, candidates int, always bool) {
+	if candidates <= 0 {
+		candidates = rerank.DefaultCandidates
+	}
+	s.reranker = r
+	s.rerankCandidates = candidates
+	s.rerankAlways = always
+}
+
+// reranks reports whether a query asking for reranking or not is reranked
+func (s *MCPContextToolServer) reranks(requested bool) bool {
+	return s.reranker != nil && (requested || s.rerankAlways)
+}
+
+// rerankResults asks the reranker for the limit candidates that best
+// answer query, out of the best rerankCandidates or limit, whichever is
+// more, and returns them and their scores in its order. The scores are
+// left as the store or ranking gave them. If the reranker fails or names
+// no candidate, the candidates are returned unchanged with ok false, and
+// the failure is logged and counted.
+func (s *MCPContextToolServer) rerankResults(ctx context.Context, query string, candidates []contextstore.SearchResult, scores []float64, limit int) (reranked []contextstore.SearchResult, rerankedScores []float64, ok bool) {
+	pool := candidates
+	if size := max(s.rerankCandidates, limit); len(pool) > size {
+		pool = pool[:size]
+	}
+	texts := make([]string, len(pool))
+	for i, candidate := range pool {
+		texts[i] = candidate.SummaryText
+	}
+
+	start := time.Now()
+	order, err := s.reranker.Rerank(ctx, query, texts, limit)
+	s.metrics.RecordTimer(telemetry.MetricRerankDuration, time.Since(start))
+	if err != nil {
+		s.metrics.IncrementCounter(telemetry.MetricRerankFailures, 1)
+		s.logger.Warn("Failed to rerank results, keeping their ranking", "candidates", len(pool), "error", err)
+		return candidates, scores, false
+	}
+	s.metrics.IncrementCounter(telemetry.MetricRerankCalls, 1)
+
+	reranked = make([]contextstore.SearchResult, 0, len(order))
+	rerankedScores = make([]float64, 0, len(order))
+	for _, index := range order {
+		if index < 0 || index >= len(pool) {
+			continue
+		}
+		reranked = append(reranked, pool[index])
+		rerankedScores = append(rerankedScores, scores[index])
+	}
+	s.logger.Debug("Reranked results", "candidates", len(pool), "kept", len(reranked))
+	return reranked, rerankedScores, true
+}
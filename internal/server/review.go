@@ -0,0 +1,219 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/localrivet/gomcp/server"
+	"github.com/localrivet/projectmemory/internal/cleanup"
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/errortypes"
+	"github.com/localrivet/projectmemory/internal/tools"
+)
+
+var (
+	// ErrUnknownReviewAction is returned by review_queue for an action
+	// other than confirm, refresh and retire.
+	ErrUnknownReviewAction = fmt.Errorf("action must be %q, %q or %q",
+		contextstore.ReviewConfirm, contextstore.ReviewRefresh, contextstore.ReviewRetire)
+
+	// ErrMissingRefreshText is returned when review_queue is asked to
+	// refresh an entry without its new text.
+	ErrMissingRefreshText = errors.New("context_text is required to refresh an entry")
+
+	// ErrEntryNotFound is returned when review_queue is asked to review an
+	// entry that is not stored.
+	ErrEntryNotFound = errors.New("context entry not found")
+)
+
+// SetReviewOptions sets which entries review_queue flags as due for
+// review. It must be called before Start.
+func (s *MCPContextToolServer) SetReviewOptions(options cleanup.StaleOptions) {
+	s.review = options
+}
+
+// handleReviewQueue handles the review_queue MCP tool call.
+func (s *MCPContextToolServer) handleReviewQueue(ctx *server.Context, req tools.ReviewQueueRequest) (tools.ReviewQueueResponse, error) {
+	s.logger.Info("Processing review_queue request", "action", req.Action, "id", req.ID, "limit", req.Limit)
+	call := s.beginCall(ctx, tools.ToolReviewQueue)
+	defer call.end()
+
+	response := tools.ReviewQueueResponse{
+		Status:  "success",
+		Entries: []tools.ReviewItem{},
+	}
+
+	// Resolve the schema version the client was built against
+	version, err := tools.ResolveSchemaVersion(req.Version)
+	if err != nil {
+		err = errortypes.ValidationError(err, "invalid review_queue request").
+			WithField("version", req.Version)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+	response.Version = version
+
+	// Validate the request's fields
+	if invalid := s.validateReviewQueue(req); invalid != nil {
+		response.Status = "error"
+		response.Error = s.rejectRequest(tools.ToolReviewQueue, invalid).Error()
+		response.FieldErrors = invalid.fields
+		return response, nil
+	}
+
+	// The queue needs a store that tracks usage and reviews
+	usage, isUsageStore := s.store.(contextstore.UsageStore)
+	reviews, isReviewStore := s.store.(contextstore.ReviewStore)
+	action := strings.ToLower(strings.TrimSpace(req.Action))
+	id := strings.TrimSpace(req.ID)
+	switch {
+	case !isUsageStore:
+		err = contextstore.ErrUsageUnsupported
+	case !isReviewStore:
+		err = contextstore.ErrReviewsUnsupported
+	}
+	if err != nil {
+		err = errortypes.ValidationError(err, "invalid review_queue request").
+			WithField("action", req.Action).
+			WithField("context_id", req.ID)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	// Refreshing and retiring replace and delete the entry, so they are
+	// disabled along with replace_context and delete_context
+	switch action {
+	case contextstore.ReviewRefresh:
+		err = s.checkToolEnabled(tools.ToolReplaceContext)
+	case contextstore.ReviewRetire:
+		err = s.checkToolEnabled(tools.ToolDeleteContext)
+	}
+	if err != nil {
+		err = errortypes.PermissionError(err, "review_queue cannot "+action+" entries").
+			WithField("context_id", req.ID)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = tools.DefaultReviewQueueLimit
+	}
+
+	call.setStage(tools.StageListing)
+	entries, err := usage.ListEntries()
+	if err != nil {
+		err = errortypes.DatabaseError(err, "failed to list context entries")
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	// Apply the reviewer's decision. Whichever it is, the entry leaves the
+	// queue: a confirmed entry is due again MinAgeMonths later, a refreshed
+	// one is new and a retired one is gone.
+	if action != "" {
+		stored := slices.IndexFunc(entries, func(entry contextstore.Entry) bool { return entry.ID == id })
+		if stored < 0 {
+			err = errortypes.ValidationError(ErrEntryNotFound, "invalid review_queue request").
+				WithField("context_id", id)
+			errortypes.LogError(s.logger, err)
+
+			response.Status = "error"
+			response.Error = err.Error()
+			return response, nil
+		}
+
+		switch action {
+		case contextstore.ReviewRefresh:
+			replaced, _ := s.handleReplaceContext(ctx, tools.ReplaceContextRequest{ID: id, ContextText: req.ContextText})
+			if replaced.Status != "success" {
+				response.Status = "error"
+				response.Error = replaced.Error
+				return response, nil
+			}
+		case contextstore.ReviewRetire:
+			call.setStage(tools.StageDeleting)
+			deleteStart := time.Now()
+			err = s.store.Delete(id)
+			s.recordStoreOperation("delete", deleteStart, err)
+			if err != nil {
+				err = errortypes.DatabaseError(err, "failed to retire context").
+					WithField("context_id", id)
+				errortypes.LogError(s.logger, err)
+
+				response.Status = "error"
+				response.Error = err.Error()
+				return response, nil
+			}
+		}
+
+		call.setStage(tools.StageStoring)
+		review := contextstore.Review{
+			ID:       id,
+			Action:   action,
+			Reviewer: strings.TrimSpace(req.Reviewer),
+			Note:     strings.TrimSpace(req.Note),
+			At:       time.Now(),
+		}
+		if err := reviews.RecordReview(review); err != nil {
+			err = errortypes.DatabaseError(err, "failed to record review").
+				WithField("context_id", id).
+				WithField("action", action)
+			errortypes.LogError(s.logger, err)
+
+			response.Status = "error"
+			response.Error = err.Error()
+			return response, nil
+		}
+		entries = slices.Delete(entries, stored, stored+1)
+		s.logger.Info("Recorded review", "id", id, "action", action, "reviewer", review.Reviewer)
+	}
+
+	call.setStage(tools.StageListing)
+	recorded, err := reviews.ListReviews("")
+	if err != nil {
+		err = errortypes.DatabaseError(err, "failed to list reviews")
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	stale := cleanup.FindStale(entries, recorded, s.review)
+	for i, entry := range stale {
+		if i == limit {
+			break
+		}
+		item := tools.ReviewItem{
+			ID:            entry.ID,
+			Title:         entry.Title,
+			Summary:       entry.SummaryText,
+			Timestamp:     entry.Timestamp.Format(time.RFC3339),
+			Retrievals:    entry.Retrievals,
+			LastRetrieved: entry.LastRetrieved.Format(time.RFC3339),
+		}
+		if !entry.LastReviewed.IsZero() {
+			item.LastReviewed = entry.LastReviewed.Format(time.RFC3339)
+		}
+		response.Entries = append(response.Entries, item)
+	}
+
+	s.logger.Info("Listed review queue", "entries", len(entries), "due", len(stale))
+	return response, nil
+}
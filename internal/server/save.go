@@ -0,0 +1,252 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/errortypes"
+	"github.com/localrivet/projectmemory/internal/summarizer"
+	"github.com/localrivet/projectmemory/internal/tools"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+// NewEntry is an entry saved by SaveEntry. Every field but Text may be empty.
+type NewEntry struct {
+	// Text is the text summarized and embedded into the entry
+	Text string
+
+	// Tags label the entry
+	Tags []string
+
+	// Source names where the text came from, and Via what saved it, such
+	// as contextstore.SourceAPI. Together they start the entry's
+	// provenance chain; an empty Via records the save_context tool.
+	Source string
+	Via    string
+
+	// Batch, Session and Namespace group the entry like the batch_id,
+	// session_id and namespace of save_context
+	Batch     string
+	Session   string
+	Namespace string
+
+	// Untrusted fences the text off from the summarizer's prompt
+	Untrusted bool
+
+	// MaxSummaryLength overrides the summarizer's summary length; 0 uses it
+	MaxSummaryLength int
+}
+
+// SavedEntry describes an entry saved by SaveEntry
+type SavedEntry struct {
+	ID    string
+	Title string
+
+	// Quarantined entries were embedded by a fallback provider and are
+	// kept out of the index until the primary provider re-embeds them
+	Quarantined bool
+
+	// SummaryUnavailable is set when the summarizer refused the text and it
+	// was stored verbatim
+	SummaryUnavailable bool
+}
+
+// SaveEntry summarizes, embeds and stores entry like save_context, without
+// the save limit: short text is stored as is, text the summarizer refuses
+// is stored verbatim, and an entry embedded by a fallback provider is
+// quarantined. Cancelling ctx stops the summarizer and embedding calls and
+// stores nothing. It returns contextstore.ErrTagsUnsupported,
+// ErrProvenanceUnsupported, ErrBatchesUnsupported, ErrSessionsUnsupported or
+// ErrNamespacesUnsupported if the store cannot record what entry asks for.
+func (s *MCPContextToolServer) SaveEntry(ctx context.Context, entry NewEntry) (SavedEntry, error) {
+	if err := s.unsupportedEntry(entry); err != nil {
+		s.logger.Error("Failed to save context", "source", entry.Source, "error", err)
+		return SavedEntry{}, err
+	}
+	return s.saveEntry(ctx, nil, entry)
+}
+
+// unsupportedEntry returns the error for the first thing entry asks for
+// that the store cannot record, or nil
+func (s *MCPContextToolServer) unsupportedEntry(entry NewEntry) error {
+	if _, ok := s.store.(contextstore.TaggedStore); len(entry.Tags) > 0 && !ok {
+		return contextstore.ErrTagsUnsupported
+	}
+	if _, ok := s.store.(contextstore.ProvenanceStore); strings.TrimSpace(entry.Source) != "" && !ok {
+		return contextstore.ErrProvenanceUnsupported
+	}
+	if _, ok := s.store.(contextstore.BatchStore); strings.TrimSpace(entry.Batch) != "" && !ok {
+		return contextstore.ErrBatchesUnsupported
+	}
+	if _, ok := s.store.(contextstore.SessionStore); strings.TrimSpace(entry.Session) != "" && !ok {
+		return contextstore.ErrSessionsUnsupported
+	}
+	namespace := strings.TrimSpace(entry.Namespace)
+	if _, ok := s.store.(contextstore.NamespacedStore); namespace != "" && namespace != contextstore.DefaultNamespace && !ok {
+		return contextstore.ErrNamespacesUnsupported
+	}
+	return nil
+}
+
+// saveEntry is the save pipeline shared by save_context and SaveEntry. The
+// store must support what entry asks for. call, if not nil, follows its
+// stages. Errors are logged and returned as errortypes errors.
+func (s *MCPContextToolServer) saveEntry(ctx context.Context, call *trackedRequest, entry NewEntry) (SavedEntry, error) {
+	source := strings.TrimSpace(entry.Source)
+	batch := strings.TrimSpace(entry.Batch)
+	session := strings.TrimSpace(entry.Session)
+	namespace := strings.TrimSpace(entry.Namespace)
+	if namespace == contextstore.DefaultNamespace {
+		namespace = ""
+	}
+	var saved SavedEntry
+
+	// Generate summary. Third-party text is fenced off from the
+	// summarizer's prompt, so it cannot dictate the memory stored.
+	s.logger.Debug("Generating summary of context", "untrusted", entry.Untrusted)
+	call.setStage(tools.StageSummarizing)
+	summaryCtx := ctx
+	if entry.Untrusted {
+		summaryCtx = summarizer.WithUntrustedText(ctx)
+	}
+	written, err := s.summarizeOrVerbatim(summaryCtx, entry.Text, entry.MaxSummaryLength)
+	summary, generation := written.Text, written.Generation
+	if err == nil && summary == "" && strings.TrimSpace(entry.Text) != "" {
+		err = summarizer.ErrEmptySummary
+	}
+	if err != nil {
+		err = errortypes.APIError(err, "failed to summarize text").
+			WithField("text_length", len(entry.Text))
+		errortypes.LogError(s.logger, err)
+		return saved, err
+	}
+	saved.SummaryUnavailable = generation.Summarizer == summarizer.GeneratedVerbatim
+
+	// Create embedding
+	s.logger.Debug("Creating embedding of context", "input", s.embedInput)
+	call.setStage(tools.StageEmbedding)
+	sourced, err := vector.CreateEntryEmbedding(ctx, s.embedder, s.embedInput, summary, entry.Text)
+	embedding := sourced.Vector
+	if err == nil {
+		err = vector.ValidateEmbedding(embedding)
+	}
+	if err != nil {
+		err = errortypes.APIError(err, "failed to create embedding").
+			WithField("summary_length", len(summary))
+		errortypes.LogError(s.logger, err)
+		return saved, err
+	}
+
+	// Convert embedding to bytes
+	embeddingBytes, err := vector.Float32SliceToBytes(embedding)
+	if err != nil {
+		err = errortypes.APIError(err, "failed to convert embedding to bytes").
+			WithField("embedding_size", len(embedding))
+		errortypes.LogError(s.logger, err)
+		return saved, err
+	}
+
+	// A save that was cancelled or ran out of time stores nothing, so the
+	// caller can retry it without saving the text twice
+	if err := ctx.Err(); err != nil {
+		err = errortypes.APIError(err, "save ran out of time before storing").
+			WithField("timeout", s.requestTimeout.String())
+		errortypes.LogError(s.logger, err)
+		return saved, err
+	}
+
+	// Generate ID (simple hash of content + timestamp)
+	timestamp := time.Now()
+	hasher := sha256.New()
+	hasher.Write([]byte(summary))
+	hasher.Write([]byte(timestamp.String()))
+	id := hex.EncodeToString(hasher.Sum(nil))[:16] // Use first 16 chars of the hash
+
+	call.setStage(tools.StageStoring)
+	if sourced.Fallback {
+		// A fallback embedding may come from another model, so the entry is
+		// kept out of the index until the primary provider re-embeds it
+		s.logger.Debug("Quarantining context", "id", id, "provider", sourced.Provider)
+		quarantine, ok := s.store.(contextstore.QuarantineStore)
+		switch {
+		case namespace != "":
+			err = ErrQuarantineNamespace
+		case ok:
+			err = quarantine.Quarantine(id, summary, embeddingBytes, timestamp, entry.Tags, sourced.Provider)
+		default:
+			err = contextstore.ErrQuarantineUnsupported
+		}
+		if err != nil {
+			err = errortypes.DatabaseError(err, "failed to quarantine context").
+				WithField("context_id", id).
+				WithField("provider", sourced.Provider)
+			errortypes.LogError(s.logger, err)
+			return saved, err
+		}
+	} else {
+		// Store in context store
+		s.logger.Debug("Storing context", "id", id)
+		storeStart := time.Now()
+		if namespace != "" {
+			err = s.store.(contextstore.NamespacedStore).StoreInNamespace(namespace, id, summary, embeddingBytes, timestamp)
+		} else {
+			err = s.store.Store(id, summary, embeddingBytes, timestamp)
+		}
+		s.recordStoreOperation("save", storeStart, err)
+		if err != nil {
+			err = errortypes.DatabaseError(err, "failed to store context").
+				WithField("context_id", id).
+				WithField("namespace", entry.Namespace)
+			errortypes.LogError(s.logger, err)
+			return saved, err
+		}
+
+		// Tag the new entry, removing it again if that fails so an
+		// untagged entry cannot slip past exclude_tags
+		if len(entry.Tags) > 0 {
+			if err := s.store.(contextstore.TaggedStore).SetTags(id, entry.Tags); err != nil {
+				if deleteErr := s.store.Delete(id); deleteErr != nil {
+					s.logger.Warn("Failed to remove untagged context entry", "id", id, "error", deleteErr)
+				}
+
+				err = errortypes.DatabaseError(err, "failed to tag context").
+					WithField("context_id", id)
+				errortypes.LogError(s.logger, err)
+				return saved, err
+			}
+		}
+	}
+
+	if err := s.traceSaved(id, source, entry.Via); err != nil {
+		return saved, err
+	}
+	if err := s.batchSaved(id, batch); err != nil {
+		return saved, err
+	}
+	if err := s.sessionSaved(id, session); err != nil {
+		return saved, err
+	}
+	s.recordGeneration(id, generation)
+	s.recordTitle(id, written.Title)
+	s.recordReferences(id, entry.Text)
+
+	saved.ID = id
+	saved.Title = written.Title
+	if sourced.Fallback {
+		saved.Quarantined = true
+		s.logger.Warn("Saved context embedded by a fallback provider; it is quarantined until re-embedded",
+			"id", id, "provider", sourced.Provider)
+		return saved, nil
+	}
+	s.logger.Info("Successfully saved context", "id", id)
+
+	// The primary provider is back, so catch up on quarantined entries
+	if quarantine, ok := s.store.(contextstore.QuarantineStore); ok {
+		s.reembedQuarantined(ctx, quarantine, reembedBatchSize)
+	}
+	return saved, nil
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/telemetry"
+)
+
+// DefaultSaveLimitWindow is the window save limits are counted over when
+// none is configured.
+const DefaultSaveLimitWindow = time.Minute
+
+// StatusThrottled is the save_context status of a save refused because its
+// source reached the save limit. Nothing is stored, and the call can be
+// retried once the window allows it.
+const StatusThrottled = "throttled"
+
+// ErrSaveLimited is reported when a source saves more often, or more text,
+// than the save limit allows within its window.
+var ErrSaveLimited = errors.New("save limit reached for this source")
+
+// ErrInvalidSaveLimit is returned for a negative save limit or window.
+var ErrInvalidSaveLimit = errors.New("save limits and window must not be negative")
+
+// saveLimiter bounds how many saves, and how many bytes of text, each source
+// may send within a sliding window, so a runaway agent loop cannot flood the
+// store or the summarizer. A source repeating text it saved within the window
+// gets the stored entry back instead of a new one. The zero value limits
+// nothing.
+type saveLimiter struct {
+	window   time.Duration
+	maxSaves int
+	maxBytes int
+
+	mu      sync.Mutex
+	sources map[string][]recentSave
+}
+
+// recentSave is a save admitted within the window
+type recentSave struct {
+	at    time.Time
+	bytes int
+	hash  [sha256.Size]byte
+
+	// id is the stored entry, empty until the save succeeds
+	id string
+}
+
+// saveDecision is the outcome of admitting a save
+type saveDecision struct {
+	// id is the entry already holding the same text, if the save was
+	// coalesced with it
+	id string
+
+	// retryAfter is how long until the save would be admitted, if it was
+	// throttled
+	retryAfter time.Duration
+}
+
+// SetSaveLimit bounds the saves each source, as named by save_context's
+// source, may make within window: at most maxSaves saves and maxBytes bytes
+// of context text. Saves without a source share one limit. A limit of 0 is
+// unlimited, and a window of 0 uses DefaultSaveLimitWindow. While a limit is
+// set, a source saving text it saved within the window gets the existing
+// entry's ID back. It must be called before Start.
+func (s *MCPContextToolServer) SetSaveLimit(window time.Duration, maxSaves, maxBytes int) error {
+	if window < 0 || maxSaves < 0 || maxBytes < 0 {
+		return ErrInvalidSaveLimit
+	}
+	if window == 0 {
+		window = DefaultSaveLimitWindow
+	}
+	s.saveLimit = &saveLimiter{
+		window:   window,
+		maxSaves: maxSaves,
+		maxBytes: maxBytes,
+		sources:  make(map[string][]recentSave),
+	}
+	return nil
+}
+
+// GetMetrics returns the server's metrics collector.
+func (s *MCPContextToolServer) GetMetrics() *telemetry.MetricsCollector {
+	return s.metrics
+}
+
+// enabled reports whether the limiter limits anything
+func (l *saveLimiter) enabled() bool {
+	return l != nil && (l.maxSaves > 0 || l.maxBytes > 0)
+}
+
+// admit decides whether source may save text at now. An admitted save
+// counts against the limit whether or not it is then stored.
+func (l *saveLimiter) admit(source, text string, now time.Time) saveDecision {
+	if !l.enabled() {
+		return saveDecision{}
+	}
+	hash := sha256.Sum256([]byte(text))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Forget saves that left the window
+	saves := l.sources[source]
+	kept := saves[:0]
+	for _, save := range saves {
+		if now.Sub(save.at) < l.window {
+			kept = append(kept, save)
+		}
+	}
+	saves = kept
+
+	for _, save := range saves {
+		if save.hash == hash && save.id != "" {
+			l.sources[source] = saves
+			return saveDecision{id: save.id}
+		}
+	}
+
+	// Drop the oldest saves until the new one fits; it is admitted once
+	// they have left the window
+	count, bytes := len(saves)+1, len(text)
+	for _, save := range saves {
+		bytes += save.bytes
+	}
+	var retryAfter time.Duration
+	for i := 0; i < len(saves) && ((l.maxSaves > 0 && count > l.maxSaves) || (l.maxBytes > 0 && bytes > l.maxBytes)); i++ {
+		count--
+		bytes -= saves[i].bytes
+		retryAfter = saves[i].at.Add(l.window).Sub(now)
+	}
+	if l.maxBytes > 0 && len(text) > l.maxBytes {
+		// No window ever fits it
+		retryAfter = -1
+	}
+	if retryAfter != 0 {
+		if len(saves) == 0 {
+			delete(l.sources, source)
+		} else {
+			l.sources[source] = saves
+		}
+		return saveDecision{retryAfter: retryAfter}
+	}
+
+	l.sources[source] = append(saves, recentSave{at: now, bytes: len(text), hash: hash})
+	return saveDecision{}
+}
+
+// stored records that the admitted save of text by source was stored as id,
+// so repeats within the window are coalesced with it
+func (l *saveLimiter) stored(source, text, id string) {
+	if !l.enabled() {
+		return
+	}
+	hash := sha256.Sum256([]byte(text))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	saves := l.sources[source]
+	for i := len(saves) - 1; i >= 0; i-- {
+		if saves[i].hash == hash && saves[i].id == "" {
+			saves[i].id = id
+			return
+		}
+	}
+}
+
+// throttledError describes a throttled save for the tool response
+func throttledError(source string, retryAfter time.Duration) error {
+	if source == "" {
+		source = "saves without a source"
+	}
+	if retryAfter < 0 {
+		return fmt.Errorf("%w (%s): the text is longer than the save limit allows", ErrSaveLimited, source)
+	}
+	return fmt.Errorf("%w (%s): retry in %ds", ErrSaveLimited, source, retrySeconds(retryAfter))
+}
+
+// retrySeconds rounds retryAfter up to whole seconds
+func retrySeconds(retryAfter time.Duration) int {
+	return int((retryAfter + time.Second - 1) / time.Second)
+}
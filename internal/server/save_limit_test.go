@@ -0,0 +1,99 @@
+package server
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/telemetry"
+	"github.com/localrivet/projectmemory/internal/tools"
+)
+
+func TestSaveLimiterAdmit(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	limiter := &saveLimiter{window: time.Minute, maxSaves: 2, maxBytes: 10, sources: make(map[string][]recentSave)}
+
+	if d := limiter.admit("agent", "aaaa", start); d != (saveDecision{}) {
+		t.Fatalf("Expected the first save to be admitted, got %+v", d)
+	}
+	limiter.stored("agent", "aaaa", "id-a")
+	if d := limiter.admit("agent", "aaaa", start.Add(time.Second)); d.id != "id-a" {
+		t.Errorf("Expected a repeat to be coalesced with id-a, got %+v", d)
+	}
+	if d := limiter.admit("agent", "bbbb", start.Add(10*time.Second)); d != (saveDecision{}) {
+		t.Fatalf("Expected the second save to be admitted, got %+v", d)
+	}
+
+	// A third save within the window waits for the first to leave it
+	if d := limiter.admit("agent", "cc", start.Add(20*time.Second)); d.retryAfter != 40*time.Second {
+		t.Errorf("Expected a retry after 40s, got %+v", d)
+	}
+	if d := limiter.admit("other", "cc", start.Add(20*time.Second)); d != (saveDecision{}) {
+		t.Errorf("Expected other sources to have their own limit, got %+v", d)
+	}
+	if d := limiter.admit("agent", "cc", start.Add(time.Minute)); d != (saveDecision{}) {
+		t.Errorf("Expected the save to be admitted once the first left the window, got %+v", d)
+	}
+
+	// Bytes count too, and text over the byte limit never fits
+	if d := limiter.admit("bytes", "123456", start); d != (saveDecision{}) {
+		t.Fatalf("Expected the save to be admitted, got %+v", d)
+	}
+	if d := limiter.admit("bytes", "123456", start.Add(time.Second)); d.retryAfter != 59*time.Second {
+		t.Errorf("Expected uncoalesced text over the byte limit to wait 59s, got %+v", d)
+	}
+	if d := limiter.admit("bytes", strings.Repeat("x", 11), start); d.retryAfter >= 0 {
+		t.Errorf("Expected text longer than the byte limit to be refused outright, got %+v", d)
+	}
+
+	var unlimited *saveLimiter
+	if d := unlimited.admit("agent", "aaaa", start); d != (saveDecision{}) {
+		t.Errorf("Expected a nil limiter to admit everything, got %+v", d)
+	}
+}
+
+func TestSaveContextSaveLimit(t *testing.T) {
+	store := contextstore.NewMemoryContextStore()
+	server := NewContextToolServer(store, &MockSummarizer{}, &MockEmbedder{})
+	if err := server.SetSaveLimit(time.Hour, 2, 0); err != nil {
+		t.Fatalf("SetSaveLimit() error = %v", err)
+	}
+
+	first, err := server.handleSaveContext(nil, tools.SaveContextRequest{ContextText: "Loop output 1", Source: "agent"})
+	if err != nil || first.Status != "success" {
+		t.Fatalf("Failed to save: %v %s", err, first.Error)
+	}
+	repeat, _ := server.handleSaveContext(nil, tools.SaveContextRequest{ContextText: "Loop output 1", Source: " agent "})
+	if repeat.Status != "success" || !repeat.Coalesced || repeat.ID != first.ID {
+		t.Errorf("Expected the repeat to be coalesced with %s, got %+v", first.ID, repeat)
+	}
+	if saved, _ := server.handleSaveContext(nil, tools.SaveContextRequest{ContextText: "Loop output 2", Source: "agent"}); saved.Status != "success" {
+		t.Fatalf("Expected the second save to succeed, got %+v", saved)
+	}
+
+	throttled, err := server.handleSaveContext(nil, tools.SaveContextRequest{ContextText: "Loop output 3", Source: "agent"})
+	if err != nil || throttled.Status != StatusThrottled || throttled.ID != "" {
+		t.Fatalf("Expected the third save to be throttled, got %v %+v", err, throttled)
+	}
+	if !strings.Contains(throttled.Error, ErrSaveLimited.Error()) || throttled.RetryAfterSeconds <= 0 || throttled.RetryAfterSeconds > 3600 {
+		t.Errorf("Expected a save limit error with a retry time, got %+v", throttled)
+	}
+	if saved, _ := server.handleSaveContext(nil, tools.SaveContextRequest{ContextText: "Manual note"}); saved.Status != "success" {
+		t.Errorf("Expected saves without a source to have their own limit, got %+v", saved)
+	}
+
+	if entries, _ := store.ListEntries(); len(entries) != 3 {
+		t.Errorf("Expected 3 stored entries, got %d", len(entries))
+	}
+	metrics := server.GetMetrics()
+	if metrics.GetCounter(telemetry.MetricSavesThrottled) != 1 || metrics.GetCounter(telemetry.MetricSavesCoalesced) != 1 {
+		t.Errorf("Expected one throttled and one coalesced save, got %d and %d",
+			metrics.GetCounter(telemetry.MetricSavesThrottled), metrics.GetCounter(telemetry.MetricSavesCoalesced))
+	}
+
+	if err := server.SetSaveLimit(-time.Second, 1, 0); !errors.Is(err, ErrInvalidSaveLimit) {
+		t.Errorf("Expected ErrInvalidSaveLimit for a negative window, got %v", err)
+	}
+}
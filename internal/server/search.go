@@ -0,0 +1,389 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/retrieval"
+	"github.com/localrivet/projectmemory/internal/tools"
+)
+
+var (
+	// ErrUnknownDedupMode is returned for a retrieve_context dedup value
+	// other than tools.DedupExclude or tools.DedupDownrank.
+	ErrUnknownDedupMode = errors.New("unknown dedup mode")
+
+	// ErrInvalidTimeRange is returned for retrieve_context since and until
+	// values that are not RFC 3339 times, or with until not after since.
+	ErrInvalidTimeRange = errors.New("invalid time range")
+
+	// ErrUnknownSearchMode is returned for a retrieve_context mode other
+	// than tools.SearchModeVector or tools.SearchModeKeyword.
+	ErrUnknownSearchMode = errors.New("unknown search mode")
+
+	// ErrKeywordModeOption is returned for a keyword retrieve_context
+	// request setting an option that compares embeddings.
+	ErrKeywordModeOption = errors.New("option does not apply to keyword searches")
+)
+
+// searchFunc returns up to limit entries not excluded by filter, best
+// first, with their scores: a vector or a keyword search of the store
+type searchFunc func(limit int, filter contextstore.SearchFilter) ([]contextstore.SearchResult, error)
+
+// vectorSearch returns the search of scored for the first of embeddings.
+// The candidates found for the others, embeddings of other phrasings of the
+// query, are fused with them.
+func vectorSearch(scored contextstore.ScoredSearcher, embeddings ...[]float32) searchFunc {
+	return func(limit int, filter contextstore.SearchFilter) ([]contextstore.SearchResult, error) {
+		if len(embeddings) == 1 {
+			return scored.SearchWithScores(embeddings[0], limit, filter)
+		}
+		sets := make([][]contextstore.SearchResult, len(embeddings))
+		for i, embedding := range embeddings {
+			found, err := scored.SearchWithScores(embedding, limit, filter)
+			if err != nil {
+				return nil, err
+			}
+			sets[i] = found
+		}
+		return fuseCandidates(sets, limit), nil
+	}
+}
+
+// keywordSearch returns the search of keywords for the words of query
+func keywordSearch(keywords contextstore.KeywordSearcher, query string) searchFunc {
+	return func(limit int, filter contextstore.SearchFilter) ([]contextstore.SearchResult, error) {
+		return keywords.SearchKeywords(query, limit, filter)
+	}
+}
+
+// searchOptions controls how retrieve_context ranks and filters results
+type searchOptions struct {
+	filter   contextstore.SearchFilter
+	adaptive bool
+
+	// minScore drops candidates less similar to the query than this
+	minScore float64
+
+	// ranking scores candidates by recency and keywords as well as
+	// similarity to query, if it reranks
+	ranking retrieval.Defaults
+	query   string
+
+	// rerank has the server's reranker pick the results from the best
+	// candidates
+	rerank bool
+
+	// known holds the context the caller already has when it should be
+	// down-ranked rather than excluded
+	known knownContext
+}
+
+// knownContext identifies entries the caller already has, by ID or by
+// contextstore.ContentHash of their summary
+type knownContext struct {
+	ids    map[string]bool
+	hashes map[string]bool
+}
+
+// newSearchOptions builds the search options for a validated query
+func newSearchOptions(q Query) searchOptions {
+	options := searchOptions{
+		filter: contextstore.SearchFilter{
+			Namespace:   strings.TrimSpace(q.Namespace),
+			ExcludeIDs:  q.ExcludeIDs,
+			ExcludeTags: q.ExcludeTags,
+			Tags:        q.Tags,
+			Session:     strings.TrimSpace(q.Session),
+			Since:       q.Since,
+			Until:       q.Until,
+		},
+		adaptive: q.Adaptive,
+		query:    q.Text,
+	}
+
+	if q.Dedup == tools.DedupDownrank {
+		options.known = knownContext{
+			ids:    make(map[string]bool, len(q.KnownIDs)),
+			hashes: make(map[string]bool, len(q.KnownHashes)),
+		}
+		for _, id := range q.KnownIDs {
+			options.known.ids[id] = true
+		}
+		for _, hash := range q.KnownHashes {
+			options.known.hashes[strings.ToLower(hash)] = true
+		}
+	} else {
+		options.filter.ExcludeIDs = append(append([]string{}, q.ExcludeIDs...), q.KnownIDs...)
+		options.filter.ExcludeHashes = q.KnownHashes
+	}
+	return options
+}
+
+// parseBound parses the RFC 3339 time of a since or until field. Empty is
+// the zero time, leaving that end of the range open.
+func parseBound(field, value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	bound, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s %q is not an RFC 3339 time", ErrInvalidTimeRange, field, value)
+	}
+	return bound, nil
+}
+
+// parseHalfLife parses the recency half-life of a retrieve_context
+// request, a Go duration string. Empty returns 0.
+func parseHalfLife(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	halfLife, err := time.ParseDuration(value)
+	if err != nil || halfLife < 0 {
+		return 0, fmt.Errorf("%w: %q is not a positive duration such as \"72h\"", retrieval.ErrInvalidRecencyHalfLife, value)
+	}
+	return halfLife, nil
+}
+
+// needsScores reports whether the options can only be applied by a
+// contextstore.ScoredSearcher. Adaptive limits alone fall back to Search.
+func (o searchOptions) needsScores() bool {
+	return o.minScore > 0 || len(o.filter.ExcludeIDs) > 0 || len(o.filter.ExcludeTags) > 0 ||
+		len(o.filter.ExcludeHashes) > 0 || o.filter.Namespace != "" || len(o.filter.Tags) > 0 ||
+		o.filter.Session != "" || !o.filter.Since.IsZero() || !o.filter.Until.IsZero() || o.known.size() > 0 ||
+		o.ranking.Reranks()
+}
+
+// size returns the number of known IDs and hashes
+func (k knownContext) size() int {
+	return len(k.ids) + len(k.hashes)
+}
+
+// has reports whether the caller already has result
+func (k knownContext) has(result contextstore.SearchResult) bool {
+	if k.size() == 0 {
+		return false
+	}
+	return k.ids[result.ID] || k.hashes[contextstore.ContentHash(result.SummaryText)]
+}
+
+// searchScored runs search with the filter, ranking and limits of options.
+// In adaptive mode it fetches up to retrieval.AdaptiveMaxFactor times
+// limit candidates and lets retrieval.AdaptiveLimit decide how many to return.
+// Candidates below the minimum score are dropped first. If the ranking
+// reranks, up to retrieval.RerankFactor times limit candidates are reordered
+// by their ranking score before the limit applies. With options.rerank, the
+// server's reranker then picks up to limit results from the best
+// candidates in place of the adaptive limit, unless it fails. Entries the
+// caller already has are moved behind all others. Stores that track usage record
+// the retrieval of every returned entry.
+func (s *MCPContextToolServer) searchScored(ctx context.Context, search searchFunc, limit int, options searchOptions) ([]QueryResult, error) {
+	candidateLimit := limit
+	if options.adaptive {
+		candidateLimit = limit * retrieval.AdaptiveMaxFactor
+	}
+	if options.ranking.Reranks() && candidateLimit < limit*retrieval.RerankFactor {
+		candidateLimit = limit * retrieval.RerankFactor
+	}
+	if options.rerank && candidateLimit < s.rerankCandidates {
+		candidateLimit = s.rerankCandidates
+	}
+	// Fetch enough extra candidates to fill the limit if every known entry ranks first
+	candidateLimit += options.known.size()
+
+	candidates, err := search(candidateLimit, options.filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.minScore > 0 {
+		// Candidates are sorted by similarity, so everything after the first
+		// one below the minimum is below it too
+		kept := len(candidates)
+		for i, candidate := range candidates {
+			if candidate.Similarity < options.minScore {
+				kept = i
+				break
+			}
+		}
+		candidates = candidates[:kept]
+	}
+
+	scores := make([]float64, len(candidates))
+	for i, candidate := range candidates {
+		scores[i] = candidate.Similarity
+	}
+	if options.ranking.Reranks() {
+		candidates, scores = rankCandidates(candidates, options.ranking, options.query, time.Now())
+	}
+
+	count := limit
+	reranked := false
+	if options.rerank {
+		candidates, scores, reranked = s.rerankResults(ctx, options.query, candidates, scores, limit)
+		if reranked {
+			count = len(candidates)
+		}
+	}
+	if options.adaptive && !reranked {
+		count = retrieval.AdaptiveLimit(scores, limit)
+		s.logger.Debug("Adaptive limit for retrieve_context", "limit", limit, "candidates", len(candidates), "returned", count)
+
+		// Down-ranking reorders the entries the adaptive limit kept
+		candidates = candidates[:count]
+	}
+
+	// Stable partition: new entries first, then entries the caller already has
+	ranked := make([]QueryResult, 0, len(candidates))
+	var known []QueryResult
+	for i, candidate := range candidates {
+		result := QueryResult{ID: candidate.ID, Summary: candidate.SummaryText, Score: scores[i], Timestamp: candidate.Timestamp}
+		if options.known.has(candidate) {
+			known = append(known, result)
+		} else {
+			ranked = append(ranked, result)
+		}
+	}
+	ranked = append(ranked, known...)
+
+	if count > len(ranked) {
+		count = len(ranked)
+	}
+	results := ranked[:count]
+	s.recordRetrievals(resultIDs(results))
+	return results, nil
+}
+
+// rankCandidates orders candidates by their ranking score, highest first, keeping
+// the store's order on ties. It returns the reordered candidates and their
+// scores.
+func rankCandidates(candidates []contextstore.SearchResult, ranking retrieval.Defaults, query string, now time.Time) ([]contextstore.SearchResult, []float64) {
+	type rankedResult struct {
+		result contextstore.SearchResult
+		score  float64
+	}
+	ranked := make([]rankedResult, len(candidates))
+	for i, candidate := range candidates {
+		ranked[i] = rankedResult{candidate, ranking.Score(candidate.Similarity, query, candidate.SummaryText, now.Sub(candidate.Timestamp))}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].score > ranked[j].score
+	})
+
+	results := make([]contextstore.SearchResult, len(ranked))
+	scores := make([]float64, len(ranked))
+	for i, r := range ranked {
+		results[i], scores[i] = r.result, r.score
+	}
+	return results, scores
+}
+
+// resultEntries returns the retrieve_context entry of each result, with
+// its tags if the store holds tags and its source if the origin of its
+// provenance chain, in the same order, names one. Results whose tags
+// cannot be read are left without.
+func (s *MCPContextToolServer) resultEntries(results []QueryResult, provenance [][]string) []tools.ContextEntry {
+	tagged, _ := s.store.(contextstore.TaggedStore)
+	entries := make([]tools.ContextEntry, len(results))
+	for i, result := range results {
+		entries[i] = tools.ContextEntry{ID: result.ID, Summary: result.Summary, Score: result.Score, Tags: []string{}}
+		if !result.Timestamp.IsZero() {
+			entries[i].Timestamp = result.Timestamp.Format(time.RFC3339)
+		}
+		if i < len(provenance) {
+			entries[i].Source = entrySource(provenance[i])
+		}
+		if tagged == nil || result.ID == "" {
+			continue
+		}
+		tags, err := tagged.GetTags(result.ID)
+		if err != nil {
+			s.logger.Warn("Failed to read tags of retrieved context", "id", result.ID, "error", err)
+			continue
+		}
+		if tags != nil {
+			entries[i].Tags = tags
+		}
+	}
+	return entries
+}
+
+// resultProvenance returns the provenance chain of each ID if the store
+// records provenance, or nil if it does not. A chain that cannot be read is
+// logged and left empty rather than failing the retrieval.
+func (s *MCPContextToolServer) resultProvenance(ids []string) [][]string {
+	provenance, ok := s.store.(contextstore.ProvenanceStore)
+	if !ok || len(ids) == 0 {
+		return nil
+	}
+
+	chains := make([][]string, len(ids))
+	for i, id := range ids {
+		chain, err := provenance.GetProvenance(id)
+		if err != nil {
+			s.logger.Warn("Failed to read provenance of retrieved context", "id", id, "error", err)
+			chain = []string{}
+		}
+		chains[i] = chain
+	}
+	return chains
+}
+
+// entrySource returns the source named by the origin of a provenance
+// chain, or nil if it names neither a file's lines nor a commit
+func entrySource(chain []string) *tools.EntrySource {
+	origin, ok := contextstore.ParseOrigin(chain)
+	if !ok {
+		return nil
+	}
+	return &tools.EntrySource{Path: origin.Path, StartLine: origin.StartLine, EndLine: origin.EndLine, Commit: origin.Commit}
+}
+
+// resultGenerations returns what wrote the summary of each ID if the store
+// records generations, or nil if it does not. IDs without a recorded
+// generation, or whose generation cannot be read, are left nil.
+func (s *MCPContextToolServer) resultGenerations(ids []string) []*tools.SummaryGeneration {
+	generations, ok := s.store.(contextstore.GenerationStore)
+	if !ok || len(ids) == 0 {
+		return nil
+	}
+
+	results := make([]*tools.SummaryGeneration, len(ids))
+	for i, id := range ids {
+		generation, err := generations.GetGeneration(id)
+		if err != nil {
+			s.logger.Warn("Failed to read generation of retrieved context", "id", id, "error", err)
+			continue
+		}
+		if generation.IsZero() {
+			continue
+		}
+		results[i] = &tools.SummaryGeneration{
+			Summarizer:    generation.Summarizer,
+			Provider:      generation.Provider,
+			Model:         generation.Model,
+			PromptVersion: generation.PromptVersion,
+		}
+	}
+	return results
+}
+
+// recordRetrievals counts a retrieval of each ID if the store tracks usage.
+// Failures are logged rather than failing the retrieval.
+func (s *MCPContextToolServer) recordRetrievals(ids []string) {
+	usage, ok := s.store.(contextstore.UsageStore)
+	if !ok || len(ids) == 0 {
+		return
+	}
+	if err := usage.RecordRetrievals(ids, time.Now()); err != nil && !errors.Is(err, contextstore.ErrUsageUnsupported) {
+		s.logger.Warn("Failed to record retrievals", "count", len(ids), "error", err)
+	}
+}
@@ -2,16 +2,37 @@
 package server
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
 	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/localrivet/gomcp/server"
+	"github.com/localrivet/projectmemory/internal/analytics"
+	"github.com/localrivet/projectmemory/internal/archive"
+	"github.com/localrivet/projectmemory/internal/auth"
+	"github.com/localrivet/projectmemory/internal/cleanup"
+	"github.com/localrivet/projectmemory/internal/consolidate"
 	"github.com/localrivet/projectmemory/internal/contextstore"
 	"github.com/localrivet/projectmemory/internal/errortypes"
+	"github.com/localrivet/projectmemory/internal/expansion"
+	"github.com/localrivet/projectmemory/internal/hyde"
+	"github.com/localrivet/projectmemory/internal/ingest"
+	"github.com/localrivet/projectmemory/internal/links"
+	"github.com/localrivet/projectmemory/internal/rerank"
+	"github.com/localrivet/projectmemory/internal/retrieval"
 	"github.com/localrivet/projectmemory/internal/summarizer"
+	"github.com/localrivet/projectmemory/internal/telemetry"
+	"github.com/localrivet/projectmemory/internal/tokenizer"
 	"github.com/localrivet/projectmemory/internal/tools"
 	"github.com/localrivet/projectmemory/internal/vector"
 )
@@ -20,8 +41,29 @@ import (
 var (
 	ErrServerNotInitialized = errors.New("server not initialized")
 	ErrMissingDependencies  = errors.New("one or more required dependencies are nil")
+	ErrInvalidMinScore      = errors.New("min_score must be between 0 and 1")
+	ErrMissingBatchID       = errors.New("batch_id is required")
+	ErrInvalidSummaryLength = errors.New("max_summary_length must not be negative")
+
+	// ErrFallbackEmbedding is returned when an entry already in the index
+	// would be re-embedded by a fallback provider.
+	ErrFallbackEmbedding = errors.New("primary embedding provider unavailable; fallback embeddings cannot replace indexed entries")
+
+	// ErrQuarantineNamespace is returned when an entry saved to a namespace
+	// other than the default one is embedded by a fallback provider.
+	// Quarantined entries are released into the default namespace, so the
+	// entry would lose its namespace.
+	ErrQuarantineNamespace = errors.New("primary embedding provider unavailable; fallback embeddings can only be saved to the default namespace")
 )
 
+// DefaultClearGracePeriod is how long entries removed by clear_all_context
+// can be restored with undo_clear.
+const DefaultClearGracePeriod = 24 * time.Hour
+
+// reembedBatchSize bounds how many quarantined entries one save_context
+// re-embeds once the primary embedding provider is back.
+const reembedBatchSize = 10
+
 // MCPContextToolServer implements the ContextToolServer interface
 // for handling MCP tool calls related to context storage and retrieval.
 type MCPContextToolServer struct {
@@ -29,6 +71,162 @@ type MCPContextToolServer struct {
 	summarizer summarizer.Summarizer
 	embedder   vector.Embedder
 	mcpServer  server.Server
+	requests   *requestTracker
+	cleanup    cleanup.Policy
+	review     cleanup.StaleOptions
+	queries    *analytics.QueryLog
+
+	// embedInput is the text embedded for saved and replaced entries
+	embedInput vector.EmbedInput
+
+	// clearGracePeriod is how long cleared entries stay restorable. 0
+	// makes clear_all_context delete entries immediately.
+	clearGracePeriod time.Duration
+
+	// idleTimeout is how long the server waits without tool calls before
+	// releasing idle resources. 0 never releases them.
+	idleTimeout      time.Duration
+	idleReleaseStore bool
+
+	// memoryLimit is the live heap size above which caches are shrunk,
+	// checked every memoryCheckInterval. 0 never shrinks them.
+	memoryLimit         uint64
+	memoryCheckInterval time.Duration
+
+	// retrievalDefaults holds the retrieve_context defaults of each
+	// namespace that configures its own
+	retrievalDefaults map[string]retrieval.Defaults
+
+	// healthSink receives the health report every healthReportInterval.
+	// nil sends none.
+	healthSink           HealthSink
+	healthReportInterval time.Duration
+
+	// usageSink receives the usage report in usageReportFormat every
+	// usageReportInterval, listing usageReportTop items per list. nil sends
+	// none.
+	usageSink           HealthSink
+	usageReportInterval time.Duration
+	usageReportFormat   string
+	usageReportTop      int
+
+	// suggestIngestion adds topics to ingest, from the store's retrieval
+	// gaps, to the usage report
+	suggestIngestion bool
+
+	// archiveTarget is where archive_namespace moves namespaces. nil
+	// disables archiving.
+	archiveTarget archive.Target
+
+	// quickCaptureAddr is where POST /quick-capture is served, to requests
+	// carrying quickCaptureToken. Empty serves nothing.
+	quickCaptureAddr  string
+	quickCaptureToken string
+
+	// grpcAddr is where the gRPC service is served, to calls carrying
+	// grpcToken if it is set. Empty serves nothing.
+	grpcAddr  string
+	grpcToken string
+
+	// metricsAddr is where GET /metrics is served. Empty serves nothing.
+	metricsAddr string
+
+	// linkIndex holds the files and symbols of the repository saved text
+	// is linked to, rebuilt every linkRefresh if it is positive. An empty
+	// index links nothing.
+	linkIndex   atomic.Pointer[links.Index]
+	linkRefresh time.Duration
+
+	// watchDirs are the directories whose changed files are split by
+	// watchChunker and ingested again. Empty watches nothing. watchChunks
+	// maps each file ingested since Start to the IDs of its chunks, by
+	// source and text, and is only used by the watching goroutine.
+	watchDirs    []string
+	watchChunker ingest.Chunker
+	watchOptions ingest.WatchOptions
+	watchChunks  map[string]map[string]string
+
+	// injectionMode is what retrieve_context does with instructions
+	// planted in retrieved summaries
+	injectionMode retrieval.InjectionMode
+
+	// tokenizer counts the tokens of results against max_tokens. nil
+	// estimates them.
+	tokenizer tokenizer.Tokenizer
+
+	// reranker picks retrieve_context results from the best
+	// rerankCandidates, for requests asking for it or every request if
+	// rerankAlways. nil ranks results by score alone.
+	reranker         rerank.Reranker
+	rerankCandidates int
+	rerankAlways     bool
+
+	// expander phrases retrieve_context queries in expansionQueries other
+	// ways, each searched as well, for requests asking for it or every
+	// request if expansionAlways. nil searches the query alone.
+	expander         expansion.Expander
+	expansionQueries int
+	expansionAlways  bool
+
+	// drafter writes hypothetical answers to retrieve_context queries,
+	// searched with in place of the query, for requests asking for it or
+	// every request if hydeAlways. nil searches with the query.
+	drafter    hyde.Drafter
+	hydeAlways bool
+
+	// merger merges the clusters of similar entries consolidate finds with
+	// consolidateOptions, every consolidateInterval if it is positive.
+	// consolidating keeps runs from overlapping. nil consolidates nothing.
+	merger              consolidate.Merger
+	consolidateOptions  consolidate.Options
+	consolidateInterval time.Duration
+	consolidating       sync.Mutex
+
+	// authenticator authenticates callers of the quick-capture and gRPC
+	// endpoints besides their tokens. nil accepts only the tokens.
+	authenticator auth.Authenticator
+
+	// tlsConfig serves the quick-capture and gRPC endpoints over TLS. nil
+	// serves plain connections.
+	tlsConfig *tls.Config
+
+	// saveLimit throttles sources saving too often or too much. nil
+	// limits nothing.
+	saveLimit *saveLimiter
+
+	// requestTimeout bounds each tool call. 0 leaves calls unbounded.
+	requestTimeout time.Duration
+
+	// limits bounds the fields of tool requests
+	limits RequestLimits
+
+	// disabledTools lists the tools the server does not offer
+	disabledTools []string
+
+	// readOnly withholds the tools that change stored context
+	readOnly bool
+
+	// minInputLength is the length in characters below which text is
+	// stored as it is instead of summarized
+	minInputLength int
+
+	// stopping is closed once Stop begins, and exited once Start has shut
+	// down the background services it runs. background counts the
+	// goroutines that must finish before the store is closed, waiting at
+	// most shutdownTimeout.
+	stopping        chan struct{}
+	stopOnce        sync.Once
+	running         atomic.Bool
+	exited          chan struct{}
+	background      sync.WaitGroup
+	shutdownTimeout time.Duration
+	shutdownOnce    sync.Once
+	shutdownErr     error
+
+	// logger receives everything the server logs, so servers sharing a
+	// process can log apart
+	logger  *slog.Logger
+	metrics *telemetry.MetricsCollector
 }
 
 // NewContextToolServer creates a new MCPContextToolServer instance.
@@ -37,183 +235,566 @@ func NewContextToolServer(store contextstore.ContextStore, summarizer summarizer
 		store:      store,
 		summarizer: summarizer,
 		embedder:   embedder,
+		requests:   newRequestTracker(),
+		cleanup:    cleanup.DefaultPolicy(),
+		queries:    analytics.NewQueryLog(),
+		logger:     slog.Default(),
+		metrics:    telemetry.NewMetricsCollector(),
+
+		embedInput:          vector.EmbedSummary,
+		clearGracePeriod:    DefaultClearGracePeriod,
+		idleTimeout:         DefaultIdleTimeout,
+		memoryCheckInterval: DefaultMemoryCheckInterval,
+
+		healthReportInterval: DefaultHealthReportInterval,
+		usageReportInterval:  DefaultUsageReportInterval,
+		usageReportFormat:    analytics.FormatMarkdown,
+		injectionMode:        retrieval.InjectionOff,
+
+		stopping:        make(chan struct{}),
+		exited:          make(chan struct{}),
+		shutdownTimeout: DefaultShutdownTimeout,
+		requestTimeout:  DefaultRequestTimeout,
+		limits:          DefaultRequestLimits,
+	}
+}
+
+// SetClearGracePeriod sets how long entries removed by clear_all_context can
+// be restored with undo_clear. 0 deletes them immediately. It must be called
+// before Start.
+func (s *MCPContextToolServer) SetClearGracePeriod(gracePeriod time.Duration) {
+	s.clearGracePeriod = gracePeriod
+}
+
+// SetEmbedInput sets which text of saved and replaced entries is embedded.
+// The default embeds their summaries.
+func (s *MCPContextToolServer) SetEmbedInput(input vector.EmbedInput) {
+	s.embedInput = input
+}
+
+// SetLogger sets the logger the server logs to instead of slog.Default(). It
+// must be called before Initialize.
+func (s *MCPContextToolServer) SetLogger(logger *slog.Logger) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	s.logger = logger
+}
+
+// SetCleanupPolicy sets how cleanup_report scores entries and whether it
+// deletes them. It must be called before Start.
+func (s *MCPContextToolServer) SetCleanupPolicy(policy cleanup.Policy) {
+	s.cleanup = policy
+}
+
+// SetRetrievalDefaults sets the retrieve_context defaults of each namespace
+// that configures its own. Requests to other namespaces keep the server-wide
+// defaults. It must be called before Start.
+func (s *MCPContextToolServer) SetRetrievalDefaults(defaults map[string]retrieval.Defaults) error {
+	for namespace, d := range defaults {
+		if err := d.Validate(); err != nil {
+			return fmt.Errorf("invalid retrieval defaults for namespace %q: %w", namespace, err)
+		}
 	}
+	s.retrievalDefaults = defaults
+	return nil
 }
 
 // Initialize initializes the server with dependencies and configurations.
 func (s *MCPContextToolServer) Initialize() error {
-	slog.Info("Initializing MCP Context Tool Server")
+	s.logger.Info("Initializing MCP Context Tool Server")
 
 	if s.store == nil || s.summarizer == nil || s.embedder == nil {
 		return errortypes.ConfigError(errors.New("missing dependencies"), "server initialization failed")
 	}
 
-	// Create the MCP server
+	// Create the MCP server, offering the tools that are enabled
 	srv := server.NewServer("projectmemory")
+	registered := 0
+	register := func(name, description string, handler interface{}) {
+		if !s.toolEnabled(name) {
+			s.logger.Info("Tool disabled", "tool", name)
+			return
+		}
+		srv = srv.Tool(name, description, handler).
+			WithAnnotations(name, tools.ToolAnnotations(name).Map())
+		registered++
+	}
 
 	// Register save_context tool
-	srv = srv.Tool(tools.ToolSaveContext, "Save context to the persistent memory store",
-		s.handleSaveContext)
+	register(tools.ToolSaveContext, "Save context to the persistent memory store",
+		whileRunning(s, s.handleSaveContext))
 
 	// Register retrieve_context tool
-	srv = srv.Tool(tools.ToolRetrieveContext, "Retrieve relevant context based on a query",
-		s.handleRetrieveContext)
+	register(tools.ToolRetrieveContext, "Retrieve relevant context based on a query",
+		whileRunning(s, s.handleRetrieveContext))
 
 	// Register delete_context tool
-	srv = srv.Tool(tools.ToolDeleteContext, "Delete a specific context entry by ID",
-		s.handleDeleteContext)
+	register(tools.ToolDeleteContext, "Delete a specific context entry by ID",
+		whileRunning(s, s.handleDeleteContext))
 
 	// Register clear_all_context tool
-	srv = srv.Tool(tools.ToolClearAllContext, "Clear all context entries from the store",
-		s.handleClearAllContext)
+	register(tools.ToolClearAllContext, "Clear all context entries from the store",
+		whileRunning(s, s.handleClearAllContext))
+
+	// Register undo_clear tool
+	register(tools.ToolUndoClear, "Restore the entries removed by clear_all_context during its grace period",
+		whileRunning(s, s.handleUndoClear))
 
 	// Register replace_context tool
-	srv = srv.Tool(tools.ToolReplaceContext, "Replace an existing context entry with new content",
-		s.handleReplaceContext)
+	register(tools.ToolReplaceContext, "Replace an existing context entry with new content",
+		whileRunning(s, s.handleReplaceContext))
+
+	// Register list_active_requests tool
+	register(tools.ToolListActiveRequests, "List tool calls that are currently executing, with elapsed time and stage",
+		whileRunning(s, s.handleListActiveRequests))
+
+	// Register cleanup_report tool
+	register(tools.ToolCleanupReport, "Report likely junk entries as deletion candidates, deleting them if the server's cleanup policy allows",
+		whileRunning(s, s.handleCleanupReport))
+
+	// Register snapshot_hash tool
+	register(tools.ToolSnapshotHash, "Hash the stored context per namespace, so two stores can be checked for identical content",
+		whileRunning(s, s.handleSnapshotHash))
+
+	// Register list_batches tool
+	register(tools.ToolListBatches, "List the import batches holding entries, with their size and age",
+		whileRunning(s, s.handleListBatches))
+
+	// Register rollback_batch tool
+	register(tools.ToolRollbackBatch, "Delete every entry saved with a batch ID, undoing an import in one call",
+		whileRunning(s, s.handleRollbackBatch))
+
+	// Register memory_status tool
+	register(tools.ToolMemoryStatus, "Report summarization queue depth and provider health, and whether non-critical saves should be deferred",
+		whileRunning(s, s.handleMemoryStatus))
+
+	// Register archive_namespace tool
+	register(tools.ToolArchiveNamespace, "Move a namespace out of the live store into the configured archive",
+		whileRunning(s, s.handleArchiveNamespace))
+
+	// Register restore_namespace tool
+	register(tools.ToolRestoreNamespace, "Move an archived namespace back into the live store",
+		whileRunning(s, s.handleRestoreNamespace))
+
+	// Register memory_gaps tool
+	register(tools.ToolMemoryGaps, "List retrieval queries that found nothing, pointing at knowledge worth ingesting, and forget the ones since filled",
+		whileRunning(s, s.handleMemoryGaps))
+
+	// Register pin_context tool
+	register(tools.ToolPinContext, "Pin an entry so retrieve_context always returns it, such as a project convention, or unpin it",
+		whileRunning(s, s.handlePinContext))
+
+	// Register memory_health tool
+	register(tools.ToolMemoryHealth, "Check whether the summarizer's LLM providers, the embedder and the store are operational",
+		whileRunning(s, s.handleMemoryHealth))
+
+	// Register review_queue tool
+	register(tools.ToolReviewQueue, "List old entries that are still retrieved often for a person to confirm, refresh or retire, and record their decision",
+		whileRunning(s, s.handleReviewQueue))
+
+	// Register retrieve_by_file tool
+	register(tools.ToolRetrieveByFile, "Retrieve the stored context that mentions a repository file or the Go symbols declared in it",
+		whileRunning(s, s.handleRetrieveByFile))
+
+	// Register list_sessions tool
+	register(tools.ToolListSessions, "List the agent sessions holding entries, with their size and when they were last active",
+		whileRunning(s, s.handleListSessions))
+
+	// Register expire_session tool
+	register(tools.ToolExpireSession, "Delete every entry saved with a session ID, expiring an agent session's memories in one call",
+		whileRunning(s, s.handleExpireSession))
+
+	// Register link_context tool
+	register(tools.ToolLinkContext, "Record that one entry supersedes, elaborates or contradicts another, or remove that relation",
+		whileRunning(s, s.handleLinkContext))
+
+	// Register get_linked_context tool
+	register(tools.ToolGetLinkedContext, "Retrieve the entries linked to an entry by supersedes, elaborates or contradicts relations, following them a few steps",
+		whileRunning(s, s.handleGetLinkedContext))
+	register(tools.ToolConsolidate, "Merge clusters of highly similar entries into single consolidated entries that replace them, or list the clusters with dry_run",
+		whileRunning(s, s.handleConsolidate))
+
+	// Register the prompts that drive the tools above, unless they need
+	// a disabled one
+	prompts := 0
+	for _, prompt := range tools.Prompts() {
+		if slices.ContainsFunc(prompt.Tools, func(name string) bool { return !s.toolEnabled(name) }) {
+			continue
+		}
+		srv = srv.Prompt(prompt.Name, prompt.Description, prompt.Template)
+		prompts++
+	}
 
 	s.mcpServer = srv
-	slog.Info("MCP Context Tool Server initialized successfully", "tool_count", 5)
+	s.logger.Info("MCP Context Tool Server initialized successfully", "tool_count", registered, "prompt_count", prompts)
 	return nil
 }
 
-// Start starts the MCP server on the specified transport.
-func (s *MCPContextToolServer) Start() error {
+// Start starts the MCP server on the specified transport. It returns when
+// the transport closes, when Stop is called, or after SIGINT or SIGTERM,
+// which stop the server before Start returns.
+func (s *MCPContextToolServer) Start() (err error) {
 	if s.mcpServer == nil {
 		return errortypes.ConfigError(errors.New("server not initialized"), "cannot start server")
 	}
 
-	slog.Info("Starting MCP Context Tool Server")
+	s.logger.Info("Starting MCP Context Tool Server")
+
+	// A signal stops the server once the services below have shut down
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	signalled := false
+	defer func() {
+		if signalled {
+			err = s.Stop()
+		}
+	}()
+	s.running.Store(true)
+	defer close(s.exited)
+
+	// Entries whose grace period ran out while the server was down
+	if clearer, ok := s.store.(contextstore.SoftClearer); ok {
+		s.purgeExpiredClears(clearer, time.Now())
+	}
+
+	// Entries embedded by a fallback provider during the last run
+	if quarantine, ok := s.store.(contextstore.QuarantineStore); ok {
+		s.reembedQuarantined(context.Background(), quarantine, 0)
+	}
+
+	// Give back connections and cache memory while the editor leaves the
+	// server idle
+	if s.idleTimeout > 0 {
+		stop := make(chan struct{})
+		defer close(stop)
+		go s.watchIdle(s.idleTimeout, stop)
+	}
+
+	// Keep the long-lived process small when caches grow past the limit
+	if s.memoryLimit > 0 {
+		stop := make(chan struct{})
+		defer close(stop)
+		go s.watchMemory(s.memoryLimit, s.memoryCheckInterval, stop)
+	}
+
+	// Keep provider health fresh without a caller waiting on the providers
+	if prober, ok := s.summarizer.(summarizer.HealthProber); ok && prober.HealthProbeInterval() > 0 {
+		stop := make(chan struct{})
+		defer close(stop)
+		go s.probeHealth(prober, prober.HealthProbeInterval(), stop)
+	}
+
+	// Let monitoring see provider health without calling a tool
+	if s.healthSink != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+		go s.reportHealth(s.healthReportInterval, s.healthSink, stop)
+	}
+
+	// Show teams whether their memory is actually being used
+	if s.usageSink != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+		go s.reportUsage(s.usageReportInterval, s.usageSink, stop)
+	}
+
+	// Let hotkey scripts save text without an MCP client
+	if s.quickCaptureAddr != "" {
+		stop := make(chan struct{})
+		defer close(stop)
+		if err := s.serveQuickCapture(stop); err != nil {
+			return err
+		}
+	}
+
+	// Let backend services use the memory without an MCP client
+	if s.grpcAddr != "" {
+		stop := make(chan struct{})
+		defer close(stop)
+		if err := s.serveGRPC(stop); err != nil {
+			return err
+		}
+	}
+
+	// Keep links pointing at the repository as it changes
+	if s.linkIndex.Load() != nil && s.linkRefresh > 0 {
+		stop := make(chan struct{})
+		defer close(stop)
+		go s.refreshLinks(s.linkRefresh, stop)
+	}
+
+	// Keep ingested documentation in step with the repository
+	if len(s.watchDirs) > 0 {
+		stop := make(chan struct{})
+		defer close(stop)
+		go s.watchFiles(stop)
+	}
+
+	// Merge the redundant entries weeks of saving accumulate
+	if s.merger != nil && s.consolidateInterval > 0 {
+		stop := make(chan struct{})
+		defer close(stop)
+		s.background.Add(1)
+		go s.consolidatePeriodically(s.consolidateInterval, stop)
+	}
+
+	// Let Prometheus scrape the server's metrics
+	if s.metricsAddr != "" {
+		stop := make(chan struct{})
+		defer close(stop)
+		if err := s.serveMetrics(stop); err != nil {
+			return err
+		}
+	}
 
 	// Start the server using stdio transport
 	stdioServer := s.mcpServer.AsStdio()
-	return stdioServer.Run()
-}
-
-// Stop gracefully shuts down the MCP server.
-func (s *MCPContextToolServer) Stop() error {
-	slog.Info("Stopping MCP Context Tool Server")
-	// The server will exit when stdin is closed
-	return nil
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- stdioServer.Run()
+	}()
+
+	select {
+	case err := <-stopped:
+		return err
+	case <-s.stopping:
+		return nil
+	case received := <-signals:
+		s.logger.Info("Received signal, shutting down", "signal", received.String())
+		signalled = true
+		s.beginStop()
+		return nil
+	}
 }
 
 // handleSaveContext handles the save_context MCP tool call.
 func (s *MCPContextToolServer) handleSaveContext(ctx *server.Context, req tools.SaveContextRequest) (tools.SaveContextResponse, error) {
-	slog.Info("Processing save_context request", "text_length", len(req.ContextText))
+	s.logger.Info("Processing save_context request", "text_length", len(req.ContextText))
+	call := s.beginCall(ctx, tools.ToolSaveContext)
+	defer call.end()
 
 	response := tools.SaveContextResponse{
 		Status: "success",
 	}
 
-	// Generate summary
-	slog.Debug("Generating summary for save_context")
-	summary, err := s.summarizer.Summarize(req.ContextText)
+	// Resolve the schema version the client was built against
+	version, err := tools.ResolveSchemaVersion(req.Version)
 	if err != nil {
-		err = errortypes.APIError(err, "failed to summarize text").
-			WithField("text_length", len(req.ContextText))
-		errortypes.LogError(nil, err)
+		err = errortypes.ValidationError(err, "invalid save_context request").
+			WithField("version", req.Version)
+		errortypes.LogError(s.logger, err)
 
 		response.Status = "error"
 		response.Error = err.Error()
 		return response, nil
 	}
+	response.Version = version
 
-	// Create embedding
-	slog.Debug("Creating embedding for save_context")
-	embedding, err := s.embedder.CreateEmbedding(summary)
-	if err != nil {
-		err = errortypes.APIError(err, "failed to create embedding").
-			WithField("summary_length", len(summary))
-		errortypes.LogError(nil, err)
+	// Validate the request's fields
+	if invalid := s.validateSaveContext(req); invalid != nil {
+		response.Status = "error"
+		response.Error = s.rejectRequest(tools.ToolSaveContext, invalid).Error()
+		response.FieldErrors = invalid.fields
+		return response, nil
+	}
+
+	// Tags need a store that can hold them
+	_, canTag := s.store.(contextstore.TaggedStore)
+	if len(req.Tags) > 0 && !canTag {
+		err := errortypes.ValidationError(contextstore.ErrTagsUnsupported, "invalid save_context request").
+			WithField("tags", req.Tags)
+		errortypes.LogError(s.logger, err)
 
 		response.Status = "error"
 		response.Error = err.Error()
 		return response, nil
 	}
 
-	// Convert embedding to bytes
-	embeddingBytes, err := vector.Float32SliceToBytes(embedding)
-	if err != nil {
-		err = errortypes.APIError(err, "failed to convert embedding to bytes").
-			WithField("embedding_size", len(embedding))
-		errortypes.LogError(nil, err)
+	// A source needs a store that can record provenance
+	_, canTrace := s.store.(contextstore.ProvenanceStore)
+	if strings.TrimSpace(req.Source) != "" && !canTrace {
+		err := errortypes.ValidationError(contextstore.ErrProvenanceUnsupported, "invalid save_context request").
+			WithField("source", req.Source)
+		errortypes.LogError(s.logger, err)
 
 		response.Status = "error"
 		response.Error = err.Error()
 		return response, nil
 	}
 
-	// Generate ID (simple hash of content + timestamp)
-	timestamp := time.Now()
-	hasher := sha256.New()
-	hasher.Write([]byte(summary))
-	hasher.Write([]byte(timestamp.String()))
-	id := hex.EncodeToString(hasher.Sum(nil))[:16] // Use first 16 chars of the hash
-
-	// Store in context store
-	slog.Debug("Storing context for save_context", "id", id)
-	err = s.store.Store(id, summary, embeddingBytes, timestamp)
-	if err != nil {
-		err = errortypes.DatabaseError(err, "failed to store context").
-			WithField("context_id", id)
-		errortypes.LogError(nil, err)
+	// A batch needs a store that can track batches
+	batch := strings.TrimSpace(req.BatchID)
+	if _, canBatch := s.store.(contextstore.BatchStore); batch != "" && !canBatch {
+		err := errortypes.ValidationError(contextstore.ErrBatchesUnsupported, "invalid save_context request").
+			WithField("batch_id", req.BatchID)
+		errortypes.LogError(s.logger, err)
 
 		response.Status = "error"
 		response.Error = err.Error()
 		return response, nil
 	}
 
-	// Set response
-	response.ID = id
-	slog.Info("Successfully saved context", "id", id)
+	// A session needs a store that can track sessions
+	session := strings.TrimSpace(req.SessionID)
+	if _, canSession := s.store.(contextstore.SessionStore); session != "" && !canSession {
+		err := errortypes.ValidationError(contextstore.ErrSessionsUnsupported, "invalid save_context request").
+			WithField("session_id", req.SessionID)
+		errortypes.LogError(s.logger, err)
 
-	// Return response
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	// A namespace other than the default needs a store that keeps them
+	namespace := strings.TrimSpace(req.Namespace)
+	if namespace == contextstore.DefaultNamespace {
+		namespace = ""
+	}
+	if _, canNamespace := s.store.(contextstore.NamespacedStore); namespace != "" && !canNamespace {
+		err := errortypes.ValidationError(contextstore.ErrNamespacesUnsupported, "invalid save_context request").
+			WithField("namespace", req.Namespace)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	// A summary length needs a summarizer that can honor it
+	if err := s.checkSummaryLength(req.MaxSummaryLength); err != nil {
+		err = errortypes.ValidationError(err, "invalid save_context request").
+			WithField("max_summary_length", req.MaxSummaryLength)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	// Hold back a source saving more often or more text than the save
+	// limit allows, and answer a repeated save with the stored entry
+	source := strings.TrimSpace(req.Source)
+	decision := s.saveLimit.admit(source, req.ContextText, time.Now())
+	if decision.id != "" {
+		s.metrics.IncrementCounter(telemetry.MetricSavesCoalesced, 1)
+		s.logger.Info("Coalesced repeated save_context with the stored entry", "id", decision.id, "source", source)
+		response.ID = decision.id
+		response.Coalesced = true
+		return response, nil
+	}
+	if decision.retryAfter != 0 {
+		s.metrics.IncrementCounter(telemetry.MetricSavesThrottled, 1)
+		err := throttledError(source, decision.retryAfter)
+		s.logger.Warn("Throttled save_context", "source", source, "text_length", len(req.ContextText), "error", err)
+		response.Status = StatusThrottled
+		response.Error = err.Error()
+		if decision.retryAfter > 0 {
+			response.RetryAfterSeconds = retrySeconds(decision.retryAfter)
+		}
+		return response, nil
+	}
+
+	// Bound the provider calls, so a stuck one fails the call instead of
+	// holding it
+	callCtx, cancel := s.callContext(ctx)
+	defer cancel()
+
+	saved, err := s.saveEntry(callCtx, call, NewEntry{
+		Text:             req.ContextText,
+		Tags:             req.Tags,
+		Source:           req.Source,
+		Batch:            batch,
+		Session:          session,
+		Namespace:        namespace,
+		Untrusted:        req.Untrusted,
+		MaxSummaryLength: req.MaxSummaryLength,
+	})
+	if err != nil {
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	// Set response
+	s.saveLimit.stored(source, req.ContextText, saved.ID)
+	response.ID = saved.ID
+	response.Title = saved.Title
+	response.Quarantined = saved.Quarantined
+	response.SummaryUnavailable = saved.SummaryUnavailable
 	return response, nil
 }
 
 // handleRetrieveContext handles the retrieve_context MCP tool call.
 func (s *MCPContextToolServer) handleRetrieveContext(ctx *server.Context, req tools.RetrieveContextRequest) (tools.RetrieveContextResponse, error) {
-	slog.Info("Processing retrieve_context request", "query", req.Query, "limit", req.Limit)
+	s.logger.Info("Processing retrieve_context request", "query", req.Query, "queries", len(req.Queries), "limit", req.Limit, "namespace", req.Namespace)
+	call := s.beginCall(ctx, tools.ToolRetrieveContext)
+	defer call.end()
 
 	response := tools.RetrieveContextResponse{
 		Status: "success",
 	}
 
-	// Set default limit if not specified
-	limit := req.Limit
-	if limit <= 0 {
-		limit = tools.DefaultRetrieveLimit
-		slog.Debug("Using default limit for retrieve_context", "limit", limit)
+	// Resolve the schema version the client was built against
+	version, err := tools.ResolveSchemaVersion(req.Version)
+	if err != nil {
+		err = errortypes.ValidationError(err, "invalid retrieve_context request").
+			WithField("version", req.Version)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+	response.Version = version
+
+	// Validate the request's fields and map them onto a query
+	q, invalid := s.retrieveQuery(req)
+	if invalid != nil {
+		response.Status = "error"
+		response.Error = s.rejectRequest(tools.ToolRetrieveContext, invalid).Error()
+		response.FieldErrors = invalid.fields
+		return response, nil
 	}
 
-	// Create embedding for query
-	slog.Debug("Creating embedding for query in retrieve_context")
-	queryEmbedding, err := s.embedder.CreateEmbedding(req.Query)
+	// Run the query
+	callCtx, cancel := s.callContext(ctx)
+	defer cancel()
+	found, err := s.query(callCtx, call, q)
 	if err != nil {
-		err = errortypes.APIError(err, "failed to create embedding for query").
-			WithField("query", req.Query)
-		errortypes.LogError(nil, err)
+		errortypes.LogError(s.logger, err)
 
 		response.Status = "error"
 		response.Error = err.Error()
 		return response, nil
 	}
+	summaries := make([]string, len(found))
+	for i, result := range found {
+		summaries[i] = result.Summary
+	}
+	ids := resultIDs(found)
 
-	// Search context store
-	slog.Debug("Searching context store for retrieve_context")
-	results, err := s.store.Search(queryEmbedding, limit)
+	// Render the results for the agent if it asked for a format
+	formatted, err := renderResults(req.Format, summaries, ids)
 	if err != nil {
-		err = errortypes.DatabaseError(err, "failed to search context store").
-			WithField("limit", limit)
-		errortypes.LogError(nil, err)
+		err = errortypes.InternalError(err, "failed to render retrieve_context results").
+			WithField("format", req.Format)
+		errortypes.LogError(s.logger, err)
 
 		response.Status = "error"
 		response.Error = err.Error()
 		return response, nil
 	}
 
-	// Set response
-	response.Results = results
-	slog.Info("Successfully retrieved context results", "count", len(results))
+	// Set response, adapted to the client's schema version
+	response.Provenance = s.resultProvenance(ids)
+	response.Results = s.resultEntries(found, response.Provenance)
+	response.Generations = s.resultGenerations(ids)
+	response.Formatted = formatted
+	response = response.ForVersion(version)
+	s.logger.Info("Successfully retrieved context results", "count", len(found))
 
 	// Return response
 	return response, nil
@@ -221,25 +802,51 @@ func (s *MCPContextToolServer) handleRetrieveContext(ctx *server.Context, req to
 
 // handleDeleteContext handles the delete_context MCP tool call.
 func (s *MCPContextToolServer) handleDeleteContext(ctx *server.Context, req tools.DeleteContextRequest) (tools.DeleteContextResponse, error) {
-	slog.Info("Processing delete_context request", "id", req.ID)
+	s.logger.Info("Processing delete_context request", "id", req.ID)
+	call := s.beginCall(ctx, tools.ToolDeleteContext)
+	defer call.end()
 
 	response := tools.DeleteContextResponse{
 		Status: "success",
 	}
 
+	// Resolve the schema version the client was built against
+	version, err := tools.ResolveSchemaVersion(req.Version)
+	if err != nil {
+		err = errortypes.ValidationError(err, "invalid delete_context request").
+			WithField("version", req.Version)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+	response.Version = version
+
+	// Validate the request's fields
+	if invalid := s.validateDeleteContext(req); invalid != nil {
+		response.Status = "error"
+		response.Error = s.rejectRequest(tools.ToolDeleteContext, invalid).Error()
+		response.FieldErrors = invalid.fields
+		return response, nil
+	}
+
 	// Delete context entry
-	err := s.store.Delete(req.ID)
+	call.setStage(tools.StageDeleting)
+	deleteStart := time.Now()
+	err = s.store.Delete(req.ID)
+	s.recordStoreOperation("delete", deleteStart, err)
 	if err != nil {
 		err = errortypes.DatabaseError(err, "failed to delete context").
 			WithField("context_id", req.ID)
-		errortypes.LogError(nil, err)
+		errortypes.LogError(s.logger, err)
 
 		response.Status = "error"
 		response.Error = err.Error()
 		return response, nil
 	}
 
-	slog.Info("Successfully deleted context", "id", req.ID)
+	s.logger.Info("Successfully deleted context", "id", req.ID)
 
 	// Return response
 	return response, nil
@@ -247,75 +854,507 @@ func (s *MCPContextToolServer) handleDeleteContext(ctx *server.Context, req tool
 
 // handleClearAllContext handles the clear_all_context MCP tool call.
 func (s *MCPContextToolServer) handleClearAllContext(ctx *server.Context, req tools.ClearAllContextRequest) (tools.ClearAllContextResponse, error) {
-	slog.Info("Processing clear_all_context request")
+	s.logger.Info("Processing clear_all_context request")
+	call := s.beginCall(ctx, tools.ToolClearAllContext)
+	defer call.end()
 
 	response := tools.ClearAllContextResponse{
 		Status: "success",
 	}
 
+	// Resolve the schema version the client was built against
+	version, err := tools.ResolveSchemaVersion(req.Version)
+	if err != nil {
+		err = errortypes.ValidationError(err, "invalid clear_all_context request").
+			WithField("version", req.Version)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+	response.Version = version
+
 	// Check confirmation string
 	if req.Confirmation != "confirm" {
 		response.Status = "error"
 		response.Error = "Confirmation required. Set confirmation to 'confirm' to proceed with clearing all context"
-		slog.Warn("Clear all context operation rejected: missing confirmation")
+		s.logger.Warn("Clear all context operation rejected: missing confirmation")
 		return response, nil
 	}
 
-	// Clear all entries from context store
-	count, err := s.store.Clear()
+	// Clear all entries from context store, recoverably if the store can
+	call.setStage(tools.StageClearing)
+	now := time.Now()
+	count, err := 0, contextstore.ErrSoftClearUnsupported
+	if clearer, ok := s.store.(contextstore.SoftClearer); ok && !req.Permanent && s.clearGracePeriod > 0 {
+		s.purgeExpiredClears(clearer, now)
+		count, err = clearer.MarkCleared(now)
+		if err == nil {
+			response.RestorableUntil = now.Add(s.clearGracePeriod).Format(time.RFC3339)
+		}
+	}
+	if errors.Is(err, contextstore.ErrSoftClearUnsupported) {
+		count, err = s.store.Clear()
+	}
+	s.recordStoreOperation("clear", now, err)
 	if err != nil {
 		err = errortypes.DatabaseError(err, "failed to clear context store")
-		errortypes.LogError(nil, err)
+		errortypes.LogError(s.logger, err)
 
 		response.Status = "error"
 		response.Error = err.Error()
 		return response, nil
 	}
 
-	slog.Info("Successfully cleared context entries", "count", count)
+	s.logger.Info("Successfully cleared context entries", "count", count, "restorable_until", response.RestorableUntil)
 	response.DeletedCount = count
 
 	// Return response
 	return response, nil
 }
 
+// handleUndoClear handles the undo_clear MCP tool call.
+func (s *MCPContextToolServer) handleUndoClear(ctx *server.Context, req tools.UndoClearRequest) (tools.UndoClearResponse, error) {
+	s.logger.Info("Processing undo_clear request")
+	call := s.beginCall(ctx, tools.ToolUndoClear)
+	defer call.end()
+
+	response := tools.UndoClearResponse{
+		Status: "success",
+	}
+
+	// Resolve the schema version the client was built against
+	version, err := tools.ResolveSchemaVersion(req.Version)
+	if err != nil {
+		err = errortypes.ValidationError(err, "invalid undo_clear request").
+			WithField("version", req.Version)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+	response.Version = version
+
+	clearer, ok := s.store.(contextstore.SoftClearer)
+	if !ok {
+		err := errortypes.ValidationError(contextstore.ErrSoftClearUnsupported, "invalid undo_clear request")
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	// Restore the entries still within the grace period
+	call.setStage(tools.StageRestoring)
+	s.purgeExpiredClears(clearer, time.Now())
+	count, err := clearer.UndoClear()
+	if err != nil {
+		err = errortypes.DatabaseError(err, "failed to restore cleared context")
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	s.logger.Info("Successfully restored cleared context entries", "count", count)
+	response.RestoredCount = count
+
+	return response, nil
+}
+
+// handleSnapshotHash handles the snapshot_hash MCP tool call.
+func (s *MCPContextToolServer) handleSnapshotHash(ctx *server.Context, req tools.SnapshotHashRequest) (tools.SnapshotHashResponse, error) {
+	s.logger.Info("Processing snapshot_hash request", "namespace", req.Namespace)
+	call := s.beginCall(ctx, tools.ToolSnapshotHash)
+	defer call.end()
+
+	response := tools.SnapshotHashResponse{
+		Status: "success",
+		Hashes: map[string]string{},
+	}
+
+	// Resolve the schema version the client was built against
+	version, err := tools.ResolveSchemaVersion(req.Version)
+	if err != nil {
+		err = errortypes.ValidationError(err, "invalid snapshot_hash request").
+			WithField("version", req.Version)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+	response.Version = version
+
+	hasher, ok := s.store.(contextstore.SnapshotHasher)
+	if !ok {
+		err := errortypes.ValidationError(contextstore.ErrSnapshotUnsupported, "invalid snapshot_hash request")
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	call.setStage(tools.StageHashing)
+	hashes, err := hasher.SnapshotHashes()
+	if err != nil {
+		err = errortypes.DatabaseError(err, "failed to hash context")
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	// An empty namespace has no hash, like in SnapshotHashes
+	if req.Namespace == "" {
+		response.Hashes = hashes
+	} else if hash, exists := hashes[req.Namespace]; exists {
+		response.Hashes[req.Namespace] = hash
+	}
+
+	s.logger.Info("Successfully hashed context", "namespaces", len(response.Hashes))
+	return response, nil
+}
+
+// handleListBatches handles the list_batches MCP tool call.
+func (s *MCPContextToolServer) handleListBatches(ctx *server.Context, req tools.ListBatchesRequest) (tools.ListBatchesResponse, error) {
+	s.logger.Info("Processing list_batches request")
+	call := s.beginCall(ctx, tools.ToolListBatches)
+	defer call.end()
+
+	response := tools.ListBatchesResponse{
+		Status:  "success",
+		Batches: []tools.BatchInfo{},
+	}
+
+	// Resolve the schema version the client was built against
+	version, err := tools.ResolveSchemaVersion(req.Version)
+	if err != nil {
+		err = errortypes.ValidationError(err, "invalid list_batches request").
+			WithField("version", req.Version)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+	response.Version = version
+
+	store, ok := s.store.(contextstore.BatchStore)
+	if !ok {
+		err := errortypes.ValidationError(contextstore.ErrBatchesUnsupported, "invalid list_batches request")
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	call.setStage(tools.StageListing)
+	batches, err := store.ListBatches()
+	if err != nil {
+		err = errortypes.DatabaseError(err, "failed to list batches")
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	for _, batch := range batches {
+		response.Batches = append(response.Batches, tools.BatchInfo{
+			ID:          batch.ID,
+			Entries:     batch.Entries,
+			FirstStored: batch.FirstStored.Format(time.RFC3339),
+			LastStored:  batch.LastStored.Format(time.RFC3339),
+		})
+	}
+
+	s.logger.Info("Successfully listed batches", "count", len(response.Batches))
+	return response, nil
+}
+
+// handleRollbackBatch handles the rollback_batch MCP tool call.
+func (s *MCPContextToolServer) handleRollbackBatch(ctx *server.Context, req tools.RollbackBatchRequest) (tools.RollbackBatchResponse, error) {
+	s.logger.Info("Processing rollback_batch request", "batch_id", req.BatchID)
+	call := s.beginCall(ctx, tools.ToolRollbackBatch)
+	defer call.end()
+
+	response := tools.RollbackBatchResponse{
+		Status: "success",
+	}
+
+	// Resolve the schema version the client was built against
+	version, err := tools.ResolveSchemaVersion(req.Version)
+	if err != nil {
+		err = errortypes.ValidationError(err, "invalid rollback_batch request").
+			WithField("version", req.Version)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+	response.Version = version
+
+	// Check confirmation string
+	if req.Confirmation != "confirm" {
+		response.Status = "error"
+		response.Error = "Confirmation required. Set confirmation to 'confirm' to proceed with deleting the batch"
+		s.logger.Warn("Rollback batch operation rejected: missing confirmation", "batch_id", req.BatchID)
+		return response, nil
+	}
+
+	// Validate the request's fields
+	if invalid := s.validateRollbackBatch(req); invalid != nil {
+		response.Status = "error"
+		response.Error = s.rejectRequest(tools.ToolRollbackBatch, invalid).Error()
+		response.FieldErrors = invalid.fields
+		return response, nil
+	}
+
+	store, ok := s.store.(contextstore.BatchStore)
+	batch := strings.TrimSpace(req.BatchID)
+	if !ok {
+		err := errortypes.ValidationError(contextstore.ErrBatchesUnsupported, "invalid rollback_batch request").
+			WithField("batch_id", req.BatchID)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	call.setStage(tools.StageDeleting)
+	count, err := store.DeleteBatch(batch)
+	if err != nil {
+		err = errortypes.DatabaseError(err, "failed to roll back batch").
+			WithField("batch_id", batch)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	response.DeletedCount = count
+	s.logger.Info("Successfully rolled back batch", "batch_id", batch, "count", count)
+	return response, nil
+}
+
+// purgeExpiredClears permanently deletes entries cleared more than the grace
+// period before now. Failures are logged; the entries are purged next time.
+func (s *MCPContextToolServer) purgeExpiredClears(clearer contextstore.SoftClearer, now time.Time) {
+	count, err := clearer.PurgeCleared(now.Add(-s.clearGracePeriod))
+	if err != nil {
+		if !errors.Is(err, contextstore.ErrSoftClearUnsupported) {
+			s.logger.Warn("Failed to purge expired cleared entries", "error", err)
+		}
+		return
+	}
+	if count > 0 {
+		s.logger.Info("Purged cleared entries past their grace period", "count", count)
+	}
+}
+
+// traceSaved records the provenance of a newly saved entry if the store
+// can: the caller's source, if any, followed by via, or the save_context
+// tool if via is empty. If that fails the entry is removed again so it
+// cannot be retrieved without a way to trace it, and the logged error is
+// returned.
+func (s *MCPContextToolServer) traceSaved(id string, source string, via string) error {
+	provenance, ok := s.store.(contextstore.ProvenanceStore)
+	if !ok {
+		return nil
+	}
+
+	if via == "" {
+		via = contextstore.SourceTool + ":" + tools.ToolSaveContext
+	}
+	chain := contextstore.AppendProvenance(nil, source, via)
+	err := provenance.SetProvenance(id, chain)
+	if err == nil {
+		return nil
+	}
+	if deleteErr := s.store.Delete(id); deleteErr != nil {
+		s.logger.Warn("Failed to remove untraced context entry", "id", id, "error", deleteErr)
+	}
+
+	err = errortypes.DatabaseError(err, "failed to record context provenance").
+		WithField("context_id", id).
+		WithField("source", source)
+	errortypes.LogError(s.logger, err)
+	return err
+}
+
+// batchSaved records the batch of a newly saved entry, if it has one. If
+// that fails the entry is removed again so a rollback cannot miss it, and
+// the logged error is returned.
+func (s *MCPContextToolServer) batchSaved(id string, batch string) error {
+	store, ok := s.store.(contextstore.BatchStore)
+	if !ok || batch == "" {
+		return nil
+	}
+
+	err := store.SetBatch(id, batch)
+	if err == nil {
+		return nil
+	}
+	if deleteErr := s.store.Delete(id); deleteErr != nil {
+		s.logger.Warn("Failed to remove unbatched context entry", "id", id, "error", deleteErr)
+	}
+
+	err = errortypes.DatabaseError(err, "failed to record context batch").
+		WithField("context_id", id).
+		WithField("batch_id", batch)
+	errortypes.LogError(s.logger, err)
+	return err
+}
+
+// reembedQuarantined re-embeds quarantined entries, oldest first, and moves
+// them into the index. It stops as soon as the primary embedding provider
+// fails or a fallback answers instead. A limit of 0 re-embeds every entry.
+// Failures are logged rather than returned, since entries stay quarantined
+// and are retried later. It also stops once ctx is done.
+func (s *MCPContextToolServer) reembedQuarantined(ctx context.Context, quarantine contextstore.QuarantineStore, limit int) int {
+	entries, err := quarantine.ListQuarantined()
+	if err != nil {
+		s.logger.Warn("Failed to list quarantined context entries", "error", err)
+		return 0
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	released := 0
+	for _, entry := range entries {
+		embedding, err := vector.CreateEmbeddingContext(ctx, s.embedder, entry.SummaryText)
+		if err == nil {
+			err = vector.ValidateEmbedding(embedding.Vector)
+		}
+		if err != nil || embedding.Fallback {
+			s.logger.Debug("Primary embedding provider unavailable, leaving entries quarantined", "error", err)
+			break
+		}
+
+		embeddingBytes, err := vector.Float32SliceToBytes(embedding.Vector)
+		if err == nil {
+			err = quarantine.ReleaseQuarantined(entry.ID, embeddingBytes)
+		}
+		if err != nil {
+			s.logger.Warn("Failed to release quarantined context entry", "id", entry.ID, "error", err)
+			continue
+		}
+		released++
+	}
+
+	if released > 0 {
+		s.logger.Info("Re-embedded quarantined context entries", "count", released)
+	}
+	return released
+}
+
 // handleReplaceContext handles the replace_context MCP tool call.
 func (s *MCPContextToolServer) handleReplaceContext(ctx *server.Context, req tools.ReplaceContextRequest) (tools.ReplaceContextResponse, error) {
-	slog.Info("Processing replace_context request", "id", req.ID, "new_text_length", len(req.ContextText))
+	s.logger.Info("Processing replace_context request", "id", req.ID, "new_text_length", len(req.ContextText))
+	call := s.beginCall(ctx, tools.ToolReplaceContext)
+	defer call.end()
 
 	response := tools.ReplaceContextResponse{
 		Status: "success",
 	}
 
-	// Validate ID
-	if req.ID == "" {
-		err := errortypes.ValidationError(errors.New("id cannot be empty for replace_context"), "invalid replace_context request")
-		errortypes.LogError(nil, err)
+	// Resolve the schema version the client was built against
+	version, err := tools.ResolveSchemaVersion(req.Version)
+	if err != nil {
+		err = errortypes.ValidationError(err, "invalid replace_context request").
+			WithField("version", req.Version)
+		errortypes.LogError(s.logger, err)
+
 		response.Status = "error"
 		response.Error = err.Error()
 		return response, nil
 	}
+	response.Version = version
+
+	// Validate the request's fields
+	if invalid := s.validateReplaceContext(req); invalid != nil {
+		response.Status = "error"
+		response.Error = s.rejectRequest(tools.ToolReplaceContext, invalid).Error()
+		response.FieldErrors = invalid.fields
+		return response, nil
+	}
+
+	// A source needs a store that can record provenance
+	if strings.TrimSpace(req.Source) != "" {
+		if _, ok := s.store.(contextstore.ProvenanceStore); !ok {
+			err := errortypes.ValidationError(contextstore.ErrProvenanceUnsupported, "invalid replace_context request").
+				WithField("source", req.Source)
+			errortypes.LogError(s.logger, err)
+
+			response.Status = "error"
+			response.Error = err.Error()
+			return response, nil
+		}
+	}
+
+	// A summary length needs a summarizer that can honor it
+	if err := s.checkSummaryLength(req.MaxSummaryLength); err != nil {
+		err = errortypes.ValidationError(err, "invalid replace_context request").
+			WithField("max_summary_length", req.MaxSummaryLength)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	// Bound the provider calls, so a stuck one fails the call instead of
+	// holding it
+	callCtx, cancel := s.callContext(ctx)
+	defer cancel()
 
 	// Generate summary
-	slog.Debug("Generating summary for replace_context")
-	summary, err := s.summarizer.Summarize(req.ContextText)
+	s.logger.Debug("Generating summary for replace_context")
+	call.setStage(tools.StageSummarizing)
+	written, err := s.summarizeOrVerbatim(callCtx, req.ContextText, req.MaxSummaryLength)
+	summary, generation := written.Text, written.Generation
+	if err == nil && summary == "" && strings.TrimSpace(req.ContextText) != "" {
+		err = summarizer.ErrEmptySummary
+	}
 	if err != nil {
 		err = errortypes.APIError(err, "failed to summarize new text for replace_context").
 			WithField("text_length", len(req.ContextText))
-		errortypes.LogError(nil, err)
+		errortypes.LogError(s.logger, err)
 
 		response.Status = "error"
 		response.Error = err.Error()
 		return response, nil
 	}
-
-	// Create embedding
-	slog.Debug("Creating new embedding for replace_context")
-	embedding, err := s.embedder.CreateEmbedding(summary)
+	response.SummaryUnavailable = generation.Summarizer == summarizer.GeneratedVerbatim
+
+	// Create embedding. The entry stays in the index, so only the primary
+	// provider's embedding will do
+	s.logger.Debug("Creating new embedding for replace_context")
+	call.setStage(tools.StageEmbedding)
+	sourced, err := vector.CreateEntryEmbedding(callCtx, s.embedder, s.embedInput, summary, req.ContextText)
+	embedding := sourced.Vector
+	if err == nil && sourced.Fallback {
+		err = ErrFallbackEmbedding
+	}
+	if err == nil {
+		err = vector.ValidateEmbedding(embedding)
+	}
 	if err != nil {
 		err = errortypes.APIError(err, "failed to create new embedding for replace_context").
 			WithField("summary_length", len(summary))
-		errortypes.LogError(nil, err)
+		errortypes.LogError(s.logger, err)
 
 		response.Status = "error"
 		response.Error = err.Error()
@@ -327,7 +1366,19 @@ func (s *MCPContextToolServer) handleReplaceContext(ctx *server.Context, req too
 	if err != nil {
 		err = errortypes.APIError(err, "failed to convert new embedding to bytes for replace_context").
 			WithField("embedding_size", len(embedding))
-		errortypes.LogError(nil, err)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	// A call that ran out of time leaves the entry as it was
+	if err := callCtx.Err(); err != nil {
+		err = errortypes.APIError(err, "replace_context ran out of time before storing").
+			WithField("context_id", req.ID).
+			WithField("timeout", s.requestTimeout.String())
+		errortypes.LogError(s.logger, err)
 
 		response.Status = "error"
 		response.Error = err.Error()
@@ -335,21 +1386,233 @@ func (s *MCPContextToolServer) handleReplaceContext(ctx *server.Context, req too
 	}
 
 	// Store (Replace) in context store
-	slog.Debug("Replacing context for replace_context", "id", req.ID)
+	s.logger.Debug("Replacing context for replace_context", "id", req.ID)
+	call.setStage(tools.StageStoring)
 	timestamp := time.Now()
 	err = s.store.Replace(req.ID, summary, embeddingBytes, timestamp)
+	s.recordStoreOperation("replace", timestamp, err)
 	if err != nil {
 		err = errortypes.DatabaseError(err, "failed to replace context for replace_context").
 			WithField("context_id", req.ID)
-		errortypes.LogError(nil, err)
+		errortypes.LogError(s.logger, err)
 
 		response.Status = "error"
 		response.Error = err.Error()
 		return response, nil
 	}
 
-	slog.Info("Successfully replaced context", "id", req.ID)
+	// The text has been replaced, so a provenance failure is only logged
+	if provenance, ok := s.store.(contextstore.ProvenanceStore); ok {
+		chain, err := provenance.GetProvenance(req.ID)
+		if err == nil {
+			chain = contextstore.AppendProvenance(chain, req.Source, contextstore.SourceTool+":"+tools.ToolReplaceContext)
+			err = provenance.SetProvenance(req.ID, chain)
+		}
+		if err != nil {
+			s.logger.Warn("Failed to record provenance of replaced context", "id", req.ID, "error", err)
+		}
+	}
+	s.recordGeneration(req.ID, generation)
+	s.recordTitle(req.ID, written.Title)
+	s.recordReferences(req.ID, req.ContextText)
+	response.Title = written.Title
+
+	s.logger.Info("Successfully replaced context", "id", req.ID)
 
 	// Return response
 	return response, nil
 }
+
+// handleListActiveRequests handles the list_active_requests MCP tool call.
+// The call itself is not tracked, so it never lists itself.
+func (s *MCPContextToolServer) handleListActiveRequests(ctx *server.Context, req tools.ListActiveRequestsRequest) (tools.ListActiveRequestsResponse, error) {
+	s.logger.Debug("Processing list_active_requests request")
+
+	response := tools.ListActiveRequestsResponse{
+		Status: "success",
+	}
+
+	// Resolve the schema version the client was built against
+	version, err := tools.ResolveSchemaVersion(req.Version)
+	if err != nil {
+		err = errortypes.ValidationError(err, "invalid list_active_requests request").
+			WithField("version", req.Version)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+	response.Version = version
+
+	response.Requests = s.requests.snapshot(time.Now())
+
+	return response, nil
+}
+
+// handleMemoryStatus handles the memory_status MCP tool call. It never calls
+// a provider, so clients can poll it cheaply before saving.
+func (s *MCPContextToolServer) handleMemoryStatus(ctx *server.Context, req tools.MemoryStatusRequest) (tools.MemoryStatusResponse, error) {
+	s.logger.Debug("Processing memory_status request")
+
+	response := tools.MemoryStatusResponse{
+		Status:    "success",
+		Providers: map[string]string{},
+	}
+
+	// Resolve the schema version the client was built against
+	version, err := tools.ResolveSchemaVersion(req.Version)
+	if err != nil {
+		err = errortypes.ValidationError(err, "invalid memory_status request").
+			WithField("version", req.Version)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+	response.Version = version
+
+	response.ActiveRequests = len(s.requests.snapshot(time.Now()))
+
+	reporter, ok := s.summarizer.(summarizer.LoadReporter)
+	if !ok {
+		return response, nil
+	}
+	load := reporter.Load()
+
+	response.QueueDepth = load.QueueDepth
+	response.ProviderRequests = load.ActiveRequests
+	response.MaxConcurrency = load.MaxConcurrency
+	response.OverBudget = load.OverBudget
+
+	healthy := 0
+	for name, health := range load.Providers {
+		response.Providers[name] = string(health)
+		if health == summarizer.StatusHealthy {
+			healthy++
+		}
+	}
+
+	if load.QueueDepth > 0 {
+		response.DeferReasons = append(response.DeferReasons, tools.DeferQueueFull)
+	}
+	// Over budget, saves are summarized without a provider
+	if len(load.Providers) > 0 && healthy == 0 && !load.OverBudget {
+		response.DeferReasons = append(response.DeferReasons, tools.DeferProvidersFailing)
+	}
+	response.DeferNonCritical = len(response.DeferReasons) > 0
+
+	return response, nil
+}
+
+// handleCleanupReport handles the cleanup_report MCP tool call.
+func (s *MCPContextToolServer) handleCleanupReport(ctx *server.Context, req tools.CleanupReportRequest) (tools.CleanupReportResponse, error) {
+	s.logger.Info("Processing cleanup_report request", "min_score", req.MinScore, "dry_run", req.DryRun)
+	call := s.beginCall(ctx, tools.ToolCleanupReport)
+	defer call.end()
+
+	response := tools.CleanupReportResponse{
+		Status:     "success",
+		Candidates: []tools.CleanupCandidate{},
+		DryRun:     req.DryRun,
+	}
+
+	// Resolve the schema version the client was built against
+	version, err := tools.ResolveSchemaVersion(req.Version)
+	if err != nil {
+		err = errortypes.ValidationError(err, "invalid cleanup_report request").
+			WithField("version", req.Version)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+	response.Version = version
+
+	// Validate the request's fields
+	if invalid := s.validateCleanupReport(req); invalid != nil {
+		response.Status = "error"
+		response.Error = s.rejectRequest(tools.ToolCleanupReport, invalid).Error()
+		response.FieldErrors = invalid.fields
+		return response, nil
+	}
+
+	// The report needs a store that tracks usage
+	usage, ok := s.store.(contextstore.UsageStore)
+	if !ok {
+		err := errortypes.ValidationError(contextstore.ErrUsageUnsupported, "invalid cleanup_report request")
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = tools.DefaultCleanupReportLimit
+	}
+
+	// Score every entry
+	call.setStage(tools.StageAnalyzing)
+	entries, err := usage.ListEntries()
+	if err != nil {
+		err = errortypes.DatabaseError(err, "failed to list context entries")
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	options := s.cleanup.Options
+	if req.MinScore > 0 {
+		options.MinScore = req.MinScore
+	}
+	candidates := cleanup.Analyze(entries, options)
+
+	for i, candidate := range candidates {
+		if i == limit {
+			break
+		}
+		response.Candidates = append(response.Candidates, tools.CleanupCandidate{
+			ID:          candidate.ID,
+			Summary:     candidate.SummaryText,
+			Title:       candidate.Title,
+			Score:       candidate.Score,
+			Reasons:     candidate.Reasons,
+			DuplicateOf: candidate.DuplicateOf,
+			Retrievals:  candidate.Retrievals,
+		})
+	}
+
+	// Apply the cleanup policy. Deleting is disabled along with
+	// delete_context, leaving a dry run.
+	dryRun := req.DryRun || !s.toolEnabled(tools.ToolDeleteContext)
+	response.DryRun = dryRun
+	selected := s.cleanup.Select(candidates)
+	if !dryRun && len(selected) > 0 {
+		call.setStage(tools.StageDeleting)
+	}
+	for _, candidate := range selected {
+		if !dryRun {
+			if err := s.store.Delete(candidate.ID); err != nil {
+				err = errortypes.DatabaseError(err, "failed to delete cleanup candidate").
+					WithField("context_id", candidate.ID)
+				errortypes.LogError(s.logger, err)
+
+				response.Status = "error"
+				response.Error = err.Error()
+				return response, nil
+			}
+		}
+		response.Deleted = append(response.Deleted, candidate.ID)
+	}
+
+	s.logger.Info("Cleanup report complete", "entries", len(entries), "candidates", len(candidates),
+		"deleted", len(response.Deleted), "dry_run", dryRun)
+
+	return response, nil
+}
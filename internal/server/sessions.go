@@ -0,0 +1,165 @@
+package server
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/localrivet/gomcp/server"
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/errortypes"
+	"github.com/localrivet/projectmemory/internal/tools"
+)
+
+// ErrMissingSessionID is returned when expire_session names no session.
+var ErrMissingSessionID = errors.New("session_id is required")
+
+// sessionSaved records the agent session of a newly saved entry, if it has
+// one. If that fails the entry is removed again so expiring the session
+// cannot miss it, and the logged error is returned.
+func (s *MCPContextToolServer) sessionSaved(id string, session string) error {
+	store, ok := s.store.(contextstore.SessionStore)
+	if !ok || session == "" {
+		return nil
+	}
+
+	err := store.SetSession(id, session)
+	if err == nil {
+		return nil
+	}
+	if deleteErr := s.store.Delete(id); deleteErr != nil {
+		s.logger.Warn("Failed to remove context entry outside its session", "id", id, "error", deleteErr)
+	}
+
+	err = errortypes.DatabaseError(err, "failed to record context session").
+		WithField("context_id", id).
+		WithField("session_id", session)
+	errortypes.LogError(s.logger, err)
+	return err
+}
+
+// handleListSessions handles the list_sessions MCP tool call.
+func (s *MCPContextToolServer) handleListSessions(ctx *server.Context, req tools.ListSessionsRequest) (tools.ListSessionsResponse, error) {
+	s.logger.Info("Processing list_sessions request")
+	call := s.beginCall(ctx, tools.ToolListSessions)
+	defer call.end()
+
+	response := tools.ListSessionsResponse{
+		Status:   "success",
+		Sessions: []tools.SessionInfo{},
+	}
+
+	// Resolve the schema version the client was built against
+	version, err := tools.ResolveSchemaVersion(req.Version)
+	if err != nil {
+		err = errortypes.ValidationError(err, "invalid list_sessions request").
+			WithField("version", req.Version)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+	response.Version = version
+
+	store, ok := s.store.(contextstore.SessionStore)
+	if !ok {
+		err := errortypes.ValidationError(contextstore.ErrSessionsUnsupported, "invalid list_sessions request")
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	call.setStage(tools.StageListing)
+	sessions, err := store.ListSessions()
+	if err != nil {
+		err = errortypes.DatabaseError(err, "failed to list sessions")
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	for _, session := range sessions {
+		response.Sessions = append(response.Sessions, tools.SessionInfo{
+			ID:          session.ID,
+			Entries:     session.Entries,
+			FirstStored: session.FirstStored.Format(time.RFC3339),
+			LastStored:  session.LastStored.Format(time.RFC3339),
+		})
+	}
+
+	s.logger.Info("Successfully listed sessions", "count", len(response.Sessions))
+	return response, nil
+}
+
+// handleExpireSession handles the expire_session MCP tool call.
+func (s *MCPContextToolServer) handleExpireSession(ctx *server.Context, req tools.ExpireSessionRequest) (tools.ExpireSessionResponse, error) {
+	s.logger.Info("Processing expire_session request", "session_id", req.SessionID)
+	call := s.beginCall(ctx, tools.ToolExpireSession)
+	defer call.end()
+
+	response := tools.ExpireSessionResponse{
+		Status: "success",
+	}
+
+	// Resolve the schema version the client was built against
+	version, err := tools.ResolveSchemaVersion(req.Version)
+	if err != nil {
+		err = errortypes.ValidationError(err, "invalid expire_session request").
+			WithField("version", req.Version)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+	response.Version = version
+
+	// Check confirmation string
+	if req.Confirmation != "confirm" {
+		response.Status = "error"
+		response.Error = "Confirmation required. Set confirmation to 'confirm' to proceed with deleting the session"
+		s.logger.Warn("Expire session operation rejected: missing confirmation", "session_id", req.SessionID)
+		return response, nil
+	}
+
+	// Validate the request's fields
+	if invalid := s.validateExpireSession(req); invalid != nil {
+		response.Status = "error"
+		response.Error = s.rejectRequest(tools.ToolExpireSession, invalid).Error()
+		response.FieldErrors = invalid.fields
+		return response, nil
+	}
+
+	store, ok := s.store.(contextstore.SessionStore)
+	session := strings.TrimSpace(req.SessionID)
+	if !ok {
+		err := errortypes.ValidationError(contextstore.ErrSessionsUnsupported, "invalid expire_session request").
+			WithField("session_id", req.SessionID)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	call.setStage(tools.StageDeleting)
+	count, err := store.DeleteSession(session)
+	if err != nil {
+		err = errortypes.DatabaseError(err, "failed to expire session").
+			WithField("session_id", session)
+		errortypes.LogError(s.logger, err)
+
+		response.Status = "error"
+		response.Error = err.Error()
+		return response, nil
+	}
+
+	response.DeletedCount = count
+	s.logger.Info("Successfully expired session", "session_id", session, "count", count)
+	return response, nil
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"errors"
+	"time"
+
+	"github.com/localrivet/gomcp/server"
+)
+
+// DefaultShutdownTimeout is how long Stop waits for calls in flight and
+// background work before closing the store anyway.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// ErrServerStopping answers tool calls made after Stop began.
+var ErrServerStopping = errors.New("server is shutting down")
+
+// SetShutdownTimeout sets how long Stop waits for calls in flight, queued
+// quick captures and the shutdown of the gRPC, quick-capture and metrics
+// endpoints before closing the store anyway. It must be called before
+// Start.
+func (s *MCPContextToolServer) SetShutdownTimeout(timeout time.Duration) {
+	s.shutdownTimeout = timeout
+}
+
+// whileRunning wraps a tool handler so it refuses calls once Stop began.
+// Calls already in flight finish.
+func whileRunning[Req, Resp any](s *MCPContextToolServer, handler func(*server.Context, Req) (Resp, error)) func(*server.Context, Req) (Resp, error) {
+	return func(ctx *server.Context, req Req) (Resp, error) {
+		select {
+		case <-s.stopping:
+			var response Resp
+			return response, ErrServerStopping
+		default:
+			return handler(ctx, req)
+		}
+	}
+}
+
+// beginStop makes Start return and tool calls be refused. It may be called
+// more than once.
+func (s *MCPContextToolServer) beginStop() {
+	s.stopOnce.Do(func() { close(s.stopping) })
+}
+
+// Stop gracefully shuts down the MCP server: it refuses new tool calls,
+// stops the background services and endpoints, waits up to the shutdown
+// timeout for calls in flight and queued quick captures, then closes the
+// store, committing its pending writes. It may be called whether or not
+// Start was, and more than once; later calls return the first one's
+// result.
+func (s *MCPContextToolServer) Stop() error {
+	s.shutdownOnce.Do(func() {
+		s.shutdownErr = s.shutdown()
+	})
+	return s.shutdownErr
+}
+
+// shutdown does the work of Stop
+func (s *MCPContextToolServer) shutdown() error {
+	s.logger.Info("Stopping MCP Context Tool Server")
+	s.beginStop()
+
+	deadline := time.NewTimer(s.shutdownTimeout)
+	defer deadline.Stop()
+
+	// Start shuts the endpoints down as it returns, and their goroutines
+	// finish once the calls and captures they accepted are done
+	background := make(chan struct{})
+	go func() {
+		if s.running.Load() {
+			<-s.exited
+		}
+		s.background.Wait()
+		close(background)
+	}()
+
+	drained := true
+	select {
+	case <-background:
+		select {
+		case <-s.requests.drain():
+		case <-deadline.C:
+			drained = false
+		}
+	case <-deadline.C:
+		drained = false
+	}
+	if !drained {
+		s.logger.Warn("Shutdown timed out; closing the store with work in flight",
+			"timeout", s.shutdownTimeout, "active_requests", s.requests.snapshot(time.Now()))
+	}
+
+	if err := s.store.Close(); err != nil {
+		s.logger.Error("Failed to close store", "error", err)
+		return err
+	}
+	s.logger.Info("MCP Context Tool Server stopped")
+	return nil
+}
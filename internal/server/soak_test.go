@@ -0,0 +1,231 @@
+//go:build cgo && !purego
+
+package server
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/summarizer"
+	"github.com/localrivet/projectmemory/internal/tools"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+// Soak mode is off by default. Enable it with, for example:
+//
+//	go test ./internal/server -run TestSoak -soak=4h -timeout 0
+var (
+	soakDuration   = flag.Duration("soak", 0, "run the soak test for this long (0 disables it)")
+	soakInterval   = flag.Duration("soak.interval", time.Minute, "how often the soak test samples resource usage")
+	soakHeapGrowth = flag.Float64("soak.heapgrowth", 2.0, "maximum allowed ratio of final to baseline live heap")
+)
+
+const (
+	// soakGoroutineSlack is how many goroutines above baseline are tolerated
+	// before the soak test reports a leak.
+	soakGoroutineSlack = 5
+
+	// soakMinHeapBytes keeps the heap growth check from flagging noise when
+	// the baseline heap is tiny.
+	soakMinHeapBytes = 8 << 20
+
+	// soakReopenEvery is how many load iterations run between store reopens,
+	// which exercises the Initialize/Close path the way editor restarts do.
+	soakReopenEvery = 500
+)
+
+// soakSample is a snapshot of the resources the soak test watches for leaks.
+type soakSample struct {
+	at         time.Time
+	goroutines int
+	heapBytes  uint64
+	dbHandles  int // -1 when the platform cannot report open files
+}
+
+// takeSoakSample forces a GC so heap figures reflect live memory only.
+func takeSoakSample(dbPath string) soakSample {
+	runtime.GC()
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	return soakSample{
+		at:         time.Now(),
+		goroutines: runtime.NumGoroutine(),
+		heapBytes:  mem.HeapAlloc,
+		dbHandles:  countOpenFiles(dbPath),
+	}
+}
+
+// countOpenFiles counts this process's file descriptors that refer to the
+// database or its journal files. It returns -1 where /proc is unavailable.
+func countOpenFiles(dbPath string) int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+
+	count := 0
+	for _, entry := range entries {
+		target, err := os.Readlink(filepath.Join("/proc/self/fd", entry.Name()))
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(target, dbPath) {
+			count++
+		}
+	}
+	return count
+}
+
+// checkSoakLeaks compares the final sample against the baseline and returns
+// one message per resource that grew beyond its allowance.
+func checkSoakLeaks(baseline, final soakSample, maxHeapGrowth float64) []string {
+	var leaks []string
+
+	if final.goroutines > baseline.goroutines+soakGoroutineSlack {
+		leaks = append(leaks, fmt.Sprintf("goroutines grew from %d to %d", baseline.goroutines, final.goroutines))
+	}
+
+	heapLimit := uint64(float64(max(baseline.heapBytes, soakMinHeapBytes)) * maxHeapGrowth)
+	if final.heapBytes > heapLimit {
+		leaks = append(leaks, fmt.Sprintf("live heap grew from %d to %d bytes (limit %d)", baseline.heapBytes, final.heapBytes, heapLimit))
+	}
+
+	if baseline.dbHandles >= 0 && final.dbHandles > baseline.dbHandles {
+		leaks = append(leaks, fmt.Sprintf("open SQLite handles grew from %d to %d", baseline.dbHandles, final.dbHandles))
+	}
+
+	return leaks
+}
+
+// TestSoak drives synthetic save/retrieve/replace/delete/clear load through
+// the tool handlers against a real SQLite store for -soak, then fails if
+// goroutines, live heap or SQLite file handles leaked. The stdio server runs
+// for weeks inside editors, so slow leaks matter more than throughput.
+func TestSoak(t *testing.T) {
+	if *soakDuration <= 0 {
+		t.Skip("soak test disabled; run with -soak=<duration>")
+	}
+
+	// Hours of per-request logging would dwarf the samples
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer slog.SetDefault(defaultLogger)
+
+	dbPath := filepath.Join(t.TempDir(), "soak.db")
+	store := contextstore.NewSQLiteContextStore()
+	if err := store.Initialize(dbPath); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+	defer func() { store.Close() }()
+
+	srv := NewContextToolServer(store, summarizer.NewBasicSummarizer(200), vector.NewMockEmbedder(vector.DefaultEmbeddingDimensions))
+	if err := srv.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize server: %v", err)
+	}
+
+	// Warm up once so lazily allocated state is part of the baseline
+	runSoakIteration(t, srv, 0)
+	baseline := takeSoakSample(dbPath)
+	t.Logf("baseline: goroutines=%d heap=%d db_handles=%d", baseline.goroutines, baseline.heapBytes, baseline.dbHandles)
+
+	deadline := time.Now().Add(*soakDuration)
+	nextSample := time.Now().Add(*soakInterval)
+	iterations := 0
+	for time.Now().Before(deadline) {
+		iterations++
+		runSoakIteration(t, srv, iterations)
+
+		if iterations%soakReopenEvery == 0 {
+			if err := store.Close(); err != nil {
+				t.Fatalf("Failed to close store: %v", err)
+			}
+			store = contextstore.NewSQLiteContextStore()
+			if err := store.Initialize(dbPath); err != nil {
+				t.Fatalf("Failed to reopen store: %v", err)
+			}
+			srv.store = store
+		}
+
+		if time.Now().After(nextSample) {
+			sample := takeSoakSample(dbPath)
+			t.Logf("%s: iterations=%d goroutines=%d heap=%d db_handles=%d",
+				sample.at.Format(time.RFC3339), iterations, sample.goroutines, sample.heapBytes, sample.dbHandles)
+			nextSample = sample.at.Add(*soakInterval)
+		}
+	}
+
+	final := takeSoakSample(dbPath)
+	for _, leak := range checkSoakLeaks(baseline, final, *soakHeapGrowth) {
+		t.Errorf("Leak detected after %d iterations: %s", iterations, leak)
+	}
+}
+
+// runSoakIteration exercises every tool once. Each iteration leaves the
+// store empty so row growth is not mistaken for a leak.
+func runSoakIteration(t *testing.T, srv *MCPContextToolServer, i int) {
+	t.Helper()
+
+	text := fmt.Sprintf("Soak entry %d: the deploy pipeline runs migrations before restarting workers.", i)
+	saveResp, _ := srv.handleSaveContext(nil, tools.SaveContextRequest{ContextText: text})
+	if saveResp.Status != "success" {
+		t.Fatalf("save_context failed on iteration %d: %s", i, saveResp.Error)
+	}
+
+	retrieveResp, _ := srv.handleRetrieveContext(nil, tools.RetrieveContextRequest{Query: "deploy pipeline", Limit: 5})
+	if retrieveResp.Status != "success" {
+		t.Fatalf("retrieve_context failed on iteration %d: %s", i, retrieveResp.Error)
+	}
+
+	replaceResp, _ := srv.handleReplaceContext(nil, tools.ReplaceContextRequest{ID: saveResp.ID, ContextText: text + " Updated."})
+	if replaceResp.Status != "success" {
+		t.Fatalf("replace_context failed on iteration %d: %s", i, replaceResp.Error)
+	}
+
+	if i%2 == 0 {
+		deleteResp, _ := srv.handleDeleteContext(nil, tools.DeleteContextRequest{ID: saveResp.ID})
+		if deleteResp.Status != "success" {
+			t.Fatalf("delete_context failed on iteration %d: %s", i, deleteResp.Error)
+		}
+		return
+	}
+
+	clearResp, _ := srv.handleClearAllContext(nil, tools.ClearAllContextRequest{Confirmation: "confirm"})
+	if clearResp.Status != "success" {
+		t.Fatalf("clear_all_context failed on iteration %d: %s", i, clearResp.Error)
+	}
+}
+
+func TestCheckSoakLeaks(t *testing.T) {
+	baseline := soakSample{goroutines: 10, heapBytes: 1 << 20, dbHandles: 1}
+
+	tests := []struct {
+		name      string
+		final     soakSample
+		wantLeaks int
+	}{
+		{"steady", soakSample{goroutines: 12, heapBytes: 2 << 20, dbHandles: 1}, 0},
+		{"goroutine leak", soakSample{goroutines: 40, heapBytes: 1 << 20, dbHandles: 1}, 1},
+		{"heap leak", soakSample{goroutines: 10, heapBytes: 64 << 20, dbHandles: 1}, 1},
+		{"handle leak", soakSample{goroutines: 10, heapBytes: 1 << 20, dbHandles: 3}, 1},
+		{"everything leaks", soakSample{goroutines: 40, heapBytes: 64 << 20, dbHandles: 3}, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			leaks := checkSoakLeaks(baseline, test.final, 2.0)
+			if len(leaks) != test.wantLeaks {
+				t.Errorf("Expected %d leaks, got %d: %v", test.wantLeaks, len(leaks), leaks)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+//go:build cgo && !purego
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/archive"
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/summarizer"
+	"github.com/localrivet/projectmemory/internal/tools"
+)
+
+// These tests need the SQLite store: a store that can be closed, archived
+// or shared between goroutines like the server's.
+
+// reportSignal is a HealthSink that signals a report was sent, dropping
+// the signal if the last one has not been received yet
+type reportSignal chan struct{}
+
+func (c reportSignal) Send(report []byte) error {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func TestUsageReportDuringToolCalls(t *testing.T) {
+	store := contextstore.NewSQLiteContextStore()
+	if err := store.Initialize(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+	defer store.Close()
+	srv := NewContextToolServer(store, &MockSummarizer{}, &MockEmbedder{})
+	if err := srv.SetIngestionSuggestions(true); err != nil {
+		t.Fatalf("SetIngestionSuggestions failed: %v", err)
+	}
+
+	// The report reads entries, tags and gaps from the ticker goroutine
+	// while tool calls write them. Run it with -race.
+	reports := make(reportSignal, 1)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		srv.reportUsage(time.Millisecond, reports, stop)
+		close(done)
+	}()
+
+	for i := 0; i < 20; i++ {
+		saved, _ := srv.handleSaveContext(nil, tools.SaveContextRequest{ContextText: fmt.Sprintf("Saved note %d", i)})
+		if saved.Status != "success" {
+			t.Fatalf("save_context failed during a report: %s", saved.Error)
+		}
+		retrieved, _ := srv.handleRetrieveContext(nil, tools.RetrieveContextRequest{Query: fmt.Sprintf("missing topic %d", i)})
+		if retrieved.Status != "success" {
+			t.Fatalf("retrieve_context failed during a report: %s", retrieved.Error)
+		}
+	}
+	<-reports
+	close(stop)
+	<-done
+}
+
+func TestMemoryHealth(t *testing.T) {
+	store := contextstore.NewSQLiteContextStore()
+	if err := store.Initialize(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+	defer store.Close()
+
+	server := NewContextToolServer(store, &MockSummarizer{}, &MockEmbedder{})
+	response, err := server.handleMemoryHealth(nil, tools.MemoryHealthRequest{})
+	if err != nil || response.Status != "success" || response.Health != "healthy" || len(response.Components) != 3 {
+		t.Fatalf("Expected every component healthy, got %+v, %v", response, err)
+	}
+	if response.Summarizer != nil || len(response.Problems) != 0 {
+		t.Errorf("Expected no summarizer report or problems, got %+v", response)
+	}
+
+	// The summarizer's report is passed on, and its status counts
+	server = NewContextToolServer(store, &reportingSummarizer{}, &MockEmbedder{})
+	response, _ = server.handleMemoryHealth(nil, tools.MemoryHealthRequest{})
+	var report summarizer.HealthReport
+	if err := json.Unmarshal(response.Summarizer, &report); err != nil || report.Providers["openai"] {
+		t.Errorf("Expected the summarizer's report, got %s, %v", response.Summarizer, err)
+	}
+	if response.Health != "degraded" || response.Components[tools.ComponentSummarizer] != "degraded" {
+		t.Errorf("Expected a degraded summarizer, got %+v", response)
+	}
+
+	// A failing embedder and a closed store are unhealthy
+	server = NewContextToolServer(store, &MockSummarizer{}, &MockEmbedder{ReturnError: true})
+	store.Close()
+	response, _ = server.handleMemoryHealth(nil, tools.MemoryHealthRequest{})
+	if response.Health != "unhealthy" || response.Components[tools.ComponentEmbedder] != "unhealthy" || response.Components[tools.ComponentStore] != "unhealthy" {
+		t.Errorf("Expected an unhealthy embedder and store, got %+v", response)
+	}
+	if response.Problems[tools.ComponentEmbedder] == "" || response.Problems[tools.ComponentStore] == "" {
+		t.Errorf("Expected the problems to be described, got %+v", response.Problems)
+	}
+
+	response, _ = server.handleMemoryHealth(nil, tools.MemoryHealthRequest{Version: "99"})
+	if response.Status != "error" {
+		t.Errorf("Expected an unknown version to be rejected, got %+v", response)
+	}
+}
+
+func TestArchiveAndRestoreNamespace(t *testing.T) {
+	store := contextstore.NewSQLiteContextStore()
+	if err := store.Initialize(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+	defer store.Close()
+	server := NewContextToolServer(store, &MockSummarizer{}, &MockEmbedder{})
+
+	saved, _ := server.handleSaveContext(nil, tools.SaveContextRequest{ContextText: "Finished project notes"})
+	if saved.Status != "success" {
+		t.Fatalf("Failed to save context: %s", saved.Error)
+	}
+	namespace := contextstore.DefaultNamespace
+
+	// Archiving needs a target
+	archived, _ := server.handleArchiveNamespace(nil, tools.ArchiveNamespaceRequest{Namespace: namespace})
+	if archived.Status != "error" || !strings.Contains(archived.Error, ErrArchiveNotConfigured.Error()) {
+		t.Errorf("Expected an unconfigured archive to be rejected, got %+v", archived)
+	}
+
+	server.SetArchiveTarget(archive.Directory{Path: t.TempDir()})
+	archived, _ = server.handleArchiveNamespace(nil, tools.ArchiveNamespaceRequest{Namespace: " "})
+	if archived.Status != "error" || !strings.Contains(archived.Error, ErrMissingNamespace.Error()) {
+		t.Errorf("Expected a missing namespace to be rejected, got %+v", archived)
+	}
+
+	archived, _ = server.handleArchiveNamespace(nil, tools.ArchiveNamespaceRequest{Namespace: namespace})
+	if archived.Status != "success" || archived.ArchivedCount != 1 || archived.SnapshotHash == "" {
+		t.Fatalf("Expected one entry archived, got %+v", archived)
+	}
+	if results, _ := server.handleRetrieveContext(nil, tools.RetrieveContextRequest{Query: "project notes"}); len(results.Results) != 0 {
+		t.Errorf("Expected archived entries not to be retrieved, got %v", results.Results)
+	}
+
+	restored, _ := server.handleRestoreNamespace(nil, tools.RestoreNamespaceRequest{Namespace: namespace})
+	if restored.Status != "success" || restored.RestoredCount != 1 {
+		t.Fatalf("Expected one entry restored, got %+v", restored)
+	}
+	hashed, _ := server.handleSnapshotHash(nil, tools.SnapshotHashRequest{Namespace: namespace})
+	if hashed.Hashes[namespace] != archived.SnapshotHash {
+		t.Errorf("Expected snapshot hash %s after restoring, got %v", archived.SnapshotHash, hashed.Hashes)
+	}
+
+	restored, _ = server.handleRestoreNamespace(nil, tools.RestoreNamespaceRequest{Namespace: namespace})
+	if restored.Status != "error" {
+		t.Errorf("Expected restoring over entries to fail, got %+v", restored)
+	}
+}
+
+func TestStop(t *testing.T) {
+	store := contextstore.NewSQLiteContextStore()
+	if err := store.Initialize(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+	server := NewContextToolServer(store, &MockSummarizer{}, &MockEmbedder{})
+	save := whileRunning(server, server.handleSaveContext)
+
+	// A call in flight holds the store open until it ends
+	call := server.requests.begin(tools.ToolSaveContext)
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- server.Stop()
+	}()
+
+	select {
+	case err := <-stopped:
+		t.Fatalf("Expected Stop to wait for the call in flight, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if _, err := save(nil, tools.SaveContextRequest{ContextText: "Saved while stopping"}); !errors.Is(err, ErrServerStopping) {
+		t.Errorf("Expected %v for a call made while stopping, got %v", ErrServerStopping, err)
+	}
+	if err := store.Ping(); err != nil {
+		t.Errorf("Expected the store open while a call is in flight, got %v", err)
+	}
+
+	call.end()
+	if err := <-stopped; err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if err := store.Ping(); err == nil {
+		t.Errorf("Expected the store closed after Stop")
+	}
+	if err := server.Stop(); err != nil {
+		t.Errorf("Expected a second Stop to succeed, got %v", err)
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	store := contextstore.NewSQLiteContextStore()
+	if err := store.Initialize(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+	server := NewContextToolServer(store, &MockSummarizer{}, &MockEmbedder{})
+	server.SetShutdownTimeout(10 * time.Millisecond)
+
+	// A wedged call does not keep the server from stopping
+	call := server.requests.begin(tools.ToolSaveContext)
+	defer call.end()
+	if err := server.Stop(); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if err := store.Ping(); err == nil {
+		t.Errorf("Expected the store closed after the shutdown timeout")
+	}
+}
+
+// TestQuickCaptureDuringToolCalls saves captures on the capture goroutine
+// while tool calls use the same SQLite store. Run it with -race.
+func TestQuickCaptureDuringToolCalls(t *testing.T) {
+	store := contextstore.NewSQLiteContextStore()
+	if err := store.Initialize(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+	defer store.Close()
+	srv := NewContextToolServer(store, &MockSummarizer{}, &MockEmbedder{})
+
+	const captures = 20
+	queue := make(chan tools.SaveContextRequest, captures)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		srv.saveCaptures(queue, stop)
+		close(done)
+	}()
+
+	for i := 0; i < captures; i++ {
+		queue <- tools.SaveContextRequest{ContextText: fmt.Sprintf("Captured note %d", i), Source: QuickCaptureSource}
+		saved, _ := srv.handleSaveContext(nil, tools.SaveContextRequest{ContextText: fmt.Sprintf("Saved note %d", i)})
+		if saved.Status != "success" {
+			t.Fatalf("save_context failed during a capture: %s", saved.Error)
+		}
+		retrieved, _ := srv.handleRetrieveContext(nil, tools.RetrieveContextRequest{Query: "note"})
+		if retrieved.Status != "success" {
+			t.Fatalf("retrieve_context failed during a capture: %s", retrieved.Error)
+		}
+	}
+
+	// Wait for the queue to drain before stopping, so no capture is dropped
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		entries, err := store.ListEntries()
+		if err != nil {
+			t.Fatalf("ListEntries failed: %v", err)
+		}
+		if len(entries) == 2*captures {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d entries, got %d", 2*captures, len(entries))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(stop)
+	<-done
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/summarizer"
+	"github.com/localrivet/projectmemory/internal/telemetry"
+)
+
+// checkSummaryLength returns an error if a summary of maxLength characters
+// cannot be requested. 0 requests the summarizer's configured length, and a
+// negative length is rejected by request validation.
+func (s *MCPContextToolServer) checkSummaryLength(maxLength int) error {
+	if _, ok := s.summarizer.(summarizer.LengthSummarizer); maxLength > 0 && !ok {
+		return summarizer.ErrLengthUnsupported
+	}
+	return nil
+}
+
+// summarize summarizes and titles text in at most maxLength characters, or
+// in the summarizer's configured length if maxLength is 0. The generation
+// is zero if the summarizer does not report one.
+func (s *MCPContextToolServer) summarize(ctx context.Context, text string, maxLength int) (summarizer.Summary, error) {
+	return summarizer.SummarizeWithTitle(ctx, s.summarizer, text, maxLength)
+}
+
+// SetMinInputLength sets the length, in characters, below which saved and
+// replaced text is stored as it is instead of being summarized, so quick
+// notes cost no summarizer call. 0, the default, summarizes all text.
+func (s *MCPContextToolServer) SetMinInputLength(length int) {
+	s.minInputLength = length
+}
+
+// summarizeOrVerbatim summarizes text like summarize. If the summarizer's
+// providers refused the text, it returns the text itself, so the refusal is
+// never stored as the memory, with a summarizer.GeneratedVerbatim
+// generation. Text shorter than the minimum input length, and no longer
+// than maxLength if one is asked for, is returned without calling the
+// summarizer, with a summarizer.GeneratedShort generation.
+func (s *MCPContextToolServer) summarizeOrVerbatim(ctx context.Context, text string, maxLength int) (summarizer.Summary, error) {
+	length := utf8.RuneCountInString(strings.TrimSpace(text))
+	if length < s.minInputLength && (maxLength <= 0 || length <= maxLength) {
+		s.metrics.IncrementCounter(telemetry.MetricSummariesSkipped, 1)
+		return summarizer.Summary{
+			Title:      summarizer.Title(text),
+			Text:       text,
+			Generation: summarizer.Generation{Summarizer: summarizer.GeneratedShort},
+		}, nil
+	}
+
+	summary, err := s.summarize(ctx, text, maxLength)
+	if errors.Is(err, summarizer.ErrContentFiltered) {
+		s.metrics.IncrementCounter(telemetry.MetricSummariesUnavailable, 1)
+		s.logger.Warn("Summarizer refused the text; storing it verbatim", "text_length", len(text), "error", err)
+		return summarizer.Summary{
+			Title:      summarizer.Title(text),
+			Text:       text,
+			Generation: summarizer.Generation{Summarizer: summarizer.GeneratedVerbatim},
+		}, nil
+	}
+	return summary, err
+}
+
+// recordGeneration records what wrote the summary of an entry if the store
+// can. The summary is already stored, so a failure is only logged.
+func (s *MCPContextToolServer) recordGeneration(id string, generation summarizer.Generation) {
+	generations, ok := s.store.(contextstore.GenerationStore)
+	if !ok || generation == (summarizer.Generation{}) {
+		return
+	}
+	err := generations.SetGeneration(id, contextstore.Generation{
+		Summarizer:    generation.Summarizer,
+		Provider:      generation.Provider,
+		Model:         generation.Model,
+		PromptVersion: generation.PromptVersion,
+	})
+	if err != nil {
+		s.logger.Warn("Failed to record the generation of a summary", "id", id, "error", err)
+	}
+}
+
+// recordTitle records the title of an entry's summary if the store can. The
+// summary is already stored, so a failure is only logged.
+func (s *MCPContextToolServer) recordTitle(id string, title string) {
+	titles, ok := s.store.(contextstore.TitleStore)
+	if !ok || title == "" {
+		return
+	}
+	if err := titles.SetTitle(id, title); err != nil {
+		s.logger.Warn("Failed to record the title of a summary", "id", id, "error", err)
+	}
+}
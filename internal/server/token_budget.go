@@ -0,0 +1,39 @@
+package server
+
+import (
+	"github.com/localrivet/projectmemory/internal/tokenizer"
+)
+
+// SetTokenizer sets how retrieve_context counts the tokens of results
+// against a request's max_tokens. nil, the default, estimates them as
+// tokenizer.Approximate does. It must be called before Start.
+func (s *MCPContextToolServer) SetTokenizer(t tokenizer.Tokenizer) {
+	s.tokenizer = t
+}
+
+// packTokens returns the results whose summaries fit in maxTokens tokens
+// together, taking each result in order while it fits and skipping those
+// that do not, so smaller results further down still fill the budget.
+// Results are ranked, so the best are kept; the order is unchanged.
+func (s *MCPContextToolServer) packTokens(results []QueryResult, maxTokens int) []QueryResult {
+	var counter tokenizer.Tokenizer = tokenizer.Approximate{}
+	if s.tokenizer != nil {
+		counter = s.tokenizer
+	}
+
+	packed := results[:0]
+	used := 0
+	for _, result := range results {
+		tokens := counter.Count(result.Summary)
+		if used+tokens > maxTokens {
+			continue
+		}
+		used += tokens
+		packed = append(packed, result)
+	}
+	if len(packed) < len(results) {
+		s.logger.Debug("Dropped results over the token budget", "max_tokens", maxTokens, "tokens", used,
+			"kept", len(packed), "dropped", len(results)-len(packed))
+	}
+	return packed
+}
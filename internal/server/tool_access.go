@@ -0,0 +1,62 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/localrivet/projectmemory/internal/tools"
+)
+
+var (
+	// ErrUnknownTool is returned when a tool that does not exist is
+	// disabled.
+	ErrUnknownTool = errors.New("unknown tool")
+
+	// ErrToolDisabled is returned when a disabled tool, or the part of
+	// another tool that does the same, is called.
+	ErrToolDisabled = errors.New("tool is disabled on this server")
+)
+
+// SetDisabledTools sets the tools the server does not offer, such as
+// clear_all_context, delete_context and replace_context on a shared server
+// where agents should only read and append. It must be called before
+// Initialize.
+func (s *MCPContextToolServer) SetDisabledTools(names []string) error {
+	disabled := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if !tools.IsTool(name) {
+			return fmt.Errorf("%w: %q", ErrUnknownTool, name)
+		}
+		disabled = append(disabled, name)
+	}
+	s.disabledTools = disabled
+	return nil
+}
+
+// SetReadOnly makes the server read-only: it does not offer the tools that
+// change stored context, cleanup_report only reports, and review_queue
+// only records confirmations. Retrievals are still counted. It must be
+// called before Initialize.
+func (s *MCPContextToolServer) SetReadOnly(readOnly bool) {
+	s.readOnly = readOnly
+}
+
+// toolEnabled reports whether the server offers the tool
+func (s *MCPContextToolServer) toolEnabled(name string) bool {
+	if s.readOnly && tools.IsWriteTool(name) {
+		return false
+	}
+	return !slices.Contains(s.disabledTools, name)
+}
+
+// checkToolEnabled returns an error wrapping ErrToolDisabled unless the
+// server offers the tool
+func (s *MCPContextToolServer) checkToolEnabled(name string) error {
+	if !s.toolEnabled(name) {
+		return fmt.Errorf("%w: %s", ErrToolDisabled, name)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/analytics"
+	"github.com/localrivet/projectmemory/internal/contextstore"
+)
+
+// DefaultUsageReportInterval is how often the usage report is sent when no
+// interval is configured.
+const DefaultUsageReportInterval = 24 * time.Hour
+
+// SetUsageReporting sends the usage report to sink every interval while the
+// server runs, as analytics.FormatMarkdown or analytics.FormatJSON, with at
+// most top items per list. An interval of 0 uses DefaultUsageReportInterval,
+// an empty format Markdown and a top of 0 analytics.DefaultTop. The store
+// must track usage. It must be called before Start.
+func (s *MCPContextToolServer) SetUsageReporting(interval time.Duration, format string, top int, sink HealthSink) error {
+	if _, ok := s.store.(contextstore.UsageStore); !ok {
+		return contextstore.ErrUsageUnsupported
+	}
+	if format == "" {
+		format = analytics.FormatMarkdown
+	}
+	if err := analytics.ValidateFormat(format); err != nil {
+		return err
+	}
+	if interval <= 0 {
+		interval = DefaultUsageReportInterval
+	}
+
+	s.usageReportInterval = interval
+	s.usageReportFormat = format
+	s.usageReportTop = top
+	s.usageSink = sink
+	return nil
+}
+
+// SetIngestionSuggestions makes the usage report suggest topics to ingest
+// documentation about, from the retrieval gaps the store has logged. The
+// store must keep gaps. It must be called before Start.
+func (s *MCPContextToolServer) SetIngestionSuggestions(enabled bool) error {
+	if _, ok := s.store.(contextstore.GapStore); enabled && !ok {
+		return contextstore.ErrGapsUnsupported
+	}
+	s.suggestIngestion = enabled
+	return nil
+}
+
+// UsageReport reports the most retrieved entries, the tags never retrieved
+// and the retrievals since the server started, with ingestion suggestions
+// if they are enabled. It may run alongside tool calls, relying on the
+// store to serialize its own access. It returns
+// contextstore.ErrUsageUnsupported if the store does not track usage.
+func (s *MCPContextToolServer) UsageReport() (analytics.Report, error) {
+	usage, ok := s.store.(contextstore.UsageStore)
+	if !ok {
+		return analytics.Report{}, contextstore.ErrUsageUnsupported
+	}
+	entries, err := usage.ListEntries()
+	if err != nil {
+		return analytics.Report{}, fmt.Errorf("failed to list context entries: %w", err)
+	}
+
+	// Entries whose tags cannot be read still count, untagged
+	tags := make(map[string][]string)
+	if tagged, ok := s.store.(contextstore.TaggedStore); ok {
+		for _, entry := range entries {
+			entryTags, err := tagged.GetTags(entry.ID)
+			if err != nil {
+				s.logger.Warn("Failed to read tags for usage report", "id", entry.ID, "error", err)
+				continue
+			}
+			tags[entry.ID] = entryTags
+		}
+	}
+
+	report := analytics.Build(entries, tags, s.queries.Stats(), s.usageReportTop, time.Now())
+
+	if gapStore, ok := s.store.(contextstore.GapStore); ok && s.suggestIngestion {
+		gaps, err := gapStore.ListGaps("")
+		if err != nil {
+			return analytics.Report{}, fmt.Errorf("failed to list retrieval gaps: %w", err)
+		}
+		report.Suggestions = analytics.SuggestIngestion(gaps, s.usageReportTop)
+	}
+	return report, nil
+}
+
+// reportUsage sends the usage report to sink every interval until stop is
+// closed.
+func (s *MCPContextToolServer) reportUsage(interval time.Duration, sink HealthSink, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := s.sendUsageReport(sink); err != nil {
+				s.logger.Warn("Failed to send usage report", "error", err)
+			}
+		}
+	}
+}
+
+// sendUsageReport builds the usage report and sends it to sink
+func (s *MCPContextToolServer) sendUsageReport(sink HealthSink) error {
+	report, err := s.UsageReport()
+	if err != nil {
+		return err
+	}
+	data, err := report.Render(s.usageReportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to render usage report: %w", err)
+	}
+	return sink.Send(data)
+}
@@ -0,0 +1,443 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/errortypes"
+	"github.com/localrivet/projectmemory/internal/retrieval"
+	"github.com/localrivet/projectmemory/internal/tools"
+)
+
+var (
+	// ErrMissingText is returned when save_context or replace_context is
+	// given no text.
+	ErrMissingText = errors.New("context_text is required")
+
+	// ErrTextTooLong is returned for text longer than the request limits
+	// allow.
+	ErrTextTooLong = errors.New("context_text is too long")
+
+	// ErrMissingQuery is returned when retrieve_context is given no query.
+	ErrMissingQuery = errors.New("query is required")
+
+	// ErrQueryTooLong is returned for a query longer than the request
+	// limits allow.
+	ErrQueryTooLong = errors.New("query is too long")
+
+	// ErrTooManyQueries is returned for a retrieve_context request
+	// searching more than tools.MaxRetrieveQueries queries.
+	ErrTooManyQueries = fmt.Errorf("at most %d queries can be searched at once", tools.MaxRetrieveQueries)
+
+	// ErrInvalidLimit is returned for a negative limit or one above the
+	// request limits.
+	ErrInvalidLimit = errors.New("limit is out of range")
+
+	// ErrInvalidMaxTokens is returned for a negative token budget.
+	ErrInvalidMaxTokens = errors.New("max_tokens must not be negative")
+
+	// ErrInvalidID is returned for an entry ID that no store assigns.
+	ErrInvalidID = errors.New("id is malformed")
+)
+
+// idPattern matches the entry IDs stores assign: the hex IDs of
+// save_context, and the names imports and tests give entries
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:-]{0,127}$`)
+
+// RequestLimits bounds the fields of tool requests.
+type RequestLimits struct {
+	// MaxTextLength is the most characters of text save_context,
+	// replace_context and review_queue accept
+	MaxTextLength int
+
+	// MaxQueryLength is the most characters of a retrieve_context query
+	MaxQueryLength int
+
+	// MaxLimit is the highest limit a tool call may ask for
+	MaxLimit int
+}
+
+// DefaultRequestLimits are the request limits of a new server.
+var DefaultRequestLimits = RequestLimits{
+	MaxTextLength:  200_000,
+	MaxQueryLength: 2_000,
+	MaxLimit:       100,
+}
+
+// SetRequestLimits sets the bounds tool requests are validated against. A
+// field of 0 keeps its default. It must be called before Start.
+func (s *MCPContextToolServer) SetRequestLimits(limits RequestLimits) {
+	if limits.MaxTextLength > 0 {
+		s.limits.MaxTextLength = limits.MaxTextLength
+	}
+	if limits.MaxQueryLength > 0 {
+		s.limits.MaxQueryLength = limits.MaxQueryLength
+	}
+	if limits.MaxLimit > 0 {
+		s.limits.MaxLimit = limits.MaxLimit
+	}
+}
+
+// invalidRequest is the error of a tool request with invalid fields. It
+// wraps the error of each field, so errors.Is finds any of them.
+type invalidRequest struct {
+	fields []tools.FieldError
+	errs   []error
+}
+
+// Error joins the messages of the invalid fields
+func (e *invalidRequest) Error() string {
+	messages := make([]string, len(e.fields))
+	for i, field := range e.fields {
+		messages[i] = field.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap returns the error of each invalid field
+func (e *invalidRequest) Unwrap() []error {
+	return e.errs
+}
+
+// requestValidator collects the invalid fields of a tool request, so the
+// response names all of them rather than the first.
+type requestValidator struct {
+	limits  RequestLimits
+	invalid invalidRequest
+}
+
+// check records err, if any, as the error of field
+func (v *requestValidator) check(field string, err error) {
+	if err == nil {
+		return
+	}
+	v.invalid.fields = append(v.invalid.fields, tools.FieldError{Field: field, Message: err.Error()})
+	v.invalid.errs = append(v.invalid.errs, err)
+}
+
+// text checks text against the text length limit, and that it is not
+// blank if required
+func (v *requestValidator) text(field, text string, required bool) {
+	switch {
+	case required && strings.TrimSpace(text) == "":
+		v.check(field, ErrMissingText)
+	case utf8.RuneCountInString(text) > v.limits.MaxTextLength:
+		v.check(field, fmt.Errorf("%w: at most %d characters", ErrTextTooLong, v.limits.MaxTextLength))
+	}
+}
+
+// limit checks a limit against the request limits. 0 asks for the tool's
+// default.
+func (v *requestValidator) limit(limit int) {
+	if limit < 0 || limit > v.limits.MaxLimit {
+		v.check("limit", fmt.Errorf("%w: must be between 0 and %d", ErrInvalidLimit, v.limits.MaxLimit))
+	}
+}
+
+// score checks a minimum score, which 0 leaves unset
+func (v *requestValidator) score(minScore float64) {
+	if minScore < 0 || minScore > 1 {
+		v.check("min_score", ErrInvalidMinScore)
+	}
+}
+
+// id checks the ID of an entry, and that there is one if required
+func (v *requestValidator) id(field, id string, required bool) {
+	id = strings.TrimSpace(id)
+	switch {
+	case id == "" && required:
+		v.check(field, ErrMissingID)
+	case id != "" && !idPattern.MatchString(id):
+		v.check(field, fmt.Errorf("%w: %q", ErrInvalidID, id))
+	}
+}
+
+// ids checks a list of entry IDs, reporting the first malformed one
+func (v *requestValidator) ids(field string, ids []string) {
+	for _, id := range ids {
+		if !idPattern.MatchString(strings.TrimSpace(id)) {
+			v.check(field, fmt.Errorf("%w: %q", ErrInvalidID, id))
+			return
+		}
+	}
+}
+
+// err returns the invalid fields as an error, or nil if there are none
+func (v *requestValidator) err() *invalidRequest {
+	if len(v.invalid.fields) == 0 {
+		return nil
+	}
+	return &v.invalid
+}
+
+// validator returns a validator for a request to s
+func (s *MCPContextToolServer) validator() *requestValidator {
+	return &requestValidator{limits: s.limits}
+}
+
+// rejectRequest logs the validation error of a tool request with invalid
+// fields and returns it for the response.
+func (s *MCPContextToolServer) rejectRequest(tool string, invalid *invalidRequest) error {
+	err := errortypes.ValidationError(invalid, "invalid "+tool+" request")
+	for _, field := range invalid.fields {
+		err = err.WithField(field.Field, field.Message)
+	}
+	errortypes.LogError(s.logger, err)
+	return err
+}
+
+// validateSaveContext validates the fields of a save_context request
+func (s *MCPContextToolServer) validateSaveContext(req tools.SaveContextRequest) *invalidRequest {
+	v := s.validator()
+	v.text("context_text", req.ContextText, true)
+	if req.MaxSummaryLength < 0 {
+		v.check("max_summary_length", ErrInvalidSummaryLength)
+	}
+	return v.err()
+}
+
+// query checks the fields of a query
+func (v *requestValidator) query(q Query) {
+	switch {
+	case strings.TrimSpace(q.Text) == "" && len(q.Queries) == 0:
+		v.check("query", ErrMissingQuery)
+	case utf8.RuneCountInString(q.Text) > v.limits.MaxQueryLength:
+		v.check("query", fmt.Errorf("%w: at most %d characters", ErrQueryTooLong, v.limits.MaxQueryLength))
+	}
+	for _, text := range q.Queries {
+		if strings.TrimSpace(text) == "" {
+			v.check("queries", ErrMissingQuery)
+			break
+		}
+		if utf8.RuneCountInString(text) > v.limits.MaxQueryLength {
+			v.check("queries", fmt.Errorf("%w: at most %d characters", ErrQueryTooLong, v.limits.MaxQueryLength))
+			break
+		}
+	}
+	if len(q.texts()) > tools.MaxRetrieveQueries {
+		v.check("queries", ErrTooManyQueries)
+	}
+	v.limit(q.Limit)
+	if q.MaxTokens < 0 {
+		v.check("max_tokens", fmt.Errorf("%w: %d", ErrInvalidMaxTokens, q.MaxTokens))
+	}
+	v.score(q.MinScore)
+	v.ids("exclude_ids", q.ExcludeIDs)
+	v.ids("known_ids", q.KnownIDs)
+	switch q.Dedup {
+	case "", tools.DedupExclude, tools.DedupDownrank:
+	default:
+		v.check("dedup", fmt.Errorf("%w: %q", ErrUnknownDedupMode, q.Dedup))
+	}
+	if q.RecencyHalfLife < 0 {
+		v.check("recency_half_life", fmt.Errorf("%w: %v", retrieval.ErrInvalidRecencyHalfLife, q.RecencyHalfLife))
+	}
+	if q.RecencyFloor < 0 || q.RecencyFloor > 1 {
+		v.check("recency_floor", fmt.Errorf("%w: %v", retrieval.ErrInvalidRecencyFloor, q.RecencyFloor))
+	}
+	if q.HybridWeights.Vector < 0 || q.HybridWeights.Keyword < 0 {
+		v.check("hybrid_weights", fmt.Errorf("%w: vector %v, keyword %v", retrieval.ErrInvalidHybridWeights, q.HybridWeights.Vector, q.HybridWeights.Keyword))
+	}
+	switch q.Mode {
+	case "", tools.SearchModeVector:
+	case tools.SearchModeKeyword:
+		// These options compare embeddings, which keyword searches have none of
+		options := []struct {
+			field string
+			set   bool
+		}{
+			{"min_score", q.MinScore > 0},
+			{"expand", q.Expand},
+			{"hyde", q.HyDE},
+			{"hybrid_weights", q.HybridWeights != (retrieval.HybridWeights{})},
+		}
+		for _, option := range options {
+			if option.set {
+				v.check(option.field, fmt.Errorf("%w: %s", ErrKeywordModeOption, option.field))
+			}
+		}
+	default:
+		v.check("mode", fmt.Errorf("%w: %q", ErrUnknownSearchMode, q.Mode))
+	}
+	if !q.Since.IsZero() && !q.Until.IsZero() && !q.Until.After(q.Since) {
+		v.check("until", fmt.Errorf("%w: until %s is not after since %s", ErrInvalidTimeRange,
+			q.Until.Format(time.RFC3339), q.Since.Format(time.RFC3339)))
+	}
+}
+
+// retrieveQuery validates the fields of a retrieve_context request and
+// maps it onto the query it runs
+func (s *MCPContextToolServer) retrieveQuery(req tools.RetrieveContextRequest) (Query, *invalidRequest) {
+	v := s.validator()
+	q := Query{
+		Text:        req.Query,
+		Queries:     req.Queries,
+		Namespace:   req.Namespace,
+		Limit:       req.Limit,
+		MaxTokens:   req.MaxTokens,
+		Adaptive:    req.Adaptive,
+		MinScore:    req.MinScore,
+		Tags:        req.Tags,
+		ExcludeTags: req.ExcludeTags,
+		Session:     req.SessionID,
+		ExcludeIDs:  req.ExcludeIDs,
+		KnownIDs:    req.KnownIDs,
+		KnownHashes: req.KnownHashes,
+		Dedup:       req.Dedup,
+
+		RecencyFloor: req.RecencyFloor,
+		Rerank:       req.Rerank,
+		Expand:       req.Expand,
+		HyDE:         req.HyDE,
+		Mode:         req.Mode,
+	}
+	var err error
+	if q.Since, err = parseBound("since", req.Since); err != nil {
+		v.check("since", err)
+	}
+	if q.RecencyHalfLife, err = parseHalfLife(req.RecencyHalfLife); err != nil {
+		v.check("recency_half_life", err)
+	}
+	if q.Until, err = parseBound("until", req.Until); err != nil {
+		v.check("until", err)
+	}
+	v.query(q)
+	v.check("format", validateFormat(req.Format))
+	return q, v.err()
+}
+
+// validateDeleteContext validates the fields of a delete_context request
+func (s *MCPContextToolServer) validateDeleteContext(req tools.DeleteContextRequest) *invalidRequest {
+	v := s.validator()
+	v.id("id", req.ID, true)
+	return v.err()
+}
+
+// validateReplaceContext validates the fields of a replace_context request
+func (s *MCPContextToolServer) validateReplaceContext(req tools.ReplaceContextRequest) *invalidRequest {
+	v := s.validator()
+	v.id("id", req.ID, true)
+	v.text("context_text", req.ContextText, true)
+	if req.MaxSummaryLength < 0 {
+		v.check("max_summary_length", ErrInvalidSummaryLength)
+	}
+	return v.err()
+}
+
+// validateRollbackBatch validates the fields of a rollback_batch request
+func (s *MCPContextToolServer) validateRollbackBatch(req tools.RollbackBatchRequest) *invalidRequest {
+	v := s.validator()
+	if strings.TrimSpace(req.BatchID) == "" {
+		v.check("batch_id", ErrMissingBatchID)
+	}
+	return v.err()
+}
+
+// validateExpireSession validates the fields of an expire_session request
+func (s *MCPContextToolServer) validateExpireSession(req tools.ExpireSessionRequest) *invalidRequest {
+	v := s.validator()
+	if strings.TrimSpace(req.SessionID) == "" {
+		v.check("session_id", ErrMissingSessionID)
+	}
+	return v.err()
+}
+
+// validateLinkContext validates the fields of a link_context request
+func (s *MCPContextToolServer) validateLinkContext(req tools.LinkContextRequest) *invalidRequest {
+	v := s.validator()
+	v.id("id", req.ID, true)
+	v.id("related_id", req.RelatedID, true)
+	if id := strings.TrimSpace(req.ID); id != "" && id == strings.TrimSpace(req.RelatedID) {
+		v.check("related_id", ErrSelfRelation)
+	}
+	if !knownRelation(relationType(req.RelationType)) {
+		v.check("relation_type", ErrUnknownRelation)
+	}
+	return v.err()
+}
+
+// validateGetLinkedContext validates the fields of a get_linked_context
+// request. An empty relation type follows every type.
+func (s *MCPContextToolServer) validateGetLinkedContext(req tools.GetLinkedContextRequest) *invalidRequest {
+	v := s.validator()
+	v.id("id", req.ID, true)
+	if name := relationType(req.RelationType); name != "" && !knownRelation(name) {
+		v.check("relation_type", ErrUnknownRelation)
+	}
+	if req.Depth < 0 || req.Depth > tools.MaxLinkDepth {
+		v.check("depth", ErrInvalidDepth)
+	}
+	v.limit(req.Limit)
+	return v.err()
+}
+
+// validateConsolidate validates the fields of a consolidate request. A
+// threshold of 0 uses the server's.
+func (s *MCPContextToolServer) validateConsolidate(req tools.ConsolidateRequest) *invalidRequest {
+	v := s.validator()
+	if req.Threshold < 0 || req.Threshold > 1 {
+		v.check("threshold", ErrInvalidThreshold)
+	}
+	return v.err()
+}
+
+// validateCleanupReport validates the fields of a cleanup_report request
+func (s *MCPContextToolServer) validateCleanupReport(req tools.CleanupReportRequest) *invalidRequest {
+	v := s.validator()
+	v.limit(req.Limit)
+	v.score(req.MinScore)
+	return v.err()
+}
+
+// validatePinContext validates the fields of a pin_context request
+func (s *MCPContextToolServer) validatePinContext(req tools.PinContextRequest) *invalidRequest {
+	v := s.validator()
+	v.id("id", req.ID, true)
+	return v.err()
+}
+
+// validateReviewQueue validates the fields of a review_queue request. An
+// action needs the entry it applies to, and a refresh its new text.
+func (s *MCPContextToolServer) validateReviewQueue(req tools.ReviewQueueRequest) *invalidRequest {
+	v := s.validator()
+	action := strings.ToLower(strings.TrimSpace(req.Action))
+	switch action {
+	case "", contextstore.ReviewConfirm, contextstore.ReviewRefresh, contextstore.ReviewRetire:
+	default:
+		v.check("action", ErrUnknownReviewAction)
+	}
+	v.id("id", req.ID, action != "")
+	if action == contextstore.ReviewRefresh && strings.TrimSpace(req.ContextText) == "" {
+		v.check("context_text", ErrMissingRefreshText)
+	} else {
+		v.text("context_text", req.ContextText, false)
+	}
+	v.limit(req.Limit)
+	return v.err()
+}
+
+// validateMemoryGaps validates the fields of a memory_gaps request
+func (s *MCPContextToolServer) validateMemoryGaps(req tools.MemoryGapsRequest) *invalidRequest {
+	v := s.validator()
+	if len(req.Resolve) > 0 && strings.TrimSpace(req.Namespace) == "" {
+		v.check("namespace", ErrResolveNamespace)
+	}
+	v.limit(req.Limit)
+	return v.err()
+}
+
+// validateRetrieveByFile validates the fields of a retrieve_by_file
+// request
+func (s *MCPContextToolServer) validateRetrieveByFile(req tools.RetrieveByFileRequest) *invalidRequest {
+	v := s.validator()
+	if strings.TrimSpace(req.Path) == "" {
+		v.check("path", ErrMissingPath)
+	}
+	v.limit(req.Limit)
+	return v.err()
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/ingest"
+	"github.com/localrivet/projectmemory/internal/tools"
+)
+
+// chunkTagPrefix starts the tag of an entry saved from a watched file,
+// followed by the hash of its chunk, by which a restarted server tells
+// the file's unchanged chunks from its changed ones
+const chunkTagPrefix = "chunk:"
+
+// SetWatch watches dirs while the server runs and ingests each changed file
+// again, split by chunker: its new and changed chunks are saved like
+// save_context calls, with the file and lines as their source and a
+// reference to the file, and the chunks saved from it before that it no
+// longer has are deleted. Files removed from dirs lose their chunks. Paths
+// are relative to the working directory, as with ingest.Run. The store must
+// record references, provenance and tags, by which the chunks of a file and
+// their hashes are found. It must be called before Start.
+func (s *MCPContextToolServer) SetWatch(dirs []string, chunker ingest.Chunker, options ingest.WatchOptions) error {
+	if _, ok := s.store.(contextstore.ReferenceStore); !ok {
+		return contextstore.ErrReferencesUnsupported
+	}
+	if _, ok := s.store.(contextstore.ProvenanceStore); !ok {
+		return contextstore.ErrProvenanceUnsupported
+	}
+	if _, ok := s.store.(contextstore.TaggedStore); !ok {
+		return contextstore.ErrTagsUnsupported
+	}
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("watched path %s is not a directory", dir)
+		}
+	}
+	s.watchDirs = dirs
+	s.watchChunker = chunker
+	s.watchOptions = options
+	s.watchChunks = make(map[string]map[string]string)
+	return nil
+}
+
+// watchFiles ingests changed files again until stop is closed
+func (s *MCPContextToolServer) watchFiles(stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	options := s.watchOptions
+	options.Errors = func(err error) {
+		s.logger.Warn("Failed to watch files", "error", err)
+	}
+	s.logger.Info("Watching files to ingest", "dirs", s.watchDirs)
+	if err := ingest.Watch(ctx, s.watchDirs, options, s.reingestFile); err != nil {
+		s.logger.Error("Failed to watch files", "dirs", s.watchDirs, "error", err)
+	}
+}
+
+// reingestFile brings the chunks of a changed file up to date: chunks saved
+// from it by the watch, before or since Start, that are unchanged are kept,
+// new and changed ones saved, and the other entries ingested from the file
+// deleted, all of them if it was removed
+func (s *MCPContextToolServer) reingestFile(file string) {
+	root, err := os.Getwd()
+	if err != nil {
+		s.logger.Warn("Failed to resolve the path of a changed file", "file", file, "error", err)
+		return
+	}
+	path := ingest.RelativePath(root, file)
+	chunks, err := ingest.ReadChunks(s.watchChunker, root, file)
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, ingest.ErrSkippedFile) {
+		chunks, err = nil, nil
+	}
+	if err != nil {
+		s.logger.Warn("Failed to read changed file", "path", path, "error", err)
+		return
+	}
+
+	// Chunks are matched by the hash of their source and text, so a chunk
+	// whose lines moved is saved again with its new range. The first change
+	// to a file since Start finds its chunks in the store.
+	previous, seen := s.watchChunks[path]
+	if !seen {
+		if previous, err = s.storedChunks(path); err != nil {
+			s.logger.Warn("Failed to find the chunks of a changed file", "path", path, "error", err)
+			return
+		}
+	}
+	current := make(map[string]string, len(chunks))
+	kept := make(map[string]bool)
+	var added []ingest.Chunk
+	for _, chunk := range chunks {
+		if id, ok := previous[chunkHash(chunk)]; ok {
+			current[chunkHash(chunk)] = id
+			kept[id] = true
+			continue
+		}
+		added = append(added, chunk)
+	}
+	if seen && len(added) == 0 && len(kept) == len(previous) {
+		return
+	}
+
+	deleted, err := s.deleteChunks(path, kept)
+	if err != nil {
+		s.logger.Warn("Failed to delete the chunks of a changed file", "path", path, "error", err)
+		return
+	}
+	for _, chunk := range added {
+		if id, ok := s.saveChunk(chunk); ok {
+			current[chunkHash(chunk)] = id
+		}
+	}
+	s.watchChunks[path] = current
+	s.logger.Info("Ingested changed file", "path", path, "kept", len(kept), "saved", len(current)-len(kept),
+		"failed", len(chunks)-len(current), "deleted", deleted)
+}
+
+// chunkHash identifies a chunk by the hash of its source and text
+func chunkHash(chunk ingest.Chunk) string {
+	hash := sha256.Sum256([]byte(chunk.Source() + "\x00" + chunk.Document()))
+	return hex.EncodeToString(hash[:])[:16]
+}
+
+// fileChunks returns the IDs of the entries ingested from the file at path,
+// those referencing it whose provenance starts at a range of its lines
+func (s *MCPContextToolServer) fileChunks(path string) ([]string, error) {
+	references := s.store.(contextstore.ReferenceStore)
+	provenance := s.store.(contextstore.ProvenanceStore)
+	entries, err := references.ListReferencing(path)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, entry := range entries {
+		chain, err := provenance.GetProvenance(entry.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(chain) > 0 && strings.HasPrefix(chain[0], path+"#L") {
+			ids = append(ids, entry.ID)
+		}
+	}
+	return ids, nil
+}
+
+// storedChunks returns the IDs of the entries saved from the file at path
+// by the watch, by the hash of their chunk
+func (s *MCPContextToolServer) storedChunks(path string) (map[string]string, error) {
+	ids, err := s.fileChunks(path)
+	if err != nil {
+		return nil, err
+	}
+	tagged := s.store.(contextstore.TaggedStore)
+	chunks := make(map[string]string, len(ids))
+	for _, id := range ids {
+		tags, err := tagged.GetTags(id)
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range tags {
+			if hash, ok := strings.CutPrefix(tag, chunkTagPrefix); ok {
+				chunks[hash] = id
+			}
+		}
+	}
+	return chunks, nil
+}
+
+// deleteChunks deletes the entries ingested from the file at path, except
+// the kept ones
+func (s *MCPContextToolServer) deleteChunks(path string, kept map[string]bool) (int, error) {
+	ids, err := s.fileChunks(path)
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, id := range ids {
+		if kept[id] {
+			continue
+		}
+		if err := s.store.Delete(id); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// saveChunk saves a chunk like a save_context call, tagged with its hash,
+// and adds its file to the entry's references, returning its ID and
+// whether it was saved
+func (s *MCPContextToolServer) saveChunk(chunk ingest.Chunk) (string, bool) {
+	response, err := s.handleSaveContext(nil, tools.SaveContextRequest{
+		ContextText: chunk.Document(),
+		Source:      chunk.Source(),
+		Tags:        []string{chunkTagPrefix + chunkHash(chunk)},
+	})
+	if err != nil || response.Status != "success" {
+		s.logger.Warn("Failed to save chunk of changed file", "source", chunk.Source(), "error", response.Error, "handler_error", err)
+		return "", false
+	}
+
+	references := s.store.(contextstore.ReferenceStore)
+	linked, err := references.GetReferences(response.ID)
+	if err == nil {
+		err = references.SetReferences(response.ID, append(linked, contextstore.Reference{Path: chunk.Path}))
+	}
+	if err != nil {
+		s.logger.Warn("Failed to record the file of a chunk", "id", response.ID, "path", chunk.Path, "error", err)
+	}
+	return response.ID, true
+}
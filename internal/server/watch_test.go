@@ -0,0 +1,133 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/ingest"
+	"github.com/localrivet/projectmemory/internal/summarizer"
+	"github.com/localrivet/projectmemory/internal/vector"
+)
+
+func TestReingestFile(t *testing.T) {
+	dir := t.TempDir()
+	store := contextstore.NewMemoryContextStore()
+	if err := store.Initialize(""); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+	srv := NewContextToolServer(store, summarizer.NewBasicSummarizer(200), vector.NewMockEmbedder(16))
+	chunker, err := ingest.NewChunker(ingest.ChunkerHeadings, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.SetWatch([]string{filepath.Join(dir, "missing")}, chunker, ingest.WatchOptions{}); err == nil {
+		t.Error("Expected SetWatch to fail for a missing directory")
+	}
+	if err := srv.SetWatch([]string{dir}, chunker, ingest.WatchOptions{}); err != nil {
+		t.Fatalf("SetWatch failed: %v", err)
+	}
+
+	file := filepath.Join(dir, "deploy.md")
+	path := ingest.RelativePath(".", file)
+
+	// A memory mentioning the file is not one of its chunks
+	data, _ := vector.Float32SliceToBytes([]float32{1, 0, 0, 0})
+	if err := store.Store("note", "deploy.md needs a rewrite", data, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetReferences("note", []contextstore.Reference{{Path: path}}); err != nil {
+		t.Fatal(err)
+	}
+
+	sources := func() []string {
+		t.Helper()
+		entries, err := store.ListReferencing(path)
+		if err != nil {
+			t.Fatalf("ListReferencing failed: %v", err)
+		}
+		var sources []string
+		for _, entry := range entries {
+			chain, _ := store.GetProvenance(entry.ID)
+			if len(chain) > 0 {
+				sources = append(sources, chain[0])
+			} else {
+				sources = append(sources, entry.ID)
+			}
+		}
+		slices.Sort(sources)
+		return sources
+	}
+	ids := func() []string {
+		t.Helper()
+		entries, _ := store.ListReferencing(path)
+		var ids []string
+		for _, entry := range entries {
+			ids = append(ids, entry.ID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		srv.reingestFile(file)
+	}
+
+	write("# Deploy\nRun make release.\n# Rollback\nRun make rollback.\n")
+	if got, want := sources(), []string{path + "#L1-L2", path + "#L3-L4", "note"}; !slices.Equal(got, want) {
+		t.Fatalf("Expected a chunk per section, got %v, want %v", got, want)
+	}
+	before := ids()
+
+	// Unchanged content is left alone
+	write("# Deploy\nRun make release.\n# Rollback\nRun make rollback.\n")
+	if got := ids(); !slices.Equal(got, before) {
+		t.Errorf("Expected unchanged chunks kept, got %v, want %v", got, before)
+	}
+
+	// Only the changed section is replaced
+	write("# Deploy\nRun make release.\n# Rollback\nRun make undo.\n")
+	after := ids()
+	if got, want := sources(), []string{path + "#L1-L2", path + "#L3-L4", "note"}; !slices.Equal(got, want) {
+		t.Errorf("Expected the chunks updated, got %v, want %v", got, want)
+	}
+	common := 0
+	for _, id := range after {
+		if slices.Contains(before, id) {
+			common++
+		}
+	}
+	if common != 2 {
+		t.Errorf("Expected the note and the unchanged chunk kept, got %v after %v", after, before)
+	}
+
+	// A restarted server finds the chunks in the store and keeps the
+	// unchanged ones
+	srv = NewContextToolServer(store, summarizer.NewBasicSummarizer(200), vector.NewMockEmbedder(16))
+	if err := srv.SetWatch([]string{dir}, chunker, ingest.WatchOptions{}); err != nil {
+		t.Fatalf("SetWatch failed: %v", err)
+	}
+	write("# Deploy\nRun make release.\n# Rollback\nRun make undo.\n")
+	if got := ids(); !slices.Equal(got, after) {
+		t.Errorf("Expected unchanged chunks kept after a restart, got %v, want %v", got, after)
+	}
+	write("# Deploy\nRun make ship.\n# Rollback\nRun make undo.\n")
+	if got := ids(); len(got) != 3 || len(slices.DeleteFunc(slices.Clone(got), func(id string) bool { return slices.Contains(after, id) })) != 1 {
+		t.Errorf("Expected only the changed chunk replaced after a restart, got %v after %v", got, after)
+	}
+
+	// A removed file loses its chunks
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	srv.reingestFile(file)
+	if got := sources(); !slices.Equal(got, []string{"note"}) {
+		t.Errorf("Expected only the note left, got %v", got)
+	}
+}
@@ -11,10 +11,12 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	"github.com/localrivet/projectmemory/internal/summarizer/providers"
 	"github.com/localrivet/projectmemory/internal/telemetry"
+	"github.com/localrivet/projectmemory/internal/tokenizer"
 )
 
 const (
@@ -24,6 +26,14 @@ const (
 	DefaultRetryDelay    = 2 * time.Second
 	DefaultCacheCapacity = 1000
 	DefaultCacheTTL      = 24 * time.Hour
+
+	// DefaultChunkConcurrency is how many chunks of a long text are
+	// summarized at once.
+	DefaultChunkConcurrency = 4
+
+	// DefaultMaxConcurrency is how many provider requests are in flight
+	// at once, across all callers.
+	DefaultMaxConcurrency = 8
 )
 
 // Errors
@@ -32,6 +42,17 @@ var (
 	ErrSummarizationFailed  = errors.New("summarization failed")
 	ErrConfigError          = errors.New("configuration error")
 	ErrContextCanceled      = errors.New("context canceled")
+	ErrEmptySummary         = errors.New("summarizer returned an empty summary")
+
+	// ErrContentFiltered is returned when a provider's safety filters kept
+	// it from summarizing the text and no other provider summarized it.
+	// The basic summarizer is not used instead, so the caller can keep the
+	// text as it is.
+	ErrContentFiltered = providers.ErrContentFiltered
+
+	// ErrLengthUnsupported is returned when a summary length is requested
+	// from a summarizer that only writes summaries of its configured length.
+	ErrLengthUnsupported = errors.New("summarizer does not support a requested summary length")
 )
 
 // Using providers.LLMProvider instead of a local definition
@@ -42,14 +63,23 @@ type AISummarizer struct {
 	provider            providers.LLMProvider
 	fallbackProviders   []providers.LLMProvider
 	maxSummaryLength    int
+	chunkConcurrency    int
 	timeout             time.Duration
 	maxRetries          int
 	retryDelay          time.Duration
+	hedgeDelay          time.Duration
+	healthProbeInterval time.Duration
 	cache               *summaryCache
 	httpClient          *http.Client
 	providerInitialized bool
 	providerFactory     *providers.ProviderFactory
+	config              AISummarizerConfig
 	metrics             *telemetry.MetricsCollector
+	costs               *costTracker
+	queue               *requestQueue
+	router              *router
+	calls               *callLog
+	probes              *probeResults
 	mu                  sync.RWMutex
 }
 
@@ -57,14 +87,46 @@ type AISummarizer struct {
 type summaryCache struct {
 	items    map[string]cachedSummary
 	capacity int
+	maxBytes int64
+	bytes    int64
 	ttl      time.Duration
 	mu       sync.RWMutex
 }
 
 // cachedSummary represents a cached summary with expiration
 type cachedSummary struct {
-	summary  string
-	expireAt time.Time
+	summary    string
+	generation Generation
+	size       int64
+	expireAt   time.Time
+}
+
+// evictOne removes an arbitrary entry. The caller holds mu.
+func (c *summaryCache) evictOne() {
+	for key, item := range c.items {
+		delete(c.items, key)
+		c.bytes -= item.size
+		return
+	}
+}
+
+// compact replaces the items with a new map holding at most limit unexpired
+// entries, since a map never gives back the memory of deleted entries. The
+// caller holds mu.
+func (c *summaryCache) compact(limit int) {
+	now := time.Now()
+	items := make(map[string]cachedSummary, limit)
+	c.bytes = 0
+	for key, item := range c.items {
+		if len(items) >= limit {
+			break
+		}
+		if now.Before(item.expireAt) {
+			items[key] = item
+			c.bytes += item.size
+		}
+	}
+	c.items = items
 }
 
 // NewAISummarizer creates a new AISummarizer with the specified provider and settings
@@ -92,6 +154,15 @@ func NewAISummarizer(config *AISummarizerConfig) *AISummarizer {
 	if config.CacheTTL <= 0 {
 		config.CacheTTL = DefaultCacheTTL
 	}
+	if config.ChunkConcurrency <= 0 {
+		config.ChunkConcurrency = DefaultChunkConcurrency
+	}
+	if config.MaxConcurrency <= 0 {
+		config.MaxConcurrency = DefaultMaxConcurrency
+	}
+	if config.RoutingInterval <= 0 {
+		config.RoutingInterval = DefaultRoutingInterval
+	}
 
 	// Create HTTP client with timeout
 	httpClient := &http.Client{
@@ -102,38 +173,97 @@ func NewAISummarizer(config *AISummarizerConfig) *AISummarizer {
 	cache := &summaryCache{
 		items:    make(map[string]cachedSummary),
 		capacity: config.CacheCapacity,
+		maxBytes: config.CacheMaxBytes,
 		ttl:      config.CacheTTL,
 	}
 
 	// Create metrics collector
 	metrics := telemetry.NewMetricsCollector()
 
+	var providerRouter *router
+	if config.Routing == RoutingLatency {
+		providerRouter = newRouter(config.RoutingInterval, metrics)
+	}
+
 	return &AISummarizer{
-		maxSummaryLength: config.MaxSummaryLength,
-		timeout:          config.Timeout,
-		maxRetries:       config.MaxRetries,
-		retryDelay:       config.RetryDelay,
-		cache:            cache,
-		httpClient:       httpClient,
-		metrics:          metrics,
+		maxSummaryLength:    config.MaxSummaryLength,
+		chunkConcurrency:    config.ChunkConcurrency,
+		timeout:             config.Timeout,
+		maxRetries:          config.MaxRetries,
+		retryDelay:          config.RetryDelay,
+		hedgeDelay:          config.HedgeDelay,
+		healthProbeInterval: config.HealthProbeInterval,
+		cache:               cache,
+		httpClient:          httpClient,
+		config:              *config,
+		metrics:             metrics,
+		costs:               newCostTracker(config.Pricing, config.MonthlyBudget),
+		queue:               newRequestQueue(config.MaxConcurrency, metrics),
+		router:              providerRouter,
+		calls:               newCallLog(),
+		probes:              &probeResults{},
 	}
 }
 
-// AISummarizerConfig holds configuration for the AISummarizer
+// AISummarizerConfig holds configuration for the AISummarizer.
+// When ProviderName is empty, providers are configured from the
+// AI_SUMMARIZER_* environment variables instead. Empty API keys are read
+// from the provider's usual environment variable, e.g. ANTHROPIC_API_KEY.
+// PromptTemplate overrides providers.DefaultPromptTemplate for every
+// provider. CacheMaxBytes bounds the size of the cached summaries on top of
+// CacheCapacity; 0 bounds only the entry count. MaxInputLength is the
+// longest text sent to a provider at once; longer text is summarized in
+// chunks, ChunkConcurrency at a time, and the chunk summaries are
+// summarized again. MaxInputTokens also bounds it in tokens, as counted by
+// Tokenizer, or by tokenizer.ForProvider for each provider if Tokenizer is
+// nil; 0 bounds it in bytes only. The same counts estimate the tokens the
+// cost estimates are based on. At most MaxConcurrency provider requests are in flight
+// at once; further requests wait in a queue. Routing is RoutingStatic, the
+// default, or RoutingLatency to try the fastest healthy provider first,
+// re-ranked every RoutingInterval. With a HedgeDelay, the first fallback is
+// also asked once the primary has not answered within it, and the first
+// summary wins; 0 never hedges. With a HealthProbeInterval, the providers
+// are meant to be probed that often in the background, and health reports
+// use the last probe instead of calling the providers; 0 probes them for
+// every health report. Pricing overrides
+// DefaultPricing per model ID for the cost estimates; once the estimated
+// cost of the current month reaches MonthlyBudget, in US dollars, summaries
+// are written by the basic summarizer. A MonthlyBudget of 0 is unlimited.
+// APIKeys are further keys for the primary provider, used in turn with
+// APIKey as KeyRotation says; see providers.Config.
+// Transport sends every provider's HTTP requests; nil uses
+// http.DefaultTransport.
 type AISummarizerConfig struct {
-	ProviderName      string
-	ModelID           string
-	APIKey            string
-	MaxSummaryLength  int
-	Timeout           time.Duration
-	MaxRetries        int
-	RetryDelay        time.Duration
-	CacheCapacity     int
-	CacheTTL          time.Duration
-	FallbackProviders []struct {
+	ProviderName        string
+	ModelID             string
+	APIKey              string
+	APIKeys             []string
+	KeyRotation         string
+	PromptTemplate      string
+	MaxSummaryLength    int
+	MaxInputLength      int
+	MaxInputTokens      int
+	Tokenizer           tokenizer.Tokenizer
+	ChunkConcurrency    int
+	MaxConcurrency      int
+	Routing             string
+	RoutingInterval     time.Duration
+	HedgeDelay          time.Duration
+	HealthProbeInterval time.Duration
+	Timeout             time.Duration
+	MaxRetries          int
+	RetryDelay          time.Duration
+	CacheCapacity       int
+	CacheMaxBytes       int64
+	CacheTTL            time.Duration
+	Pricing             map[string]ModelPrice
+	MonthlyBudget       float64
+	Transport           http.RoundTripper
+	FallbackProviders   []struct {
 		Name    string
 		ModelID string
 		APIKey  string
+		APIKeys []string
 	}
 }
 
@@ -149,59 +279,151 @@ func (s *AISummarizer) Initialize() error {
 
 	// Create provider based on config
 	if s.provider == nil {
-		// Load configuration from config file and environment variables
-		config, err := loadConfigFromEnvironment()
-		if err != nil {
-			return fmt.Errorf("failed to load configuration: %w", err)
+		config := &s.config
+		if config.ProviderName == "" {
+			// Load configuration from environment variables
+			envConfig, err := loadConfigFromEnvironment()
+			if err != nil {
+				return fmt.Errorf("failed to load configuration: %w", err)
+			}
+			envConfig.Transport = s.config.Transport
+			config = envConfig
+			s.costs.setBudget(envConfig.MonthlyBudget)
+			if envConfig.Routing == RoutingLatency {
+				s.router = newRouter(envConfig.RoutingInterval, s.metrics)
+			}
+			s.hedgeDelay = envConfig.HedgeDelay
+			s.healthProbeInterval = envConfig.HealthProbeInterval
 		}
 
-		// Create provider configs
-		providerConfigs := make(map[string]providers.Config)
-
-		// Add main provider
-		providerConfigs[config.ProviderName] = providers.Config{
-			ModelID: config.ModelID,
-			APIKey:  config.APIKey,
+		if err := s.createProviders(config); err != nil {
+			return err
 		}
+	}
 
-		// Add fallback providers
-		for _, fallbackConfig := range config.FallbackProviders {
-			providerConfigs[fallbackConfig.Name] = providers.Config{
-				ModelID: fallbackConfig.ModelID,
-				APIKey:  fallbackConfig.APIKey,
-			}
-		}
+	s.providerInitialized = true
+	return nil
+}
+
+// createProviders creates the primary provider and the fallback chain, in
+// the order the fallbacks are listed in config. Fallbacks without an API key
+// are skipped.
+func (s *AISummarizer) createProviders(config *AISummarizerConfig) error {
+	switch config.Routing {
+	case "", RoutingStatic, RoutingLatency:
+	default:
+		return fmt.Errorf("%w: unknown routing %q", ErrConfigError, config.Routing)
+	}
+	switch config.KeyRotation {
+	case "", providers.KeyRotationRoundRobin, providers.KeyRotationFailover:
+	default:
+		return fmt.Errorf("%w: unknown key rotation %q", ErrConfigError, config.KeyRotation)
+	}
 
-		// Create provider factory
-		s.providerFactory = providers.NewProviderFactory(providerConfigs)
+	apiKey := firstKey(config.APIKey, config.APIKeys)
+	if apiKey == "" {
+		apiKey = getProviderAPIKey(config.ProviderName)
+	}
+	if apiKey == "" {
+		return fmt.Errorf("%w: missing API key for primary provider %s", ErrConfigError, config.ProviderName)
+	}
 
-		// Create primary provider
-		primaryProvider, err := s.providerFactory.GetProvider(config.ProviderName)
+	// Every provider is asked for a summary with the same prompt
+	var prompt *template.Template
+	if config.PromptTemplate != "" {
+		parsed, err := providers.ParsePromptTemplate(config.PromptTemplate)
 		if err != nil {
-			return fmt.Errorf("failed to create primary provider: %w", err)
+			return fmt.Errorf("%w: %w", ErrConfigError, err)
+		}
+		prompt = parsed
+	}
+
+	// Create provider configs
+	providerConfigs := map[string]providers.Config{
+		config.ProviderName: {
+			ModelID:        config.ModelID,
+			APIKey:         apiKey,
+			APIKeys:        config.APIKeys,
+			KeyRotation:    config.KeyRotation,
+			Prompt:         prompt,
+			MaxInputLength: config.MaxInputLength,
+			Transport:      config.Transport,
+		},
+	}
+
+	// Add fallback providers
+	var preferenceOrder []string
+	for _, fallbackConfig := range config.FallbackProviders {
+		if _, exists := providerConfigs[fallbackConfig.Name]; exists {
+			continue
 		}
-		s.provider = primaryProvider
 
-		// Create fallback provider chain
-		// First try with explicit fallback order
-		var preferenceOrder []string
-		for _, fb := range config.FallbackProviders {
-			preferenceOrder = append(preferenceOrder, fb.Name)
+		fallbackKey := firstKey(fallbackConfig.APIKey, fallbackConfig.APIKeys)
+		if fallbackKey == "" {
+			fallbackKey = getProviderAPIKey(fallbackConfig.Name)
+		}
+		if fallbackKey == "" {
+			continue
 		}
 
-		s.fallbackProviders = s.providerFactory.GetProviderChain(preferenceOrder)
+		providerConfigs[fallbackConfig.Name] = providers.Config{
+			ModelID:        fallbackConfig.ModelID,
+			APIKey:         fallbackKey,
+			APIKeys:        fallbackConfig.APIKeys,
+			KeyRotation:    config.KeyRotation,
+			Prompt:         prompt,
+			MaxInputLength: config.MaxInputLength,
+			Transport:      config.Transport,
+		}
+		preferenceOrder = append(preferenceOrder, fallbackConfig.Name)
+	}
+
+	// Create provider factory
+	s.providerFactory = providers.NewProviderFactory(providerConfigs)
+
+	// Create primary provider
+	primaryProvider, err := s.providerFactory.GetProvider(config.ProviderName)
+	if err != nil {
+		return fmt.Errorf("failed to create primary provider: %w", err)
+	}
+	s.provider = primaryProvider
+
+	// Create fallback provider chain. The primary is not repeated in it.
+	s.fallbackProviders = nil
+	for _, name := range preferenceOrder {
+		fallbackProvider, err := s.providerFactory.GetProvider(name)
+		if err != nil {
+			return fmt.Errorf("failed to create fallback provider %s: %w", name, err)
+		}
+		s.fallbackProviders = append(s.fallbackProviders, fallbackProvider)
 	}
 
-	s.providerInitialized = true
 	return nil
 }
 
+// firstKey returns apiKey, or the first of apiKeys if it is empty
+func firstKey(apiKey string, apiKeys []string) string {
+	if apiKey != "" {
+		return apiKey
+	}
+	for _, key := range apiKeys {
+		if key != "" {
+			return key
+		}
+	}
+	return ""
+}
+
 // loadConfigFromEnvironment loads configuration from environment variables
 func loadConfigFromEnvironment() (*AISummarizerConfig, error) {
 	// Get the primary provider configuration
 	primaryProvider := getEnvWithDefault("AI_SUMMARIZER_PROVIDER", providers.ProviderAnthropic)
 	primaryModelID := getEnvWithDefault("AI_SUMMARIZER_MODEL_ID", "")
-	primaryAPIKey := getProviderAPIKey(primaryProvider)
+	promptTemplate := getEnvWithDefault("AI_SUMMARIZER_PROMPT_TEMPLATE", "")
+	routing := getEnvWithDefault("AI_SUMMARIZER_ROUTING", RoutingStatic)
+	keyRotation := getEnvWithDefault("AI_SUMMARIZER_KEY_ROTATION", "")
+	primaryAPIKeys := getProviderAPIKeys(primaryProvider)
+	primaryAPIKey := firstKey(getProviderAPIKey(primaryProvider), primaryAPIKeys)
 
 	if primaryAPIKey == "" {
 		return nil, fmt.Errorf("%w: missing API key for primary provider %s", ErrConfigError, primaryProvider)
@@ -209,25 +431,45 @@ func loadConfigFromEnvironment() (*AISummarizerConfig, error) {
 
 	// Parse numeric settings with defaults
 	maxSummaryLen := getEnvIntWithDefault("AI_SUMMARIZER_MAX_LENGTH", DefaultMaxSummaryLength)
+	maxInputLen := getEnvIntWithDefault("AI_SUMMARIZER_MAX_INPUT_LENGTH", 0)
+	chunkConcurrency := getEnvIntWithDefault("AI_SUMMARIZER_CHUNK_CONCURRENCY", DefaultChunkConcurrency)
+	maxConcurrency := getEnvIntWithDefault("AI_SUMMARIZER_MAX_CONCURRENCY", DefaultMaxConcurrency)
 	maxRetries := getEnvIntWithDefault("AI_SUMMARIZER_MAX_RETRIES", DefaultMaxRetries)
 	cacheCapacity := getEnvIntWithDefault("AI_SUMMARIZER_CACHE_CAPACITY", DefaultCacheCapacity)
+	cacheMaxBytes := getEnvIntWithDefault("AI_SUMMARIZER_CACHE_MAX_BYTES", 0)
+	monthlyBudget := getEnvFloatWithDefault("AI_SUMMARIZER_MONTHLY_BUDGET", 0)
 
 	// Parse duration settings with defaults
 	timeout := getEnvDurationWithDefault("AI_SUMMARIZER_TIMEOUT", DefaultTimeout)
 	retryDelay := getEnvDurationWithDefault("AI_SUMMARIZER_RETRY_DELAY", DefaultRetryDelay)
 	cacheTTL := getEnvDurationWithDefault("AI_SUMMARIZER_CACHE_TTL", DefaultCacheTTL)
+	routingInterval := getEnvDurationWithDefault("AI_SUMMARIZER_ROUTING_INTERVAL", DefaultRoutingInterval)
+	hedgeDelay := getEnvDurationWithDefault("AI_SUMMARIZER_HEDGE_DELAY", 0)
+	healthProbeInterval := getEnvDurationWithDefault("AI_SUMMARIZER_HEALTH_PROBE_INTERVAL", 0)
 
 	// Build the configuration
 	config := &AISummarizerConfig{
-		ProviderName:     primaryProvider,
-		ModelID:          primaryModelID,
-		APIKey:           primaryAPIKey,
-		MaxSummaryLength: maxSummaryLen,
-		Timeout:          timeout,
-		MaxRetries:       maxRetries,
-		RetryDelay:       retryDelay,
-		CacheCapacity:    cacheCapacity,
-		CacheTTL:         cacheTTL,
+		ProviderName:        primaryProvider,
+		ModelID:             primaryModelID,
+		APIKey:              primaryAPIKey,
+		APIKeys:             primaryAPIKeys,
+		KeyRotation:         keyRotation,
+		PromptTemplate:      promptTemplate,
+		MaxSummaryLength:    maxSummaryLen,
+		MaxInputLength:      maxInputLen,
+		ChunkConcurrency:    chunkConcurrency,
+		MaxConcurrency:      maxConcurrency,
+		Routing:             routing,
+		RoutingInterval:     routingInterval,
+		HedgeDelay:          hedgeDelay,
+		HealthProbeInterval: healthProbeInterval,
+		Timeout:             timeout,
+		MaxRetries:          maxRetries,
+		RetryDelay:          retryDelay,
+		CacheCapacity:       cacheCapacity,
+		CacheMaxBytes:       int64(cacheMaxBytes),
+		CacheTTL:            cacheTTL,
+		MonthlyBudget:       monthlyBudget,
 	}
 
 	// Get fallback provider order
@@ -241,7 +483,8 @@ func loadConfigFromEnvironment() (*AISummarizerConfig, error) {
 			continue
 		}
 
-		apiKey := getProviderAPIKey(providerName)
+		apiKeys := getProviderAPIKeys(providerName)
+		apiKey := firstKey(getProviderAPIKey(providerName), apiKeys)
 		if apiKey == "" {
 			// Skip providers with no API key
 			continue
@@ -255,30 +498,33 @@ func loadConfigFromEnvironment() (*AISummarizerConfig, error) {
 			Name    string
 			ModelID string
 			APIKey  string
+			APIKeys []string
 		}{
 			Name:    providerName,
 			ModelID: modelID,
 			APIKey:  apiKey,
+			APIKeys: apiKeys,
 		})
 	}
 
 	return config, nil
 }
 
+// getProviderAPIKeys retrieves further API keys for the specified provider
+// from AI_SUMMARIZER_<PROVIDER>_API_KEYS, a comma-separated list
+func getProviderAPIKeys(providerName string) []string {
+	var keys []string
+	for _, key := range strings.Split(os.Getenv(fmt.Sprintf("AI_SUMMARIZER_%s_API_KEYS", strings.ToUpper(providerName))), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
 // getProviderAPIKey retrieves the API key for the specified provider
 func getProviderAPIKey(providerName string) string {
-	switch providerName {
-	case providers.ProviderAnthropic:
-		return os.Getenv("ANTHROPIC_API_KEY")
-	case providers.ProviderOpenAI:
-		return os.Getenv("OPENAI_API_KEY")
-	case providers.ProviderGoogle:
-		return os.Getenv("GOOGLE_API_KEY")
-	case providers.ProviderXAI:
-		return os.Getenv("XAI_API_KEY")
-	default:
-		return ""
-	}
+	return providers.EnvAPIKey(providerName)
 }
 
 // getEnvWithDefault retrieves an environment variable or returns the default value
@@ -304,6 +550,20 @@ func getEnvIntWithDefault(key string, defaultValue int) int {
 	return value
 }
 
+// getEnvFloatWithDefault retrieves an environment variable as float64 or returns the default value
+func getEnvFloatWithDefault(key string, defaultValue float64) float64 {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	value, err := strconv.ParseFloat(valueStr, 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
 // getEnvDurationWithDefault retrieves an environment variable as duration or returns the default value
 func getEnvDurationWithDefault(key string, defaultValue time.Duration) time.Duration {
 	valueStr := os.Getenv(key)
@@ -318,8 +578,40 @@ func getEnvDurationWithDefault(key string, defaultValue time.Duration) time.Dura
 	return value
 }
 
-// Summarize takes a text input and returns a condensed summary using LLMs
-func (s *AISummarizer) Summarize(text string) (string, error) {
+// Summarize takes a text input and returns a condensed summary using LLMs.
+// Once ctx is done, provider requests and retries stop and no further
+// fallback is tried.
+func (s *AISummarizer) Summarize(ctx context.Context, text string) (string, error) {
+	return s.SummarizeWithLength(ctx, text, 0)
+}
+
+// SummarizeWithLength summarizes text like Summarize, asking the providers
+// for at most maxLength characters instead of MaxSummaryLength. A maxLength
+// of 0 uses MaxSummaryLength.
+func (s *AISummarizer) SummarizeWithLength(ctx context.Context, text string, maxLength int) (string, error) {
+	summary, _, err := s.SummarizeWithGeneration(ctx, text, maxLength)
+	return summary, err
+}
+
+// SummarizeWithGeneration summarizes text like SummarizeWithLength and
+// reports what wrote the summary: the provider, model and prompt template,
+// or the basic summarizer it fell back to. A summary of text summarized in
+// chunks reports what wrote the final reduction.
+func (s *AISummarizer) SummarizeWithGeneration(ctx context.Context, text string, maxLength int) (string, Generation, error) {
+	summary, err := s.SummarizeWithTitle(ctx, text, maxLength)
+	return summary.Text, summary.Generation, err
+}
+
+// SummarizeWithTitle summarizes text like SummarizeWithGeneration and
+// titles the summary. The default prompt asks the provider for the title in
+// the same request; summaries without one, such as those of the basic
+// summarizer or of a custom prompt that does not ask for it, are titled with
+// their first sentence.
+func (s *AISummarizer) SummarizeWithTitle(ctx context.Context, text string, maxLength int) (Summary, error) {
+	if maxLength <= 0 {
+		maxLength = s.maxSummaryLength
+	}
+
 	startTime := time.Now()
 	defer func() {
 		s.metrics.RecordTimer("summarizer.total_time", time.Since(startTime))
@@ -329,130 +621,189 @@ func (s *AISummarizer) Summarize(text string) (string, error) {
 	if !s.providerInitialized {
 		s.mu.RUnlock()
 		if err := s.Initialize(); err != nil {
-			return "", fmt.Errorf("failed to initialize summarizer: %w", err)
+			return Summary{}, fmt.Errorf("failed to initialize summarizer: %w", err)
 		}
 	} else {
 		s.mu.RUnlock()
 	}
 
+	// Take the providers once, so concurrent calls never see a provider
+	// switched for another call's fallback
+	s.mu.RLock()
+	primary := s.provider
+	fallbacks := s.fallbackProviders
+	s.mu.RUnlock()
+	primary, fallbacks = s.router.route(primary, fallbacks)
+
+	// Untrusted text is summarized differently, so its summaries are
+	// cached apart
+	cacheText := text
+	if IsUntrustedText(ctx) {
+		cacheText = "\x00untrusted\x00" + text
+	}
+
 	// Check cache first
-	if summary, found := s.checkCache(text); found {
+	if cached, found := s.checkCache(cacheText, maxLength); found {
 		s.metrics.IncrementCounter(telemetry.MetricCacheHits, 1)
-		return summary, nil
+		return parseSummary(cached.summary, cached.generation), nil
 	}
 	s.metrics.IncrementCounter(telemetry.MetricCacheMisses, 1)
 
-	// Create a context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
-	defer cancel()
+	// Text longer than a provider accepts is summarized in chunks
+	var summary string
+	var generation Generation
+	var err error
+	if limit := s.inputLimit(primary, fallbacks); limit.exceededBy(text) {
+		summary, generation, err = s.summarizeChunks(ctx, text, maxLength, limit, primary, fallbacks)
+	} else {
+		summary, generation, err = s.summarizeWithFallbacks(ctx, text, maxLength, primary, fallbacks)
+	}
+	if err != nil {
+		return Summary{}, err
+	}
 
-	// Track current provider for metrics
-	var currentProviderMetric string
-	if s.provider != nil {
-		switch s.provider.Name() {
-		case providers.ProviderAnthropic:
-			currentProviderMetric = telemetry.MetricAPICallsAnthropic
-		case providers.ProviderOpenAI:
-			currentProviderMetric = telemetry.MetricAPICallsOpenAI
-		case providers.ProviderGoogle:
-			currentProviderMetric = telemetry.MetricAPICallsGoogle
-		case providers.ProviderXAI:
-			currentProviderMetric = telemetry.MetricAPICallsXAI
-		}
-		s.metrics.IncrementCounter(currentProviderMetric, 1)
+	// Cache the successful result
+	s.cacheResult(cacheText, maxLength, summary, generation)
+	return parseSummary(summary, generation), nil
+}
+
+// summarizeWithFallbacks summarizes text in at most maxLength characters
+// with primary, then with each fallback in turn, and finally with the basic
+// summarizer. If a provider refused the text and none summarized it, the
+// refusal is returned instead of a basic summary. Over the monthly budget,
+// only the basic summarizer is used.
+// With a hedge delay, the first fallback is raced against a primary that has
+// not answered in time. Once ctx is done, ErrContextCanceled is returned
+// instead of trying the next. The generation reports what wrote the summary.
+func (s *AISummarizer) summarizeWithFallbacks(ctx context.Context, text string, maxLength int, primary providers.LLMProvider, fallbacks []providers.LLMProvider) (string, Generation, error) {
+	if s.costs.overBudget() {
+		s.metrics.IncrementCounter(telemetry.MetricBudgetExceeded, 1)
+		return s.summarizeBasic(text, maxLength)
 	}
 
 	// Try with primary provider with retries
-	primaryStart := time.Now()
-	summary, err := s.summarizeWithRetries(ctx, text)
+	var summary string
+	var err error
+	writer := primary
+	if s.hedgeDelay > 0 && len(fallbacks) > 0 {
+		summary, writer, err = s.summarizeHedged(ctx, text, maxLength, primary, fallbacks[0])
+		fallbacks = fallbacks[1:]
+	} else {
+		summary, err = s.callProvider(ctx, primary, text, maxLength)
+	}
 	if err == nil {
-		// Cache the successful result
-		s.cacheResult(text, summary)
-		s.metrics.IncrementCounter(telemetry.MetricAPICallsSuccess, 1)
-
-		// Record response time for the provider
-		switch s.provider.Name() {
-		case providers.ProviderAnthropic:
-			s.metrics.RecordTimer(telemetry.MetricResponseTimeAnthropic, time.Since(primaryStart))
-		case providers.ProviderOpenAI:
-			s.metrics.RecordTimer(telemetry.MetricResponseTimeOpenAI, time.Since(primaryStart))
-		case providers.ProviderGoogle:
-			s.metrics.RecordTimer(telemetry.MetricResponseTimeGoogle, time.Since(primaryStart))
-		case providers.ProviderXAI:
-			s.metrics.RecordTimer(telemetry.MetricResponseTimeXAI, time.Since(primaryStart))
-		}
-
-		return summary, nil
+		return summary, s.providerGeneration(writer), nil
+	}
+	if ctx.Err() != nil {
+		return "", Generation{}, ErrContextCanceled
+	}
+	var refusal error
+	if errors.Is(err, ErrContentFiltered) {
+		refusal = err
 	}
-
-	// Record primary provider failure
-	s.metrics.IncrementCounter(telemetry.MetricAPICallsFailure, 1)
 	s.metrics.IncrementCounter(telemetry.MetricFallbackAttempts, 1)
 
 	// If primary provider fails, try fallbacks
-	for _, fallbackProvider := range s.fallbackProviders {
-		ctx, cancel = context.WithTimeout(context.Background(), s.timeout)
-		tempProvider := s.provider    // Save current provider
-		s.provider = fallbackProvider // Temporarily switch provider
-
-		// Track current fallback provider for metrics
-		switch fallbackProvider.Name() {
-		case providers.ProviderAnthropic:
-			s.metrics.IncrementCounter(telemetry.MetricAPICallsAnthropic, 1)
-		case providers.ProviderOpenAI:
-			s.metrics.IncrementCounter(telemetry.MetricAPICallsOpenAI, 1)
-		case providers.ProviderGoogle:
-			s.metrics.IncrementCounter(telemetry.MetricAPICallsGoogle, 1)
-		case providers.ProviderXAI:
-			s.metrics.IncrementCounter(telemetry.MetricAPICallsXAI, 1)
-		}
-
-		fallbackStart := time.Now()
-		summary, err = s.summarizeWithRetries(ctx, text)
-		s.provider = tempProvider // Restore original provider
-		cancel()
-
+	for _, fallbackProvider := range fallbacks {
+		summary, err = s.callProvider(ctx, fallbackProvider, text, maxLength)
 		if err == nil {
-			// Cache the successful result
-			s.cacheResult(text, summary)
-			s.metrics.IncrementCounter(telemetry.MetricAPICallsSuccess, 1)
 			s.metrics.IncrementCounter(telemetry.MetricFallbackSuccess, 1)
-
-			// Record response time for the fallback provider
-			switch fallbackProvider.Name() {
-			case providers.ProviderAnthropic:
-				s.metrics.RecordTimer(telemetry.MetricResponseTimeAnthropic, time.Since(fallbackStart))
-			case providers.ProviderOpenAI:
-				s.metrics.RecordTimer(telemetry.MetricResponseTimeOpenAI, time.Since(fallbackStart))
-			case providers.ProviderGoogle:
-				s.metrics.RecordTimer(telemetry.MetricResponseTimeGoogle, time.Since(fallbackStart))
-			case providers.ProviderXAI:
-				s.metrics.RecordTimer(telemetry.MetricResponseTimeXAI, time.Since(fallbackStart))
-			}
-
-			return summary, nil
+			return summary, s.providerGeneration(fallbackProvider), nil
 		}
+		if ctx.Err() != nil {
+			return "", Generation{}, ErrContextCanceled
+		}
+		if errors.Is(err, ErrContentFiltered) {
+			refusal = err
+		}
+	}
 
-		// Record fallback provider failure
-		s.metrics.IncrementCounter(telemetry.MetricAPICallsFailure, 1)
+	// Text a provider refused is not summarized by the basic summarizer
+	// either; the caller decides what to keep
+	if refusal != nil {
+		return "", Generation{}, refusal
 	}
 
 	// If all providers fail, use BasicSummarizer as final fallback
-	basicSummarizer := NewBasicSummarizer(s.maxSummaryLength)
-	summary, err = basicSummarizer.Summarize(text)
+	return s.summarizeBasic(text, maxLength)
+}
+
+// callProvider summarizes text with provider, with retries, within the
+// summarizer's timeout, and records the call in the metrics and the
+// router. A call abandoned because parent was canceled is not counted as a
+// failure, and a refusal is counted as filtered content: the provider
+// answered, so its health is not affected.
+func (s *AISummarizer) callProvider(parent context.Context, provider providers.LLMProvider, text string, maxLength int) (string, error) {
+	ctx, cancel := context.WithTimeout(parent, s.timeout)
+	defer cancel()
+
+	// Track current provider for metrics
+	switch provider.Name() {
+	case providers.ProviderAnthropic:
+		s.metrics.IncrementCounter(telemetry.MetricAPICallsAnthropic, 1)
+	case providers.ProviderOpenAI:
+		s.metrics.IncrementCounter(telemetry.MetricAPICallsOpenAI, 1)
+	case providers.ProviderGoogle:
+		s.metrics.IncrementCounter(telemetry.MetricAPICallsGoogle, 1)
+	case providers.ProviderXAI:
+		s.metrics.IncrementCounter(telemetry.MetricAPICallsXAI, 1)
+	}
+
+	start := time.Now()
+	summary, err := s.summarizeWithRetries(ctx, provider, text, maxLength)
+	if err != nil && parent.Err() != nil {
+		return "", err
+	}
+	if errors.Is(err, ErrContentFiltered) {
+		s.router.observe(provider.Name(), time.Since(start), nil)
+		s.calls.observe(provider.Name(), nil)
+		s.metrics.IncrementCounter(telemetry.MetricContentFiltered, 1)
+		return "", err
+	}
+	s.router.observe(provider.Name(), time.Since(start), err)
+	s.calls.observe(provider.Name(), err)
 	if err != nil {
-		return "", ErrSummarizationFailed
+		s.metrics.IncrementCounter(telemetry.MetricAPICallsFailure, 1)
+		return "", err
 	}
+	s.metrics.IncrementCounter(telemetry.MetricAPICallsSuccess, 1)
 
-	// Cache the fallback result
-	s.cacheResult(text, summary)
+	// Record response time for the provider
+	switch provider.Name() {
+	case providers.ProviderAnthropic:
+		s.metrics.RecordTimer(telemetry.MetricResponseTimeAnthropic, time.Since(start))
+	case providers.ProviderOpenAI:
+		s.metrics.RecordTimer(telemetry.MetricResponseTimeOpenAI, time.Since(start))
+	case providers.ProviderGoogle:
+		s.metrics.RecordTimer(telemetry.MetricResponseTimeGoogle, time.Since(start))
+	case providers.ProviderXAI:
+		s.metrics.RecordTimer(telemetry.MetricResponseTimeXAI, time.Since(start))
+	}
 	return summary, nil
 }
 
-// summarizeWithRetries attempts to summarize text with the current provider, with retries
-func (s *AISummarizer) summarizeWithRetries(ctx context.Context, text string) (string, error) {
+// summarizeBasic summarizes text with the basic summarizer
+func (s *AISummarizer) summarizeBasic(text string, maxLength int) (string, Generation, error) {
+	summary, generation, err := NewBasicSummarizer(maxLength).SummarizeWithGeneration(context.Background(), text, 0)
+	if err != nil {
+		return "", Generation{}, ErrSummarizationFailed
+	}
+	return summary, generation, nil
+}
+
+// summarizeWithRetries attempts to summarize text with provider, with
+// retries. A refusal is returned right away, since it would be repeated.
+// Untrusted text is fenced off from the prompt, and tool-use output is
+// stripped from its summary; a summary holding nothing else is retried.
+func (s *AISummarizer) summarizeWithRetries(ctx context.Context, provider providers.LLMProvider, text string, maxLength int) (string, error) {
 	var lastErr error
 
+	untrusted := IsUntrustedText(ctx)
+	input := text
+	if untrusted {
+		input = fenceUntrusted(text)
+	}
+
 	for attempt := 0; attempt <= s.maxRetries; attempt++ {
 		// Check if context is canceled before making the attempt
 		select {
@@ -466,30 +817,52 @@ func (s *AISummarizer) summarizeWithRetries(ctx context.Context, text string) (s
 			s.metrics.IncrementCounter(telemetry.MetricRetryAttempts, 1)
 
 			// Wait before retry with exponential backoff
-			retryDelay := s.retryDelay * time.Duration(attempt)
-			time.Sleep(retryDelay)
+			retryDelay := time.NewTimer(s.retryDelay * time.Duration(attempt))
+			select {
+			case <-retryDelay.C:
+			case <-ctx.Done():
+				retryDelay.Stop()
+				return "", ErrContextCanceled
+			}
 		}
 
-		summary, err := s.provider.Summarize(ctx, text, s.maxSummaryLength)
+		if err := s.queue.acquire(ctx); err != nil {
+			return "", err
+		}
+		summary, err := provider.Summarize(ctx, input, maxLength)
+		s.queue.release()
+		if err == nil && untrusted {
+			var stripped bool
+			if summary, stripped = stripToolUse(summary); stripped {
+				s.metrics.IncrementCounter(telemetry.MetricToolUseStripped, 1)
+			}
+		}
+		if err == nil && summary == "" {
+			// An empty summary is a malformed response; retry like any failure
+			err = ErrEmptySummary
+		}
 		if err == nil {
 			if attempt > 0 {
 				// Track successful retry
 				s.metrics.IncrementCounter(telemetry.MetricRetrySuccess, 1)
 			}
+			s.recordUsage(provider, input, summary)
 			return summary, nil
 		}
 
+		if errors.Is(err, ErrContentFiltered) {
+			return "", err
+		}
 		lastErr = err
 	}
 
 	return "", lastErr
 }
 
-// checkCache looks for a cached summary
-func (s *AISummarizer) checkCache(text string) (string, bool) {
-	// Create a proper hash of the text as the key
-	hash := sha256.Sum256([]byte(text))
-	key := hex.EncodeToString(hash[:])
+// checkCache looks for a cached summary of text in at most maxLength
+// characters
+func (s *AISummarizer) checkCache(text string, maxLength int) (cachedSummary, bool) {
+	key := cacheKey(text, maxLength)
 
 	s.cache.mu.RLock()
 	defer s.cache.mu.RUnlock()
@@ -497,106 +870,98 @@ func (s *AISummarizer) checkCache(text string) (string, bool) {
 	if item, exists := s.cache.items[key]; exists {
 		// Check if the cached item is still valid
 		if time.Now().Before(item.expireAt) {
-			return item.summary, true
+			return item, true
 		}
 	}
 
-	return "", false
+	return cachedSummary{}, false
 }
 
-// cacheResult stores a summary in the cache
-func (s *AISummarizer) cacheResult(text, summary string) {
-	// Create a proper hash of the text as the key
-	hash := sha256.Sum256([]byte(text))
-	key := hex.EncodeToString(hash[:])
+// cacheResult stores a summary of text in at most maxLength characters,
+// and what wrote it, in the cache
+func (s *AISummarizer) cacheResult(text string, maxLength int, summary string, generation Generation) {
+	key := cacheKey(text, maxLength)
+
+	// Count the key and the summary, which dominate an entry's memory
+	size := int64(len(key) + len(summary))
 
 	s.cache.mu.Lock()
 	defer s.cache.mu.Unlock()
 
-	// Enforce cache capacity by evicting oldest items if needed
-	if len(s.cache.items) >= s.cache.capacity {
+	if existing, exists := s.cache.items[key]; exists {
+		delete(s.cache.items, key)
+		s.cache.bytes -= existing.size
+	}
+
+	// A summary larger than the whole byte budget is not cached at all
+	if s.cache.maxBytes <= 0 || size <= s.cache.maxBytes {
+		// Enforce cache capacity and byte budget by evicting items if needed.
 		// Simple eviction strategy - delete a random item
 		// In a real implementation, use LRU or similar policy
-		for k := range s.cache.items {
-			delete(s.cache.items, k)
-			break
+		for len(s.cache.items) > 0 && (len(s.cache.items) >= s.cache.capacity ||
+			(s.cache.maxBytes > 0 && s.cache.bytes+size > s.cache.maxBytes)) {
+			s.cache.evictOne()
 		}
-	}
 
-	// Store the new item
-	s.cache.items[key] = cachedSummary{
-		summary:  summary,
-		expireAt: time.Now().Add(s.cache.ttl),
+		// Store the new item
+		s.cache.items[key] = cachedSummary{
+			summary:    summary,
+			generation: generation,
+			size:       size,
+			expireAt:   time.Now().Add(s.cache.ttl),
+		}
+		s.cache.bytes += size
 	}
 
-	// Update cache size metric
+	// Update cache size metrics
 	s.metrics.SetGauge(telemetry.MetricCacheSize, float64(len(s.cache.items)))
+	s.metrics.SetGauge(telemetry.MetricCacheBytes, float64(s.cache.bytes))
 }
 
-// GetMetrics returns the metrics collector for this summarizer
-func (s *AISummarizer) GetMetrics() *telemetry.MetricsCollector {
-	return s.metrics
+// cacheKey returns the cache key of the summary of text in at most
+// maxLength characters, a hash of both
+func cacheKey(text string, maxLength int) string {
+	hash := sha256.Sum256([]byte(strconv.Itoa(maxLength) + "\x00" + text))
+	return hex.EncodeToString(hash[:])
 }
 
-// CheckProviderHealth tests if all providers are operational
-func (s *AISummarizer) CheckProviderHealth() map[string]bool {
-	results := make(map[string]bool)
-	testText := "This is a brief health check for the LLM provider."
+// ReleaseIdle closes the providers' idle connections and drops expired
+// summaries from the cache.
+func (s *AISummarizer) ReleaseIdle() error {
+	s.mu.RLock()
+	chain := append([]providers.LLMProvider{s.provider}, s.fallbackProviders...)
+	s.mu.RUnlock()
 
-	// First, ensure the AISummarizer is initialized
-	if err := s.Initialize(); err != nil {
-		return results
+	for _, provider := range chain {
+		if closer, ok := provider.(providers.IdleConnectionCloser); ok {
+			closer.CloseIdleConnections()
+		}
 	}
+	s.httpClient.CloseIdleConnections()
 
-	// Check primary provider
-	if s.provider != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		_, err := s.provider.Summarize(ctx, testText, 50)
-		cancel()
-
-		providerName := s.provider.Name()
-		results[providerName] = (err == nil)
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
 
-		// Record health status
-		switch providerName {
-		case providers.ProviderAnthropic:
-			s.metrics.SetGauge(telemetry.MetricProviderHealthAnthropic, boolToFloat64(results[providerName]))
-		case providers.ProviderOpenAI:
-			s.metrics.SetGauge(telemetry.MetricProviderHealthOpenAI, boolToFloat64(results[providerName]))
-		case providers.ProviderGoogle:
-			s.metrics.SetGauge(telemetry.MetricProviderHealthGoogle, boolToFloat64(results[providerName]))
-		case providers.ProviderXAI:
-			s.metrics.SetGauge(telemetry.MetricProviderHealthXAI, boolToFloat64(results[providerName]))
-		}
-	}
+	s.cache.compact(len(s.cache.items))
+	s.metrics.SetGauge(telemetry.MetricCacheSize, float64(len(s.cache.items)))
+	s.metrics.SetGauge(telemetry.MetricCacheBytes, float64(s.cache.bytes))
+	return nil
+}
 
-	// Check fallback providers
-	for _, provider := range s.fallbackProviders {
-		providerName := provider.Name()
-		if _, alreadyChecked := results[providerName]; alreadyChecked {
-			continue
-		}
+// ShrinkCache drops expired summaries and keeps at most half of the
+// cache, so the process can give memory back under pressure.
+func (s *AISummarizer) ShrinkCache() {
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
 
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		_, err := provider.Summarize(ctx, testText, 50)
-		cancel()
-
-		results[providerName] = (err == nil)
-
-		// Record health status
-		switch providerName {
-		case providers.ProviderAnthropic:
-			s.metrics.SetGauge(telemetry.MetricProviderHealthAnthropic, boolToFloat64(results[providerName]))
-		case providers.ProviderOpenAI:
-			s.metrics.SetGauge(telemetry.MetricProviderHealthOpenAI, boolToFloat64(results[providerName]))
-		case providers.ProviderGoogle:
-			s.metrics.SetGauge(telemetry.MetricProviderHealthGoogle, boolToFloat64(results[providerName]))
-		case providers.ProviderXAI:
-			s.metrics.SetGauge(telemetry.MetricProviderHealthXAI, boolToFloat64(results[providerName]))
-		}
-	}
+	s.cache.compact(len(s.cache.items) / 2)
+	s.metrics.SetGauge(telemetry.MetricCacheSize, float64(len(s.cache.items)))
+	s.metrics.SetGauge(telemetry.MetricCacheBytes, float64(s.cache.bytes))
+}
 
-	return results
+// GetMetrics returns the metrics collector for this summarizer
+func (s *AISummarizer) GetMetrics() *telemetry.MetricsCollector {
+	return s.metrics
 }
 
 // boolToFloat64 converts a boolean to a float64 (1.0 for true, 0.0 for false)
@@ -3,10 +3,19 @@ package summarizer
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/localrivet/projectmemory/internal/chaos"
 	"github.com/localrivet/projectmemory/internal/summarizer/providers"
+	"github.com/localrivet/projectmemory/internal/telemetry"
+	"github.com/localrivet/projectmemory/internal/tokenizer"
 )
 
 // MockLLMProvider implements the providers.LLMProvider interface for testing
@@ -77,6 +86,274 @@ func TestNewAISummarizer(t *testing.T) {
 	}
 }
 
+// TestAISummarizerInitializeFromConfig tests that providers come from the
+// config rather than the environment when a provider name is set
+func TestAISummarizerInitializeFromConfig(t *testing.T) {
+	t.Setenv("AI_SUMMARIZER_PROVIDER", providers.ProviderGoogle)
+	t.Setenv("GOOGLE_API_KEY", "")
+	t.Setenv("XAI_API_KEY", "xai-env-key")
+
+	config := &AISummarizerConfig{
+		ProviderName: providers.ProviderOpenAI,
+		ModelID:      "gpt-4o-mini",
+		APIKey:       "openai-key",
+	}
+	for _, fallback := range []struct{ name, key string }{
+		{providers.ProviderXAI, ""},         // key read from XAI_API_KEY
+		{providers.ProviderGoogle, ""},      // skipped, no key
+		{providers.ProviderOpenAI, "other"}, // skipped, same as primary
+		{providers.ProviderAnthropic, "anthropic-key"},
+	} {
+		config.FallbackProviders = append(config.FallbackProviders, struct {
+			Name    string
+			ModelID string
+			APIKey  string
+			APIKeys []string
+		}{Name: fallback.name, APIKey: fallback.key})
+	}
+
+	s := NewAISummarizer(config)
+	if err := s.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	if s.provider.Name() != providers.ProviderOpenAI {
+		t.Errorf("Expected primary provider %s, got %s", providers.ProviderOpenAI, s.provider.Name())
+	}
+	var fallbacks []string
+	for _, fallback := range s.fallbackProviders {
+		fallbacks = append(fallbacks, fallback.Name())
+	}
+	want := []string{providers.ProviderXAI, providers.ProviderAnthropic}
+	if len(fallbacks) != len(want) || fallbacks[0] != want[0] || fallbacks[1] != want[1] {
+		t.Errorf("Expected fallbacks %v, got %v", want, fallbacks)
+	}
+
+	// A primary without any API key is a configuration error
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	missing := NewAISummarizer(&AISummarizerConfig{ProviderName: providers.ProviderAnthropic})
+	if err := missing.Initialize(); !errors.Is(err, ErrConfigError) {
+		t.Errorf("Expected ErrConfigError, got %v", err)
+	}
+}
+
+// TestAISummarizerPromptTemplate tests that a configured prompt template
+// reaches every provider and that unusable templates are rejected
+func TestAISummarizerPromptTemplate(t *testing.T) {
+	config := &AISummarizerConfig{
+		ProviderName:   providers.ProviderOpenAI,
+		APIKey:         "openai-key",
+		PromptTemplate: "Keep every code identifier. At most {{.MaxLength}} characters:\n{{.Text}}",
+	}
+	config.FallbackProviders = append(config.FallbackProviders, struct {
+		Name    string
+		ModelID string
+		APIKey  string
+		APIKeys []string
+	}{Name: providers.ProviderAnthropic, APIKey: "anthropic-key"})
+
+	s := NewAISummarizer(config)
+	if err := s.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	type promptRenderer interface {
+		RenderPrompt(text string, maxLength int) (string, error)
+	}
+	for _, provider := range append([]providers.LLMProvider{s.provider}, s.fallbackProviders...) {
+		renderer, ok := provider.(promptRenderer)
+		if !ok {
+			t.Fatalf("Provider %s does not render prompts", provider.Name())
+		}
+		prompt, err := renderer.RenderPrompt("func ParseConfig()", 200)
+		if err != nil {
+			t.Fatalf("RenderPrompt() error = %v", err)
+		}
+		if want := "Keep every code identifier. At most 200 characters:\nfunc ParseConfig()"; prompt != want {
+			t.Errorf("Provider %s: expected prompt %q, got %q", provider.Name(), want, prompt)
+		}
+	}
+
+	for _, template := range []string{
+		"Summarize {{.Text",           // does not parse
+		"Summarize {{.Body}}",         // unknown field
+		"Summarize in {{.MaxLength}}", // leaves out the text
+	} {
+		invalid := NewAISummarizer(&AISummarizerConfig{
+			ProviderName:   providers.ProviderOpenAI,
+			APIKey:         "openai-key",
+			PromptTemplate: template,
+		})
+		if err := invalid.Initialize(); !errors.Is(err, ErrConfigError) {
+			t.Errorf("Template %q: expected ErrConfigError, got %v", template, err)
+		}
+	}
+}
+
+// keyedTransport answers Anthropic requests, rate limiting the keys in
+// limited and recording the key each request was sent with
+type keyedTransport struct {
+	limited map[string]bool
+	mu      sync.Mutex
+	keys    []string
+}
+
+// RoundTrip answers req with a summary or 429 Too Many Requests
+func (t *keyedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := req.Header.Get("X-API-Key")
+	t.mu.Lock()
+	t.keys = append(t.keys, key)
+	t.mu.Unlock()
+
+	status, body := http.StatusOK, `{"content":[{"text":"summary"}]}`
+	if t.limited[key] {
+		status, body = http.StatusTooManyRequests, `{"error":{"type":"rate_limit_error","message":"rate limited"}}`
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+// TestAISummarizerKeyRotation tests that requests rotate among a provider's
+// API keys and move past a rate-limited key
+func TestAISummarizerKeyRotation(t *testing.T) {
+	summarize := func(t *testing.T, rotation string, transport *keyedTransport, texts int) {
+		t.Helper()
+		s := NewAISummarizer(&AISummarizerConfig{
+			ProviderName: providers.ProviderAnthropic,
+			APIKeys:      []string{"key-a", "key-b", "key-c"},
+			KeyRotation:  rotation,
+			MaxRetries:   1,
+			Transport:    transport,
+		})
+		if err := s.Initialize(); err != nil {
+			t.Fatalf("Initialize failed: %v", err)
+		}
+		for i := 0; i < texts; i++ {
+			if _, err := s.Summarize(context.Background(), fmt.Sprintf("text %d to summarize", i)); err != nil {
+				t.Fatalf("Summarize failed: %v", err)
+			}
+		}
+	}
+
+	t.Run("round-robin", func(t *testing.T) {
+		transport := &keyedTransport{}
+		summarize(t, providers.KeyRotationRoundRobin, transport, 4)
+		want := []string{"key-a", "key-b", "key-c", "key-a"}
+		if fmt.Sprint(transport.keys) != fmt.Sprint(want) {
+			t.Errorf("Expected keys %v, got %v", want, transport.keys)
+		}
+	})
+
+	t.Run("failover", func(t *testing.T) {
+		transport := &keyedTransport{limited: map[string]bool{"key-a": true}}
+		summarize(t, providers.KeyRotationFailover, transport, 3)
+		want := []string{"key-a", "key-b", "key-b", "key-b"}
+		if fmt.Sprint(transport.keys) != fmt.Sprint(want) {
+			t.Errorf("Expected keys %v, got %v", want, transport.keys)
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		s := NewAISummarizer(&AISummarizerConfig{
+			ProviderName: providers.ProviderAnthropic,
+			APIKey:       "key-a",
+			KeyRotation:  "random",
+		})
+		if err := s.Initialize(); !errors.Is(err, ErrConfigError) {
+			t.Errorf("Expected ErrConfigError, got %v", err)
+		}
+	})
+}
+
+// bodyTransport answers every request with status and body, counting the
+// requests
+type bodyTransport struct {
+	status   int
+	body     string
+	requests atomic.Int32
+}
+
+// RoundTrip answers req with the transport's status and body
+func (t *bodyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+	return &http.Response{
+		StatusCode: t.status,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(t.body)),
+		Request:    req,
+	}, nil
+}
+
+// TestAISummarizerContentFiltered tests that each provider's refusals are
+// reported as ErrContentFiltered without retries, fallback to the basic
+// summarizer or counting the provider as failing
+func TestAISummarizerContentFiltered(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		status   int
+		body     string
+	}{
+		{"anthropic refusal", providers.ProviderAnthropic, http.StatusOK,
+			`{"content":[{"text":"I can't help with that."}],"stop_reason":"refusal"}`},
+		{"openai refusal", providers.ProviderOpenAI, http.StatusOK,
+			`{"choices":[{"message":{"content":"","refusal":"I can't help with that."},"finish_reason":"stop"}]}`},
+		{"openai filtered completion", providers.ProviderOpenAI, http.StatusOK,
+			`{"choices":[{"message":{"content":""},"finish_reason":"content_filter"}]}`},
+		{"openai policy error", providers.ProviderOpenAI, http.StatusBadRequest,
+			`{"error":{"message":"rejected by the safety system","type":"invalid_request_error","code":"content_policy_violation"}}`},
+		{"google blocked prompt", providers.ProviderGoogle, http.StatusOK,
+			`{"promptFeedback":{"blockReason":"SAFETY"}}`},
+		{"google blocked candidate", providers.ProviderGoogle, http.StatusOK,
+			`{"candidates":[{"content":{"parts":[]},"finishReason":"SAFETY"}]}`},
+		{"xai filtered completion", providers.ProviderXAI, http.StatusOK,
+			`{"choices":[{"message":{"content":""},"finish_reason":"content_filter"}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &bodyTransport{status: tt.status, body: tt.body}
+			s := NewAISummarizer(&AISummarizerConfig{
+				ProviderName: tt.provider,
+				APIKey:       "test-key",
+				MaxRetries:   2,
+				RetryDelay:   time.Millisecond,
+				Transport:    transport,
+			})
+			if err := s.Initialize(); err != nil {
+				t.Fatalf("Initialize failed: %v", err)
+			}
+
+			summary, err := s.Summarize(context.Background(), "Text the provider will not summarize.")
+			if !errors.Is(err, ErrContentFiltered) {
+				t.Fatalf("Expected ErrContentFiltered, got summary %q and error %v", summary, err)
+			}
+			if got := transport.requests.Load(); got != 1 {
+				t.Errorf("Expected a refusal not to be retried, got %d requests", got)
+			}
+			if got := s.metrics.GetCounter(telemetry.MetricContentFiltered); got != 1 {
+				t.Errorf("Expected 1 filtered call, got %d", got)
+			}
+			if got := s.metrics.GetCounter(telemetry.MetricAPICallsFailure); got != 0 {
+				t.Errorf("Expected a refusal not to count as a failure, got %d failures", got)
+			}
+		})
+	}
+
+	// A fallback provider that accepts the text writes the summary
+	s := NewAISummarizer(&AISummarizerConfig{})
+	s.provider = providers.NewTestProvider("refusing", "", fmt.Errorf("%w: test", ErrContentFiltered))
+	s.fallbackProviders = []providers.LLMProvider{providers.NewTestProvider("accepting", "A summary", nil)}
+	s.providerInitialized = true
+	if summary, err := s.Summarize(context.Background(), "Text one provider refuses."); err != nil || summary != "A summary" {
+		t.Errorf("Expected the fallback's summary, got %q and error %v", summary, err)
+	}
+}
+
 // TestAISummarizerCache tests the caching functionality
 func TestAISummarizerCache(t *testing.T) {
 	// Create a mock provider that returns a specific summary
@@ -96,7 +373,7 @@ func TestAISummarizerCache(t *testing.T) {
 
 	// First call should use the provider
 	text := "This is some text to summarize."
-	summary1, err := summarizer.Summarize(text)
+	summary1, err := summarizer.Summarize(context.Background(), text)
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -108,7 +385,7 @@ func TestAISummarizerCache(t *testing.T) {
 	mockProvider.returnSummary = "This is a different summary."
 
 	// Second call with same text should use cache
-	summary2, err := summarizer.Summarize(text)
+	summary2, err := summarizer.Summarize(context.Background(), text)
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -118,7 +395,7 @@ func TestAISummarizerCache(t *testing.T) {
 
 	// Call with different text should use provider again
 	text2 := "This is different text to summarize."
-	summary3, err := summarizer.Summarize(text2)
+	summary3, err := summarizer.Summarize(context.Background(), text2)
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -127,6 +404,68 @@ func TestAISummarizerCache(t *testing.T) {
 	}
 }
 
+// TestAISummarizerSummaryLength checks that a requested summary length
+// reaches the provider and is cached apart from the configured length
+func TestAISummarizerSummaryLength(t *testing.T) {
+	mockProvider := &MockLLMProvider{returnSummary: strings.Repeat("s", 80)}
+	summarizer := NewAISummarizer(&AISummarizerConfig{MaxSummaryLength: 50})
+	summarizer.provider = mockProvider
+	summarizer.providerInitialized = true
+
+	text := "This is some text to summarize."
+	for _, tc := range []struct {
+		maxLength int
+		want      int
+	}{
+		{0, 50},
+		{20, 20},
+		{0, 50},
+	} {
+		summary, err := summarizer.SummarizeWithLength(context.Background(), text, tc.maxLength)
+		if err != nil {
+			t.Fatalf("SummarizeWithLength(%d) failed: %v", tc.maxLength, err)
+		}
+		if len(summary) != tc.want {
+			t.Errorf("Expected a %d character summary for max length %d, got %d", tc.want, tc.maxLength, len(summary))
+		}
+	}
+}
+
+// TestAISummarizerCacheMaxBytes tests that the cache stays within its byte
+// budget and shrinks on demand
+func TestAISummarizerCacheMaxBytes(t *testing.T) {
+	// Each entry is a 64 byte key plus a 36 byte summary
+	summarizer := NewAISummarizer(&AISummarizerConfig{
+		CacheCapacity: 10,
+		CacheMaxBytes: 250,
+		CacheTTL:      time.Hour,
+	})
+	summary := strings.Repeat("s", 36)
+	for i := 0; i < 5; i++ {
+		summarizer.cacheResult(fmt.Sprintf("text %d", i), DefaultMaxSummaryLength, summary, Generation{})
+	}
+	if size := len(summarizer.cache.items); size != 2 {
+		t.Errorf("Expected 2 cached summaries within 250 bytes, got %d", size)
+	}
+	if summarizer.cache.bytes != 200 {
+		t.Errorf("Expected 200 cached bytes, got %d", summarizer.cache.bytes)
+	}
+
+	// A summary over the whole budget is not cached
+	summarizer.cacheResult("huge", DefaultMaxSummaryLength, strings.Repeat("s", 300), Generation{})
+	if _, found := summarizer.checkCache("huge", DefaultMaxSummaryLength); found {
+		t.Error("Expected a summary larger than the budget not to be cached")
+	}
+
+	summarizer.ShrinkCache()
+	if size := len(summarizer.cache.items); size != 1 {
+		t.Errorf("Expected 1 cached summary after shrinking, got %d", size)
+	}
+	if summarizer.cache.bytes != 100 {
+		t.Errorf("Expected 100 cached bytes after shrinking, got %d", summarizer.cache.bytes)
+	}
+}
+
 // TestAISummarizerRetries tests the retry functionality
 func TestAISummarizerRetries(t *testing.T) {
 	// Create a mock provider that fails a certain number of times then succeeds
@@ -145,7 +484,7 @@ func TestAISummarizerRetries(t *testing.T) {
 	summarizer.providerInitialized = true
 
 	// Should succeed after retries
-	summary, err := summarizer.Summarize("Test text")
+	summary, err := summarizer.Summarize(context.Background(), "Test text")
 	if err != nil {
 		t.Fatalf("Expected success after retries, got error: %v", err)
 	}
@@ -173,7 +512,7 @@ func TestAISummarizerRetries(t *testing.T) {
 		ctx, cancel := context.WithTimeout(context.Background(), failSummarizer.timeout)
 		defer cancel()
 
-		_, err := failSummarizer.summarizeWithRetries(ctx, "Test direct failure")
+		_, err := failSummarizer.summarizeWithRetries(ctx, failingProvider, "Test direct failure", DefaultMaxSummaryLength)
 		if err == nil {
 			t.Fatalf("Expected error from summarizeWithRetries, got success")
 		}
@@ -203,7 +542,7 @@ func TestAISummarizerFallback(t *testing.T) {
 	summarizer.providerInitialized = true
 
 	// Should use fallback provider
-	summary, err := summarizer.Summarize("Test text")
+	summary, err := summarizer.Summarize(context.Background(), "Test text")
 	if err != nil {
 		t.Fatalf("Expected success with fallback, got error: %v", err)
 	}
@@ -222,7 +561,7 @@ func TestAISummarizerFallback(t *testing.T) {
 
 	// Should use the basic summarizer fallback
 	veryShortText := "Test"
-	summary, err = summarizer2.Summarize(veryShortText)
+	summary, err = summarizer2.Summarize(context.Background(), veryShortText)
 	if err != nil {
 		t.Fatalf("Expected success with basic summarizer fallback, got error: %v", err)
 	}
@@ -232,3 +571,692 @@ func TestAISummarizerFallback(t *testing.T) {
 		t.Errorf("Expected '%s' from basic summarizer, got '%s'", veryShortText, summary)
 	}
 }
+
+// TestAISummarizerGeneration checks that summaries report the provider,
+// model and prompt version that wrote them, from the cache too, and the
+// basic summarizer once every provider fails
+func TestAISummarizerGeneration(t *testing.T) {
+	fallback := &modelProvider{countingProvider: countingProvider{summary: "Fallback summary"}, model: "test-model"}
+	s := NewAISummarizer(&AISummarizerConfig{
+		MaxRetries:     1,
+		RetryDelay:     time.Millisecond,
+		PromptTemplate: "Summarize in {{max_length}} characters: {{text}}",
+	})
+	s.provider = &MockLLMProvider{returnError: true}
+	s.fallbackProviders = []providers.LLMProvider{fallback}
+	s.providerInitialized = true
+
+	want := Generation{
+		Summarizer:    GeneratedByAI,
+		Provider:      "counting",
+		Model:         "test-model",
+		PromptVersion: promptVersion("Summarize in {{max_length}} characters: {{text}}"),
+	}
+	if !strings.HasPrefix(want.PromptVersion, "sha256:") {
+		t.Errorf("Expected a hashed prompt version for a custom template, got %q", want.PromptVersion)
+	}
+	for _, call := range []string{"first", "cached"} {
+		summary, generation, err := s.SummarizeWithGeneration(context.Background(), "Test text", 0)
+		if err != nil || summary != "Fallback summary" {
+			t.Fatalf("%s call: expected the fallback summary, got %q, %v", call, summary, err)
+		}
+		if generation != want {
+			t.Errorf("%s call: expected generation %+v, got %+v", call, want, generation)
+		}
+	}
+	if calls := fallback.calls.Load(); calls != 1 {
+		t.Errorf("Expected the second call to be cached, got %d provider calls", calls)
+	}
+
+	fallback.summary = ""
+	_, generation, err := s.SummarizeWithGeneration(context.Background(), "Other text", 0)
+	if err != nil {
+		t.Fatalf("Expected the basic summarizer to take over, got %v", err)
+	}
+	if generation != (Generation{Summarizer: GeneratedByBasic}) {
+		t.Errorf("Expected a basic generation, got %+v", generation)
+	}
+}
+
+// TestAISummarizerTitle checks that the title line of a provider's answer is
+// split off the summary, also when the answer comes from the cache
+func TestAISummarizerTitle(t *testing.T) {
+	provider := &countingProvider{summary: "Title: JWT authentication\nThe API uses JWT tokens that expire hourly."}
+	s := NewAISummarizer(&AISummarizerConfig{MaxRetries: 1, RetryDelay: time.Millisecond})
+	s.provider = provider
+	s.providerInitialized = true
+
+	for _, call := range []string{"first", "cached"} {
+		summary, err := s.SummarizeWithTitle(context.Background(), "Test text", 0)
+		if err != nil {
+			t.Fatalf("%s call: SummarizeWithTitle() error = %v", call, err)
+		}
+		if summary.Title != "JWT authentication" || summary.Text != "The API uses JWT tokens that expire hourly." {
+			t.Errorf("%s call: expected the title split off, got %+v", call, summary)
+		}
+	}
+	if calls := provider.calls.Load(); calls != 1 {
+		t.Errorf("Expected the second call to be cached, got %d provider calls", calls)
+	}
+	if summary, _, err := s.SummarizeWithGeneration(context.Background(), "Test text", 0); err != nil || summary != "The API uses JWT tokens that expire hourly." {
+		t.Errorf("SummarizeWithGeneration() = %q, %v, want the summary without its title", summary, err)
+	}
+
+	// Answers without a title line get one from their first sentence
+	provider.summary = "Deploys run from main. Tags publish."
+	summary, err := s.SummarizeWithTitle(context.Background(), "Other text", 0)
+	if err != nil || summary.Title != "Deploys run from main" || summary.Text != provider.summary {
+		t.Errorf("SummarizeWithTitle() = %+v, %v, want a derived title", summary, err)
+	}
+}
+
+// countingProvider is a providers.LLMProvider that is safe for concurrent
+// use and counts its calls
+type countingProvider struct {
+	summary string
+	calls   atomic.Int32
+}
+
+// Summarize returns the fixed summary, or an error if there is none
+func (p *countingProvider) Summarize(ctx context.Context, text string, maxLength int) (string, error) {
+	p.calls.Add(1)
+	if p.summary == "" {
+		return "", errors.New("mock summarization error")
+	}
+	return p.summary, nil
+}
+
+// Name returns the provider name
+func (p *countingProvider) Name() string {
+	return "counting"
+}
+
+// TestAISummarizerConcurrentFallback checks that concurrent calls falling
+// back to another provider never use it in place of each other's primary
+func TestAISummarizerConcurrentFallback(t *testing.T) {
+	const calls = 20
+
+	primaryProvider := &countingProvider{}
+	fallbackProvider := &countingProvider{summary: "Fallback summary"}
+	summarizer := NewAISummarizer(&AISummarizerConfig{
+		MaxRetries: 1,
+		RetryDelay: time.Millisecond,
+	})
+	summarizer.provider = primaryProvider
+	summarizer.fallbackProviders = []providers.LLMProvider{fallbackProvider}
+	summarizer.providerInitialized = true
+
+	var wg sync.WaitGroup
+	errs := make(chan error, calls)
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			summary, err := summarizer.Summarize(context.Background(), fmt.Sprintf("Text %d", i))
+			if err == nil && summary != "Fallback summary" {
+				err = fmt.Errorf("unexpected summary %q", summary)
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Summarize() error = %v", err)
+		}
+	}
+	// Each call tries the primary once and retries it once
+	if got := primaryProvider.calls.Load(); got != 2*calls {
+		t.Errorf("Expected %d primary calls, got %d", 2*calls, got)
+	}
+	if got := fallbackProvider.calls.Load(); got != calls {
+		t.Errorf("Expected %d fallback calls, got %d", calls, got)
+	}
+	if summarizer.provider != primaryProvider {
+		t.Error("Expected the primary provider to be unchanged")
+	}
+}
+
+// TestAISummarizerUnderChaos checks that retries and fallbacks recover from
+// injected errors and malformed (empty) provider responses
+func TestAISummarizerUnderChaos(t *testing.T) {
+	config := &AISummarizerConfig{
+		MaxRetries: 5,
+		RetryDelay: time.Millisecond,
+	}
+
+	t.Run("retries through intermittent errors", func(t *testing.T) {
+		summarizer := NewAISummarizer(config)
+		summarizer.provider = chaos.WrapProvider(providers.NewTestProvider("flaky", "Recovered summary", nil),
+			chaos.Config{ErrorRate: 0.5, Seed: 7})
+		summarizer.providerInitialized = true
+
+		summary, err := summarizer.Summarize(context.Background(), "Test text")
+		if err != nil {
+			t.Fatalf("Expected retries to recover, got error: %v", err)
+		}
+		if summary != "Recovered summary" {
+			t.Errorf("Expected 'Recovered summary', got '%s'", summary)
+		}
+	})
+
+	t.Run("falls back past malformed responses", func(t *testing.T) {
+		summarizer := NewAISummarizer(config)
+		summarizer.provider = chaos.WrapProvider(providers.NewTestProvider("broken", "unused", nil),
+			chaos.Config{MalformedRate: 1, Seed: 7})
+		summarizer.fallbackProviders = []providers.LLMProvider{providers.NewTestProvider("healthy", "Fallback summary", nil)}
+		summarizer.providerInitialized = true
+
+		summary, err := summarizer.Summarize(context.Background(), "Test text")
+		if err != nil {
+			t.Fatalf("Expected fallback to recover, got error: %v", err)
+		}
+		if summary != "Fallback summary" {
+			t.Errorf("Expected 'Fallback summary', got '%s'", summary)
+		}
+	})
+}
+
+// chunkProvider is a providers.LLMProvider that records the texts it is
+// asked to summarize and how many calls overlap
+type chunkProvider struct {
+	mu         sync.Mutex
+	inputs     []string
+	inFlight   int
+	maxOverlap int
+}
+
+// Summarize records text and returns a short summary of it
+func (p *chunkProvider) Summarize(ctx context.Context, text string, maxLength int) (string, error) {
+	p.mu.Lock()
+	p.inputs = append(p.inputs, text)
+	p.inFlight++
+	if p.inFlight > p.maxOverlap {
+		p.maxOverlap = p.inFlight
+	}
+	p.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	p.mu.Lock()
+	p.inFlight--
+	p.mu.Unlock()
+	return fmt.Sprintf("summary of %d bytes", len(text)), nil
+}
+
+// Name returns the provider name
+func (p *chunkProvider) Name() string {
+	return "chunk"
+}
+
+// TestAISummarizerChunkedSummarization tests that text over the input limit
+// is summarized in bounded concurrent chunks whose summaries are summarized
+// again
+func TestAISummarizerChunkedSummarization(t *testing.T) {
+	provider := &chunkProvider{}
+	summarizer := NewAISummarizer(&AISummarizerConfig{
+		MaxInputLength:   100,
+		ChunkConcurrency: 2,
+	})
+	summarizer.provider = provider
+	summarizer.providerInitialized = true
+
+	var paragraphs []string
+	for i := 0; i < 10; i++ {
+		paragraphs = append(paragraphs, fmt.Sprintf("Paragraph %d explains one part of the design in some detail.", i))
+	}
+	text := strings.Join(paragraphs, "\n\n")
+
+	summary, err := summarizer.Summarize(context.Background(), text)
+	if err != nil {
+		t.Fatalf("Summarize() error = %v", err)
+	}
+
+	// Ten paragraphs, then three chunks of their 208 bytes of summaries,
+	// then the final reduction
+	if len(provider.inputs) != 14 {
+		t.Fatalf("Expected 14 provider calls, got %d", len(provider.inputs))
+	}
+	for _, input := range provider.inputs {
+		if len(input) > 100 {
+			t.Errorf("Expected inputs of at most 100 bytes, got %d: %q", len(input), input)
+		}
+	}
+	reduced := provider.inputs[len(provider.inputs)-1]
+	if !strings.HasPrefix(reduced, "summary of ") {
+		t.Errorf("Expected the last call to summarize the chunk summaries, got %q", reduced)
+	}
+	if want := fmt.Sprintf("summary of %d bytes", len(reduced)); summary != want {
+		t.Errorf("Expected summary %q, got %q", want, summary)
+	}
+	if provider.maxOverlap > 2 {
+		t.Errorf("Expected at most 2 chunks at once, got %d", provider.maxOverlap)
+	}
+
+	// Short text goes to the provider whole
+	provider.inputs = nil
+	if _, err := summarizer.Summarize(context.Background(), "Short text."); err != nil {
+		t.Fatalf("Summarize() error = %v", err)
+	}
+	if len(provider.inputs) != 1 || provider.inputs[0] != "Short text." {
+		t.Errorf("Expected short text in a single call, got %q", provider.inputs)
+	}
+}
+
+// echoProvider is a providers.LLMProvider whose summaries are as long as
+// the text, recording each text it is sent
+type echoProvider struct {
+	mu     sync.Mutex
+	inputs []string
+}
+
+// Summarize records text and returns it unchanged
+func (p *echoProvider) Summarize(ctx context.Context, text string, maxLength int) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inputs = append(p.inputs, text)
+	return text, nil
+}
+
+// Name returns the provider name
+func (p *echoProvider) Name() string {
+	return "echo"
+}
+
+// TestAISummarizerChunkedSummariesThatDoNotShrink tests that summaries
+// which do not get shorter are truncated rather than sent over the limit
+func TestAISummarizerChunkedSummariesThatDoNotShrink(t *testing.T) {
+	provider := &echoProvider{}
+	summarizer := NewAISummarizer(&AISummarizerConfig{MaxInputLength: 100})
+	summarizer.provider = provider
+	summarizer.providerInitialized = true
+
+	text := strings.Repeat("Every sentence of this text survives summarization. ", 10)
+	if _, err := summarizer.Summarize(context.Background(), text); err != nil {
+		t.Fatalf("Summarize() error = %v", err)
+	}
+
+	for _, input := range provider.inputs {
+		if len(input) > 100 {
+			t.Errorf("Expected inputs of at most 100 bytes, got %d: %q", len(input), input)
+		}
+	}
+}
+
+// TestAISummarizerChunkedByTokens tests that MaxInputTokens bounds chunks
+// in tokens as counted by the configured tokenizer
+func TestAISummarizerChunkedByTokens(t *testing.T) {
+	provider := &chunkProvider{}
+	summarizer := NewAISummarizer(&AISummarizerConfig{
+		MaxInputLength: 1000,
+		MaxInputTokens: 10,
+		Tokenizer:      tokenizer.Approximate{BytesPerToken: 2},
+	})
+	summarizer.provider = provider
+	summarizer.providerInitialized = true
+
+	text := strings.Repeat("Short words fit. ", 4)
+	if _, err := summarizer.Summarize(context.Background(), text); err != nil {
+		t.Fatalf("Summarize() error = %v", err)
+	}
+
+	if len(provider.inputs) < 3 {
+		t.Fatalf("Expected %d bytes to be chunked under 10 tokens, got %q", len(text), provider.inputs)
+	}
+	for _, input := range provider.inputs {
+		if tokens := (tokenizer.Approximate{BytesPerToken: 2}).Count(input); tokens > 10 {
+			t.Errorf("Expected inputs of at most 10 tokens, got %d: %q", tokens, input)
+		}
+	}
+}
+
+// TestSplitChunks tests that chunks stay within the limit, prefer natural
+// boundaries and never split a rune
+func TestSplitChunks(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{
+			name:  "fits",
+			text:  "One chunk.",
+			limit: 20,
+			want:  []string{"One chunk."},
+		},
+		{
+			name:  "paragraphs",
+			text:  "First paragraph.\n\nSecond paragraph.",
+			limit: 20,
+			want:  []string{"First paragraph.", "Second paragraph."},
+		},
+		{
+			name:  "words",
+			text:  "alpha beta gamma delta",
+			limit: 12,
+			want:  []string{"alpha beta", "gamma delta"},
+		},
+		{
+			name:  "runes",
+			text:  "ééééé",
+			limit: 3,
+			want:  []string{"é", "é", "é", "é", "é"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitChunks(tt.text, chunkLimit{bytes: tt.limit})
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("splitChunks() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// modelProvider is a countingProvider that reports its model
+type modelProvider struct {
+	countingProvider
+	model string
+}
+
+// Model returns the model ID
+func (p *modelProvider) Model() string {
+	return p.model
+}
+
+// TestAISummarizerMonthlyBudget checks that usage is priced per provider
+// and model, and that summaries fall back to the basic summarizer once the
+// month's cost reaches the budget
+func TestAISummarizerMonthlyBudget(t *testing.T) {
+	provider := &modelProvider{countingProvider: countingProvider{summary: "A summary"}, model: "test-model"}
+	s := NewAISummarizer(&AISummarizerConfig{
+		Pricing:       map[string]ModelPrice{"test-model": {Input: 1e6, Output: 1e6}},
+		MonthlyBudget: 10,
+	})
+	s.provider = provider
+	s.providerInitialized = true
+
+	// 16 bytes in and 9 out are 4 and 3 tokens, costing a dollar each
+	if _, err := s.Summarize(context.Background(), "sixteen bytes!!!"); err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+	usage := s.Usage()["counting/test-model"]
+	if usage.InputTokens != 4 || usage.OutputTokens != 3 || usage.CostUSD != 7 {
+		t.Fatalf("Expected 4 input tokens, 3 output tokens and $7, got %+v", usage)
+	}
+	if s.OverBudget() {
+		t.Fatal("Expected to be under budget at $7 of $10")
+	}
+
+	if _, err := s.Summarize(context.Background(), "another sixteen!"); err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+	if spent, budget := s.MonthSpend(); spent != 14 || budget != 10 {
+		t.Fatalf("Expected $14 of $10 spent, got $%v of $%v", spent, budget)
+	}
+
+	// Over budget, the provider is not called
+	summary, err := s.Summarize(context.Background(), "Over budget")
+	if err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+	if summary != "Over budget" || provider.calls.Load() != 2 {
+		t.Errorf("Expected a basic summary without a provider call, got %q after %d calls", summary, provider.calls.Load())
+	}
+
+	report, err := CreateHealthReport(s)
+	if err != nil {
+		t.Fatalf("CreateHealthReport failed: %v", err)
+	}
+	if report.Components["budget"] != string(StatusDegraded) || report.MonthSpendUSD != 14 {
+		t.Errorf("Expected a degraded budget at $14, got %q at $%v", report.Components["budget"], report.MonthSpendUSD)
+	}
+
+	// A new month starts with nothing spent
+	s.costs.now = func() time.Time { return time.Now().AddDate(0, 1, 0) }
+	if s.OverBudget() {
+		t.Error("Expected the budget to reset in a new month")
+	}
+}
+
+// concurrencyProvider records the most calls it has had in flight at once
+type concurrencyProvider struct {
+	inFlight atomic.Int32
+	max      atomic.Int32
+}
+
+// Summarize holds the call briefly so concurrent calls overlap
+func (p *concurrencyProvider) Summarize(ctx context.Context, text string, maxLength int) (string, error) {
+	n := p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+	for {
+		max := p.max.Load()
+		if n <= max || p.max.CompareAndSwap(max, n) {
+			break
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	return "Summary of " + text, nil
+}
+
+// Name returns the provider name
+func (p *concurrencyProvider) Name() string {
+	return "concurrency"
+}
+
+// TestAISummarizerMaxConcurrency checks that a burst of calls never has
+// more than MaxConcurrency provider requests in flight
+func TestAISummarizerMaxConcurrency(t *testing.T) {
+	provider := &concurrencyProvider{}
+	s := NewAISummarizer(&AISummarizerConfig{MaxConcurrency: 2})
+	s.provider = provider
+	s.providerInitialized = true
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := s.Summarize(context.Background(), fmt.Sprintf("text %d", i)); err != nil {
+				t.Errorf("Summarize failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := provider.max.Load(); got != 2 {
+		t.Errorf("Expected at most 2 requests in flight, got %d", got)
+	}
+	if got := s.metrics.GetGauge(telemetry.MetricQueueDepth); got != 0 {
+		t.Errorf("Expected an empty queue afterwards, got depth %v", got)
+	}
+	if s.metrics.GetTimerAverage(telemetry.MetricQueueWaitTime) == 0 {
+		t.Error("Expected queued requests to record their wait")
+	}
+}
+
+// latencyProvider answers after a delay, or fails
+type latencyProvider struct {
+	name  string
+	delay time.Duration
+	fail  atomic.Bool
+	calls atomic.Int32
+}
+
+// Summarize answers after the delay, unless ctx is done first
+func (p *latencyProvider) Summarize(ctx context.Context, text string, maxLength int) (string, error) {
+	p.calls.Add(1)
+	select {
+	case <-time.After(p.delay):
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	if p.fail.Load() {
+		return "", errors.New("mock summarization error")
+	}
+	return p.name + " summary", nil
+}
+
+// Name returns the provider name
+func (p *latencyProvider) Name() string {
+	return p.name
+}
+
+// TestAISummarizerLatencyRouting checks that latency routing measures each
+// provider, then prefers the fastest healthy one
+func TestAISummarizerLatencyRouting(t *testing.T) {
+	slow := &latencyProvider{name: "slow", delay: 30 * time.Millisecond}
+	fast := &latencyProvider{name: "fast"}
+	s := NewAISummarizer(&AISummarizerConfig{
+		Routing:         RoutingLatency,
+		RoutingInterval: time.Minute,
+		MaxRetries:      1,
+		RetryDelay:      time.Millisecond,
+	})
+	s.provider = slow
+	s.fallbackProviders = []providers.LLMProvider{fast}
+	s.providerInitialized = true
+
+	now := time.Now()
+	s.router.now = func() time.Time { return now }
+	summarize := func(text string) string {
+		now = now.Add(time.Minute)
+		summary, err := s.Summarize(context.Background(), text)
+		if err != nil {
+			t.Fatalf("Summarize failed: %v", err)
+		}
+		return summary
+	}
+
+	// Neither is measured, so the configured order holds; then the
+	// unmeasured fallback is tried; then the faster one wins
+	for i, want := range []string{"slow summary", "fast summary", "fast summary"} {
+		if got := summarize(fmt.Sprintf("text %d", i)); got != want {
+			t.Errorf("Call %d: expected %q, got %q", i, want, got)
+		}
+	}
+
+	// Once the fast provider fails half its calls, it is tried last
+	fast.fail.Store(true)
+	for i := 3; i < 5; i++ {
+		if got := summarize(fmt.Sprintf("text %d", i)); got != "slow summary" {
+			t.Errorf("Call %d: expected the slow provider to answer, got %q", i, got)
+		}
+	}
+	calls := fast.calls.Load()
+	if got := summarize("text 5"); got != "slow summary" || fast.calls.Load() != calls {
+		t.Errorf("Expected the failing provider to be skipped, got %q", got)
+	}
+	if got := s.metrics.GetCounter(telemetry.MetricRouterSwitches); got != 2 {
+		t.Errorf("Expected 2 switches, got %d", got)
+	}
+}
+
+// TestAISummarizerHedging checks that a slow primary is raced against the
+// first fallback, and that the abandoned request is not a failure
+func TestAISummarizerHedging(t *testing.T) {
+	primary := &latencyProvider{name: "primary", delay: time.Second}
+	fallback := &latencyProvider{name: "fallback"}
+	s := NewAISummarizer(&AISummarizerConfig{HedgeDelay: 20 * time.Millisecond})
+	s.provider = primary
+	s.fallbackProviders = []providers.LLMProvider{fallback}
+	s.providerInitialized = true
+
+	start := time.Now()
+	summary, err := s.Summarize(context.Background(), "Slow text")
+	if err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+	if summary != "fallback summary" || time.Since(start) >= primary.delay {
+		t.Errorf("Expected the hedged fallback to answer first, got %q after %v", summary, time.Since(start))
+	}
+	if hedged, wins := s.metrics.GetCounter(telemetry.MetricHedgedRequests), s.metrics.GetCounter(telemetry.MetricHedgeWins); hedged != 1 || wins != 1 {
+		t.Errorf("Expected 1 hedged request won by the fallback, got %d and %d wins", hedged, wins)
+	}
+
+	// The canceled primary is not counted as a failure
+	time.Sleep(20 * time.Millisecond)
+	if got := s.metrics.GetCounter(telemetry.MetricAPICallsFailure); got != 0 {
+		t.Errorf("Expected no failures, got %d", got)
+	}
+
+	// A primary answering within the delay is not hedged
+	primary.delay = 0
+	if summary, err := s.Summarize(context.Background(), "Fast text"); err != nil || summary != "primary summary" {
+		t.Errorf("Expected the primary's summary, got %q, %v", summary, err)
+	}
+	if got := s.metrics.GetCounter(telemetry.MetricHedgedRequests); got != 1 {
+		t.Errorf("Expected no further hedged requests, got %d", got)
+	}
+}
+
+// TestAISummarizerCancellation checks that a canceled call stops waiting
+// for the provider and tries neither the fallbacks nor the basic summarizer
+func TestAISummarizerCancellation(t *testing.T) {
+	primary := &latencyProvider{name: "primary", delay: time.Second}
+	fallback := &latencyProvider{name: "fallback"}
+	s := NewAISummarizer(&AISummarizerConfig{MaxRetries: 3, RetryDelay: time.Second})
+	s.provider = primary
+	s.fallbackProviders = []providers.LLMProvider{fallback}
+	s.providerInitialized = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	summary, err := s.Summarize(ctx, "Slow text")
+	if !errors.Is(err, ErrContextCanceled) || summary != "" {
+		t.Errorf("Expected ErrContextCanceled, got %q, %v", summary, err)
+	}
+	if elapsed := time.Since(start); elapsed >= primary.delay {
+		t.Errorf("Expected the call to stop at the deadline, took %v", elapsed)
+	}
+	if primary.calls.Load() != 1 || fallback.calls.Load() != 0 {
+		t.Errorf("Expected one primary call and no fallback, got %d and %d", primary.calls.Load(), fallback.calls.Load())
+	}
+	if got := s.metrics.GetCounter(telemetry.MetricAPICallsFailure); got != 0 {
+		t.Errorf("Expected the canceled call not to count as a failure, got %d", got)
+	}
+}
+
+// TestAISummarizerLoad checks that provider health in the load report
+// follows consecutive failures without calling the providers
+func TestAISummarizerLoad(t *testing.T) {
+	failing := &latencyProvider{name: "failing"}
+	failing.fail.Store(true)
+	working := &latencyProvider{name: "working"}
+	s := NewAISummarizer(&AISummarizerConfig{
+		MaxConcurrency: 4,
+		MaxRetries:     1,
+		RetryDelay:     time.Millisecond,
+	})
+	s.provider = failing
+	s.fallbackProviders = []providers.LLMProvider{working}
+	s.providerInitialized = true
+
+	load := s.Load()
+	if load.MaxConcurrency != 4 || load.Providers["failing"] != StatusHealthy {
+		t.Errorf("Expected healthy providers before any call, got %+v", load)
+	}
+
+	for i, want := range []HealthStatus{StatusDegraded, StatusDegraded, StatusUnhealthy} {
+		if _, err := s.Summarize(context.Background(), fmt.Sprintf("text %d", i)); err != nil {
+			t.Fatalf("Summarize failed: %v", err)
+		}
+		if got := s.Load().Providers["failing"]; got != want {
+			t.Errorf("After %d failures: expected %s, got %s", i+1, want, got)
+		}
+	}
+
+	calls := failing.calls.Load()
+	load = s.Load()
+	if failing.calls.Load() != calls {
+		t.Error("Expected Load not to call the providers")
+	}
+	if load.Providers["working"] != StatusHealthy || load.QueueDepth != 0 || load.ActiveRequests != 0 {
+		t.Errorf("Expected an idle queue and a healthy fallback, got %+v", load)
+	}
+}
@@ -1,7 +1,9 @@
 package summarizer
 
 import (
+	"context"
 	"strings"
+	"unicode/utf8"
 )
 
 // BasicSummarizer is a simple implementation of the Summarizer interface.
@@ -27,18 +29,29 @@ func (s *BasicSummarizer) Initialize() error {
 
 // Summarize takes a text input and returns a condensed summary.
 // This basic implementation simply truncates the text to a specified length
-// and attempts to end at a sentence boundary.
-func (s *BasicSummarizer) Summarize(text string) (string, error) {
-	if len(text) <= s.maxSummaryLen {
+// and attempts to end at a sentence boundary. It runs locally, so ctx is
+// not used.
+func (s *BasicSummarizer) Summarize(ctx context.Context, text string) (string, error) {
+	return s.SummarizeWithLength(ctx, text, 0)
+}
+
+// SummarizeWithLength summarizes text like Summarize in at most maxLength
+// characters instead of the configured length. A maxLength of 0 uses the
+// configured length.
+func (s *BasicSummarizer) SummarizeWithLength(_ context.Context, text string, maxLength int) (string, error) {
+	if maxLength <= 0 {
+		maxLength = s.maxSummaryLen
+	}
+	if len(text) <= maxLength {
 		return text, nil
 	}
 
 	// Calculate actual truncation length to leave room for ellipsis if needed
 	ellipsis := "..."
-	truncateLen := s.maxSummaryLen
+	truncateLen := maxLength
 
 	// Try to find a sentence boundary near the max length
-	truncated := text[:truncateLen]
+	truncated := text[:runeBoundary(text, truncateLen)]
 
 	// Look for common sentence terminators
 	lastPeriod := strings.LastIndex(truncated, ".")
@@ -55,13 +68,13 @@ func (s *BasicSummarizer) Summarize(text string) (string, error) {
 
 	// If no sentence boundary found, find the last space
 	// Adjust truncation length to leave room for ellipsis
-	truncateLen = s.maxSummaryLen - len(ellipsis)
+	truncateLen = maxLength - len(ellipsis)
 	if truncateLen < 0 {
-		truncateLen = 0 // Edge case for very small maxSummaryLen
+		truncateLen = 0 // Edge case for very small maxLength
 	}
 
 	if truncateLen < len(text) {
-		truncated = text[:truncateLen]
+		truncated = text[:runeBoundary(text, truncateLen)]
 	}
 
 	lastSpace := strings.LastIndex(truncated, " ")
@@ -71,7 +84,7 @@ func (s *BasicSummarizer) Summarize(text string) (string, error) {
 	}
 
 	// If no good boundary found, just truncate and add ellipsis
-	// Ensure that truncateLen + len(ellipsis) doesn't exceed maxSummaryLen
+	// Ensure that truncateLen + len(ellipsis) doesn't exceed maxLength
 	return truncated + ellipsis, nil
 }
 
@@ -82,3 +95,12 @@ func max(a, b int) int {
 	}
 	return b
 }
+
+// runeBoundary moves n back to the start of the rune containing it, so
+// slicing text[:n] never splits a multi-byte UTF-8 character.
+func runeBoundary(text string, n int) int {
+	for n > 0 && n < len(text) && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return n
+}
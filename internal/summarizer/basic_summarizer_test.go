@@ -1,6 +1,7 @@
 package summarizer
 
 import (
+	"context"
 	"strings"
 	"testing"
 )
@@ -90,12 +91,18 @@ func TestBasicSummarizer_Summarize(t *testing.T) {
 			maxSummaryLen: 10,
 			wantContains:  "...",
 		},
+		{
+			name:          "multibyte text is not split mid-character",
+			text:          "ééééééééééé",
+			maxSummaryLen: 10,
+			want:          "ééé...",
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			summarizer := NewBasicSummarizer(test.maxSummaryLen)
-			got, err := summarizer.Summarize(test.text)
+			got, err := summarizer.Summarize(context.Background(), test.text)
 
 			if err != nil {
 				t.Errorf("Summarize() error = %v, want nil", err)
@@ -117,3 +124,24 @@ func TestBasicSummarizer_Summarize(t *testing.T) {
 		})
 	}
 }
+
+func TestBasicSummarizer_SummarizeWithLength(t *testing.T) {
+	summarizer := NewBasicSummarizer(100)
+	text := "First sentence here. Second sentence follows. " + strings.Repeat("word ", 30)
+
+	summary, err := summarizer.SummarizeWithLength(context.Background(), text, 30)
+	if err != nil {
+		t.Fatalf("SummarizeWithLength() error = %v", err)
+	}
+	if summary != "First sentence here." {
+		t.Errorf("SummarizeWithLength() = %q, want the first sentence", summary)
+	}
+
+	summary, err = summarizer.SummarizeWithLength(context.Background(), text, 0)
+	if err != nil {
+		t.Fatalf("SummarizeWithLength() error = %v", err)
+	}
+	if len(summary) <= 30 || len(summary) > 100 {
+		t.Errorf("SummarizeWithLength() with 0 = %q, want the configured length", summary)
+	}
+}
@@ -0,0 +1,132 @@
+package summarizer
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/localrivet/projectmemory/internal/summarizer/providers"
+	"github.com/localrivet/projectmemory/internal/telemetry"
+	"github.com/localrivet/projectmemory/internal/tokenizer"
+)
+
+// chunkSeparators are tried in order when looking for the end of a chunk,
+// so chunks break between paragraphs, then lines, then sentences, then words
+var chunkSeparators = []string{"\n\n", "\n", ". ", " "}
+
+// chunkLimit bounds the text sent to a provider at once: at most bytes
+// bytes and, if tokens is positive, at most tokens tokens as counted by
+// tokenizer
+type chunkLimit struct {
+	bytes     int
+	tokens    int
+	tokenizer tokenizer.Tokenizer
+}
+
+// exceededBy reports whether text is over the limit
+func (l chunkLimit) exceededBy(text string) bool {
+	return len(text) > l.bytes || (l.tokens > 0 && l.tokenizer.Count(text) > l.tokens)
+}
+
+// prefix returns the length of the longest prefix of text within the
+// limit, ending on a rune boundary
+func (l chunkLimit) prefix(text string) int {
+	end := len(text)
+	if end > l.bytes {
+		end = runeBoundary(text, l.bytes)
+	}
+	if l.tokens > 0 {
+		end = tokenizer.Prefix(l.tokenizer, text[:end], l.tokens)
+	}
+	return end
+}
+
+// inputLimit returns the longest text every provider in the chain accepts
+// at once, in bytes and, if MaxInputTokens is set, in tokens as counted for
+// every provider in the chain.
+func (s *AISummarizer) inputLimit(primary providers.LLMProvider, fallbacks []providers.LLMProvider) chunkLimit {
+	limit := chunkLimit{bytes: s.config.MaxInputLength, tokens: s.config.MaxInputTokens}
+	if limit.bytes <= 0 {
+		limit.bytes = providers.DefaultMaxInputLength
+	}
+	chain := append([]providers.LLMProvider{primary}, fallbacks...)
+	tokenizers := make([]tokenizer.Tokenizer, len(chain))
+	for i, provider := range chain {
+		if limiter, ok := provider.(providers.InputLimiter); ok && limiter.InputLimit() < limit.bytes {
+			limit.bytes = limiter.InputLimit()
+		}
+		tokenizers[i] = s.tokenizerFor(provider)
+	}
+	limit.tokenizer = tokenizer.Max(tokenizers...)
+	return limit
+}
+
+// tokenizerFor returns the tokenizer counting provider's tokens: the
+// configured one, or an approximation for the provider's models
+func (s *AISummarizer) tokenizerFor(provider providers.LLMProvider) tokenizer.Tokenizer {
+	if s.config.Tokenizer != nil {
+		return s.config.Tokenizer
+	}
+	return tokenizer.ForProvider(provider.Name())
+}
+
+// summarizeChunks summarizes text over limit by summarizing chunks within
+// it, up to chunkConcurrency at a time, and then
+// summarizing their concatenated summaries. Summaries still longer than
+// limit are reduced again the same way while that shortens them, and are
+// otherwise truncated to limit, so no provider is sent more than it accepts.
+// The generation reports what wrote the final reduction.
+func (s *AISummarizer) summarizeChunks(ctx context.Context, text string, maxLength int, limit chunkLimit, primary providers.LLMProvider, fallbacks []providers.LLMProvider) (string, Generation, error) {
+	chunks := splitChunks(text, limit)
+	s.metrics.IncrementCounter(telemetry.MetricChunkedInputs, 1)
+	s.metrics.IncrementCounter(telemetry.MetricChunks, int64(len(chunks)))
+
+	summaries, err := summarizePool(chunks, s.chunkConcurrency, func(chunk string) (string, error) {
+		// Chunk titles would clutter the final reduction
+		summary, generation, err := s.summarizeWithFallbacks(ctx, chunk, maxLength, primary, fallbacks)
+		return parseSummary(summary, generation).Text, err
+	})
+	if err != nil {
+		return "", Generation{}, err
+	}
+
+	// Reduce again while the summaries are too long, as long as each round
+	// actually shortens them
+	combined := strings.Join(summaries, "\n\n")
+	if limit.exceededBy(combined) && len(combined) < len(text) {
+		return s.summarizeChunks(ctx, combined, maxLength, limit, primary, fallbacks)
+	}
+	if limit.exceededBy(combined) {
+		combined = strings.TrimSpace(combined[:limit.prefix(combined)])
+	}
+	return s.summarizeWithFallbacks(ctx, combined, maxLength, primary, fallbacks)
+}
+
+// splitChunks splits text into chunks within limit. A chunk ends at the
+// last paragraph, line, sentence or word boundary in the second half of the
+// longest prefix within the limit, or otherwise at the last whole rune.
+func splitChunks(text string, limit chunkLimit) []string {
+	var chunks []string
+	for limit.exceededBy(text) {
+		end := limit.prefix(text)
+		for _, separator := range chunkSeparators {
+			if i := strings.LastIndex(text[:end], separator); i >= end/2 {
+				end = i + len(separator)
+				break
+			}
+		}
+		if end == 0 {
+			// limit is shorter than the first rune
+			_, end = utf8.DecodeRuneInString(text)
+		}
+
+		if chunk := strings.TrimSpace(text[:end]); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		text = text[end:]
+	}
+	if chunk := strings.TrimSpace(text); chunk != "" {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
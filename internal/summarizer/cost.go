@@ -0,0 +1,169 @@
+package summarizer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/summarizer/providers"
+	"github.com/localrivet/projectmemory/internal/telemetry"
+)
+
+// ModelPrice is the price of a model in US dollars per million tokens
+type ModelPrice struct {
+	Input  float64
+	Output float64
+}
+
+// DefaultPricing holds the list prices of the models the providers request
+// when no model is configured. Usage of a model missing from the pricing is
+// counted in tokens but costs nothing.
+var DefaultPricing = map[string]ModelPrice{
+	"claude-3-haiku-20240307": {Input: 0.25, Output: 1.25},
+	"gpt-3.5-turbo":           {Input: 0.50, Output: 1.50},
+	"gemini-pro":              {Input: 0.50, Output: 1.50},
+	"grok-1":                  {Input: 5.00, Output: 15.00},
+}
+
+// ModelUsage is the estimated usage and cost of one provider and model
+type ModelUsage struct {
+	InputTokens  int64   `json:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+	CostUSD      float64 `json:"cost_usd"`
+}
+
+// costTracker prices provider calls and keeps the spend of the current
+// calendar month, in UTC, against a monthly budget
+type costTracker struct {
+	pricing map[string]ModelPrice
+	budget  float64
+	month   time.Time
+	spent   float64
+	now     func() time.Time
+	mu      sync.Mutex
+}
+
+// newCostTracker creates a tracker pricing models from DefaultPricing, with
+// pricing taking precedence. A budget of 0 is unlimited.
+func newCostTracker(pricing map[string]ModelPrice, budget float64) *costTracker {
+	merged := make(map[string]ModelPrice, len(DefaultPricing)+len(pricing))
+	for model, price := range DefaultPricing {
+		merged[model] = price
+	}
+	for model, price := range pricing {
+		merged[model] = price
+	}
+	return &costTracker{pricing: merged, budget: budget, now: time.Now}
+}
+
+// currentMonth returns the start of the month of now, in UTC
+func currentMonth(now time.Time) time.Time {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// add records cost against the current month and returns the month's
+// spend so far
+func (c *costTracker) add(cost float64) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rollover()
+	c.spent += cost
+	return c.spent
+}
+
+// monthSpend returns the spend of the current month and the budget
+func (c *costTracker) monthSpend() (float64, float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rollover()
+	return c.spent, c.budget
+}
+
+// setBudget replaces the monthly budget
+func (c *costTracker) setBudget(budget float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.budget = budget
+}
+
+// overBudget reports whether the current month's spend has reached a
+// budget
+func (c *costTracker) overBudget() bool {
+	spent, budget := c.monthSpend()
+	return budget > 0 && spent >= budget
+}
+
+// rollover starts a new month's spend once the month changes. The caller
+// holds mu.
+func (c *costTracker) rollover() {
+	if month := currentMonth(c.now()); !month.Equal(c.month) {
+		c.month = month
+		c.spent = 0
+	}
+}
+
+// usageKey returns the provider and model a call was made to, as
+// "provider/model", and the model. The model is left out if the provider
+// does not report one.
+func usageKey(provider providers.LLMProvider) (string, string) {
+	namer, ok := provider.(providers.ModelNamer)
+	if !ok {
+		return provider.Name(), ""
+	}
+	return provider.Name() + "/" + namer.Model(), namer.Model()
+}
+
+// recordUsage records the estimated tokens and cost of summarizing text
+// into summary with provider. Tokens are counted by the provider's
+// tokenizer, since providers are not asked for their token counts.
+func (s *AISummarizer) recordUsage(provider providers.LLMProvider, text, summary string) {
+	key, model := usageKey(provider)
+	tok := s.tokenizerFor(provider)
+	inputTokens := int64(tok.Count(text))
+	outputTokens := int64(tok.Count(summary))
+	s.metrics.IncrementCounter(telemetry.MetricTokensInputPrefix+key, inputTokens)
+	s.metrics.IncrementCounter(telemetry.MetricTokensOutputPrefix+key, outputTokens)
+
+	price := s.costs.pricing[model]
+	cost := (float64(inputTokens)*price.Input + float64(outputTokens)*price.Output) / 1e6
+	s.metrics.AddToGauge(telemetry.MetricCostPrefix+key, cost)
+	s.metrics.SetGauge(telemetry.MetricMonthSpend, s.costs.add(cost))
+}
+
+// Usage returns the estimated usage and cost since the metrics were last
+// reset, keyed by "provider/model"
+func (s *AISummarizer) Usage() map[string]ModelUsage {
+	usage := make(map[string]ModelUsage)
+	for key, tokens := range s.metrics.GetCountersWithPrefix(telemetry.MetricTokensInputPrefix) {
+		u := usage[key]
+		u.InputTokens = tokens
+		usage[key] = u
+	}
+	for key, tokens := range s.metrics.GetCountersWithPrefix(telemetry.MetricTokensOutputPrefix) {
+		u := usage[key]
+		u.OutputTokens = tokens
+		usage[key] = u
+	}
+	for key, cost := range s.metrics.GetGaugesWithPrefix(telemetry.MetricCostPrefix) {
+		u := usage[key]
+		u.CostUSD = cost
+		usage[key] = u
+	}
+	return usage
+}
+
+// MonthSpend returns the estimated cost of the current calendar month and
+// the monthly budget, 0 if unlimited
+func (s *AISummarizer) MonthSpend() (spent, budget float64) {
+	return s.costs.monthSpend()
+}
+
+// OverBudget reports whether the current month's estimated cost has reached
+// the monthly budget. Over budget, summaries are written by the basic
+// summarizer without calling a provider.
+func (s *AISummarizer) OverBudget() bool {
+	return s.costs.overBudget()
+}
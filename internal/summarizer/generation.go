@@ -0,0 +1,76 @@
+package summarizer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/localrivet/projectmemory/internal/summarizer/providers"
+)
+
+// Kinds of summarizer reported in a Generation
+const (
+	// GeneratedByAI marks summaries written by an LLM provider.
+	GeneratedByAI = "ai"
+
+	// GeneratedByBasic marks summaries written by the basic summarizer,
+	// including those an AI summarizer fell back to.
+	GeneratedByBasic = "basic"
+
+	// GeneratedVerbatim marks text the caller kept as it was after
+	// ErrContentFiltered.
+	GeneratedVerbatim = "verbatim"
+
+	// GeneratedShort marks text the caller kept as it was because it was
+	// too short to be worth summarizing.
+	GeneratedShort = "short"
+)
+
+// DefaultPromptVersion is the PromptVersion of AI summaries written with
+// the providers' default prompt template.
+const DefaultPromptVersion = "default"
+
+// Generation describes what wrote a summary.
+type Generation struct {
+	// Summarizer is GeneratedByAI or GeneratedByBasic, or what the
+	// caller stored instead of a summary.
+	Summarizer string
+
+	// Provider and Model name the LLM provider and model of an AI summary.
+	// Model is empty if the provider does not report it.
+	Provider string
+	Model    string
+
+	// PromptVersion identifies the prompt template of an AI summary:
+	// DefaultPromptVersion, or a hash of a custom template.
+	PromptVersion string
+}
+
+// SummarizeWithGeneration summarizes text like SummarizeWithLength and
+// reports the summary as written by the basic summarizer.
+func (s *BasicSummarizer) SummarizeWithGeneration(ctx context.Context, text string, maxLength int) (string, Generation, error) {
+	summary, err := s.SummarizeWithLength(ctx, text, maxLength)
+	return summary, Generation{Summarizer: GeneratedByBasic}, err
+}
+
+// promptVersion returns the PromptVersion of summaries written with a
+// prompt template, empty for the default one
+func promptVersion(template string) string {
+	if template == "" {
+		return DefaultPromptVersion
+	}
+	hash := sha256.Sum256([]byte(template))
+	return "sha256:" + hex.EncodeToString(hash[:6])
+}
+
+// providerGeneration returns the generation of a summary written by
+// provider
+func (s *AISummarizer) providerGeneration(provider providers.LLMProvider) Generation {
+	_, model := usageKey(provider)
+	return Generation{
+		Summarizer:    GeneratedByAI,
+		Provider:      provider.Name(),
+		Model:         model,
+		PromptVersion: promptVersion(s.config.PromptTemplate),
+	}
+}
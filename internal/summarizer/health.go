@@ -33,6 +33,17 @@ type HealthReport struct {
 	SuccessRate   float64            `json:"success_rate"`
 	TotalRequests int64              `json:"total_requests"`
 	Version       string             `json:"version"`
+
+	// ProvidersCheckedAt is when the providers were last probed
+	ProvidersCheckedAt time.Time `json:"providers_checked_at"`
+
+	// Usage is the estimated usage and cost per "provider/model"
+	Usage map[string]ModelUsage `json:"usage"`
+
+	// MonthSpendUSD is the estimated cost of the current calendar month,
+	// and MonthlyBudgetUSD its budget, 0 if unlimited
+	MonthSpendUSD    float64 `json:"month_spend_usd"`
+	MonthlyBudgetUSD float64 `json:"monthly_budget_usd"`
 }
 
 // CreateHealthReport generates a health report for the AI summarizer
@@ -46,8 +57,8 @@ func CreateHealthReport(summarizer *AISummarizer) (*HealthReport, error) {
 		return nil, fmt.Errorf("metrics collector is nil")
 	}
 
-	// Check provider health
-	providerHealth := summarizer.CheckProviderHealth()
+	// Check provider health, or use the last background probe
+	providerHealth, checkedAt := summarizer.providerHealth()
 
 	// Determine overall status
 	status := StatusHealthy
@@ -95,6 +106,16 @@ func CreateHealthReport(summarizer *AISummarizer) (*HealthReport, error) {
 		"cache":     string(StatusHealthy),
 		"primary":   string(StatusUnhealthy),
 		"fallbacks": string(StatusUnhealthy),
+		"budget":    string(StatusHealthy),
+	}
+
+	// Over budget, every summary is a basic one
+	monthSpend, monthlyBudget := summarizer.MonthSpend()
+	if summarizer.OverBudget() {
+		components["budget"] = string(StatusDegraded)
+		if status == StatusHealthy {
+			status = StatusDegraded
+		}
 	}
 
 	// Update component status based on provider health
@@ -116,6 +137,12 @@ func CreateHealthReport(summarizer *AISummarizer) (*HealthReport, error) {
 		SuccessRate:   successRate,
 		TotalRequests: totalRequests,
 		Version:       "1.0.0", // Replace with actual version from your build system
+
+		ProvidersCheckedAt: checkedAt,
+
+		Usage:            summarizer.Usage(),
+		MonthSpendUSD:    monthSpend,
+		MonthlyBudgetUSD: monthlyBudget,
 	}, nil
 }
 
@@ -148,3 +175,9 @@ func ResetMetrics(summarizer *AISummarizer) error {
 	m.Reset()
 	return nil
 }
+
+// HealthReport returns the current health, checking the providers unless
+// a background probe has done so recently
+func (s *AISummarizer) HealthReport() (*HealthReport, error) {
+	return CreateHealthReport(s)
+}
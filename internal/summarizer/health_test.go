@@ -152,3 +152,56 @@ func TestProviderHealthCheck(t *testing.T) {
 		t.Errorf("Expected openai provider to be unhealthy")
 	}
 }
+
+// TestHealthReportUsesBackgroundProbe checks that health reports reuse a
+// fresh probe instead of calling the providers, and that failed probes count
+// towards a provider's load health
+func TestHealthReportUsesBackgroundProbe(t *testing.T) {
+	primary := &latencyProvider{name: providers.ProviderAnthropic}
+	fallback := &latencyProvider{name: providers.ProviderOpenAI}
+	fallback.fail.Store(true)
+
+	summarizer := NewAISummarizer(&AISummarizerConfig{HealthProbeInterval: time.Minute})
+	summarizer.provider = primary
+	summarizer.fallbackProviders = []providers.LLMProvider{fallback}
+	summarizer.providerInitialized = true
+
+	// Without a probe yet, the report checks the providers itself
+	report, err := summarizer.HealthReport()
+	if err != nil {
+		t.Fatalf("HealthReport failed: %v", err)
+	}
+	if primary.calls.Load() != 1 || report.Status != StatusDegraded || report.ProvidersCheckedAt.IsZero() {
+		t.Fatalf("Expected one probe and a degraded report, got %d calls, %+v", primary.calls.Load(), report)
+	}
+
+	// A fresh probe is reused without calling the providers
+	for i := 0; i < loadUnhealthyFailures-1; i++ {
+		summarizer.CheckProviderHealth()
+	}
+	calls := primary.calls.Load()
+	report, err = summarizer.HealthReport()
+	if err != nil {
+		t.Fatalf("HealthReport failed: %v", err)
+	}
+	if primary.calls.Load() != calls {
+		t.Errorf("Expected the report to reuse the last probe, got %d provider calls", primary.calls.Load()-calls)
+	}
+	if report.Providers[providers.ProviderOpenAI] {
+		t.Error("Expected the failing fallback to be reported unhealthy")
+	}
+
+	// Failed probes count towards the provider's load health
+	if health := summarizer.Load().Providers[providers.ProviderOpenAI]; health != StatusUnhealthy {
+		t.Errorf("Expected the fallback unhealthy after %d failed probes, got %s", loadUnhealthyFailures, health)
+	}
+
+	// A stale probe is replaced
+	summarizer.probes.store(map[string]bool{}, time.Now().Add(-healthProbeStaleIntervals*time.Minute-time.Second))
+	if _, err := summarizer.HealthReport(); err != nil {
+		t.Fatalf("HealthReport failed: %v", err)
+	}
+	if primary.calls.Load() != calls+1 {
+		t.Errorf("Expected a stale probe to be replaced, got %d provider calls", primary.calls.Load()-calls)
+	}
+}
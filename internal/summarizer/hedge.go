@@ -0,0 +1,73 @@
+package summarizer
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/summarizer/providers"
+	"github.com/localrivet/projectmemory/internal/telemetry"
+)
+
+// hedgeResult is the outcome of one side of a hedged request
+type hedgeResult struct {
+	summary string
+	err     error
+	hedged  bool
+}
+
+// summarizeHedged summarizes text with primary and, once primary has not
+// answered within the hedge delay or has failed, with hedge as well. The
+// first summary wins and is returned with the provider that wrote it, and
+// the other request is canceled. If both fail, the error of the last to
+// fail is returned.
+func (s *AISummarizer) summarizeHedged(parent context.Context, text string, maxLength int, primary, hedge providers.LLMProvider) (string, providers.LLMProvider, error) {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	// Both sides can finish after the winner, so neither blocks on send
+	results := make(chan hedgeResult, 2)
+	call := func(provider providers.LLMProvider, hedged bool) {
+		summary, err := s.callProvider(ctx, provider, text, maxLength)
+		results <- hedgeResult{summary: summary, err: err, hedged: hedged}
+	}
+	go call(primary, false)
+
+	timer := time.NewTimer(s.hedgeDelay)
+	defer timer.Stop()
+
+	pending, hedging := 1, false
+	startHedge := func() {
+		if !hedging {
+			hedging = true
+			pending++
+			s.metrics.IncrementCounter(telemetry.MetricHedgedRequests, 1)
+			go call(hedge, true)
+		}
+	}
+
+	var lastErr error
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			startHedge()
+		case result := <-results:
+			pending--
+			if result.err == nil {
+				if result.hedged {
+					s.metrics.IncrementCounter(telemetry.MetricHedgeWins, 1)
+					return result.summary, hedge, nil
+				}
+				return result.summary, primary, nil
+			}
+			// A refusal outranks other failures, so it is not hidden by one
+			if lastErr == nil || !errors.Is(lastErr, ErrContentFiltered) {
+				lastErr = result.err
+			}
+
+			// A primary failing before the delay is hedged right away
+			startHedge()
+		}
+	}
+	return "", nil, lastErr
+}
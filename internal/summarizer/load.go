@@ -0,0 +1,105 @@
+package summarizer
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// loadWindow is how long a provider call counts towards its health in
+	// a load report
+	loadWindow = 5 * time.Minute
+
+	// loadUnhealthyFailures is the number of consecutive failed calls after
+	// which a provider is reported unhealthy
+	loadUnhealthyFailures = 3
+)
+
+// Load is the current load of a summarizer, built from its own bookkeeping
+// without calling any provider
+type Load struct {
+	// QueueDepth is the number of provider requests waiting for a slot
+	QueueDepth int
+
+	// ActiveRequests is the number of provider requests in flight, and
+	// MaxConcurrency the most allowed at once
+	ActiveRequests int
+	MaxConcurrency int
+
+	// Providers maps each configured provider to its health, judged by its
+	// recent calls. A provider without recent calls is healthy.
+	Providers map[string]HealthStatus
+
+	// OverBudget is true once the monthly budget is spent and summaries
+	// fall back to the basic summarizer
+	OverBudget bool
+}
+
+// callOutcome is the most recent call to a provider
+type callOutcome struct {
+	at       time.Time
+	failures int
+}
+
+// callLog tracks the consecutive failures of each provider
+type callLog struct {
+	outcomes map[string]callOutcome
+	now      func() time.Time
+	mu       sync.Mutex
+}
+
+// newCallLog creates an empty callLog
+func newCallLog() *callLog {
+	return &callLog{outcomes: make(map[string]callOutcome), now: time.Now}
+}
+
+// observe records the outcome of a call to the named provider
+func (l *callLog) observe(name string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	outcome := callOutcome{at: l.now()}
+	if err != nil {
+		outcome.failures = l.outcomes[name].failures + 1
+	}
+	l.outcomes[name] = outcome
+}
+
+// health returns the health of the named provider
+func (l *callLog) health(name string) HealthStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	outcome, ok := l.outcomes[name]
+	switch {
+	case !ok || outcome.failures == 0 || l.now().Sub(outcome.at) > loadWindow:
+		return StatusHealthy
+	case outcome.failures >= loadUnhealthyFailures:
+		return StatusUnhealthy
+	default:
+		return StatusDegraded
+	}
+}
+
+// Load returns the current load of the summarizer
+func (s *AISummarizer) Load() Load {
+	s.mu.RLock()
+	chain := s.fallbackProviders
+	if s.provider != nil {
+		chain = append(chain[:0:0], s.provider)
+		chain = append(chain, s.fallbackProviders...)
+	}
+	s.mu.RUnlock()
+
+	load := Load{
+		QueueDepth:     s.queue.depth(),
+		ActiveRequests: s.queue.active(),
+		MaxConcurrency: cap(s.queue.slots),
+		Providers:      make(map[string]HealthStatus, len(chain)),
+		OverBudget:     s.costs.overBudget(),
+	}
+	for _, provider := range chain {
+		load.Providers[provider.Name()] = s.calls.health(provider.Name())
+	}
+	return load
+}
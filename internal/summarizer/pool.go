@@ -0,0 +1,35 @@
+package summarizer
+
+import "sync"
+
+// summarizePool calls summarize on each text, at most concurrency at a time,
+// and returns the summaries in the order of texts. Once every call has
+// returned, it returns the error of the first text that failed, if any.
+func summarizePool(texts []string, concurrency int, summarize func(text string) (string, error)) ([]string, error) {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	summaries := make([]string, len(texts))
+	errs := make([]error, len(texts))
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, text := range texts {
+		wg.Add(1)
+		go func(i int, text string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			summaries[i], errs[i] = summarize(text)
+		}(i, text)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return summaries, nil
+}
@@ -0,0 +1,59 @@
+package summarizer
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestSummarizePool tests that the pool keeps the order of its texts, never
+// runs more than its concurrency at once and reports the first failure
+func TestSummarizePool(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxOverlap := 0, 0
+	summarize := func(text string) (string, error) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxOverlap {
+			maxOverlap = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		if text == "bad" || text == "worse" {
+			return "", errors.New(text)
+		}
+		return "summary of " + text, nil
+	}
+
+	texts := make([]string, 8)
+	for i := range texts {
+		texts[i] = fmt.Sprintf("chunk %d", i)
+	}
+	summaries, err := summarizePool(texts, 3, summarize)
+	if err != nil {
+		t.Fatalf("summarizePool() error = %v", err)
+	}
+	for i, summary := range summaries {
+		if want := "summary of " + texts[i]; summary != want {
+			t.Errorf("Expected summary %d to be %q, got %q", i, want, summary)
+		}
+	}
+	if maxOverlap > 3 {
+		t.Errorf("Expected at most 3 calls at once, got %d", maxOverlap)
+	}
+
+	maxOverlap = 0
+	if _, err := summarizePool([]string{"a", "bad", "worse"}, 0, summarize); err == nil || err.Error() != "bad" {
+		t.Errorf("Expected the first failure, got %v", err)
+	}
+	if maxOverlap != 1 {
+		t.Errorf("Expected a concurrency of 0 to run one call at a time, got %d", maxOverlap)
+	}
+}
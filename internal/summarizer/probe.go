@@ -0,0 +1,132 @@
+package summarizer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/summarizer/providers"
+	"github.com/localrivet/projectmemory/internal/telemetry"
+)
+
+const (
+	// healthProbeTimeout bounds the probe of each provider
+	healthProbeTimeout = 5 * time.Second
+
+	// healthProbeText is the text each provider is asked to summarize
+	healthProbeText = "This is a brief health check for the LLM provider."
+
+	// healthProbeStaleIntervals is how many probe intervals the last probe
+	// stays fresh for, so one slow or missed probe does not send health
+	// reports back to the providers
+	healthProbeStaleIntervals = 2
+)
+
+// probeResults holds the provider health found by the most recent probe
+type probeResults struct {
+	health    map[string]bool
+	checkedAt time.Time
+	mu        sync.RWMutex
+}
+
+// store replaces the results with health, found at checkedAt
+func (p *probeResults) store(health map[string]bool, checkedAt time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.health = health
+	p.checkedAt = checkedAt
+}
+
+// fresh returns a copy of the most recent results and when they were found,
+// or false if there are none younger than maxAge
+func (p *probeResults) fresh(now time.Time, maxAge time.Duration) (map[string]bool, time.Time, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.health == nil || now.Sub(p.checkedAt) > maxAge {
+		return nil, time.Time{}, false
+	}
+	health := make(map[string]bool, len(p.health))
+	for name, healthy := range p.health {
+		health[name] = healthy
+	}
+	return health, p.checkedAt, true
+}
+
+// HealthProbeInterval returns how often the providers should be probed in
+// the background, 0 if they are only checked when a health report is made.
+func (s *AISummarizer) HealthProbeInterval() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.healthProbeInterval
+}
+
+// CheckProviderHealth sends each provider a short summarization request and
+// returns whether each one answered. The results are kept for health
+// reports, and count towards each provider's health in Load and its rank in
+// latency routing.
+func (s *AISummarizer) CheckProviderHealth() map[string]bool {
+	results := make(map[string]bool)
+
+	// First, ensure the AISummarizer is initialized
+	if err := s.Initialize(); err != nil {
+		return results
+	}
+
+	s.mu.RLock()
+	chain := s.fallbackProviders
+	if s.provider != nil {
+		chain = append(chain[:0:0], s.provider)
+		chain = append(chain, s.fallbackProviders...)
+	}
+	s.mu.RUnlock()
+
+	for _, provider := range chain {
+		if _, alreadyChecked := results[provider.Name()]; alreadyChecked {
+			continue
+		}
+		results[provider.Name()] = s.probeProvider(provider)
+	}
+
+	s.probes.store(results, time.Now())
+	return results
+}
+
+// probeProvider sends provider a short summarization request, records the
+// outcome and reports whether it answered
+func (s *AISummarizer) probeProvider(provider providers.LLMProvider) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), healthProbeTimeout)
+	start := time.Now()
+	_, err := provider.Summarize(ctx, healthProbeText, 50)
+	latency := time.Since(start)
+	cancel()
+
+	s.calls.observe(provider.Name(), err)
+	s.router.observe(provider.Name(), latency, err)
+
+	healthy := err == nil
+	switch provider.Name() {
+	case providers.ProviderAnthropic:
+		s.metrics.SetGauge(telemetry.MetricProviderHealthAnthropic, boolToFloat64(healthy))
+	case providers.ProviderOpenAI:
+		s.metrics.SetGauge(telemetry.MetricProviderHealthOpenAI, boolToFloat64(healthy))
+	case providers.ProviderGoogle:
+		s.metrics.SetGauge(telemetry.MetricProviderHealthGoogle, boolToFloat64(healthy))
+	case providers.ProviderXAI:
+		s.metrics.SetGauge(telemetry.MetricProviderHealthXAI, boolToFloat64(healthy))
+	}
+	return healthy
+}
+
+// providerHealth returns the health of each provider for a health report
+// and when it was checked. With background probing, the last probe is used
+// while it is fresh; otherwise the providers are checked now.
+func (s *AISummarizer) providerHealth() (map[string]bool, time.Time) {
+	if interval := s.HealthProbeInterval(); interval > 0 {
+		if health, checkedAt, ok := s.probes.fresh(time.Now(), healthProbeStaleIntervals*interval); ok {
+			return health, checkedAt
+		}
+	}
+	return s.CheckProviderHealth(), time.Now()
+}
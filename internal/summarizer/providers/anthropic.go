@@ -38,7 +38,8 @@ type AnthropicResponse struct {
 	Content []struct {
 		Text string `json:"text"`
 	} `json:"content"`
-	Error *struct {
+	StopReason string `json:"stop_reason"`
+	Error      *struct {
 		Type    string `json:"type"`
 		Message string `json:"message"`
 	} `json:"error,omitempty"`
@@ -49,7 +50,8 @@ func NewAnthropicProvider(config Config) *AnthropicProvider {
 	return &AnthropicProvider{
 		Config: config,
 		httpClient: &http.Client{
-			Timeout: DefaultTimeout,
+			Timeout:   DefaultTimeout,
+			Transport: config.transport(),
 		},
 		version: "2023-06-01", // API version, can be made configurable
 	}
@@ -60,28 +62,52 @@ func (p *AnthropicProvider) Name() string {
 	return ProviderAnthropic
 }
 
+// Model returns the configured model, or Claude 3 Haiku if none is configured
+func (p *AnthropicProvider) Model() string {
+	if p.ModelID == "" {
+		return "claude-3-haiku-20240307"
+	}
+	return p.ModelID
+}
+
+// CloseIdleConnections closes connections to the API left open by earlier
+// requests. Later requests open new ones.
+func (p *AnthropicProvider) CloseIdleConnections() {
+	p.httpClient.CloseIdleConnections()
+}
+
 // Summarize implements the LLMProvider interface for Anthropic
 func (p *AnthropicProvider) Summarize(ctx context.Context, text string, maxLength int) (string, error) {
+	prompt, err := p.RenderPrompt(text, maxLength)
+	if err != nil {
+		return "", err
+	}
+
+	summary, err := p.Complete(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	if len(summary) > maxLength {
+		summary = summary[:maxLength]
+	}
+	return summary, nil
+}
+
+// Complete implements the Completer interface for Anthropic
+func (p *AnthropicProvider) Complete(ctx context.Context, prompt string) (string, error) {
 	if p.APIKey == "" {
 		return "", fmt.Errorf("Anthropic API key not provided")
 	}
 
-	// Default to Claude 3 Haiku if no model specified
-	model := p.ModelID
-	if model == "" {
-		model = "claude-3-haiku-20240307"
-	}
+	model := p.Model()
 
 	// Create the API request
 	reqBody := AnthropicRequest{
 		Model: model,
 		Messages: []AnthropicMessage{
 			{
-				Role: "user",
-				Content: fmt.Sprintf(
-					"Summarize the following text in a concise way, keeping the most important points. "+
-						"The summary should be no more than %d characters:\n\n%s",
-					maxLength, text),
+				Role:    "user",
+				Content: prompt,
 			},
 		},
 		MaxTokens: 1024, // Reasonable default, can be made configurable
@@ -133,15 +159,15 @@ func (p *AnthropicProvider) Summarize(ctx context.Context, text string, maxLengt
 			anthResponse.Error.Type, anthResponse.Error.Message)
 	}
 
-	// Extract summary
-	if len(anthResponse.Content) == 0 || anthResponse.Content[0].Text == "" {
-		return "", fmt.Errorf("empty response from Anthropic API")
+	// A refusal's text explains the refusal rather than summarizing
+	if anthResponse.StopReason == "refusal" {
+		return "", refused("Anthropic", anthResponse.StopReason)
 	}
 
-	summary := anthResponse.Content[0].Text
-	if len(summary) > maxLength {
-		summary = summary[:maxLength]
+	// Extract the answer
+	if len(anthResponse.Content) == 0 || anthResponse.Content[0].Text == "" {
+		return "", fmt.Errorf("empty response from Anthropic API")
 	}
 
-	return summary, nil
+	return anthResponse.Content[0].Text, nil
 }
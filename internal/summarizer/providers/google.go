@@ -47,7 +47,11 @@ type GoogleResponse struct {
 				Text string `json:"text"`
 			} `json:"parts"`
 		} `json:"content"`
+		FinishReason string `json:"finishReason"`
 	} `json:"candidates"`
+	PromptFeedback *struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback,omitempty"`
 	Error *struct {
 		Code    int    `json:"code"`
 		Message string `json:"message"`
@@ -55,12 +59,22 @@ type GoogleResponse struct {
 	} `json:"error,omitempty"`
 }
 
+// googleFilteredReasons are the finish reasons of candidates withheld by
+// Google's safety filters
+var googleFilteredReasons = map[string]bool{
+	"SAFETY":             true,
+	"BLOCKLIST":          true,
+	"PROHIBITED_CONTENT": true,
+	"SPII":               true,
+}
+
 // NewGoogleProvider creates a new instance of the Google provider
 func NewGoogleProvider(config Config) *GoogleProvider {
 	return &GoogleProvider{
 		Config: config,
 		httpClient: &http.Client{
-			Timeout: DefaultTimeout,
+			Timeout:   DefaultTimeout,
+			Transport: config.transport(),
 		},
 	}
 }
@@ -70,17 +84,44 @@ func (p *GoogleProvider) Name() string {
 	return ProviderGoogle
 }
 
+// Model returns the configured model, or Gemini Pro if none is configured
+func (p *GoogleProvider) Model() string {
+	if p.ModelID == "" {
+		return "gemini-pro"
+	}
+	return p.ModelID
+}
+
+// CloseIdleConnections closes connections to the API left open by earlier
+// requests. Later requests open new ones.
+func (p *GoogleProvider) CloseIdleConnections() {
+	p.httpClient.CloseIdleConnections()
+}
+
 // Summarize implements the LLMProvider interface for Google
 func (p *GoogleProvider) Summarize(ctx context.Context, text string, maxLength int) (string, error) {
+	prompt, err := p.RenderPrompt(text, maxLength)
+	if err != nil {
+		return "", err
+	}
+
+	summary, err := p.Complete(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	if len(summary) > maxLength {
+		summary = summary[:maxLength]
+	}
+	return summary, nil
+}
+
+// Complete implements the Completer interface for Google
+func (p *GoogleProvider) Complete(ctx context.Context, prompt string) (string, error) {
 	if p.APIKey == "" {
 		return "", fmt.Errorf("Google API key not provided")
 	}
 
-	// Default to Gemini Pro if no model specified
-	model := p.ModelID
-	if model == "" {
-		model = "gemini-pro"
-	}
+	model := p.Model()
 
 	// Create the API request
 	reqBody := GoogleRequest{
@@ -95,10 +136,7 @@ func (p *GoogleProvider) Summarize(ctx context.Context, text string, maxLength i
 					Text string `json:"text"`
 				}{
 					{
-						Text: fmt.Sprintf(
-							"Summarize the following text in a concise way, keeping the most important points. "+
-								"The summary should be no more than %d characters:\n\n%s",
-							maxLength, text),
+						Text: prompt,
 					},
 				},
 				Role: "user",
@@ -156,17 +194,20 @@ func (p *GoogleProvider) Summarize(ctx context.Context, text string, maxLength i
 			googleResponse.Error.Status, googleResponse.Error.Message)
 	}
 
-	// Extract summary
+	// A blocked prompt gets no candidates, and a blocked candidate no text
+	if googleResponse.PromptFeedback != nil && googleResponse.PromptFeedback.BlockReason != "" {
+		return "", refused("Google", googleResponse.PromptFeedback.BlockReason)
+	}
+	if len(googleResponse.Candidates) > 0 && googleFilteredReasons[googleResponse.Candidates[0].FinishReason] {
+		return "", refused("Google", googleResponse.Candidates[0].FinishReason)
+	}
+
+	// Extract the answer
 	if len(googleResponse.Candidates) == 0 ||
 		len(googleResponse.Candidates[0].Content.Parts) == 0 ||
 		googleResponse.Candidates[0].Content.Parts[0].Text == "" {
 		return "", fmt.Errorf("empty response from Google API")
 	}
 
-	summary := googleResponse.Candidates[0].Content.Parts[0].Text
-	if len(summary) > maxLength {
-		summary = summary[:maxLength]
-	}
-
-	return summary, nil
+	return googleResponse.Candidates[0].Content.Parts[0].Text, nil
 }
@@ -0,0 +1,189 @@
+package providers
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// KeyRotationRoundRobin sends each request with the next API key in turn
+	KeyRotationRoundRobin = "round-robin"
+
+	// KeyRotationFailover keeps using one API key until it is rate limited
+	KeyRotationFailover = "failover"
+
+	// defaultKeyCooldown is how long a rate-limited key is passed over when
+	// the response does not say when to retry
+	defaultKeyCooldown = time.Minute
+)
+
+// EnvAPIKey returns the API key of the named provider from its usual
+// environment variable, such as ANTHROPIC_API_KEY, or "" if it is unset or
+// the provider is unknown.
+func EnvAPIKey(providerName string) string {
+	switch providerName {
+	case ProviderAnthropic:
+		return os.Getenv("ANTHROPIC_API_KEY")
+	case ProviderOpenAI:
+		return os.Getenv("OPENAI_API_KEY")
+	case ProviderGoogle:
+		return os.Getenv("GOOGLE_API_KEY")
+	case ProviderXAI:
+		return os.Getenv("XAI_API_KEY")
+	default:
+		return ""
+	}
+}
+
+// keys returns APIKey followed by the APIKeys not already listed
+func (c Config) keys() []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, key := range append([]string{c.APIKey}, c.APIKeys...) {
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// transport returns the transport a provider sends its requests with. With
+// more than one API key, it rotates among them.
+func (c Config) transport() http.RoundTripper {
+	keys := c.keys()
+	if len(keys) < 2 {
+		return c.Transport
+	}
+	next := c.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &keyRotator{
+		keys:     keys,
+		rotation: c.KeyRotation,
+		next:     next,
+		cooling:  make([]time.Time, len(keys)),
+		now:      time.Now,
+	}
+}
+
+// keyRotator is an http.RoundTripper that sends each request with one of
+// several API keys. Providers put the first key in their requests; the
+// rotator swaps it for the chosen one wherever it appears in the headers
+// or query. A key answered with 429 Too Many Requests cools down until the
+// response's Retry-After, and the request is retried with the next key.
+type keyRotator struct {
+	keys     []string
+	rotation string
+	next     http.RoundTripper
+
+	mu      sync.Mutex
+	current int
+	cooling []time.Time
+	now     func() time.Time
+}
+
+// RoundTrip sends req with the next usable key
+func (r *keyRotator) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		index := r.pick()
+		keyed, err := r.withKey(req, r.keys[index], attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := r.next.RoundTrip(keyed)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+			return resp, err
+		}
+		r.coolDown(index, resp.Header.Get("Retry-After"))
+
+		// Retry once per key, and only if the body can be sent again
+		if attempt+1 >= len(r.keys) || (req.Body != nil && req.GetBody == nil) {
+			return resp, nil
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
+
+// pick returns the index of the key to send the next request with. Keys
+// cooling down are passed over unless every key is.
+func (r *keyRotator) pick() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	index := r.current
+	for i := range r.keys {
+		candidate := (r.current + i) % len(r.keys)
+		if !now.Before(r.cooling[candidate]) {
+			index = candidate
+			break
+		}
+	}
+
+	if r.rotation == KeyRotationFailover {
+		r.current = index
+	} else {
+		r.current = (index + 1) % len(r.keys)
+	}
+	return index
+}
+
+// coolDown passes over the key at index until retryAfter, a Retry-After
+// header value in seconds, or for defaultKeyCooldown
+func (r *keyRotator) coolDown(index int, retryAfter string) {
+	cooldown := defaultKeyCooldown
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		cooldown = time.Duration(seconds) * time.Second
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cooling[index] = r.now().Add(cooldown)
+	if r.current == index {
+		r.current = (index + 1) % len(r.keys)
+	}
+}
+
+// withKey returns a copy of req sent with key in place of the first key.
+// Retries get a fresh copy of the body.
+func (r *keyRotator) withKey(req *http.Request, key string, attempt int) (*http.Request, error) {
+	keyed := req.Clone(req.Context())
+	if attempt > 0 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		keyed.Body = body
+	}
+
+	primary := r.keys[0]
+	if key == primary {
+		return keyed, nil
+	}
+	for name, values := range keyed.Header {
+		for i, value := range values {
+			keyed.Header[name][i] = strings.ReplaceAll(value, primary, key)
+		}
+	}
+	if query := keyed.URL.Query(); len(query) > 0 {
+		for name, values := range query {
+			for i, value := range values {
+				if value == primary {
+					query[name][i] = key
+				}
+			}
+		}
+		keyed.URL.RawQuery = query.Encode()
+	}
+	return keyed, nil
+}
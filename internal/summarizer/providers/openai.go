@@ -37,20 +37,31 @@ type OpenAIResponse struct {
 	Choices []struct {
 		Message struct {
 			Content string `json:"content"`
+			Refusal string `json:"refusal"`
 		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
 	Error *struct {
 		Message string `json:"message"`
 		Type    string `json:"type"`
+		Code    string `json:"code"`
 	} `json:"error,omitempty"`
 }
 
+// filteredErrorCodes are the error codes of OpenAI-compatible APIs for
+// requests rejected by their content filters
+var filteredErrorCodes = map[string]bool{
+	"content_filter":           true,
+	"content_policy_violation": true,
+}
+
 // NewOpenAIProvider creates a new instance of the OpenAI provider
 func NewOpenAIProvider(config Config) *OpenAIProvider {
 	return &OpenAIProvider{
 		Config: config,
 		httpClient: &http.Client{
-			Timeout: DefaultTimeout,
+			Timeout:   DefaultTimeout,
+			Transport: config.transport(),
 		},
 	}
 }
@@ -60,34 +71,59 @@ func (p *OpenAIProvider) Name() string {
 	return ProviderOpenAI
 }
 
+// Model returns the configured model, or GPT-3.5-turbo if none is configured
+func (p *OpenAIProvider) Model() string {
+	if p.ModelID == "" {
+		return "gpt-3.5-turbo"
+	}
+	return p.ModelID
+}
+
+// CloseIdleConnections closes connections to the API left open by earlier
+// requests. Later requests open new ones.
+func (p *OpenAIProvider) CloseIdleConnections() {
+	p.httpClient.CloseIdleConnections()
+}
+
 // Summarize implements the LLMProvider interface for OpenAI
 func (p *OpenAIProvider) Summarize(ctx context.Context, text string, maxLength int) (string, error) {
+	prompt, err := p.RenderPrompt(text, maxLength)
+	if err != nil {
+		return "", err
+	}
+
+	summary, err := p.complete(ctx, "You are a precise summarizer that creates concise summaries of text.", prompt)
+	if err != nil {
+		return "", err
+	}
+	if len(summary) > maxLength {
+		summary = summary[:maxLength]
+	}
+	return summary, nil
+}
+
+// Complete implements the Completer interface for OpenAI
+func (p *OpenAIProvider) Complete(ctx context.Context, prompt string) (string, error) {
+	return p.complete(ctx, "", prompt)
+}
+
+// complete sends prompt to the OpenAI API and returns its answer
+func (p *OpenAIProvider) complete(ctx context.Context, system, prompt string) (string, error) {
 	if p.APIKey == "" {
 		return "", fmt.Errorf("OpenAI API key not provided")
 	}
 
-	// Default to GPT-3.5-turbo if no model specified
-	model := p.ModelID
-	if model == "" {
-		model = "gpt-3.5-turbo"
-	}
+	model := p.Model()
 
-	// Create the API request
+	// Create the API request, after the system prompt if there is one
+	var messages []OpenAIMessage
+	if system != "" {
+		messages = append(messages, OpenAIMessage{Role: "system", Content: system})
+	}
+	messages = append(messages, OpenAIMessage{Role: "user", Content: prompt})
 	reqBody := OpenAIRequest{
-		Model: model,
-		Messages: []OpenAIMessage{
-			{
-				Role:    "system",
-				Content: "You are a precise summarizer that creates concise summaries of text.",
-			},
-			{
-				Role: "user",
-				Content: fmt.Sprintf(
-					"Summarize the following text in a concise way, keeping the most important points. "+
-						"The summary should be no more than %d characters:\n\n%s",
-					maxLength, text),
-			},
-		},
+		Model:     model,
+		Messages:  messages,
 		MaxTokens: 1024, // Reasonable default, can be made configurable
 	}
 
@@ -131,20 +167,29 @@ func (p *OpenAIProvider) Summarize(ctx context.Context, text string, maxLength i
 	}
 
 	// Check for API error
+	if openaiResponse.Error != nil && filteredErrorCodes[openaiResponse.Error.Code] {
+		return "", refused("OpenAI", openaiResponse.Error.Message)
+	}
 	if openaiResponse.Error != nil {
 		return "", fmt.Errorf("OpenAI API error: %s: %s",
 			openaiResponse.Error.Type, openaiResponse.Error.Message)
 	}
 
-	// Extract summary
-	if len(openaiResponse.Choices) == 0 || openaiResponse.Choices[0].Message.Content == "" {
-		return "", fmt.Errorf("empty response from OpenAI API")
+	// A refusal or filtered completion is not an answer
+	if len(openaiResponse.Choices) > 0 {
+		choice := openaiResponse.Choices[0]
+		if choice.Message.Refusal != "" {
+			return "", refused("OpenAI", choice.Message.Refusal)
+		}
+		if choice.FinishReason == "content_filter" {
+			return "", refused("OpenAI", choice.FinishReason)
+		}
 	}
 
-	summary := openaiResponse.Choices[0].Message.Content
-	if len(summary) > maxLength {
-		summary = summary[:maxLength]
+	// Extract the answer
+	if len(openaiResponse.Choices) == 0 || openaiResponse.Choices[0].Message.Content == "" {
+		return "", fmt.Errorf("empty response from OpenAI API")
 	}
 
-	return summary, nil
+	return openaiResponse.Choices[0].Message.Content, nil
 }
@@ -0,0 +1,68 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// DefaultPromptTemplate is the summarization prompt used when no template
+// is configured. It asks for a one-line title on a first line starting with
+// "Title:", followed by the summary.
+const DefaultPromptTemplate = "Summarize the following text in a concise way, keeping the most important points. " +
+	"The summary should be no more than {{.MaxLength}} characters. " +
+	"Start your answer with a line of the form \"Title: <title>\" giving a title of at most 80 characters, " +
+	"then write the summary on the following lines:\n\n{{.Text}}"
+
+// ErrPromptMissingText is returned for a prompt template that never includes
+// the text to summarize.
+var ErrPromptMissingText = errors.New("prompt template does not include {{.Text}}")
+
+// defaultPrompt is DefaultPromptTemplate, parsed once
+var defaultPrompt = template.Must(template.New("prompt").Parse(DefaultPromptTemplate))
+
+// PromptData is what prompt templates are executed with
+type PromptData struct {
+	// Text is the text to summarize
+	Text string
+
+	// MaxLength is the maximum summary length in characters
+	MaxLength int
+}
+
+// ParsePromptTemplate parses a Go text/template for summarization prompts.
+// It fails if the template does not execute or leaves out the text.
+func ParsePromptTemplate(text string) (*template.Template, error) {
+	prompt, err := template.New("prompt").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prompt template: %w", err)
+	}
+
+	// A template that drops the text would summarize nothing
+	const probe = "\x00projectmemory-prompt-probe\x00"
+	var b strings.Builder
+	if err := prompt.Execute(&b, PromptData{Text: probe, MaxLength: 1}); err != nil {
+		return nil, fmt.Errorf("invalid prompt template: %w", err)
+	}
+	if !strings.Contains(b.String(), probe) {
+		return nil, ErrPromptMissingText
+	}
+	return prompt, nil
+}
+
+// RenderPrompt returns the prompt asking for a summary of text of at most
+// maxLength characters, from the configured template or
+// DefaultPromptTemplate.
+func (c Config) RenderPrompt(text string, maxLength int) (string, error) {
+	prompt := c.Prompt
+	if prompt == nil {
+		prompt = defaultPrompt
+	}
+
+	var b strings.Builder
+	if err := prompt.Execute(&b, PromptData{Text: text, MaxLength: maxLength}); err != nil {
+		return "", fmt.Errorf("error rendering prompt: %w", err)
+	}
+	return b.String(), nil
+}
@@ -4,6 +4,8 @@ package providers
 
 import (
 	"context"
+	"net/http"
+	"text/template"
 	"time"
 )
 
@@ -28,8 +30,68 @@ type LLMProvider interface {
 	Name() string
 }
 
+// Completer is implemented by providers that answer a prompt as given,
+// without the summarization prompt around it or a length limit, such as
+// the prompt asking an LLM to rerank search results.
+type Completer interface {
+	// Complete returns the model's answer to prompt
+	Complete(ctx context.Context, prompt string) (string, error)
+}
+
+// IdleConnectionCloser is implemented by providers that keep HTTP
+// connections open between requests, like http.Client.
+type IdleConnectionCloser interface {
+	// CloseIdleConnections closes connections not in use by a request
+	CloseIdleConnections()
+}
+
+// InputLimiter is implemented by providers that accept text up to a
+// maximum length. Longer text has to be split before it is summarized.
+type InputLimiter interface {
+	// InputLimit returns the maximum input length in bytes
+	InputLimit() int
+}
+
+// ModelNamer is implemented by providers that report the model they
+// request summaries from, so usage can be priced per model.
+type ModelNamer interface {
+	// Model returns the model ID sent with each request
+	Model() string
+}
+
 // Config holds common configuration for LLM providers
 type Config struct {
 	APIKey  string
 	ModelID string
+
+	// APIKeys are further keys for the same provider, used in turn with
+	// APIKey so a team can spread its quota across them.
+	APIKeys []string
+
+	// KeyRotation is how requests are spread over the keys:
+	// KeyRotationRoundRobin, the default, or KeyRotationFailover. Either
+	// way, a request answered 429 Too Many Requests is retried with the
+	// next key.
+	KeyRotation string
+
+	// Prompt is the summarization prompt template, from
+	// ParsePromptTemplate. nil uses DefaultPromptTemplate.
+	Prompt *template.Template
+
+	// MaxInputLength is the longest text, in bytes, the provider is asked
+	// to summarize at once. 0 uses DefaultMaxInputLength.
+	MaxInputLength int
+
+	// Transport sends the provider's HTTP requests. nil uses
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// InputLimit returns the configured MaxInputLength or
+// DefaultMaxInputLength.
+func (c Config) InputLimit() int {
+	if c.MaxInputLength > 0 {
+		return c.MaxInputLength
+	}
+	return DefaultMaxInputLength
 }
@@ -0,0 +1,17 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrContentFiltered is returned when a provider refuses to summarize a
+// text, or withholds its summary, because of its safety filters. Asking the
+// same provider again gets the same answer, so it is not retried.
+var ErrContentFiltered = errors.New("content filtered by provider")
+
+// refused returns an ErrContentFiltered for the named provider, giving the
+// reason the provider reported
+func refused(provider, reason string) error {
+	return fmt.Errorf("%w: %s: %s", ErrContentFiltered, provider, reason)
+}
@@ -122,3 +122,17 @@ func (p *CapturingProvider) GetCapturedText() string {
 func (p *CapturingProvider) GetCapturedMaxLength() int {
 	return p.capturedMax
 }
+
+// AnswerCompleter is a Completer for testing that answers every prompt with
+// Answer and Err and keeps the last prompt in Prompt
+type AnswerCompleter struct {
+	Answer string
+	Err    error
+	Prompt string
+}
+
+// Complete records prompt and returns the configured answer
+func (c *AnswerCompleter) Complete(_ context.Context, prompt string) (string, error) {
+	c.Prompt = prompt
+	return c.Answer, c.Err
+}
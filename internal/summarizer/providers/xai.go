@@ -37,11 +37,14 @@ type XAIResponse struct {
 	Choices []struct {
 		Message struct {
 			Content string `json:"content"`
+			Refusal string `json:"refusal"`
 		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
 	Error *struct {
 		Message string `json:"message"`
 		Type    string `json:"type"`
+		Code    string `json:"code"`
 	} `json:"error,omitempty"`
 }
 
@@ -50,7 +53,8 @@ func NewXAIProvider(config Config) *XAIProvider {
 	return &XAIProvider{
 		Config: config,
 		httpClient: &http.Client{
-			Timeout: DefaultTimeout,
+			Timeout:   DefaultTimeout,
+			Transport: config.transport(),
 		},
 	}
 }
@@ -60,34 +64,60 @@ func (p *XAIProvider) Name() string {
 	return ProviderXAI
 }
 
+// Model returns the configured model, or Grok-1 if none is configured
+func (p *XAIProvider) Model() string {
+	if p.ModelID == "" {
+		return "grok-1"
+	}
+	return p.ModelID
+}
+
+// CloseIdleConnections closes connections to the API left open by earlier
+// requests. Later requests open new ones.
+func (p *XAIProvider) CloseIdleConnections() {
+	p.httpClient.CloseIdleConnections()
+}
+
 // Summarize implements the LLMProvider interface for X.AI
 func (p *XAIProvider) Summarize(ctx context.Context, text string, maxLength int) (string, error) {
+	prompt, err := p.RenderPrompt(text, maxLength)
+	if err != nil {
+		return "", err
+	}
+
+	summary, err := p.complete(ctx, "You are a precise summarizer that creates concise summaries of text.", prompt)
+	if err != nil {
+		return "", err
+	}
+	if len(summary) > maxLength {
+		summary = summary[:maxLength]
+	}
+	return summary, nil
+}
+
+// Complete implements the Completer interface for X.AI
+func (p *XAIProvider) Complete(ctx context.Context, prompt string) (string, error) {
+	return p.complete(ctx, "", prompt)
+}
+
+// complete sends prompt to the X.AI API and returns its answer
+func (p *XAIProvider) complete(ctx context.Context, system, prompt string) (string, error) {
 	if p.APIKey == "" {
 		return "", fmt.Errorf("X.AI API key not provided")
 	}
 
-	// Default to Grok-1 if no model specified
-	model := p.ModelID
-	if model == "" {
-		model = "grok-1"
-	}
+	model := p.Model()
 
-	// Create the API request (similar to OpenAI format)
+	// Create the API request (similar to OpenAI format), after the system
+	// prompt if there is one
+	var messages []XAIMessage
+	if system != "" {
+		messages = append(messages, XAIMessage{Role: "system", Content: system})
+	}
+	messages = append(messages, XAIMessage{Role: "user", Content: prompt})
 	reqBody := XAIRequest{
-		Model: model,
-		Messages: []XAIMessage{
-			{
-				Role:    "system",
-				Content: "You are a precise summarizer that creates concise summaries of text.",
-			},
-			{
-				Role: "user",
-				Content: fmt.Sprintf(
-					"Summarize the following text in a concise way, keeping the most important points. "+
-						"The summary should be no more than %d characters:\n\n%s",
-					maxLength, text),
-			},
-		},
+		Model:     model,
+		Messages:  messages,
 		MaxTokens: 1024, // Reasonable default, can be made configurable
 	}
 
@@ -131,20 +161,29 @@ func (p *XAIProvider) Summarize(ctx context.Context, text string, maxLength int)
 	}
 
 	// Check for API error
+	if xaiResponse.Error != nil && filteredErrorCodes[xaiResponse.Error.Code] {
+		return "", refused("X.AI", xaiResponse.Error.Message)
+	}
 	if xaiResponse.Error != nil {
 		return "", fmt.Errorf("X.AI API error: %s: %s",
 			xaiResponse.Error.Type, xaiResponse.Error.Message)
 	}
 
-	// Extract summary
-	if len(xaiResponse.Choices) == 0 || xaiResponse.Choices[0].Message.Content == "" {
-		return "", fmt.Errorf("empty response from X.AI API")
+	// A refusal or filtered completion is not an answer
+	if len(xaiResponse.Choices) > 0 {
+		choice := xaiResponse.Choices[0]
+		if choice.Message.Refusal != "" {
+			return "", refused("X.AI", choice.Message.Refusal)
+		}
+		if choice.FinishReason == "content_filter" {
+			return "", refused("X.AI", choice.FinishReason)
+		}
 	}
 
-	summary := xaiResponse.Choices[0].Message.Content
-	if len(summary) > maxLength {
-		summary = summary[:maxLength]
+	// Extract the answer
+	if len(xaiResponse.Choices) == 0 || xaiResponse.Choices[0].Message.Content == "" {
+		return "", fmt.Errorf("empty response from X.AI API")
 	}
 
-	return summary, nil
+	return xaiResponse.Choices[0].Message.Content, nil
 }
@@ -0,0 +1,64 @@
+package summarizer
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/telemetry"
+)
+
+// requestQueue bounds the number of provider requests in flight. Callers
+// beyond the limit wait their turn.
+type requestQueue struct {
+	slots   chan struct{}
+	waiting atomic.Int64
+	metrics *telemetry.MetricsCollector
+}
+
+// newRequestQueue creates a queue allowing limit requests at once
+func newRequestQueue(limit int, metrics *telemetry.MetricsCollector) *requestQueue {
+	return &requestQueue{slots: make(chan struct{}, limit), metrics: metrics}
+}
+
+// acquire waits for a free slot, or returns ErrContextCanceled once ctx is
+// done. Every successful acquire is followed by a release.
+func (q *requestQueue) acquire(ctx context.Context) error {
+	select {
+	case q.slots <- struct{}{}:
+		q.metrics.SetGauge(telemetry.MetricQueueActive, float64(len(q.slots)))
+		return nil
+	default:
+	}
+
+	start := time.Now()
+	q.waiting.Add(1)
+	defer q.waiting.Add(-1)
+	q.metrics.AddToGauge(telemetry.MetricQueueDepth, 1)
+	defer q.metrics.AddToGauge(telemetry.MetricQueueDepth, -1)
+
+	select {
+	case q.slots <- struct{}{}:
+		q.metrics.RecordTimer(telemetry.MetricQueueWaitTime, time.Since(start))
+		q.metrics.SetGauge(telemetry.MetricQueueActive, float64(len(q.slots)))
+		return nil
+	case <-ctx.Done():
+		return ErrContextCanceled
+	}
+}
+
+// release frees the slot taken by acquire
+func (q *requestQueue) release() {
+	<-q.slots
+	q.metrics.SetGauge(telemetry.MetricQueueActive, float64(len(q.slots)))
+}
+
+// depth returns the number of callers waiting for a slot
+func (q *requestQueue) depth() int {
+	return int(q.waiting.Load())
+}
+
+// active returns the number of slots in use
+func (q *requestQueue) active() int {
+	return len(q.slots)
+}
@@ -0,0 +1,167 @@
+package summarizer
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/summarizer/providers"
+	"github.com/localrivet/projectmemory/internal/telemetry"
+)
+
+const (
+	// RoutingStatic tries the primary provider first and the fallbacks in
+	// their configured order
+	RoutingStatic = "static"
+
+	// RoutingLatency tries the currently fastest healthy provider first
+	RoutingLatency = "latency"
+
+	// DefaultRoutingInterval is how often latency routing re-ranks the
+	// providers
+	DefaultRoutingInterval = 30 * time.Second
+
+	// routingWindow is how long a call counts towards a provider's rank
+	routingWindow = 5 * time.Minute
+
+	// routingSamples is the most calls per provider kept for ranking
+	routingSamples = 50
+
+	// routingMaxErrorRate is the error rate at which a provider is only
+	// tried after every other one
+	routingMaxErrorRate = 0.5
+)
+
+// Provider tiers, in the order they are tried. Providers without recent
+// calls come first so every provider's latency gets measured.
+const (
+	tierUnmeasured = iota
+	tierHealthy
+	tierFailing
+)
+
+// routingSample is the outcome of one provider call
+type routingSample struct {
+	at      time.Time
+	latency time.Duration
+	failed  bool
+}
+
+// router orders the provider chain by the recent latency and error rate of
+// each provider, re-ranking at most once per interval
+type router struct {
+	interval time.Duration
+	samples  map[string][]routingSample
+	order    []string
+	ranked   time.Time
+	metrics  *telemetry.MetricsCollector
+	now      func() time.Time
+	mu       sync.Mutex
+}
+
+// newRouter creates a router that re-ranks every interval
+func newRouter(interval time.Duration, metrics *telemetry.MetricsCollector) *router {
+	return &router{
+		interval: interval,
+		samples:  make(map[string][]routingSample),
+		metrics:  metrics,
+		now:      time.Now,
+	}
+}
+
+// observe records the outcome of a call to the named provider
+func (r *router) observe(name string, latency time.Duration, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	samples := append(r.samples[name], routingSample{at: r.now(), latency: latency, failed: err != nil})
+	if len(samples) > routingSamples {
+		samples = samples[len(samples)-routingSamples:]
+	}
+	r.samples[name] = samples
+}
+
+// route returns primary and fallbacks reordered by rank. Providers that
+// rank equally keep their configured order.
+func (r *router) route(primary providers.LLMProvider, fallbacks []providers.LLMProvider) (providers.LLMProvider, []providers.LLMProvider) {
+	if r == nil || primary == nil {
+		return primary, fallbacks
+	}
+	chain := append([]providers.LLMProvider{primary}, fallbacks...)
+
+	r.mu.Lock()
+	if now := r.now(); now.Sub(r.ranked) >= r.interval || len(r.order) != len(chain) {
+		r.rank(chain, now)
+	}
+	position := make(map[string]int, len(r.order))
+	for i, name := range r.order {
+		position[name] = i
+	}
+	r.mu.Unlock()
+
+	sort.SliceStable(chain, func(i, j int) bool {
+		return position[chain[i].Name()] < position[chain[j].Name()]
+	})
+	return chain[0], chain[1:]
+}
+
+// rank orders the providers of chain: providers without recent calls,
+// then healthy providers by latency adjusted for their error rate, then
+// failing providers. The caller holds mu.
+func (r *router) rank(chain []providers.LLMProvider, now time.Time) {
+	type ranking struct {
+		name  string
+		tier  int
+		score float64
+	}
+	rankings := make([]ranking, len(chain))
+	for i, provider := range chain {
+		rankings[i] = ranking{name: provider.Name(), tier: tierUnmeasured}
+
+		var calls, failures int
+		var latency time.Duration
+		for _, sample := range r.samples[provider.Name()] {
+			if now.Sub(sample.at) > routingWindow {
+				continue
+			}
+			calls++
+			if sample.failed {
+				failures++
+			} else {
+				latency += sample.latency
+			}
+		}
+		if calls == 0 {
+			continue
+		}
+
+		errorRate := float64(failures) / float64(calls)
+		if errorRate >= routingMaxErrorRate {
+			rankings[i].tier = tierFailing
+			continue
+		}
+		average := float64(latency) / float64(calls-failures)
+		rankings[i].tier = tierHealthy
+		rankings[i].score = average / (1 - errorRate)
+	}
+
+	sort.SliceStable(rankings, func(i, j int) bool {
+		if rankings[i].tier != rankings[j].tier {
+			return rankings[i].tier < rankings[j].tier
+		}
+		return rankings[i].score < rankings[j].score
+	})
+
+	order := make([]string, len(rankings))
+	for i, ranking := range rankings {
+		order[i] = ranking.name
+	}
+	if len(r.order) > 0 && order[0] != r.order[0] {
+		r.metrics.IncrementCounter(telemetry.MetricRouterSwitches, 1)
+	}
+	r.order = order
+	r.ranked = now
+}
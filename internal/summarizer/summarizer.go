@@ -2,6 +2,11 @@
 // summarizing text content within the ProjectMemory service.
 package summarizer
 
+import (
+	"context"
+	"time"
+)
+
 const (
 	// DefaultMaxSummaryLength defines the default maximum length for summaries.
 	DefaultMaxSummaryLength = 500
@@ -12,9 +17,80 @@ const (
 
 // Summarizer defines the interface for summarizing text content.
 type Summarizer interface {
-	// Summarize takes a text input and returns a condensed summary.
-	Summarize(text string) (string, error)
+	// Summarize takes a text input and returns a condensed summary. Provider
+	// requests are abandoned once ctx is canceled or its deadline passes.
+	Summarize(ctx context.Context, text string) (string, error)
 
 	// Initialize sets up the summarizer with any required configuration.
 	Initialize() error
 }
+
+// LengthSummarizer is implemented by summarizers that can write a summary
+// of a length requested by the caller instead of their configured one.
+type LengthSummarizer interface {
+	// SummarizeWithLength summarizes text like Summarize in at most
+	// maxLength characters. A maxLength of 0 uses the configured length.
+	SummarizeWithLength(ctx context.Context, text string, maxLength int) (string, error)
+}
+
+// GenerationReporter is implemented by summarizers that report what wrote
+// each summary, so stored summaries can be traced to a model and
+// regenerated.
+type GenerationReporter interface {
+	// SummarizeWithGeneration summarizes text like
+	// LengthSummarizer.SummarizeWithLength and reports what wrote the
+	// summary.
+	SummarizeWithGeneration(ctx context.Context, text string, maxLength int) (string, Generation, error)
+}
+
+// TitleSummarizer is implemented by summarizers that write a one-line
+// title with each summary, so listings can show entries compactly.
+type TitleSummarizer interface {
+	// SummarizeWithTitle summarizes text like
+	// GenerationReporter.SummarizeWithGeneration and titles the summary.
+	SummarizeWithTitle(ctx context.Context, text string, maxLength int) (Summary, error)
+}
+
+// IdleReleaser is implemented by summarizers that hold resources worth
+// giving back while the server sits idle, such as open HTTP connections and
+// cached summaries.
+type IdleReleaser interface {
+	// ReleaseIdle releases idle resources. The summarizer stays usable and
+	// reacquires them on demand.
+	ReleaseIdle() error
+}
+
+// CacheShrinker is implemented by summarizers with a cache that can be cut
+// down when the process runs short of memory.
+type CacheShrinker interface {
+	// ShrinkCache drops expired entries and about half of the rest.
+	ShrinkCache()
+}
+
+// HealthReporter is implemented by summarizers that depend on providers
+// whose health can be checked.
+type HealthReporter interface {
+	// HealthReport returns the current health, checking the providers
+	// unless they were probed recently.
+	HealthReport() (*HealthReport, error)
+}
+
+// HealthProber is implemented by summarizers whose providers can be probed
+// in the background, so health reports and routing use recent results
+// without a caller waiting on the providers.
+type HealthProber interface {
+	// HealthProbeInterval returns how often to probe the providers, 0 if
+	// they are only probed on demand.
+	HealthProbeInterval() time.Duration
+
+	// CheckProviderHealth sends each provider a short request and records
+	// whether it answered.
+	CheckProviderHealth() map[string]bool
+}
+
+// LoadReporter is implemented by summarizers that queue provider requests
+// and can report their load without calling the providers.
+type LoadReporter interface {
+	// Load returns the current queue depth and provider health.
+	Load() Load
+}
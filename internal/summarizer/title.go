@@ -0,0 +1,139 @@
+package summarizer
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxTitleLength is the longest title, in characters, kept for a summary
+const MaxTitleLength = 80
+
+// titlePrefix starts the first line of an AI summary, as the default prompt
+// template asks
+const titlePrefix = "title:"
+
+// Summary is a summary with its one-line title and what wrote it
+type Summary struct {
+	Title      string
+	Text       string
+	Generation Generation
+}
+
+// SummarizeWithTitle summarizes text with summarizer in at most maxLength
+// characters, or in its configured length if maxLength is 0, and titles the
+// summary. Summarizers that are not TitleSummarizers get a title derived
+// with Title, and the generation is zero if they are not
+// GenerationReporters either. A maxLength above 0 is ignored by summarizers
+// that are not LengthSummarizers.
+func SummarizeWithTitle(ctx context.Context, summarizer Summarizer, text string, maxLength int) (Summary, error) {
+	if titles, ok := summarizer.(TitleSummarizer); ok {
+		return titles.SummarizeWithTitle(ctx, text, maxLength)
+	}
+
+	var summary string
+	var generation Generation
+	var err error
+	if generations, ok := summarizer.(GenerationReporter); ok {
+		summary, generation, err = generations.SummarizeWithGeneration(ctx, text, maxLength)
+	} else if lengths, ok := summarizer.(LengthSummarizer); ok && maxLength > 0 {
+		summary, err = lengths.SummarizeWithLength(ctx, text, maxLength)
+	} else {
+		summary, err = summarizer.Summarize(ctx, text)
+	}
+	if err != nil {
+		return Summary{}, err
+	}
+	return Summary{Title: Title(summary), Text: summary, Generation: generation}, nil
+}
+
+// SummarizeWithTitle summarizes text like SummarizeWithGeneration, with
+// the first sentence of the summary as its title.
+func (s *BasicSummarizer) SummarizeWithTitle(ctx context.Context, text string, maxLength int) (Summary, error) {
+	summary, generation, err := s.SummarizeWithGeneration(ctx, text, maxLength)
+	if err != nil {
+		return Summary{}, err
+	}
+	return Summary{Title: Title(summary), Text: summary, Generation: generation}, nil
+}
+
+// Title derives a title from a summary that came without one: its first
+// sentence, on one line, shortened to MaxTitleLength characters at a word
+// boundary.
+func Title(summary string) string {
+	line := firstLine(summary)
+	for i, r := range line {
+		if (r == '.' || r == '?' || r == '!') && (i+1 == len(line) || line[i+1] == ' ') {
+			line = line[:i+1]
+			break
+		}
+	}
+	return clampTitle(strings.TrimSuffix(line, "."))
+}
+
+// parseSummary splits the title line off a summary written by generation.
+// Only AI summaries carry one, and only if the prompt asked for it; every
+// other summary gets a title derived from it.
+func parseSummary(raw string, generation Generation) Summary {
+	if generation.Summarizer == GeneratedByAI {
+		if title, text, ok := splitTitle(raw); ok {
+			return Summary{Title: title, Text: text, Generation: generation}
+		}
+	}
+	return Summary{Title: Title(raw), Text: raw, Generation: generation}
+}
+
+// splitTitle splits a provider's answer of the form "Title: ...", followed
+// by the summary on the next lines. Markdown emphasis around the labels and
+// a "Summary:" label are dropped. It reports false if the answer has no
+// title line.
+func splitTitle(raw string) (string, string, bool) {
+	first, rest, _ := strings.Cut(strings.TrimSpace(raw), "\n")
+	label, title, found := strings.Cut(first, ":")
+	if !found || !strings.EqualFold(strings.Trim(label, "*# ")+":", titlePrefix) {
+		return "", "", false
+	}
+	title = clampTitle(strings.Trim(title, "* "))
+	text := strings.TrimSpace(rest)
+	if label, summary, found := strings.Cut(text, ":"); found && strings.EqualFold(strings.Trim(label, "*# "), "summary") {
+		text = strings.TrimSpace(strings.TrimLeft(summary, "*"))
+	}
+	if title == "" || text == "" {
+		return "", "", false
+	}
+	return title, text, true
+}
+
+// firstLine returns the first non-blank line of text with its whitespace
+// collapsed
+func firstLine(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// clampTitle puts title on one line and shortens it to MaxTitleLength
+// characters, at the last word boundary if there is one
+func clampTitle(title string) string {
+	title = firstLine(title)
+	if utf8.RuneCountInString(title) <= MaxTitleLength {
+		return title
+	}
+
+	const ellipsis = "..."
+	cut, runes := 0, 0
+	for i := range title {
+		if runes == MaxTitleLength-len(ellipsis) {
+			cut = i
+			break
+		}
+		runes++
+	}
+	if space := strings.LastIndex(title[:cut], " "); space > 0 {
+		cut = space
+	}
+	return strings.TrimSpace(title[:cut]) + ellipsis
+}
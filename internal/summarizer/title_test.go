@@ -0,0 +1,60 @@
+package summarizer
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTitle(t *testing.T) {
+	long := strings.Repeat("word ", 30)
+	tests := []struct {
+		summary string
+		want    string
+	}{
+		{"The API uses JWT tokens.", "The API uses JWT tokens"},
+		{"The API uses JWT tokens. They expire hourly.", "The API uses JWT tokens"},
+		{"Is v1.2 supported? Yes, until June.", "Is v1.2 supported?"},
+		{"\n  Deploys run\tfrom main\nand are tagged", "Deploys run from main"},
+		{"", ""},
+		{long, strings.Repeat("word ", 14) + "word..."},
+	}
+
+	for _, test := range tests {
+		got := Title(test.summary)
+		if got != test.want {
+			t.Errorf("Title(%q) = %q, want %q", test.summary, got, test.want)
+		}
+		if utf8.RuneCountInString(got) > MaxTitleLength {
+			t.Errorf("Title(%q) is %d characters, longer than %d", test.summary, utf8.RuneCountInString(got), MaxTitleLength)
+		}
+	}
+}
+
+func TestParseSummary(t *testing.T) {
+	ai := Generation{Summarizer: GeneratedByAI}
+	basic := Generation{Summarizer: GeneratedByBasic}
+	tests := []struct {
+		name       string
+		raw        string
+		generation Generation
+		wantTitle  string
+		wantText   string
+	}{
+		{"title line", "Title: JWT authentication\nThe API uses JWT tokens.", ai, "JWT authentication", "The API uses JWT tokens."},
+		{"markdown labels", "**Title:** JWT authentication\n\n**Summary:** The API uses JWT tokens.", ai, "JWT authentication", "The API uses JWT tokens."},
+		{"lowercase label", "title: JWT authentication\nThe API uses JWT tokens.", ai, "JWT authentication", "The API uses JWT tokens."},
+		{"no title line", "The API uses JWT tokens. They expire hourly.", ai, "The API uses JWT tokens", "The API uses JWT tokens. They expire hourly."},
+		{"title without summary", "Title: JWT authentication", ai, "Title: JWT authentication", "Title: JWT authentication"},
+		{"basic summary", "Title: JWT authentication\nThe API uses JWT tokens.", basic, "Title: JWT authentication", "Title: JWT authentication\nThe API uses JWT tokens."},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := parseSummary(test.raw, test.generation)
+			if got.Title != test.wantTitle || got.Text != test.wantText || got.Generation != test.generation {
+				t.Errorf("parseSummary(%q) = %+v, want title %q and text %q", test.raw, got, test.wantTitle, test.wantText)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package telemetry
+
+import (
+	"sort"
+	"time"
+)
+
+// TimerBuckets are the upper bounds, in seconds, of the histogram buckets
+// every timer counts its durations in. They span cache hits to slow
+// provider calls.
+var TimerBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// histogram counts every duration a timer recorded in TimerBuckets
+type histogram struct {
+	// counts[i] counts the durations in bucket i alone; the last one
+	// counts those above every bound
+	counts []uint64
+	sum    time.Duration
+	count  uint64
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]uint64, len(TimerBuckets)+1)}
+}
+
+// observe counts duration in its bucket
+func (h *histogram) observe(duration time.Duration) {
+	i := sort.SearchFloat64s(TimerBuckets, duration.Seconds())
+	h.counts[i]++
+	h.sum += duration
+	h.count++
+}
+
+// HistogramSnapshot is the distribution of every duration a timer recorded
+type HistogramSnapshot struct {
+	// Buckets are the upper bounds in seconds, as in TimerBuckets
+	Buckets []float64
+
+	// Counts[i] counts the durations at or below Buckets[i]
+	Counts []uint64
+
+	// Count and Sum are the number and total of every duration
+	Count uint64
+	Sum   time.Duration
+}
+
+// Snapshot is a copy of the metrics a collector holds at one moment
+type Snapshot struct {
+	Counters map[string]int64
+	Gauges   map[string]float64
+	Timers   map[string]HistogramSnapshot
+}
+
+// Snapshot returns a copy of the collector's counters, gauges and timer
+// histograms
+func (m *MetricsCollector) Snapshot() Snapshot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	snapshot := Snapshot{
+		Counters: make(map[string]int64, len(m.counters)),
+		Gauges:   make(map[string]float64, len(m.gauges)),
+		Timers:   make(map[string]HistogramSnapshot, len(m.histograms)),
+	}
+	for name, value := range m.counters {
+		snapshot.Counters[name] = value
+	}
+	for name, value := range m.gauges {
+		snapshot.Gauges[name] = value
+	}
+	for name, h := range m.histograms {
+		timer := HistogramSnapshot{
+			Buckets: TimerBuckets,
+			Counts:  make([]uint64, len(TimerBuckets)),
+			Count:   h.count,
+			Sum:     h.sum,
+		}
+		var cumulative uint64
+		for i := range TimerBuckets {
+			cumulative += h.counts[i]
+			timer.Counts[i] = cumulative
+		}
+		snapshot.Timers[name] = timer
+	}
+	return snapshot
+}
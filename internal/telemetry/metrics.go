@@ -4,6 +4,7 @@ package telemetry
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 )
@@ -14,6 +15,7 @@ type MetricsCollector struct {
 	counters   map[string]int64
 	gauges     map[string]float64
 	timers     map[string][]time.Duration
+	histograms map[string]*histogram
 	latestTime map[string]time.Time
 	mu         sync.RWMutex
 }
@@ -30,6 +32,14 @@ const (
 	MetricAPICallsSuccess = "summarizer.api_calls.success"
 	MetricAPICallsFailure = "summarizer.api_calls.failure"
 
+	// MetricContentFiltered counts provider calls refused by the
+	// provider's safety filters. They are not counted as failures.
+	MetricContentFiltered = "summarizer.api_calls.content_filtered"
+
+	// MetricToolUseStripped counts summaries of untrusted text that held
+	// tool calls or other tool-use output, which was stripped.
+	MetricToolUseStripped = "summarizer.tool_use_stripped"
+
 	// Retry metrics
 	MetricRetryAttempts = "summarizer.retry_attempts"
 	MetricRetrySuccess  = "summarizer.retry_success"
@@ -38,10 +48,30 @@ const (
 	MetricFallbackAttempts = "summarizer.fallback_attempts"
 	MetricFallbackSuccess  = "summarizer.fallback_success"
 
+	// Hedging metrics: fallback requests raced against a slow primary, and
+	// how many of them answered first
+	MetricHedgedRequests = "summarizer.hedge.requests"
+	MetricHedgeWins      = "summarizer.hedge.wins"
+
+	// Chunking metrics
+	MetricChunkedInputs = "summarizer.chunked_inputs"
+	MetricChunks        = "summarizer.chunks"
+
+	// Request queue metrics: requests waiting for a slot, requests in
+	// flight and the time spent waiting
+	MetricQueueDepth    = "summarizer.queue.depth"
+	MetricQueueActive   = "summarizer.queue.active"
+	MetricQueueWaitTime = "summarizer.queue.wait_time"
+
+	// MetricRouterSwitches counts the times latency routing made another
+	// provider the first one tried
+	MetricRouterSwitches = "summarizer.router.switches"
+
 	// Cache metrics
 	MetricCacheHits   = "summarizer.cache.hits"
 	MetricCacheMisses = "summarizer.cache.misses"
 	MetricCacheSize   = "summarizer.cache.size"
+	MetricCacheBytes  = "summarizer.cache.bytes"
 
 	// Response times
 	MetricResponseTimeAnthropic = "summarizer.response_time.anthropic"
@@ -54,6 +84,91 @@ const (
 	MetricProviderHealthOpenAI    = "summarizer.health.openai"
 	MetricProviderHealthGoogle    = "summarizer.health.google"
 	MetricProviderHealthXAI       = "summarizer.health.xai"
+
+	// Estimated usage and cost. Each prefix is followed by
+	// "provider/model".
+	MetricTokensInputPrefix  = "summarizer.tokens.input."
+	MetricTokensOutputPrefix = "summarizer.tokens.output."
+	MetricCostPrefix         = "summarizer.cost_usd."
+
+	// Monthly budget metrics
+	MetricMonthSpend     = "summarizer.budget.month_spend_usd"
+	MetricBudgetExceeded = "summarizer.budget.exceeded"
+)
+
+// EmbedderMetrics defines constants for metrics related to embedders
+const (
+	// Cache metrics
+	MetricEmbedderCacheHits   = "embedder.cache.hits"
+	MetricEmbedderCacheMisses = "embedder.cache.misses"
+	MetricEmbedderCacheSize   = "embedder.cache.size"
+	MetricEmbedderCacheErrors = "embedder.cache.errors"
+	MetricEmbedderCacheBytes  = "embedder.cache.bytes"
+
+	// Success/failure metrics
+	MetricEmbedderCallsSuccess = "embedder.calls.success"
+	MetricEmbedderCallsFailure = "embedder.calls.failure"
+
+	// Retry metrics
+	MetricEmbedderRetryAttempts = "embedder.retry_attempts"
+	MetricEmbedderRetrySuccess  = "embedder.retry_success"
+
+	// Fallback metrics
+	MetricEmbedderFallbackAttempts = "embedder.fallback_attempts"
+	MetricEmbedderFallbackSuccess  = "embedder.fallback_success"
+
+	// MetricEmbedderResponseTimePrefix is followed by the provider name
+	MetricEmbedderResponseTimePrefix = "embedder.response_time."
+)
+
+// ServerMetrics defines constants for metrics related to the tool server
+const (
+	// Save limit metrics: saves refused because their source reached its
+	// limit, and repeated saves answered with the entry already stored
+	MetricSavesThrottled = "server.saves.throttled"
+	MetricSavesCoalesced = "server.saves.coalesced"
+
+	// MetricSummariesUnavailable counts texts stored verbatim because the
+	// summarizer's providers refused them
+	MetricSummariesUnavailable = "server.summaries.unavailable"
+
+	// MetricSummariesSkipped counts texts stored verbatim because they
+	// were shorter than the minimum input length
+	MetricSummariesSkipped = "server.summaries.skipped"
+
+	// Prompt injection metrics: suspected instructions found in retrieved
+	// summaries, and results returned with them scrubbed
+	MetricInjectionsDetected = "server.injections.detected"
+	MetricInjectionsScrubbed = "server.injections.scrubbed"
+
+	// Reranking metrics: results picked by the reranker, reranking calls
+	// that failed and left the results as ranked, and how long each call
+	// took
+	MetricRerankCalls    = "server.rerank.calls"
+	MetricRerankFailures = "server.rerank.failures"
+	MetricRerankDuration = "server.rerank.duration"
+
+	// Query expansion metrics: queries expanded, expansion calls that
+	// failed and left the query to be searched alone, and how long each
+	// call took
+	MetricExpansionCalls    = "server.expansion.calls"
+	MetricExpansionFailures = "server.expansion.failures"
+	MetricExpansionDuration = "server.expansion.duration"
+
+	// Hypothetical answer metrics: queries searched with a drafted answer,
+	// drafting calls that failed and left the query to be searched with
+	// its own embedding, and how long each call took
+	MetricHyDECalls    = "server.hyde.calls"
+	MetricHyDEFailures = "server.hyde.failures"
+	MetricHyDEDuration = "server.hyde.duration"
+)
+
+// StoreMetrics defines constants for metrics related to the context store
+const (
+	// Store operation metrics. Each prefix is followed by the operation:
+	// "save", "search", "delete", "clear" or "replace".
+	MetricStoreDurationPrefix = "store.duration."
+	MetricStoreErrorsPrefix   = "store.errors."
 )
 
 // NewMetricsCollector creates a new MetricsCollector instance
@@ -62,6 +177,7 @@ func NewMetricsCollector() *MetricsCollector {
 		counters:   make(map[string]int64),
 		gauges:     make(map[string]float64),
 		timers:     make(map[string][]time.Duration),
+		histograms: make(map[string]*histogram),
 		latestTime: make(map[string]time.Time),
 	}
 }
@@ -82,6 +198,14 @@ func (m *MetricsCollector) SetGauge(name string, value float64) {
 	m.gauges[name] = value
 }
 
+// AddToGauge adds delta to a named gauge
+func (m *MetricsCollector) AddToGauge(name string, delta float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.gauges[name] += delta
+}
+
 // RecordTimer records a duration for the specified timer
 func (m *MetricsCollector) RecordTimer(name string, duration time.Duration) {
 	m.mu.Lock()
@@ -97,6 +221,14 @@ func (m *MetricsCollector) RecordTimer(name string, duration time.Duration) {
 	if len(m.timers[name]) > 100 {
 		m.timers[name] = m.timers[name][1:]
 	}
+
+	// The histogram keeps counting what the stored durations forget
+	h, exists := m.histograms[name]
+	if !exists {
+		h = newHistogram()
+		m.histograms[name] = h
+	}
+	h.observe(duration)
 }
 
 // RecordTimestamp records the current time for the specified event
@@ -123,6 +255,36 @@ func (m *MetricsCollector) GetGauge(name string) float64 {
 	return m.gauges[name]
 }
 
+// GetCountersWithPrefix returns the counters whose names start with prefix,
+// keyed by the rest of the name
+func (m *MetricsCollector) GetCountersWithPrefix(prefix string) map[string]int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counters := make(map[string]int64)
+	for name, value := range m.counters {
+		if strings.HasPrefix(name, prefix) {
+			counters[strings.TrimPrefix(name, prefix)] = value
+		}
+	}
+	return counters
+}
+
+// GetGaugesWithPrefix returns the gauges whose names start with prefix,
+// keyed by the rest of the name
+func (m *MetricsCollector) GetGaugesWithPrefix(prefix string) map[string]float64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	gauges := make(map[string]float64)
+	for name, value := range m.gauges {
+		if strings.HasPrefix(name, prefix) {
+			gauges[strings.TrimPrefix(name, prefix)] = value
+		}
+	}
+	return gauges
+}
+
 // GetTimerAverage calculates the average duration for a timer
 func (m *MetricsCollector) GetTimerAverage(name string) time.Duration {
 	m.mu.RLock()
@@ -228,5 +390,6 @@ func (m *MetricsCollector) Reset() {
 	m.counters = make(map[string]int64)
 	m.gauges = make(map[string]float64)
 	m.timers = make(map[string][]time.Duration)
+	m.histograms = make(map[string]*histogram)
 	m.latestTime = make(map[string]time.Time)
 }
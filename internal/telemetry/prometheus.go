@@ -0,0 +1,206 @@
+package telemetry
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// PrometheusNamespace prefixes the name of every exported metric
+	PrometheusNamespace = "projectmemory"
+
+	// PrometheusContentType is the content type of the text exposition
+	// format WritePrometheus writes
+	PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// MetricsSource is implemented by components that collect their own
+// metrics, such as the summarizer and the embedders
+type MetricsSource interface {
+	GetMetrics() *MetricsCollector
+}
+
+// labeledPrefixes name the label holding the rest of the metric names that
+// start with each prefix, so every provider, model or operation shares one
+// metric family
+var labeledPrefixes = []struct {
+	prefix string
+	label  string
+}{
+	{"summarizer.response_time.", "provider"},
+	{"summarizer.health.", "provider"},
+	{MetricTokensInputPrefix, "model"},
+	{MetricTokensOutputPrefix, "model"},
+	{MetricCostPrefix, "model"},
+	{MetricEmbedderResponseTimePrefix, "provider"},
+	{MetricStoreDurationPrefix, "operation"},
+	{MetricStoreErrorsPrefix, "operation"},
+}
+
+// promSample is one series of a metric family
+type promSample struct {
+	labels string
+	value  any // int64, float64 or HistogramSnapshot
+}
+
+// promFamily is the series sharing a metric name and type
+type promFamily struct {
+	kind    string
+	samples []promSample
+}
+
+// WritePrometheus writes the metrics of collectors to w in the Prometheus
+// text exposition format. Counters become "_total" counters, gauges stay
+// gauges and timers become "_seconds" histograms. Metrics named alike in
+// several collectors are added together. Nil collectors are skipped.
+func WritePrometheus(w io.Writer, collectors ...*MetricsCollector) error {
+	counters := make(map[string]int64)
+	gauges := make(map[string]float64)
+	timers := make(map[string]HistogramSnapshot)
+	for _, collector := range collectors {
+		if collector == nil {
+			continue
+		}
+		snapshot := collector.Snapshot()
+		for name, value := range snapshot.Counters {
+			counters[name] += value
+		}
+		for name, value := range snapshot.Gauges {
+			gauges[name] += value
+		}
+		for name, timer := range snapshot.Timers {
+			timers[name] = mergeHistograms(timers[name], timer)
+		}
+	}
+
+	families := make(map[string]*promFamily)
+	add := func(name, kind, suffix string, value any) {
+		familyName, labels := promName(name)
+		familyName += suffix
+		family, ok := families[familyName]
+		if !ok {
+			family = &promFamily{kind: kind}
+			families[familyName] = family
+		}
+		family.samples = append(family.samples, promSample{labels: labels, value: value})
+	}
+	for name, value := range counters {
+		add(name, "counter", "_total", value)
+	}
+	for name, value := range gauges {
+		add(name, "gauge", "", value)
+	}
+	for name, timer := range timers {
+		add(name, "histogram", "_seconds", timer)
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := bufio.NewWriter(w)
+	for _, name := range names {
+		family := families[name]
+		sort.Slice(family.samples, func(i, j int) bool { return family.samples[i].labels < family.samples[j].labels })
+		fmt.Fprintf(out, "# TYPE %s %s\n", name, family.kind)
+		for _, sample := range family.samples {
+			switch value := sample.value.(type) {
+			case int64:
+				fmt.Fprintf(out, "%s%s %d\n", name, promLabels(sample.labels, ""), value)
+			case float64:
+				fmt.Fprintf(out, "%s%s %s\n", name, promLabels(sample.labels, ""), promFloat(value))
+			case HistogramSnapshot:
+				for i, bound := range value.Buckets {
+					fmt.Fprintf(out, "%s_bucket%s %d\n", name, promLabels(sample.labels, promFloat(bound)), value.Counts[i])
+				}
+				fmt.Fprintf(out, "%s_bucket%s %d\n", name, promLabels(sample.labels, "+Inf"), value.Count)
+				fmt.Fprintf(out, "%s_sum%s %s\n", name, promLabels(sample.labels, ""), promFloat(value.Sum.Seconds()))
+				fmt.Fprintf(out, "%s_count%s %d\n", name, promLabels(sample.labels, ""), value.Count)
+			}
+		}
+	}
+	return out.Flush()
+}
+
+// PrometheusHandler serves the metrics of collectors, as WritePrometheus
+// writes them, to GET requests
+func PrometheusHandler(collectors ...*MetricsCollector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", PrometheusContentType)
+		WritePrometheus(w, collectors...)
+	})
+}
+
+// mergeHistograms adds the counts of b to those of a, which may be empty
+func mergeHistograms(a, b HistogramSnapshot) HistogramSnapshot {
+	if a.Buckets == nil {
+		return b
+	}
+	merged := HistogramSnapshot{
+		Buckets: a.Buckets,
+		Counts:  make([]uint64, len(a.Counts)),
+		Count:   a.Count + b.Count,
+		Sum:     a.Sum + b.Sum,
+	}
+	for i := range a.Counts {
+		merged.Counts[i] = a.Counts[i] + b.Counts[i]
+	}
+	return merged
+}
+
+// promName returns the Prometheus metric name of a dotted metric name and
+// the label pair its labeled prefix calls for, if any
+func promName(name string) (string, string) {
+	for _, labeled := range labeledPrefixes {
+		if rest, ok := strings.CutPrefix(name, labeled.prefix); ok && rest != "" {
+			return promSanitize(strings.TrimSuffix(labeled.prefix, ".")), labeled.label + `="` + promEscape(rest) + `"`
+		}
+	}
+	return promSanitize(name), ""
+}
+
+// promSanitize turns a dotted metric name into a valid Prometheus name
+func promSanitize(name string) string {
+	return PrometheusNamespace + "_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// promEscape escapes a label value
+func promEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// promLabels formats labels, adding an "le" label unless le is empty
+func promLabels(labels, le string) string {
+	if le != "" {
+		if labels != "" {
+			labels += ","
+		}
+		labels += `le="` + le + `"`
+	}
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+// promFloat formats a sample value or bucket bound
+func promFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,66 @@
+package telemetry
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	summarizer := NewMetricsCollector()
+	summarizer.IncrementCounter(MetricAPICallsSuccess, 3)
+	summarizer.IncrementCounter(MetricTokensInputPrefix+"openai/gpt-4o", 120)
+	summarizer.SetGauge(MetricCacheSize, 2.5)
+	summarizer.RecordTimer("summarizer.total_time", 3*time.Millisecond)
+	summarizer.RecordTimer("summarizer.total_time", 2*time.Second)
+
+	store := NewMetricsCollector()
+	store.RecordTimer(MetricStoreDurationPrefix+"save", 20*time.Millisecond)
+	other := NewMetricsCollector()
+	other.RecordTimer(MetricStoreDurationPrefix+"save", 90*time.Second)
+	other.IncrementCounter(MetricAPICallsSuccess, 1)
+
+	var out strings.Builder
+	if err := WritePrometheus(&out, summarizer, nil, store, other); err != nil {
+		t.Fatalf("WritePrometheus failed: %v", err)
+	}
+	got := out.String()
+
+	for _, want := range []string{
+		"# TYPE projectmemory_summarizer_api_calls_success_total counter\nprojectmemory_summarizer_api_calls_success_total 4\n",
+		`projectmemory_summarizer_tokens_input_total{model="openai/gpt-4o"} 120` + "\n",
+		"# TYPE projectmemory_summarizer_cache_size gauge\nprojectmemory_summarizer_cache_size 2.5\n",
+		"# TYPE projectmemory_summarizer_total_time_seconds histogram\n",
+		`projectmemory_summarizer_total_time_seconds_bucket{le="0.001"} 0` + "\n",
+		`projectmemory_summarizer_total_time_seconds_bucket{le="0.005"} 1` + "\n",
+		`projectmemory_summarizer_total_time_seconds_bucket{le="2.5"} 2` + "\n",
+		`projectmemory_summarizer_total_time_seconds_bucket{le="+Inf"} 2` + "\n",
+		"projectmemory_summarizer_total_time_seconds_sum 2.003\n",
+		"projectmemory_summarizer_total_time_seconds_count 2\n",
+		`projectmemory_store_duration_seconds_bucket{operation="save",le="0.025"} 1` + "\n",
+		`projectmemory_store_duration_seconds_bucket{operation="save",le="60"} 1` + "\n",
+		`projectmemory_store_duration_seconds_bucket{operation="save",le="+Inf"} 2` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected the output to contain %q, got:\n%s", want, got)
+		}
+	}
+	if strings.Count(got, "# TYPE projectmemory_store_duration_seconds ") != 1 {
+		t.Errorf("Expected every operation to share one family, got:\n%s", got)
+	}
+}
+
+func TestTimerHistogramOutlivesStoredDurations(t *testing.T) {
+	m := NewMetricsCollector()
+	for i := 0; i < 150; i++ {
+		m.RecordTimer("timer", time.Millisecond)
+	}
+	if timer := m.Snapshot().Timers["timer"]; timer.Count != 150 || timer.Counts[len(timer.Counts)-1] != 150 {
+		t.Errorf("Expected the histogram to count all 150 durations, got %+v", timer)
+	}
+
+	m.Reset()
+	if timers := m.Snapshot().Timers; len(timers) != 0 {
+		t.Errorf("Expected Reset to clear the histograms, got %v", timers)
+	}
+}
@@ -0,0 +1,108 @@
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// pretokenizePattern splits text into the pieces byte-pair encoding merges
+// within. It follows the cl100k_base pattern of OpenAI's models, except
+// that RE2 has no lookahead, so a run of spaces before a word stays whole
+// instead of leaving its last space to the word; counts of text with such
+// runs may differ slightly from tiktoken's.
+var pretokenizePattern = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`)
+
+// BPE counts tokens by byte-pair encoding, as tiktoken does for OpenAI's
+// models, with the merge ranks of a tiktoken rank file.
+type BPE struct {
+	ranks map[string]int
+}
+
+// NewBPE returns a BPE tokenizer merging byte sequences by ranks, lowest
+// first. Every single byte should have a rank.
+func NewBPE(ranks map[string]int) *BPE {
+	return &BPE{ranks: ranks}
+}
+
+// LoadTiktoken reads a tiktoken rank file, such as cl100k_base.tiktoken:
+// one base64-encoded token and its rank per line.
+func LoadTiktoken(r io.Reader) (*BPE, error) {
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid rank file line %d: want a token and a rank", line)
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid rank file line %d: %w", line, err)
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid rank file line %d: %w", line, err)
+		}
+		ranks[string(token)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rank file: %w", err)
+	}
+	return NewBPE(ranks), nil
+}
+
+// LoadTiktokenFile reads the tiktoken rank file at path.
+func LoadTiktokenFile(path string) (*BPE, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open rank file: %w", err)
+	}
+	defer file.Close()
+	return LoadTiktoken(file)
+}
+
+// Count returns the number of tokens text encodes to
+func (b *BPE) Count(text string) int {
+	count := 0
+	for _, piece := range pretokenizePattern.FindAllString(text, -1) {
+		if _, ok := b.ranks[piece]; ok {
+			count++
+			continue
+		}
+		count += b.mergeCount(piece)
+	}
+	return count
+}
+
+// mergeCount returns the number of tokens piece is merged into, by
+// repeatedly merging the adjacent pair of parts with the lowest rank
+func (b *BPE) mergeCount(piece string) int {
+	// bounds[i] is where part i starts; the last bound is len(piece)
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+
+	for len(bounds) > 2 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i+2 < len(bounds); i++ {
+			if rank, ok := b.ranks[piece[bounds[i]:bounds[i+2]]]; ok && rank < bestRank {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		bounds = append(bounds[:best+1], bounds[best+2:]...)
+	}
+	return len(bounds) - 1
+}
@@ -0,0 +1,139 @@
+// Package tokenizer counts the tokens language models see in text, so
+// input limits, chunking and cost estimates can be expressed in the unit
+// providers actually charge and limit by.
+package tokenizer
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"unicode/utf8"
+)
+
+// Tokenizer names
+const (
+	// NameApproximate estimates tokens from the text's length, with a ratio
+	// chosen per provider
+	NameApproximate = "approximate"
+
+	// NameBPE counts tokens exactly by byte-pair encoding with a tiktoken
+	// rank file
+	NameBPE = "bpe"
+)
+
+// DefaultBytesPerToken is the rough length of a token in English text for
+// providers without a better known ratio.
+const DefaultBytesPerToken = 4.0
+
+// providerBytesPerToken is the rough length of a token in English text for
+// each provider's models, keyed by provider name
+var providerBytesPerToken = map[string]float64{
+	"anthropic": 3.5,
+	"openai":    4.0,
+	"google":    4.0,
+	"xai":       4.0,
+}
+
+// ErrUnknownTokenizer is returned by New for a tokenizer name it does not
+// know.
+var ErrUnknownTokenizer = errors.New("unknown tokenizer")
+
+// ErrMissingRankFile is returned by New for the BPE tokenizer without a
+// rank file.
+var ErrMissingRankFile = errors.New("the bpe tokenizer needs a rank file")
+
+// Tokenizer counts the tokens of text. Implementations must be safe for
+// concurrent use.
+type Tokenizer interface {
+	// Count returns the number of tokens in text
+	Count(text string) int
+}
+
+// Approximate estimates the tokens of text as its length in bytes divided
+// by BytesPerToken, rounded up.
+type Approximate struct {
+	BytesPerToken float64
+}
+
+// Count returns the estimated number of tokens in text
+func (a Approximate) Count(text string) int {
+	ratio := a.BytesPerToken
+	if ratio <= 0 {
+		ratio = DefaultBytesPerToken
+	}
+	return int(math.Ceil(float64(len(text)) / ratio))
+}
+
+// ForProvider returns the approximate tokenizer for the models of the named
+// summarization provider, or DefaultBytesPerToken for providers it does not
+// know.
+func ForProvider(provider string) Tokenizer {
+	if ratio, ok := providerBytesPerToken[provider]; ok {
+		return Approximate{BytesPerToken: ratio}
+	}
+	return Approximate{BytesPerToken: DefaultBytesPerToken}
+}
+
+// New returns the tokenizer called name. An empty name returns nil, leaving
+// the choice to ForProvider for each provider. NameBPE loads rankFile.
+func New(name, rankFile string) (Tokenizer, error) {
+	switch name {
+	case "":
+		return nil, nil
+	case NameApproximate:
+		return Approximate{BytesPerToken: DefaultBytesPerToken}, nil
+	case NameBPE:
+		if rankFile == "" {
+			return nil, ErrMissingRankFile
+		}
+		return LoadTiktokenFile(rankFile)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownTokenizer, name)
+	}
+}
+
+// maxTokenizer counts the most tokens any of its tokenizers counts
+type maxTokenizer []Tokenizer
+
+// Max returns a tokenizer counting the most tokens any of tokenizers
+// counts, for text that must fit every one of several models.
+func Max(tokenizers ...Tokenizer) Tokenizer {
+	if len(tokenizers) == 1 {
+		return tokenizers[0]
+	}
+	return maxTokenizer(tokenizers)
+}
+
+// Count returns the largest count of text
+func (m maxTokenizer) Count(text string) int {
+	count := 0
+	for _, t := range m {
+		count = max(count, t.Count(text))
+	}
+	return count
+}
+
+// Prefix returns the length in bytes of the longest prefix of text, ending
+// on a rune boundary, that t counts as at most maxTokens tokens. Counts are
+// assumed not to shrink as text grows.
+func Prefix(t Tokenizer, text string, maxTokens int) int {
+	if t.Count(text) <= maxTokens {
+		return len(text)
+	}
+
+	// Binary search for the longest fitting prefix
+	low, high := 0, len(text)
+	for low < high {
+		mid := (low + high + 1) / 2
+		end := mid
+		for end > 0 && end < len(text) && !utf8.RuneStart(text[end]) {
+			end--
+		}
+		if end > low && t.Count(text[:end]) <= maxTokens {
+			low = end
+		} else {
+			high = mid - 1
+		}
+	}
+	return low
+}
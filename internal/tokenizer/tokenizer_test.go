@@ -0,0 +1,127 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testRanks ranks every single byte, then "ab", "abc" and " the"
+func testRanks() map[string]int {
+	ranks := make(map[string]int)
+	for b := 0; b < 256; b++ {
+		ranks[string([]byte{byte(b)})] = b
+	}
+	ranks["ab"] = 256
+	ranks["abc"] = 257
+	ranks[" t"] = 258
+	ranks["he"] = 259
+	ranks[" the"] = 260
+	return ranks
+}
+
+func TestApproximate(t *testing.T) {
+	tests := []struct {
+		ratio float64
+		text  string
+		want  int
+	}{
+		{4, "", 0},
+		{4, "abcd", 1},
+		{4, "abcde", 2},
+		{3.5, "abcdefg", 2},
+		{0, "abcdefgh", 2},
+	}
+	for _, test := range tests {
+		if got := (Approximate{BytesPerToken: test.ratio}).Count(test.text); got != test.want {
+			t.Errorf("Approximate{%v}.Count(%q) = %d, want %d", test.ratio, test.text, got, test.want)
+		}
+	}
+
+	text := strings.Repeat("x", 70)
+	if anthropic, other := ForProvider("anthropic").Count(text), ForProvider("unknown").Count(text); anthropic != 20 || other != 18 {
+		t.Errorf("Expected 20 anthropic and 18 default tokens, got %d and %d", anthropic, other)
+	}
+}
+
+func TestBPECount(t *testing.T) {
+	bpe := NewBPE(testRanks())
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"abc", 1},
+		{"abd", 2},
+		{"abcabc", 2},
+		{" the", 1},
+		{"the abc", 4},
+		{"x1234", 5},
+	}
+	for _, test := range tests {
+		if got := bpe.Count(test.text); got != test.want {
+			t.Errorf("Count(%q) = %d, want %d", test.text, got, test.want)
+		}
+	}
+}
+
+func TestLoadTiktoken(t *testing.T) {
+	var file strings.Builder
+	for token, rank := range testRanks() {
+		fmt.Fprintf(&file, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(token)), rank)
+	}
+	bpe, err := LoadTiktoken(strings.NewReader(file.String()))
+	if err != nil {
+		t.Fatalf("LoadTiktoken() error = %v", err)
+	}
+	if got := bpe.Count("abc the"); got != 2 {
+		t.Errorf("Count() = %d, want 2", got)
+	}
+
+	if _, err := LoadTiktoken(strings.NewReader("YWI=\n")); err == nil {
+		t.Error("Expected an error for a line without a rank")
+	}
+	if _, err := LoadTiktoken(strings.NewReader("not-base64! 1\n")); err == nil {
+		t.Error("Expected an error for a token that is not base64")
+	}
+}
+
+func TestNew(t *testing.T) {
+	if tok, err := New("", ""); tok != nil || err != nil {
+		t.Errorf("New(\"\") = %v, %v, want nil, nil", tok, err)
+	}
+	if tok, err := New(NameApproximate, ""); err != nil || tok.Count("abcd") != 1 {
+		t.Errorf("New(approximate) = %v, %v", tok, err)
+	}
+	if _, err := New(NameBPE, ""); !errors.Is(err, ErrMissingRankFile) {
+		t.Errorf("Expected ErrMissingRankFile, got %v", err)
+	}
+	if _, err := New("sentencepiece", ""); !errors.Is(err, ErrUnknownTokenizer) {
+		t.Errorf("Expected ErrUnknownTokenizer, got %v", err)
+	}
+}
+
+func TestMaxAndPrefix(t *testing.T) {
+	both := Max(Approximate{BytesPerToken: 4}, Approximate{BytesPerToken: 2})
+	if got := both.Count("abcdefgh"); got != 4 {
+		t.Errorf("Max().Count() = %d, want 4", got)
+	}
+
+	tests := []struct {
+		text      string
+		maxTokens int
+		want      int
+	}{
+		{"abcdefgh", 4, 8},
+		{"abcdefgh", 3, 6},
+		{"abcdefgh", 0, 0},
+		{"ééééé", 2, 4},
+	}
+	for _, test := range tests {
+		if got := Prefix(both, test.text, test.maxTokens); got != test.want {
+			t.Errorf("Prefix(%q, %d) = %d, want %d", test.text, test.maxTokens, got, test.want)
+		}
+	}
+}
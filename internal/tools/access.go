@@ -0,0 +1,67 @@
+package tools
+
+import "slices"
+
+// names lists every MCP tool in the order the server registers them
+var names = []string{
+	ToolSaveContext,
+	ToolRetrieveContext,
+	ToolDeleteContext,
+	ToolClearAllContext,
+	ToolUndoClear,
+	ToolReplaceContext,
+	ToolListActiveRequests,
+	ToolCleanupReport,
+	ToolSnapshotHash,
+	ToolListBatches,
+	ToolRollbackBatch,
+	ToolMemoryStatus,
+	ToolArchiveNamespace,
+	ToolRestoreNamespace,
+	ToolMemoryGaps,
+	ToolPinContext,
+	ToolMemoryHealth,
+	ToolReviewQueue,
+	ToolRetrieveByFile,
+	ToolListSessions,
+	ToolExpireSession,
+	ToolLinkContext,
+	ToolGetLinkedContext,
+	ToolConsolidate,
+}
+
+// writeTools lists the tools that exist to change stored context, which a
+// read-only server does not offer
+var writeTools = []string{
+	ToolSaveContext,
+	ToolDeleteContext,
+	ToolClearAllContext,
+	ToolUndoClear,
+	ToolReplaceContext,
+	ToolRollbackBatch,
+	ToolArchiveNamespace,
+	ToolRestoreNamespace,
+	ToolPinContext,
+	ToolExpireSession,
+	ToolLinkContext,
+	ToolConsolidate,
+}
+
+// Names returns the name of every MCP tool, in the order the server
+// registers them
+func Names() []string {
+	return slices.Clone(names)
+}
+
+// IsTool reports whether name is the name of an MCP tool
+func IsTool(name string) bool {
+	return slices.Contains(names, name)
+}
+
+// IsWriteTool reports whether the tool exists to change stored context:
+// saving, replacing, deleting, pinning, linking, consolidating or moving entries. Tools that only
+// record bookkeeping, such as the retrievals of an entry or the queries
+// that found nothing, are not write tools.
+func IsWriteTool(name string) bool {
+	return slices.Contains(writeTools, name)
+}
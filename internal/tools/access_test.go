@@ -0,0 +1,53 @@
+package tools
+
+import "testing"
+
+func TestToolNames(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, name := range Names() {
+		if seen[name] {
+			t.Errorf("Tool %q is listed twice", name)
+		}
+		seen[name] = true
+	}
+	for _, name := range writeTools {
+		if !IsTool(name) {
+			t.Errorf("Write tool %q is not a tool", name)
+		}
+	}
+	for _, prompt := range Prompts() {
+		for _, name := range prompt.Tools {
+			if !IsTool(name) {
+				t.Errorf("Prompt %q uses unknown tool %q", prompt.Name, name)
+			}
+		}
+	}
+
+	if IsWriteTool(ToolRetrieveContext) || !IsWriteTool(ToolClearAllContext) {
+		t.Error("Expected clear_all_context, and not retrieve_context, to be a write tool")
+	}
+	if IsTool("wipe_everything") {
+		t.Error("Expected an unknown name not to be a tool")
+	}
+}
+
+func TestToolAnnotations(t *testing.T) {
+	for _, name := range Names() {
+		annotations, ok := annotations[name]
+		if !ok {
+			t.Errorf("Tool %q has no annotations", name)
+			continue
+		}
+		if annotations.ReadOnly && (IsWriteTool(name) || annotations.Destructive) {
+			t.Errorf("Tool %q is annotated read-only but changes stored context", name)
+		}
+		if IsWriteTool(name) && annotations.ReadOnly {
+			t.Errorf("Write tool %q is annotated read-only", name)
+		}
+	}
+
+	hints := ToolAnnotations(ToolClearAllContext).Map()
+	if hints["destructiveHint"] != true || hints["readOnlyHint"] != false {
+		t.Errorf("Expected clear_all_context to be annotated destructive, got %v", hints)
+	}
+}
@@ -0,0 +1,64 @@
+package tools
+
+// Annotations are the MCP hints a tool is registered with, so clients can
+// ask the user before calling a tool that destroys stored context and call
+// read-only tools freely
+type Annotations struct {
+	// ReadOnly reports that the tool does not change stored context. Tools
+	// that only record bookkeeping, such as retrieval counts, are read-only.
+	ReadOnly bool
+
+	// Destructive reports that the tool can delete or overwrite stored
+	// context, rather than only add to it
+	Destructive bool
+
+	// Idempotent reports that calling the tool again with the same
+	// arguments has no further effect
+	Idempotent bool
+}
+
+// Map returns the annotations under their MCP names
+func (a Annotations) Map() map[string]interface{} {
+	return map[string]interface{}{
+		"readOnlyHint":    a.ReadOnly,
+		"destructiveHint": a.Destructive,
+		"idempotentHint":  a.Idempotent,
+	}
+}
+
+// readOnly annotates the tools that do not change stored context
+var readOnly = Annotations{ReadOnly: true, Idempotent: true}
+
+// annotations holds the annotations of every MCP tool
+var annotations = map[string]Annotations{
+	ToolSaveContext:        {},
+	ToolRetrieveContext:    readOnly,
+	ToolDeleteContext:      {Destructive: true, Idempotent: true},
+	ToolClearAllContext:    {Destructive: true, Idempotent: true},
+	ToolUndoClear:          {Idempotent: true},
+	ToolReplaceContext:     {Destructive: true},
+	ToolListActiveRequests: readOnly,
+	ToolCleanupReport:      {Destructive: true},
+	ToolSnapshotHash:       readOnly,
+	ToolListBatches:        readOnly,
+	ToolRollbackBatch:      {Destructive: true, Idempotent: true},
+	ToolMemoryStatus:       readOnly,
+	ToolArchiveNamespace:   {Destructive: true, Idempotent: true},
+	ToolRestoreNamespace:   {Idempotent: true},
+	ToolMemoryGaps:         {Idempotent: true},
+	ToolPinContext:         {Idempotent: true},
+	ToolMemoryHealth:       readOnly,
+	ToolReviewQueue:        {Destructive: true},
+	ToolRetrieveByFile:     readOnly,
+	ToolListSessions:       readOnly,
+	ToolExpireSession:      {Destructive: true, Idempotent: true},
+	ToolLinkContext:        {Idempotent: true},
+	ToolGetLinkedContext:   readOnly,
+	ToolConsolidate:        {Destructive: true},
+}
+
+// ToolAnnotations returns the annotations of the named tool, or the zero
+// Annotations for an unknown tool
+func ToolAnnotations(name string) Annotations {
+	return annotations[name]
+}
@@ -0,0 +1,68 @@
+package tools
+
+import (
+	"regexp"
+	"slices"
+)
+
+const (
+	// PromptRecallMemory is the name of the recall_memory MCP prompt
+	PromptRecallMemory = "recall_memory"
+
+	// PromptSaveTakeaways is the name of the save_takeaways MCP prompt
+	PromptSaveTakeaways = "save_takeaways"
+)
+
+// Prompt is an MCP prompt template that clients can offer as a one-click
+// memory workflow. The client fills in each {{argument}} of Template and
+// sends the result to its model, which then calls Tools.
+type Prompt struct {
+	Name        string
+	Description string
+	Template    string
+	Tools       []string
+}
+
+// recallMemoryTemplate asks the model to look up what the project memory
+// knows about a task before starting on it
+const recallMemoryTemplate = `I am about to work on this task: {{task}}
+
+Before starting, recall what the project memory knows about it. Call the ` + ToolRetrieveContext + ` tool with a query describing the task, then with narrower queries for the components, decisions and conventions it involves. Use the past decisions, conventions and known pitfalls you find, and tell me which retrieved entries you relied on. If nothing relevant is stored, say so rather than guessing.`
+
+// saveTakeawaysTemplate asks the model to save what the session taught it
+const saveTakeawaysTemplate = `Review this session and save its lasting takeaways to the project memory: decisions made and why, conventions agreed, pitfalls found and facts learned about the project.
+
+First call the ` + ToolRetrieveContext + ` tool to check what is already stored. Then call the ` + ToolSaveContext + ` tool once per new takeaway, with a short text that makes sense without this conversation. If a takeaway corrects a stored entry, update that entry with the ` + ToolReplaceContext + ` tool instead of saving a duplicate. Skip anything temporary and never save secrets such as API keys or passwords. Finish by listing what you saved.`
+
+// Prompts returns the prompts the server registers
+func Prompts() []Prompt {
+	return []Prompt{
+		{
+			Name:        PromptRecallMemory,
+			Description: "Recall relevant project memory for a task before starting on it",
+			Template:    recallMemoryTemplate,
+			Tools:       []string{ToolRetrieveContext},
+		},
+		{
+			Name:        PromptSaveTakeaways,
+			Description: "Save the session's decisions, conventions and pitfalls to project memory",
+			Template:    saveTakeawaysTemplate,
+			Tools:       []string{ToolRetrieveContext, ToolSaveContext, ToolReplaceContext},
+		},
+	}
+}
+
+// promptArgument matches an {{argument}} placeholder
+var promptArgument = regexp.MustCompile(`{{\s*(\w+)\s*}}`)
+
+// Arguments returns the names of the prompt's arguments, in the order they
+// first appear in its template
+func (p Prompt) Arguments() []string {
+	var arguments []string
+	for _, match := range promptArgument.FindAllStringSubmatch(p.Template, -1) {
+		if !slices.Contains(arguments, match[1]) {
+			arguments = append(arguments, match[1])
+		}
+	}
+	return arguments
+}
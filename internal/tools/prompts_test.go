@@ -0,0 +1,46 @@
+package tools
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPrompts(t *testing.T) {
+	wantArguments := map[string][]string{
+		PromptRecallMemory:  {"task"},
+		PromptSaveTakeaways: nil,
+	}
+
+	prompts := Prompts()
+	if len(prompts) != len(wantArguments) {
+		t.Fatalf("Expected %d prompts, got %d", len(wantArguments), len(prompts))
+	}
+	for _, prompt := range prompts {
+		want, ok := wantArguments[prompt.Name]
+		if !ok {
+			t.Errorf("Unexpected or duplicate prompt %q", prompt.Name)
+			continue
+		}
+		delete(wantArguments, prompt.Name)
+
+		if got := prompt.Arguments(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Prompt %q has arguments %v, want %v", prompt.Name, got, want)
+		}
+		if prompt.Description == "" || len(prompt.Tools) == 0 {
+			t.Errorf("Prompt %q has no description or tools", prompt.Name)
+		}
+		for _, tool := range prompt.Tools {
+			if !strings.Contains(prompt.Template, "the "+tool+" tool") {
+				t.Errorf("Prompt %q does not name its %s tool", prompt.Name, tool)
+			}
+		}
+	}
+}
+
+func TestPromptArguments(t *testing.T) {
+	prompt := Prompt{Template: "Compare {{ first }} with {{second}}, then {{first}} with {{third}}. {{not an argument}}"}
+	if got, want := prompt.Arguments(), []string{"first", "second", "third"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Arguments() = %v, want %v", got, want)
+	}
+}
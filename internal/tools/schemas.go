@@ -2,6 +2,11 @@
 // for the ProjectMemory service.
 package tools
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
 const (
 	// ToolSaveContext is the name of the save_context MCP tool
 	ToolSaveContext = "save_context"
@@ -15,30 +20,241 @@ const (
 	// ToolClearAllContext is the name of the clear_all_context MCP tool
 	ToolClearAllContext = "clear_all_context"
 
+	// ToolUndoClear is the name of the undo_clear MCP tool
+	ToolUndoClear = "undo_clear"
+
 	// ToolReplaceContext is the name of the replace_context MCP tool
 	ToolReplaceContext = "replace_context"
 
+	// ToolListActiveRequests is the name of the list_active_requests MCP tool
+	ToolListActiveRequests = "list_active_requests"
+
+	// ToolCleanupReport is the name of the cleanup_report MCP tool
+	ToolCleanupReport = "cleanup_report"
+
+	// ToolSnapshotHash is the name of the snapshot_hash MCP tool
+	ToolSnapshotHash = "snapshot_hash"
+
+	// ToolListBatches is the name of the list_batches MCP tool
+	ToolListBatches = "list_batches"
+
+	// ToolRollbackBatch is the name of the rollback_batch MCP tool
+	ToolRollbackBatch = "rollback_batch"
+
+	// ToolMemoryStatus is the name of the memory_status MCP tool
+	ToolMemoryStatus = "memory_status"
+
+	// ToolArchiveNamespace is the name of the archive_namespace MCP tool
+	ToolArchiveNamespace = "archive_namespace"
+
+	// ToolRestoreNamespace is the name of the restore_namespace MCP tool
+	ToolRestoreNamespace = "restore_namespace"
+
+	// ToolMemoryGaps is the name of the memory_gaps MCP tool
+	ToolMemoryGaps = "memory_gaps"
+
+	// ToolPinContext is the name of the pin_context MCP tool
+	ToolPinContext = "pin_context"
+
+	// ToolMemoryHealth is the name of the memory_health MCP tool
+	ToolMemoryHealth = "memory_health"
+
+	// ToolReviewQueue is the name of the review_queue MCP tool
+	ToolReviewQueue = "review_queue"
+
+	// ToolRetrieveByFile is the name of the retrieve_by_file MCP tool
+	ToolRetrieveByFile = "retrieve_by_file"
+
+	// ToolListSessions is the name of the list_sessions MCP tool
+	ToolListSessions = "list_sessions"
+
+	// ToolExpireSession is the name of the expire_session MCP tool
+	ToolExpireSession = "expire_session"
+
+	// ToolLinkContext is the name of the link_context MCP tool
+	ToolLinkContext = "link_context"
+
+	// ToolGetLinkedContext is the name of the get_linked_context MCP tool
+	ToolGetLinkedContext = "get_linked_context"
+
+	// ToolConsolidate is the name of the consolidate MCP tool
+	ToolConsolidate = "consolidate"
+
 	// DefaultRetrieveLimit is the default number of results to return
 	// when no limit is specified in a retrieve_context request
 	DefaultRetrieveLimit = 5
+
+	// MaxRetrieveQueries is the most queries a retrieve_context request
+	// may search at once, counting its query and its queries
+	MaxRetrieveQueries = 8
+
+	// DefaultCleanupReportLimit is the default number of candidates to
+	// return when no limit is specified in a cleanup_report request
+	DefaultCleanupReportLimit = 20
+
+	// DefaultMemoryGapsLimit is the default number of gaps to return when
+	// no limit is specified in a memory_gaps request
+	DefaultMemoryGapsLimit = 20
+
+	// DefaultReviewQueueLimit is the default number of entries to return
+	// when no limit is specified in a review_queue request
+	DefaultReviewQueueLimit = 20
+
+	// DefaultRetrieveByFileLimit is the default number of entries to
+	// return when no limit is specified in a retrieve_by_file request
+	DefaultRetrieveByFileLimit = 20
+
+	// DefaultLinkedContextLimit is the default number of entries to
+	// return when no limit is specified in a get_linked_context request
+	DefaultLinkedContextLimit = 20
+
+	// MaxLinkDepth is the most relations get_linked_context follows from
+	// the requested entry
+	MaxLinkDepth = 3
+
+	// MaxPinned is the most entries that can be pinned at once, across
+	// every namespace, since each retrieval returns all of them
+	MaxPinned = 20
 )
 
+// Stages reported for in-flight tool calls by list_active_requests
+const (
+	StageValidating    = "validating"
+	StageSummarizing   = "summarizing"
+	StageExpanding     = "expanding"
+	StageDrafting      = "drafting"
+	StageEmbedding     = "embedding"
+	StageSearching     = "searching"
+	StageStoring       = "storing"
+	StageDeleting      = "deleting"
+	StageClearing      = "clearing"
+	StageAnalyzing     = "analyzing"
+	StageRestoring     = "restoring"
+	StageHashing       = "hashing"
+	StageListing       = "listing"
+	StageArchiving     = "archiving"
+	StageConsolidating = "consolidating"
+)
+
+// Ways retrieve_context handles context the caller already has
+const (
+	// DedupExclude drops known entries from the results. It is the default.
+	DedupExclude = "exclude"
+
+	// DedupDownrank returns known entries only after all others
+	DedupDownrank = "downrank"
+)
+
+// Ways retrieve_context searches the stored context
+const (
+	// SearchModeVector compares the query's embedding with the entries'.
+	// It is the default.
+	SearchModeVector = "vector"
+
+	// SearchModeKeyword searches the store's keyword index for the
+	// query's words, without embeddings
+	SearchModeKeyword = "keyword"
+)
+
+// Textual formats retrieve_context can render its results into
+const (
+	// FormatJSON renders results as a JSON array of objects with "id" and
+	// "text" fields
+	FormatJSON = "json"
+
+	// FormatMarkdownBullets renders each result as a Markdown bullet
+	// prefixed with its ID in brackets
+	FormatMarkdownBullets = "markdown_bullets"
+
+	// FormatXMLTags renders each result as a <context> element with an id
+	// attribute
+	FormatXMLTags = "xml_tags"
+)
+
+// FieldError names a field of a tool request that failed validation
+type FieldError struct {
+	// Field is the JSON name of the field
+	Field string `json:"field"`
+
+	// Message says what is wrong with it
+	Message string `json:"message"`
+}
+
 // SaveContextRequest defines the input schema for save_context tool
 type SaveContextRequest struct {
 	// ContextText is the text to save in the context store
 	ContextText string `json:"context_text"`
+
+	// Tags label the entry so retrieve_context can exclude it by tag
+	Tags []string `json:"tags,omitempty"`
+
+	// Source names where the context came from, such as a CLI, an
+	// importer, a file path or a URL
+	Source string `json:"source,omitempty"`
+
+	// BatchID groups the entry with the others written by the same import
+	// or ingestion run, so rollback_batch can remove them together
+	BatchID string `json:"batch_id,omitempty"`
+
+	// SessionID groups the entry with the others saved during the same
+	// agent session, so retrieve_context can search them together and
+	// expire_session can remove them together
+	SessionID string `json:"session_id,omitempty"`
+
+	// Untrusted marks the text as third-party content, such as a web page
+	// or an email, so instructions in it cannot steer the summarizer
+	Untrusted bool `json:"untrusted,omitempty"`
+
+	// MaxSummaryLength overrides the summarizer's configured summary
+	// length, in characters, for this entry. 0 uses the configured length.
+	MaxSummaryLength int `json:"max_summary_length,omitempty"`
+
+	// Namespace is the namespace to save the entry in. If omitted, the
+	// entry is saved in the default namespace.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Version is the tool schema version the client was built against.
+	// If omitted, DefaultSchemaVersion is assumed.
+	Version string `json:"version,omitempty"`
 }
 
 // SaveContextResponse defines the output schema for save_context tool
 type SaveContextResponse struct {
-	// Status indicates the result of the operation ("success" or "error")
+	// Status indicates the result of the operation ("success", "error" or
+	// "throttled")
 	Status string `json:"status"`
 
 	// ID is the unique identifier assigned to the saved context
 	ID string `json:"id"`
 
+	// Quarantined reports that a fallback embedding provider embedded the
+	// context. It is not retrieved until the primary provider re-embeds it.
+	Quarantined bool `json:"quarantined,omitempty"`
+
+	// Coalesced reports that the same source saved the same text within
+	// the save limit's window, so ID is the entry stored then
+	Coalesced bool `json:"coalesced,omitempty"`
+
+	// SummaryUnavailable reports that the summarizer's providers refused
+	// the text, so it was stored verbatim instead of a summary
+	SummaryUnavailable bool `json:"summary_unavailable,omitempty"`
+
+	// Title is the one-line title of the summary
+	Title string `json:"title,omitempty"`
+
+	// RetryAfterSeconds is how long to wait before retrying when Status is
+	// "throttled"
+	RetryAfterSeconds int `json:"retry_after_seconds,omitempty"`
+
 	// Error contains an error message if Status is "error"
 	Error string `json:"error,omitempty"`
+
+	// FieldErrors names each invalid field of the request, if the
+	// request failed validation
+	FieldErrors []FieldError `json:"field_errors,omitempty"`
+
+	// Version is the tool schema version this response follows
+	Version string `json:"version,omitempty"`
 }
 
 // RetrieveContextRequest defines the input schema for retrieve_context tool
@@ -46,9 +262,110 @@ type RetrieveContextRequest struct {
 	// Query is the text to search for in the context store
 	Query string `json:"query"`
 
+	// Queries are further queries, such as the subtopics of a task, each
+	// searched on its own like Query. Their results are merged by
+	// reciprocal rank fusion, so entries several of them find rank first.
+	// Query may be omitted when Queries are given.
+	Queries []string `json:"queries,omitempty"`
+
 	// Limit is the maximum number of results to return
-	// If not specified, DefaultRetrieveLimit will be used
+	// If not specified, the namespace's default or DefaultRetrieveLimit will be used
 	Limit int `json:"limit,omitempty"`
+
+	// MaxTokens bounds the tokens of the returned summaries together. The
+	// best results are added while they fit, so a prompt's context window
+	// can be filled without guessing a limit. Without a Limit, up to the
+	// highest limit the server allows are considered. 0 leaves the
+	// results unbounded.
+	MaxTokens int `json:"max_tokens,omitempty"`
+
+	// Adaptive lets the server return fewer results than Limit when there is
+	// a sharp drop in relevance, and up to twice Limit when scores are flat
+	Adaptive bool `json:"adaptive,omitempty"`
+
+	// MinScore drops results whose similarity to the query is below it,
+	// between 0 and 1. If not specified, the namespace's default is used.
+	MinScore float64 `json:"min_score,omitempty"`
+
+	// Namespace restricts the search to one namespace and selects whose
+	// configured retrieval defaults apply. If not specified, every
+	// namespace is searched with the defaults of
+	// contextstore.DefaultNamespace.
+	Namespace string `json:"namespace,omitempty"`
+
+	// RecencyHalfLife ranks newer entries higher: an entry's score decays
+	// exponentially with its age, halving at this Go duration, such as
+	// "72h". If not specified, the namespace's ranking is used.
+	RecencyHalfLife string `json:"recency_half_life,omitempty"`
+
+	// RecencyFloor is the share of an entry's score kept however old it
+	// is, between 0 and 1. If not specified, the namespace's default is
+	// used.
+	RecencyFloor float64 `json:"recency_floor,omitempty"`
+
+	// Mode selects how the context is searched: SearchModeVector (the
+	// default) or SearchModeKeyword, for exact identifiers or when the
+	// embedder is unavailable
+	Mode string `json:"mode,omitempty"`
+
+	// Rerank asks the server's LLM reranker to pick the results from the
+	// best candidates, for nuanced queries similarity ranks poorly. It
+	// fails on servers without a reranker, and servers reranking every
+	// request rerank it either way.
+	Rerank bool `json:"rerank,omitempty"`
+
+	// Expand asks the server's LLM query expander for other phrasings of
+	// the query, each searched as well, for terse queries similarity
+	// alone finds little for. It fails on servers without an expander,
+	// and servers expanding every request expand it either way.
+	Expand bool `json:"expand,omitempty"`
+
+	// HyDE asks the server's LLM drafter for a hypothetical answer to the
+	// query and searches with its embedding in place of the query's, for
+	// questions worded unlike the notes answering them. It fails on
+	// servers without a drafter, and servers drafting for every request
+	// draft for it either way.
+	HyDE bool `json:"hyde,omitempty"`
+
+	// ExcludeIDs lists entries that must not be returned, such as entries
+	// already in the caller's context window
+	ExcludeIDs []string `json:"exclude_ids,omitempty"`
+
+	// ExcludeTags drops entries carrying any of these tags
+	ExcludeTags []string `json:"exclude_tags,omitempty"`
+
+	// Tags restricts the search to entries carrying at least one of these
+	// tags
+	Tags []string `json:"tags,omitempty"`
+
+	// SessionID restricts the search to the entries saved with this
+	// session_id
+	SessionID string `json:"session_id,omitempty"`
+
+	// Since and Until restrict the search to entries saved at or after
+	// Since and before Until, in RFC 3339 format. Either may be omitted.
+	Since string `json:"since,omitempty"`
+	Until string `json:"until,omitempty"`
+
+	// KnownIDs lists entries the caller already has
+	KnownIDs []string `json:"known_ids,omitempty"`
+
+	// KnownHashes lists contextstore.ContentHash values of summaries the
+	// caller already has, for context it holds without an ID
+	KnownHashes []string `json:"known_hashes,omitempty"`
+
+	// Dedup selects how known entries are handled: DedupExclude (the
+	// default) or DedupDownrank
+	Dedup string `json:"dedup,omitempty"`
+
+	// Format asks the server to also render the results as text ready to
+	// paste into a prompt: FormatJSON, FormatMarkdownBullets or
+	// FormatXMLTags. If omitted, nothing is rendered.
+	Format string `json:"format,omitempty"`
+
+	// Version is the tool schema version the client was built against.
+	// If omitted, DefaultSchemaVersion is assumed.
+	Version string `json:"version,omitempty"`
 }
 
 // RetrieveContextResponse defines the output schema for retrieve_context tool
@@ -56,17 +373,152 @@ type RetrieveContextResponse struct {
 	// Status indicates the result of the operation ("success" or "error")
 	Status string `json:"status"`
 
-	// Results contains the matching context entries
-	Results []string `json:"results"`
+	// Results contains the matching context entries. Clients of schema
+	// version 1.x receive only their summaries, as a list of strings.
+	Results []ContextEntry `json:"results"`
+
+	// Provenance holds the provenance chain of each result, origin first,
+	// in the same order as Results. It is omitted when the store does not
+	// record provenance.
+	Provenance [][]string `json:"provenance,omitempty"`
+
+	// Generations records what wrote the summary of each result, in the
+	// same order as Results, nil where nothing was recorded. It is omitted
+	// when the store does not record generations.
+	Generations []*SummaryGeneration `json:"generations,omitempty"`
+
+	// Formatted holds the results rendered in the requested Format, with
+	// each entry's ID embedded where the store reports IDs
+	Formatted string `json:"formatted,omitempty"`
 
 	// Error contains an error message if Status is "error"
 	Error string `json:"error,omitempty"`
+
+	// FieldErrors names each invalid field of the request, if the
+	// request failed validation
+	FieldErrors []FieldError `json:"field_errors,omitempty"`
+
+	// Version is the tool schema version this response follows
+	Version string `json:"version,omitempty"`
+}
+
+// ContextEntry is an entry returned by retrieve_context from schema
+// version 2.0 on
+type ContextEntry struct {
+	// ID identifies the entry. It is empty if the store cannot report IDs.
+	ID string `json:"id,omitempty"`
+
+	// Summary is the stored summary
+	Summary string `json:"summary"`
+
+	// Score is how well the entry matches the query, its similarity or
+	// its ranking score if the namespace reranks results, or its fused
+	// score for several queries. Pinned entries come first whatever their
+	// score.
+	Score float64 `json:"score"`
+
+	// Timestamp is when the entry was saved (RFC 3339). It is empty if the
+	// store cannot report it.
+	Timestamp string `json:"timestamp,omitempty"`
+
+	// Tags are the entry's tags. They are empty if the store cannot hold
+	// them.
+	Tags []string `json:"tags"`
+
+	// Source is where the entry's content came from, if it was ingested
+	// from a file or captured from a commit. Since 2.1.
+	Source *EntrySource `json:"source,omitempty"`
+}
+
+// EntrySource is where an entry's content came from, for citing it: the
+// lines of a file, or a commit
+type EntrySource struct {
+	// Path is the file's path, and StartLine and EndLine the first and
+	// last of its lines, counted from 1
+	Path      string `json:"path,omitempty"`
+	StartLine int    `json:"start_line,omitempty"`
+	EndLine   int    `json:"end_line,omitempty"`
+
+	// Commit is the full hash of the commit
+	Commit string `json:"commit,omitempty"`
+}
+
+// Summaries returns the summary of each result, in order
+func (r RetrieveContextResponse) Summaries() []string {
+	summaries := make([]string, len(r.Results))
+	for i, entry := range r.Results {
+		summaries[i] = entry.Summary
+	}
+	return summaries
+}
+
+// retrieveContextResponse is RetrieveContextResponse without its JSON
+// methods
+type retrieveContextResponse RetrieveContextResponse
+
+// MarshalJSON encodes the response in the shape of its schema version.
+// Before 2.0, results are a list of summaries.
+func (r RetrieveContextResponse) MarshalJSON() ([]byte, error) {
+	if !schemaVersionBefore(r.Version, SchemaVersionV2) {
+		return json.Marshal(retrieveContextResponse(r))
+	}
+	return json.Marshal(struct {
+		retrieveContextResponse
+		Results []string `json:"results"`
+	}{retrieveContextResponse(r), r.Summaries()})
+}
+
+// UnmarshalJSON decodes a response of any schema version. Results given as
+// a list of summaries become entries with only a summary.
+func (r *RetrieveContextResponse) UnmarshalJSON(data []byte) error {
+	var response struct {
+		retrieveContextResponse
+		Results json.RawMessage `json:"results"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return err
+	}
+	*r = RetrieveContextResponse(response.retrieveContextResponse)
+	if len(response.Results) == 0 || string(response.Results) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(response.Results, &r.Results); err == nil {
+		return nil
+	}
+	var summaries []string
+	if err := json.Unmarshal(response.Results, &summaries); err != nil {
+		return fmt.Errorf("results are neither entries nor summaries: %w", err)
+	}
+	r.Results = make([]ContextEntry, len(summaries))
+	for i, summary := range summaries {
+		r.Results[i] = ContextEntry{Summary: summary}
+	}
+	return nil
+}
+
+// SummaryGeneration records what wrote a stored summary
+type SummaryGeneration struct {
+	// Summarizer is "ai", "basic", or "verbatim" for text stored as it was
+	// because the summarizer refused it
+	Summarizer string `json:"summarizer"`
+
+	// Provider and Model name the LLM provider and model of an AI summary
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+
+	// PromptVersion identifies the prompt template of an AI summary:
+	// "default", or a hash of a custom template
+	PromptVersion string `json:"prompt_version,omitempty"`
 }
 
 // DeleteContextRequest defines the input schema for delete_context tool
 type DeleteContextRequest struct {
 	// ID is the unique identifier of the context entry to delete
 	ID string `json:"id"`
+
+	// Version is the tool schema version the client was built against.
+	// If omitted, DefaultSchemaVersion is assumed.
+	Version string `json:"version,omitempty"`
 }
 
 // DeleteContextResponse defines the output schema for delete_context tool
@@ -76,6 +528,13 @@ type DeleteContextResponse struct {
 
 	// Error contains an error message if Status is "error"
 	Error string `json:"error,omitempty"`
+
+	// FieldErrors names each invalid field of the request, if the
+	// request failed validation
+	FieldErrors []FieldError `json:"field_errors,omitempty"`
+
+	// Version is the tool schema version this response follows
+	Version string `json:"version,omitempty"`
 }
 
 // ClearAllContextRequest defines the input schema for clear_all_context tool
@@ -83,6 +542,14 @@ type ClearAllContextRequest struct {
 	// Confirmation is a required field to confirm the operation
 	// Must be set to "confirm" to prevent accidental clearing
 	Confirmation string `json:"confirmation"`
+
+	// Permanent deletes the entries immediately instead of keeping them
+	// restorable with undo_clear for the server's grace period
+	Permanent bool `json:"permanent,omitempty"`
+
+	// Version is the tool schema version the client was built against.
+	// If omitted, DefaultSchemaVersion is assumed.
+	Version string `json:"version,omitempty"`
 }
 
 // ClearAllContextResponse defines the output schema for clear_all_context tool
@@ -93,8 +560,38 @@ type ClearAllContextResponse struct {
 	// DeletedCount contains the number of entries that were deleted
 	DeletedCount int `json:"deleted_count,omitempty"`
 
+	// RestorableUntil is when the cleared entries are permanently deleted,
+	// in RFC 3339 format. Until then undo_clear restores them. It is empty
+	// if the entries were deleted immediately.
+	RestorableUntil string `json:"restorable_until,omitempty"`
+
+	// Error contains an error message if Status is "error"
+	Error string `json:"error,omitempty"`
+
+	// Version is the tool schema version this response follows
+	Version string `json:"version,omitempty"`
+}
+
+// UndoClearRequest defines the input schema for undo_clear tool
+type UndoClearRequest struct {
+	// Version is the tool schema version the client was built against.
+	// If omitted, DefaultSchemaVersion is assumed.
+	Version string `json:"version,omitempty"`
+}
+
+// UndoClearResponse defines the output schema for undo_clear tool
+type UndoClearResponse struct {
+	// Status indicates the result of the operation ("success" or "error")
+	Status string `json:"status"`
+
+	// RestoredCount contains the number of entries that were restored
+	RestoredCount int `json:"restored_count"`
+
 	// Error contains an error message if Status is "error"
 	Error string `json:"error,omitempty"`
+
+	// Version is the tool schema version this response follows
+	Version string `json:"version,omitempty"`
 }
 
 // ReplaceContextRequest defines the input schema for replace_context tool
@@ -104,6 +601,18 @@ type ReplaceContextRequest struct {
 
 	// ContextText is the new text to replace the existing context
 	ContextText string `json:"context_text"`
+
+	// Source names where the new text came from. It is appended to the
+	// entry's provenance chain.
+	Source string `json:"source,omitempty"`
+
+	// MaxSummaryLength overrides the summarizer's configured summary
+	// length, in characters, for the new text. 0 uses the configured length.
+	MaxSummaryLength int `json:"max_summary_length,omitempty"`
+
+	// Version is the tool schema version the client was built against.
+	// If omitted, DefaultSchemaVersion is assumed.
+	Version string `json:"version,omitempty"`
 }
 
 // ReplaceContextResponse defines the output schema for replace_context tool
@@ -111,6 +620,859 @@ type ReplaceContextResponse struct {
 	// Status indicates the result of the operation ("success" or "error")
 	Status string `json:"status"`
 
+	// SummaryUnavailable reports that the summarizer's providers refused
+	// the new text, so it was stored verbatim instead of a summary
+	SummaryUnavailable bool `json:"summary_unavailable,omitempty"`
+
+	// Title is the one-line title of the new summary
+	Title string `json:"title,omitempty"`
+
 	// Error contains an error message if Status is "error"
 	Error string `json:"error,omitempty"`
+
+	// FieldErrors names each invalid field of the request, if the
+	// request failed validation
+	FieldErrors []FieldError `json:"field_errors,omitempty"`
+
+	// Version is the tool schema version this response follows
+	Version string `json:"version,omitempty"`
+}
+
+// ListActiveRequestsRequest defines the input schema for list_active_requests tool
+type ListActiveRequestsRequest struct {
+	// Version is the tool schema version the client was built against.
+	// If omitted, DefaultSchemaVersion is assumed.
+	Version string `json:"version,omitempty"`
+}
+
+// ActiveRequest describes a tool call that is currently executing
+type ActiveRequest struct {
+	// ID identifies the call for the lifetime of the server process
+	ID uint64 `json:"id"`
+
+	// Tool is the name of the tool being called
+	Tool string `json:"tool"`
+
+	// Stage is the step the call is currently in, such as "summarizing"
+	Stage string `json:"stage"`
+
+	// StartedAt is when the call started, in RFC 3339 format
+	StartedAt string `json:"started_at"`
+
+	// ElapsedMs is how long the call has been running, in milliseconds
+	ElapsedMs int64 `json:"elapsed_ms"`
+
+	// StageElapsedMs is how long the call has been in its current stage, in milliseconds
+	StageElapsedMs int64 `json:"stage_elapsed_ms"`
+}
+
+// ListActiveRequestsResponse defines the output schema for list_active_requests tool
+type ListActiveRequestsResponse struct {
+	// Status indicates the result of the operation ("success" or "error")
+	Status string `json:"status"`
+
+	// Requests contains the executing tool calls, oldest first
+	Requests []ActiveRequest `json:"requests"`
+
+	// Error contains an error message if Status is "error"
+	Error string `json:"error,omitempty"`
+
+	// Version is the tool schema version this response follows
+	Version string `json:"version,omitempty"`
+}
+
+// CleanupReportRequest defines the input schema for cleanup_report tool
+type CleanupReportRequest struct {
+	// MinScore is the garbage score from which entries are reported.
+	// If not specified, the server's configured minimum is used.
+	MinScore float64 `json:"min_score,omitempty"`
+
+	// Limit is the maximum number of candidates to return.
+	// If not specified, DefaultCleanupReportLimit will be used
+	Limit int `json:"limit,omitempty"`
+
+	// DryRun reports what the server's auto-apply policy would delete
+	// without deleting anything
+	DryRun bool `json:"dry_run,omitempty"`
+
+	// Version is the tool schema version the client was built against.
+	// If omitted, DefaultSchemaVersion is assumed.
+	Version string `json:"version,omitempty"`
+}
+
+// CleanupCandidate describes an entry that is likely junk
+type CleanupCandidate struct {
+	// ID is the unique identifier of the entry
+	ID string `json:"id"`
+
+	// Summary is the stored summary of the entry
+	Summary string `json:"summary"`
+
+	// Title is the one-line title of the summary, if the store records one
+	Title string `json:"title,omitempty"`
+
+	// Score is the garbage score in [0, 1]. Higher is more likely junk.
+	Score float64 `json:"score"`
+
+	// Reasons lists why the entry is reported: "low_information",
+	// "never_retrieved" or "near_duplicate"
+	Reasons []string `json:"reasons"`
+
+	// DuplicateOf is the ID of the newer entry this one nearly duplicates
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+
+	// Retrievals is how often the entry was returned by retrieve_context
+	Retrievals int `json:"retrievals"`
+}
+
+// CleanupReportResponse defines the output schema for cleanup_report tool
+type CleanupReportResponse struct {
+	// Status indicates the result of the operation ("success" or "error")
+	Status string `json:"status"`
+
+	// Candidates contains the likely junk entries, highest score first
+	Candidates []CleanupCandidate `json:"candidates"`
+
+	// Deleted lists the IDs deleted under the auto-apply policy, or that
+	// would be deleted in a dry run
+	Deleted []string `json:"deleted,omitempty"`
+
+	// DryRun is true if Deleted lists entries that were not deleted
+	DryRun bool `json:"dry_run,omitempty"`
+
+	// Error contains an error message if Status is "error"
+	Error string `json:"error,omitempty"`
+
+	// FieldErrors names each invalid field of the request, if the
+	// request failed validation
+	FieldErrors []FieldError `json:"field_errors,omitempty"`
+
+	// Version is the tool schema version this response follows
+	Version string `json:"version,omitempty"`
+}
+
+// SnapshotHashRequest defines the input schema for snapshot_hash tool
+type SnapshotHashRequest struct {
+	// Namespace limits the response to one namespace.
+	// If not specified, every namespace holding entries is hashed.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Version is the tool schema version the client was built against.
+	// If omitted, DefaultSchemaVersion is assumed.
+	Version string `json:"version,omitempty"`
+}
+
+// SnapshotHashResponse defines the output schema for snapshot_hash tool
+type SnapshotHashResponse struct {
+	// Status indicates the result of the operation ("success" or "error")
+	Status string `json:"status"`
+
+	// Hashes maps each namespace holding entries to the hex snapshot hash
+	// of its content. Stores with the same content have the same hashes.
+	Hashes map[string]string `json:"hashes"`
+
+	// Error contains an error message if Status is "error"
+	Error string `json:"error,omitempty"`
+
+	// Version is the tool schema version this response follows
+	Version string `json:"version,omitempty"`
+}
+
+// ListBatchesRequest defines the input schema for list_batches tool
+type ListBatchesRequest struct {
+	// Version is the tool schema version the client was built against.
+	// If omitted, DefaultSchemaVersion is assumed.
+	Version string `json:"version,omitempty"`
+}
+
+// BatchInfo describes the entries written by one import or ingestion run
+type BatchInfo struct {
+	// ID is the batch_id the entries were saved with
+	ID string `json:"id"`
+
+	// Entries is the number of entries in the batch
+	Entries int `json:"entries"`
+
+	// FirstStored and LastStored are when the oldest and newest entries of
+	// the batch were saved, in RFC 3339 format
+	FirstStored string `json:"first_stored"`
+	LastStored  string `json:"last_stored"`
+}
+
+// ListBatchesResponse defines the output schema for list_batches tool
+type ListBatchesResponse struct {
+	// Status indicates the result of the operation ("success" or "error")
+	Status string `json:"status"`
+
+	// Batches lists every batch holding entries, oldest first
+	Batches []BatchInfo `json:"batches"`
+
+	// Error contains an error message if Status is "error"
+	Error string `json:"error,omitempty"`
+
+	// Version is the tool schema version this response follows
+	Version string `json:"version,omitempty"`
+}
+
+// RollbackBatchRequest defines the input schema for rollback_batch tool
+type RollbackBatchRequest struct {
+	// BatchID is the batch whose entries are deleted
+	BatchID string `json:"batch_id"`
+
+	// Confirmation is a required field to confirm the operation
+	// Must be set to "confirm" to prevent accidental deletion
+	Confirmation string `json:"confirmation"`
+
+	// Version is the tool schema version the client was built against.
+	// If omitted, DefaultSchemaVersion is assumed.
+	Version string `json:"version,omitempty"`
+}
+
+// RollbackBatchResponse defines the output schema for rollback_batch tool
+type RollbackBatchResponse struct {
+	// Status indicates the result of the operation ("success" or "error")
+	Status string `json:"status"`
+
+	// DeletedCount contains the number of entries that were deleted
+	DeletedCount int `json:"deleted_count"`
+
+	// Error contains an error message if Status is "error"
+	Error string `json:"error,omitempty"`
+
+	// FieldErrors names each invalid field of the request, if the
+	// request failed validation
+	FieldErrors []FieldError `json:"field_errors,omitempty"`
+
+	// Version is the tool schema version this response follows
+	Version string `json:"version,omitempty"`
+}
+
+// ListSessionsRequest defines the input schema for list_sessions tool
+type ListSessionsRequest struct {
+	// Version is the tool schema version the client was built against.
+	// If omitted, DefaultSchemaVersion is assumed.
+	Version string `json:"version,omitempty"`
+}
+
+// SessionInfo describes the entries saved during one agent session
+type SessionInfo struct {
+	// ID is the session_id the entries were saved with
+	ID string `json:"id"`
+
+	// Entries is the number of entries in the session
+	Entries int `json:"entries"`
+
+	// FirstStored and LastStored are when the oldest and newest entries of
+	// the session were saved, in RFC 3339 format
+	FirstStored string `json:"first_stored"`
+	LastStored  string `json:"last_stored"`
+}
+
+// ListSessionsResponse defines the output schema for list_sessions tool
+type ListSessionsResponse struct {
+	// Status indicates the result of the operation ("success" or "error")
+	Status string `json:"status"`
+
+	// Sessions lists every session holding entries, most recently active
+	// first
+	Sessions []SessionInfo `json:"sessions"`
+
+	// Error contains an error message if Status is "error"
+	Error string `json:"error,omitempty"`
+
+	// Version is the tool schema version this response follows
+	Version string `json:"version,omitempty"`
+}
+
+// ExpireSessionRequest defines the input schema for expire_session tool
+type ExpireSessionRequest struct {
+	// SessionID is the session whose entries are deleted
+	SessionID string `json:"session_id"`
+
+	// Confirmation is a required field to confirm the operation
+	// Must be set to "confirm" to prevent accidental deletion
+	Confirmation string `json:"confirmation"`
+
+	// Version is the tool schema version the client was built against.
+	// If omitted, DefaultSchemaVersion is assumed.
+	Version string `json:"version,omitempty"`
+}
+
+// ExpireSessionResponse defines the output schema for expire_session tool
+type ExpireSessionResponse struct {
+	// Status indicates the result of the operation ("success" or "error")
+	Status string `json:"status"`
+
+	// DeletedCount contains the number of entries that were deleted
+	DeletedCount int `json:"deleted_count"`
+
+	// Error contains an error message if Status is "error"
+	Error string `json:"error,omitempty"`
+
+	// FieldErrors names each invalid field of the request, if the
+	// request failed validation
+	FieldErrors []FieldError `json:"field_errors,omitempty"`
+
+	// Version is the tool schema version this response follows
+	Version string `json:"version,omitempty"`
+}
+
+// MemoryStatusRequest defines the input schema for memory_status tool
+type MemoryStatusRequest struct {
+	// Version is the tool schema version the client was built against.
+	// If omitted, DefaultSchemaVersion is assumed.
+	Version string `json:"version,omitempty"`
+}
+
+// Reasons memory_status gives for advising clients to defer saves
+const (
+	// DeferQueueFull means summarization requests are waiting for a slot
+	DeferQueueFull = "queue_full"
+
+	// DeferProvidersFailing means no summarization provider is healthy
+	DeferProvidersFailing = "providers_failing"
+)
+
+// MemoryStatusResponse defines the output schema for memory_status tool
+type MemoryStatusResponse struct {
+	// Status indicates the result of the operation ("success" or "error")
+	Status string `json:"status"`
+
+	// QueueDepth is the number of summarization requests waiting for a
+	// provider slot
+	QueueDepth int `json:"queue_depth"`
+
+	// ProviderRequests is the number of summarization requests in flight,
+	// and MaxConcurrency the most allowed at once
+	ProviderRequests int `json:"provider_requests"`
+	MaxConcurrency   int `json:"max_concurrency,omitempty"`
+
+	// ActiveRequests is the number of tool calls currently executing
+	ActiveRequests int `json:"active_requests"`
+
+	// Providers maps each summarization provider to "healthy", "degraded"
+	// or "unhealthy", judged by its recent calls
+	Providers map[string]string `json:"providers"`
+
+	// OverBudget is true once the monthly summarization budget is spent
+	// and summaries are made without a provider
+	OverBudget bool `json:"over_budget,omitempty"`
+
+	// DeferNonCritical advises clients to postpone saves that can wait
+	DeferNonCritical bool `json:"defer_non_critical"`
+
+	// DeferReasons lists why DeferNonCritical is set: "queue_full" or
+	// "providers_failing"
+	DeferReasons []string `json:"defer_reasons,omitempty"`
+
+	// Error contains an error message if Status is "error"
+	Error string `json:"error,omitempty"`
+
+	// Version is the tool schema version this response follows
+	Version string `json:"version,omitempty"`
+}
+
+// ArchiveNamespaceRequest defines the input schema for archive_namespace tool
+type ArchiveNamespaceRequest struct {
+	// Namespace is the namespace moved to the archive
+	Namespace string `json:"namespace"`
+
+	// Version is the tool schema version the client was built against.
+	// If omitted, DefaultSchemaVersion is assumed.
+	Version string `json:"version,omitempty"`
+}
+
+// ArchiveNamespaceResponse defines the output schema for archive_namespace tool
+type ArchiveNamespaceResponse struct {
+	// Status indicates the result of the operation ("success" or "error")
+	Status string `json:"status"`
+
+	// ArchivedCount contains the number of entries moved to the archive
+	ArchivedCount int `json:"archived_count"`
+
+	// SnapshotHash is the snapshot hash of the archived namespace, which
+	// it has again once restored
+	SnapshotHash string `json:"snapshot_hash,omitempty"`
+
+	// Error contains an error message if Status is "error"
+	Error string `json:"error,omitempty"`
+
+	// Version is the tool schema version this response follows
+	Version string `json:"version,omitempty"`
+}
+
+// RestoreNamespaceRequest defines the input schema for restore_namespace tool
+type RestoreNamespaceRequest struct {
+	// Namespace is the archived namespace moved back into the store
+	Namespace string `json:"namespace"`
+
+	// Version is the tool schema version the client was built against.
+	// If omitted, DefaultSchemaVersion is assumed.
+	Version string `json:"version,omitempty"`
+}
+
+// RestoreNamespaceResponse defines the output schema for restore_namespace tool
+type RestoreNamespaceResponse struct {
+	// Status indicates the result of the operation ("success" or "error")
+	Status string `json:"status"`
+
+	// RestoredCount contains the number of entries moved back into the store
+	RestoredCount int `json:"restored_count"`
+
+	// Error contains an error message if Status is "error"
+	Error string `json:"error,omitempty"`
+
+	// Version is the tool schema version this response follows
+	Version string `json:"version,omitempty"`
+}
+
+// MemoryGapsRequest defines the input schema for memory_gaps tool
+type MemoryGapsRequest struct {
+	// Namespace limits the gaps to one namespace. Empty lists the gaps of
+	// every namespace.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Limit is the maximum number of gaps to return
+	Limit int `json:"limit,omitempty"`
+
+	// Resolve lists queries of Namespace whose gaps have been filled, such
+	// as by ingesting documentation. They are forgotten before the gaps
+	// are listed. Resolving requires a Namespace.
+	Resolve []string `json:"resolve,omitempty"`
+
+	// Version is the tool schema version the client was built against.
+	// If omitted, DefaultSchemaVersion is assumed.
+	Version string `json:"version,omitempty"`
+}
+
+// GapInfo describes a retrieval query that found nothing
+type GapInfo struct {
+	// Namespace is the namespace the query searched
+	Namespace string `json:"namespace"`
+
+	// Query is the retrieve_context query
+	Query string `json:"query"`
+
+	// Count is how often the query returned nothing above the score
+	// threshold
+	Count int `json:"count"`
+
+	// FirstSeen and LastSeen are when the query first and last found
+	// nothing, in RFC 3339 format
+	FirstSeen string `json:"first_seen"`
+	LastSeen  string `json:"last_seen"`
+}
+
+// MemoryGapsResponse defines the output schema for memory_gaps tool
+type MemoryGapsResponse struct {
+	// Status indicates the result of the operation ("success" or "error")
+	Status string `json:"status"`
+
+	// Gaps lists the queries that found nothing, most often asked first
+	Gaps []GapInfo `json:"gaps"`
+
+	// Resolved is the number of gaps forgotten by Resolve
+	Resolved int `json:"resolved,omitempty"`
+
+	// Error contains an error message if Status is "error"
+	Error string `json:"error,omitempty"`
+
+	// FieldErrors names each invalid field of the request, if the
+	// request failed validation
+	FieldErrors []FieldError `json:"field_errors,omitempty"`
+
+	// Version is the tool schema version this response follows
+	Version string `json:"version,omitempty"`
+}
+
+// PinContextRequest defines the input schema for pin_context tool
+type PinContextRequest struct {
+	// ID is the entry to pin
+	ID string `json:"id"`
+
+	// Unpin removes the entry's pin instead
+	Unpin bool `json:"unpin,omitempty"`
+
+	// Version is the tool schema version the client was built against.
+	// If omitted, DefaultSchemaVersion is assumed.
+	Version string `json:"version,omitempty"`
+}
+
+// PinContextResponse defines the output schema for pin_context tool
+type PinContextResponse struct {
+	// Status indicates the result of the operation ("success" or "error")
+	Status string `json:"status"`
+
+	// Pinned reports whether the entry is pinned after the call
+	Pinned bool `json:"pinned"`
+
+	// Error contains an error message if Status is "error"
+	Error string `json:"error,omitempty"`
+
+	// FieldErrors names each invalid field of the request, if the
+	// request failed validation
+	FieldErrors []FieldError `json:"field_errors,omitempty"`
+
+	// Version is the tool schema version this response follows
+	Version string `json:"version,omitempty"`
+}
+
+// Components memory_health reports on
+const (
+	// ComponentSummarizer is the summarizer and its LLM providers
+	ComponentSummarizer = "summarizer"
+
+	// ComponentEmbedder is the embedder and its fallbacks
+	ComponentEmbedder = "embedder"
+
+	// ComponentStore is the context store
+	ComponentStore = "store"
+)
+
+// MemoryHealthRequest defines the input schema for memory_health tool
+type MemoryHealthRequest struct {
+	// Version is the tool schema version the client was built against.
+	// If omitted, DefaultSchemaVersion is assumed.
+	Version string `json:"version,omitempty"`
+}
+
+// MemoryHealthResponse defines the output schema for memory_health tool
+type MemoryHealthResponse struct {
+	// Status indicates the result of the operation ("success" or "error")
+	Status string `json:"status"`
+
+	// Health is the worst health of the components: "healthy", "degraded"
+	// or "unhealthy"
+	Health string `json:"health,omitempty"`
+
+	// Components maps "summarizer", "embedder" and "store" to their health
+	Components map[string]string `json:"components,omitempty"`
+
+	// Problems maps each component that is not healthy to what is wrong
+	Problems map[string]string `json:"problems,omitempty"`
+
+	// Summarizer is the AI summarizer's health report, with the health of
+	// each provider, response times, cache statistics and spend. Other
+	// summarizers have none.
+	Summarizer json.RawMessage `json:"summarizer,omitempty"`
+
+	// Error contains an error message if Status is "error"
+	Error string `json:"error,omitempty"`
+
+	// Version is the tool schema version this response follows
+	Version string `json:"version,omitempty"`
+}
+
+// ReviewQueueRequest defines the input schema for review_queue tool
+type ReviewQueueRequest struct {
+	// Action is what the reviewer decided about the entry ID: "confirm"
+	// that it still holds, "refresh" it with ContextText, or "retire" it.
+	// Empty only lists the queue.
+	Action string `json:"action,omitempty"`
+
+	// ID is the entry the Action applies to
+	ID string `json:"id,omitempty"`
+
+	// ContextText is the up-to-date text of a refreshed entry
+	ContextText string `json:"context_text,omitempty"`
+
+	// Reviewer and Note are recorded with the Action
+	Reviewer string `json:"reviewer,omitempty"`
+	Note     string `json:"note,omitempty"`
+
+	// Limit is the maximum number of entries to return
+	Limit int `json:"limit,omitempty"`
+
+	// Version is the tool schema version the client was built against.
+	// If omitted, DefaultSchemaVersion is assumed.
+	Version string `json:"version,omitempty"`
+}
+
+// ReviewItem describes an entry due for review
+type ReviewItem struct {
+	// ID is the entry's unique identifier
+	ID string `json:"id"`
+
+	// Title is the one-line title of the summary, if it has one
+	Title string `json:"title,omitempty"`
+
+	// Summary is the stored summary text
+	Summary string `json:"summary"`
+
+	// Timestamp is when the entry was stored, in RFC 3339 format
+	Timestamp string `json:"timestamp"`
+
+	// Retrievals is how often the entry was retrieved, last at
+	// LastRetrieved in RFC 3339 format
+	Retrievals    int    `json:"retrievals"`
+	LastRetrieved string `json:"last_retrieved"`
+
+	// LastReviewed is when the entry was last reviewed, in RFC 3339
+	// format. It is empty if it never was.
+	LastReviewed string `json:"last_reviewed,omitempty"`
+}
+
+// ReviewQueueResponse defines the output schema for review_queue tool
+type ReviewQueueResponse struct {
+	// Status indicates the result of the operation ("success" or "error")
+	Status string `json:"status"`
+
+	// Entries lists the entries due for review after the Action, most
+	// retrieved first
+	Entries []ReviewItem `json:"entries"`
+
+	// Error contains an error message if Status is "error"
+	Error string `json:"error,omitempty"`
+
+	// FieldErrors names each invalid field of the request, if the
+	// request failed validation
+	FieldErrors []FieldError `json:"field_errors,omitempty"`
+
+	// Version is the tool schema version this response follows
+	Version string `json:"version,omitempty"`
+}
+
+// RetrieveByFileRequest defines the input schema for retrieve_by_file tool
+type RetrieveByFileRequest struct {
+	// Path is the file whose memories to retrieve: a path from the
+	// repository root, an absolute path inside it, or the end of a path,
+	// such as "store.go"
+	Path string `json:"path"`
+
+	// Limit is the maximum number of entries to return
+	Limit int `json:"limit,omitempty"`
+
+	// Version is the tool schema version the client was built against.
+	// If omitted, DefaultSchemaVersion is assumed.
+	Version string `json:"version,omitempty"`
+}
+
+// LinkedResult describes an entry that mentions a file
+type LinkedResult struct {
+	// ID is the entry's unique identifier
+	ID string `json:"id"`
+
+	// Title is the one-line title of the summary, if it has one
+	Title string `json:"title,omitempty"`
+
+	// Summary is the stored summary text
+	Summary string `json:"summary"`
+
+	// Timestamp is when the entry was stored, in RFC 3339 format
+	Timestamp string `json:"timestamp"`
+
+	// Path is the file the entry mentions
+	Path string `json:"path"`
+
+	// Symbols lists the Go symbols of Path the entry mentions. It is
+	// empty when the entry mentions only the file.
+	Symbols []string `json:"symbols,omitempty"`
+
+	// Source is where the entry's content came from, if it was ingested
+	// from a file or captured from a commit. Since 2.1.
+	Source *EntrySource `json:"source,omitempty"`
+}
+
+// RetrieveByFileResponse defines the output schema for retrieve_by_file tool
+type RetrieveByFileResponse struct {
+	// Status indicates the result of the operation ("success" or "error")
+	Status string `json:"status"`
+
+	// Paths lists the repository files the requested path matched
+	Paths []string `json:"paths"`
+
+	// Results lists the entries mentioning those files, newest first
+	Results []LinkedResult `json:"results"`
+
+	// Error contains an error message if Status is "error"
+	Error string `json:"error,omitempty"`
+
+	// FieldErrors names each invalid field of the request, if the
+	// request failed validation
+	FieldErrors []FieldError `json:"field_errors,omitempty"`
+
+	// Version is the tool schema version this response follows
+	Version string `json:"version,omitempty"`
+}
+
+// Directions of the relations get_linked_context follows
+const (
+	// DirectionOutgoing is a relation from the entry it was followed from,
+	// as in "it supersedes this one"
+	DirectionOutgoing = "outgoing"
+
+	// DirectionIncoming is a relation to the entry it was followed from,
+	// as in "this one supersedes it"
+	DirectionIncoming = "incoming"
+)
+
+// LinkContextRequest defines the input schema for link_context tool
+type LinkContextRequest struct {
+	// ID is the entry the relation starts from
+	ID string `json:"id"`
+
+	// RelatedID is the entry the relation points to
+	RelatedID string `json:"related_id"`
+
+	// RelationType is how ID relates to RelatedID: "supersedes",
+	// "elaborates" or "contradicts"
+	RelationType string `json:"relation_type"`
+
+	// Unlink removes the relation instead
+	Unlink bool `json:"unlink,omitempty"`
+
+	// Version is the tool schema version the client was built against.
+	// If omitted, DefaultSchemaVersion is assumed.
+	Version string `json:"version,omitempty"`
+}
+
+// LinkContextResponse defines the output schema for link_context tool
+type LinkContextResponse struct {
+	// Status indicates the result of the operation ("success" or "error")
+	Status string `json:"status"`
+
+	// Linked reports whether the entries are related after the call
+	Linked bool `json:"linked"`
+
+	// Error contains an error message if Status is "error"
+	Error string `json:"error,omitempty"`
+
+	// FieldErrors names each invalid field of the request, if the
+	// request failed validation
+	FieldErrors []FieldError `json:"field_errors,omitempty"`
+
+	// Version is the tool schema version this response follows
+	Version string `json:"version,omitempty"`
+}
+
+// GetLinkedContextRequest defines the input schema for get_linked_context
+// tool
+type GetLinkedContextRequest struct {
+	// ID is the entry whose linked entries to retrieve
+	ID string `json:"id"`
+
+	// RelationType follows only relations of this type. Empty follows
+	// every type.
+	RelationType string `json:"relation_type,omitempty"`
+
+	// Depth is how many relations to follow from ID, 1 if omitted and at
+	// most MaxLinkDepth
+	Depth int `json:"depth,omitempty"`
+
+	// Limit is the maximum number of entries to return
+	Limit int `json:"limit,omitempty"`
+
+	// Version is the tool schema version the client was built against.
+	// If omitted, DefaultSchemaVersion is assumed.
+	Version string `json:"version,omitempty"`
+}
+
+// LinkedContextResult describes an entry reached by following relations
+type LinkedContextResult struct {
+	// ID is the entry's unique identifier
+	ID string `json:"id"`
+
+	// Title is the one-line title of the summary, if it has one
+	Title string `json:"title,omitempty"`
+
+	// Summary is the stored summary text
+	Summary string `json:"summary"`
+
+	// Timestamp is when the entry was stored, in RFC 3339 format
+	Timestamp string `json:"timestamp"`
+
+	// From is the entry the relation was followed from: the requested
+	// entry at depth 1, or an entry returned before it
+	From string `json:"from"`
+
+	// RelationType is the type of the relation between From and the entry
+	RelationType string `json:"relation_type"`
+
+	// Direction is "outgoing" if From relates to the entry, as in "From
+	// supersedes it", or "incoming" if the entry relates to From
+	Direction string `json:"direction"`
+
+	// Depth is the number of relations followed to reach the entry
+	Depth int `json:"depth"`
+}
+
+// GetLinkedContextResponse defines the output schema for
+// get_linked_context tool
+type GetLinkedContextResponse struct {
+	// Status indicates the result of the operation ("success" or "error")
+	Status string `json:"status"`
+
+	// Results lists the linked entries, nearest first, each once
+	Results []LinkedContextResult `json:"results"`
+
+	// Error contains an error message if Status is "error"
+	Error string `json:"error,omitempty"`
+
+	// FieldErrors names each invalid field of the request, if the
+	// request failed validation
+	FieldErrors []FieldError `json:"field_errors,omitempty"`
+
+	// Version is the tool schema version this response follows
+	Version string `json:"version,omitempty"`
+}
+
+// ConsolidateRequest defines the input schema for consolidate tool
+type ConsolidateRequest struct {
+	// Namespace restricts consolidation to one namespace. Empty
+	// consolidates every namespace.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Threshold is the cosine similarity, between 0 and 1, every two
+	// entries of a cluster reach. 0 uses the server's threshold.
+	Threshold float64 `json:"threshold,omitempty"`
+
+	// DryRun lists the clusters without merging them
+	DryRun bool `json:"dry_run,omitempty"`
+
+	// Confirmation is required unless DryRun is set
+	// Must be set to "confirm" to prevent accidental replacement
+	Confirmation string `json:"confirmation,omitempty"`
+
+	// Version is the tool schema version the client was built against.
+	// If omitted, DefaultSchemaVersion is assumed.
+	Version string `json:"version,omitempty"`
+}
+
+// ConsolidatedCluster describes a cluster of highly similar entries
+type ConsolidatedCluster struct {
+	// Namespace is the namespace of the cluster's entries
+	Namespace string `json:"namespace"`
+
+	// IDs are the entries of the cluster, oldest first
+	IDs []string `json:"ids"`
+
+	// ConsolidatedID is the entry that replaced them, empty on a dry run
+	// or if they could not be merged
+	ConsolidatedID string `json:"consolidated_id,omitempty"`
+}
+
+// ConsolidateResponse defines the output schema for consolidate tool
+type ConsolidateResponse struct {
+	// Status indicates the result of the operation ("success" or "error")
+	Status string `json:"status"`
+
+	// Clusters lists the clusters found, oldest first
+	Clusters []ConsolidatedCluster `json:"clusters"`
+
+	// ConsolidatedCount is the number of clusters merged, ReplacedCount
+	// the number of entries they replaced and FailedCount the number of
+	// clusters that could not be merged and were kept
+	ConsolidatedCount int `json:"consolidated_count"`
+	ReplacedCount     int `json:"replaced_count"`
+	FailedCount       int `json:"failed_count"`
+
+	// Error contains an error message if Status is "error"
+	Error string `json:"error,omitempty"`
+
+	// FieldErrors names each invalid field of the request, if the
+	// request failed validation
+	FieldErrors []FieldError `json:"field_errors,omitempty"`
+
+	// Version is the tool schema version this response follows
+	Version string `json:"version,omitempty"`
 }
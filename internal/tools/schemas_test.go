@@ -165,7 +165,7 @@ func TestRetrieveContextRequestMarshaling(t *testing.T) {
 func TestRetrieveContextResponseMarshaling(t *testing.T) {
 	resp := RetrieveContextResponse{
 		Status:  "success",
-		Results: []string{"result1", "result2", "result3"},
+		Results: []ContextEntry{{Summary: "result1"}, {Summary: "result2"}, {Summary: "result3"}},
 	}
 
 	data, err := json.Marshal(resp)
@@ -188,8 +188,8 @@ func TestRetrieveContextResponseMarshaling(t *testing.T) {
 		t.Errorf("Expected %d results, got %d", len(resp.Results), len(results))
 	}
 	for i, result := range results {
-		if resultStr, ok := result.(string); !ok || resultStr != resp.Results[i] {
-			t.Errorf("Expected result[%d]='%s', got '%v'", i, resp.Results[i], result)
+		if resultStr, ok := result.(string); !ok || resultStr != resp.Results[i].Summary {
+			t.Errorf("Expected result[%d]='%s', got '%v'", i, resp.Results[i].Summary, result)
 		}
 	}
 
@@ -0,0 +1,152 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// SchemaVersionV1 is the original tool schema, in which retrieve_context
+	// returns results as a plain []string.
+	SchemaVersionV1 = "1.0"
+
+	// SchemaVersionV1_1 adds the optional provenance and formatted fields
+	// to retrieve_context responses.
+	SchemaVersionV1_1 = "1.1"
+
+	// SchemaVersionV1_2 adds the optional generations field to
+	// retrieve_context responses.
+	SchemaVersionV1_2 = "1.2"
+
+	// SchemaVersionV2 turns retrieve_context results into ContextEntry
+	// objects carrying each entry's ID, score, timestamp and tags.
+	SchemaVersionV2 = "2.0"
+
+	// SchemaVersionV2_1 adds the optional source of each retrieve_context
+	// and retrieve_by_file result.
+	SchemaVersionV2_1 = "2.1"
+
+	// CurrentSchemaVersion is the newest schema version the server speaks.
+	CurrentSchemaVersion = SchemaVersionV2_1
+
+	// DefaultSchemaVersion is assumed when a request carries no version
+	// field. It is the latest 1.x, so clients built before versioning
+	// existed keep receiving results as a plain []string.
+	DefaultSchemaVersion = SchemaVersionV1_2
+)
+
+// ErrUnsupportedSchemaVersion is returned when a request asks for a schema
+// major version the server does not implement.
+var ErrUnsupportedSchemaVersion = errors.New("unsupported schema version")
+
+// latestMinorVersions maps each supported major version to its latest minor
+// release. Minor releases only add optional fields.
+var latestMinorVersions = map[int]int{
+	1: 2,
+	2: 1,
+}
+
+// retrieveContextFields records the schema version that introduced each
+// optional retrieve_context response field, and how to remove it for
+// clients built against an earlier version.
+var retrieveContextFields = []struct {
+	since string
+	strip func(r *RetrieveContextResponse)
+}{
+	{SchemaVersionV1_1, func(r *RetrieveContextResponse) { r.Provenance = nil }},
+	{SchemaVersionV1_1, func(r *RetrieveContextResponse) { r.Formatted = "" }},
+	{SchemaVersionV1_2, func(r *RetrieveContextResponse) { r.Generations = nil }},
+	{SchemaVersionV2_1, func(r *RetrieveContextResponse) {
+		results := make([]ContextEntry, len(r.Results))
+		for i, entry := range r.Results {
+			entry.Source = nil
+			results[i] = entry
+		}
+		r.Results = results
+	}},
+}
+
+// ResolveSchemaVersion maps the version sent by a client to the concrete
+// schema version the response will follow. An empty version resolves to
+// DefaultSchemaVersion; "1" and minors newer than the server knows, such as
+// "1.7", resolve to the latest 1.x, while "1.0" stays 1.0 so the response
+// leaves out fields added since.
+func ResolveSchemaVersion(requested string) (string, error) {
+	requested = strings.TrimPrefix(strings.TrimSpace(requested), "v")
+	if requested == "" {
+		return DefaultSchemaVersion, nil
+	}
+
+	major, minor, err := parseSchemaVersion(requested)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedSchemaVersion, requested)
+	}
+
+	latest, exists := latestMinorVersions[major]
+	if !exists {
+		return "", fmt.Errorf("%w: %q (current is %s)", ErrUnsupportedSchemaVersion, requested, CurrentSchemaVersion)
+	}
+	if minor < 0 || minor > latest {
+		minor = latest
+	}
+	return fmt.Sprintf("%d.%d", major, minor), nil
+}
+
+// parseSchemaVersion splits a MAJOR or MAJOR.MINOR version. The minor is -1
+// if the version has none.
+func parseSchemaVersion(version string) (int, int, error) {
+	majorStr, minorStr, hasMinor := strings.Cut(version, ".")
+	major, err := strconv.Atoi(majorStr)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !hasMinor {
+		return major, -1, nil
+	}
+	minor, err := strconv.Atoi(minorStr)
+	if err != nil || minor < 0 {
+		return 0, 0, fmt.Errorf("invalid minor version %q", minorStr)
+	}
+	return major, minor, nil
+}
+
+// schemaVersionBefore reports whether the resolved version a is older than b.
+func schemaVersionBefore(a, b string) bool {
+	aMajor, aMinor, _ := parseSchemaVersion(a)
+	bMajor, bMinor, _ := parseSchemaVersion(b)
+	if aMajor != bMajor {
+		return aMajor < bMajor
+	}
+	return aMinor < bMinor
+}
+
+// ForVersion adapts a retrieve_context response to the given resolved schema
+// version. Fields introduced after that version are removed so older clients
+// receive exactly the shape they were built against.
+func (r RetrieveContextResponse) ForVersion(version string) RetrieveContextResponse {
+	r.Version = version
+	for _, field := range retrieveContextFields {
+		if schemaVersionBefore(version, field.since) {
+			field.strip(&r)
+		}
+	}
+	return r
+}
+
+// ForVersion adapts a retrieve_by_file response to the given resolved
+// schema version, removing the sources of results for clients built before
+// SchemaVersionV2_1
+func (r RetrieveByFileResponse) ForVersion(version string) RetrieveByFileResponse {
+	r.Version = version
+	if schemaVersionBefore(version, SchemaVersionV2_1) {
+		results := make([]LinkedResult, len(r.Results))
+		for i, result := range r.Results {
+			result.Source = nil
+			results[i] = result
+		}
+		r.Results = results
+	}
+	return r
+}
@@ -0,0 +1,176 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestResolveSchemaVersion(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested string
+		want      string
+		wantErr   bool
+	}{
+		{"empty defaults to latest v1", "", SchemaVersionV1_2, false},
+		{"major only", "1", SchemaVersionV1_2, false},
+		{"exact version", "1.0", SchemaVersionV1, false},
+		{"earlier minor", "1.1", SchemaVersionV1_1, false},
+		{"latest v1", "1.2", SchemaVersionV1_2, false},
+		{"earlier v2 minor", "2.0", SchemaVersionV2, false},
+		{"current version", "2.1", SchemaVersionV2_1, false},
+		{"major only v2", "2", SchemaVersionV2_1, false},
+		{"newer minor of known major", "1.7", SchemaVersionV1_2, false},
+		{"v prefix", "v1.0", SchemaVersionV1, false},
+		{"unknown major", "99", "", true},
+		{"garbage", "latest", "", true},
+		{"garbage minor", "1.x", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ResolveSchemaVersion(test.requested)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ResolveSchemaVersion(%q) error = %v, wantErr %v", test.requested, err, test.wantErr)
+			}
+			if test.wantErr && !errors.Is(err, ErrUnsupportedSchemaVersion) {
+				t.Errorf("Expected ErrUnsupportedSchemaVersion, got %v", err)
+			}
+			if got != test.want {
+				t.Errorf("ResolveSchemaVersion(%q) = %q, want %q", test.requested, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRetrieveContextResponseForV1(t *testing.T) {
+	resp := RetrieveContextResponse{
+		Status:  "success",
+		Results: []ContextEntry{{ID: "a", Summary: "result1"}, {ID: "b", Summary: "result2"}},
+	}.ForVersion(SchemaVersionV1)
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatalf("Failed to marshal RetrieveContextResponse: %v", err)
+	}
+
+	// v1 clients decode results as a plain list of strings
+	var v1 struct {
+		Status  string   `json:"status"`
+		Results []string `json:"results"`
+	}
+	if err := json.Unmarshal(data, &v1); err != nil {
+		t.Fatalf("v1 client failed to decode response: %v", err)
+	}
+	if len(v1.Results) != 2 || v1.Results[0] != "result1" {
+		t.Errorf("Unexpected v1 results: %v", v1.Results)
+	}
+	if resp.Version != SchemaVersionV1 {
+		t.Errorf("Expected version %s, got %s", SchemaVersionV1, resp.Version)
+	}
+}
+
+func TestRetrieveContextResponseForVersion(t *testing.T) {
+	resp := RetrieveContextResponse{
+		Status:      "success",
+		Results:     []ContextEntry{{Summary: "result1"}},
+		Provenance:  [][]string{{"docs/auth.md", "tool:save_context"}},
+		Generations: []*SummaryGeneration{{Summarizer: "ai", Provider: "openai", Model: "gpt-4o"}},
+		Formatted:   "- result1",
+	}
+
+	data, err := json.Marshal(resp.ForVersion(SchemaVersionV1))
+	if err != nil {
+		t.Fatalf("Failed to marshal RetrieveContextResponse: %v", err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	for _, field := range []string{"provenance", "generations", "formatted"} {
+		if _, ok := fields[field]; ok {
+			t.Errorf("Expected a 1.0 response without %q, got %s", field, data)
+		}
+	}
+
+	v1_1 := resp.ForVersion(SchemaVersionV1_1)
+	if len(v1_1.Provenance) != 1 || v1_1.Formatted != "- result1" || v1_1.Generations != nil {
+		t.Errorf("Expected a 1.1 response with provenance and formatted but no generations, got %+v", v1_1)
+	}
+
+	current := resp.ForVersion(SchemaVersionV1_2)
+	if len(current.Generations) != 1 || current.Generations[0].Model != "gpt-4o" {
+		t.Errorf("Expected a 1.2 response to keep generations, got %+v", current)
+	}
+}
+
+func TestRetrieveContextResponseForV2(t *testing.T) {
+	resp := RetrieveContextResponse{
+		Status: "success",
+		Results: []ContextEntry{
+			{ID: "a", Summary: "result1", Score: 0.9, Timestamp: "2024-01-02T03:04:05Z", Tags: []string{"auth"}},
+		},
+	}.ForVersion(SchemaVersionV2)
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatalf("Failed to marshal RetrieveContextResponse: %v", err)
+	}
+	var v2 struct {
+		Results []struct {
+			ID        string   `json:"id"`
+			Summary   string   `json:"summary"`
+			Score     float64  `json:"score"`
+			Timestamp string   `json:"timestamp"`
+			Tags      []string `json:"tags"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(data, &v2); err != nil {
+		t.Fatalf("v2 client failed to decode response: %s: %v", data, err)
+	}
+	if len(v2.Results) != 1 {
+		t.Fatalf("Unexpected v2 results: %s", data)
+	}
+	got := v2.Results[0]
+	if got.ID != "a" || got.Summary != "result1" || got.Score != 0.9 || got.Timestamp != "2024-01-02T03:04:05Z" || len(got.Tags) != 1 {
+		t.Errorf("Unexpected v2 entry: %+v", got)
+	}
+
+	// Responses of either shape decode back into entries
+	for _, version := range []string{SchemaVersionV1, SchemaVersionV2} {
+		data, err := json.Marshal(resp.ForVersion(version))
+		if err != nil {
+			t.Fatalf("Failed to marshal %s response: %v", version, err)
+		}
+		var decoded RetrieveContextResponse
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Failed to decode %s response: %v", version, err)
+		}
+		if len(decoded.Results) != 1 || decoded.Results[0].Summary != "result1" {
+			t.Errorf("Unexpected results decoding %s response: %+v", version, decoded.Results)
+		}
+	}
+}
+
+func TestResponseSourcesForVersion(t *testing.T) {
+	source := &EntrySource{Path: "docs/auth.md", StartLine: 1, EndLine: 4}
+	resp := RetrieveContextResponse{Status: "success", Results: []ContextEntry{{ID: "a", Summary: "result1", Source: source}}}
+	if current := resp.ForVersion(SchemaVersionV2_1); current.Results[0].Source != source {
+		t.Errorf("Expected a 2.1 response to keep sources, got %+v", current.Results[0])
+	}
+	if older := resp.ForVersion(SchemaVersionV2); older.Results[0].Source != nil {
+		t.Errorf("Expected a 2.0 response without sources, got %+v", older.Results[0])
+	}
+	if resp.Results[0].Source != source {
+		t.Errorf("Expected ForVersion to leave the response it adapts alone, got %+v", resp.Results[0])
+	}
+
+	byFile := RetrieveByFileResponse{Status: "success", Results: []LinkedResult{{ID: "a", Path: "docs/auth.md", Source: source}}}
+	if older := byFile.ForVersion(SchemaVersionV1_2); older.Results[0].Source != nil || older.Version != SchemaVersionV1_2 {
+		t.Errorf("Expected a 1.2 retrieve_by_file response without sources, got %+v", older)
+	}
+	if current := byFile.ForVersion(SchemaVersionV2_1); current.Results[0].Source != source {
+		t.Errorf("Expected a 2.1 retrieve_by_file response to keep sources, got %+v", current.Results[0])
+	}
+}
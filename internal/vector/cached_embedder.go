@@ -0,0 +1,305 @@
+package vector
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/telemetry"
+)
+
+const (
+	// DefaultEmbeddingCacheCapacity is the number of embeddings kept in memory.
+	DefaultEmbeddingCacheCapacity = 1000
+
+	// DefaultEmbeddingCacheTTL is how long a cached embedding stays valid.
+	DefaultEmbeddingCacheTTL = 24 * time.Hour
+)
+
+// EmbeddingCacheStore persists cached embeddings across restarts.
+// SQLiteContextStore implements it alongside its context table.
+type EmbeddingCacheStore interface {
+	// LoadCachedEmbedding returns the embedding stored under key if it was
+	// written after notBefore.
+	LoadCachedEmbedding(key string, notBefore time.Time) ([]float32, bool, error)
+
+	// SaveCachedEmbedding stores embedding under key.
+	SaveCachedEmbedding(key string, embedding []float32, createdAt time.Time) error
+}
+
+// EmbeddingCacheConfig holds configuration for a CachedEmbedder.
+type EmbeddingCacheConfig struct {
+	// Capacity is the maximum number of in-memory entries.
+	Capacity int
+
+	// MaxBytes bounds the memory of the in-memory entries' vectors and keys.
+	// 0 bounds only the entry count.
+	MaxBytes int64
+
+	// TTL is how long an entry stays valid, in memory and on disk.
+	TTL time.Duration
+
+	// Namespace is mixed into every key so embeddings from a different
+	// provider, model or dimension count are never served from the cache.
+	Namespace string
+
+	// Store optionally persists entries; nil keeps the cache in memory only.
+	Store EmbeddingCacheStore
+}
+
+// CachedEmbedder wraps an Embedder with a content-hash keyed cache so
+// repeated saves and queries of the same text do not re-call the provider.
+type CachedEmbedder struct {
+	embedder  Embedder
+	namespace string
+	store     EmbeddingCacheStore
+	cache     *embeddingCache
+	metrics   *telemetry.MetricsCollector
+}
+
+// embeddingCache provides thread-safe in-memory caching for embeddings
+type embeddingCache struct {
+	items    map[string]cachedEmbedding
+	capacity int
+	maxBytes int64
+	bytes    int64
+	ttl      time.Duration
+	mu       sync.RWMutex
+}
+
+// cachedEmbedding represents a cached embedding with expiration
+type cachedEmbedding struct {
+	embedding []float32
+	size      int64
+	expireAt  time.Time
+}
+
+// evictOne removes an arbitrary entry. The caller holds mu.
+func (c *embeddingCache) evictOne() {
+	for key, item := range c.items {
+		delete(c.items, key)
+		c.bytes -= item.size
+		return
+	}
+}
+
+// compact replaces the items with a new map holding at most limit unexpired
+// entries, since a map never gives back the memory of deleted entries. The
+// caller holds mu.
+func (c *embeddingCache) compact(limit int) {
+	now := time.Now()
+	items := make(map[string]cachedEmbedding, limit)
+	c.bytes = 0
+	for key, item := range c.items {
+		if len(items) >= limit {
+			break
+		}
+		if now.Before(item.expireAt) {
+			items[key] = item
+			c.bytes += item.size
+		}
+	}
+	c.items = items
+}
+
+// NewCachedEmbedder creates a CachedEmbedder in front of embedder.
+func NewCachedEmbedder(embedder Embedder, config EmbeddingCacheConfig) *CachedEmbedder {
+	if config.Capacity <= 0 {
+		config.Capacity = DefaultEmbeddingCacheCapacity
+	}
+	if config.TTL <= 0 {
+		config.TTL = DefaultEmbeddingCacheTTL
+	}
+
+	return &CachedEmbedder{
+		embedder:  embedder,
+		namespace: config.Namespace,
+		store:     config.Store,
+		cache: &embeddingCache{
+			items:    make(map[string]cachedEmbedding),
+			capacity: config.Capacity,
+			maxBytes: config.MaxBytes,
+			ttl:      config.TTL,
+		},
+		metrics: telemetry.NewMetricsCollector(),
+	}
+}
+
+var (
+	_ SourcedEmbedder = (*CachedEmbedder)(nil)
+	_ ContextEmbedder = (*CachedEmbedder)(nil)
+	_ IdleReleaser    = (*CachedEmbedder)(nil)
+	_ CacheShrinker   = (*CachedEmbedder)(nil)
+)
+
+// Initialize initializes the wrapped embedder.
+func (e *CachedEmbedder) Initialize() error {
+	return e.embedder.Initialize()
+}
+
+// CreateEmbedding returns the cached embedding for text, checking memory
+// first and then the persistent store, and only calls the wrapped embedder
+// on a miss. Persistent store errors are treated as misses.
+func (e *CachedEmbedder) CreateEmbedding(text string) ([]float32, error) {
+	embedding, err := e.CreateSourcedEmbedding(text)
+	if err != nil {
+		return nil, err
+	}
+	return embedding.Vector, nil
+}
+
+// CreateSourcedEmbedding is CreateEmbedding with the provider that made the
+// embedding. Only embeddings from the primary provider are cached, because
+// the cache namespace names the primary's model, so cache hits report no
+// provider and are never fallbacks.
+func (e *CachedEmbedder) CreateSourcedEmbedding(text string) (SourcedEmbedding, error) {
+	return e.CreateSourcedEmbeddingContext(context.Background(), text)
+}
+
+// CreateSourcedEmbeddingContext is CreateSourcedEmbedding, passing ctx on to
+// the wrapped embedder on a miss.
+func (e *CachedEmbedder) CreateSourcedEmbeddingContext(ctx context.Context, text string) (SourcedEmbedding, error) {
+	key := e.cacheKey(text)
+
+	if embedding, found := e.checkCache(key); found {
+		e.metrics.IncrementCounter(telemetry.MetricEmbedderCacheHits, 1)
+		return SourcedEmbedding{Vector: embedding}, nil
+	}
+
+	if e.store != nil {
+		embedding, found, err := e.store.LoadCachedEmbedding(key, time.Now().Add(-e.cache.ttl))
+		if err != nil {
+			e.metrics.IncrementCounter(telemetry.MetricEmbedderCacheErrors, 1)
+		} else if found {
+			e.metrics.IncrementCounter(telemetry.MetricEmbedderCacheHits, 1)
+			e.cacheResult(key, embedding)
+			return SourcedEmbedding{Vector: copyEmbedding(embedding)}, nil
+		}
+	}
+	e.metrics.IncrementCounter(telemetry.MetricEmbedderCacheMisses, 1)
+
+	embedding, err := CreateEmbeddingContext(ctx, e.embedder, text)
+	if err != nil {
+		return SourcedEmbedding{}, err
+	}
+	if embedding.Fallback {
+		return embedding, nil
+	}
+
+	e.cacheResult(key, embedding.Vector)
+	if e.store != nil {
+		if err := e.store.SaveCachedEmbedding(key, embedding.Vector, time.Now()); err != nil {
+			e.metrics.IncrementCounter(telemetry.MetricEmbedderCacheErrors, 1)
+		}
+	}
+
+	embedding.Vector = copyEmbedding(embedding.Vector)
+	return embedding, nil
+}
+
+// ReleaseIdle shrinks the in-memory cache and releases the wrapped
+// embedder's idle resources. With a persistent store every entry is
+// dropped, since it can be loaded again; without one only expired entries
+// are.
+func (e *CachedEmbedder) ReleaseIdle() error {
+	e.cache.mu.Lock()
+	if e.store == nil {
+		e.cache.compact(len(e.cache.items))
+	} else {
+		e.cache.compact(0)
+	}
+	e.updateCacheMetrics()
+	e.cache.mu.Unlock()
+
+	if releaser, ok := e.embedder.(IdleReleaser); ok {
+		return releaser.ReleaseIdle()
+	}
+	return nil
+}
+
+// ShrinkCache drops expired embeddings and keeps at most half of the
+// in-memory cache, so the process can give memory back under pressure.
+// Persisted entries are untouched.
+func (e *CachedEmbedder) ShrinkCache() {
+	e.cache.mu.Lock()
+	defer e.cache.mu.Unlock()
+
+	e.cache.compact(len(e.cache.items) / 2)
+	e.updateCacheMetrics()
+}
+
+// updateCacheMetrics reports the cache's size. The caller holds the cache's mu.
+func (e *CachedEmbedder) updateCacheMetrics() {
+	e.metrics.SetGauge(telemetry.MetricEmbedderCacheSize, float64(len(e.cache.items)))
+	e.metrics.SetGauge(telemetry.MetricEmbedderCacheBytes, float64(e.cache.bytes))
+}
+
+// Unwrap returns the embedder the cache wraps.
+func (e *CachedEmbedder) Unwrap() Embedder {
+	return e.embedder
+}
+
+// GetMetrics returns the metrics collector for this embedder
+func (e *CachedEmbedder) GetMetrics() *telemetry.MetricsCollector {
+	return e.metrics
+}
+
+// cacheKey hashes the namespace and text into a cache key
+func (e *CachedEmbedder) cacheKey(text string) string {
+	hash := sha256.Sum256([]byte(e.namespace + "\x00" + text))
+	return hex.EncodeToString(hash[:])
+}
+
+// checkCache looks for a cached embedding in memory
+func (e *CachedEmbedder) checkCache(key string) ([]float32, bool) {
+	e.cache.mu.RLock()
+	defer e.cache.mu.RUnlock()
+
+	if item, exists := e.cache.items[key]; exists {
+		// Check if the cached item is still valid
+		if time.Now().Before(item.expireAt) {
+			return copyEmbedding(item.embedding), true
+		}
+	}
+
+	return nil, false
+}
+
+// cacheResult stores an embedding in the in-memory cache
+func (e *CachedEmbedder) cacheResult(key string, embedding []float32) {
+	// Count the key and the vector, which dominate an entry's memory
+	size := int64(len(key) + 4*len(embedding))
+
+	e.cache.mu.Lock()
+	defer e.cache.mu.Unlock()
+
+	if existing, exists := e.cache.items[key]; exists {
+		delete(e.cache.items, key)
+		e.cache.bytes -= existing.size
+	}
+
+	// An embedding larger than the whole byte budget is not cached at all
+	if e.cache.maxBytes <= 0 || size <= e.cache.maxBytes {
+		// Enforce cache capacity and byte budget by evicting items if needed
+		for len(e.cache.items) > 0 && (len(e.cache.items) >= e.cache.capacity ||
+			(e.cache.maxBytes > 0 && e.cache.bytes+size > e.cache.maxBytes)) {
+			e.cache.evictOne()
+		}
+
+		e.cache.items[key] = cachedEmbedding{
+			embedding: copyEmbedding(embedding),
+			size:      size,
+			expireAt:  time.Now().Add(e.cache.ttl),
+		}
+		e.cache.bytes += size
+	}
+
+	e.updateCacheMetrics()
+}
+
+// copyEmbedding returns a copy so callers cannot mutate cached vectors
+func copyEmbedding(embedding []float32) []float32 {
+	return append([]float32(nil), embedding...)
+}
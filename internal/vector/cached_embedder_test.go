@@ -0,0 +1,263 @@
+package vector
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/telemetry"
+)
+
+// countingEmbedder counts how often the provider is actually called
+type countingEmbedder struct {
+	*MockEmbedder
+	calls int
+}
+
+func (e *countingEmbedder) CreateEmbedding(text string) ([]float32, error) {
+	e.calls++
+	return e.MockEmbedder.CreateEmbedding(text)
+}
+
+// memoryCacheStore is an in-memory EmbeddingCacheStore for testing
+type memoryCacheStore struct {
+	entries map[string][]float32
+	created map[string]time.Time
+}
+
+func newMemoryCacheStore() *memoryCacheStore {
+	return &memoryCacheStore{
+		entries: make(map[string][]float32),
+		created: make(map[string]time.Time),
+	}
+}
+
+func (s *memoryCacheStore) LoadCachedEmbedding(key string, notBefore time.Time) ([]float32, bool, error) {
+	embedding, exists := s.entries[key]
+	if !exists || s.created[key].Before(notBefore) {
+		return nil, false, nil
+	}
+	return embedding, true, nil
+}
+
+func (s *memoryCacheStore) SaveCachedEmbedding(key string, embedding []float32, createdAt time.Time) error {
+	s.entries[key] = embedding
+	s.created[key] = createdAt
+	return nil
+}
+
+func TestCachedEmbedderHitsAndMisses(t *testing.T) {
+	inner := &countingEmbedder{MockEmbedder: NewMockEmbedder(8)}
+	embedder := NewCachedEmbedder(inner, EmbeddingCacheConfig{})
+
+	first, err := embedder.CreateEmbedding("same text")
+	if err != nil {
+		t.Fatalf("CreateEmbedding() error = %v", err)
+	}
+
+	// Mutating a returned vector must not poison the cache
+	first[0] = 42
+
+	second, err := embedder.CreateEmbedding("same text")
+	if err != nil {
+		t.Fatalf("CreateEmbedding() error = %v", err)
+	}
+	if inner.calls != 1 {
+		t.Errorf("Expected 1 provider call, got %d", inner.calls)
+	}
+	if second[0] == 42 {
+		t.Error("Cached embedding was mutated through a returned slice")
+	}
+
+	if _, err := embedder.CreateEmbedding("other text"); err != nil {
+		t.Fatalf("CreateEmbedding() error = %v", err)
+	}
+	if inner.calls != 2 {
+		t.Errorf("Expected 2 provider calls, got %d", inner.calls)
+	}
+
+	metrics := embedder.GetMetrics()
+	if hits := metrics.GetCounter(telemetry.MetricEmbedderCacheHits); hits != 1 {
+		t.Errorf("Expected 1 cache hit, got %d", hits)
+	}
+	if misses := metrics.GetCounter(telemetry.MetricEmbedderCacheMisses); misses != 2 {
+		t.Errorf("Expected 2 cache misses, got %d", misses)
+	}
+}
+
+func TestCachedEmbedderTTL(t *testing.T) {
+	inner := &countingEmbedder{MockEmbedder: NewMockEmbedder(8)}
+	embedder := NewCachedEmbedder(inner, EmbeddingCacheConfig{TTL: time.Millisecond})
+
+	embedder.CreateEmbedding("text")
+	time.Sleep(5 * time.Millisecond)
+	embedder.CreateEmbedding("text")
+
+	if inner.calls != 2 {
+		t.Errorf("Expected expired entry to be re-embedded, got %d provider calls", inner.calls)
+	}
+}
+
+func TestCachedEmbedderPersistentStore(t *testing.T) {
+	store := newMemoryCacheStore()
+
+	inner := &countingEmbedder{MockEmbedder: NewMockEmbedder(8)}
+	embedder := NewCachedEmbedder(inner, EmbeddingCacheConfig{Namespace: "mock:8", Store: store})
+	if _, err := embedder.CreateEmbedding("persisted text"); err != nil {
+		t.Fatalf("CreateEmbedding() error = %v", err)
+	}
+
+	// A fresh embedder, as after a restart, is served from the store
+	restarted := &countingEmbedder{MockEmbedder: NewMockEmbedder(8)}
+	embedder = NewCachedEmbedder(restarted, EmbeddingCacheConfig{Namespace: "mock:8", Store: store})
+	if _, err := embedder.CreateEmbedding("persisted text"); err != nil {
+		t.Fatalf("CreateEmbedding() error = %v", err)
+	}
+	if restarted.calls != 0 {
+		t.Errorf("Expected persisted embedding to be reused, got %d provider calls", restarted.calls)
+	}
+
+	// A different namespace never sees the other provider's vectors
+	other := &countingEmbedder{MockEmbedder: NewMockEmbedder(16)}
+	embedder = NewCachedEmbedder(other, EmbeddingCacheConfig{Namespace: "mock:16", Store: store})
+	embedding, err := embedder.CreateEmbedding("persisted text")
+	if err != nil {
+		t.Fatalf("CreateEmbedding() error = %v", err)
+	}
+	if other.calls != 1 || len(embedding) != 16 {
+		t.Errorf("Expected a fresh 16-dimension embedding, got %d calls and %d dimensions", other.calls, len(embedding))
+	}
+}
+
+// releasingEmbedder counts how often its idle resources are released
+type releasingEmbedder struct {
+	*countingEmbedder
+	released int
+}
+
+func (e *releasingEmbedder) ReleaseIdle() error {
+	e.released++
+	return nil
+}
+
+func TestCachedEmbedderReleaseIdle(t *testing.T) {
+	inner := &releasingEmbedder{countingEmbedder: &countingEmbedder{MockEmbedder: NewMockEmbedder(8)}}
+	embedder := NewCachedEmbedder(inner, EmbeddingCacheConfig{TTL: time.Hour})
+	embedder.CreateEmbedding("live")
+	embedder.cache.items[embedder.cacheKey("expired")] = cachedEmbedding{embedding: []float32{1}, expireAt: time.Now().Add(-time.Second)}
+
+	// Without a persistent store only expired entries are dropped
+	if err := embedder.ReleaseIdle(); err != nil {
+		t.Fatalf("ReleaseIdle() error = %v", err)
+	}
+	if inner.released != 1 {
+		t.Errorf("Expected the wrapped embedder to be released once, got %d", inner.released)
+	}
+	if size := len(embedder.cache.items); size != 1 {
+		t.Errorf("Expected 1 cached embedding after release, got %d", size)
+	}
+	embedder.CreateEmbedding("live")
+	if inner.calls != 1 {
+		t.Errorf("Expected live entry to stay cached, got %d provider calls", inner.calls)
+	}
+
+	// With a persistent store memory is emptied and refilled from the store
+	store := newMemoryCacheStore()
+	persisted := &countingEmbedder{MockEmbedder: NewMockEmbedder(8)}
+	embedder = NewCachedEmbedder(persisted, EmbeddingCacheConfig{Store: store})
+	embedder.CreateEmbedding("text")
+	if err := embedder.ReleaseIdle(); err != nil {
+		t.Fatalf("ReleaseIdle() error = %v", err)
+	}
+	if size := len(embedder.cache.items); size != 0 {
+		t.Errorf("Expected empty in-memory cache after release, got %d", size)
+	}
+	embedder.CreateEmbedding("text")
+	if persisted.calls != 1 {
+		t.Errorf("Expected released entry to load from the store, got %d provider calls", persisted.calls)
+	}
+}
+
+func TestCachedEmbedderMaxBytes(t *testing.T) {
+	// Each entry is a 64 byte key plus an 8 dimension vector of 32 bytes
+	inner := &countingEmbedder{MockEmbedder: NewMockEmbedder(8)}
+	embedder := NewCachedEmbedder(inner, EmbeddingCacheConfig{MaxBytes: 250})
+	for _, text := range []string{"a", "b", "c", "d", "e"} {
+		if _, err := embedder.CreateEmbedding(text); err != nil {
+			t.Fatalf("CreateEmbedding() error = %v", err)
+		}
+	}
+	if size := len(embedder.cache.items); size != 2 {
+		t.Errorf("Expected 2 cached embeddings within 250 bytes, got %d", size)
+	}
+	if bytes := embedder.GetMetrics().GetGauge(telemetry.MetricEmbedderCacheBytes); bytes != 192 {
+		t.Errorf("Expected 192 cached bytes, got %v", bytes)
+	}
+
+	embedder.ShrinkCache()
+	if size := len(embedder.cache.items); size != 1 {
+		t.Errorf("Expected 1 cached embedding after shrinking, got %d", size)
+	}
+	if embedder.cache.bytes != 96 {
+		t.Errorf("Expected 96 cached bytes after shrinking, got %d", embedder.cache.bytes)
+	}
+
+	// A budget smaller than one entry caches nothing
+	tiny := NewCachedEmbedder(inner, EmbeddingCacheConfig{MaxBytes: 50})
+	tiny.CreateEmbedding("a")
+	if size := len(tiny.cache.items); size != 0 {
+		t.Errorf("Expected nothing cached within 50 bytes, got %d", size)
+	}
+}
+
+func TestCachedEmbedderSkipsFallbacks(t *testing.T) {
+	primary := &switchEmbedder{MockEmbedder: NewMockEmbedder(8), down: true}
+	fallback := &countingEmbedder{MockEmbedder: NewMockEmbedder(8)}
+	chain := NewFallbackEmbedder(
+		NamedEmbedder{Name: "primary", Embedder: primary},
+		[]NamedEmbedder{{Name: "fallback", Embedder: fallback}},
+		FallbackEmbedderConfig{MaxRetries: 1, RetryDelay: time.Nanosecond},
+	)
+	embedder := NewCachedEmbedder(chain, EmbeddingCacheConfig{Namespace: "primary"})
+
+	for i := 0; i < 2; i++ {
+		embedding, err := embedder.CreateSourcedEmbedding("text")
+		if err != nil {
+			t.Fatalf("CreateSourcedEmbedding() error = %v", err)
+		}
+		if !embedding.Fallback {
+			t.Errorf("Expected a fallback embedding on call %d", i+1)
+		}
+	}
+	if fallback.calls != 2 {
+		t.Errorf("Expected fallback embeddings not to be cached, got %d fallback calls", fallback.calls)
+	}
+
+	// Primary embeddings are cached and served as primary
+	primary.down = false
+	for i := 0; i < 2; i++ {
+		embedding, err := embedder.CreateSourcedEmbedding("text")
+		if err != nil {
+			t.Fatalf("CreateSourcedEmbedding() error = %v", err)
+		}
+		if embedding.Fallback {
+			t.Errorf("Expected a primary embedding on call %d", i+1)
+		}
+	}
+	if got := embedder.GetMetrics().GetCounter(telemetry.MetricEmbedderCacheHits); got != 1 {
+		t.Errorf("Expected 1 cache hit, got %d", got)
+	}
+}
+
+// switchEmbedder is a MockEmbedder that fails while down
+type switchEmbedder struct {
+	*MockEmbedder
+	down bool
+}
+
+func (e *switchEmbedder) CreateEmbedding(text string) ([]float32, error) {
+	if e.down {
+		return nil, errors.New("provider unavailable")
+	}
+	return e.MockEmbedder.CreateEmbedding(text)
+}
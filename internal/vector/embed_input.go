@@ -0,0 +1,106 @@
+package vector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// EmbedInput selects which text of a saved entry is embedded.
+type EmbedInput string
+
+const (
+	// EmbedSummary embeds the entry's summary, the default.
+	EmbedSummary EmbedInput = "summary"
+
+	// EmbedOriginal embeds the text the entry was saved from. It keeps the
+	// details a summary drops, such as identifiers and error messages.
+	EmbedOriginal EmbedInput = "original"
+
+	// EmbedBoth embeds the summary and the original text and stores the
+	// average of the two, each scaled to unit length first so neither
+	// outweighs the other.
+	EmbedBoth EmbedInput = "both"
+)
+
+// ErrUnknownEmbedInput is returned by ParseEmbedInput for a name that is
+// not an EmbedInput.
+var ErrUnknownEmbedInput = errors.New("unknown embed input")
+
+// ParseEmbedInput returns the EmbedInput named by s. An empty s is
+// EmbedSummary.
+func ParseEmbedInput(s string) (EmbedInput, error) {
+	switch input := EmbedInput(strings.ToLower(strings.TrimSpace(s))); input {
+	case "":
+		return EmbedSummary, nil
+	case EmbedSummary, EmbedOriginal, EmbedBoth:
+		return input, nil
+	}
+	return "", fmt.Errorf("%w %q: want %q, %q or %q", ErrUnknownEmbedInput, s, EmbedSummary, EmbedOriginal, EmbedBoth)
+}
+
+// CreateEntryEmbedding embeds an entry's summary, its original text or
+// both, as input selects. An empty original, as for entries whose original
+// text is no longer at hand, embeds the summary. When both are embedded the
+// result is reported as a fallback if either embedding is one. It returns
+// ctx.Err() once ctx is done, like CreateEmbeddingContext.
+func CreateEntryEmbedding(ctx context.Context, embedder Embedder, input EmbedInput, summary, original string) (SourcedEmbedding, error) {
+	if strings.TrimSpace(original) == "" {
+		input = EmbedSummary
+	}
+
+	switch input {
+	case EmbedOriginal:
+		return CreateEmbeddingContext(ctx, embedder, original)
+	case EmbedBoth:
+		return createBothEmbedding(ctx, embedder, summary, original)
+	}
+	return CreateEmbeddingContext(ctx, embedder, summary)
+}
+
+// createBothEmbedding embeds summary and original and averages the two
+func createBothEmbedding(ctx context.Context, embedder Embedder, summary, original string) (SourcedEmbedding, error) {
+	fromSummary, err := CreateEmbeddingContext(ctx, embedder, summary)
+	if err != nil {
+		return SourcedEmbedding{}, err
+	}
+	fromOriginal, err := CreateEmbeddingContext(ctx, embedder, original)
+	if err != nil {
+		return SourcedEmbedding{}, err
+	}
+	averaged, err := averageUnit(fromSummary.Vector, fromOriginal.Vector)
+	if err != nil {
+		return SourcedEmbedding{}, err
+	}
+
+	embedding := SourcedEmbedding{Vector: averaged, Provider: fromSummary.Provider}
+	if fromOriginal.Fallback {
+		embedding.Provider, embedding.Fallback = fromOriginal.Provider, true
+	}
+	if fromSummary.Fallback {
+		embedding.Provider, embedding.Fallback = fromSummary.Provider, true
+	}
+	return embedding, nil
+}
+
+// averageUnit returns the average of a and b after scaling each to unit
+// length
+func averageUnit(a, b []float32) ([]float32, error) {
+	if len(a) != len(b) {
+		return nil, fmt.Errorf("%w: embeddings have %d and %d dimensions", ErrInvalidEmbedding, len(a), len(b))
+	}
+	normA, normB := Norm(a), Norm(b)
+	if normA == 0 || normB == 0 {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidEmbedding, ErrZeroMagnitude)
+	}
+
+	averaged := make([]float32, len(a))
+	for i := range a {
+		averaged[i] = float32((float64(a[i])/normA + float64(b[i])/normB) / 2)
+	}
+	if Norm(averaged) == 0 {
+		return nil, fmt.Errorf("%w: summary and original embeddings cancel out", ErrInvalidEmbedding)
+	}
+	return averaged, nil
+}
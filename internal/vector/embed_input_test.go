@@ -0,0 +1,110 @@
+package vector
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// textEmbedder returns a fixed embedding for each text
+type textEmbedder map[string][]float32
+
+func (e textEmbedder) Initialize() error { return nil }
+
+func (e textEmbedder) CreateEmbedding(text string) ([]float32, error) {
+	embedding, ok := e[text]
+	if !ok {
+		return nil, errors.New("no embedding for " + text)
+	}
+	return embedding, nil
+}
+
+// sourcedTextEmbedder is textEmbedder with the texts answered by a fallback
+type sourcedTextEmbedder struct {
+	textEmbedder
+	fallback map[string]bool
+}
+
+func (e sourcedTextEmbedder) CreateSourcedEmbedding(text string) (SourcedEmbedding, error) {
+	embedding, err := e.CreateEmbedding(text)
+	if err != nil {
+		return SourcedEmbedding{}, err
+	}
+	if e.fallback[text] {
+		return SourcedEmbedding{Vector: embedding, Provider: "fallback", Fallback: true}, nil
+	}
+	return SourcedEmbedding{Vector: embedding, Provider: "primary"}, nil
+}
+
+func TestParseEmbedInput(t *testing.T) {
+	tests := []struct {
+		s    string
+		want EmbedInput
+	}{
+		{"", EmbedSummary},
+		{"summary", EmbedSummary},
+		{" Original ", EmbedOriginal},
+		{"both", EmbedBoth},
+	}
+	for _, test := range tests {
+		got, err := ParseEmbedInput(test.s)
+		if err != nil || got != test.want {
+			t.Errorf("ParseEmbedInput(%q) = %q, %v, want %q", test.s, got, err, test.want)
+		}
+	}
+
+	if _, err := ParseEmbedInput("multi-vector"); !errors.Is(err, ErrUnknownEmbedInput) {
+		t.Errorf("Expected ErrUnknownEmbedInput, got %v", err)
+	}
+}
+
+func TestCreateEntryEmbedding(t *testing.T) {
+	embedder := textEmbedder{
+		"summary":  {3, 0},
+		"original": {0, 0.5},
+	}
+	tests := []struct {
+		name     string
+		input    EmbedInput
+		original string
+		want     []float32
+	}{
+		{"summary", EmbedSummary, "original", []float32{3, 0}},
+		{"original", EmbedOriginal, "original", []float32{0, 0.5}},
+		{"both", EmbedBoth, "original", []float32{0.5, 0.5}},
+		{"original unknown", EmbedOriginal, "", []float32{3, 0}},
+		{"both without original", EmbedBoth, " ", []float32{3, 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := CreateEntryEmbedding(context.Background(), embedder, test.input, "summary", test.original)
+			if err != nil {
+				t.Fatalf("CreateEntryEmbedding failed: %v", err)
+			}
+			if !reflect.DeepEqual(got.Vector, test.want) {
+				t.Errorf("Got embedding %v, want %v", got.Vector, test.want)
+			}
+		})
+	}
+}
+
+func TestCreateEntryEmbeddingBothFallback(t *testing.T) {
+	embedder := sourcedTextEmbedder{
+		textEmbedder: textEmbedder{"summary": {1, 0}, "original": {0, 1}},
+		fallback:     map[string]bool{"original": true},
+	}
+	got, err := CreateEntryEmbedding(context.Background(), embedder, EmbedBoth, "summary", "original")
+	if err != nil {
+		t.Fatalf("CreateEntryEmbedding failed: %v", err)
+	}
+	if !got.Fallback || got.Provider != "fallback" {
+		t.Errorf("Expected the fallback provider to be reported, got %+v", got)
+	}
+
+	// Embeddings of different sizes cannot be averaged
+	embedder.textEmbedder["original"] = []float32{0, 1, 0}
+	if _, err := CreateEntryEmbedding(context.Background(), embedder, EmbedBoth, "summary", "original"); !errors.Is(err, ErrInvalidEmbedding) {
+		t.Errorf("Expected ErrInvalidEmbedding, got %v", err)
+	}
+}
@@ -2,11 +2,17 @@
 // and text embedding within the ProjectMemory service.
 package vector
 
+import "context"
+
 const (
 	// DefaultEmbeddingDimensions defines the standard size of embedding vectors.
 	// 1536 is a common size for modern embedding models.
 	DefaultEmbeddingDimensions = 1536
 
+	// MaxEmbeddingDimensions bounds configured and decoded vector sizes so a
+	// bad config value cannot trigger an enormous allocation.
+	MaxEmbeddingDimensions = 65536
+
 	// DefaultBatchSize defines how many embeddings can be processed in a single batch.
 	DefaultBatchSize = 8
 )
@@ -19,3 +25,102 @@ type Embedder interface {
 	// Initialize sets up the embedder with any required configuration.
 	Initialize() error
 }
+
+// SourcedEmbedding is an embedding together with the provider that made it.
+type SourcedEmbedding struct {
+	Vector []float32
+
+	// Provider is the name of the provider that made the embedding. It is
+	// empty when the embedder does not report it, e.g. on a cache hit.
+	Provider string
+
+	// Fallback reports that a fallback provider made the embedding. It may
+	// come from a different model than the stored entries, so it must not be
+	// compared with them.
+	Fallback bool
+}
+
+// IdleReleaser is implemented by embedders that hold resources worth giving
+// back while the server sits idle, such as open HTTP connections and cached
+// embeddings. Wrappers pass the call on to the embedders they wrap.
+type IdleReleaser interface {
+	// ReleaseIdle releases idle resources. The embedder stays usable and
+	// reacquires them on demand.
+	ReleaseIdle() error
+}
+
+// CacheShrinker is implemented by embedders with a cache that can be cut
+// down when the process runs short of memory. Wrappers pass the call on to
+// the embedders they wrap.
+type CacheShrinker interface {
+	// ShrinkCache drops expired entries and about half of the rest.
+	ShrinkCache()
+}
+
+// SourcedEmbedder is implemented by embedders that report which provider
+// made each embedding, such as FallbackEmbedder.
+type SourcedEmbedder interface {
+	Embedder
+
+	// CreateSourcedEmbedding is CreateEmbedding with the provider of the
+	// result.
+	CreateSourcedEmbedding(text string) (SourcedEmbedding, error)
+}
+
+// ContextEmbedder is implemented by embedders that stop waiting on their
+// providers once a context is done, such as HTTPEmbedder. Wrappers pass the
+// context on to the embedders they wrap.
+type ContextEmbedder interface {
+	Embedder
+
+	// CreateSourcedEmbeddingContext is CreateSourcedEmbedding, returning
+	// ctx.Err() once ctx is done.
+	CreateSourcedEmbeddingContext(ctx context.Context, text string) (SourcedEmbedding, error)
+}
+
+// CreateEmbeddingContext embeds text with embedder like
+// CreateSourcedEmbedding, returning ctx.Err() once ctx is done. Embedders
+// that are not ContextEmbedders are left to finish in the background, so
+// the caller stops waiting even when they cannot be interrupted.
+func CreateEmbeddingContext(ctx context.Context, embedder Embedder, text string) (SourcedEmbedding, error) {
+	if err := ctx.Err(); err != nil {
+		return SourcedEmbedding{}, err
+	}
+	if interruptible, ok := embedder.(ContextEmbedder); ok {
+		return interruptible.CreateSourcedEmbeddingContext(ctx, text)
+	}
+	if ctx.Done() == nil {
+		return CreateSourcedEmbedding(embedder, text)
+	}
+
+	type result struct {
+		embedding SourcedEmbedding
+		err       error
+	}
+	done := make(chan result, 1)
+	go func() {
+		embedding, err := CreateSourcedEmbedding(embedder, text)
+		done <- result{embedding, err}
+	}()
+	select {
+	case result := <-done:
+		return result.embedding, result.err
+	case <-ctx.Done():
+		return SourcedEmbedding{}, ctx.Err()
+	}
+}
+
+// CreateSourcedEmbedding embeds text with embedder, reporting the provider
+// if embedder is a SourcedEmbedder. Embeddings from any other embedder are
+// reported as coming from the primary.
+func CreateSourcedEmbedding(embedder Embedder, text string) (SourcedEmbedding, error) {
+	if sourced, ok := embedder.(SourcedEmbedder); ok {
+		return sourced.CreateSourcedEmbedding(text)
+	}
+
+	embedding, err := embedder.CreateEmbedding(text)
+	if err != nil {
+		return SourcedEmbedding{}, err
+	}
+	return SourcedEmbedding{Vector: embedding}, nil
+}
@@ -0,0 +1,119 @@
+package vector
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const (
+	// Embedder provider constants
+	ProviderMock   = "mock"
+	ProviderONNX   = "onnx"
+	ProviderHTTP   = "http"
+	ProviderOpenAI = "openai"
+
+	// openAIEmbeddingsURL is the OpenAI embeddings endpoint.
+	openAIEmbeddingsURL = "https://api.openai.com/v1/embeddings"
+
+	// defaultOpenAIEmbeddingModel is used when no model is configured for OpenAI.
+	defaultOpenAIEmbeddingModel = "text-embedding-3-small"
+)
+
+// Errors
+var (
+	ErrUnknownEmbedderProvider = errors.New("unknown embedder provider")
+	ErrMissingAPIKey           = errors.New("missing API key")
+)
+
+// EmbedderConfig holds configuration for a single embedder provider.
+// Fields that do not apply to a provider are ignored.
+type EmbedderConfig struct {
+	APIKey     string
+	ModelID    string
+	Dimensions int
+
+	// HTTP provider settings. A nil Transport uses http.DefaultTransport.
+	Endpoint     string
+	BodyTemplate string
+	VectorPath   string
+	Transport    http.RoundTripper
+
+	// ONNX provider settings
+	ModelPath   string
+	VocabPath   string
+	LibraryPath string
+}
+
+// EmbedderFactory creates and returns the appropriate embedders
+type EmbedderFactory struct {
+	// ProviderConfigs stores configuration for each provider
+	ProviderConfigs map[string]EmbedderConfig
+}
+
+// NewEmbedderFactory creates a new embedder factory
+func NewEmbedderFactory(configs map[string]EmbedderConfig) *EmbedderFactory {
+	return &EmbedderFactory{
+		ProviderConfigs: configs,
+	}
+}
+
+// GetEmbedder returns an embedder instance for the specified provider name.
+// Unknown providers and providers missing a required API key return an error
+// instead of silently falling back to the mock embedder.
+func (f *EmbedderFactory) GetEmbedder(providerName string) (Embedder, error) {
+	config, exists := f.ProviderConfigs[providerName]
+	if !exists {
+		return nil, fmt.Errorf("configuration for embedder provider '%s' not found", providerName)
+	}
+
+	if config.Dimensions > MaxEmbeddingDimensions {
+		return nil, fmt.Errorf("embedder provider '%s' dimensions %d exceed maximum of %d", providerName, config.Dimensions, MaxEmbeddingDimensions)
+	}
+
+	switch providerName {
+	case ProviderMock:
+		dimensions := config.Dimensions
+		if dimensions <= 0 {
+			dimensions = DefaultEmbeddingDimensions
+		}
+		return NewMockEmbedder(dimensions), nil
+	case ProviderONNX:
+		return newONNXEmbedder(ONNXConfig{
+			ModelPath:   config.ModelPath,
+			VocabPath:   config.VocabPath,
+			LibraryPath: config.LibraryPath,
+			Dimensions:  config.Dimensions,
+		})
+	case ProviderHTTP:
+		if config.Endpoint == "" {
+			return nil, fmt.Errorf("embedder provider '%s' requires an endpoint", providerName)
+		}
+		return NewHTTPEmbedder(HTTPEmbedderConfig{
+			Endpoint:     config.Endpoint,
+			BodyTemplate: config.BodyTemplate,
+			VectorPath:   config.VectorPath,
+			Model:        config.ModelID,
+			APIKey:       config.APIKey,
+			Transport:    config.Transport,
+		}), nil
+	case ProviderOpenAI:
+		if config.APIKey == "" {
+			return nil, fmt.Errorf("%w for embedder provider '%s'", ErrMissingAPIKey, providerName)
+		}
+		model := config.ModelID
+		if model == "" {
+			model = defaultOpenAIEmbeddingModel
+		}
+		return NewHTTPEmbedder(HTTPEmbedderConfig{
+			Endpoint:     openAIEmbeddingsURL,
+			BodyTemplate: `{"input": {{.Text}}, "model": {{.Model}}}`,
+			VectorPath:   "$.data[0].embedding",
+			Model:        model,
+			APIKey:       config.APIKey,
+			Transport:    config.Transport,
+		}), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEmbedderProvider, providerName)
+	}
+}
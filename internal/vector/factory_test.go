@@ -0,0 +1,82 @@
+package vector
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEmbedderFactoryGetEmbedder(t *testing.T) {
+	factory := NewEmbedderFactory(map[string]EmbedderConfig{
+		ProviderMock:   {Dimensions: 64},
+		ProviderHTTP:   {Endpoint: "http://localhost:8080/embed"},
+		ProviderOpenAI: {APIKey: "sk-test"},
+		"bogus":        {},
+	})
+
+	tests := []struct {
+		name     string
+		provider string
+		wantErr  error
+	}{
+		{"mock", ProviderMock, nil},
+		{"http", ProviderHTTP, nil},
+		{"openai", ProviderOpenAI, nil},
+		{"unknown provider", "bogus", ErrUnknownEmbedderProvider},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			embedder, err := factory.GetEmbedder(test.provider)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Errorf("GetEmbedder(%q) error = %v, want %v", test.provider, err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetEmbedder(%q) error = %v", test.provider, err)
+			}
+			if embedder == nil {
+				t.Fatalf("GetEmbedder(%q) returned nil embedder", test.provider)
+			}
+		})
+	}
+}
+
+func TestEmbedderFactoryValidation(t *testing.T) {
+	factory := NewEmbedderFactory(map[string]EmbedderConfig{
+		ProviderOpenAI: {},
+		ProviderHTTP:   {},
+	})
+
+	if _, err := factory.GetEmbedder(ProviderOpenAI); !errors.Is(err, ErrMissingAPIKey) {
+		t.Errorf("Expected ErrMissingAPIKey for openai without key, got %v", err)
+	}
+	if _, err := factory.GetEmbedder(ProviderHTTP); err == nil {
+		t.Error("Expected error for http provider without endpoint")
+	}
+	if _, err := factory.GetEmbedder(ProviderMock); err == nil {
+		t.Error("Expected error for unconfigured provider")
+	}
+
+	factory = NewEmbedderFactory(map[string]EmbedderConfig{ProviderMock: {Dimensions: MaxEmbeddingDimensions + 1}})
+	if _, err := factory.GetEmbedder(ProviderMock); err == nil {
+		t.Error("Expected error for dimensions above MaxEmbeddingDimensions")
+	}
+}
+
+func TestEmbedderFactoryMockDimensions(t *testing.T) {
+	factory := NewEmbedderFactory(map[string]EmbedderConfig{ProviderMock: {Dimensions: 32}})
+	embedder, err := factory.GetEmbedder(ProviderMock)
+	if err != nil {
+		t.Fatalf("GetEmbedder() error = %v", err)
+	}
+
+	embedding, err := embedder.CreateEmbedding("text")
+	if err != nil {
+		t.Fatalf("CreateEmbedding() error = %v", err)
+	}
+	if len(embedding) != 32 {
+		t.Errorf("Expected 32 dimensions, got %d", len(embedding))
+	}
+}
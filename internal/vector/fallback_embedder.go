@@ -0,0 +1,258 @@
+package vector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/telemetry"
+)
+
+const (
+	// Default retry settings for FallbackEmbedder
+	DefaultEmbedderMaxRetries    = 2
+	DefaultEmbedderRetryDelay    = 500 * time.Millisecond
+	DefaultEmbedderMaxRetryDelay = 10 * time.Second
+)
+
+// ErrAllEmbeddersFailed is returned when the primary embedder and every
+// fallback failed to produce a usable embedding.
+var ErrAllEmbeddersFailed = errors.New("all embedding providers failed")
+
+// NamedEmbedder pairs an embedder with the provider name used in metrics.
+type NamedEmbedder struct {
+	Name     string
+	Embedder Embedder
+}
+
+// FallbackEmbedderConfig holds retry settings for a FallbackEmbedder.
+type FallbackEmbedderConfig struct {
+	// MaxRetries is the number of retries per provider after the first attempt.
+	MaxRetries int
+
+	// RetryDelay is the delay before the first retry. It doubles on each
+	// further retry, up to MaxRetryDelay.
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+
+	// Dimensions is the expected embedding size. Fallback embeddings of any
+	// other size are rejected, because vectors of different sizes cannot be
+	// compared with the ones already stored. Once the primary succeeds, its
+	// actual size takes precedence.
+	Dimensions int
+}
+
+// FallbackEmbedder tries a primary embedder with retries and exponential
+// backoff, then each fallback in order, so retrieval keeps working when one
+// embedding API is down.
+//
+// Fallbacks usually run a different model than the primary, so their
+// embeddings are only roughly comparable with stored ones even when the
+// sizes match. CreateSourcedEmbedding reports which provider answered so
+// callers can keep fallback embeddings out of the main index.
+type FallbackEmbedder struct {
+	providers     []NamedEmbedder
+	maxRetries    int
+	retryDelay    time.Duration
+	maxRetryDelay time.Duration
+	dimensions    atomic.Int64
+	metrics       *telemetry.MetricsCollector
+	sleep         func(context.Context, time.Duration) error
+}
+
+// NewFallbackEmbedder creates a FallbackEmbedder that tries primary first and
+// then fallbacks in the given order.
+func NewFallbackEmbedder(primary NamedEmbedder, fallbacks []NamedEmbedder, config FallbackEmbedderConfig) *FallbackEmbedder {
+	if config.MaxRetries <= 0 {
+		config.MaxRetries = DefaultEmbedderMaxRetries
+	}
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = DefaultEmbedderRetryDelay
+	}
+	if config.MaxRetryDelay <= 0 {
+		config.MaxRetryDelay = DefaultEmbedderMaxRetryDelay
+	}
+
+	e := &FallbackEmbedder{
+		providers:     append([]NamedEmbedder{primary}, fallbacks...),
+		maxRetries:    config.MaxRetries,
+		retryDelay:    config.RetryDelay,
+		maxRetryDelay: config.MaxRetryDelay,
+		metrics:       telemetry.NewMetricsCollector(),
+		sleep:         sleepContext,
+	}
+	e.dimensions.Store(int64(config.Dimensions))
+	return e
+}
+
+var (
+	_ SourcedEmbedder = (*FallbackEmbedder)(nil)
+	_ ContextEmbedder = (*FallbackEmbedder)(nil)
+	_ IdleReleaser    = (*FallbackEmbedder)(nil)
+)
+
+// Initialize initializes every provider. Fallbacks that fail to initialize
+// are dropped from the chain; the primary failing is an error.
+func (e *FallbackEmbedder) Initialize() error {
+	if err := e.providers[0].Embedder.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize primary embedder %s: %w", e.providers[0].Name, err)
+	}
+
+	initialized := []NamedEmbedder{e.providers[0]}
+	for _, provider := range e.providers[1:] {
+		if err := provider.Embedder.Initialize(); err != nil {
+			continue
+		}
+		initialized = append(initialized, provider)
+	}
+	e.providers = initialized
+
+	return nil
+}
+
+// CreateEmbedding returns the first usable embedding from the chain.
+func (e *FallbackEmbedder) CreateEmbedding(text string) ([]float32, error) {
+	embedding, err := e.create(context.Background(), text, true)
+	if err != nil {
+		return nil, err
+	}
+	return embedding.Vector, nil
+}
+
+// CreateSourcedEmbedding returns the first usable embedding from the chain
+// and the provider that made it. Fallback embeddings of any size are
+// accepted, because callers must keep them apart from the stored entries
+// anyway.
+func (e *FallbackEmbedder) CreateSourcedEmbedding(text string) (SourcedEmbedding, error) {
+	return e.create(context.Background(), text, false)
+}
+
+// CreateSourcedEmbeddingContext is CreateSourcedEmbedding, giving up on
+// the chain once ctx is done rather than retrying or falling back.
+func (e *FallbackEmbedder) CreateSourcedEmbeddingContext(ctx context.Context, text string) (SourcedEmbedding, error) {
+	return e.create(ctx, text, false)
+}
+
+// create tries each provider in turn until ctx is done. checkDimensions
+// rejects fallback embeddings whose size differs from the primary's.
+func (e *FallbackEmbedder) create(ctx context.Context, text string, checkDimensions bool) (SourcedEmbedding, error) {
+	var lastErr error
+
+	for i, provider := range e.providers {
+		if err := ctx.Err(); err != nil {
+			return SourcedEmbedding{}, err
+		}
+		if i > 0 {
+			e.metrics.IncrementCounter(telemetry.MetricEmbedderFallbackAttempts, 1)
+		}
+
+		start := time.Now()
+		embedding, err := e.createWithRetries(ctx, provider, text, i > 0 && checkDimensions)
+		if err == nil {
+			if i == 0 {
+				e.dimensions.Store(int64(len(embedding)))
+			}
+			e.metrics.IncrementCounter(telemetry.MetricEmbedderCallsSuccess, 1)
+			e.metrics.RecordTimer(telemetry.MetricEmbedderResponseTimePrefix+provider.Name, time.Since(start))
+			if i > 0 {
+				e.metrics.IncrementCounter(telemetry.MetricEmbedderFallbackSuccess, 1)
+			}
+			return SourcedEmbedding{Vector: embedding, Provider: provider.Name, Fallback: i > 0}, nil
+		}
+
+		e.metrics.IncrementCounter(telemetry.MetricEmbedderCallsFailure, 1)
+		lastErr = fmt.Errorf("%s: %w", provider.Name, err)
+	}
+
+	return SourcedEmbedding{}, fmt.Errorf("%w: %w", ErrAllEmbeddersFailed, lastErr)
+}
+
+// createWithRetries calls one provider, retrying with exponential backoff.
+// With checkDimensions, results must also match the primary's dimensions.
+func (e *FallbackEmbedder) createWithRetries(ctx context.Context, provider NamedEmbedder, text string, checkDimensions bool) ([]float32, error) {
+	var lastErr error
+
+	for attempt := 0; attempt <= e.maxRetries; attempt++ {
+		if attempt > 0 {
+			e.metrics.IncrementCounter(telemetry.MetricEmbedderRetryAttempts, 1)
+			if err := e.sleep(ctx, e.backoff(attempt)); err != nil {
+				return nil, err
+			}
+		}
+
+		sourced, err := CreateEmbeddingContext(ctx, provider.Embedder, text)
+		embedding := sourced.Vector
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		if err == nil {
+			err = e.validate(embedding, checkDimensions)
+		}
+		if err == nil {
+			if attempt > 0 {
+				e.metrics.IncrementCounter(telemetry.MetricEmbedderRetrySuccess, 1)
+			}
+			return embedding, nil
+		}
+
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// sleepContext waits for d, returning ctx.Err() if ctx is done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// backoff returns the delay before the given retry attempt (1-based)
+func (e *FallbackEmbedder) backoff(attempt int) time.Duration {
+	delay := e.retryDelay << (attempt - 1)
+	if delay <= 0 || delay > e.maxRetryDelay {
+		return e.maxRetryDelay
+	}
+	return delay
+}
+
+// validate rejects embeddings that could not be stored or compared
+func (e *FallbackEmbedder) validate(embedding []float32, checkDimensions bool) error {
+	if err := ValidateEmbedding(embedding); err != nil {
+		return err
+	}
+	if dimensions := int(e.dimensions.Load()); checkDimensions && dimensions > 0 && len(embedding) != dimensions {
+		return fmt.Errorf("%w: got %d dimensions, want %d", ErrInvalidEmbedding, len(embedding), dimensions)
+	}
+	return nil
+}
+
+// ReleaseIdle releases the idle resources of every provider, returning the
+// first error.
+func (e *FallbackEmbedder) ReleaseIdle() error {
+	var firstErr error
+	for _, provider := range e.providers {
+		releaser, ok := provider.Embedder.(IdleReleaser)
+		if !ok {
+			continue
+		}
+		if err := releaser.ReleaseIdle(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to release idle resources of %s: %w", provider.Name, err)
+		}
+	}
+	return firstErr
+}
+
+// GetMetrics returns the metrics collector for this embedder
+func (e *FallbackEmbedder) GetMetrics() *telemetry.MetricsCollector {
+	return e.metrics
+}
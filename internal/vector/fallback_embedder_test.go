@@ -0,0 +1,205 @@
+package vector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/telemetry"
+)
+
+// flakyEmbedder fails a set number of times before delegating to MockEmbedder
+type flakyEmbedder struct {
+	*MockEmbedder
+	failures int
+	calls    int
+}
+
+func (e *flakyEmbedder) CreateEmbedding(text string) ([]float32, error) {
+	e.calls++
+	if e.calls <= e.failures {
+		return nil, errors.New("provider unavailable")
+	}
+	return e.MockEmbedder.CreateEmbedding(text)
+}
+
+// newTestFallbackEmbedder returns a FallbackEmbedder that records backoff delays instead of sleeping
+func newTestFallbackEmbedder(primary NamedEmbedder, fallbacks []NamedEmbedder, config FallbackEmbedderConfig) (*FallbackEmbedder, *[]time.Duration) {
+	embedder := NewFallbackEmbedder(primary, fallbacks, config)
+	var delays []time.Duration
+	embedder.sleep = func(_ context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	return embedder, &delays
+}
+
+func TestFallbackEmbedderRetriesPrimary(t *testing.T) {
+	primary := &flakyEmbedder{MockEmbedder: NewMockEmbedder(8), failures: 2}
+	embedder, delays := newTestFallbackEmbedder(
+		NamedEmbedder{Name: "primary", Embedder: primary}, nil,
+		FallbackEmbedderConfig{MaxRetries: 3, RetryDelay: 100 * time.Millisecond},
+	)
+
+	if _, err := embedder.CreateEmbedding("text"); err != nil {
+		t.Fatalf("CreateEmbedding() error = %v", err)
+	}
+	if primary.calls != 3 {
+		t.Errorf("Expected 3 calls, got %d", primary.calls)
+	}
+
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}
+	if len(*delays) != len(want) || (*delays)[0] != want[0] || (*delays)[1] != want[1] {
+		t.Errorf("Expected backoff %v, got %v", want, *delays)
+	}
+
+	metrics := embedder.GetMetrics()
+	if got := metrics.GetCounter(telemetry.MetricEmbedderRetryAttempts); got != 2 {
+		t.Errorf("Expected 2 retry attempts, got %d", got)
+	}
+	if got := metrics.GetCounter(telemetry.MetricEmbedderRetrySuccess); got != 1 {
+		t.Errorf("Expected 1 retry success, got %d", got)
+	}
+}
+
+func TestFallbackEmbedderBackoffCapped(t *testing.T) {
+	embedder := NewFallbackEmbedder(NamedEmbedder{Name: "primary", Embedder: NewMockEmbedder(8)}, nil,
+		FallbackEmbedderConfig{RetryDelay: time.Second, MaxRetryDelay: 3 * time.Second})
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 3 * time.Second},
+		{64, 3 * time.Second},
+	}
+	for _, test := range tests {
+		if got := embedder.backoff(test.attempt); got != test.want {
+			t.Errorf("backoff(%d) = %v, want %v", test.attempt, got, test.want)
+		}
+	}
+}
+
+func TestFallbackEmbedderUsesFallback(t *testing.T) {
+	primary := &flakyEmbedder{MockEmbedder: NewMockEmbedder(8), failures: 100}
+	fallback := &flakyEmbedder{MockEmbedder: NewMockEmbedder(8)}
+	embedder, _ := newTestFallbackEmbedder(
+		NamedEmbedder{Name: "primary", Embedder: primary},
+		[]NamedEmbedder{{Name: "fallback", Embedder: fallback}},
+		FallbackEmbedderConfig{MaxRetries: 1, Dimensions: 8},
+	)
+
+	embedding, err := embedder.CreateEmbedding("text")
+	if err != nil {
+		t.Fatalf("CreateEmbedding() error = %v", err)
+	}
+	if len(embedding) != 8 {
+		t.Errorf("Expected 8 dimensions, got %d", len(embedding))
+	}
+	if primary.calls != 2 || fallback.calls != 1 {
+		t.Errorf("Expected 2 primary and 1 fallback calls, got %d and %d", primary.calls, fallback.calls)
+	}
+
+	metrics := embedder.GetMetrics()
+	if got := metrics.GetCounter(telemetry.MetricEmbedderFallbackSuccess); got != 1 {
+		t.Errorf("Expected 1 fallback success, got %d", got)
+	}
+	if got := metrics.GetCounter(telemetry.MetricEmbedderCallsFailure); got != 1 {
+		t.Errorf("Expected 1 failed provider, got %d", got)
+	}
+}
+
+func TestFallbackEmbedderStopsWhenCancelled(t *testing.T) {
+	primary := &flakyEmbedder{MockEmbedder: NewMockEmbedder(8), failures: 100}
+	fallback := &flakyEmbedder{MockEmbedder: NewMockEmbedder(8)}
+	embedder, _ := newTestFallbackEmbedder(
+		NamedEmbedder{Name: "primary", Embedder: primary},
+		[]NamedEmbedder{{Name: "fallback", Embedder: fallback}},
+		FallbackEmbedderConfig{MaxRetries: 3, Dimensions: 8},
+	)
+
+	// The deadline passes during the first backoff
+	ctx, cancel := context.WithCancel(context.Background())
+	embedder.sleep = func(ctx context.Context, _ time.Duration) error {
+		cancel()
+		return ctx.Err()
+	}
+
+	_, err := CreateEmbeddingContext(ctx, embedder, "text")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected %v, got %v", context.Canceled, err)
+	}
+	if primary.calls != 1 || fallback.calls != 0 {
+		t.Errorf("Expected 1 primary and no fallback calls, got %d and %d", primary.calls, fallback.calls)
+	}
+}
+
+func TestFallbackEmbedderRejectsDimensionMismatch(t *testing.T) {
+	primary := &flakyEmbedder{MockEmbedder: NewMockEmbedder(8), failures: 1}
+	fallback := NewMockEmbedder(16)
+	embedder, _ := newTestFallbackEmbedder(
+		NamedEmbedder{Name: "primary", Embedder: primary},
+		[]NamedEmbedder{{Name: "fallback", Embedder: fallback}},
+		FallbackEmbedderConfig{MaxRetries: 1, Dimensions: 8},
+	)
+
+	// The primary succeeds on its retry, establishing 8 dimensions
+	if _, err := embedder.CreateEmbedding("first"); err != nil {
+		t.Fatalf("CreateEmbedding() error = %v", err)
+	}
+
+	primary.calls, primary.failures = 0, 100
+	_, err := embedder.CreateEmbedding("second")
+	if !errors.Is(err, ErrAllEmbeddersFailed) {
+		t.Fatalf("Expected ErrAllEmbeddersFailed, got %v", err)
+	}
+	if !errors.Is(err, ErrInvalidEmbedding) {
+		t.Errorf("Expected the dimension mismatch to be reported, got %v", err)
+	}
+}
+
+func TestFallbackEmbedderSourcedEmbedding(t *testing.T) {
+	primary := &flakyEmbedder{MockEmbedder: NewMockEmbedder(8), failures: 1}
+	embedder, _ := newTestFallbackEmbedder(
+		NamedEmbedder{Name: "primary", Embedder: primary},
+		[]NamedEmbedder{{Name: "fallback", Embedder: NewMockEmbedder(16)}},
+		FallbackEmbedderConfig{MaxRetries: 1, Dimensions: 8},
+	)
+
+	embedding, err := embedder.CreateSourcedEmbedding("first")
+	if err != nil {
+		t.Fatalf("CreateSourcedEmbedding() error = %v", err)
+	}
+	if embedding.Provider != "primary" || embedding.Fallback {
+		t.Errorf("Expected a primary embedding, got provider %q fallback %v", embedding.Provider, embedding.Fallback)
+	}
+
+	// Fallback embeddings of another size are reported rather than rejected
+	primary.calls, primary.failures = 0, 100
+	embedding, err = embedder.CreateSourcedEmbedding("second")
+	if err != nil {
+		t.Fatalf("CreateSourcedEmbedding() error = %v", err)
+	}
+	if embedding.Provider != "fallback" || !embedding.Fallback || len(embedding.Vector) != 16 {
+		t.Errorf("Expected a 16-dimension fallback embedding, got provider %q fallback %v with %d dimensions",
+			embedding.Provider, embedding.Fallback, len(embedding.Vector))
+	}
+}
+
+func TestFallbackEmbedderAllFail(t *testing.T) {
+	embedder, _ := newTestFallbackEmbedder(
+		NamedEmbedder{Name: "primary", Embedder: &flakyEmbedder{MockEmbedder: NewMockEmbedder(8), failures: 100}},
+		[]NamedEmbedder{{Name: "fallback", Embedder: &flakyEmbedder{MockEmbedder: NewMockEmbedder(8), failures: 100}}},
+		FallbackEmbedderConfig{MaxRetries: 1},
+	)
+
+	if _, err := embedder.CreateEmbedding("text"); !errors.Is(err, ErrAllEmbeddersFailed) {
+		t.Errorf("Expected ErrAllEmbeddersFailed, got %v", err)
+	}
+	if got := embedder.GetMetrics().GetCounter(telemetry.MetricEmbedderCallsFailure); got != 2 {
+		t.Errorf("Expected 2 failed providers, got %d", got)
+	}
+}
@@ -0,0 +1,301 @@
+package vector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// DefaultHTTPBodyTemplate matches the request format of Hugging Face
+	// text-embeddings-inference (TEI) and HF inference servers.
+	DefaultHTTPBodyTemplate = `{"inputs": {{.Text}}}`
+
+	// DefaultHTTPVectorPath extracts the first vector from a TEI response.
+	DefaultHTTPVectorPath = "$[0]"
+
+	// DefaultHTTPTimeout is the request timeout used when none is configured.
+	DefaultHTTPTimeout = 30 * time.Second
+)
+
+// HTTPEmbedderConfig holds configuration for the generic HTTP embedder.
+type HTTPEmbedderConfig struct {
+	// Endpoint is the URL the request body is POSTed to.
+	Endpoint string
+
+	// BodyTemplate is a text/template for the JSON request body.
+	// {{.Text}} expands to the JSON-encoded input text (including quotes)
+	// and {{.Model}} to the JSON-encoded model name.
+	BodyTemplate string
+
+	// VectorPath is a JSONPath expression locating the vector in the response,
+	// e.g. "$[0]" or "$.data[0].embedding".
+	VectorPath string
+
+	// Model is an optional model name made available to the body template.
+	Model string
+
+	// APIKey, if set, is sent as a bearer token.
+	APIKey string
+
+	// Headers are additional HTTP headers sent with every request.
+	Headers map[string]string
+
+	// Timeout is the HTTP request timeout.
+	Timeout time.Duration
+
+	// Transport sends the requests. nil uses http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// HTTPEmbedder is an Embedder that calls a user-specified HTTP endpoint,
+// so self-hosted embedding servers can be used without a dedicated provider.
+type HTTPEmbedder struct {
+	config     HTTPEmbedderConfig
+	body       *template.Template
+	path       []jsonPathStep
+	httpClient *http.Client
+}
+
+// NewHTTPEmbedder creates a new HTTPEmbedder with the given configuration.
+func NewHTTPEmbedder(config HTTPEmbedderConfig) *HTTPEmbedder {
+	if config.BodyTemplate == "" {
+		config.BodyTemplate = DefaultHTTPBodyTemplate
+	}
+	if config.VectorPath == "" {
+		config.VectorPath = DefaultHTTPVectorPath
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultHTTPTimeout
+	}
+	return &HTTPEmbedder{
+		config: config,
+		httpClient: &http.Client{
+			Timeout:   config.Timeout,
+			Transport: config.Transport,
+		},
+	}
+}
+
+var (
+	_ ContextEmbedder = (*HTTPEmbedder)(nil)
+	_ IdleReleaser    = (*HTTPEmbedder)(nil)
+)
+
+// Initialize validates the endpoint and parses the body template and vector path.
+func (e *HTTPEmbedder) Initialize() error {
+	if e.config.Endpoint == "" {
+		return fmt.Errorf("HTTP embedder endpoint not provided")
+	}
+
+	body, err := template.New("body").Parse(e.config.BodyTemplate)
+	if err != nil {
+		return fmt.Errorf("invalid body template: %w", err)
+	}
+
+	path, err := parseJSONPath(e.config.VectorPath)
+	if err != nil {
+		return fmt.Errorf("invalid vector path: %w", err)
+	}
+
+	e.body = body
+	e.path = path
+	return nil
+}
+
+// ReleaseIdle closes connections to the endpoint left open by earlier
+// requests.
+func (e *HTTPEmbedder) ReleaseIdle() error {
+	e.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// CreateEmbedding POSTs the templated body and extracts the vector from the response.
+func (e *HTTPEmbedder) CreateEmbedding(text string) ([]float32, error) {
+	return e.createEmbedding(context.Background(), text)
+}
+
+// CreateSourcedEmbeddingContext is CreateEmbedding, abandoning the request
+// once ctx is done.
+func (e *HTTPEmbedder) CreateSourcedEmbeddingContext(ctx context.Context, text string) (SourcedEmbedding, error) {
+	embedding, err := e.createEmbedding(ctx, text)
+	if err != nil {
+		return SourcedEmbedding{}, err
+	}
+	return SourcedEmbedding{Vector: embedding}, nil
+}
+
+// createEmbedding sends the request for text with ctx
+func (e *HTTPEmbedder) createEmbedding(ctx context.Context, text string) ([]float32, error) {
+	if e.body == nil {
+		if err := e.Initialize(); err != nil {
+			return nil, err
+		}
+	}
+
+	textJSON, err := json.Marshal(text)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding text: %w", err)
+	}
+	modelJSON, err := json.Marshal(e.config.Model)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding model: %w", err)
+	}
+
+	var reqBody bytes.Buffer
+	err = e.body.Execute(&reqBody, struct{ Text, Model string }{string(textJSON), string(modelJSON)})
+	if err != nil {
+		return nil, fmt.Errorf("error rendering body template: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.config.Endpoint, &reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if e.config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.config.APIKey)
+	}
+	for k, v := range e.config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request to embedding endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("embedding endpoint returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(respBody, &decoded); err != nil {
+		return nil, fmt.Errorf("error unmarshaling response: %w", err)
+	}
+
+	value, err := evalJSONPath(decoded, e.path)
+	if err != nil {
+		return nil, fmt.Errorf("error extracting vector at %s: %w", e.config.VectorPath, err)
+	}
+
+	return toFloat32Slice(value)
+}
+
+// jsonPathStep is a single step of a parsed JSONPath expression:
+// either an object key or an array index.
+type jsonPathStep struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parseJSONPath parses the subset of JSONPath needed to locate a vector:
+// a leading "$" followed by ".key", "['key']" and "[index]" steps.
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	path = strings.TrimSpace(path)
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("path must start with '$': %q", path)
+	}
+
+	var steps []jsonPathStep
+	rest := path[1:]
+	for len(rest) > 0 {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty key in path %q", path)
+			}
+			steps = append(steps, jsonPathStep{key: rest[:end]})
+			rest = rest[end:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated '[' in path %q", path)
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				steps = append(steps, jsonPathStep{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			index, err := strconv.Atoi(inner)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid array index %q in path %q", inner, path)
+			}
+			steps = append(steps, jsonPathStep{index: index, isIndex: true})
+		default:
+			return nil, fmt.Errorf("unexpected character %q in path %q", rest[0], path)
+		}
+	}
+	return steps, nil
+}
+
+// evalJSONPath walks a decoded JSON document following the given steps.
+func evalJSONPath(doc interface{}, steps []jsonPathStep) (interface{}, error) {
+	current := doc
+	for _, step := range steps {
+		if step.isIndex {
+			arr, ok := current.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("expected array for index %d", step.index)
+			}
+			if step.index >= len(arr) {
+				return nil, fmt.Errorf("index %d out of range (length %d)", step.index, len(arr))
+			}
+			current = arr[step.index]
+			continue
+		}
+
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected object for key %q", step.key)
+		}
+		value, exists := obj[step.key]
+		if !exists {
+			return nil, fmt.Errorf("key %q not found", step.key)
+		}
+		current = value
+	}
+	return current, nil
+}
+
+// toFloat32Slice converts a decoded JSON array of numbers to []float32.
+func toFloat32Slice(value interface{}) ([]float32, error) {
+	arr, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an array of numbers, got %T", value)
+	}
+	if len(arr) == 0 {
+		return nil, fmt.Errorf("embedding vector is empty")
+	}
+
+	result := make([]float32, len(arr))
+	for i, v := range arr {
+		f, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("element %d is not a number", i)
+		}
+		result[i] = float32(f)
+	}
+	return result, nil
+}
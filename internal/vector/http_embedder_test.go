@@ -0,0 +1,126 @@
+package vector
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestHTTPEmbedderCreateEmbedding(t *testing.T) {
+	tests := []struct {
+		name         string
+		bodyTemplate string
+		vectorPath   string
+		response     string
+		wantBody     string
+		want         []float32
+	}{
+		{
+			name:     "TEI defaults",
+			response: `[[0.1, 0.2, 0.3]]`,
+			wantBody: `{"inputs": "hello \"world\""}`,
+			want:     []float32{0.1, 0.2, 0.3},
+		},
+		{
+			name:         "OpenAI-style response",
+			bodyTemplate: `{"input": {{.Text}}, "model": {{.Model}}}`,
+			vectorPath:   "$.data[0].embedding",
+			response:     `{"data": [{"embedding": [1, -1]}]}`,
+			wantBody:     `{"input": "hello \"world\"", "model": "test-model"}`,
+			want:         []float32{1, -1},
+		},
+		{
+			name:       "bracketed key",
+			vectorPath: "$['embeddings'][1]",
+			response:   `{"embeddings": [[0], [0.5, 0.25]]}`,
+			wantBody:   `{"inputs": "hello \"world\""}`,
+			want:       []float32{0.5, 0.25},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var gotBody string
+			var gotAuth string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				gotBody = string(body)
+				gotAuth = r.Header.Get("Authorization")
+				w.Write([]byte(test.response))
+			}))
+			defer server.Close()
+
+			embedder := NewHTTPEmbedder(HTTPEmbedderConfig{
+				Endpoint:     server.URL,
+				BodyTemplate: test.bodyTemplate,
+				VectorPath:   test.vectorPath,
+				Model:        "test-model",
+				APIKey:       "secret",
+			})
+			if err := embedder.Initialize(); err != nil {
+				t.Fatalf("Initialize() error = %v", err)
+			}
+
+			got, err := embedder.CreateEmbedding(`hello "world"`)
+			if err != nil {
+				t.Fatalf("CreateEmbedding() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("CreateEmbedding() = %v, want %v", got, test.want)
+			}
+			if gotBody != test.wantBody {
+				t.Errorf("Expected request body %s, got %s", test.wantBody, gotBody)
+			}
+			if !json.Valid([]byte(gotBody)) {
+				t.Errorf("Request body is not valid JSON: %s", gotBody)
+			}
+			if gotAuth != "Bearer secret" {
+				t.Errorf("Expected bearer authorization header, got %q", gotAuth)
+			}
+		})
+	}
+}
+
+func TestHTTPEmbedderErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		vectorPath string
+		response   string
+	}{
+		{"non-2xx status", http.StatusInternalServerError, "", `{"error": "boom"}`},
+		{"path not found", http.StatusOK, "$.missing", `{"data": []}`},
+		{"not numbers", http.StatusOK, "", `[["a", "b"]]`},
+		{"invalid JSON", http.StatusOK, "", `not json`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+				w.Write([]byte(test.response))
+			}))
+			defer server.Close()
+
+			embedder := NewHTTPEmbedder(HTTPEmbedderConfig{Endpoint: server.URL, VectorPath: test.vectorPath})
+			if _, err := embedder.CreateEmbedding("text"); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestHTTPEmbedderInitializeValidation(t *testing.T) {
+	if err := NewHTTPEmbedder(HTTPEmbedderConfig{}).Initialize(); err == nil {
+		t.Error("Expected error for missing endpoint")
+	}
+	if err := NewHTTPEmbedder(HTTPEmbedderConfig{Endpoint: "http://localhost", VectorPath: "data[0]"}).Initialize(); err == nil {
+		t.Error("Expected error for path without '$'")
+	}
+	if err := NewHTTPEmbedder(HTTPEmbedderConfig{Endpoint: "http://localhost", BodyTemplate: "{{.Text"}).Initialize(); err == nil {
+		t.Error("Expected error for malformed template")
+	}
+}
@@ -0,0 +1,45 @@
+package vector
+
+import "errors"
+
+const (
+	// DefaultONNXDimensions is the output size of all-MiniLM-L6-v2.
+	DefaultONNXDimensions = 384
+
+	// DefaultONNXMaxSequenceLength is the maximum number of tokens fed to the model.
+	DefaultONNXMaxSequenceLength = 256
+)
+
+// ErrONNXUnavailable is returned for the "onnx" provider when the binary was
+// built without the "onnx" build tag.
+var ErrONNXUnavailable = errors.New("ONNX embedder not available: built without the onnx build tag, rebuild with -tags onnx")
+
+// ONNXConfig holds configuration for the local ONNX embedder.
+type ONNXConfig struct {
+	// ModelPath is the path to the sentence-transformer .onnx model file.
+	ModelPath string
+
+	// VocabPath is the path to the model's WordPiece vocab.txt file.
+	VocabPath string
+
+	// LibraryPath is the path to the onnxruntime shared library.
+	// If empty, the platform default is used.
+	LibraryPath string
+
+	// Dimensions is the size of the vectors produced by the model.
+	Dimensions int
+
+	// MaxSequenceLength is the maximum number of tokens per input.
+	MaxSequenceLength int
+}
+
+// withDefaults returns a copy of the config with zero values replaced by defaults.
+func (c ONNXConfig) withDefaults() ONNXConfig {
+	if c.Dimensions <= 0 {
+		c.Dimensions = DefaultONNXDimensions
+	}
+	if c.MaxSequenceLength <= 0 {
+		c.MaxSequenceLength = DefaultONNXMaxSequenceLength
+	}
+	return c
+}
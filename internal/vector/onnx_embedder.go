@@ -0,0 +1,167 @@
+//go:build onnx
+
+package vector
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// ONNXEmbedder runs a sentence-transformer model (e.g. all-MiniLM-L6-v2)
+// in-process through onnxruntime, so no network access is required.
+//
+// Building it requires the "onnx" build tag, the onnxruntime_go module and
+// the onnxruntime shared library on the host.
+type ONNXEmbedder struct {
+	config    ONNXConfig
+	tokenizer *WordPieceTokenizer
+	session   *ort.DynamicAdvancedSession
+	mu        sync.Mutex
+}
+
+// NewONNXEmbedder creates a new ONNXEmbedder with the given configuration.
+func NewONNXEmbedder(config ONNXConfig) *ONNXEmbedder {
+	return &ONNXEmbedder{config: config.withDefaults()}
+}
+
+// newONNXEmbedder creates the embedder for the "onnx" provider
+func newONNXEmbedder(config ONNXConfig) (Embedder, error) {
+	return NewONNXEmbedder(config), nil
+}
+
+// Initialize loads the vocabulary, the onnxruntime library and the model.
+func (e *ONNXEmbedder) Initialize() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.session != nil {
+		return nil
+	}
+
+	if e.config.ModelPath == "" || e.config.VocabPath == "" {
+		return fmt.Errorf("ONNX embedder requires both a model path and a vocabulary path")
+	}
+
+	tokenizer, err := LoadWordPieceTokenizer(e.config.VocabPath)
+	if err != nil {
+		return fmt.Errorf("failed to load tokenizer: %w", err)
+	}
+
+	if !ort.IsInitialized() {
+		if e.config.LibraryPath != "" {
+			ort.SetSharedLibraryPath(e.config.LibraryPath)
+		}
+		if err := ort.InitializeEnvironment(); err != nil {
+			return fmt.Errorf("failed to initialize onnxruntime: %w", err)
+		}
+	}
+
+	session, err := ort.NewDynamicAdvancedSession(e.config.ModelPath,
+		[]string{"input_ids", "attention_mask", "token_type_ids"},
+		[]string{"last_hidden_state"}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to load ONNX model: %w", err)
+	}
+
+	e.tokenizer = tokenizer
+	e.session = session
+	return nil
+}
+
+// CreateEmbedding converts text into a mean-pooled, unit-length vector.
+func (e *ONNXEmbedder) CreateEmbedding(text string) ([]float32, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.session == nil {
+		return nil, fmt.Errorf("ONNX embedder not initialized")
+	}
+
+	ids, mask := e.tokenizer.Encode(text, e.config.MaxSequenceLength)
+	seqLen := int64(len(ids))
+	shape := ort.NewShape(1, seqLen)
+
+	inputIDs, err := ort.NewTensor(shape, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create input_ids tensor: %w", err)
+	}
+	defer inputIDs.Destroy()
+
+	attentionMask, err := ort.NewTensor(shape, mask)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create attention_mask tensor: %w", err)
+	}
+	defer attentionMask.Destroy()
+
+	tokenTypeIDs, err := ort.NewTensor(shape, make([]int64, seqLen))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token_type_ids tensor: %w", err)
+	}
+	defer tokenTypeIDs.Destroy()
+
+	output, err := ort.NewEmptyTensor[float32](ort.NewShape(1, seqLen, int64(e.config.Dimensions)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output tensor: %w", err)
+	}
+	defer output.Destroy()
+
+	err = e.session.Run(
+		[]ort.Value{inputIDs, attentionMask, tokenTypeIDs},
+		[]ort.Value{output})
+	if err != nil {
+		return nil, fmt.Errorf("failed to run ONNX model: %w", err)
+	}
+
+	return meanPool(output.GetData(), mask, e.config.Dimensions), nil
+}
+
+// Close releases the ONNX session.
+func (e *ONNXEmbedder) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.session == nil {
+		return nil
+	}
+	err := e.session.Destroy()
+	e.session = nil
+	return err
+}
+
+// meanPool averages token embeddings weighted by the attention mask and
+// normalizes the result to unit length.
+func meanPool(hidden []float32, mask []int64, dimensions int) []float32 {
+	embedding := make([]float32, dimensions)
+	var tokens float32
+
+	for t, m := range mask {
+		if m == 0 {
+			continue
+		}
+		row := hidden[t*dimensions : (t+1)*dimensions]
+		for i, v := range row {
+			embedding[i] += v
+		}
+		tokens++
+	}
+
+	if tokens == 0 {
+		return embedding
+	}
+
+	var sumSquares float64
+	for i := range embedding {
+		embedding[i] /= tokens
+		sumSquares += float64(embedding[i] * embedding[i])
+	}
+
+	if magnitude := float32(math.Sqrt(sumSquares)); magnitude > 0 {
+		for i := range embedding {
+			embedding[i] /= magnitude
+		}
+	}
+	return embedding
+}
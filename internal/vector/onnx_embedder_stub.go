@@ -0,0 +1,9 @@
+//go:build !onnx
+
+package vector
+
+// newONNXEmbedder reports that ONNX support was not compiled in, so a
+// configured "onnx" provider fails at startup instead of on the first save.
+func newONNXEmbedder(config ONNXConfig) (Embedder, error) {
+	return nil, ErrONNXUnavailable
+}
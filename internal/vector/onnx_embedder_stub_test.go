@@ -0,0 +1,17 @@
+//go:build !onnx
+
+package vector
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestONNXProviderWithoutBuildTag(t *testing.T) {
+	factory := NewEmbedderFactory(map[string]EmbedderConfig{
+		ProviderONNX: {ModelPath: "model.onnx", VocabPath: "vocab.txt"},
+	})
+	if _, err := factory.GetEmbedder(ProviderONNX); !errors.Is(err, ErrONNXUnavailable) {
+		t.Errorf("GetEmbedder(%q) error = %v, want ErrONNXUnavailable", ProviderONNX, err)
+	}
+}
@@ -0,0 +1,105 @@
+package vector
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrZeroMagnitude is returned when the cosine similarity of a zero vector is requested.
+var ErrZeroMagnitude = errors.New("one or both vectors have zero magnitude")
+
+// dot returns the dot product of a and b, which must have the same length.
+// Like dotAndNorms, it is replaced at init with a SIMD implementation when
+// the CPU supports one.
+var dot = dotGeneric
+
+// dotAndNorms returns the dot product of a and b and the squared norms of
+// each in a single pass. a and b must have the same length. It is replaced at
+// init with a SIMD implementation when the CPU supports one.
+var dotAndNorms = dotAndNormsGeneric
+
+// dotAndNormsGeneric is the portable implementation of dotAndNorms. Four
+// independent accumulators per sum break the dependency chain between
+// iterations so the CPU can overlap the multiply-adds.
+func dotAndNormsGeneric(a, b []float32) (dot, normA, normB float32) {
+	b = b[:len(a)]
+
+	var dot0, dot1, dot2, dot3 float32
+	var normA0, normA1, normA2, normA3 float32
+	var normB0, normB1, normB2, normB3 float32
+
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		a0, a1, a2, a3 := a[i], a[i+1], a[i+2], a[i+3]
+		b0, b1, b2, b3 := b[i], b[i+1], b[i+2], b[i+3]
+
+		dot0 += a0 * b0
+		dot1 += a1 * b1
+		dot2 += a2 * b2
+		dot3 += a3 * b3
+
+		normA0 += a0 * a0
+		normA1 += a1 * a1
+		normA2 += a2 * a2
+		normA3 += a3 * a3
+
+		normB0 += b0 * b0
+		normB1 += b1 * b1
+		normB2 += b2 * b2
+		normB3 += b3 * b3
+	}
+
+	dot = (dot0 + dot1) + (dot2 + dot3)
+	normA = (normA0 + normA1) + (normA2 + normA3)
+	normB = (normB0 + normB1) + (normB2 + normB3)
+
+	for ; i < len(a); i++ {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+
+	return dot, normA, normB
+}
+
+// dotGeneric is the portable implementation of dot
+func dotGeneric(a, b []float32) float32 {
+	b = b[:len(a)]
+
+	var dot0, dot1, dot2, dot3 float32
+
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		dot0 += a[i] * b[i]
+		dot1 += a[i+1] * b[i+1]
+		dot2 += a[i+2] * b[i+2]
+		dot3 += a[i+3] * b[i+3]
+	}
+
+	sum := (dot0 + dot1) + (dot2 + dot3)
+	for ; i < len(a); i++ {
+		sum += a[i] * b[i]
+	}
+
+	return sum
+}
+
+// Norm returns the L2 norm of v.
+func Norm(v []float32) float64 {
+	return math.Sqrt(float64(dot(v, v)))
+}
+
+// CosineSimilarityWithNorms is CosineSimilarity for vectors whose L2 norms,
+// as returned by Norm, are already known. Only the dot product is computed,
+// which roughly halves the work when one side is scored against many.
+func CosineSimilarityWithNorms(a, b []float32, normA, normB float64) (float64, error) {
+	if len(a) != len(b) {
+		return 0, fmt.Errorf("vectors must have the same dimension: %d != %d", len(a), len(b))
+	}
+	if normA == 0 || normB == 0 {
+		return 0, ErrZeroMagnitude
+	}
+
+	return float64(dot(a, b)) / (normA * normB), nil
+}
@@ -0,0 +1,60 @@
+//go:build amd64 && !purego
+
+package vector
+
+import "golang.org/x/sys/cpu"
+
+func init() {
+	if cpu.X86.HasAVX2 && cpu.X86.HasFMA {
+		dot = dotAVX2
+		dotAndNorms = dotAndNormsAVX2
+	}
+}
+
+// dotAVX2Kernel processes n elements of a and b, eight at a time.
+// n must be a multiple of 8.
+//
+//go:noescape
+func dotAVX2Kernel(a, b *float32, n int) float32
+
+// dotAVX2 is dot using AVX2 and FMA instructions
+func dotAVX2(a, b []float32) float32 {
+	b = b[:len(a)]
+
+	n := len(a) &^ 7
+	var sum float32
+	if n > 0 {
+		sum = dotAVX2Kernel(&a[0], &b[0], n)
+	}
+
+	for i := n; i < len(a); i++ {
+		sum += a[i] * b[i]
+	}
+
+	return sum
+}
+
+// dotAndNormsAVX2Kernel processes n elements of a and b, eight at a time.
+// n must be a multiple of 8.
+//
+//go:noescape
+func dotAndNormsAVX2Kernel(a, b *float32, n int) (dot, normA, normB float32)
+
+// dotAndNormsAVX2 is dotAndNorms using AVX2 and FMA instructions. The kernel
+// handles the largest multiple of 8 elements and the remainder is added here.
+func dotAndNormsAVX2(a, b []float32) (dot, normA, normB float32) {
+	b = b[:len(a)]
+
+	n := len(a) &^ 7
+	if n > 0 {
+		dot, normA, normB = dotAndNormsAVX2Kernel(&a[0], &b[0], n)
+	}
+
+	for i := n; i < len(a); i++ {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+
+	return dot, normA, normB
+}
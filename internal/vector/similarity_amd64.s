@@ -0,0 +1,140 @@
+//go:build amd64 && !purego
+
+#include "textflag.h"
+
+// func dotAndNormsAVX2Kernel(a, b *float32, n int) (dot, normA, normB float32)
+TEXT ·dotAndNormsAVX2Kernel(SB), NOSPLIT, $0-36
+	MOVQ a+0(FP), SI
+	MOVQ b+8(FP), DI
+	MOVQ n+16(FP), CX
+
+	// Two sets of accumulators: Y0-Y2 and Y3-Y5 hold dot, normA and normB
+	VXORPS Y0, Y0, Y0
+	VXORPS Y1, Y1, Y1
+	VXORPS Y2, Y2, Y2
+	VXORPS Y3, Y3, Y3
+	VXORPS Y4, Y4, Y4
+	VXORPS Y5, Y5, Y5
+
+loop16:
+	CMPQ CX, $16
+	JL   loop8
+
+	VMOVUPS (SI), Y6
+	VMOVUPS (DI), Y7
+	VMOVUPS 32(SI), Y8
+	VMOVUPS 32(DI), Y9
+
+	VFMADD231PS Y7, Y6, Y0
+	VFMADD231PS Y6, Y6, Y1
+	VFMADD231PS Y7, Y7, Y2
+	VFMADD231PS Y9, Y8, Y3
+	VFMADD231PS Y8, Y8, Y4
+	VFMADD231PS Y9, Y9, Y5
+
+	ADDQ $64, SI
+	ADDQ $64, DI
+	SUBQ $16, CX
+	JMP  loop16
+
+loop8:
+	CMPQ CX, $8
+	JL   reduce
+
+	VMOVUPS (SI), Y6
+	VMOVUPS (DI), Y7
+
+	VFMADD231PS Y7, Y6, Y0
+	VFMADD231PS Y6, Y6, Y1
+	VFMADD231PS Y7, Y7, Y2
+
+	ADDQ $32, SI
+	ADDQ $32, DI
+	SUBQ $8, CX
+	JMP  loop8
+
+reduce:
+	VADDPS Y3, Y0, Y0
+	VADDPS Y4, Y1, Y1
+	VADDPS Y5, Y2, Y2
+
+	// Sum the eight lanes of each accumulator
+	VEXTRACTF128 $1, Y0, X6
+	VADDPS       X6, X0, X0
+	VHADDPS      X0, X0, X0
+	VHADDPS      X0, X0, X0
+
+	VEXTRACTF128 $1, Y1, X6
+	VADDPS       X6, X1, X1
+	VHADDPS      X1, X1, X1
+	VHADDPS      X1, X1, X1
+
+	VEXTRACTF128 $1, Y2, X6
+	VADDPS       X6, X2, X2
+	VHADDPS      X2, X2, X2
+	VHADDPS      X2, X2, X2
+
+	VZEROUPPER
+
+	MOVSS X0, dot+24(FP)
+	MOVSS X1, normA+28(FP)
+	MOVSS X2, normB+32(FP)
+	RET
+
+// func dotAVX2Kernel(a, b *float32, n int) float32
+TEXT ·dotAVX2Kernel(SB), NOSPLIT, $0-28
+	MOVQ a+0(FP), SI
+	MOVQ b+8(FP), DI
+	MOVQ n+16(FP), CX
+
+	// Four independent accumulators hide the FMA latency
+	VXORPS Y0, Y0, Y0
+	VXORPS Y1, Y1, Y1
+	VXORPS Y2, Y2, Y2
+	VXORPS Y3, Y3, Y3
+
+dotloop32:
+	CMPQ CX, $32
+	JL   dotloop8
+
+	VMOVUPS (SI), Y4
+	VMOVUPS 32(SI), Y5
+	VMOVUPS 64(SI), Y6
+	VMOVUPS 96(SI), Y7
+
+	VFMADD231PS (DI), Y4, Y0
+	VFMADD231PS 32(DI), Y5, Y1
+	VFMADD231PS 64(DI), Y6, Y2
+	VFMADD231PS 96(DI), Y7, Y3
+
+	ADDQ $128, SI
+	ADDQ $128, DI
+	SUBQ $32, CX
+	JMP  dotloop32
+
+dotloop8:
+	CMPQ CX, $8
+	JL   dotreduce
+
+	VMOVUPS     (SI), Y4
+	VFMADD231PS (DI), Y4, Y0
+
+	ADDQ $32, SI
+	ADDQ $32, DI
+	SUBQ $8, CX
+	JMP  dotloop8
+
+dotreduce:
+	VADDPS Y1, Y0, Y0
+	VADDPS Y3, Y2, Y2
+	VADDPS Y2, Y0, Y0
+
+	VEXTRACTF128 $1, Y0, X4
+	VADDPS       X4, X0, X0
+	VHADDPS      X0, X0, X0
+	VHADDPS      X0, X0, X0
+
+	VZEROUPPER
+
+	MOVSS X0, ret+24(FP)
+	RET
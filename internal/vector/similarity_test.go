@@ -0,0 +1,156 @@
+package vector
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// randomVector returns a vector of n values in [-1, 1)
+func randomVector(rng *rand.Rand, n int) []float32 {
+	v := make([]float32, n)
+	for i := range v {
+		v[i] = rng.Float32()*2 - 1
+	}
+	return v
+}
+
+// closeEnough compares float32 sums that were accumulated in a different order
+func closeEnough(got, want float32) bool {
+	return math.Abs(float64(got-want)) <= 1e-4*math.Max(1, math.Abs(float64(want)))
+}
+
+// TestDotAndNorms checks the selected implementation, which is SIMD on
+// supported CPUs, against a straightforward loop for lengths around every
+// kernel boundary.
+func TestDotAndNorms(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	lengths := []int{0, 1, 3, 4, 7, 8, 9, 15, 16, 17, 31, 33, 384, 768, 1536}
+	for _, n := range lengths {
+		a, b := randomVector(rng, n), randomVector(rng, n)
+
+		var wantDot, wantNormA, wantNormB float32
+		for i := range a {
+			wantDot += a[i] * b[i]
+			wantNormA += a[i] * a[i]
+			wantNormB += b[i] * b[i]
+		}
+
+		implementations := map[string]func(a, b []float32) (float32, float32, float32){
+			"selected": dotAndNorms,
+			"generic":  dotAndNormsGeneric,
+		}
+		for name, fn := range implementations {
+			dot, normA, normB := fn(a, b)
+			if !closeEnough(dot, wantDot) || !closeEnough(normA, wantNormA) || !closeEnough(normB, wantNormB) {
+				t.Errorf("%s(len=%d) = (%v, %v, %v), want (%v, %v, %v)", name, n, dot, normA, normB, wantDot, wantNormA, wantNormB)
+			}
+		}
+	}
+}
+
+func BenchmarkCosineSimilarity(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+
+	for _, dims := range []int{384, 768, 1536} {
+		x, y := randomVector(rng, dims), randomVector(rng, dims)
+
+		b.Run(fmt.Sprintf("dims=%d", dims), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				CosineSimilarity(x, y)
+			}
+		})
+	}
+}
+
+func BenchmarkDotAndNorms(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	x, y := randomVector(rng, 1536), randomVector(rng, 1536)
+
+	b.Run("selected", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			dotAndNorms(x, y)
+		}
+	})
+	b.Run("generic", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			dotAndNormsGeneric(x, y)
+		}
+	})
+}
+
+// BenchmarkScan measures a retrieval-sized scan: one query against thousands
+// of stored 1536-dimension vectors.
+func BenchmarkScan(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	query := randomVector(rng, 1536)
+	stored := make([][]float32, 5000)
+	for i := range stored {
+		stored[i] = randomVector(rng, 1536)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, v := range stored {
+			CosineSimilarity(query, v)
+		}
+	}
+}
+
+// TestDot checks the selected dot implementation against a straightforward loop
+func TestDot(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+
+	for _, n := range []int{0, 1, 7, 8, 9, 31, 32, 33, 40, 1536} {
+		a, b := randomVector(rng, n), randomVector(rng, n)
+
+		var want float32
+		for i := range a {
+			want += a[i] * b[i]
+		}
+
+		if got := dot(a, b); !closeEnough(got, want) {
+			t.Errorf("dot(len=%d) = %v, want %v", n, got, want)
+		}
+		if got := dotGeneric(a, b); !closeEnough(got, want) {
+			t.Errorf("dotGeneric(len=%d) = %v, want %v", n, got, want)
+		}
+	}
+}
+
+func TestCosineSimilarityWithNorms(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	a, b := randomVector(rng, 768), randomVector(rng, 768)
+
+	want, err := CosineSimilarity(a, b)
+	if err != nil {
+		t.Fatalf("CosineSimilarity() error = %v", err)
+	}
+	got, err := CosineSimilarityWithNorms(a, b, Norm(a), Norm(b))
+	if err != nil {
+		t.Fatalf("CosineSimilarityWithNorms() error = %v", err)
+	}
+	if math.Abs(got-want) > 1e-6 {
+		t.Errorf("CosineSimilarityWithNorms() = %v, want %v", got, want)
+	}
+
+	if _, err := CosineSimilarityWithNorms(a, b, 0, Norm(b)); !errors.Is(err, ErrZeroMagnitude) {
+		t.Errorf("Expected ErrZeroMagnitude for a zero norm, got %v", err)
+	}
+	if _, err := CosineSimilarityWithNorms(a, b[:10], Norm(a), Norm(b)); err == nil {
+		t.Error("Expected error for mismatched dimensions")
+	}
+}
+
+func BenchmarkCosineSimilarityWithNorms(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	x, y := randomVector(rng, 1536), randomVector(rng, 1536)
+	normX, normY := Norm(x), Norm(y)
+
+	for i := 0; i < b.N; i++ {
+		CosineSimilarityWithNorms(x, y, normX, normY)
+	}
+}
@@ -1,50 +1,82 @@
 package vector
 
 import (
-	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"math"
 )
 
-// Float32SliceToBytes converts a slice of float32 to a byte slice.
-func Float32SliceToBytes(floats []float32) ([]byte, error) {
-	buf := new(bytes.Buffer)
+// ErrInvalidEmbedding is returned by ValidateEmbedding for vectors that must
+// not be stored or searched with.
+var ErrInvalidEmbedding = errors.New("invalid embedding")
 
-	// First write the length of the slice
-	err := binary.Write(buf, binary.LittleEndian, int32(len(floats)))
-	if err != nil {
-		return nil, fmt.Errorf("failed to write vector length: %w", err)
-	}
+// ErrMalformedVector is returned when an encoded vector's length prefix does
+// not match the number of bytes that follow it.
+var ErrMalformedVector = errors.New("malformed vector data")
 
-	// Then write the float32 values
-	err = binary.Write(buf, binary.LittleEndian, floats)
-	if err != nil {
-		return nil, fmt.Errorf("failed to write vector values: %w", err)
+// Float32SliceToBytes converts a slice of float32 to a byte slice: its
+// length as a little-endian int32, then its values.
+func Float32SliceToBytes(floats []float32) ([]byte, error) {
+	if int64(len(floats)) > math.MaxInt32 {
+		return nil, fmt.Errorf("failed to write vector length: %d values do not fit", len(floats))
 	}
 
-	return buf.Bytes(), nil
+	data := make([]byte, 4+4*len(floats))
+	binary.LittleEndian.PutUint32(data, uint32(len(floats)))
+	for i, value := range floats {
+		binary.LittleEndian.PutUint32(data[4+4*i:], math.Float32bits(value))
+	}
+	return data, nil
 }
 
 // BytesToFloat32Slice converts a byte slice to a slice of float32.
 func BytesToFloat32Slice(data []byte) ([]float32, error) {
-	buf := bytes.NewReader(data)
+	return DecodeFloat32s(nil, data)
+}
+
+// DecodeFloat32s is BytesToFloat32Slice decoding into dst, which is grown
+// if it is too short. Searches reuse one dst for every stored vector they
+// score, so they allocate none per entry.
+func DecodeFloat32s(dst []float32, data []byte) ([]float32, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("failed to read vector length: %w", io.ErrUnexpectedEOF)
+	}
+	length := int32(binary.LittleEndian.Uint32(data))
+	values := data[4:]
 
-	// First read the length of the slice
-	var length int32
-	err := binary.Read(buf, binary.LittleEndian, &length)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read vector length: %w", err)
+	// Validate the length prefix against the payload before allocating, so a
+	// corrupt or hostile blob cannot request an arbitrarily large slice
+	if length < 0 {
+		return nil, fmt.Errorf("%w: negative length %d", ErrMalformedVector, length)
+	}
+	if int64(length)*4 != int64(len(values)) {
+		return nil, fmt.Errorf("%w: length %d needs %d bytes, have %d", ErrMalformedVector, length, int64(length)*4, len(values))
 	}
 
-	// Then read the float32 values
-	floats := make([]float32, length)
-	err = binary.Read(buf, binary.LittleEndian, floats)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read vector values: %w", err)
+	if dst == nil || cap(dst) < int(length) {
+		dst = make([]float32, length)
+	}
+	dst = dst[:length]
+	for i := range dst {
+		dst[i] = math.Float32frombits(binary.LittleEndian.Uint32(values[4*i:]))
 	}
+	return dst, nil
+}
 
-	return floats, nil
+// ValidateEmbedding rejects empty vectors and vectors containing NaN or
+// infinite values. Storing either would break every later search.
+func ValidateEmbedding(embedding []float32) error {
+	if len(embedding) == 0 {
+		return fmt.Errorf("%w: empty vector", ErrInvalidEmbedding)
+	}
+	for i, value := range embedding {
+		if math.IsNaN(float64(value)) || math.IsInf(float64(value), 0) {
+			return fmt.Errorf("%w: non-finite value at index %d", ErrInvalidEmbedding, i)
+		}
+	}
+	return nil
 }
 
 // CosineSimilarity calculates the cosine similarity between two vectors.
@@ -55,20 +87,12 @@ func CosineSimilarity(a, b []float32) (float64, error) {
 		return 0, fmt.Errorf("vectors must have the same dimension: %d != %d", len(a), len(b))
 	}
 
-	// Calculate dot product
-	var dotProduct float32
-	var normA float32
-	var normB float32
-
-	for i := 0; i < len(a); i++ {
-		dotProduct += a[i] * b[i]
-		normA += a[i] * a[i]
-		normB += b[i] * b[i]
-	}
+	// Calculate dot product and norms in one pass
+	dotProduct, normA, normB := dotAndNorms(a, b)
 
 	// Check for zero vectors
 	if normA == 0 || normB == 0 {
-		return 0, fmt.Errorf("one or both vectors have zero magnitude")
+		return 0, ErrZeroMagnitude
 	}
 
 	// Calculate cosine similarity
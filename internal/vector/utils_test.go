@@ -1,6 +1,8 @@
 package vector
 
 import (
+	"encoding/binary"
+	"errors"
 	"math"
 	"reflect"
 	"testing"
@@ -57,6 +59,102 @@ func TestFloat32SliceToBytes(t *testing.T) {
 	}
 }
 
+func TestBytesToFloat32SliceMalformed(t *testing.T) {
+	lengthPrefix := func(n int32) []byte {
+		return binary.LittleEndian.AppendUint32(nil, uint32(n))
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"negative length", lengthPrefix(-1)},
+		{"huge length", lengthPrefix(math.MaxInt32)},
+		{"truncated values", append(lengthPrefix(2), 0, 0, 128, 63)},
+		{"trailing bytes", append(lengthPrefix(1), 0, 0, 128, 63, 0)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := BytesToFloat32Slice(test.data)
+			if !errors.Is(err, ErrMalformedVector) {
+				t.Errorf("Expected ErrMalformedVector, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDecodeFloat32s(t *testing.T) {
+	data, _ := Float32SliceToBytes([]float32{1.0, -2.5, 3.14})
+
+	// A long enough dst is reused
+	dst := make([]float32, 8)
+	floats, err := DecodeFloat32s(dst, data)
+	if err != nil {
+		t.Fatalf("DecodeFloat32s() error = %v", err)
+	}
+	if !reflect.DeepEqual(floats, []float32{1.0, -2.5, 3.14}) || &floats[0] != &dst[0] {
+		t.Errorf("Expected the values decoded into dst, got %v", floats)
+	}
+
+	// A short one is replaced
+	floats, err = DecodeFloat32s(dst[:0:1], data)
+	if err != nil || len(floats) != 3 || &floats[0] == &dst[0] {
+		t.Errorf("Expected the values decoded into a new slice, got %v, %v", floats, err)
+	}
+
+	if _, err := DecodeFloat32s(dst, data[:2]); err == nil {
+		t.Error("Expected an error for a truncated length")
+	}
+}
+
+// BenchmarkDecodeFloat32s compares decoding a stored 1536-dimension vector
+// into a new slice with decoding it into a reused one
+func BenchmarkDecodeFloat32s(b *testing.B) {
+	data, _ := Float32SliceToBytes(make([]float32, 1536))
+
+	b.Run("new", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			BytesToFloat32Slice(data)
+		}
+	})
+	b.Run("reused", func(b *testing.B) {
+		b.ReportAllocs()
+		var dst []float32
+		for b.Loop() {
+			dst, _ = DecodeFloat32s(dst, data)
+		}
+	})
+}
+
+func FuzzBytesToFloat32Slice(f *testing.F) {
+	seed, _ := Float32SliceToBytes([]float32{1.0, -2.5, 3.14})
+	f.Add(seed)
+	f.Add([]byte{})
+	f.Add([]byte{0xff, 0xff, 0xff, 0x7f})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		floats, err := BytesToFloat32Slice(data)
+		if err != nil {
+			return
+		}
+
+		// Anything that decodes must be exactly the prefix plus its values
+		if len(data) != 4+4*len(floats) {
+			t.Fatalf("Decoded %d values from %d bytes", len(floats), len(data))
+		}
+
+		encoded, err := Float32SliceToBytes(floats)
+		if err != nil {
+			t.Fatalf("Float32SliceToBytes() error = %v", err)
+		}
+		if !reflect.DeepEqual(encoded, data) {
+			t.Fatalf("Round trip changed bytes: %v != %v", encoded, data)
+		}
+	})
+}
+
 func TestCosineSimilarity(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -0,0 +1,148 @@
+package vector
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+const (
+	// wordPieceUnknownToken is the token used for words that cannot be tokenized.
+	wordPieceUnknownToken = "[UNK]"
+
+	// wordPieceClassToken marks the start of a sequence.
+	wordPieceClassToken = "[CLS]"
+
+	// wordPieceSeparatorToken marks the end of a sequence.
+	wordPieceSeparatorToken = "[SEP]"
+
+	// wordPieceMaxWordChars is the longest word that will be split into sub-words.
+	wordPieceMaxWordChars = 100
+)
+
+// WordPieceTokenizer implements the uncased BERT WordPiece tokenizer used by
+// sentence-transformer models such as all-MiniLM-L6-v2.
+type WordPieceTokenizer struct {
+	vocab map[string]int64
+}
+
+// NewWordPieceTokenizer creates a tokenizer from the given vocabulary,
+// mapping each token to its id.
+func NewWordPieceTokenizer(vocab map[string]int64) (*WordPieceTokenizer, error) {
+	for _, token := range []string{wordPieceUnknownToken, wordPieceClassToken, wordPieceSeparatorToken} {
+		if _, exists := vocab[token]; !exists {
+			return nil, fmt.Errorf("vocabulary is missing required token %s", token)
+		}
+	}
+	return &WordPieceTokenizer{vocab: vocab}, nil
+}
+
+// LoadWordPieceTokenizer reads a vocab.txt file (one token per line, the line
+// number being the token id) and creates a tokenizer from it.
+func LoadWordPieceTokenizer(vocabPath string) (*WordPieceTokenizer, error) {
+	file, err := os.Open(vocabPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open vocabulary file: %w", err)
+	}
+	defer file.Close()
+
+	vocab := make(map[string]int64)
+	scanner := bufio.NewScanner(file)
+	var id int64
+	for scanner.Scan() {
+		vocab[strings.TrimRight(scanner.Text(), "\r")] = id
+		id++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read vocabulary file: %w", err)
+	}
+
+	return NewWordPieceTokenizer(vocab)
+}
+
+// Encode converts text into token ids wrapped in [CLS] and [SEP], truncated
+// to at most maxLen tokens. It also returns the matching attention mask.
+func (t *WordPieceTokenizer) Encode(text string, maxLen int) ([]int64, []int64) {
+	ids := []int64{t.vocab[wordPieceClassToken]}
+
+	for _, word := range basicTokenize(text) {
+		ids = append(ids, t.wordPiece(word)...)
+	}
+
+	// Leave room for the trailing [SEP]
+	if maxLen > 1 && len(ids) > maxLen-1 {
+		ids = ids[:maxLen-1]
+	}
+	ids = append(ids, t.vocab[wordPieceSeparatorToken])
+
+	mask := make([]int64, len(ids))
+	for i := range mask {
+		mask[i] = 1
+	}
+	return ids, mask
+}
+
+// wordPiece splits a single word into the longest matching sub-word tokens.
+func (t *WordPieceTokenizer) wordPiece(word string) []int64 {
+	chars := []rune(word)
+	if len(chars) > wordPieceMaxWordChars {
+		return []int64{t.vocab[wordPieceUnknownToken]}
+	}
+
+	var ids []int64
+	for start := 0; start < len(chars); {
+		end := len(chars)
+		found := false
+		for end > start {
+			candidate := string(chars[start:end])
+			if start > 0 {
+				candidate = "##" + candidate
+			}
+			if id, exists := t.vocab[candidate]; exists {
+				ids = append(ids, id)
+				found = true
+				break
+			}
+			end--
+		}
+		if !found {
+			// The whole word is unknown if any piece cannot be matched
+			return []int64{t.vocab[wordPieceUnknownToken]}
+		}
+		start = end
+	}
+	return ids
+}
+
+// basicTokenize lowercases the text, drops control characters and splits it
+// on whitespace and punctuation.
+func basicTokenize(text string) []string {
+	var words []string
+	var current strings.Builder
+
+	flush := func() {
+		if current.Len() > 0 {
+			words = append(words, current.String())
+			current.Reset()
+		}
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsSpace(r):
+			flush()
+		case unicode.IsControl(r) || r == unicode.ReplacementChar:
+			// Skip control characters entirely
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			flush()
+			words = append(words, string(r))
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+
+	return words
+}
@@ -0,0 +1,100 @@
+package vector
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testVocab() map[string]int64 {
+	tokens := []string{"[PAD]", "[UNK]", "[CLS]", "[SEP]", "hello", "world", "play", "##ing", "!", ","}
+	vocab := make(map[string]int64, len(tokens))
+	for i, token := range tokens {
+		vocab[token] = int64(i)
+	}
+	return vocab
+}
+
+func TestWordPieceTokenizerEncode(t *testing.T) {
+	tokenizer, err := NewWordPieceTokenizer(testVocab())
+	if err != nil {
+		t.Fatalf("NewWordPieceTokenizer() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		maxLen  int
+		wantIDs []int64
+	}{
+		{
+			name:    "empty string",
+			input:   "",
+			maxLen:  16,
+			wantIDs: []int64{2, 3},
+		},
+		{
+			name:    "lowercases and splits punctuation",
+			input:   "Hello, World!",
+			maxLen:  16,
+			wantIDs: []int64{2, 4, 9, 5, 8, 3},
+		},
+		{
+			name:    "sub-word pieces",
+			input:   "playing",
+			maxLen:  16,
+			wantIDs: []int64{2, 6, 7, 3},
+		},
+		{
+			name:    "unknown word",
+			input:   "hello zebra",
+			maxLen:  16,
+			wantIDs: []int64{2, 4, 1, 3},
+		},
+		{
+			name:    "truncation keeps separator",
+			input:   "hello world hello world",
+			maxLen:  4,
+			wantIDs: []int64{2, 4, 5, 3},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ids, mask := tokenizer.Encode(test.input, test.maxLen)
+			if !reflect.DeepEqual(ids, test.wantIDs) {
+				t.Errorf("Encode(%q) ids = %v, want %v", test.input, ids, test.wantIDs)
+			}
+			if len(mask) != len(ids) {
+				t.Errorf("Expected mask length %d, got %d", len(ids), len(mask))
+			}
+		})
+	}
+}
+
+func TestNewWordPieceTokenizerMissingSpecialTokens(t *testing.T) {
+	_, err := NewWordPieceTokenizer(map[string]int64{"hello": 0})
+	if err == nil {
+		t.Error("Expected error for vocabulary without special tokens")
+	}
+}
+
+func TestLoadWordPieceTokenizer(t *testing.T) {
+	vocabPath := filepath.Join(t.TempDir(), "vocab.txt")
+	content := strings.Join([]string{"[PAD]", "[UNK]", "[CLS]", "[SEP]", "hello"}, "\n")
+	if err := os.WriteFile(vocabPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write vocabulary: %v", err)
+	}
+
+	tokenizer, err := LoadWordPieceTokenizer(vocabPath)
+	if err != nil {
+		t.Fatalf("LoadWordPieceTokenizer() error = %v", err)
+	}
+
+	ids, _ := tokenizer.Encode("hello", 8)
+	if !reflect.DeepEqual(ids, []int64{2, 4, 3}) {
+		t.Errorf("Expected ids [2 4 3], got %v", ids)
+	}
+}
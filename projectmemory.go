@@ -1,16 +1,41 @@
 package projectmemory
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/localrivet/projectmemory/internal/analytics"
+	"github.com/localrivet/projectmemory/internal/archive"
+	"github.com/localrivet/projectmemory/internal/auth"
+	"github.com/localrivet/projectmemory/internal/cassette"
+	"github.com/localrivet/projectmemory/internal/chaos"
+	"github.com/localrivet/projectmemory/internal/cleanup"
 	"github.com/localrivet/projectmemory/internal/config"
+	"github.com/localrivet/projectmemory/internal/consolidate"
 	"github.com/localrivet/projectmemory/internal/contextstore"
 	"github.com/localrivet/projectmemory/internal/errortypes"
+	"github.com/localrivet/projectmemory/internal/eval"
+	"github.com/localrivet/projectmemory/internal/expansion"
+	"github.com/localrivet/projectmemory/internal/git"
+	"github.com/localrivet/projectmemory/internal/hyde"
+	"github.com/localrivet/projectmemory/internal/ingest"
+	"github.com/localrivet/projectmemory/internal/regenerate"
+	"github.com/localrivet/projectmemory/internal/rerank"
+	"github.com/localrivet/projectmemory/internal/retrieval"
 	"github.com/localrivet/projectmemory/internal/server"
 	"github.com/localrivet/projectmemory/internal/summarizer"
+	"github.com/localrivet/projectmemory/internal/summarizer/providers"
+	"github.com/localrivet/projectmemory/internal/tokenizer"
+	"github.com/localrivet/projectmemory/internal/tools"
 	"github.com/localrivet/projectmemory/internal/util"
 	"github.com/localrivet/projectmemory/internal/vector"
 )
@@ -24,22 +49,46 @@ type Server struct {
 	store      contextstore.ContextStore
 	summarizer summarizer.Summarizer
 	embedder   vector.Embedder
+	embedInput vector.EmbedInput
 	toolServer server.ContextToolServer
-	logger     *slog.Logger // Logger for this Server instance
+	archive    archive.Target // nil unless Store.ArchiveTarget is set
+	logger     *slog.Logger   // Logger for this Server instance
+
+	// tools is toolServer, which runs queries
+	tools *server.MCPContextToolServer
 }
 
 // ServerOptions defines the options for creating a new Server.
 type ServerOptions struct {
-	Config     *Config      // Pre-filled config. If nil, ConfigPath is used.
+	Config     *Config      // Pre-filled config, copied by NewServer. If nil, ConfigPath is used.
 	ConfigPath string       // Path to config file. Used if Config is nil. If both are empty, DefaultConfig() is used.
 	Logger     *slog.Logger // External logger. If nil, slog.Default() is used.
+	Chaos      bool         // Inject faults into the store, summarizer and embedder. Development only.
+
+	// RecordCassette records the summarizer and embedder providers' HTTP
+	// requests and responses, with API keys redacted, to this file.
+	// ReplayCassette answers them from a recorded file instead of the
+	// network. At most one may be set. Development and tests only.
+	RecordCassette string
+	ReplayCassette string
+
+	// Store, Summarizer and Embedder replace the components the config
+	// describes, such as NewMemoryStore, NewFakeSummarizer and
+	// NewFakeEmbedder in tests and examples. They must be set together and
+	// ready to use; the cassette options do not apply to them.
+	Store      ContextStore
+	Summarizer Summarizer
+	Embedder   Embedder
 }
 
 // NewServer creates a new ProjectMemory Server with the given options.
-// If opts.Config is provided, it will be used directly.
+// If opts.Config is provided, the server uses a copy of it, so one Config
+// can create several servers and be changed afterwards without affecting
+// them.
 // Otherwise, if opts.ConfigPath is provided, configuration will be loaded from that path.
 // If neither is provided, DefaultConfig() will be used.
-// If opts.Logger is nil, slog.Default() will be used.
+// Everything the server logs goes to opts.Logger, or to slog.Default() if it
+// is nil, so servers with different loggers can share a process.
 func NewServer(opts ServerOptions) (*Server, error) {
 	logger := opts.Logger
 	if logger == nil {
@@ -50,7 +99,7 @@ func NewServer(opts ServerOptions) (*Server, error) {
 	var err error
 
 	if opts.Config != nil {
-		cfg = opts.Config
+		cfg = opts.Config.Clone()
 		logger.Info("Using provided Config object for server initialization")
 	} else if opts.ConfigPath != "" {
 		logger.Info("Loading configuration for server initialization", "path", opts.ConfigPath)
@@ -64,16 +113,311 @@ func NewServer(opts ServerOptions) (*Server, error) {
 		cfg = DefaultConfig()
 	}
 
-	store, sum, emb, err := CreateComponents(cfg, logger) // Pass logger to CreateComponents
+	// Provider requests go through transport, a cassette when recording or
+	// replaying one
+	var transport http.RoundTripper
+	store, sum, emb := opts.Store, opts.Summarizer, opts.Embedder
+	switch {
+	case store != nil && sum != nil && emb != nil:
+		logger.Info("Using provided store, summarizer and embedder for server initialization")
+	case store != nil || sum != nil || emb != nil:
+		return nil, errortypes.ConfigError(ErrIncompleteComponents, "Invalid server components")
+	default:
+		transport, err = cassetteTransport(opts, logger)
+		if err != nil {
+			return nil, err
+		}
+
+		store, sum, emb, err = createComponents(cfg, logger, transport)
+		if err != nil {
+			// CreateComponents already logs the specific error
+			logger.Error("Failed to create components during server initialization", "error", err)
+			return nil, err // Return the original error which should be specific enough
+		}
+	}
+
+	if opts.Chaos {
+		chaosConfig := chaos.LoadConfigFromEnvironment()
+		logger.Warn("Chaos mode enabled: injecting faults into store, summarizer and embedder",
+			"error_rate", chaosConfig.ErrorRate,
+			"latency_rate", chaosConfig.LatencyRate,
+			"latency", chaosConfig.Latency,
+			"malformed_rate", chaosConfig.MalformedRate)
+		store = chaos.WrapStore(store, chaosConfig)
+		sum = chaos.WrapSummarizer(sum, chaosConfig)
+		emb = chaos.WrapEmbedder(emb, chaosConfig)
+	}
+
+	policy, err := CleanupPolicy(cfg)
 	if err != nil {
-		// CreateComponents already logs the specific error
-		logger.Error("Failed to create components during server initialization", "error", err)
-		return nil, err // Return the original error which should be specific enough
+		logger.Error("Invalid cleanup policy", "error", err)
+		return nil, err
+	}
+
+	reviewOptions, err := ReviewOptions(cfg)
+	if err != nil {
+		logger.Error("Invalid review options", "error", err)
+		return nil, err
+	}
+
+	retrievalDefaults, err := RetrievalDefaults(cfg)
+	if err != nil {
+		logger.Error("Invalid retrieval defaults", "error", err)
+		return nil, err
 	}
 
 	logger.Info("Initializing context tool server component")
 	mcpServer := server.NewContextToolServer(store, sum, emb)
-	err = mcpServer.Initialize() // Note: mcpServer.Initialize still uses global slog internally
+	mcpServer.SetLogger(logger)
+	mcpServer.SetCleanupPolicy(policy)
+	mcpServer.SetReviewOptions(reviewOptions)
+	embedInput, err := vector.ParseEmbedInput(cfg.Embedder.Input)
+	if err != nil {
+		logger.Error("Invalid embedder input", "input", cfg.Embedder.Input, "error", err)
+		return nil, errortypes.ConfigError(err, "Invalid embedder input")
+	}
+	mcpServer.SetEmbedInput(embedInput)
+	mcpServer.SetMinInputLength(cfg.Summarizer.MinInputLength)
+	injectionMode, err := retrieval.ParseInjectionMode(cfg.Retrieval.InjectionMode)
+	if err != nil {
+		logger.Error("Invalid injection mode", "mode", cfg.Retrieval.InjectionMode, "error", err)
+		return nil, errortypes.ConfigError(err, "Invalid injection mode")
+	}
+	mcpServer.SetInjectionMode(injectionMode)
+	retrievalTokenizer, err := tokenizer.New(cfg.Retrieval.Tokenizer, cfg.Retrieval.TokenizerFile)
+	if err != nil {
+		logger.Error("Invalid retrieval tokenizer", "tokenizer", cfg.Retrieval.Tokenizer, "error", err)
+		return nil, errortypes.ConfigError(err, "Invalid retrieval tokenizer")
+	}
+	mcpServer.SetTokenizer(retrievalTokenizer)
+	rerankMode, err := retrieval.ParseStageMode(cfg.Retrieval.Rerank.Mode)
+	if err != nil {
+		logger.Error("Invalid rerank mode", "mode", cfg.Retrieval.Rerank.Mode, "error", err)
+		return nil, errortypes.ConfigError(err, "Invalid rerank mode")
+	}
+	if rerankMode != retrieval.StageOff {
+		reranker, err := newReranker(cfg, transport)
+		if err != nil {
+			logger.Error("Invalid rerank configuration", "error", err)
+			return nil, errortypes.ConfigError(err, "Invalid rerank configuration")
+		}
+		mcpServer.SetReranker(reranker, cfg.Retrieval.Rerank.Candidates, rerankMode == retrieval.StageAlways)
+	}
+	expansionMode, err := retrieval.ParseStageMode(cfg.Retrieval.Expansion.Mode)
+	if err != nil {
+		logger.Error("Invalid expansion mode", "mode", cfg.Retrieval.Expansion.Mode, "error", err)
+		return nil, errortypes.ConfigError(err, "Invalid expansion mode")
+	}
+	if expansionMode != retrieval.StageOff {
+		expander, err := newQueryExpander(cfg, transport)
+		if err != nil {
+			logger.Error("Invalid expansion configuration", "error", err)
+			return nil, errortypes.ConfigError(err, "Invalid expansion configuration")
+		}
+		mcpServer.SetQueryExpander(expander, cfg.Retrieval.Expansion.Queries, expansionMode == retrieval.StageAlways)
+	}
+	hydeMode, err := retrieval.ParseStageMode(cfg.Retrieval.HyDE.Mode)
+	if err != nil {
+		logger.Error("Invalid hyde mode", "mode", cfg.Retrieval.HyDE.Mode, "error", err)
+		return nil, errortypes.ConfigError(err, "Invalid hyde mode")
+	}
+	if hydeMode != retrieval.StageOff {
+		settings := cfg.Retrieval.HyDE
+		completer, err := llmCompleter(cfg, "hyde", settings.Provider, settings.ModelID, settings.ApiKey, transport)
+		if err != nil {
+			logger.Error("Invalid hyde configuration", "error", err)
+			return nil, errortypes.ConfigError(err, "Invalid hyde configuration")
+		}
+		mcpServer.SetDrafter(hyde.NewLLMDrafter(completer), hydeMode == retrieval.StageAlways)
+	}
+	if err := mcpServer.SetRetrievalDefaults(retrievalDefaults); err != nil {
+		logger.Error("Invalid retrieval defaults", "error", err)
+		return nil, errortypes.ConfigError(err, "Invalid retrieval defaults")
+	}
+	if cfg.Store.ClearGracePeriod != "" {
+		gracePeriod, err := time.ParseDuration(cfg.Store.ClearGracePeriod)
+		if err != nil {
+			logger.Error("Invalid clear grace period", "clear_grace_period", cfg.Store.ClearGracePeriod, "error", err)
+			return nil, errortypes.ConfigError(err, "Invalid clear grace period")
+		}
+		mcpServer.SetClearGracePeriod(gracePeriod)
+	}
+	var archiveTarget archive.Target
+	if cfg.Store.ArchiveTarget != "" {
+		archiveTarget, err = archive.OpenTarget(cfg.Store.ArchiveTarget, nil)
+		if err != nil {
+			logger.Error("Invalid archive target", "archive_target", cfg.Store.ArchiveTarget, "error", err)
+			return nil, errortypes.ConfigError(err, "Invalid archive target")
+		}
+		mcpServer.SetArchiveTarget(archiveTarget)
+	}
+	if cfg.Idle.Timeout != "" || cfg.Idle.ReleaseStore {
+		idleTimeout := server.DefaultIdleTimeout
+		if cfg.Idle.Timeout != "" {
+			idleTimeout, err = time.ParseDuration(cfg.Idle.Timeout)
+			if err != nil {
+				logger.Error("Invalid idle timeout", "timeout", cfg.Idle.Timeout, "error", err)
+				return nil, errortypes.ConfigError(err, "Invalid idle timeout")
+			}
+		}
+		mcpServer.SetIdleRelease(idleTimeout, cfg.Idle.ReleaseStore)
+	}
+	authenticator, err := Authenticator(cfg)
+	if err != nil {
+		logger.Error("Invalid authentication configuration", "error", err)
+		return nil, err
+	}
+	if authenticator != nil {
+		mcpServer.SetAuthenticator(authenticator)
+	}
+	tlsConfig, err := TransportTLS(cfg)
+	if err != nil {
+		logger.Error("Invalid TLS configuration", "error", err)
+		return nil, err
+	}
+	if tlsConfig != nil {
+		mcpServer.SetTLS(tlsConfig)
+	}
+	if cfg.QuickCapture.Addr != "" {
+		if err := mcpServer.SetQuickCapture(cfg.QuickCapture.Addr, cfg.QuickCapture.Token); err != nil {
+			logger.Error("Invalid quick-capture configuration", "addr", cfg.QuickCapture.Addr, "error", err)
+			return nil, errortypes.ConfigError(err, "Invalid quick-capture configuration")
+		}
+	}
+	if cfg.GRPC.Addr != "" {
+		if err := mcpServer.SetGRPC(cfg.GRPC.Addr, cfg.GRPC.Token); err != nil {
+			logger.Error("Invalid gRPC configuration", "addr", cfg.GRPC.Addr, "error", err)
+			return nil, errortypes.ConfigError(err, "Invalid gRPC configuration")
+		}
+	}
+	if cfg.Metrics.Addr != "" {
+		if err := mcpServer.SetMetrics(cfg.Metrics.Addr); err != nil {
+			logger.Error("Invalid metrics configuration", "addr", cfg.Metrics.Addr, "error", err)
+			return nil, errortypes.ConfigError(err, "Invalid metrics configuration")
+		}
+	}
+	if cfg.Requests.Timeout != "" {
+		timeout, err := time.ParseDuration(cfg.Requests.Timeout)
+		if err != nil {
+			logger.Error("Invalid request timeout", "timeout", cfg.Requests.Timeout, "error", err)
+			return nil, errortypes.ConfigError(err, "Invalid request timeout")
+		}
+		mcpServer.SetRequestTimeout(timeout)
+	}
+	if cfg.Requests.MaxTextLength < 0 || cfg.Requests.MaxQueryLength < 0 || cfg.Requests.MaxLimit < 0 {
+		err := errors.New("request limits must not be negative")
+		logger.Error("Invalid request limits", "error", err)
+		return nil, errortypes.ConfigError(err, "Invalid request limits")
+	}
+	if err := mcpServer.SetDisabledTools(cfg.Tools.Disabled); err != nil {
+		logger.Error("Invalid disabled tools", "tools", cfg.Tools.Disabled, "error", err)
+		return nil, errortypes.ConfigError(err, "Invalid disabled tools")
+	}
+	mcpServer.SetReadOnly(cfg.Tools.ReadOnly)
+	mcpServer.SetRequestLimits(server.RequestLimits{
+		MaxTextLength:  cfg.Requests.MaxTextLength,
+		MaxQueryLength: cfg.Requests.MaxQueryLength,
+		MaxLimit:       cfg.Requests.MaxLimit,
+	})
+	if cfg.Shutdown.Timeout != "" {
+		timeout, err := time.ParseDuration(cfg.Shutdown.Timeout)
+		if err != nil {
+			logger.Error("Invalid shutdown timeout", "timeout", cfg.Shutdown.Timeout, "error", err)
+			return nil, errortypes.ConfigError(err, "Invalid shutdown timeout")
+		}
+		mcpServer.SetShutdownTimeout(timeout)
+	}
+	if cfg.Links.Root != "" {
+		var refresh time.Duration
+		if cfg.Links.RefreshInterval != "" {
+			refresh, err = time.ParseDuration(cfg.Links.RefreshInterval)
+			if err != nil {
+				logger.Error("Invalid links refresh interval", "refresh_interval", cfg.Links.RefreshInterval, "error", err)
+				return nil, errortypes.ConfigError(err, "Invalid links refresh interval")
+			}
+		}
+		if err := mcpServer.SetLinks(cfg.Links.Root, refresh); err != nil {
+			logger.Error("Invalid links configuration", "root", cfg.Links.Root, "error", err)
+			return nil, errortypes.ConfigError(err, "Invalid links configuration")
+		}
+	}
+	if len(cfg.Watch.Paths) > 0 {
+		var debounce time.Duration
+		if cfg.Watch.Debounce != "" {
+			debounce, err = time.ParseDuration(cfg.Watch.Debounce)
+			if err != nil {
+				logger.Error("Invalid watch debounce", "debounce", cfg.Watch.Debounce, "error", err)
+				return nil, errortypes.ConfigError(err, "Invalid watch debounce")
+			}
+		}
+		chunker, err := ingest.NewChunker(cfg.Watch.Chunker, cfg.Watch.MaxTokens, retrievalTokenizer)
+		if err == nil {
+			err = mcpServer.SetWatch(cfg.Watch.Paths, chunker, ingest.WatchOptions{Extensions: cfg.Watch.Extensions, Debounce: debounce})
+		}
+		if err != nil {
+			logger.Error("Invalid watch configuration", "paths", cfg.Watch.Paths, "error", err)
+			return nil, errortypes.ConfigError(err, "Invalid watch configuration")
+		}
+	}
+	if cfg.Consolidation.Enabled {
+		merger, options, interval, err := newConsolidation(cfg, transport)
+		if err != nil {
+			logger.Error("Invalid consolidation configuration", "error", err)
+			return nil, errortypes.ConfigError(err, "Invalid consolidation configuration")
+		}
+		mcpServer.SetConsolidation(merger, options, interval)
+	}
+	if cfg.SaveLimit.MaxSaves != 0 || cfg.SaveLimit.MaxBytes != 0 {
+		var window time.Duration
+		if cfg.SaveLimit.Window != "" {
+			window, err = time.ParseDuration(cfg.SaveLimit.Window)
+			if err != nil {
+				logger.Error("Invalid save limit window", "window", cfg.SaveLimit.Window, "error", err)
+				return nil, errortypes.ConfigError(err, "Invalid save limit window")
+			}
+		}
+		if err := mcpServer.SetSaveLimit(window, cfg.SaveLimit.MaxSaves, cfg.SaveLimit.MaxBytes); err != nil {
+			logger.Error("Invalid save limit", "error", err)
+			return nil, errortypes.ConfigError(err, "Invalid save limit")
+		}
+	}
+	if cfg.HealthReport.Sink != "" {
+		interval, sink, err := HealthReporting(cfg)
+		if err != nil {
+			logger.Error("Invalid health report configuration", "error", err)
+			return nil, err
+		}
+		logger.Info("Sending health reports", "sink", cfg.HealthReport.Sink, "interval", interval)
+		mcpServer.SetHealthReporting(interval, sinkLogger(sink, logger))
+	}
+	if cfg.UsageReport.Sink != "" {
+		interval, sink, err := UsageReporting(cfg)
+		if err != nil {
+			logger.Error("Invalid usage report configuration", "error", err)
+			return nil, err
+		}
+		if err := mcpServer.SetUsageReporting(interval, cfg.UsageReport.Format, cfg.UsageReport.Top, sinkLogger(sink, logger)); err != nil {
+			logger.Error("Invalid usage report configuration", "format", cfg.UsageReport.Format, "error", err)
+			return nil, errortypes.ConfigError(err, "Invalid usage report configuration")
+		}
+		if err := mcpServer.SetIngestionSuggestions(cfg.UsageReport.SuggestIngestion); err != nil {
+			logger.Error("Invalid usage report configuration", "suggest_ingestion", true, "error", err)
+			return nil, errortypes.ConfigError(err, "Invalid usage report configuration")
+		}
+		logger.Info("Sending usage reports", "sink", cfg.UsageReport.Sink, "interval", interval)
+	}
+	if cfg.Memory.HeapLimit > 0 {
+		var interval time.Duration
+		if cfg.Memory.CheckInterval != "" {
+			interval, err = time.ParseDuration(cfg.Memory.CheckInterval)
+			if err != nil {
+				logger.Error("Invalid memory check interval", "check_interval", cfg.Memory.CheckInterval, "error", err)
+				return nil, errortypes.ConfigError(err, "Invalid memory check interval")
+			}
+		}
+		mcpServer.SetMemoryPressure(uint64(cfg.Memory.HeapLimit), interval)
+	}
+	err = mcpServer.Initialize()
 	if err != nil {
 		logger.Error("Failed to initialize MCP context tool server component", "error", err)
 		return nil, errortypes.ConfigError(err, "Failed to initialize MCP context tool server component")
@@ -85,7 +429,10 @@ func NewServer(opts ServerOptions) (*Server, error) {
 		store:      store,
 		summarizer: sum,
 		embedder:   emb,
+		embedInput: embedInput,
 		toolServer: mcpServer,
+		tools:      mcpServer,
+		archive:    archiveTarget,
 		logger:     logger, // Store the resolved logger
 	}, nil
 }
@@ -131,73 +478,79 @@ func loadConfig(configPath string) (*Config, error) {
 	return config, nil
 }
 
-// Start starts the ProjectMemory service.
+// Start starts the ProjectMemory service. It returns when the MCP client
+// disconnects, when Stop is called, or after SIGINT or SIGTERM, which stop
+// the service before Start returns.
 func (s *Server) Start() error {
 	s.logger.Info("Starting ProjectMemory service")
 	return s.toolServer.Start()
 }
 
-// Stop stops the ProjectMemory service.
+// Stop stops the ProjectMemory service: it refuses new tool calls, waits for
+// calls in flight and queued captures up to the shutdown timeout, and closes
+// the store. It may be called more than once.
 func (s *Server) Stop() error {
 	s.logger.Info("Stopping ProjectMemory service")
-	err := s.toolServer.Stop()
-	if err != nil {
-		// The Stop method of toolServer might return an error that should be logged.
+	if err := s.toolServer.Stop(); err != nil {
 		s.logger.Error("Error stopping tool server", "error", err)
 		return err
 	}
 
-	// Close the store
-	s.logger.Info("Closing store")
-	err = s.store.Close()
-	if err != nil {
-		s.logger.Error("Failed to close store", "error", err)
-		return err
-	}
-
 	s.logger.Info("ProjectMemory service stopped")
 	return nil
 }
 
-// SaveContext saves the given text to the context store.
+// SaveContext saves the given text to the context store. Like save_context,
+// an entry embedded by a fallback provider is quarantined until the primary
+// provider re-embeds it.
 func (s *Server) SaveContext(text string) (string, error) {
-	// Generate summary
-	s.logger.Debug("Generating summary of text", "length", len(text))
-	summary, err := s.summarizer.Summarize(text)
-	if err != nil {
-		s.logger.Error("Failed to summarize text", "error", err)
-		return "", err
-	}
+	return s.SaveContextWithSource(text, "")
+}
 
-	// Create embedding
-	s.logger.Debug("Creating embedding for summary")
-	embedding, err := s.embedder.CreateEmbedding(summary)
-	if err != nil {
-		s.logger.Error("Failed to create embedding", "error", err)
-		return "", err
-	}
+// SaveContextWithSource saves text like SaveContext and records where it
+// came from, such as a CLI, an importer, a file path or a URL. The entry's
+// provenance chain is the source followed by "api". It returns
+// contextstore.ErrProvenanceUnsupported if a source is given but the store
+// cannot record provenance.
+func (s *Server) SaveContextWithSource(text string, source string) (string, error) {
+	return s.SaveContextInBatch(text, source, "")
+}
 
-	// Convert embedding to bytes
-	embeddingBytes, err := vector.Float32SliceToBytes(embedding)
-	if err != nil {
-		s.logger.Error("Failed to convert embedding to bytes", "error", err)
-		return "", err
-	}
+// SaveContextInBatch saves text like SaveContextWithSource and groups the
+// entry with the others written by the same import or ingestion run, so
+// RollbackBatch can remove them together. An empty batch saves the entry
+// outside any batch. It returns contextstore.ErrBatchesUnsupported if a
+// batch is given but the store cannot track batches.
+func (s *Server) SaveContextInBatch(text string, source string, batch string) (string, error) {
+	return s.saveContext(context.Background(), text, source, batch, "")
+}
 
-	// Generate ID (simple hash of content + timestamp)
-	timestamp := time.Now()
-	id := GenerateHash(summary, timestamp.UnixNano())
+// SaveContextInSession saves text like SaveContext and groups the entry
+// with the others saved during the same agent session, so a Query with
+// that Session searches them together and ExpireSession removes them
+// together. An empty session saves the entry outside any session. It
+// returns contextstore.ErrSessionsUnsupported if a session is given but
+// the store cannot track sessions.
+func (s *Server) SaveContextInSession(text string, session string) (string, error) {
+	return s.saveContext(context.Background(), text, "", "", session)
+}
 
-	// Store in context store
-	s.logger.Debug("Storing context", "id", id)
-	err = s.store.Store(id, summary, embeddingBytes, timestamp)
+// saveContext saves text with its source, batch and session, each of
+// which may be empty, through the same pipeline as save_context, so short
+// text is stored as is, refused text verbatim, and fallback embeddings are
+// quarantined. Cancelling ctx stops the summarizer and embedding calls.
+func (s *Server) saveContext(ctx context.Context, text string, source string, batch string, session string) (string, error) {
+	saved, err := s.tools.SaveEntry(ctx, server.NewEntry{
+		Text:    text,
+		Source:  source,
+		Via:     contextstore.SourceAPI,
+		Batch:   batch,
+		Session: session,
+	})
 	if err != nil {
-		s.logger.Error("Failed to store context", "id", id, "error", err)
 		return "", err
 	}
-
-	s.logger.Info("Successfully saved context", "id", id)
-	return id, nil
+	return saved.ID, nil
 }
 
 // RetrieveContext retrieves context entries similar to the given query.
@@ -222,6 +575,533 @@ func (s *Server) RetrieveContext(query string, limit int) ([]string, error) {
 	return results, nil
 }
 
+// SearchResult is an entry found by SearchContext
+type SearchResult struct {
+	ID      string   `json:"id"`
+	Score   float64  `json:"score"`
+	Tags    []string `json:"tags"`
+	Summary string   `json:"summary"`
+
+	// Title is the one-line title of the summary. It is empty if the store
+	// records no title for the entry.
+	Title string `json:"title,omitempty"`
+
+	// Generation records what wrote the summary. It is nil if the store
+	// records no generation for the entry.
+	Generation *contextstore.Generation `json:"generation,omitempty"`
+
+	// Source is the file lines or commit the entry's content came from,
+	// read from the origin of its provenance chain. It is nil for entries
+	// not ingested from a file or captured from a commit.
+	Source *contextstore.Origin `json:"source,omitempty"`
+}
+
+// SearchContext retrieves the entries most similar to query like
+// RetrieveContext, with the ID, similarity score, tags, title, generation
+// and source of each. Tags are empty if the store cannot hold them. It returns
+// contextstore.ErrScoresUnsupported if the store cannot score results.
+func (s *Server) SearchContext(query string, limit int) ([]SearchResult, error) {
+	scored, ok := s.store.(contextstore.ScoredSearcher)
+	if !ok {
+		s.logger.Error("Failed to search context", "error", contextstore.ErrScoresUnsupported)
+		return nil, contextstore.ErrScoresUnsupported
+	}
+
+	queryEmbedding, err := s.embedder.CreateEmbedding(query)
+	if err != nil {
+		s.logger.Error("Failed to create embedding for query", "query", query, "error", err)
+		return nil, err
+	}
+
+	found, err := scored.SearchWithScores(queryEmbedding, limit, contextstore.SearchFilter{})
+	if err != nil {
+		s.logger.Error("Failed to search context store", "limit", limit, "error", err)
+		return nil, err
+	}
+
+	results := make([]SearchResult, len(found))
+	for i, result := range found {
+		entry, err := s.describe(result.ID)
+		if err != nil {
+			return nil, err
+		}
+		entry.ID = result.ID
+		entry.Score = result.Similarity
+		entry.Summary = result.SummaryText
+		results[i] = entry
+	}
+
+	s.logger.Info("Searched context entries", "count", len(results))
+	return results, nil
+}
+
+// describe returns the tags, title, generation and source the store records
+// for an entry. Tags are empty if the store cannot hold them.
+func (s *Server) describe(id string) (SearchResult, error) {
+	entry := SearchResult{Tags: []string{}}
+	if titles, ok := s.store.(contextstore.TitleStore); ok {
+		title, err := titles.GetTitle(id)
+		if err != nil {
+			s.logger.Error("Failed to read context title", "id", id, "error", err)
+			return entry, err
+		}
+		entry.Title = title
+	}
+	if generations, ok := s.store.(contextstore.GenerationStore); ok {
+		generation, err := generations.GetGeneration(id)
+		if err != nil {
+			s.logger.Error("Failed to read context generation", "id", id, "error", err)
+			return entry, err
+		}
+		if !generation.IsZero() {
+			entry.Generation = &generation
+		}
+	}
+	if provenance, ok := s.store.(contextstore.ProvenanceStore); ok {
+		chain, err := provenance.GetProvenance(id)
+		if err != nil {
+			s.logger.Error("Failed to read context provenance", "id", id, "error", err)
+			return entry, err
+		}
+		if origin, ok := contextstore.ParseOrigin(chain); ok {
+			entry.Source = &origin
+		}
+	}
+	if tagged, ok := s.store.(contextstore.TaggedStore); ok {
+		tags, err := tagged.GetTags(id)
+		if err != nil {
+			s.logger.Error("Failed to read context tags", "id", id, "error", err)
+			return entry, err
+		}
+		if tags != nil {
+			entry.Tags = tags
+		}
+	}
+	return entry, nil
+}
+
+// PinContext pins or unpins an entry. Pinned entries are returned by every
+// retrieve_context call whatever the query. It returns
+// server.ErrTooManyPinned if 20 entries are pinned already, and
+// contextstore.ErrPinsUnsupported if the store cannot pin entries.
+func (s *Server) PinContext(id string, pinned bool) error {
+	pins, ok := s.store.(contextstore.PinStore)
+	if !ok {
+		s.logger.Error("Failed to pin context", "id", id, "error", contextstore.ErrPinsUnsupported)
+		return contextstore.ErrPinsUnsupported
+	}
+	if pinned {
+		ids, err := pins.ListPinned("")
+		if err != nil {
+			s.logger.Error("Failed to list pinned context", "error", err)
+			return err
+		}
+		if len(ids) >= tools.MaxPinned && !slices.Contains(ids, id) {
+			s.logger.Error("Failed to pin context", "id", id, "error", server.ErrTooManyPinned)
+			return server.ErrTooManyPinned
+		}
+	}
+	if err := pins.SetPinned(id, pinned); err != nil {
+		s.logger.Error("Failed to pin context", "id", id, "error", err)
+		return err
+	}
+	s.logger.Info("Pinned context", "id", id, "pinned", pinned)
+	return nil
+}
+
+// SnapshotHashes returns the snapshot hash of each namespace holding
+// entries. Stores with the same content have the same hashes, so comparing
+// them checks a replication or an export and import round trip. It returns
+// contextstore.ErrSnapshotUnsupported if the store cannot hash its content.
+func (s *Server) SnapshotHashes() (map[string]string, error) {
+	hasher, ok := s.store.(contextstore.SnapshotHasher)
+	if !ok {
+		s.logger.Error("Failed to hash context", "error", contextstore.ErrSnapshotUnsupported)
+		return nil, contextstore.ErrSnapshotUnsupported
+	}
+
+	hashes, err := hasher.SnapshotHashes()
+	if err != nil {
+		s.logger.Error("Failed to hash context", "error", err)
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// ListBatches returns every batch holding entries, oldest first. It returns
+// contextstore.ErrBatchesUnsupported if the store cannot track batches.
+func (s *Server) ListBatches() ([]contextstore.Batch, error) {
+	batches, ok := s.store.(contextstore.BatchStore)
+	if !ok {
+		s.logger.Error("Failed to list batches", "error", contextstore.ErrBatchesUnsupported)
+		return nil, contextstore.ErrBatchesUnsupported
+	}
+
+	listed, err := batches.ListBatches()
+	if err != nil {
+		s.logger.Error("Failed to list batches", "error", err)
+		return nil, err
+	}
+	return listed, nil
+}
+
+// RollbackBatch deletes every entry saved in the batch and returns how many
+// were deleted. It returns contextstore.ErrBatchesUnsupported if the store
+// cannot track batches.
+func (s *Server) RollbackBatch(batch string) (int, error) {
+	batches, ok := s.store.(contextstore.BatchStore)
+	if !ok {
+		s.logger.Error("Failed to roll back batch", "batch", batch, "error", contextstore.ErrBatchesUnsupported)
+		return 0, contextstore.ErrBatchesUnsupported
+	}
+
+	count, err := batches.DeleteBatch(strings.TrimSpace(batch))
+	if err != nil {
+		s.logger.Error("Failed to roll back batch", "batch", batch, "error", err)
+		return 0, err
+	}
+	s.logger.Info("Rolled back batch", "batch", batch, "count", count)
+	return count, nil
+}
+
+// ListSessions returns every agent session holding entries, most recently
+// active first. It returns contextstore.ErrSessionsUnsupported if the store
+// cannot track sessions.
+func (s *Server) ListSessions() ([]contextstore.Session, error) {
+	sessions, ok := s.store.(contextstore.SessionStore)
+	if !ok {
+		s.logger.Error("Failed to list sessions", "error", contextstore.ErrSessionsUnsupported)
+		return nil, contextstore.ErrSessionsUnsupported
+	}
+
+	listed, err := sessions.ListSessions()
+	if err != nil {
+		s.logger.Error("Failed to list sessions", "error", err)
+		return nil, err
+	}
+	return listed, nil
+}
+
+// ExpireSession deletes every entry saved in the session and returns how
+// many were deleted. It returns contextstore.ErrSessionsUnsupported if the
+// store cannot track sessions.
+func (s *Server) ExpireSession(session string) (int, error) {
+	sessions, ok := s.store.(contextstore.SessionStore)
+	if !ok {
+		s.logger.Error("Failed to expire session", "session", session, "error", contextstore.ErrSessionsUnsupported)
+		return 0, contextstore.ErrSessionsUnsupported
+	}
+
+	count, err := sessions.DeleteSession(strings.TrimSpace(session))
+	if err != nil {
+		s.logger.Error("Failed to expire session", "session", session, "error", err)
+		return 0, err
+	}
+	s.logger.Info("Expired session", "session", session, "count", count)
+	return count, nil
+}
+
+// LinkContext records that the entry id relates to the entry relatedID,
+// by one of contextstore.RelationSupersedes, RelationElaborates and
+// RelationContradicts. It returns an error wrapping
+// contextstore.ErrEntryNotFound if either entry is not stored, and
+// contextstore.ErrRelationsUnsupported if the store cannot link entries.
+func (s *Server) LinkContext(id string, relatedID string, relationType string) error {
+	relations, ok := s.store.(contextstore.RelationStore)
+	if !ok {
+		s.logger.Error("Failed to link context", "id", id, "error", contextstore.ErrRelationsUnsupported)
+		return contextstore.ErrRelationsUnsupported
+	}
+
+	relation := contextstore.Relation{EntryID: id, RelatedID: relatedID, Type: relationType, CreatedAt: time.Now()}
+	if err := relations.Link(relation); err != nil {
+		s.logger.Error("Failed to link context", "id", id, "related_id", relatedID, "relation_type", relationType, "error", err)
+		return err
+	}
+	s.logger.Info("Linked context", "id", id, "related_id", relatedID, "relation_type", relationType)
+	return nil
+}
+
+// UnlinkContext removes the relation of the given type from the entry id
+// to the entry relatedID and reports whether there was one. It returns
+// contextstore.ErrRelationsUnsupported if the store cannot link entries.
+func (s *Server) UnlinkContext(id string, relatedID string, relationType string) (bool, error) {
+	relations, ok := s.store.(contextstore.RelationStore)
+	if !ok {
+		s.logger.Error("Failed to unlink context", "id", id, "error", contextstore.ErrRelationsUnsupported)
+		return false, contextstore.ErrRelationsUnsupported
+	}
+
+	removed, err := relations.Unlink(id, relatedID, relationType)
+	if err != nil {
+		s.logger.Error("Failed to unlink context", "id", id, "related_id", relatedID, "relation_type", relationType, "error", err)
+		return false, err
+	}
+	return removed, nil
+}
+
+// LinkedContext returns the relations from and to the entry id with the
+// entries at their other ends, oldest first. It returns an error wrapping
+// contextstore.ErrEntryNotFound if the entry is not stored, and
+// contextstore.ErrRelationsUnsupported if the store cannot link entries.
+func (s *Server) LinkedContext(id string) ([]contextstore.RelatedEntry, error) {
+	relations, ok := s.store.(contextstore.RelationStore)
+	if !ok {
+		s.logger.Error("Failed to list linked context", "id", id, "error", contextstore.ErrRelationsUnsupported)
+		return nil, contextstore.ErrRelationsUnsupported
+	}
+
+	related, err := relations.ListRelations(id)
+	if err != nil {
+		s.logger.Error("Failed to list linked context", "id", id, "error", err)
+		return nil, err
+	}
+	return related, nil
+}
+
+// ArchiveNamespace moves the entries of a namespace to the configured
+// archive target and returns how many were moved. It returns
+// contextstore.ErrArchiveUnsupported if the store cannot archive namespaces.
+func (s *Server) ArchiveNamespace(namespace string) (int, error) {
+	target, err := s.archiveTarget()
+	if err != nil {
+		s.logger.Error("Failed to archive namespace", "namespace", namespace, "error", err)
+		return 0, err
+	}
+
+	bundle, err := archive.Archive(s.store, target, strings.TrimSpace(namespace), time.Now())
+	if err != nil {
+		s.logger.Error("Failed to archive namespace", "namespace", namespace, "error", err)
+		return 0, err
+	}
+	s.logger.Info("Archived namespace", "namespace", namespace, "count", len(bundle.Entries), "snapshot_hash", bundle.SnapshotHash)
+	return len(bundle.Entries), nil
+}
+
+// RestoreNamespace moves an archived namespace back into the store and
+// returns how many entries were restored. The namespace must hold no
+// entries. It returns contextstore.ErrArchiveUnsupported if the store cannot
+// archive namespaces.
+func (s *Server) RestoreNamespace(namespace string) (int, error) {
+	target, err := s.archiveTarget()
+	if err != nil {
+		s.logger.Error("Failed to restore namespace", "namespace", namespace, "error", err)
+		return 0, err
+	}
+
+	count, err := archive.Restore(s.store, target, strings.TrimSpace(namespace))
+	if err != nil {
+		s.logger.Error("Failed to restore namespace", "namespace", namespace, "error", err)
+		return 0, err
+	}
+	s.logger.Info("Restored namespace", "namespace", namespace, "count", count)
+	return count, nil
+}
+
+// Snapshot writes every namespace to the configured archive target, without
+// removing anything from the store, and returns the manifest of the snapshot.
+func (s *Server) Snapshot() (*archive.Manifest, error) {
+	target, err := s.archiveTarget()
+	if err != nil {
+		s.logger.Error("Failed to snapshot store", "error", err)
+		return nil, err
+	}
+
+	manifest, err := archive.Snapshot(s.store, target, time.Now())
+	if err != nil {
+		s.logger.Error("Failed to snapshot store", "error", err)
+		return nil, err
+	}
+	s.logger.Info("Took snapshot", "id", manifest.ID, "namespaces", len(manifest.Namespaces))
+	return manifest, nil
+}
+
+// RestoreSnapshot imports every namespace of a snapshot from the configured
+// archive target, or of the most recent one if id is empty or "latest", and
+// returns its manifest. None of the snapshot's namespaces may hold entries.
+func (s *Server) RestoreSnapshot(id string) (*archive.Manifest, error) {
+	target, err := s.archiveTarget()
+	if err != nil {
+		s.logger.Error("Failed to restore snapshot", "id", id, "error", err)
+		return nil, err
+	}
+
+	id = strings.TrimSpace(id)
+	if id == "" {
+		id = archive.LatestSnapshot
+	}
+	manifest, err := archive.RestoreSnapshot(s.store, target, id)
+	if err != nil {
+		s.logger.Error("Failed to restore snapshot", "id", id, "error", err)
+		return nil, err
+	}
+	s.logger.Info("Restored snapshot", "id", manifest.ID, "namespaces", len(manifest.Namespaces))
+	return manifest, nil
+}
+
+// Regenerate summarizes and embeds again every entry whose summary
+// generation matches options.Filter, such as the summaries the basic
+// fallback wrote while the AI provider was down, and returns how many
+// entries were handled. The stored text is what gets summarized, since the
+// original text is not kept. It returns contextstore.ErrUsageUnsupported if
+// the store cannot list its entries.
+func (s *Server) Regenerate(ctx context.Context, options regenerate.Options) (regenerate.Progress, error) {
+	progress, err := regenerate.Run(ctx, s.store, s.summarizer, s.embedder, options)
+	if err != nil {
+		s.logger.Error("Failed to regenerate summaries", "filter", options.Filter.String(), "error", err)
+		return progress, err
+	}
+	s.logger.Info("Regenerated summaries", "filter", options.Filter.String(), "total", progress.Total, "regenerated", progress.Regenerated, "skipped", progress.Skipped, "failed", progress.Failed)
+	return progress, nil
+}
+
+// Consolidate merges each cluster of highly similar entries into one entry
+// that replaces them, as the consolidate tool does, with options
+// overriding the configured threshold and cluster size. The consolidated
+// entry records the entries it replaced in its provenance and takes over
+// their tags and relations. Pinned entries are left alone. It returns
+// server.ErrConsolidationNotConfigured unless the consolidation section is
+// enabled, and contextstore.ErrUsageUnsupported if the store cannot list
+// its entries.
+func (s *Server) Consolidate(ctx context.Context, options consolidate.Options) (consolidate.Report, error) {
+	report, err := s.tools.Consolidate(ctx, options)
+	if err != nil {
+		s.logger.Error("Failed to consolidate context", "namespace", options.Namespace, "error", err)
+		return report, err
+	}
+	s.logger.Info("Consolidated context", "namespace", options.Namespace, "clusters", len(report.Clusters),
+		"consolidated", report.Consolidated, "replaced", report.Entries, "failed", report.Failed, "dry_run", options.DryRun)
+	return report, nil
+}
+
+// Ingest splits the markdown, code and text files under paths into chunks
+// and saves each as an entry, as SaveContextInBatch does, with the file and
+// lines it came from as its source, such as "docs/setup.md#L12-L40".
+// Cancelling ctx stops the run, including the chunk being summarized. The
+// chunks of a run share a batch, returned with the report, so
+// RollbackBatch can remove them together, and each entry references its
+// file for retrieve_by_file. Sources, batches and references are left out
+// on stores that cannot record them. Chunks are counted with the retrieval
+// tokenizer unless options.Tokenizer is set.
+func (s *Server) Ingest(ctx context.Context, paths []string, options ingest.Options) (ingest.Report, string, error) {
+	if options.Tokenizer == nil {
+		counter, err := tokenizer.New(s.config.Retrieval.Tokenizer, s.config.Retrieval.TokenizerFile)
+		if err != nil {
+			return ingest.Report{}, "", err
+		}
+		options.Tokenizer = counter
+	}
+	var batch string
+	if _, ok := s.store.(contextstore.BatchStore); ok && !options.DryRun {
+		batch = "ingest-" + time.Now().UTC().Format(time.RFC3339)
+	}
+	_, traced := s.store.(contextstore.ProvenanceStore)
+	references, linked := s.store.(contextstore.ReferenceStore)
+
+	save := func(ctx context.Context, chunk ingest.Chunk) error {
+		source := ""
+		if traced {
+			source = chunk.Source()
+		}
+		id, err := s.saveContext(ctx, chunk.Document(), source, batch, "")
+		if err != nil {
+			s.logger.Warn("Failed to save chunk", "source", chunk.Source(), "error", err)
+			return err
+		}
+		if linked {
+			if err := references.SetReferences(id, []contextstore.Reference{{Path: chunk.Path}}); err != nil {
+				s.logger.Warn("Failed to record the file of a chunk", "id", id, "path", chunk.Path, "error", err)
+			}
+		}
+		return nil
+	}
+	report, err := ingest.Run(ctx, paths, save, options)
+	if err != nil {
+		s.logger.Error("Failed to ingest files", "paths", paths, "error", err)
+		return report, batch, err
+	}
+	s.logger.Info("Ingested files", "batch", batch, "files", report.Files, "skipped", report.Skipped, "chunks", report.Chunks, "saved", report.Saved, "failed", report.Failed)
+	return report, batch, nil
+}
+
+// CaptureGit saves the commits of the repository holding dir made since
+// the last capture as entries, as SaveContextInBatch does, oldest first:
+// each commit's message, the files it changed and, with options.Diffs, its
+// diff. Entries are tagged "git" and "commit:" with the commit's full hash,
+// start their provenance with "git:" and the hash, and reference the files
+// the commit changed, relative to the repository's root. Cancelling ctx
+// stops the run, including the commit being summarized, which the next
+// capture saves again. The commits of a run share a batch, returned with the report, so RollbackBatch can remove
+// them together. Tags, sources, batches and references are left out on
+// stores that cannot record them.
+func (s *Server) CaptureGit(ctx context.Context, dir string, options git.Options) (git.Report, string, error) {
+	var batch string
+	if _, ok := s.store.(contextstore.BatchStore); ok && !options.DryRun {
+		batch = "git-" + time.Now().UTC().Format(time.RFC3339)
+	}
+	_, traced := s.store.(contextstore.ProvenanceStore)
+	tags, tagged := s.store.(contextstore.TaggedStore)
+	references, linked := s.store.(contextstore.ReferenceStore)
+
+	save := func(ctx context.Context, commit git.Commit) error {
+		source := ""
+		if traced {
+			source = commit.Source()
+		}
+		id, err := s.saveContext(ctx, commit.Document(), source, batch, "")
+		if err != nil {
+			s.logger.Warn("Failed to save commit", "commit", commit.SHA, "error", err)
+			return err
+		}
+		if tagged {
+			if err := tags.SetTags(id, []string{"git", commit.Tag()}); err != nil {
+				s.logger.Warn("Failed to tag a commit", "id", id, "commit", commit.SHA, "error", err)
+			}
+		}
+		if linked && len(commit.Files) > 0 {
+			files := make([]contextstore.Reference, len(commit.Files))
+			for i, file := range commit.Files {
+				files[i] = contextstore.Reference{Path: file}
+			}
+			if err := references.SetReferences(id, files); err != nil {
+				s.logger.Warn("Failed to record the files of a commit", "id", id, "commit", commit.SHA, "error", err)
+			}
+		}
+		return nil
+	}
+	report, err := git.Capture(ctx, dir, save, options)
+	if err != nil {
+		s.logger.Error("Failed to capture commits", "dir", dir, "error", err)
+		return report, batch, err
+	}
+	s.logger.Info("Captured commits", "batch", batch, "commits", report.Commits, "saved", report.Saved, "failed", report.Failed, "last", report.Last)
+	return report, batch, nil
+}
+
+// Evaluate runs preset against the configured summarizer and embedder in a
+// scratch store, leaving the server's store untouched. Documents are
+// embedded with the configured embedder input unless options.Input is set.
+func (s *Server) Evaluate(ctx context.Context, preset eval.Preset, options eval.Options) (eval.Report, error) {
+	if options.Input == "" {
+		options.Input = s.embedInput
+	}
+	report, err := eval.Run(ctx, preset, s.summarizer, s.embedder, options)
+	if err != nil {
+		s.logger.Error("Failed to evaluate preset", "preset", preset.Name, "error", err)
+		return report, err
+	}
+	s.logger.Info("Evaluated preset", "preset", preset.Name, "k", report.K, "recall", report.Recall, "mrr", report.MRR)
+	return report, nil
+}
+
+// archiveTarget returns the configured archive target
+func (s *Server) archiveTarget() (archive.Target, error) {
+	if s.archive == nil {
+		return nil, server.ErrArchiveNotConfigured
+	}
+	return s.archive, nil
+}
+
 // GetStore returns the context store instance used by the server.
 func (s *Server) GetStore() contextstore.ContextStore {
 	return s.store
@@ -241,6 +1121,13 @@ func (s *Server) GetEmbedder() vector.Embedder {
 // without creating a server instance. This is useful for components that need
 // direct access to the store, summarizer, and embedder.
 func CreateComponents(cfg *Config, logger *slog.Logger) (contextstore.ContextStore, summarizer.Summarizer, vector.Embedder, error) {
+	return createComponents(cfg, logger, nil)
+}
+
+// createComponents is CreateComponents with the summarizer and embedder
+// providers sending their HTTP requests through transport. A nil transport
+// uses http.DefaultTransport.
+func createComponents(cfg *Config, logger *slog.Logger, transport http.RoundTripper) (contextstore.ContextStore, summarizer.Summarizer, vector.Embedder, error) {
 	if logger == nil {
 		// This case should ideally not be hit if NewServerWithOptions always provides one,
 		// but as a public function, it's safer to have a fallback.
@@ -248,24 +1135,34 @@ func CreateComponents(cfg *Config, logger *slog.Logger) (contextstore.ContextSto
 		logger.Debug("CreateComponents called with nil logger, defaulting to slog.Default()")
 	}
 
-	// Initialize SQLite context store
-	logger.Info("Initializing SQLite context store for CreateComponents", "path", cfg.Store.SQLitePath)
-	store := contextstore.NewSQLiteContextStore()
-	err := store.Initialize(cfg.Store.SQLitePath)
+	// Initialize the context store this build supports
+	store, err := openStore(cfg, logger)
 	if err != nil {
-		logger.Error("Failed to initialize SQLite context store in CreateComponents", "path", cfg.Store.SQLitePath, "error", err)
-		return nil, nil, nil, errortypes.DatabaseError(err, "Failed to initialize SQLite context store")
+		return nil, nil, nil, err
 	}
 
 	// Initialize summarizer
 	logger.Info("Initializing summarizer for CreateComponents", "provider", cfg.Summarizer.Provider)
 	var sum summarizer.Summarizer
+	maxSummaryLength := cfg.Summarizer.MaxLength
+	if maxSummaryLength <= 0 {
+		maxSummaryLength = summarizer.DefaultMaxSummaryLength
+	}
 	switch cfg.Summarizer.Provider {
 	case "basic", "":
-		sum = summarizer.NewBasicSummarizer(summarizer.DefaultMaxSummaryLength)
+		sum = summarizer.NewBasicSummarizer(maxSummaryLength)
+	case "ai":
+		aiConfig, err := aiSummarizerConfig(cfg)
+		if err != nil {
+			logger.Error("Invalid AI summarizer configuration in CreateComponents", "error", err)
+			return nil, nil, nil, errortypes.ConfigError(err, "Invalid AI summarizer configuration")
+		}
+		aiConfig.Transport = transport
+		logger.Info("Using AI summarizer", "provider", aiConfig.ProviderName, "model", aiConfig.ModelID, "fallbacks", len(aiConfig.FallbackProviders))
+		sum = summarizer.NewAISummarizer(aiConfig)
 	default:
 		logger.Warn("Unknown summarizer provider in CreateComponents, using basic summarizer", "provider", cfg.Summarizer.Provider)
-		sum = summarizer.NewBasicSummarizer(summarizer.DefaultMaxSummaryLength)
+		sum = summarizer.NewBasicSummarizer(maxSummaryLength)
 	}
 
 	if err := sum.Initialize(); err != nil {
@@ -281,12 +1178,96 @@ func CreateComponents(cfg *Config, logger *slog.Logger) (contextstore.ContextSto
 		dimensions = vector.DefaultEmbeddingDimensions
 	}
 
-	switch cfg.Embedder.Provider {
-	case "mock", "":
-		emb = vector.NewMockEmbedder(dimensions)
-	default:
-		logger.Warn("Unknown embedder provider in CreateComponents, using mock embedder", "provider", cfg.Embedder.Provider)
-		emb = vector.NewMockEmbedder(dimensions)
+	provider := cfg.Embedder.Provider
+	if provider == "" {
+		provider = vector.ProviderMock
+	}
+
+	embedderFactory := vector.NewEmbedderFactory(map[string]vector.EmbedderConfig{
+		provider: {
+			APIKey:       cfg.Embedder.ApiKey,
+			ModelID:      cfg.Embedder.ModelID,
+			Dimensions:   dimensions,
+			Endpoint:     cfg.Embedder.Endpoint,
+			BodyTemplate: cfg.Embedder.BodyTemplate,
+			VectorPath:   cfg.Embedder.VectorPath,
+			Transport:    transport,
+			ModelPath:    cfg.Embedder.ModelPath,
+			VocabPath:    cfg.Embedder.VocabPath,
+			LibraryPath:  cfg.Embedder.LibraryPath,
+		},
+	})
+
+	emb, err = embedderFactory.GetEmbedder(provider)
+	if err != nil {
+		logger.Error("Failed to create embedder in CreateComponents", "provider", provider, "error", err)
+		return nil, nil, nil, errortypes.ConfigError(err, "Failed to create embedder")
+	}
+
+	// Wrap the provider in a fallback chain with retries
+	if len(cfg.Embedder.Fallbacks) > 0 || cfg.Embedder.MaxRetries > 0 {
+		var fallbacks []vector.NamedEmbedder
+		for _, fallbackCfg := range cfg.Embedder.Fallbacks {
+			fallbackFactory := vector.NewEmbedderFactory(map[string]vector.EmbedderConfig{
+				fallbackCfg.Provider: {
+					APIKey:       fallbackCfg.ApiKey,
+					ModelID:      fallbackCfg.ModelID,
+					Dimensions:   dimensions,
+					Endpoint:     fallbackCfg.Endpoint,
+					BodyTemplate: fallbackCfg.BodyTemplate,
+					VectorPath:   fallbackCfg.VectorPath,
+					Transport:    transport,
+					ModelPath:    fallbackCfg.ModelPath,
+					VocabPath:    fallbackCfg.VocabPath,
+					LibraryPath:  fallbackCfg.LibraryPath,
+				},
+			})
+			fallback, err := fallbackFactory.GetEmbedder(fallbackCfg.Provider)
+			if err != nil {
+				logger.Warn("Skipping embedder fallback in CreateComponents", "provider", fallbackCfg.Provider, "error", err)
+				continue
+			}
+			fallbacks = append(fallbacks, vector.NamedEmbedder{Name: fallbackCfg.Provider, Embedder: fallback})
+		}
+
+		fallbackConfig := vector.FallbackEmbedderConfig{
+			MaxRetries: cfg.Embedder.MaxRetries,
+			Dimensions: dimensions,
+		}
+		if cfg.Embedder.RetryDelay != "" {
+			fallbackConfig.RetryDelay, err = time.ParseDuration(cfg.Embedder.RetryDelay)
+			if err != nil {
+				logger.Error("Invalid embedder retry delay in CreateComponents", "retry_delay", cfg.Embedder.RetryDelay, "error", err)
+				return nil, nil, nil, errortypes.ConfigError(err, "Invalid embedder retry delay")
+			}
+		}
+		logger.Info("Enabling embedder fallback chain", "primary", provider, "fallbacks", len(fallbacks))
+		emb = vector.NewFallbackEmbedder(vector.NamedEmbedder{Name: provider, Embedder: emb}, fallbacks, fallbackConfig)
+	}
+
+	// Put the embedding cache in front of the provider
+	if cfg.Embedder.CacheCapacity > 0 {
+		cacheConfig := vector.EmbeddingCacheConfig{
+			Capacity:  cfg.Embedder.CacheCapacity,
+			MaxBytes:  cfg.Embedder.CacheMaxBytes,
+			Namespace: fmt.Sprintf("%s:%s:%d", provider, cfg.Embedder.ModelID, dimensions),
+		}
+		if cfg.Embedder.CacheTTL != "" {
+			cacheConfig.TTL, err = time.ParseDuration(cfg.Embedder.CacheTTL)
+			if err != nil {
+				logger.Error("Invalid embedder cache TTL in CreateComponents", "cache_ttl", cfg.Embedder.CacheTTL, "error", err)
+				return nil, nil, nil, errortypes.ConfigError(err, "Invalid embedder cache TTL")
+			}
+		}
+		if cfg.Embedder.CachePersist {
+			if persistent, ok := store.(vector.EmbeddingCacheStore); ok {
+				cacheConfig.Store = persistent
+			} else {
+				logger.Warn("Store cannot persist cached embeddings, keeping the cache in memory", "store", fmt.Sprintf("%T", store))
+			}
+		}
+		logger.Info("Enabling embedding cache", "capacity", cacheConfig.Capacity, "max_bytes", cacheConfig.MaxBytes, "ttl", cfg.Embedder.CacheTTL, "persist", cfg.Embedder.CachePersist)
+		emb = vector.NewCachedEmbedder(emb, cacheConfig)
 	}
 
 	if err := emb.Initialize(); err != nil {
@@ -298,6 +1279,451 @@ func CreateComponents(cfg *Config, logger *slog.Logger) (contextstore.ContextSto
 	return store, sum, emb, nil
 }
 
+// cassetteTransport returns the transport recording to or replaying from
+// the cassette set in opts, or nil if neither is set.
+func cassetteTransport(opts ServerOptions, logger *slog.Logger) (http.RoundTripper, error) {
+	var path string
+	var mode cassette.Mode
+	switch {
+	case opts.RecordCassette != "" && opts.ReplayCassette != "":
+		err := errors.New("cannot record and replay a cassette at once")
+		logger.Error("Invalid cassette options", "error", err)
+		return nil, errortypes.ConfigError(err, "Invalid cassette options")
+	case opts.RecordCassette != "":
+		path, mode = opts.RecordCassette, cassette.ModeRecord
+	case opts.ReplayCassette != "":
+		path, mode = opts.ReplayCassette, cassette.ModeReplay
+	default:
+		return nil, nil
+	}
+
+	transport, err := cassette.New(path, mode, nil)
+	if err != nil {
+		logger.Error("Failed to open cassette", "path", path, "mode", mode, "error", err)
+		return nil, errortypes.ConfigError(err, "Failed to open cassette")
+	}
+	logger.Warn("Provider requests go through a cassette", "path", path, "mode", mode)
+	return transport, nil
+}
+
+// newReranker builds the LLM reranker of cfg, whose provider sends its
+// requests through transport. The provider, model and API key default to
+// the AI summarizer's.
+func newReranker(cfg *Config, transport http.RoundTripper) (*rerank.LLMReranker, error) {
+	settings := cfg.Retrieval.Rerank
+	if settings.Candidates < 0 || settings.MaxCandidateLength < 0 {
+		return nil, fmt.Errorf("invalid rerank candidates %d and max_candidate_length %d: must not be negative",
+			settings.Candidates, settings.MaxCandidateLength)
+	}
+	completer, err := llmCompleter(cfg, "rerank", settings.Provider, settings.ModelID, settings.ApiKey, transport)
+	if err != nil {
+		return nil, err
+	}
+	return rerank.NewLLMReranker(completer, settings.MaxCandidateLength), nil
+}
+
+// newQueryExpander builds the LLM query expander of cfg, whose provider
+// sends its requests through transport. The provider, model and API key
+// default to the AI summarizer's.
+func newQueryExpander(cfg *Config, transport http.RoundTripper) (*expansion.LLMExpander, error) {
+	settings := cfg.Retrieval.Expansion
+	if settings.Queries < 0 {
+		return nil, fmt.Errorf("invalid expansion queries %d: must not be negative", settings.Queries)
+	}
+	completer, err := llmCompleter(cfg, "expansion", settings.Provider, settings.ModelID, settings.ApiKey, transport)
+	if err != nil {
+		return nil, err
+	}
+	return expansion.NewLLMExpander(completer), nil
+}
+
+// newConsolidation builds the LLM merger, clustering options and interval
+// of the consolidation of cfg, whose provider sends its requests through
+// transport. The provider, model and API key default to the AI
+// summarizer's.
+func newConsolidation(cfg *Config, transport http.RoundTripper) (*consolidate.LLMMerger, consolidate.Options, time.Duration, error) {
+	settings := cfg.Consolidation
+	if settings.Threshold < 0 || settings.Threshold > 1 {
+		return nil, consolidate.Options{}, 0, fmt.Errorf("invalid consolidation threshold %v: must be between 0 and 1", settings.Threshold)
+	}
+	if settings.MaxClusterSize < 0 || settings.MaxClusterSize == 1 {
+		return nil, consolidate.Options{}, 0, fmt.Errorf("invalid consolidation max_cluster_size %d: must be 0 or at least 2", settings.MaxClusterSize)
+	}
+	var interval time.Duration
+	if settings.Interval != "" {
+		parsed, err := time.ParseDuration(settings.Interval)
+		if err != nil {
+			return nil, consolidate.Options{}, 0, fmt.Errorf("invalid consolidation interval %q: %w", settings.Interval, err)
+		}
+		interval = parsed
+	}
+	completer, err := llmCompleter(cfg, "consolidation", settings.Provider, settings.ModelID, settings.ApiKey, transport)
+	if err != nil {
+		return nil, consolidate.Options{}, 0, err
+	}
+	options := consolidate.Options{Threshold: settings.Threshold, MaxClusterSize: settings.MaxClusterSize}
+	return consolidate.NewLLMMerger(completer), options, interval, nil
+}
+
+// llmCompleter returns the named provider answering the prompts of a
+// retrieval stage or of consolidation, sending its requests through transport. An empty name,
+// model or API key takes the AI summarizer's when the providers match, and
+// the API key then falls back to the provider's environment variable.
+func llmCompleter(cfg *Config, stage, name, model, apiKey string, transport http.RoundTripper) (providers.Completer, error) {
+	summarizerProvider := cfg.Summarizer.AIProvider
+	if summarizerProvider == "" {
+		summarizerProvider = providers.ProviderAnthropic
+	}
+	if name == "" {
+		name = summarizerProvider
+	}
+	providerConfig := providers.Config{APIKey: apiKey, ModelID: model, Transport: transport}
+	if name == summarizerProvider {
+		if providerConfig.APIKey == "" {
+			providerConfig.APIKey = cfg.Summarizer.ApiKey
+			providerConfig.APIKeys = cfg.Summarizer.ApiKeys
+			providerConfig.KeyRotation = cfg.Summarizer.KeyRotation
+		}
+		if providerConfig.ModelID == "" {
+			providerConfig.ModelID = cfg.Summarizer.ModelID
+		}
+	}
+	if providerConfig.APIKey == "" && len(providerConfig.APIKeys) == 0 {
+		providerConfig.APIKey = providers.EnvAPIKey(name)
+	}
+	if providerConfig.APIKey == "" && len(providerConfig.APIKeys) == 0 {
+		return nil, fmt.Errorf("missing API key for %s provider %s", stage, name)
+	}
+
+	provider, err := providers.NewProviderFactory(map[string]providers.Config{name: providerConfig}).GetProvider(name)
+	if err != nil {
+		return nil, err
+	}
+	completer, ok := provider.(providers.Completer)
+	if !ok {
+		return nil, fmt.Errorf("%s provider %s cannot answer prompts", stage, name)
+	}
+	return completer, nil
+}
+
+// aiSummarizerConfig builds the AI summarizer configuration from cfg. Zero
+// values take the summarizer package defaults.
+func aiSummarizerConfig(cfg *Config) (*summarizer.AISummarizerConfig, error) {
+	aiConfig := &summarizer.AISummarizerConfig{
+		ProviderName:     cfg.Summarizer.AIProvider,
+		ModelID:          cfg.Summarizer.ModelID,
+		APIKey:           cfg.Summarizer.ApiKey,
+		APIKeys:          cfg.Summarizer.ApiKeys,
+		KeyRotation:      cfg.Summarizer.KeyRotation,
+		PromptTemplate:   cfg.Summarizer.PromptTemplate,
+		MaxSummaryLength: cfg.Summarizer.MaxLength,
+		MaxInputLength:   cfg.Summarizer.MaxInputLength,
+		MaxInputTokens:   cfg.Summarizer.MaxInputTokens,
+		ChunkConcurrency: cfg.Summarizer.ChunkConcurrency,
+		MaxConcurrency:   cfg.Summarizer.MaxConcurrency,
+		Routing:          cfg.Summarizer.Routing,
+		MaxRetries:       cfg.Summarizer.MaxRetries,
+		CacheCapacity:    cfg.Summarizer.CacheCapacity,
+		CacheMaxBytes:    cfg.Summarizer.CacheMaxBytes,
+		MonthlyBudget:    cfg.Summarizer.MonthlyBudget,
+	}
+	if aiConfig.ProviderName == "" {
+		aiConfig.ProviderName = providers.ProviderAnthropic
+	}
+	if aiConfig.MonthlyBudget < 0 {
+		return nil, fmt.Errorf("invalid summarizer monthly_budget %v: must not be negative", aiConfig.MonthlyBudget)
+	}
+	if aiConfig.MaxInputTokens < 0 {
+		return nil, fmt.Errorf("invalid summarizer max_input_tokens %d: must not be negative", aiConfig.MaxInputTokens)
+	}
+
+	tok, err := tokenizer.New(cfg.Summarizer.Tokenizer, cfg.Summarizer.TokenizerFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid summarizer tokenizer: %w", err)
+	}
+	aiConfig.Tokenizer = tok
+
+	durations := []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"timeout", cfg.Summarizer.Timeout, &aiConfig.Timeout},
+		{"retry_delay", cfg.Summarizer.RetryDelay, &aiConfig.RetryDelay},
+		{"cache_ttl", cfg.Summarizer.CacheTTL, &aiConfig.CacheTTL},
+		{"routing_interval", cfg.Summarizer.RoutingInterval, &aiConfig.RoutingInterval},
+		{"hedge_delay", cfg.Summarizer.HedgeDelay, &aiConfig.HedgeDelay},
+		{"health_probe_interval", cfg.Summarizer.HealthProbeInterval, &aiConfig.HealthProbeInterval},
+	}
+	for _, duration := range durations {
+		if duration.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(duration.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid summarizer %s %q: %w", duration.name, duration.value, err)
+		}
+		*duration.dest = parsed
+	}
+
+	if len(cfg.Summarizer.Pricing) > 0 {
+		aiConfig.Pricing = make(map[string]summarizer.ModelPrice, len(cfg.Summarizer.Pricing))
+		for model, price := range cfg.Summarizer.Pricing {
+			aiConfig.Pricing[model] = summarizer.ModelPrice{Input: price.Input, Output: price.Output}
+		}
+	}
+
+	for _, fallbackCfg := range cfg.Summarizer.Fallbacks {
+		aiConfig.FallbackProviders = append(aiConfig.FallbackProviders, struct {
+			Name    string
+			ModelID string
+			APIKey  string
+			APIKeys []string
+		}{
+			Name:    fallbackCfg.Provider,
+			ModelID: fallbackCfg.ModelID,
+			APIKey:  fallbackCfg.ApiKey,
+			APIKeys: fallbackCfg.ApiKeys,
+		})
+	}
+	return aiConfig, nil
+}
+
+// HealthReporting builds the health report interval and sink from cfg. A
+// zero interval takes the server default.
+func HealthReporting(cfg *Config) (time.Duration, server.HealthSink, error) {
+	var interval time.Duration
+	if cfg.HealthReport.Interval != "" {
+		parsed, err := time.ParseDuration(cfg.HealthReport.Interval)
+		if err != nil {
+			return 0, nil, errortypes.ConfigError(err, "Invalid health report interval")
+		}
+		interval = parsed
+	}
+
+	switch cfg.HealthReport.Sink {
+	case "log":
+		return interval, server.LogHealthSink{}, nil
+	case "file":
+		if cfg.HealthReport.Path == "" {
+			return 0, nil, errortypes.ConfigError(errors.New("path is required"), "Invalid health report file sink")
+		}
+		return interval, server.FileHealthSink{Path: cfg.HealthReport.Path}, nil
+	case "http":
+		if cfg.HealthReport.URL == "" {
+			return 0, nil, errortypes.ConfigError(errors.New("url is required"), "Invalid health report http sink")
+		}
+		return interval, server.HTTPHealthSink{URL: cfg.HealthReport.URL}, nil
+	default:
+		return 0, nil, errortypes.ConfigError(fmt.Errorf("unknown sink %q", cfg.HealthReport.Sink), "Invalid health report sink")
+	}
+}
+
+// sinkLogger makes a LogHealthSink without a logger log to logger, the
+// server's own
+func sinkLogger(sink server.HealthSink, logger *slog.Logger) server.HealthSink {
+	if logSink, ok := sink.(server.LogHealthSink); ok && logSink.Logger == nil {
+		logSink.Logger = logger
+		return logSink
+	}
+	return sink
+}
+
+// UsageReporting builds the usage report interval and sink from cfg. A
+// zero interval takes the server default.
+func UsageReporting(cfg *Config) (time.Duration, server.HealthSink, error) {
+	var interval time.Duration
+	if cfg.UsageReport.Interval != "" {
+		parsed, err := time.ParseDuration(cfg.UsageReport.Interval)
+		if err != nil {
+			return 0, nil, errortypes.ConfigError(err, "Invalid usage report interval")
+		}
+		interval = parsed
+	}
+
+	switch cfg.UsageReport.Sink {
+	case "log":
+		return interval, server.LogHealthSink{Message: "Usage report"}, nil
+	case "file":
+		if cfg.UsageReport.Path == "" {
+			return 0, nil, errortypes.ConfigError(errors.New("path is required"), "Invalid usage report file sink")
+		}
+		return interval, server.FileHealthSink{Path: cfg.UsageReport.Path}, nil
+	case "http":
+		if cfg.UsageReport.URL == "" {
+			return 0, nil, errortypes.ConfigError(errors.New("url is required"), "Invalid usage report http sink")
+		}
+		contentType := "text/markdown; charset=utf-8"
+		if cfg.UsageReport.Format == analytics.FormatJSON {
+			contentType = "application/json"
+		}
+		return interval, server.HTTPHealthSink{URL: cfg.UsageReport.URL, ContentType: contentType}, nil
+	default:
+		return 0, nil, errortypes.ConfigError(fmt.Errorf("unknown sink %q", cfg.UsageReport.Sink), "Invalid usage report sink")
+	}
+}
+
+// CleanupPolicy builds the cleanup_report policy from cfg. Zero values
+// take the cleanup package defaults.
+func CleanupPolicy(cfg *Config) (cleanup.Policy, error) {
+	policy := cleanup.DefaultPolicy()
+	policy.AutoApply = cfg.Cleanup.AutoApply
+	policy.Options.MinScore = cfg.Cleanup.MinScore
+	policy.Options.DuplicateThreshold = cfg.Cleanup.DuplicateThreshold
+	if cfg.Cleanup.ApplyMinScore > 0 {
+		policy.ApplyMinScore = cfg.Cleanup.ApplyMinScore
+	}
+	if cfg.Cleanup.MaxDeletions > 0 {
+		policy.MaxDeletions = cfg.Cleanup.MaxDeletions
+	}
+	if cfg.Cleanup.MinAge != "" {
+		minAge, err := time.ParseDuration(cfg.Cleanup.MinAge)
+		if err != nil {
+			return policy, errortypes.ConfigError(err, "Invalid cleanup min age")
+		}
+		policy.Options.MinAge = minAge
+	}
+	return policy, nil
+}
+
+// ReviewOptions builds which entries review_queue flags from cfg. Zero
+// values take the cleanup package defaults.
+func ReviewOptions(cfg *Config) (cleanup.StaleOptions, error) {
+	if cfg.Review.MinAgeMonths < 0 || cfg.Review.MinRetrievals < 0 {
+		return cleanup.StaleOptions{}, errortypes.ConfigError(
+			errors.New("min_age_months and min_retrievals must not be negative"), "Invalid review options")
+	}
+	options := cleanup.StaleOptions{
+		MinAgeMonths:  cfg.Review.MinAgeMonths,
+		MinRetrievals: cfg.Review.MinRetrievals,
+	}
+	if cfg.Review.RecentWindow != "" {
+		window, err := time.ParseDuration(cfg.Review.RecentWindow)
+		if err != nil {
+			return options, errortypes.ConfigError(err, "Invalid review recent window")
+		}
+		options.RecentWindow = window
+	}
+	return options, nil
+}
+
+// RetrievalDefaults builds the retrieve_context defaults of each namespace
+// from cfg.
+func RetrievalDefaults(cfg *Config) (map[string]retrieval.Defaults, error) {
+	defaults := make(map[string]retrieval.Defaults, len(cfg.Retrieval.Namespaces))
+	for namespace, settings := range cfg.Retrieval.Namespaces {
+		d := retrieval.Defaults{
+			Limit:        settings.Limit,
+			MinScore:     settings.MinScore,
+			RecencyFloor: settings.RecencyFloor,
+			HybridWeights: retrieval.HybridWeights{
+				Vector:  settings.HybridWeights.Vector,
+				Keyword: settings.HybridWeights.Keyword,
+			},
+		}
+		if settings.RecencyHalfLife != "" {
+			halfLife, err := time.ParseDuration(settings.RecencyHalfLife)
+			if err != nil {
+				return nil, errortypes.ConfigError(err, "Invalid recency half-life").
+					WithField("namespace", namespace)
+			}
+			d.RecencyHalfLife = halfLife
+		}
+		defaults[namespace] = d
+	}
+	return defaults, nil
+}
+
+// Authenticator builds the authenticator of the quick-capture and gRPC
+// endpoints from the API keys, OIDC provider and client certificates in
+// cfg. It returns nil if none is configured.
+func Authenticator(cfg *Config) (auth.Authenticator, error) {
+	var authenticators []auth.Authenticator
+
+	if len(cfg.Auth.APIKeys) > 0 {
+		keys := make(map[string]auth.Identity, len(cfg.Auth.APIKeys))
+		for _, key := range cfg.Auth.APIKeys {
+			if key.Key == "" || len(key.Namespaces) == 0 {
+				return nil, errortypes.ConfigError(errors.New("API keys need a key and namespaces; use \"*\" for every namespace"), "Invalid API key").
+					WithField("subject", key.Subject)
+			}
+			keys[key.Key] = auth.Identity{Subject: key.Subject, Namespaces: slices.Clone(key.Namespaces)}
+		}
+		authenticators = append(authenticators, auth.NewAPIKeyAuthenticator(keys))
+	}
+
+	if cfg.Auth.OIDC.Issuer != "" {
+		oidc, err := auth.NewOIDCAuthenticator(auth.OIDCConfig{
+			Issuer:          cfg.Auth.OIDC.Issuer,
+			Audience:        cfg.Auth.OIDC.Audience,
+			JWKSURL:         cfg.Auth.OIDC.JWKSURL,
+			NamespacesClaim: cfg.Auth.OIDC.NamespacesClaim,
+		})
+		if err != nil {
+			return nil, errortypes.ConfigError(err, "Invalid OIDC configuration")
+		}
+		authenticators = append(authenticators, oidc)
+	}
+
+	if len(cfg.Auth.TLS.ClientNamespaces) > 0 {
+		if cfg.Auth.TLS.ClientCAFile == "" {
+			return nil, errortypes.ConfigError(errors.New("client_namespaces need client_ca_file"), "Invalid client certificate configuration")
+		}
+		for subject, namespaces := range cfg.Auth.TLS.ClientNamespaces {
+			if len(namespaces) == 0 {
+				return nil, errortypes.ConfigError(errors.New("client certificates need namespaces; use \"*\" for every namespace"), "Invalid client certificate configuration").
+					WithField("subject", subject)
+			}
+		}
+		authenticators = append(authenticators, auth.NewMTLSAuthenticator(cfg.Auth.TLS.ClientNamespaces))
+	}
+
+	if len(authenticators) == 0 {
+		return nil, nil
+	}
+	return auth.Chain(authenticators...), nil
+}
+
+// TransportTLS builds the TLS configuration of the quick-capture and gRPC
+// endpoints from cfg. It returns nil if no certificate is configured.
+func TransportTLS(cfg *Config) (*tls.Config, error) {
+	certFile, keyFile := cfg.Auth.TLS.CertFile, cfg.Auth.TLS.KeyFile
+	if certFile == "" && keyFile == "" {
+		if cfg.Auth.TLS.ClientCAFile != "" {
+			return nil, errortypes.ConfigError(errors.New("client_ca_file needs cert_file and key_file"), "Invalid TLS configuration")
+		}
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, errortypes.ConfigError(errors.New("cert_file and key_file must be set together"), "Invalid TLS configuration")
+	}
+	config, err := auth.ServerTLSConfig(certFile, keyFile, cfg.Auth.TLS.ClientCAFile)
+	if err != nil {
+		return nil, errortypes.ConfigError(err, "Invalid TLS configuration")
+	}
+	return config, nil
+}
+
+// Keyring builds the master keys and encrypted namespaces of the store from
+// cfg. It returns nil if no master key is configured.
+func Keyring(cfg *Config) (*contextstore.Keyring, error) {
+	if cfg.Store.MasterKeys == "" {
+		if len(cfg.Store.EncryptedNamespaces) > 0 {
+			return nil, errortypes.ConfigError(errors.New("encrypted namespaces need master_keys"), "Invalid encryption configuration")
+		}
+		return nil, nil
+	}
+	masterKeys, err := contextstore.ParseMasterKeys(cfg.Store.MasterKeys)
+	if err != nil {
+		return nil, errortypes.ConfigError(err, "Invalid master keys")
+	}
+	keyring, err := contextstore.NewKeyring(masterKeys, cfg.Store.EncryptedNamespaces)
+	if err != nil {
+		return nil, errortypes.ConfigError(err, "Invalid encryption configuration")
+	}
+	return keyring, nil
+}
+
 // GenerateHash creates a hash from the summary and a timestamp
 // This is a convenience wrapper around the internal util.GenerateHash function
 func GenerateHash(summary string, timestamp int64) string {
@@ -0,0 +1,199 @@
+package projectmemory
+
+import (
+	"context"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/retrieval"
+	"github.com/localrivet/projectmemory/internal/server"
+	"github.com/localrivet/projectmemory/internal/tools"
+)
+
+// Query is a search of the stored context run by Server.Query. Only Text,
+// or Queries, is required: zero fields leave the namespace's retrieval defaults, then
+// the server-wide defaults, in place. retrieve_context maps its request
+// fields onto the same query.
+type Query struct {
+	// Text is what to search for
+	Text string
+
+	// Queries are further texts, such as the subtopics of a task, each
+	// searched on its own like Text. Their results are merged by
+	// reciprocal rank fusion and scored by it.
+	Queries []string
+
+	// Namespace restricts the search to one namespace and selects whose
+	// retrieval defaults apply. Empty searches every namespace.
+	Namespace string
+
+	// Limit is the most results returned
+	Limit int
+
+	// MaxTokens bounds the tokens of the results' summaries together. The
+	// best results are kept while they fit, and without a Limit as many
+	// are considered as the server allows. 0 leaves the results unbounded.
+	MaxTokens int
+
+	// Adaptive returns fewer results than Limit when there is a sharp drop
+	// in relevance, and more when scores are flat
+	Adaptive bool
+
+	// MinScore drops results less similar to Text than this, between 0
+	// and 1
+	MinScore float64
+
+	// Tags restricts the search to entries carrying at least one of these
+	// tags, and ExcludeTags drops entries carrying any of them
+	Tags        []string
+	ExcludeTags []string
+
+	// Session restricts the search to the entries saved in one agent
+	// session with SaveContextInSession
+	Session string
+
+	// ExcludeIDs lists entries that must not be returned
+	ExcludeIDs []string
+
+	// Since and Until restrict the search to entries saved at or after
+	// Since and before Until. Either may be zero.
+	Since time.Time
+	Until time.Time
+
+	// KnownIDs and KnownHashes identify entries the caller already has, by
+	// ID or by the content hash of their summary. They are excluded unless
+	// DownrankKnown is set, which moves them behind the other results.
+	KnownIDs      []string
+	KnownHashes   []string
+	DownrankKnown bool
+
+	// Rerank has the server's LLM reranker pick the results from the best
+	// candidates. It fails if the server has no reranker.
+	Rerank bool
+
+	// Expand has the server's LLM query expander phrase Text in other
+	// ways, each searched as well. It fails if the server has no expander.
+	Expand bool
+
+	// Keyword searches the server's keyword index for the words of Text,
+	// scoring entries by BM25, without embedding it. It cannot be combined
+	// with MinScore, Expand, HyDE or hybrid weights.
+	Keyword bool
+
+	// HyDE has the server's LLM drafter write a hypothetical answer to
+	// Text, whose embedding is searched with in place of Text's. It fails
+	// if the server has no drafter.
+	HyDE bool
+
+	// RecencyHalfLife ranks newer entries higher, halving an entry's
+	// weight at this age, and RecencyFloor is the share of its weight kept
+	// however old it is. VectorWeight and KeywordWeight balance
+	// similarity and keyword matches. Zero keeps the namespace's ranking.
+	RecencyHalfLife time.Duration
+	RecencyFloor    float64
+	VectorWeight    float64
+	KeywordWeight   float64
+}
+
+// Result is an entry found by Server.Query
+type Result struct {
+	// ID identifies the entry. It is empty if the store cannot report IDs.
+	ID string `json:"id,omitempty"`
+
+	// Summary is the stored summary
+	Summary string `json:"summary"`
+
+	// Title is the one-line title of the summary. It is empty if the store
+	// records no title for the entry.
+	Title string `json:"title,omitempty"`
+
+	// Score is the entry's similarity to the query, or its ranking score
+	// if the namespace reranks results, or its fused score for several
+	// queries. It is 0 if the store cannot score results.
+	Score float64 `json:"score"`
+
+	// Pinned reports that the entry is pinned, so it comes first whatever
+	// its score
+	Pinned bool `json:"pinned,omitempty"`
+
+	// Tags are the entry's tags. They are empty if the store cannot hold
+	// them.
+	Tags []string `json:"tags"`
+
+	// Generation records what wrote the summary. It is nil if the store
+	// records no generation for the entry.
+	Generation *contextstore.Generation `json:"generation,omitempty"`
+
+	// Source is the file lines or commit the entry's content came from. It
+	// is nil for entries not ingested from a file or captured from a
+	// commit.
+	Source *contextstore.Origin `json:"source,omitempty"`
+}
+
+// Query runs q against the stored context, as retrieve_context does:
+// pinned entries come first and the namespace's retrieval defaults fill in
+// what q leaves out. An invalid query returns an error wrapping the error
+// of each invalid field, such as server.ErrMissingQuery. It returns an
+// error wrapping contextstore.ErrScoresUnsupported if q needs scores the
+// store cannot report, contextstore.ErrKeywordSearchUnsupported for a
+// keyword query on a store without a keyword index, or
+// contextstore.ErrSessionsUnsupported for a session on a store that cannot
+// track sessions.
+func (s *Server) Query(ctx context.Context, q Query) ([]Result, error) {
+	dedup := tools.DedupExclude
+	if q.DownrankKnown {
+		dedup = tools.DedupDownrank
+	}
+	mode := tools.SearchModeVector
+	if q.Keyword {
+		mode = tools.SearchModeKeyword
+	}
+	found, err := s.tools.Query(ctx, server.Query{
+		Text:            q.Text,
+		Queries:         q.Queries,
+		Namespace:       q.Namespace,
+		Limit:           q.Limit,
+		MaxTokens:       q.MaxTokens,
+		Adaptive:        q.Adaptive,
+		MinScore:        q.MinScore,
+		Tags:            q.Tags,
+		ExcludeTags:     q.ExcludeTags,
+		Session:         q.Session,
+		ExcludeIDs:      q.ExcludeIDs,
+		Since:           q.Since,
+		Until:           q.Until,
+		KnownIDs:        q.KnownIDs,
+		KnownHashes:     q.KnownHashes,
+		Dedup:           dedup,
+		RecencyHalfLife: q.RecencyHalfLife,
+		RecencyFloor:    q.RecencyFloor,
+		Rerank:          q.Rerank,
+		Expand:          q.Expand,
+		HyDE:            q.HyDE,
+		Mode:            mode,
+		HybridWeights:   retrieval.HybridWeights{Vector: q.VectorWeight, Keyword: q.KeywordWeight},
+	})
+	if err != nil {
+		s.logger.Error("Failed to query context", "query", q.Text, "error", err)
+		return nil, err
+	}
+
+	results := make([]Result, len(found))
+	for i, result := range found {
+		results[i] = Result{ID: result.ID, Summary: result.Summary, Score: result.Score, Pinned: result.Pinned, Tags: []string{}}
+		if result.ID == "" {
+			continue
+		}
+		entry, err := s.describe(result.ID)
+		if err != nil {
+			return nil, err
+		}
+		results[i].Title = entry.Title
+		results[i].Tags = entry.Tags
+		results[i].Generation = entry.Generation
+		results[i].Source = entry.Source
+	}
+
+	s.logger.Info("Queried context entries", "count", len(results))
+	return results, nil
+}
@@ -0,0 +1,44 @@
+//go:build !cgo || purego
+
+package projectmemory
+
+import (
+	"log/slog"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/errortypes"
+)
+
+// fileStoreSuffix is appended to the configured SQLite path to name the file
+// of the pure-Go store, so the two never open each other's files
+const fileStoreSuffix = ".gob"
+
+// openStore opens a contextstore.FileContextStore next to
+// cfg.Store.SQLitePath. This build has no SQLite, as it was built without
+// cgo or with the purego tag, so the pure-Go store stands in for it. It
+// cannot encrypt namespaces or batch writes.
+func openStore(cfg *Config, logger *slog.Logger) (contextstore.ContextStore, error) {
+	path := cfg.Store.SQLitePath + fileStoreSuffix
+	logger.Info("SQLite is not available in this build, using the pure-Go file store", "path", path)
+
+	keyring, err := Keyring(cfg)
+	if err != nil {
+		logger.Error("Invalid encryption configuration in CreateComponents", "error", err)
+		return nil, err
+	}
+	if keyring != nil {
+		logger.Error("Encrypted namespaces need SQLite", "namespaces", keyring.Namespaces())
+		return nil, errortypes.ConfigError(contextstore.ErrEncryptionUnsupported, "Encrypted namespaces need SQLite").
+			WithField("namespaces", keyring.Namespaces())
+	}
+	if cfg.Store.WriteBatchSize > 1 {
+		logger.Debug("Write batching only applies to SQLite", "write_batch_size", cfg.Store.WriteBatchSize)
+	}
+
+	store := contextstore.NewFileContextStore()
+	if err := store.Initialize(path); err != nil {
+		logger.Error("Failed to initialize file context store in CreateComponents", "path", path, "error", err)
+		return nil, errortypes.DatabaseError(err, "Failed to initialize file context store")
+	}
+	return store, nil
+}
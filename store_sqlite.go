@@ -0,0 +1,54 @@
+//go:build cgo && !purego
+
+package projectmemory
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/localrivet/projectmemory/internal/contextstore"
+	"github.com/localrivet/projectmemory/internal/errortypes"
+)
+
+// openStore opens the SQLite context store at cfg.Store.SQLitePath, with
+// the encrypted namespaces and write batching cfg asks for
+func openStore(cfg *Config, logger *slog.Logger) (contextstore.ContextStore, error) {
+	logger.Info("Initializing SQLite context store for CreateComponents", "path", cfg.Store.SQLitePath)
+	store := contextstore.NewSQLiteContextStore()
+	err := store.Initialize(cfg.Store.SQLitePath)
+	if err != nil {
+		logger.Error("Failed to initialize SQLite context store in CreateComponents", "path", cfg.Store.SQLitePath, "error", err)
+		return nil, errortypes.DatabaseError(err, "Failed to initialize SQLite context store")
+	}
+	keyring, err := Keyring(cfg)
+	if err != nil {
+		store.Close()
+		logger.Error("Invalid encryption configuration in CreateComponents", "error", err)
+		return nil, err
+	}
+	if keyring != nil {
+		if err := store.SetKeyring(keyring); err != nil {
+			store.Close()
+			logger.Error("Failed to set up encrypted namespaces in CreateComponents", "error", err)
+			return nil, errortypes.DatabaseError(err, "Failed to set up encrypted namespaces")
+		}
+		logger.Info("Encrypting namespaces", "namespaces", keyring.Namespaces())
+	}
+	if cfg.Store.WriteBatchSize > 1 {
+		var delay time.Duration
+		if cfg.Store.WriteBatchDelay != "" {
+			delay, err = time.ParseDuration(cfg.Store.WriteBatchDelay)
+			if err == nil && delay < 0 {
+				err = errors.New("delay must not be negative")
+			}
+			if err != nil {
+				store.Close()
+				logger.Error("Invalid write batch delay in CreateComponents", "write_batch_delay", cfg.Store.WriteBatchDelay, "error", err)
+				return nil, errortypes.ConfigError(err, "Invalid write batch delay")
+			}
+		}
+		store.SetWriteBatching(cfg.Store.WriteBatchSize, delay)
+	}
+	return store, nil
+}